@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
+	"github.com/gin-gonic/gin"
+)
+
+// Queries sent to the API with a rule are reports, e.g. a policy check run by a dashboard, and each resource they
+// return is a finding of the rule. Acknowledging a finding, with a justification and optionally an expiry, hides
+// the resource from the reports of the rule until the acknowledgement expires or is revoked, so that recurring
+// reports only show new or unacknowledged findings.
+
+type acknowledgement struct {
+	ID string `json:"id"`
+	// UID is the UID of the resource, as reports return it in _uid
+	UID           string `json:"uid"`
+	Rule          string `json:"rule"`
+	Justification string `json:"justification"`
+	// ExpiresAt is when the finding is reported again, never if it's nil
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// By is the user who acknowledged the finding, empty when the server doesn't authenticate requests
+	By        string    `json:"by,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (a *acknowledgement) validate(now time.Time) error {
+	if a.UID == "" || a.Rule == "" {
+		return errors.New("an acknowledgement needs the uid of a resource and a rule")
+	}
+	if a.Justification == "" {
+		return errors.New("an acknowledgement needs a justification")
+	}
+	if a.ExpiresAt != nil && !a.ExpiresAt.After(now) {
+		return errors.New("expiresAt must be in the future")
+	}
+	return nil
+}
+
+func (a *acknowledgement) expired(now time.Time) bool {
+	return a.ExpiresAt != nil && !a.ExpiresAt.After(now)
+}
+
+// acknowledgementStore keeps the acknowledgements in the acknowledgements document of a state store, which is read
+// on first use and written on every change. Expired acknowledgements are dropped when it's written.
+type acknowledgementStore struct {
+	store stateStore
+
+	mu               sync.Mutex
+	loaded           bool
+	acknowledgements map[string]*acknowledgement
+}
+
+// acknowledgementsFile is the file of the acknowledgements of the file store, ~/.cyphernetes/acknowledgements.json by default
+var acknowledgementsFile string
+
+var acknowledgements = &acknowledgementStore{}
+
+func (s *acknowledgementStore) load() error {
+	if s.loaded {
+		return nil
+	}
+	if s.store == nil {
+		s.store = serverState()
+	}
+	var list []*acknowledgement
+	if err := s.store.Load("acknowledgements", &list); err != nil {
+		return err
+	}
+	s.acknowledgements = map[string]*acknowledgement{}
+	for _, a := range list {
+		s.acknowledgements[a.ID] = a
+	}
+	s.loaded = true
+	return nil
+}
+
+func (s *acknowledgementStore) save(now time.Time) error {
+	for id, a := range s.acknowledgements {
+		if a.expired(now) {
+			delete(s.acknowledgements, id)
+		}
+	}
+	return s.store.Save("acknowledgements", s.active("", now))
+}
+
+// active lists the acknowledgements of a rule, or of every rule if it's empty, that haven't expired, oldest first
+func (s *acknowledgementStore) active(rule string, now time.Time) []*acknowledgement {
+	list := []*acknowledgement{}
+	for _, a := range s.acknowledgements {
+		if (rule == "" || a.Rule == rule) && !a.expired(now) {
+			list = append(list, a)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].CreatedAt.Before(list[j].CreatedAt)
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// hider returns a parser.QueryExecutor Hide function hiding the resources whose findings of the rule are acknowledged
+func (s *acknowledgementStore) hider(rule string, now time.Time) (func(uid string) bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	uids := map[string]bool{}
+	for _, a := range s.active(rule, now) {
+		uids[a.UID] = true
+	}
+	return func(uid string) bool { return uids[uid] }, nil
+}
+
+func handleListAcknowledgements(c *gin.Context) {
+	acknowledgements.mu.Lock()
+	defer acknowledgements.mu.Unlock()
+	if err := acknowledgements.load(); err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	c.JSON(http.StatusOK, acknowledgements.active(c.Query("rule"), time.Now()))
+}
+
+func handleCreateAcknowledgement(c *gin.Context) {
+	var a acknowledgement
+	if err := c.BindJSON(&a); err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	now := time.Now()
+	if err := a.validate(now); err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	acknowledgements.mu.Lock()
+	defer acknowledgements.mu.Unlock()
+	if err := acknowledgements.load(); err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	id, err := newRecordID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	a.ID, a.By, a.CreatedAt = id, "", now.UTC()
+	if identity := requestIdentity(c); identity != nil {
+		a.By = identity.User
+	}
+	acknowledgements.acknowledgements[a.ID] = &a
+	if err := acknowledgements.save(now); err != nil {
+		delete(acknowledgements.acknowledgements, a.ID)
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	parser.Logger().Info("Finding acknowledged", "rule", a.Rule, "uid", a.UID, "by", a.By, "justification", a.Justification)
+	c.JSON(http.StatusCreated, a)
+}
+
+// handleDeleteAcknowledgement revokes an acknowledgement, its finding is reported again
+func handleDeleteAcknowledgement(c *gin.Context) {
+	acknowledgements.mu.Lock()
+	defer acknowledgements.mu.Unlock()
+	if err := acknowledgements.load(); err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	a, ok := acknowledgements.acknowledgements[c.Param("id")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "acknowledgement not found"})
+		return
+	}
+	delete(acknowledgements.acknowledgements, a.ID)
+	if err := acknowledgements.save(time.Now()); err != nil {
+		acknowledgements.acknowledgements[a.ID] = a
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	by := ""
+	if identity := requestIdentity(c); identity != nil {
+		by = identity.User
+	}
+	parser.Logger().Info("Acknowledgement revoked", "rule", a.Rule, "uid", a.UID, "by", by)
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAcknowledgements(t *testing.T) {
+	originalAuthenticators, originalAcknowledgements := apiAuthenticators, acknowledgements
+	defer func() { apiAuthenticators, acknowledgements = originalAuthenticators, originalAcknowledgements }()
+	apiAuthenticators = []authenticator{&staticTokenAuthenticator{tokens: map[string]*apiIdentity{
+		"alice": {User: "alice"},
+	}}}
+	store := &fileStore{dir: t.TempDir()}
+	acknowledgements = &acknowledgementStore{store: store}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	setupAPIRoutes(router)
+
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	for _, body := range []string{
+		`{"rule": "no-latest-tag", "justification": "pinned"}`,
+		`{"uid": "uid-web", "rule": "no-latest-tag"}`,
+		`{"uid": "uid-web", "rule": "no-latest-tag", "justification": "pinned", "expiresAt": "` + past + `"}`,
+	} {
+		if w := apiRequest(router, "alice", http.MethodPost, "/api/acknowledgements", body); w.Code != http.StatusBadRequest {
+			t.Errorf("expected %s to be rejected, got %d", body, w.Code)
+		}
+	}
+
+	future := time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339)
+	w := apiRequest(router, "alice", http.MethodPost, "/api/acknowledgements",
+		`{"uid": "uid-web", "rule": "no-latest-tag", "justification": "Pinned by the vendor", "expiresAt": "`+future+`"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected the finding to be acknowledged, got %d: %s", w.Code, w.Body.String())
+	}
+	var saved acknowledgement
+	json.Unmarshal(w.Body.Bytes(), &saved)
+	if saved.ID == "" || saved.By != "alice" || saved.CreatedAt.IsZero() {
+		t.Errorf("unexpected acknowledgement %+v", saved)
+	}
+	apiRequest(router, "alice", http.MethodPost, "/api/acknowledgements",
+		`{"uid": "uid-api", "rule": "resource-limits", "justification": "Batch job"}`)
+
+	var list []acknowledgement
+	json.Unmarshal(apiRequest(router, "alice", http.MethodGet, "/api/acknowledgements?rule=no-latest-tag", "").Body.Bytes(), &list)
+	if len(list) != 1 || list[0].UID != "uid-web" {
+		t.Errorf("expected the rule's acknowledgement, got %+v", list)
+	}
+
+	// Findings are hidden from the reports of their rule only, until the acknowledgement expires
+	hide, err := acknowledgements.hider("no-latest-tag", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hide("uid-web") || hide("uid-api") {
+		t.Errorf("expected only uid-web to be hidden")
+	}
+	hide, _ = acknowledgements.hider("no-latest-tag", time.Now().Add(48*time.Hour))
+	if hide("uid-web") {
+		t.Errorf("expected the acknowledgement to have expired")
+	}
+
+	// Acknowledgements are kept in the file, until they're revoked
+	acknowledgements = &acknowledgementStore{store: store}
+	if w := apiRequest(router, "alice", http.MethodDelete, "/api/acknowledgements/"+saved.ID, ""); w.Code != http.StatusNoContent {
+		t.Errorf("expected the acknowledgement to be revoked, got %d", w.Code)
+	}
+	if w := apiRequest(router, "alice", http.MethodDelete, "/api/acknowledgements/"+saved.ID, ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected the acknowledgement to be gone, got %d", w.Code)
+	}
+	json.Unmarshal(apiRequest(router, "alice", http.MethodGet, "/api/acknowledgements", "").Body.Bytes(), &list)
+	if len(list) != 1 || list[0].Rule != "resource-limits" {
+		t.Errorf("expected the other acknowledgement to be left, got %+v", list)
+	}
+}
@@ -1,76 +1,212 @@
 package main
 
 import (
+	"context"
+	_ "embed"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/avitaltamir/cyphernetes/pkg/parser"
 	"github.com/gin-gonic/gin"
 )
 
+// openAPISpec is the OpenAPI document of the API, the client SDKs of sdk/ are written against it
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
 type QueryRequest struct {
 	Query string `json:"query"`
+	// Rule, if set, runs the query as a report of the rule, leaving out the findings acknowledged for it. Without a
+	// query, the rule's query in the server's policies is run.
+	Rule string `json:"rule,omitempty"`
+	// Scheduled marks the query as one run again on a schedule, e.g. by a dashboard, which yields to interactive ones
+	Scheduled bool `json:"scheduled,omitempty"`
+	// Parameters are the values of the query's $parameters
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+	// Rows, if set, also returns the results of RETURN as rows, like --rows
+	Rows bool `json:"rows,omitempty"`
 }
 
 type QueryResponse struct {
 	Result string      `json:"result"`
 	Graph  interface{} `json:"graph"`
+	// Acknowledged is the number of acknowledged findings left out of the result of a report
+	Acknowledged int `json:"acknowledged,omitempty"`
+	// Rows are the rows of RETURN as a JSON array, for requests asking for them
+	Rows string `json:"rows,omitempty"`
 }
 
 func setupAPIRoutes(router *gin.Engine) {
+	// The document is public, for clients to be generated from a running server
+	router.GET("/api/openapi.json", handleOpenAPI)
+
 	api := router.Group("/api")
+	// Authentication may be configured once the server runs, by reloading its configuration
+	api.Use(authMiddleware())
 	{
 		api.POST("/query", handleQuery)
 		api.GET("/autocomplete", handleAutocomplete)
 		api.GET("/convert-resource-name", handleConvertResourceName)
+		api.GET("/watch", handleWatch)
+		api.GET("/schema", handleSchema)
+		api.GET("/policies", handleListPolicies)
+		api.GET("/dashboards", handleListDashboards)
+		api.POST("/dashboards", handleCreateDashboard)
+		api.GET("/dashboards/:id", handleGetDashboard)
+		api.PUT("/dashboards/:id", handleUpdateDashboard)
+		api.DELETE("/dashboards/:id", handleDeleteDashboard)
+		api.GET("/acknowledgements", handleListAcknowledgements)
+		api.POST("/acknowledgements", handleCreateAcknowledgement)
+		api.DELETE("/acknowledgements/:id", handleDeleteAcknowledgement)
+		api.GET("/admin/state", handleExportState)
+		api.PUT("/admin/state", handleRestoreState)
 	}
 }
 
 func handleQuery(c *gin.Context) {
 	var req QueryRequest
 	if err := c.BindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, errorResponse(err))
 		return
 	}
-	executor := parser.GetQueryExecutorInstance()
 
-	namespace := "default"
+	if req.Query == "" && req.Rule != "" {
+		rule, ok := policyRule(req.Rule)
+		if !ok {
+			c.JSON(http.StatusBadRequest, errorResponse(errUnknownRule))
+			return
+		}
+		req.Query = rule.Query
+	}
+
+	class := interactiveQuery
+	if req.Scheduled {
+		class = scheduledQuery
+	}
+	release, err := scheduler.acquire(c.Request.Context(), class)
+	if err != nil {
+		if errors.Is(err, errQueryQueueFull) {
+			c.JSON(http.StatusServiceUnavailable, errorResponse(err))
+		}
+		return
+	}
+	defer release()
+	endQuery := metrics.startQuery()
 
 	ast, err := parser.ParseQuery(req.Query)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		metrics.queryErrors.WithLabelValues("parse").Inc()
+		endQuery(0, err)
+		recordQuery("web", nil, err)
+		c.JSON(parseErrorStatus(err), errorResponse(err))
+		return
+	}
+
+	shared, releaseExecutor, err := requestExecutor(c)
+	if err != nil {
+		endQuery(0, err)
+		recordQuery("web", ast, err)
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	defer releaseExecutor()
+	// The query is authorized with the values of its parameters
+	bound, err := parser.BindParameters(ast, req.Parameters)
+	if err != nil {
+		endQuery(0, err)
+		recordQuery("web", ast, err)
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	ast = bound
+	// The query runs on a fork of its own, alongside the other requests
+	executor := shared.Fork()
+	namespace := "default"
+	if err := authorizeQuery(c, executor, req.Query, ast, namespace); err != nil {
+		endQuery(0, err)
+		recordQuery("web", ast, err)
+		c.JSON(authorizationStatus(err), errorResponse(err))
+		return
+	}
+
+	if req.Rule != "" {
+		hide, err := acknowledgements.hider(req.Rule, time.Now())
+		if err != nil {
+			endQuery(0, err)
+			c.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+		executor.Hide = hide
+	}
+	executor.Rows = req.Rows
+
+	// The query is planned once by the executor of the request, and run with the parameters of each request
+	prepared, err := shared.Prepare(req.Query)
+	if err != nil {
+		endQuery(0, err)
+		recordQuery("web", ast, err)
+		c.JSON(parseErrorStatus(err), errorResponse(err))
 		return
 	}
 
 	// Execute the query using the parser
-	result, err := executor.Execute(ast, namespace)
+	// Stop the query if the client goes away, or once it runs past the server's deadline
+	ctx := c.Request.Context()
+	serverConfigMutex.RLock()
+	timeout := webQueryTimeout
+	serverConfigMutex.RUnlock()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	result, err := executor.ExecutePrepared(ctx, prepared, req.Parameters, namespace)
+	endQuery(executor.APICalls(), err)
+	recordQuery("web", ast, err)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(queryErrorStatus(err), errorResponse(err))
 		return
 	}
 
 	// marshal the result.Data and result.Graph to json
 	resultData, err := json.Marshal(result.Data)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
 		return
 	}
 
 	sanitizedGraph, err := sanitizeGraph(result.Graph, string(resultData))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
 		return
 	}
 	resultGraph, err := json.Marshal(sanitizedGraph)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
 		return
 	}
 
 	response := QueryResponse{
-		Result: string(resultData),
-		Graph:  string(resultGraph),
+		Result:       string(resultData),
+		Graph:        string(resultGraph),
+		Acknowledged: result.Hidden,
+	}
+	if req.Rows {
+		rows := result.Rows
+		if rows == nil {
+			// Queries without a RETURN clause have no rows
+			rows = []map[string]interface{}{}
+		}
+		resultRows, err := json.Marshal(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errorResponse(err))
+			return
+		}
+		response.Rows = string(resultRows)
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -109,9 +245,61 @@ func handleConvertResourceName(c *gin.Context) {
 	// Use the FindGVR function to get the singular form
 	gvr, err := parser.FindGVR(executor.Clientset, resourceName)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, errorResponse(err))
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"singular": gvr.Resource})
 }
+
+// handleSchema returns the kinds of the cluster and the relationships between them, for the schema browser
+func handleSchema(c *gin.Context) {
+	executor, release, err := requestExecutor(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	defer release()
+	schema, err := parser.GetSchema(executor.Clientset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	c.JSON(http.StatusOK, schema)
+}
+
+func handleOpenAPI(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json", openAPISpec)
+}
+
+// parseErrorStatus is the status of a query that failed to parse: forbidden if the server is read-only and the
+// query would make changes, otherwise a bad request
+func parseErrorStatus(err error) int {
+	if parser.DiagnosticCodeOf(err) == parser.CodeReadOnly {
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
+}
+
+// queryErrorStatus is the status of a query that failed: a gateway timeout if it, or one of its list calls, ran
+// past its deadline, otherwise an internal server error
+func queryErrorStatus(err error) int {
+	switch parser.DiagnosticCodeOf(err) {
+	case parser.CodeTimedOut, parser.CodeListTimedOut:
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+// errorResponse is the body of an API error: the message, along with its code and details if it has one
+func errorResponse(err error) gin.H {
+	response := gin.H{"error": err.Error()}
+	var diagnostic *parser.DiagnosticError
+	if errors.As(err, &diagnostic) {
+		response["code"] = diagnostic.Code
+		if len(diagnostic.Details) > 0 {
+			response["details"] = diagnostic.Details
+		}
+	}
+	return response
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOpenAPISpecCoversRoutes(t *testing.T) {
+	var spec struct {
+		Paths map[string]map[string]interface{} `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatalf("invalid OpenAPI document: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	setupAPIRoutes(router)
+	for _, route := range router.Routes() {
+		if !strings.HasPrefix(route.Path, "/api/") {
+			continue
+		}
+		if _, ok := spec.Paths[openAPIPath(route.Path)][strings.ToLower(route.Method)]; !ok {
+			t.Errorf("%s %s isn't documented by openapi.json", route.Method, route.Path)
+		}
+	}
+	for path, operations := range spec.Paths {
+		for method := range operations {
+			found := false
+			for _, route := range router.Routes() {
+				found = found || (openAPIPath(route.Path) == path && strings.ToLower(route.Method) == method)
+			}
+			if !found && method != "parameters" {
+				t.Errorf("openapi.json documents %s %s, which isn't served", method, path)
+			}
+		}
+	}
+}
+
+// openAPIPath writes the parameters of a route's path the OpenAPI way, e.g. /api/dashboards/{id}
+func openAPIPath(path string) string {
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, ":") {
+			parts[i] = "{" + part[1:] + "}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+func TestOpenAPISpecIsPublic(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	saved := apiAuthenticators
+	defer func() { apiAuthenticators = saved }()
+	apiAuthenticators = []authenticator{&staticTokenAuthenticator{tokens: map[string]*apiIdentity{}}}
+
+	router := gin.New()
+	setupAPIRoutes(router)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("expected the document without authenticating, got %d %s", recorder.Code, recorder.Header().Get("Content-Type"))
+	}
+}
+
+func TestWatchParseError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	setupAPIRoutes(router)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/watch?query=MATCH+(p:Pod", nil))
+	if recorder.Code != http.StatusBadRequest || !strings.Contains(recorder.Body.String(), `"code":"CYP-0001"`) {
+		t.Errorf("expected a parse error response, got %d %s", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestWriteWatchEvent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	writeWatchEvent(c, "added", "42", watchEvent{Node: "p", Key: "uid", Data: map[string]interface{}{"name": "web"}, ResumeToken: "42"})
+	writeWatchEvent(c, "heartbeat", "", watchEvent{ResumeToken: "42"})
+	expected := "id: 42\nevent: added\ndata: {\"node\":\"p\",\"key\":\"uid\",\"data\":{\"name\":\"web\"},\"resumeToken\":\"42\"}\n\n" +
+		"event: heartbeat\ndata: {\"resumeToken\":\"42\"}\n\n"
+	if recorder.Body.String() != expected {
+		t.Errorf("unexpected stream %q", recorder.Body.String())
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// An audit policy is a set of rules, each a query whose returned resources are the rule's findings (its
+// violations). The audit command keeps the findings of each run in the state store, or a state file, and reports
+// how they changed since the previous run, so that scheduled compliance jobs only tell teams about new and resolved findings.
+// Findings acknowledged for a rule (see acknowledgement.go) aren't reported until their acknowledgement expires,
+// when they are reported as new again.
+
+type auditPolicy struct {
+	Name  string      `yaml:"name"`
+	Rules []auditRule `yaml:"rules"`
+}
+
+type auditRule struct {
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description" json:"description,omitempty"`
+	Query       string `yaml:"query" json:"query"`
+}
+
+// Finding states in an audit report
+const (
+	findingNew        = "new"
+	findingResolved   = "resolved"
+	findingPersisting = "persisting"
+)
+
+var findingStates = []string{findingNew, findingResolved, findingPersisting}
+
+// auditFinding is a row returned by a rule's query
+type auditFinding struct {
+	// Key is the UID of the row's resource, or the row's values for rows that aren't of a resource, e.g. UNWIND's
+	Key       string                 `json:"key"`
+	Status    string                 `json:"status,omitempty"`
+	FirstSeen time.Time              `json:"firstSeen"`
+	Row       map[string]interface{} `json:"row"`
+}
+
+// auditState holds the findings of the last run of a policy, by rule and key
+type auditState struct {
+	RanAt    time.Time                           `json:"ranAt"`
+	Findings map[string]map[string]*auditFinding `json:"findings"`
+}
+
+type auditReport struct {
+	Policy string    `json:"policy"`
+	RanAt  time.Time `json:"ranAt"`
+	// PreviousRun is when the findings were compared to were found, unset on the first run
+	PreviousRun *time.Time        `json:"previousRun,omitempty"`
+	Rules       []auditRuleReport `json:"rules"`
+}
+
+type auditRuleReport struct {
+	Rule         string          `json:"rule"`
+	Description  string          `json:"description,omitempty"`
+	New          int             `json:"new"`
+	Resolved     int             `json:"resolved"`
+	Persisting   int             `json:"persisting"`
+	Acknowledged int             `json:"acknowledged,omitempty"`
+	Findings     []*auditFinding `json:"findings"`
+}
+
+var (
+	auditStateFile string
+	auditShow      []string
+)
+
+var executeAuditRule = queryAuditRule
+
+var auditCmd = &cobra.Command{
+	Use:   "audit <policy file>",
+	Short: "Run the rules of a policy and report how their findings changed since the last run",
+	Long: `Use the 'audit' subcommand to run a policy: a YAML file of rules, each a query returning the resources that
+violate it. The findings of every run are kept in a state file, and each run reports the findings that are new since
+the previous run and those that were resolved, or with --show also those that persist.`,
+	Example: `  cyphernetes audit policy.yaml
+  cyphernetes audit policy.yaml --state /var/lib/audit/policy.json --show new,resolved,persisting`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		policy, err := loadAuditPolicy(args[0])
+		if err != nil {
+			return fmt.Errorf("error loading policy >> %w", err)
+		}
+		executor = parser.GetQueryExecutorInstance()
+		if executor == nil {
+			return errNoQueryExecutor
+		}
+		parser.CleanOutput = true
+		initResourceSpecsOrWarn()
+		store, err := openStateStore(storeURL)
+		if err != nil {
+			return fmt.Errorf("error opening store >> %w", err)
+		}
+		defer store.Close()
+		stateStorage = store
+		name := auditPolicyName(policy, args[0])
+		auditStore := store
+		if auditStateFile != "" {
+			auditStore = &fileStore{files: map[string]string{auditDocument(name): auditStateFile}}
+		}
+		return runAudit(policy, name, auditStore, time.Now(), os.Stdout)
+	},
+}
+
+func loadAuditPolicy(filename string) (*auditPolicy, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return parseAuditPolicy(data)
+}
+
+func parseAuditPolicy(data []byte) (*auditPolicy, error) {
+	policy := &auditPolicy{}
+	if err := yaml.UnmarshalStrict(data, policy); err != nil {
+		return nil, err
+	}
+	if len(policy.Rules) == 0 {
+		return nil, fmt.Errorf("policy has no rules")
+	}
+	names := map[string]bool{}
+	for i, rule := range policy.Rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("rule %d: needs a name", i+1)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("rule %d: duplicate rule name %s", i+1, rule.Name)
+		}
+		names[rule.Name] = true
+		if rule.Query == "" {
+			return nil, fmt.Errorf("rule %s: needs a query", rule.Name)
+		}
+		if _, err := parser.ParseQuery(rule.Query); err != nil {
+			return nil, fmt.Errorf("rule %s: error parsing query >> %w", rule.Name, err)
+		}
+	}
+	return policy, nil
+}
+
+// auditDocument is the name of the document keeping the findings of a policy's last run
+func auditDocument(policyName string) string {
+	return "audit/" + policyName
+}
+
+// auditPolicyName is the policy's name, or else the name of its file
+func auditPolicyName(policy *auditPolicy, filename string) string {
+	if policy.Name != "" {
+		return policy.Name
+	}
+	return strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+}
+
+// runAudit runs every rule of the policy, compares their findings with those of its last run and writes the
+// report. The state is only updated once every rule ran, so a failed run is compared against again.
+func runAudit(policy *auditPolicy, name string, store stateStore, now time.Time, w io.Writer) error {
+	for _, state := range auditShow {
+		if !slices.Contains(findingStates, state) {
+			return fmt.Errorf("unknown finding state %q in --show, expected %s", state, strings.Join(findingStates, ", "))
+		}
+	}
+
+	var previous auditState
+	if err := store.Load(auditDocument(name), &previous); err != nil {
+		return err
+	}
+	current := auditState{RanAt: now.UTC(), Findings: map[string]map[string]*auditFinding{}}
+	report := auditReport{Policy: name, RanAt: current.RanAt, Rules: []auditRuleReport{}}
+	if !previous.RanAt.IsZero() {
+		report.PreviousRun = &previous.RanAt
+	}
+
+	for _, rule := range policy.Rules {
+		findings, acknowledged, err := executeAuditRule(rule, now)
+		if err != nil {
+			return fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+		ruleReport := auditRuleReport{Rule: rule.Name, Description: rule.Description, Acknowledged: len(acknowledged), Findings: []*auditFinding{}}
+		seen := previous.Findings[rule.Name]
+		current.Findings[rule.Name] = map[string]*auditFinding{}
+		for _, finding := range findings {
+			finding.Status, finding.FirstSeen = findingNew, current.RanAt
+			if earlier, ok := seen[finding.Key]; ok {
+				finding.Status, finding.FirstSeen = findingPersisting, earlier.FirstSeen
+			}
+			current.Findings[rule.Name][finding.Key] = finding
+			ruleReport.add(finding)
+		}
+		// Acknowledged findings aren't resolved, nor kept: they are new again once their acknowledgement expires
+		for key, finding := range seen {
+			if _, ok := current.Findings[rule.Name][key]; !ok && !slices.Contains(acknowledged, key) {
+				finding.Status = findingResolved
+				ruleReport.add(finding)
+			}
+		}
+		sort.SliceStable(ruleReport.Findings, func(i, j int) bool {
+			a, b := ruleReport.Findings[i], ruleReport.Findings[j]
+			if a.Status != b.Status {
+				return slices.Index(findingStates, a.Status) < slices.Index(findingStates, b.Status)
+			}
+			return a.Key < b.Key
+		})
+		report.Rules = append(report.Rules, ruleReport)
+	}
+
+	// The status of a finding is only meaningful in a report
+	for _, findings := range current.Findings {
+		for _, finding := range findings {
+			stored := *finding
+			stored.Status = ""
+			findings[finding.Key] = &stored
+		}
+	}
+	if err := store.Save(auditDocument(name), current); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, string(data))
+	return nil
+}
+
+// add counts a finding, and lists it if its state is shown
+func (r *auditRuleReport) add(finding *auditFinding) {
+	switch finding.Status {
+	case findingNew:
+		r.New++
+	case findingResolved:
+		r.Resolved++
+	case findingPersisting:
+		r.Persisting++
+	}
+	if slices.Contains(auditShow, finding.Status) {
+		r.Findings = append(r.Findings, finding)
+	}
+}
+
+// queryAuditRule runs a rule's query, returning its findings apart from those acknowledged for the rule, and the
+// keys of the acknowledged ones
+func queryAuditRule(rule auditRule, now time.Time) ([]*auditFinding, []string, error) {
+	ast, err := parser.ParseQuery(rule.Query)
+	if err != nil {
+		recordQuery("audit", nil, err)
+		return nil, nil, fmt.Errorf("error parsing query >> %w", err)
+	}
+	acknowledged, err := acknowledgements.hider(rule.Name, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Hiding nothing still has the rows carry the UIDs of their resources
+	ruleExecutor := parser.GetQueryExecutorInstance()
+	ruleExecutor.Hide = func(string) bool { return false }
+	defer func() { ruleExecutor.Hide = nil }()
+	results, err := ruleExecutor.Execute(ast, "")
+	recordQuery("audit", ast, err)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error executing query >> %w", err)
+	}
+
+	// Round-trip through JSON so findings hold the same plain types as those read from the state file
+	data, err := json.Marshal(results.Data)
+	if err != nil {
+		return nil, nil, err
+	}
+	var normalized map[string]interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return nil, nil, err
+	}
+	findings := []*auditFinding{}
+	acknowledgedKeys := []string{}
+	for _, finding := range auditFindings(normalized) {
+		if acknowledged(finding.Key) {
+			acknowledgedKeys = append(acknowledgedKeys, finding.Key)
+			continue
+		}
+		findings = append(findings, finding)
+	}
+	return findings, acknowledgedKeys, nil
+}
+
+// auditFindings are the rows of a query's results, one per resource
+func auditFindings(data map[string]interface{}) []*auditFinding {
+	findings := []*auditFinding{}
+	keys := map[string]bool{}
+	nodeIds := []string{}
+	for nodeId := range data {
+		if nodeId != "aggregate" {
+			nodeIds = append(nodeIds, nodeId)
+		}
+	}
+	sort.Strings(nodeIds)
+	for _, nodeId := range nodeIds {
+		rows, _ := data[nodeId].([]interface{})
+		for _, row := range rows {
+			values, ok := row.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			key, _ := values["_uid"].(string)
+			delete(values, "_uid")
+			if key == "" {
+				encoded, _ := json.Marshal(values)
+				key = string(encoded)
+			}
+			if keys[key] {
+				continue
+			}
+			keys[key] = true
+			findings = append(findings, &auditFinding{Key: key, Row: map[string]interface{}{nodeId: values}})
+		}
+	}
+	return findings
+}
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+	auditCmd.Flags().StringVar(&auditStateFile, "state", "", "File keeping the findings of the last run, instead of the store (default: ~/.cyphernetes/audit/<policy name>.json)")
+	auditCmd.Flags().StringVar(&storeURL, "store", "file", "Where the findings of the last run and the acknowledgements are kept (file, memory, sqlite:<path>, postgres://<url>)")
+	auditCmd.Flags().StringSliceVar(&auditShow, "show", []string{findingNew, findingResolved}, "Findings to list in the report (new, resolved, persisting)")
+	auditCmd.Flags().StringVar(&acknowledgementsFile, "acknowledgements-file", "", "File of the acknowledged findings of the file store, which aren't reported (default: ~/.cyphernetes/acknowledgements.json)")
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+const testAuditPolicy = `
+name: baseline
+rules:
+  - name: failed-pods
+    description: Pods must not fail
+    query: MATCH (p:Pod) WHERE p.status.phase = "Failed" RETURN p.metadata.name
+  - name: single-replica
+    query: MATCH (d:Deployment) WHERE d.spec.replicas < 2 RETURN d.metadata.name
+`
+
+func TestParseAuditPolicy(t *testing.T) {
+	policy, err := parseAuditPolicy([]byte(testAuditPolicy))
+	if err != nil {
+		t.Fatalf("parseAuditPolicy() error = %v", err)
+	}
+	if policy.Name != "baseline" || len(policy.Rules) != 2 || policy.Rules[0].Description != "Pods must not fail" {
+		t.Errorf("unexpected policy %+v", policy)
+	}
+
+	for _, policy := range []string{
+		`name: empty`,
+		`rules: [{query: "MATCH (p:Pod) RETURN p"}]`,
+		`rules: [{name: pods, query: "MATCH (p:Pod) RETURN p"}, {name: pods, query: "MATCH (p:Pod) RETURN p"}]`,
+		`rules: [{name: pods}]`,
+		`rules: [{name: pods, query: "MATCH (p:Pod RETURN p"}]`,
+		`rules: [{name: pods, query: "MATCH (p:Pod) RETURN p", severity: high}]`,
+	} {
+		if _, err := parseAuditPolicy([]byte(policy)); err == nil {
+			t.Errorf("expected %q to be rejected", policy)
+		}
+	}
+}
+
+// stubAuditRule makes every rule find the given keys, acknowledging those of acknowledged
+func stubAuditRule(t *testing.T, found map[string][]string, acknowledged map[string][]string, fail error) {
+	originalExecuteAuditRule := executeAuditRule
+	t.Cleanup(func() { executeAuditRule = originalExecuteAuditRule })
+	executeAuditRule = func(rule auditRule, now time.Time) ([]*auditFinding, []string, error) {
+		if fail != nil {
+			return nil, nil, fail
+		}
+		findings := []*auditFinding{}
+		for _, key := range found[rule.Name] {
+			findings = append(findings, &auditFinding{Key: key, Row: map[string]interface{}{"p": map[string]interface{}{"name": key}}})
+		}
+		return findings, acknowledged[rule.Name], nil
+	}
+}
+
+func runTestAudit(t *testing.T, policy *auditPolicy, store stateStore, now time.Time) auditReport {
+	t.Helper()
+	var out bytes.Buffer
+	if err := runAudit(policy, "baseline", store, now, &out); err != nil {
+		t.Fatalf("runAudit() error = %v", err)
+	}
+	var report auditReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("unexpected report %s: %v", out.String(), err)
+	}
+	return report
+}
+
+func findingStatuses(report auditRuleReport) map[string]string {
+	statuses := map[string]string{}
+	for _, finding := range report.Findings {
+		statuses[finding.Key] = finding.Status
+	}
+	return statuses
+}
+
+func TestAudit(t *testing.T) {
+	originalShow := auditShow
+	t.Cleanup(func() { auditShow = originalShow })
+	auditShow = []string{findingNew, findingResolved}
+	policy, err := parseAuditPolicy([]byte(testAuditPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &fileStore{dir: t.TempDir()}
+	statePath := store.file(auditDocument("baseline"))
+	first := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Every finding of the first run is new
+	stubAuditRule(t, map[string][]string{"failed-pods": {"web", "api"}}, nil, nil)
+	report := runTestAudit(t, policy, store, first)
+	if report.PreviousRun != nil || len(report.Rules) != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if rule := report.Rules[0]; rule.New != 2 || rule.Resolved != 0 || len(rule.Findings) != 2 || rule.Findings[0].Key != "api" {
+		t.Errorf("expected both findings to be new, got %+v", rule)
+	}
+
+	// Then only what changed is listed
+	second := first.Add(24 * time.Hour)
+	stubAuditRule(t, map[string][]string{"failed-pods": {"web", "db"}}, nil, nil)
+	report = runTestAudit(t, policy, store, second)
+	if report.PreviousRun == nil || !report.PreviousRun.Equal(first) {
+		t.Errorf("expected the previous run to be %v, got %v", first, report.PreviousRun)
+	}
+	rule := report.Rules[0]
+	statuses := findingStatuses(rule)
+	if rule.New != 1 || rule.Resolved != 1 || rule.Persisting != 1 || len(statuses) != 2 || statuses["db"] != findingNew || statuses["api"] != findingResolved {
+		t.Errorf("expected db to be new and api resolved, got %+v", rule)
+	}
+
+	// Persisting findings keep when they were first seen
+	auditShow = []string{findingPersisting}
+	stubAuditRule(t, map[string][]string{"failed-pods": {"web", "db"}}, nil, nil)
+	report = runTestAudit(t, policy, store, second.Add(time.Hour))
+	if rule := report.Rules[0]; len(rule.Findings) != 2 || rule.Findings[1].Key != "web" || !rule.Findings[1].FirstSeen.Equal(first) {
+		t.Errorf("expected web to persist since the first run, got %+v", rule.Findings)
+	}
+
+	// Acknowledged findings aren't resolved, and are new again once their acknowledgement expires
+	auditShow = []string{findingNew, findingResolved}
+	stubAuditRule(t, map[string][]string{"failed-pods": {"db"}}, map[string][]string{"failed-pods": {"web"}}, nil)
+	report = runTestAudit(t, policy, store, second.Add(2*time.Hour))
+	if rule := report.Rules[0]; rule.Acknowledged != 1 || rule.Resolved != 0 || len(rule.Findings) != 0 {
+		t.Errorf("expected web to be acknowledged, got %+v", rule)
+	}
+	stubAuditRule(t, map[string][]string{"failed-pods": {"web", "db"}}, nil, nil)
+	report = runTestAudit(t, policy, store, second.Add(3*time.Hour))
+	if statuses := findingStatuses(report.Rules[0]); len(statuses) != 1 || statuses["web"] != findingNew {
+		t.Errorf("expected web to be new again, got %v", statuses)
+	}
+
+	// A failed run leaves the state untouched
+	before, err := os.ReadFile(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stubAuditRule(t, nil, nil, errors.New("connection refused"))
+	if err := runAudit(policy, "baseline", store, second.Add(4*time.Hour), &bytes.Buffer{}); err == nil {
+		t.Error("expected the failed run to be reported")
+	}
+	if after, _ := os.ReadFile(statePath); !bytes.Equal(before, after) {
+		t.Error("expected the state to be kept after a failed run")
+	}
+
+	auditShow = []string{"fixed"}
+	if err := runAudit(policy, "baseline", store, second, &bytes.Buffer{}); err == nil {
+		t.Error("expected an unknown finding state to be rejected")
+	}
+}
+
+func TestAuditFindings(t *testing.T) {
+	findings := auditFindings(map[string]interface{}{
+		"p": []interface{}{
+			map[string]interface{}{"_uid": "1234", "name": "web"},
+			map[string]interface{}{"_uid": "1234", "name": "web"},
+		},
+		"rows":      []interface{}{map[string]interface{}{"c": map[string]interface{}{"image": "nginx:latest"}}},
+		"aggregate": map[string]interface{}{"count": 2},
+	})
+	if len(findings) != 2 || findings[0].Key != "1234" || findings[1].Key != `{"c":{"image":"nginx:latest"}}` {
+		t.Fatalf("unexpected findings %+v", findings)
+	}
+	if _, ok := findings[0].Row["p"].(map[string]interface{})["_uid"]; ok {
+		t.Errorf("expected the uid to be left out of the row, got %v", findings[0].Row)
+	}
+}
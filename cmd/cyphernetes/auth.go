@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gin-gonic/gin"
+)
+
+// apiIdentity is who an API request is made by, the queries of the request impersonate them
+type apiIdentity struct {
+	User   string
+	Groups []string
+}
+
+// authenticator finds the identity of an API request from one kind of credential. It returns no identity and
+// no error when the request has no credential of its kind, and an error when the credential is invalid.
+type authenticator interface {
+	authenticate(r *http.Request) (*apiIdentity, error)
+}
+
+// webAuthOptions are the authentication flags of the web command
+type webAuthOptions struct {
+	tokenFile         string
+	oidcIssuerURL     string
+	oidcClientID      string
+	oidcUsernameClaim string
+	oidcGroupsClaim   string
+	oidcGroupsPrefix  string
+	oidcGroupMap      map[string]string
+	tlsCertFile       string
+	tlsKeyFile        string
+	clientCAFile      string
+}
+
+var webAuth webAuthOptions
+
+// apiAuthenticators authenticate the requests to the API. Without any, queries run as the kubeconfig's identity.
+var apiAuthenticators []authenticator
+
+// identityKey is the gin context key of the identity of an authenticated request
+const identityKey = "identity"
+
+// newAuthenticators creates the authenticators the options configure
+func newAuthenticators(options webAuthOptions) ([]authenticator, error) {
+	var authenticators []authenticator
+	if options.tokenFile != "" {
+		tokens, err := loadStaticTokens(options.tokenFile)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, tokens)
+	}
+	if options.clientCAFile != "" {
+		if options.tlsCertFile == "" {
+			return nil, fmt.Errorf("--client-ca-file requires --tls-cert-file and --tls-key-file")
+		}
+		authenticators = append(authenticators, clientCertAuthenticator{})
+	}
+	if options.oidcIssuerURL != "" {
+		if options.oidcClientID == "" {
+			return nil, fmt.Errorf("--oidc-issuer-url requires --oidc-client-id")
+		}
+		authenticators = append(authenticators, &oidcAuthenticator{
+			issuer:        options.oidcIssuerURL,
+			clientID:      options.oidcClientID,
+			usernameClaim: options.oidcUsernameClaim,
+			groupsClaim:   options.oidcGroupsClaim,
+			groupsPrefix:  options.oidcGroupsPrefix,
+			groupMap:      options.oidcGroupMap,
+			client:        &http.Client{Timeout: 10 * time.Second},
+			now:           time.Now,
+		})
+	}
+	if (options.tlsCertFile == "") != (options.tlsKeyFile == "") {
+		return nil, fmt.Errorf("--tls-cert-file and --tls-key-file must be given together")
+	}
+	return authenticators, nil
+}
+
+// serverTLSConfig is the TLS configuration of the web server, which asks for client certificates if a CA is given
+func serverTLSConfig(options webAuthOptions) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if options.clientCAFile != "" {
+		pem, err := os.ReadFile(options.clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", options.clientCAFile)
+		}
+		config.ClientCAs = pool
+		// Requests may authenticate with a token instead
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return config, nil
+}
+
+// authMiddleware rejects the API requests that none of the authenticators authenticate, once there are any
+func authMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		serverConfigMutex.RLock()
+		authenticators := apiAuthenticators
+		serverConfigMutex.RUnlock()
+		if len(authenticators) == 0 {
+			c.Next()
+			return
+		}
+		var failure error
+		for _, authenticator := range authenticators {
+			identity, err := authenticator.authenticate(c.Request)
+			if err != nil {
+				failure = err
+				continue
+			}
+			if identity != nil {
+				c.Set(identityKey, identity)
+				c.Next()
+				return
+			}
+		}
+		if failure == nil {
+			failure = errors.New("authentication required")
+		}
+		parser.Logger().Warn("API request rejected", "remote", c.ClientIP(), "path", c.Request.URL.Path, "error", failure)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": failure.Error()})
+	}
+}
+
+var (
+	identityExecutors      = map[string]*identityExecutor{}
+	identityExecutorsMutex sync.Mutex
+	newIdentityExecutor    = parser.NewImpersonatingQueryExecutor
+	// identityExecutorTTL is how long the executor of an identity is kept after its last request, and
+	// maxIdentityExecutors how many are kept at most, the least recently used being closed first
+	identityExecutorTTL  = 10 * time.Minute
+	maxIdentityExecutors = 100
+)
+
+// identityExecutor is the executor impersonating an identity, and the requests using it
+type identityExecutor struct {
+	executor *parser.QueryExecutor
+	requests int
+	lastUsed time.Time
+}
+
+// requestExecutor is the executor for the queries of an API request: one impersonating the request's identity
+// if it was authenticated, the kubeconfig's otherwise. The request must call release once it's done with it, so
+// that executors of identities that stopped making requests can be closed.
+func requestExecutor(c *gin.Context) (executor *parser.QueryExecutor, release func(), err error) {
+	value, ok := c.Get(identityKey)
+	if !ok {
+		return parser.GetQueryExecutorInstance(), func() {}, nil
+	}
+	identity := value.(*apiIdentity)
+	groups := append([]string{}, identity.Groups...)
+	sort.Strings(groups)
+	key := identity.User + "\x00" + strings.Join(groups, "\x00")
+
+	identityExecutorsMutex.Lock()
+	entry, ok := identityExecutors[key]
+	if !ok {
+		created, err := newIdentityExecutor(identity.User, groups)
+		if err != nil {
+			identityExecutorsMutex.Unlock()
+			return nil, nil, err
+		}
+		entry = &identityExecutor{executor: created}
+		identityExecutors[key] = entry
+	}
+	entry.requests++
+	entry.lastUsed = time.Now()
+	evicted := evictIdentityExecutors(entry.lastUsed)
+	identityExecutorsMutex.Unlock()
+	for _, executor := range evicted {
+		executor.Close()
+	}
+
+	release = func() {
+		identityExecutorsMutex.Lock()
+		defer identityExecutorsMutex.Unlock()
+		entry.requests--
+		entry.lastUsed = time.Now()
+	}
+	return entry.executor, release, nil
+}
+
+// evictIdentityExecutors removes the executors unused for identityExecutorTTL, and the least recently used ones
+// past maxIdentityExecutors, returning them to be closed. Executors in use by a request are kept.
+func evictIdentityExecutors(now time.Time) []*parser.QueryExecutor {
+	var evicted []*parser.QueryExecutor
+	for key, entry := range identityExecutors {
+		if entry.requests == 0 && now.Sub(entry.lastUsed) > identityExecutorTTL {
+			evicted = append(evicted, entry.executor)
+			delete(identityExecutors, key)
+		}
+	}
+	for len(identityExecutors) > maxIdentityExecutors {
+		oldest := ""
+		for key, entry := range identityExecutors {
+			if entry.requests == 0 && (oldest == "" || entry.lastUsed.Before(identityExecutors[oldest].lastUsed)) {
+				oldest = key
+			}
+		}
+		if oldest == "" {
+			break
+		}
+		evicted = append(evicted, identityExecutors[oldest].executor)
+		delete(identityExecutors, oldest)
+	}
+	return evicted
+}
+
+// bearerToken is the token of the request's Authorization header, if any
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+// staticTokenAuthenticator authenticates the bearer tokens of a token file
+type staticTokenAuthenticator struct {
+	tokens map[string]*apiIdentity
+}
+
+// loadStaticTokens reads a token file in the format of the Kubernetes API server's: CSV lines of
+// token,user,uid,"group1,group2", where the uid and groups are optional
+func loadStaticTokens(path string) (*staticTokenAuthenticator, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading token file: %w", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("error parsing token file %s: %w", path, err)
+	}
+
+	tokens := map[string]*apiIdentity{}
+	for i, record := range records {
+		if len(record) < 2 || record[0] == "" || record[1] == "" {
+			return nil, fmt.Errorf("error parsing token file %s: line %d needs a token and a user", path, i+1)
+		}
+		identity := &apiIdentity{User: record[1]}
+		if len(record) > 3 && record[3] != "" {
+			identity.Groups = strings.Split(record[3], ",")
+		}
+		tokens[record[0]] = identity
+	}
+	return &staticTokenAuthenticator{tokens: tokens}, nil
+}
+
+func (a *staticTokenAuthenticator) authenticate(r *http.Request) (*apiIdentity, error) {
+	token := bearerToken(r)
+	if token == "" {
+		return nil, nil
+	}
+	var found *apiIdentity
+	for candidate, identity := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(token)) == 1 {
+			found = identity
+		}
+	}
+	if found == nil {
+		return nil, errors.New("invalid bearer token")
+	}
+	return found, nil
+}
+
+// clientCertAuthenticator authenticates verified client certificates like the Kubernetes API server does: the
+// common name is the user, and the organizations are the groups
+type clientCertAuthenticator struct{}
+
+func (clientCertAuthenticator) authenticate(r *http.Request) (*apiIdentity, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, nil
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	if cert.Subject.CommonName == "" {
+		return nil, errors.New("client certificate has no common name")
+	}
+	return &apiIdentity{User: cert.Subject.CommonName, Groups: cert.Subject.Organization}, nil
+}
+
+// oidcAuthenticator authenticates the ID tokens of an OpenID Connect issuer, checking their signature against
+// the issuer's published keys. Groups of the token are renamed by groupMap, others are prefixed by groupsPrefix
+// so that the issuer can't claim the cluster's own groups.
+type oidcAuthenticator struct {
+	issuer        string
+	clientID      string
+	usernameClaim string
+	groupsClaim   string
+	groupsPrefix  string
+	groupMap      map[string]string
+	client        *http.Client
+	now           func() time.Time
+
+	mu       sync.Mutex
+	verifier *oidc.IDTokenVerifier
+}
+
+func (a *oidcAuthenticator) authenticate(r *http.Request) (*apiIdentity, error) {
+	token := bearerToken(r)
+	if token == "" || strings.Count(token, ".") != 2 {
+		return nil, nil
+	}
+	verifier, err := a.idTokenVerifier()
+	if err != nil {
+		return nil, err
+	}
+	idToken, err := verifier.Verify(r.Context(), token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+
+	user, _ := claims[a.usernameClaim].(string)
+	if user == "" {
+		return nil, fmt.Errorf("invalid ID token: no %s claim", a.usernameClaim)
+	}
+	identity := &apiIdentity{User: user}
+	var groups []string
+	switch value := claims[a.groupsClaim].(type) {
+	case string:
+		groups = []string{value}
+	case []interface{}:
+		for _, group := range value {
+			if name, ok := group.(string); ok {
+				groups = append(groups, name)
+			}
+		}
+	}
+	for _, group := range groups {
+		if mapped, ok := a.groupMap[group]; ok {
+			identity.Groups = append(identity.Groups, mapped)
+		} else {
+			identity.Groups = append(identity.Groups, a.groupsPrefix+group)
+		}
+	}
+	return identity, nil
+}
+
+// idTokenVerifier checks the signature, issuer, audience and lifetime of tokens. It's created from the issuer's
+// discovery document on the first request, so that the server starts while the issuer is unreachable, and
+// fetches the issuer's keys again when they're rotated.
+func (a *oidcAuthenticator) idTokenVerifier() (*oidc.IDTokenVerifier, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.verifier != nil {
+		return a.verifier, nil
+	}
+	// The keys are fetched later with the context the provider is created with
+	provider, err := oidc.NewProvider(oidc.ClientContext(context.Background(), a.client), a.issuer)
+	if err != nil {
+		return nil, fmt.Errorf("error discovering OIDC issuer %s: %w", a.issuer, err)
+	}
+	a.verifier = provider.Verifier(&oidc.Config{ClientID: a.clientID, Now: a.now})
+	return a.verifier, nil
+}
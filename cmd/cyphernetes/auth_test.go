@@ -0,0 +1,231 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
+	"github.com/gin-gonic/gin"
+)
+
+func requestWithToken(token string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/api/convert-resource-name", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+func TestStaticTokenAuthenticator(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.csv")
+	content := "# token,user,uid,groups\nsecret-1,alice,1001,\"dev,ops\"\nsecret-2,bob\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := loadStaticTokens(path)
+	if err != nil {
+		t.Fatalf("loadStaticTokens() error = %v", err)
+	}
+
+	identity, err := tokens.authenticate(requestWithToken("secret-1"))
+	if err != nil || !reflect.DeepEqual(identity, &apiIdentity{User: "alice", Groups: []string{"dev", "ops"}}) {
+		t.Errorf("expected alice, got %+v, %v", identity, err)
+	}
+	if identity, err := tokens.authenticate(requestWithToken("")); identity != nil || err != nil {
+		t.Errorf("expected no identity without a token, got %+v, %v", identity, err)
+	}
+	if _, err := tokens.authenticate(requestWithToken("guess")); err == nil {
+		t.Errorf("expected an unknown token to be rejected")
+	}
+
+	if err := os.WriteFile(path, []byte("secret-3\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadStaticTokens(path); err == nil {
+		t.Errorf("expected a token without a user to be rejected")
+	}
+}
+
+func TestClientCertAuthenticator(t *testing.T) {
+	req := requestWithToken("")
+	if identity, err := (clientCertAuthenticator{}).authenticate(req); identity != nil || err != nil {
+		t.Errorf("expected no identity without a certificate, got %+v, %v", identity, err)
+	}
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "alice", Organization: []string{"dev"}}}
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	identity, err := (clientCertAuthenticator{}).authenticate(req)
+	if err != nil || !reflect.DeepEqual(identity, &apiIdentity{User: "alice", Groups: []string{"dev"}}) {
+		t.Errorf("expected alice, got %+v, %v", identity, err)
+	}
+}
+
+func TestOIDCAuthenticator(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var issuer string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{"issuer": issuer, "jwks_uri": issuer + "/keys"})
+		case "/keys":
+			json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "key-1",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	issuer = server.URL
+
+	now := time.Unix(1700000000, 0)
+	sign := func(kid string, claims map[string]interface{}) string {
+		encode := func(v interface{}) string {
+			data, _ := json.Marshal(v)
+			return base64.RawURLEncoding.EncodeToString(data)
+		}
+		signed := encode(map[string]string{"alg": "RS256", "kid": kid}) + "." + encode(claims)
+		digest := crypto.SHA256.New()
+		digest.Write([]byte(signed))
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest.Sum(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+	}
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		claims := map[string]interface{}{
+			"iss":    issuer,
+			"aud":    []string{"cyphernetes"},
+			"sub":    "alice",
+			"groups": []string{"platform", "dev"},
+			"exp":    now.Add(time.Hour).Unix(),
+		}
+		for k, v := range changes {
+			claims[k] = v
+		}
+		return claims
+	}
+
+	authenticators, err := newAuthenticators(webAuthOptions{
+		oidcIssuerURL:     issuer,
+		oidcClientID:      "cyphernetes",
+		oidcUsernameClaim: "sub",
+		oidcGroupsClaim:   "groups",
+		oidcGroupsPrefix:  "oidc:",
+		oidcGroupMap:      map[string]string{"platform": "cluster-admins"},
+	})
+	if err != nil {
+		t.Fatalf("newAuthenticators() error = %v", err)
+	}
+	oidc := authenticators[0].(*oidcAuthenticator)
+	oidc.now = func() time.Time { return now }
+
+	identity, err := oidc.authenticate(requestWithToken(sign("key-1", claims(nil))))
+	if err != nil {
+		t.Fatalf("authenticate() error = %v", err)
+	}
+	expected := &apiIdentity{User: "alice", Groups: []string{"cluster-admins", "oidc:dev"}}
+	if !reflect.DeepEqual(identity, expected) {
+		t.Errorf("expected %+v, got %+v", expected, identity)
+	}
+
+	for name, token := range map[string]string{
+		"expired":        sign("key-1", claims(map[string]interface{}{"exp": now.Add(-time.Hour).Unix()})),
+		"other audience": sign("key-1", claims(map[string]interface{}{"aud": "other"})),
+		"other issuer":   sign("key-1", claims(map[string]interface{}{"iss": "https://evil.example.com"})),
+		"unknown key":    sign("key-2", claims(nil)),
+		"tampered":       sign("key-1", claims(nil))[:40] + "x" + sign("key-1", claims(nil))[41:],
+		"unsigned":       base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + strings.Split(sign("key-1", claims(nil)), ".")[1] + ".",
+	} {
+		if identity, err := oidc.authenticate(requestWithToken(token)); err == nil {
+			t.Errorf("%s: expected the token to be rejected, got %+v", name, identity)
+		}
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	originalAuthenticators, originalExecutors, originalNewExecutor, originalMaxExecutors := apiAuthenticators, identityExecutors, newIdentityExecutor, maxIdentityExecutors
+	defer func() {
+		apiAuthenticators, identityExecutors, newIdentityExecutor, maxIdentityExecutors = originalAuthenticators, originalExecutors, originalNewExecutor, originalMaxExecutors
+	}()
+	apiAuthenticators = []authenticator{&staticTokenAuthenticator{tokens: map[string]*apiIdentity{"secret": {User: "alice", Groups: []string{"dev"}}}}}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	setupAPIRoutes(router)
+
+	for token, code := range map[string]int{
+		"":       http.StatusUnauthorized,
+		"guess":  http.StatusUnauthorized,
+		"secret": http.StatusBadRequest, // authenticated, the handler requires a name
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, requestWithToken(token))
+		if w.Code != code {
+			t.Errorf("token %q: expected %d, got %d: %s", token, code, w.Code, w.Body.String())
+		}
+	}
+
+	// Queries of an identity impersonate it, with one executor per identity
+	identityExecutors = map[string]*identityExecutor{}
+	var created []string
+	newIdentityExecutor = func(user string, groups []string) (*parser.QueryExecutor, error) {
+		created = append(created, user)
+		return &parser.QueryExecutor{}, nil
+	}
+	request := func(user string, groups ...string) (*parser.QueryExecutor, func()) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Set(identityKey, &apiIdentity{User: user, Groups: groups})
+		executor, release, err := requestExecutor(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return executor, release
+	}
+	first, releaseFirst := request("alice", "ops", "dev")
+	second, releaseSecond := request("alice", "dev", "ops")
+	if first != second || !reflect.DeepEqual(created, []string{"alice"}) {
+		t.Errorf("expected a single executor for alice, created %v", created)
+	}
+
+	// Past the limit, the least recently used executors are evicted once no request uses them
+	maxIdentityExecutors = 1
+	_, releaseBob := request("bob")
+	if len(identityExecutors) != 2 {
+		t.Errorf("expected alice's executor to be kept while in use, got %d executors", len(identityExecutors))
+	}
+	releaseFirst()
+	releaseSecond()
+	releaseBob()
+	_, releaseCarol := request("carol")
+	defer releaseCarol()
+	if _, ok := identityExecutors["carol\x00"]; !ok || len(identityExecutors) != 1 {
+		t.Errorf("expected only carol's executor to be kept, got %v", identityExecutors)
+	}
+	if third, release := request("alice", "dev", "ops"); third == first {
+		t.Error("expected alice's executor to have been evicted")
+	} else {
+		release()
+	}
+}
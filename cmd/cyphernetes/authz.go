@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
+	"github.com/gin-gonic/gin"
+)
+
+// The queries of the web server can be authorized by a chain of plugins, listed under authorization in its
+// configuration file. Before a query runs, each plugin is given the identity of the request, the query and the API
+// requests the query plans to make, and the query only runs if every plugin allows it: the first to deny it stops
+// the chain, and the request gets a 403 response. The plugins are
+//
+//	rbac     the identity's RBAC permissions, reviewed by the API server for each request of the query
+//	webhook  a service the input is posted to as JSON, answering with {"allowed": true} or {"allowed": false,
+//	         "reason": "..."}
+//	opa      an Open Policy Agent sidecar, whose decision at url is queried with the input, e.g.
+//	         http://localhost:8181/v1/data/cyphernetes/allow. The decision is true, false, or an object with allow
+//	         and reason fields.
+//
+// A plugin that fails, e.g. a webhook that can't be reached, denies the query unless it's configured to failOpen.
+
+// defaultAuthorizationTimeout is how long a webhook or OPA decision is waited for, unless configured otherwise
+const defaultAuthorizationTimeout = 5 * time.Second
+
+// apiAuthorizers authorize the queries of API requests, in order
+var apiAuthorizers []*authorizationPlugin
+
+// planAccess and reviewAccess are the executor's, replaced by tests
+var (
+	planAccess   = (*parser.QueryExecutor).Access
+	reviewAccess = (*parser.QueryExecutor).ReviewAccess
+)
+
+type authorizationConfig struct {
+	// Type is rbac, webhook or opa
+	Type    string        `yaml:"type"`
+	URL     string        `yaml:"url"`
+	Timeout time.Duration `yaml:"timeout"`
+	// FailOpen allows queries when the plugin fails instead of denying them
+	FailOpen bool `yaml:"failOpen"`
+}
+
+// authorizationInput is what the authorization plugins decide on
+type authorizationInput struct {
+	User   string                  `json:"user,omitempty"`
+	Groups []string                `json:"groups,omitempty"`
+	Query  string                  `json:"query"`
+	Access []parser.ResourceAccess `json:"access"`
+}
+
+// authorizationDecision is the decision of an authorization plugin on a query
+type authorizationDecision struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// queryAuthorizer decides whether a query may run, executor being the one the query would run on
+type queryAuthorizer interface {
+	authorize(ctx context.Context, executor *parser.QueryExecutor, input *authorizationInput) (authorizationDecision, error)
+}
+
+// authorizationPlugin is a plugin of the authorization chain
+type authorizationPlugin struct {
+	name       string
+	failOpen   bool
+	authorizer queryAuthorizer
+}
+
+// queryDeniedError is the error of a query a plugin of the authorization chain denied
+type queryDeniedError struct {
+	plugin string
+	reason string
+}
+
+func (e *queryDeniedError) Error() string {
+	if e.reason == "" {
+		return fmt.Sprintf("query denied by the %s authorizer", e.plugin)
+	}
+	return fmt.Sprintf("query denied by the %s authorizer: %s", e.plugin, e.reason)
+}
+
+// newAuthorizationPlugins creates the authorization chain of the configuration
+func newAuthorizationPlugins(configs []authorizationConfig) ([]*authorizationPlugin, error) {
+	var plugins []*authorizationPlugin
+	for i, config := range configs {
+		timeout := config.Timeout
+		if timeout <= 0 {
+			timeout = defaultAuthorizationTimeout
+		}
+		client := &http.Client{Timeout: timeout}
+		plugin := &authorizationPlugin{name: config.Type, failOpen: config.FailOpen}
+		switch config.Type {
+		case "rbac":
+			plugin.authorizer = rbacAuthorizer{}
+		case "webhook":
+			plugin.authorizer = &webhookAuthorizer{url: config.URL, client: client}
+		case "opa":
+			plugin.authorizer = &opaAuthorizer{url: config.URL, client: client}
+		default:
+			return nil, fmt.Errorf("authorization plugin %d: unknown type %q, expected rbac, webhook or opa", i+1, config.Type)
+		}
+		if config.Type != "rbac" && config.URL == "" {
+			return nil, fmt.Errorf("authorization plugin %d: the %s plugin requires a url", i+1, config.Type)
+		}
+		plugins = append(plugins, plugin)
+	}
+	return plugins, nil
+}
+
+// authorizeQuery runs the query of a request through the authorization chain, returning a *queryDeniedError if a
+// plugin denies it
+func authorizeQuery(c *gin.Context, executor *parser.QueryExecutor, query string, ast *parser.Expression, namespace string) error {
+	serverConfigMutex.RLock()
+	plugins := apiAuthorizers
+	serverConfigMutex.RUnlock()
+	if len(plugins) == 0 {
+		return nil
+	}
+
+	access, err := planAccess(executor, ast, namespace)
+	if err != nil {
+		return err
+	}
+	input := &authorizationInput{Query: query, Access: access}
+	if value, ok := c.Get(identityKey); ok {
+		identity := value.(*apiIdentity)
+		input.User, input.Groups = identity.User, identity.Groups
+	}
+	for _, plugin := range plugins {
+		decision, err := plugin.authorizer.authorize(c.Request.Context(), executor, input)
+		if err != nil {
+			parser.Logger().Error("Authorization plugin failed", "plugin", plugin.name, "failOpen", plugin.failOpen, "error", err)
+			if plugin.failOpen {
+				continue
+			}
+			decision = authorizationDecision{Reason: err.Error()}
+		}
+		if !decision.Allowed {
+			parser.Logger().Warn("Query denied", "plugin", plugin.name, "user", input.User, "reason", decision.Reason)
+			return &queryDeniedError{plugin: plugin.name, reason: decision.Reason}
+		}
+	}
+	return nil
+}
+
+// authorizationStatus is the status of the response to a request whose query authorizeQuery failed
+func authorizationStatus(err error) int {
+	var denied *queryDeniedError
+	if errors.As(err, &denied) {
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
+// rbacAuthorizer allows the queries whose requests the identity of the executor may all make
+type rbacAuthorizer struct{}
+
+func (rbacAuthorizer) authorize(ctx context.Context, executor *parser.QueryExecutor, input *authorizationInput) (authorizationDecision, error) {
+	denials, err := reviewAccess(executor, ctx, input.Access)
+	if err != nil {
+		return authorizationDecision{}, err
+	}
+	if len(denials) == 0 {
+		return authorizationDecision{Allowed: true}, nil
+	}
+	reasons := make([]string, len(denials))
+	for i, denial := range denials {
+		reasons[i] = denial.String()
+	}
+	return authorizationDecision{Reason: "not allowed to " + strings.Join(reasons, ", ")}, nil
+}
+
+// webhookAuthorizer posts the input to a service, which answers with the decision
+type webhookAuthorizer struct {
+	url    string
+	client *http.Client
+}
+
+func (a *webhookAuthorizer) authorize(ctx context.Context, executor *parser.QueryExecutor, input *authorizationInput) (authorizationDecision, error) {
+	var decision authorizationDecision
+	err := postAuthorizationJSON(ctx, a.client, a.url, input, &decision)
+	return decision, err
+}
+
+// opaAuthorizer queries a decision of an Open Policy Agent with the input
+type opaAuthorizer struct {
+	url    string
+	client *http.Client
+}
+
+func (a *opaAuthorizer) authorize(ctx context.Context, executor *parser.QueryExecutor, input *authorizationInput) (authorizationDecision, error) {
+	var response struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := postAuthorizationJSON(ctx, a.client, a.url, map[string]interface{}{"input": input}, &response); err != nil {
+		return authorizationDecision{}, err
+	}
+	if len(response.Result) == 0 {
+		// OPA leaves the result out when no rule defines the decision
+		return authorizationDecision{Reason: "the policy decision is undefined"}, nil
+	}
+	var allowed bool
+	if err := json.Unmarshal(response.Result, &allowed); err == nil {
+		return authorizationDecision{Allowed: allowed}, nil
+	}
+	var result struct {
+		Allow  bool   `json:"allow"`
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal(response.Result, &result); err != nil {
+		return authorizationDecision{}, fmt.Errorf("unexpected policy decision %s", response.Result)
+	}
+	return authorizationDecision{Allowed: result.Allow, Reason: result.Reason}, nil
+}
+
+// postAuthorizationJSON posts a JSON body to an authorization service and decodes its JSON response
+func postAuthorizationJSON(ctx context.Context, client *http.Client, url string, body, target interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf("%s answered %s: %s", url, response.Status, strings.TrimSpace(string(message)))
+	}
+	return json.NewDecoder(response.Body).Decode(target)
+}
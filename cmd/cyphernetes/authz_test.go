@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
+	"github.com/gin-gonic/gin"
+)
+
+var authorizationTestAccess = []parser.ResourceAccess{
+	{Verb: "list", Group: "apps", Version: "v1", Resource: "deployments", Namespace: "default"},
+	{Verb: "patch", Group: "apps", Version: "v1", Resource: "deployments", Namespace: "default"},
+}
+
+// stubAuthorizationAccess makes every query plan authorizationTestAccess, and the rbac plugin deny the verbs of
+// denied
+func stubAuthorizationAccess(t *testing.T, denied ...string) {
+	originalPlanAccess, originalReviewAccess := planAccess, reviewAccess
+	t.Cleanup(func() { planAccess, reviewAccess = originalPlanAccess, originalReviewAccess })
+	planAccess = func(*parser.QueryExecutor, *parser.Expression, string) ([]parser.ResourceAccess, error) {
+		return authorizationTestAccess, nil
+	}
+	reviewAccess = func(_ *parser.QueryExecutor, _ context.Context, requests []parser.ResourceAccess) ([]parser.AccessDenial, error) {
+		var denials []parser.AccessDenial
+		for _, request := range requests {
+			for _, verb := range denied {
+				if request.Verb == verb {
+					denials = append(denials, parser.AccessDenial{ResourceAccess: request})
+				}
+			}
+		}
+		return denials, nil
+	}
+}
+
+// authorizationServer answers each request with status and body, recording the bodies it was sent
+func authorizationServer(t *testing.T, status int, body string, received *[]map[string]interface{}) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var input map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&input)
+		if received != nil {
+			*received = append(*received, input)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestAuthorizeQuery(t *testing.T) {
+	stubAuthorizationAccess(t, "patch")
+	var received []map[string]interface{}
+	allow := authorizationServer(t, http.StatusOK, `{"allowed": true}`, &received)
+	failing := authorizationServer(t, http.StatusInternalServerError, "unavailable", nil)
+	opaDeny := authorizationServer(t, http.StatusOK, `{"result": {"allow": false, "reason": "prod is read-only"}}`, nil)
+	opaAllow := authorizationServer(t, http.StatusOK, `{"result": true}`, nil)
+	opaUndefined := authorizationServer(t, http.StatusOK, `{}`, nil)
+
+	tests := []struct {
+		name   string
+		chain  []authorizationConfig
+		denied string
+	}{
+		{
+			name:  "allowed by every plugin",
+			chain: []authorizationConfig{{Type: "webhook", URL: allow}, {Type: "opa", URL: opaAllow}},
+		},
+		{
+			name:   "denied by OPA",
+			chain:  []authorizationConfig{{Type: "webhook", URL: allow}, {Type: "opa", URL: opaDeny}},
+			denied: "query denied by the opa authorizer: prod is read-only",
+		},
+		{
+			name:   "undefined OPA decision",
+			chain:  []authorizationConfig{{Type: "opa", URL: opaUndefined}},
+			denied: "query denied by the opa authorizer: the policy decision is undefined",
+		},
+		{
+			name:   "denied by RBAC",
+			chain:  []authorizationConfig{{Type: "rbac"}, {Type: "webhook", URL: allow}},
+			denied: "query denied by the rbac authorizer: not allowed to patch deployments.apps in namespace default",
+		},
+		{
+			name:   "failing webhook",
+			chain:  []authorizationConfig{{Type: "webhook", URL: failing}},
+			denied: "500 Internal Server Error: unavailable",
+		},
+		{
+			name:  "failing webhook failing open",
+			chain: []authorizationConfig{{Type: "webhook", URL: failing, FailOpen: true}, {Type: "opa", URL: opaAllow}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plugins, err := newAuthorizationPlugins(tt.chain)
+			if err != nil {
+				t.Fatalf("newAuthorizationPlugins() error = %v", err)
+			}
+			originalAuthorizers := apiAuthorizers
+			defer func() { apiAuthorizers = originalAuthorizers }()
+			apiAuthorizers = plugins
+
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/api/query", nil)
+			c.Set(identityKey, &apiIdentity{User: "alice", Groups: []string{"dev"}})
+			err = authorizeQuery(c, &parser.QueryExecutor{}, "MATCH (d:Deployment) SET d.spec.replicas = 2", &parser.Expression{}, "default")
+			if tt.denied == "" {
+				if err != nil {
+					t.Errorf("expected the query to be allowed, got %v", err)
+				}
+				return
+			}
+			var denied *queryDeniedError
+			if !errors.As(err, &denied) || !strings.Contains(err.Error(), tt.denied) {
+				t.Errorf("expected the query to be denied with %q, got %v", tt.denied, err)
+			}
+		})
+	}
+
+	// The webhook is given the identity, the query and its requests
+	input := received[0]
+	if input["user"] != "alice" || !reflect.DeepEqual(input["groups"], []interface{}{"dev"}) || input["query"] != "MATCH (d:Deployment) SET d.spec.replicas = 2" {
+		t.Errorf("unexpected webhook input %v", input)
+	}
+	if access := input["access"].([]interface{}); len(access) != 2 || access[1].(map[string]interface{})["verb"] != "patch" {
+		t.Errorf("expected the requests of the query, got %v", input["access"])
+	}
+}
+
+func TestQueryDenied(t *testing.T) {
+	stubAuthorizationAccess(t, "patch")
+	originalAuthenticators, originalAuthorizers, originalExecutors := apiAuthenticators, apiAuthorizers, identityExecutors
+	defer func() {
+		apiAuthenticators, apiAuthorizers, identityExecutors = originalAuthenticators, originalAuthorizers, originalExecutors
+	}()
+	apiAuthenticators = []authenticator{&staticTokenAuthenticator{tokens: map[string]*apiIdentity{"secret": {User: "alice"}}}}
+	apiAuthorizers, _ = newAuthorizationPlugins([]authorizationConfig{{Type: "rbac"}})
+	identityExecutors = map[string]*identityExecutor{"alice\x00": {executor: &parser.QueryExecutor{}}}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	setupAPIRoutes(router)
+	for _, request := range []struct{ method, path, body string }{
+		{http.MethodPost, "/api/query", `{"query": "MATCH (d:Deployment) SET d.spec.replicas = 2"}`},
+		{http.MethodGet, "/api/watch?query=MATCH%20(d%3ADeployment)%20RETURN%20d", ""},
+	} {
+		w := apiRequest(router, "secret", request.method, request.path, request.body)
+		if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "not allowed to patch deployments.apps") {
+			t.Errorf("%s: expected the query to be denied, got %d: %s", request.path, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestLoadAuthorizationConfig(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config.yaml")
+	os.WriteFile(config, []byte(`authorization:
+  - type: rbac
+  - type: opa
+    url: http://localhost:8181/v1/data/cyphernetes/allow
+    timeout: 2s
+    failOpen: true
+`), 0600)
+	settings, err := loadServerSettings(config, serverSettings{})
+	if err != nil {
+		t.Fatalf("loadServerSettings() error = %v", err)
+	}
+	if len(settings.authorizers) != 2 || settings.authorizers[0].name != "rbac" || !settings.authorizers[1].failOpen {
+		t.Fatalf("expected the rbac and opa plugins, got %+v", settings.authorizers)
+	}
+	if opa := settings.authorizers[1].authorizer.(*opaAuthorizer); opa.client.Timeout != 2*time.Second {
+		t.Errorf("expected a timeout of 2s, got %s", opa.client.Timeout)
+	}
+
+	for _, chain := range [][]authorizationConfig{{{Type: "ldap"}}, {{Type: "webhook"}}} {
+		if _, err := newAuthorizationPlugins(chain); err == nil {
+			t.Errorf("expected %+v to be invalid", chain)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cobra"
+)
+
+// A state bundle holds every document of a state store: the saved dashboards and their queries, the
+// acknowledgements and the findings of audits. Exporting the state of one store and restoring it into another
+// moves a deployment, e.g. from the file store of a workstation to the PostgreSQL database of a shared server, and
+// bundles exported regularly are backups to recover from. The state command exports and restores the bundles of
+// a store, and a running server exports and restores its own through /api/admin/state.
+
+// stateBundleVersion is the version of the bundles written, restoring a bundle of another version fails
+const stateBundleVersion = 1
+
+type stateBundle struct {
+	Version    int                        `json:"version"`
+	ExportedAt time.Time                  `json:"exportedAt"`
+	Documents  map[string]json.RawMessage `json:"documents"`
+}
+
+// adminGroups are the groups allowed to export and restore the server's state, which requires requests to be
+// authenticated
+var adminGroups []string
+
+var stateOutputFile string
+
+var stateCmd = &cobra.Command{
+	Use:   "state",
+	Short: "Export and restore the state kept by the web server and audits",
+	Long: `Use the 'state' subcommand to export everything kept in a state store, the saved dashboards, the
+acknowledgements and the findings of audits, to a portable bundle, and to restore a bundle into a store.`,
+}
+
+var stateExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the documents of a state store to a bundle",
+	Example: `  cyphernetes state export > backup.json
+  cyphernetes state export --store sqlite:/var/lib/cyphernetes/state.db -o backup.json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := runStateCommand(func(store stateStore) error {
+			w := io.Writer(os.Stdout)
+			if stateOutputFile != "" {
+				file, err := os.Create(stateOutputFile)
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+				w = file
+			}
+			return writeStateBundle(store, time.Now(), w)
+		}); err != nil {
+			return fmt.Errorf("error exporting state >> %w", err)
+		}
+		return nil
+	},
+}
+
+var stateRestoreCmd = &cobra.Command{
+	Use:   "restore <bundle file>",
+	Short: "Restore the documents of a bundle into a state store",
+	Long: `Use the 'restore' subcommand to save the documents of a bundle written by 'state export' into a state store,
+replacing the documents of the same names. Documents the bundle doesn't hold are kept. Pass - to read the bundle
+from the standard input.`,
+	Example: `  cyphernetes state restore backup.json --store postgres://cyphernetes:secret@db:5432/cyphernetes`,
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var data []byte
+		var err error
+		if args[0] == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(args[0])
+		}
+		if err != nil {
+			return fmt.Errorf("error reading bundle >> %w", err)
+		}
+		var bundle stateBundle
+		if err := json.Unmarshal(data, &bundle); err != nil {
+			return fmt.Errorf("error reading bundle >> %w", err)
+		}
+		if err := runStateCommand(func(store stateStore) error {
+			return restoreState(store, &bundle)
+		}); err != nil {
+			return fmt.Errorf("error restoring state >> %w", err)
+		}
+		fmt.Printf("Restored %d documents\n", len(bundle.Documents))
+		return nil
+	},
+}
+
+// runStateCommand runs f with the store of --store, closing it afterwards
+func runStateCommand(f func(store stateStore) error) error {
+	store, err := openStateStore(storeURL)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	return f(store)
+}
+
+// exportState reads every document of a store into a bundle
+func exportState(store stateStore, now time.Time) (*stateBundle, error) {
+	names, err := store.Names()
+	if err != nil {
+		return nil, err
+	}
+	bundle := &stateBundle{Version: stateBundleVersion, ExportedAt: now.UTC(), Documents: map[string]json.RawMessage{}}
+	for _, name := range names {
+		var document json.RawMessage
+		if err := store.Load(name, &document); err != nil {
+			return nil, err
+		}
+		bundle.Documents[name] = document
+	}
+	return bundle, nil
+}
+
+func writeStateBundle(store stateStore, now time.Time, w io.Writer) error {
+	bundle, err := exportState(store, now)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(bundle)
+}
+
+// restoreState saves the documents of a bundle into a store. The bundle is checked first, so that an invalid one
+// doesn't leave the store half restored.
+func restoreState(store stateStore, bundle *stateBundle) error {
+	if bundle.Version != stateBundleVersion {
+		return fmt.Errorf("unsupported bundle version %d, expected %d", bundle.Version, stateBundleVersion)
+	}
+	names := []string{}
+	for name, document := range bundle.Documents {
+		if !validDocumentName(name) {
+			return fmt.Errorf("invalid document name %q", name)
+		}
+		if !json.Valid(document) {
+			return fmt.Errorf("document %s isn't valid JSON", name)
+		}
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		if err := store.Save(name, bundle.Documents[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validDocumentName reports whether a name is one of the documents or collections of documents the commands keep.
+// Names become paths in the file store, so they can't climb out of its directory.
+func validDocumentName(name string) bool {
+	if slices.Contains(stateDocuments, name) {
+		return true
+	}
+	collection, item, ok := strings.Cut(name, "/")
+	return ok && slices.Contains(stateCollections, collection) && item != "" && item != "." && item != ".." &&
+		!strings.ContainsAny(item, `/\`)
+}
+
+// requireAdmin rejects the requests of users who aren't members of an admin group. Without authentication, no
+// request is known to come from one, and all are rejected.
+func requireAdmin(c *gin.Context) bool {
+	identity := requestIdentity(c)
+	if identity == nil {
+		c.JSON(http.StatusForbidden, errorResponse(errors.New("the server's state may only be exported and restored by the admin groups of authenticated requests, configure authentication and --admin-group")))
+		return false
+	}
+	serverConfigMutex.RLock()
+	groups := adminGroups
+	serverConfigMutex.RUnlock()
+	for _, group := range identity.Groups {
+		if slices.Contains(groups, group) {
+			return true
+		}
+	}
+	c.JSON(http.StatusForbidden, errorResponse(errors.New("only the members of the admin groups may export and restore the server's state")))
+	return false
+}
+
+// lockServerState keeps the dashboards and acknowledgements from changing while the state is exported or restored
+func lockServerState() func() {
+	dashboards.mu.Lock()
+	acknowledgements.mu.Lock()
+	return func() {
+		acknowledgements.mu.Unlock()
+		dashboards.mu.Unlock()
+	}
+}
+
+func handleExportState(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+	unlock := lockServerState()
+	defer unlock()
+	bundle, err := exportState(serverState(), time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	c.JSON(http.StatusOK, bundle)
+}
+
+func handleRestoreState(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+	var bundle stateBundle
+	if err := c.BindJSON(&bundle); err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	unlock := lockServerState()
+	defer unlock()
+	if err := restoreState(serverState(), &bundle); err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	// The restored documents are read again on next use
+	dashboards.loaded = false
+	acknowledgements.loaded = false
+	c.JSON(http.StatusOK, gin.H{"restored": len(bundle.Documents)})
+}
+
+func init() {
+	rootCmd.AddCommand(stateCmd)
+	stateCmd.AddCommand(stateExportCmd, stateRestoreCmd)
+	stateCmd.PersistentFlags().StringVar(&storeURL, "store", "file", "The state store (file, memory, sqlite:<path>, postgres://<url>)")
+	stateCmd.PersistentFlags().StringVar(&dashboardsFile, "dashboards-file", "", "File the saved dashboards are kept in by the file store (default ~/.cyphernetes/dashboards.json)")
+	stateCmd.PersistentFlags().StringVar(&acknowledgementsFile, "acknowledgements-file", "", "File the acknowledged findings of reports are kept in by the file store (default ~/.cyphernetes/acknowledgements.json)")
+	stateExportCmd.Flags().StringVarP(&stateOutputFile, "output", "o", "", "Write the bundle to this file instead of the standard output")
+}
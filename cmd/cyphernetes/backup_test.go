@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestExportAndRestoreState(t *testing.T) {
+	source := &fileStore{dir: t.TempDir()}
+	source.Save("dashboards", []map[string]interface{}{{"id": "1", "title": "Pods"}})
+	source.Save("audit/baseline", map[string]interface{}{"ranAt": "2026-01-01T00:00:00Z"})
+	writeJSONFile(filepath.Join(source.dir, "telemetry.json"), map[string]interface{}{"enabled": true})
+
+	var out bytes.Buffer
+	now := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	if err := writeStateBundle(source, now, &out); err != nil {
+		t.Fatalf("writeStateBundle() error = %v", err)
+	}
+	var bundle stateBundle
+	if err := json.Unmarshal(out.Bytes(), &bundle); err != nil {
+		t.Fatalf("unexpected bundle %s: %v", out.String(), err)
+	}
+	if bundle.Version != stateBundleVersion || !bundle.ExportedAt.Equal(now) || len(bundle.Documents) != 2 {
+		t.Fatalf("expected the dashboards and the audit state only, got %s", out.String())
+	}
+
+	target, err := openStateStore("sqlite:" + filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+	target.Save("acknowledgements", []map[string]interface{}{{"id": "2"}})
+	if err := restoreState(target, &bundle); err != nil {
+		t.Fatalf("restoreState() error = %v", err)
+	}
+	if names, _ := target.Names(); !reflect.DeepEqual(names, []string{"acknowledgements", "audit/baseline", "dashboards"}) {
+		t.Errorf("expected the documents to be restored next to the others, got %v", names)
+	}
+	var restored []map[string]interface{}
+	if err := target.Load("dashboards", &restored); err != nil || len(restored) != 1 || restored[0]["title"] != "Pods" {
+		t.Errorf("expected the dashboards to be restored, got %v, %v", restored, err)
+	}
+
+	for _, invalid := range []stateBundle{
+		{Version: 2, Documents: map[string]json.RawMessage{}},
+		{Version: 1, Documents: map[string]json.RawMessage{"audit/../../.bashrc": json.RawMessage(`{}`)}},
+		{Version: 1, Documents: map[string]json.RawMessage{"history": json.RawMessage(`{}`)}},
+		{Version: 1, Documents: map[string]json.RawMessage{"dashboards": json.RawMessage(`[`)}},
+	} {
+		if err := restoreState(target, &invalid); err == nil {
+			t.Errorf("expected %+v to be rejected", invalid)
+		}
+	}
+}
+
+func TestStateAPI(t *testing.T) {
+	originalAuthenticators, originalStorage, originalDashboards, originalAdminGroups := apiAuthenticators, stateStorage, dashboards, adminGroups
+	defer func() {
+		apiAuthenticators, stateStorage, dashboards, adminGroups = originalAuthenticators, originalStorage, originalDashboards, originalAdminGroups
+	}()
+	authenticators := []authenticator{&staticTokenAuthenticator{tokens: map[string]*apiIdentity{
+		"alice": {User: "alice", Groups: []string{"platform"}},
+		"bob":   {User: "bob", Groups: []string{"dev"}},
+	}}}
+	adminGroups = []string{"platform"}
+	stateStorage = &memoryStore{documents: map[string][]byte{}}
+	dashboards = &dashboardStore{store: stateStorage}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	setupAPIRoutes(router)
+
+	// Without authentication, nobody is known to be an admin
+	apiAuthenticators = nil
+	for _, method := range []string{http.MethodGet, http.MethodPut} {
+		if w := apiRequest(router, "", method, "/api/admin/state", `{"version": 1, "documents": {}}`); w.Code != http.StatusForbidden {
+			t.Errorf("%s: expected unauthenticated requests to be forbidden, got %d", method, w.Code)
+		}
+	}
+	apiAuthenticators = authenticators
+
+	apiRequest(router, "bob", http.MethodPost, "/api/dashboards", `{"title": "Pods", "panels": []}`)
+	if w := apiRequest(router, "bob", http.MethodGet, "/api/admin/state", ""); w.Code != http.StatusForbidden {
+		t.Errorf("expected a user outside the admin groups to be forbidden, got %d", w.Code)
+	}
+	w := apiRequest(router, "alice", http.MethodGet, "/api/admin/state", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the state to be exported, got %d: %s", w.Code, w.Body.String())
+	}
+	var bundle stateBundle
+	json.Unmarshal(w.Body.Bytes(), &bundle)
+	if _, ok := bundle.Documents["dashboards"]; !ok {
+		t.Fatalf("expected the dashboards to be exported, got %s", w.Body.String())
+	}
+
+	// Restoring replaces the dashboards the server serves
+	apiRequest(router, "bob", http.MethodPost, "/api/dashboards", `{"title": "Nodes", "panels": []}`)
+	body, _ := json.Marshal(bundle)
+	if w := apiRequest(router, "alice", http.MethodPut, "/api/admin/state", string(body)); w.Code != http.StatusOK {
+		t.Fatalf("expected the state to be restored, got %d: %s", w.Code, w.Body.String())
+	}
+	var list []dashboard
+	json.Unmarshal(apiRequest(router, "bob", http.MethodGet, "/api/dashboards", "").Body.Bytes(), &list)
+	if len(list) != 1 || list[0].Title != "Pods" {
+		t.Errorf("expected the exported dashboards, got %+v", list)
+	}
+	if w := apiRequest(router, "alice", http.MethodPut, "/api/admin/state", `{"version": 3}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected an unsupported bundle to be rejected, got %d", w.Code)
+	}
+}
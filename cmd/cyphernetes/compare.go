@@ -0,0 +1,372 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
+	"github.com/spf13/cobra"
+)
+
+// compareTarget is one side of a comparison: a kubeconfig context ("" for the current one)
+// and a namespace ("" for all namespaces)
+type compareTarget struct {
+	context   string
+	namespace string
+}
+
+func (t compareTarget) String() string {
+	context := t.context
+	if context == "" {
+		context = "current context"
+	}
+	if t.namespace == "" {
+		return context + " (all namespaces)"
+	}
+	return context + "/" + t.namespace
+}
+
+var (
+	compareLeftContext    string
+	compareRightContext   string
+	compareLeftNamespace  string
+	compareRightNamespace string
+	compareKey            string
+	compareView           string
+)
+
+var executeCompareQuery = queryCompareTarget
+
+var compareCmd = &cobra.Command{
+	Use:   "compare [Cypher-inspired query]",
+	Short: "Run a query against two clusters or namespaces and compare the results",
+	Long: `Use the 'compare' subcommand to run the same query against two targets (kubeconfig contexts and/or namespaces)
+and show which result rows only exist on one side and which fields differ. Rows are matched by --key.`,
+	Example: `  cyphernetes compare --left-context prod --right-context staging "MATCH (d:Deployment) RETURN d.spec.replicas"
+  cyphernetes compare --left-namespace blue --right-namespace green --view side-by-side "MATCH (c:ConfigMap) RETURN c.data"`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		parser.CleanOutput = true
+		namespace := parser.Namespace
+		if parser.AllNamespaces {
+			namespace = ""
+			parser.AllNamespaces = false
+		}
+		left := compareTarget{context: compareLeftContext, namespace: namespace}
+		if cmd.Flags().Changed("left-namespace") {
+			left.namespace = compareLeftNamespace
+		}
+		right := compareTarget{context: compareRightContext, namespace: namespace}
+		if cmd.Flags().Changed("right-namespace") {
+			right.namespace = compareRightNamespace
+		}
+		return runCompare(args[0], left, right, os.Stdout)
+	},
+}
+
+func runCompare(query string, left, right compareTarget, w io.Writer) error {
+	if compareView != "diff" && compareView != "side-by-side" {
+		return fmt.Errorf("unknown view %q, expected diff or side-by-side", compareView)
+	}
+
+	leftResults, err := executeCompareQuery(query, left)
+	if err != nil {
+		return fmt.Errorf("error querying %s >> %w", left, err)
+	}
+	rightResults, err := executeCompareQuery(query, right)
+	if err != nil {
+		return fmt.Errorf("error querying %s >> %w", right, err)
+	}
+
+	diffs := compareResults(leftResults, rightResults, compareKey)
+	if compareView == "side-by-side" {
+		renderSideBySide(w, diffs, left.String(), right.String())
+	} else {
+		renderDiff(w, diffs, left.String(), right.String())
+	}
+	return nil
+}
+
+// queryCompareTarget runs the query against one target, each with its own client and caches
+func queryCompareTarget(query string, target compareTarget) (map[string]interface{}, error) {
+	// Parse per target, executing a query consumes parts of its AST (e.g. namespace properties)
+	ast, err := parser.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing query >> %w", err)
+	}
+
+	parser.RestoreClusterState(parser.ClusterState{})
+	targetExecutor, err := parser.NewQueryExecutorForContext(target.context)
+	if err != nil {
+		return nil, err
+	}
+	parser.SetQueryExecutorInstance(targetExecutor)
+	initResourceSpecsOrWarn()
+
+	parser.Namespace = target.namespace
+	results, err := targetExecutor.Execute(ast, "")
+	if err != nil {
+		return nil, fmt.Errorf("error executing query >> %w", err)
+	}
+
+	// Round-trip through JSON so both sides hold the same plain types
+	data, err := json.Marshal(results.Data)
+	if err != nil {
+		return nil, err
+	}
+	var normalized map[string]interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
+// Row states in a comparison
+const (
+	rowSame      = "same"
+	rowChanged   = "changed"
+	rowOnlyLeft  = "only-left"
+	rowOnlyRight = "only-right"
+)
+
+type fieldDiff struct {
+	path  string
+	left  string
+	right string
+}
+
+type rowDiff struct {
+	key    string
+	status string
+	// fields holds every field of the row, differing or not
+	fields []fieldDiff
+}
+
+// variableDiff holds the compared rows of one RETURN variable, sorted by key
+type variableDiff struct {
+	variable string
+	rows     []rowDiff
+}
+
+// compareResults matches the rows of each returned variable by the value at keyPath
+func compareResults(left, right map[string]interface{}, keyPath string) []variableDiff {
+	variables := map[string]bool{}
+	for variable := range left {
+		variables[variable] = true
+	}
+	for variable := range right {
+		variables[variable] = true
+	}
+	var names []string
+	for variable := range variables {
+		names = append(names, variable)
+	}
+	sort.Strings(names)
+
+	var diffs []variableDiff
+	for _, variable := range names {
+		leftRows := keyRows(variable, left[variable], keyPath)
+		rightRows := keyRows(variable, right[variable], keyPath)
+
+		keys := map[string]bool{}
+		for key := range leftRows {
+			keys[key] = true
+		}
+		for key := range rightRows {
+			keys[key] = true
+		}
+		var sortedKeys []string
+		for key := range keys {
+			sortedKeys = append(sortedKeys, key)
+		}
+		sort.Strings(sortedKeys)
+
+		diff := variableDiff{variable: variable}
+		for _, key := range sortedKeys {
+			leftRow, inLeft := leftRows[key]
+			rightRow, inRight := rightRows[key]
+			row := rowDiff{key: key, fields: diffFields(leftRow, rightRow)}
+			switch {
+			case !inRight:
+				row.status = rowOnlyLeft
+			case !inLeft:
+				row.status = rowOnlyRight
+			default:
+				row.status = rowSame
+				for _, field := range row.fields {
+					if field.left != field.right {
+						row.status = rowChanged
+						break
+					}
+				}
+			}
+			diff.rows = append(diff.rows, row)
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs
+}
+
+// keyRows indexes a variable's rows by key. Aggregates are a single row keyed by the variable name.
+func keyRows(variable string, value interface{}, keyPath string) map[string]map[string]interface{} {
+	rows := map[string]map[string]interface{}{}
+	switch v := value.(type) {
+	case []interface{}:
+		for i, item := range v {
+			row, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			key, found := lookupPath(row, keyPath)
+			if !found && keyPath == "name" {
+				// Whole objects (RETURN d) carry their name under metadata
+				key, found = lookupPath(row, "metadata.name")
+			}
+			if !found {
+				key = fmt.Sprintf("#%d", i)
+			}
+			rows[key] = row
+		}
+	case map[string]interface{}:
+		rows[variable] = v
+	}
+	return rows
+}
+
+func lookupPath(row map[string]interface{}, path string) (string, bool) {
+	var current interface{} = row
+	for _, part := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if current, ok = m[part]; !ok {
+			return "", false
+		}
+	}
+	return fmt.Sprint(current), true
+}
+
+func diffFields(left, right map[string]interface{}) []fieldDiff {
+	leftFields := map[string]string{}
+	rightFields := map[string]string{}
+	flattenRow("", left, leftFields)
+	flattenRow("", right, rightFields)
+
+	paths := map[string]bool{}
+	for path := range leftFields {
+		paths[path] = true
+	}
+	for path := range rightFields {
+		paths[path] = true
+	}
+	var sortedPaths []string
+	for path := range paths {
+		sortedPaths = append(sortedPaths, path)
+	}
+	sort.Strings(sortedPaths)
+
+	var fields []fieldDiff
+	for _, path := range sortedPaths {
+		fields = append(fields, fieldDiff{path: path, left: leftFields[path], right: rightFields[path]})
+	}
+	return fields
+}
+
+// flattenRow turns nested maps and lists into path -> JSON value, e.g. spec.ports[0].port -> 80
+func flattenRow(prefix string, value interface{}, fields map[string]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			flattenRow(path, child, fields)
+		}
+	case []interface{}:
+		for i, child := range v {
+			flattenRow(fmt.Sprintf("%s[%d]", prefix, i), child, fields)
+		}
+	default:
+		if prefix == "" {
+			return
+		}
+		encoded, _ := json.Marshal(v)
+		fields[prefix] = string(encoded)
+	}
+}
+
+func renderDiff(w io.Writer, diffs []variableDiff, left, right string) {
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", left, right)
+	differences := 0
+	for _, diff := range diffs {
+		var lines []string
+		for _, row := range diff.rows {
+			switch row.status {
+			case rowOnlyLeft:
+				lines = append(lines, "- "+row.key)
+			case rowOnlyRight:
+				lines = append(lines, "+ "+row.key)
+			case rowChanged:
+				lines = append(lines, "~ "+row.key)
+				for _, field := range row.fields {
+					if field.left != field.right {
+						lines = append(lines, fmt.Sprintf("    %s: %s -> %s", field.path, orMissing(field.left), orMissing(field.right)))
+					}
+				}
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		differences++
+		fmt.Fprintf(w, "@@ %s @@\n", diff.variable)
+		for _, line := range lines {
+			fmt.Fprintln(w, line)
+		}
+	}
+	if differences == 0 {
+		fmt.Fprintln(w, "No differences")
+	}
+}
+
+func renderSideBySide(w io.Writer, diffs []variableDiff, left, right string) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, diff := range diffs {
+		fmt.Fprintf(tw, "%s\n", diff.variable)
+		fmt.Fprintf(tw, "  KEY\tFIELD\t%s\t%s\n", left, right)
+		for _, row := range diff.rows {
+			for _, field := range row.fields {
+				marker := " "
+				if field.left != field.right {
+					marker = "*"
+				}
+				fmt.Fprintf(tw, "%s %s\t%s\t%s\t%s\n", marker, row.key, field.path, orMissing(field.left), orMissing(field.right))
+			}
+		}
+	}
+	tw.Flush()
+}
+
+func orMissing(value string) string {
+	if value == "" {
+		return "<missing>"
+	}
+	return value
+}
+
+func init() {
+	rootCmd.AddCommand(compareCmd)
+	compareCmd.Flags().StringVar(&compareLeftContext, "left-context", "", "Kubeconfig context of the left side (default: current context)")
+	compareCmd.Flags().StringVar(&compareRightContext, "right-context", "", "Kubeconfig context of the right side (default: current context)")
+	compareCmd.Flags().StringVar(&compareLeftNamespace, "left-namespace", "", "Namespace of the left side (default: --namespace)")
+	compareCmd.Flags().StringVar(&compareRightNamespace, "right-namespace", "", "Namespace of the right side (default: --namespace)")
+	compareCmd.Flags().StringVar(&compareKey, "key", "name", "Path within each result row used to match rows across both sides")
+	compareCmd.Flags().StringVar(&compareView, "view", "diff", "How to render the comparison (diff, side-by-side)")
+}
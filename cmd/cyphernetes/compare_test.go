@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func stubCompareQuery(t *testing.T) {
+	originalExecuteCompareQuery := executeCompareQuery
+	t.Cleanup(func() { executeCompareQuery = originalExecuteCompareQuery })
+
+	executeCompareQuery = func(query string, target compareTarget) (map[string]interface{}, error) {
+		switch target.context {
+		case "prod":
+			return map[string]interface{}{
+				"d": []interface{}{
+					map[string]interface{}{"name": "api", "spec": map[string]interface{}{"replicas": float64(4)}},
+					map[string]interface{}{"name": "legacy", "spec": map[string]interface{}{"replicas": float64(1)}},
+					map[string]interface{}{"name": "web", "spec": map[string]interface{}{"replicas": float64(2)}},
+				},
+			}, nil
+		case "staging":
+			return map[string]interface{}{
+				"d": []interface{}{
+					map[string]interface{}{"name": "api", "spec": map[string]interface{}{"replicas": float64(1)}},
+					map[string]interface{}{"name": "web", "spec": map[string]interface{}{"replicas": float64(2)}},
+					map[string]interface{}{"name": "worker", "spec": map[string]interface{}{"replicas": float64(1)}},
+				},
+			}, nil
+		}
+		return nil, fmt.Errorf("context %s not found", target.context)
+	}
+}
+
+func TestRunCompareDiff(t *testing.T) {
+	stubCompareQuery(t)
+	compareKey, compareView = "name", "diff"
+
+	var buf bytes.Buffer
+	if err := runCompare("MATCH (d:Deployment) RETURN d.spec.replicas", compareTarget{"prod", "default"}, compareTarget{"staging", "default"}, &buf); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := `--- prod/default
++++ staging/default
+@@ d @@
+~ api
+    spec.replicas: 4 -> 1
+- legacy
++ worker
+`
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+}
+
+func TestRunCompareNoDifferences(t *testing.T) {
+	stubCompareQuery(t)
+	compareKey, compareView = "name", "diff"
+
+	var buf bytes.Buffer
+	if err := runCompare("MATCH (d:Deployment) RETURN d.spec.replicas", compareTarget{"prod", ""}, compareTarget{"prod", "default"}, &buf); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := "--- prod (all namespaces)\n+++ prod/default\nNo differences\n"
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+}
+
+func TestRunCompareSideBySide(t *testing.T) {
+	stubCompareQuery(t)
+	compareKey, compareView = "name", "side-by-side"
+	defer func() { compareView = "diff" }()
+
+	var buf bytes.Buffer
+	if err := runCompare("MATCH (d:Deployment) RETURN d.spec.replicas", compareTarget{"prod", "default"}, compareTarget{"staging", "default"}, &buf); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 10 {
+		t.Fatalf("Expected a header and 4 rows of 2 fields, got:\n%s", buf.String())
+	}
+	if fields := strings.Fields(lines[2]); strings.Join(fields, " ") != `api name "api" "api"` {
+		t.Errorf("Expected the matching name not to be marked, got %q", lines[2])
+	}
+	if fields := strings.Fields(lines[3]); strings.Join(fields, " ") != "* api spec.replicas 4 1" {
+		t.Errorf("Expected the differing replicas to be marked, got %q", lines[3])
+	}
+	if fields := strings.Fields(lines[5]); strings.Join(fields, " ") != "* legacy spec.replicas 1 <missing>" {
+		t.Errorf("Expected a row missing on the right, got %q", lines[5])
+	}
+}
+
+func TestRunCompareErrors(t *testing.T) {
+	stubCompareQuery(t)
+	compareKey, compareView = "name", "diff"
+
+	var buf bytes.Buffer
+	err := runCompare("MATCH (d:Deployment) RETURN d", compareTarget{"prod", "default"}, compareTarget{"dev", "default"}, &buf)
+	if err == nil || err.Error() != "error querying dev/default >> context dev not found" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected no output, got %q", buf.String())
+	}
+
+	compareView = "table"
+	defer func() { compareView = "diff" }()
+	err = runCompare("MATCH (d:Deployment) RETURN d", compareTarget{"prod", "default"}, compareTarget{"staging", "default"}, &buf)
+	if err == nil || !strings.HasPrefix(err.Error(), "unknown view") {
+		t.Errorf("Expected an unknown view error, got %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var namespacesGVR = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+
+// runContextCommand backs the :context shell command.
+//
+//	:context         show the kubeconfig context queries run against
+//	:context <name>  switch the current session to another context, with a new client and empty caches
+func runContextCommand(args []string) (string, error) {
+	startTime := time.Now()
+	defer func() { execTime = time.Since(startTime) }()
+
+	switch len(args) {
+	case 0:
+		return fmt.Sprintf("Context: %s", ctx), nil
+	case 1:
+	default:
+		return "", fmt.Errorf("usage: :context [<name>]")
+	}
+
+	name := args[0]
+	if name == ctx {
+		return fmt.Sprintf("Already on context %s", name), nil
+	}
+	config, err := parser.KubeClientConfig("").RawConfig()
+	if err != nil {
+		return "", fmt.Errorf("error loading kubeconfig: %v", err)
+	}
+	kubeContext, ok := config.Contexts[name]
+	if !ok {
+		return "", fmt.Errorf("context %s not found in kubeconfig", name)
+	}
+
+	// Start with empty caches so nothing leaks between clusters
+	state := parser.SaveClusterState()
+	parser.RestoreClusterState(parser.ClusterState{})
+	contextExecutor, err := newSessionExecutor(name)
+	if err != nil {
+		parser.RestoreClusterState(state)
+		return "", err
+	}
+	ctx = name
+	useExecutor(contextExecutor)
+	if session, ok := sessions[currentSession]; ok {
+		session.context = name
+	}
+	if kubeContext.Namespace != "" {
+		parser.Namespace = kubeContext.Namespace
+	}
+	return fmt.Sprintf("Switched to context %s (namespace: %s)", name, namespaceLabel(parser.Namespace)), nil
+}
+
+// runContextsCommand backs the :contexts shell command, listing the contexts of the kubeconfig
+func runContextsCommand(args []string) (string, error) {
+	startTime := time.Now()
+	defer func() { execTime = time.Since(startTime) }()
+
+	if len(args) > 0 {
+		return "", fmt.Errorf("usage: :contexts")
+	}
+	config, err := parser.KubeClientConfig("").RawConfig()
+	if err != nil {
+		return "", fmt.Errorf("error loading kubeconfig: %v", err)
+	}
+	names := make([]string, 0, len(config.Contexts))
+	for name := range config.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, name := range names {
+		marker := " "
+		if name == ctx {
+			marker = "*"
+		}
+		kubeContext := config.Contexts[name]
+		// Contexts without a namespace use the default one
+		namespace := kubeContext.Namespace
+		if namespace == "" {
+			namespace = "default"
+		}
+		sb.WriteString(fmt.Sprintf("%s %s (cluster: %s, namespace: %s)\n", marker, name, kubeContext.Cluster, namespace))
+	}
+	return strings.TrimSuffix(sb.String(), "\n"), nil
+}
+
+// runNamespaceCommand backs the :namespace shell command.
+//
+//	:namespace              show the namespace queries run in
+//	:namespace <name>|all   switch to another namespace, or to all of them
+func runNamespaceCommand(args []string) (string, error) {
+	startTime := time.Now()
+	defer func() { execTime = time.Since(startTime) }()
+
+	switch len(args) {
+	case 0:
+		return fmt.Sprintf("Namespace: %s", namespaceLabel(parser.Namespace)), nil
+	case 1:
+	default:
+		return "", fmt.Errorf("usage: :namespace [<name>|all]")
+	}
+	switchNamespace(args[0])
+	return fmt.Sprintf("Switched to namespace %s", namespaceLabel(parser.Namespace)), nil
+}
+
+// runNamespacesCommand backs the :namespaces shell command, listing the namespaces of the cluster
+func runNamespacesCommand(args []string) (string, error) {
+	startTime := time.Now()
+	defer func() { execTime = time.Since(startTime) }()
+
+	if len(args) > 0 {
+		return "", fmt.Errorf("usage: :namespaces")
+	}
+	list, err := executor.DynamicClient.Resource(namespacesGVR).List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return "", fmt.Errorf("error listing namespaces: %v", err)
+	}
+	names := make([]string, 0, len(list.Items))
+	for _, item := range list.Items {
+		names = append(names, item.GetName())
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, name := range names {
+		marker := " "
+		if name == parser.Namespace {
+			marker = "*"
+		}
+		sb.WriteString(fmt.Sprintf("%s %s\n", marker, name))
+	}
+	return strings.TrimSuffix(sb.String(), "\n"), nil
+}
+
+// switchNamespace makes queries run in the named namespace, or in all of them for "all"
+func switchNamespace(name string) {
+	if strings.ToLower(name) == "all" {
+		parser.Namespace = ""
+	} else {
+		parser.Namespace = strings.ToLower(name)
+	}
+}
+
+func namespaceLabel(namespace string) string {
+	if namespace == "" {
+		return "all namespaces"
+	}
+	return namespace
+}
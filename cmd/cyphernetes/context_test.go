@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+current-context: dev
+clusters:
+- name: dev-cluster
+  cluster: {server: https://dev.example.com}
+- name: prod-cluster
+  cluster: {server: https://prod.example.com}
+users:
+- name: admin
+  user: {token: secret}
+contexts:
+- name: dev
+  context: {cluster: dev-cluster, user: admin}
+- name: prod
+  context: {cluster: prod-cluster, user: admin, namespace: payments}
+`
+
+func TestContextCommands(t *testing.T) {
+	originalNewSessionExecutor := newSessionExecutor
+	originalExecutor := executor
+	originalCtx := ctx
+	originalNamespace := parser.Namespace
+	originalKubeconfig := parser.Kubeconfig
+	defer func() {
+		newSessionExecutor = originalNewSessionExecutor
+		executor = originalExecutor
+		ctx = originalCtx
+		parser.Namespace = originalNamespace
+		parser.Kubeconfig = originalKubeconfig
+		sessions = make(map[string]*shellSession)
+		currentSession = ""
+		parser.RestoreClusterState(parser.ClusterState{})
+	}()
+
+	parser.Kubeconfig = filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(parser.Kubeconfig, []byte(testKubeconfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	prodExecutor := &parser.QueryExecutor{}
+	newSessionExecutor = func(contextName string) (*parser.QueryExecutor, error) {
+		return prodExecutor, nil
+	}
+	executor = &parser.QueryExecutor{}
+	ctx = "dev"
+	parser.Namespace = "default"
+
+	list, err := executeMacro(":contexts")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "* dev (cluster: dev-cluster, namespace: default)\n  prod (cluster: prod-cluster, namespace: payments)"
+	if list != expected {
+		t.Errorf("Expected contexts:\n%s\ngot:\n%s", expected, list)
+	}
+
+	result, err := executeMacro(":context prod")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result != "Switched to context prod (namespace: payments)" {
+		t.Errorf("Unexpected result %q", result)
+	}
+	if ctx != "prod" || executor != prodExecutor || parser.GetQueryExecutorInstance() != prodExecutor || parser.Namespace != "payments" {
+		t.Errorf("Expected queries to run on the prod context in payments, got context %s, namespace %s", ctx, parser.Namespace)
+	}
+	if _, err := executeMacro(":context staging"); err == nil || err.Error() != "context staging not found in kubeconfig" {
+		t.Errorf("Expected an unknown context to fail, got %v", err)
+	}
+	if ctx != "prod" {
+		t.Errorf("Expected a failed switch to stay on prod, got %s", ctx)
+	}
+
+	if result, _ := executeMacro(":namespace ALL"); result != "Switched to namespace all namespaces" || parser.Namespace != "" {
+		t.Errorf("Expected all namespaces, got %q", result)
+	}
+	if result, _ := executeMacro(":namespace kube-system"); result != "Switched to namespace kube-system" || parser.Namespace != "kube-system" {
+		t.Errorf("Expected kube-system, got %q", result)
+	}
+
+	namespace := func(name string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1", "kind": "Namespace", "metadata": map[string]interface{}{"name": name},
+		}}
+	}
+	prodExecutor.DynamicClient = dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{namespacesGVR: "NamespaceList"},
+		namespace("kube-system"), namespace("default"), namespace("payments"),
+	)
+	list, err = executeMacro(":namespaces")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := "  default\n* kube-system\n  payments"; list != expected {
+		t.Errorf("Expected namespaces:\n%s\ngot:\n%s", expected, list)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// -o csv and -o tsv print the rows a query returns for its variable as a table, one row per resource and one column
+// per field it returns, e.g. name and spec.replicas for RETURN d.spec.replicas, after a header row naming them.
+// A query returning only aggregates, e.g. RETURN count(p), prints one row of them. With --rows, the table has the
+// rows of the query, a column per item it returns, which a query returning several variables can be printed as too.
+// Cells are flattened:
+//
+//   - objects are spread across columns, their fields joined to the path of the object with dots
+//   - lists of scalars are joined with semicolons, e.g. nginx:1.25;envoy:1.30
+//   - lists of objects, and lists of lists, are printed as JSON
+//   - missing and null fields are empty
+//
+// CSV quotes the cells that need it, TSV escapes the tabs, newlines and backslashes of cells as \t, \n and \\.
+
+// tablePrinter prints results as CSV, or as TSV if tabs is set
+func tablePrinter(tabs bool) resultsPrinter {
+	return func(data interface{}, w io.Writer) {
+		// Tables are built from the results as JSON decodes them, like templates see them
+		decoded, err := decodeResults(data)
+		if err != nil {
+			fmt.Fprintln(w, "Error marshalling results: ", err)
+			return
+		}
+		header, rows, err := tabulate(decoded)
+		if err != nil {
+			fmt.Fprintln(w, "Error formatting results: ", err)
+			return
+		}
+		// Without rows, the columns aren't known
+		if len(header) == 0 {
+			return
+		}
+		if tabs {
+			for _, record := range append([][]string{header}, rows...) {
+				for i, cell := range record {
+					record[i] = tsvEscaper.Replace(cell)
+				}
+				fmt.Fprintln(w, strings.Join(record, "\t"))
+			}
+			return
+		}
+		if err := csv.NewWriter(w).WriteAll(append([][]string{header}, rows...)); err != nil {
+			fmt.Fprintln(w, "Error writing results: ", err)
+		}
+	}
+}
+
+var tsvEscaper = strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n", "\r", "\\r")
+
+// errSeveralQueries is the error of printing the results of run --combined as a table
+var errSeveralQueries = errors.New("the results of several queries can't be printed as one table")
+
+// tabulate turns the results of a query into the header and rows of a table
+func tabulate(data interface{}) ([]string, [][]string, error) {
+	// The rows of --rows are those of the table
+	if items, ok := data.([]interface{}); ok && returnRows {
+		var records []map[string]string
+		for _, item := range items {
+			if _, ok := item.(map[string]interface{}); !ok {
+				return nil, nil, errSeveralQueries
+			}
+			record := make(map[string]string)
+			flattenCells("", item, record)
+			records = append(records, record)
+		}
+		return tableRows(records)
+	}
+	results, ok := data.(map[string]interface{})
+	if !ok {
+		return nil, nil, errSeveralQueries
+	}
+	var variables []string
+	for key := range results {
+		if key != "aggregate" {
+			variables = append(variables, key)
+		}
+	}
+	sort.Strings(variables)
+	aggregate, hasAggregate := results["aggregate"].(map[string]interface{})
+
+	var records []map[string]string
+	switch {
+	case len(variables) == 0 && hasAggregate:
+		record := make(map[string]string)
+		flattenCells("", aggregate, record)
+		records = append(records, record)
+	case len(variables) == 1 && !hasAggregate:
+		items, _ := results[variables[0]].([]interface{})
+		for _, item := range items {
+			record := make(map[string]string)
+			flattenCells("", item, record)
+			records = append(records, record)
+		}
+	case len(variables) == 0:
+		return nil, nil, nil
+	default:
+		returned := variables
+		if hasAggregate {
+			returned = append(returned, "aggregates")
+		}
+		return nil, nil, fmt.Errorf("a table holds the rows of a single variable or aggregates, the query returns %s, print its rows with --rows", strings.Join(returned, ", "))
+	}
+
+	return tableRows(records)
+}
+
+// tableRows are the header and rows of a table of records
+func tableRows(records []map[string]string) ([]string, [][]string, error) {
+	header := tableColumns(records)
+	rows := make([][]string, 0, len(records))
+	for _, record := range records {
+		row := make([]string, len(header))
+		for i, column := range header {
+			row[i] = record[column]
+		}
+		rows = append(rows, row)
+	}
+	return header, rows, nil
+}
+
+// tableColumns are the columns of the records, name first as it identifies the resource of a row, then the others
+// in order
+func tableColumns(records []map[string]string) []string {
+	seen := make(map[string]bool)
+	var columns []string
+	for _, record := range records {
+		for column := range record {
+			if !seen[column] {
+				seen[column] = true
+				columns = append(columns, column)
+			}
+		}
+	}
+	sort.Slice(columns, func(i, j int) bool {
+		if (columns[i] == "name") != (columns[j] == "name") {
+			return columns[i] == "name"
+		}
+		return columns[i] < columns[j]
+	})
+	return columns
+}
+
+// flattenCells sets the cells of a value in record, spreading objects across columns
+func flattenCells(column string, value interface{}, record map[string]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			flattenCells(joinFieldPath(column, key), child, record)
+		}
+		if len(v) == 0 && column != "" {
+			record[column] = ""
+		}
+	case []interface{}:
+		cells := make([]string, 0, len(v))
+		for _, item := range v {
+			switch item.(type) {
+			case map[string]interface{}, []interface{}:
+				encoded, _ := json.Marshal(v)
+				record[column] = string(encoded)
+				return
+			}
+			cells = append(cells, scalarCell(item))
+		}
+		record[column] = strings.Join(cells, ";")
+	default:
+		if column != "" {
+			record[column] = scalarCell(v)
+		}
+	}
+}
+
+// scalarCell is the cell of a string, number, boolean or null, strings being printed as they are
+func scalarCell(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	}
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
+
+func joinFieldPath(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTablePrinter(t *testing.T) {
+	deployments := map[string]interface{}{
+		"d": []interface{}{
+			map[string]interface{}{
+				"name": "web",
+				"spec": map[string]interface{}{
+					"replicas": int64(3),
+					"template": map[string]interface{}{"spec": map[string]interface{}{"containers": []interface{}{
+						map[string]interface{}{"image": "nginx:1.25"},
+					}}},
+				},
+				"metadata": map[string]interface{}{"annotations": map[string]interface{}{"note": "says \"hi\",\tthen\nleaves"}},
+			},
+			map[string]interface{}{
+				"name":   "api",
+				"spec":   map[string]interface{}{"replicas": int64(2)},
+				"images": []interface{}{"envoy:1.30", "api:2.1"},
+			},
+		},
+	}
+	tests := []struct {
+		name     string
+		data     interface{}
+		tabs     bool
+		rows     bool
+		expected string
+	}{
+		{
+			name: "CSV",
+			data: deployments,
+			expected: `name,images,metadata.annotations.note,spec.replicas,spec.template.spec.containers
+web,,"says ""hi"",	then
+leaves",3,"[{""image"":""nginx:1.25""}]"
+api,envoy:1.30;api:2.1,,2,
+`,
+		},
+		{
+			name: "TSV",
+			data: deployments,
+			tabs: true,
+			expected: "name\timages\tmetadata.annotations.note\tspec.replicas\tspec.template.spec.containers\n" +
+				"web\t\tsays \"hi\",\\tthen\\nleaves\t3\t[{\"image\":\"nginx:1.25\"}]\n" +
+				"api\tenvoy:1.30;api:2.1\t\t2\t\n",
+		},
+		{
+			name:     "Aggregates",
+			data:     map[string]interface{}{"aggregate": map[string]interface{}{"count(p)": 4, "sum(d.spec.replicas)": 5.5}},
+			expected: "count(p),sum(d.spec.replicas)\n4,5.5\n",
+		},
+		{
+			name:     "No rows",
+			data:     map[string]interface{}{"d": []interface{}{}},
+			expected: "",
+		},
+		{
+			name:     "Several variables",
+			data:     map[string]interface{}{"d": []interface{}{}, "p": []interface{}{}},
+			expected: "Error formatting results:  a table holds the rows of a single variable or aggregates, the query returns d, p, print its rows with --rows\n",
+		},
+		{
+			name: "Rows",
+			data: []interface{}{
+				map[string]interface{}{"deployment": "web", "p.metadata.name": "web-1", "p.spec.containers[*].image": []interface{}{"nginx", "envoy"}},
+				map[string]interface{}{"deployment": "web", "p.metadata.name": "web-2", "p.spec.containers[*].image": []interface{}{"nginx"}},
+			},
+			rows:     true,
+			expected: "deployment,p.metadata.name,p.spec.containers[*].image\nweb,web-1,nginx;envoy\nweb,web-2,nginx\n",
+		},
+		{
+			name:     "Rows of several queries",
+			data:     []interface{}{[]interface{}{}, []interface{}{}},
+			rows:     true,
+			expected: "Error formatting results:  the results of several queries can't be printed as one table\n",
+		},
+		{
+			name:     "Several queries",
+			data:     []interface{}{deployments, deployments},
+			expected: "Error formatting results:  the results of several queries can't be printed as one table\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			returnRows = tt.rows
+			defer func() { returnRows = false }()
+			buf := new(bytes.Buffer)
+			tablePrinter(tt.tabs)(tt.data, buf)
+			if buf.String() != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, buf.String())
+			}
+		})
+	}
+}
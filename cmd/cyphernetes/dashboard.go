@@ -0,0 +1,264 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
+	"github.com/gin-gonic/gin"
+)
+
+// Dashboards are saved collections of queries shown as panels by the web client. They are stored by the server,
+// so a team shares them: a dashboard is visible to its owner and to the groups of its roles, or to everyone if it
+// has no roles. Only its owner may change it. Without authentication, every dashboard is visible to and may be
+// changed by everyone.
+
+// dashboardPanelTypes are how a panel shows the result of its query
+var dashboardPanelTypes = []string{"table", "graph", "stat"}
+
+type dashboardPanel struct {
+	Title string `json:"title"`
+	Query string `json:"query"`
+	// Type is table, graph or stat, which shows the first value of the result
+	Type string `json:"type"`
+	// Rule, if set, makes the panel a report: the findings acknowledged for the rule are hidden from it
+	Rule string `json:"rule,omitempty"`
+}
+
+type dashboard struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	// Owner is the user who created the dashboard, empty when the server doesn't authenticate requests
+	Owner string `json:"owner,omitempty"`
+	// Roles are the groups the dashboard is shared with
+	Roles []string `json:"roles,omitempty"`
+	// RefreshSeconds is how often panels whose queries can't be watched are run again, 0 to never refresh them
+	RefreshSeconds int              `json:"refreshSeconds,omitempty"`
+	Panels         []dashboardPanel `json:"panels"`
+	UpdatedAt      time.Time        `json:"updatedAt"`
+}
+
+// validate checks the dashboard has a title and its panels have a known type and a query that parses
+func (d *dashboard) validate() error {
+	if d.Title == "" {
+		return errors.New("a dashboard needs a title")
+	}
+	if d.RefreshSeconds < 0 {
+		return errors.New("refreshSeconds can't be negative")
+	}
+	for i, panel := range d.Panels {
+		if !slices.Contains(dashboardPanelTypes, panel.Type) {
+			return fmt.Errorf("panel %d: unknown type %q, expected one of %v", i+1, panel.Type, dashboardPanelTypes)
+		}
+		if _, err := parser.ParseQuery(panel.Query); err != nil {
+			return fmt.Errorf("panel %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// visibleTo reports whether an identity may see the dashboard, a nil identity when requests aren't authenticated
+func (d *dashboard) visibleTo(identity *apiIdentity) bool {
+	if identity == nil || len(d.Roles) == 0 || d.Owner == identity.User {
+		return true
+	}
+	for _, group := range identity.Groups {
+		if slices.Contains(d.Roles, group) {
+			return true
+		}
+	}
+	return false
+}
+
+// editableBy reports whether an identity may change or delete the dashboard
+func (d *dashboard) editableBy(identity *apiIdentity) bool {
+	return identity == nil || d.Owner == identity.User
+}
+
+// dashboardStore keeps the dashboards in the dashboards document of a state store, which is read on first use and
+// written on every change
+type dashboardStore struct {
+	store stateStore
+
+	mu         sync.Mutex
+	loaded     bool
+	dashboards map[string]*dashboard
+}
+
+// dashboardsFile is the file of the dashboards of the file store, ~/.cyphernetes/dashboards.json by default
+var dashboardsFile string
+
+var dashboards = &dashboardStore{}
+
+func (s *dashboardStore) load() error {
+	if s.loaded {
+		return nil
+	}
+	if s.store == nil {
+		s.store = serverState()
+	}
+	var list []*dashboard
+	if err := s.store.Load("dashboards", &list); err != nil {
+		return err
+	}
+	s.dashboards = map[string]*dashboard{}
+	for _, d := range list {
+		s.dashboards[d.ID] = d
+	}
+	s.loaded = true
+	return nil
+}
+
+func (s *dashboardStore) save() error {
+	return s.store.Save("dashboards", s.sorted(nil))
+}
+
+// sorted lists the dashboards the filter accepts by title, all of them if it's nil
+func (s *dashboardStore) sorted(filter func(*dashboard) bool) []*dashboard {
+	list := []*dashboard{}
+	for _, d := range s.dashboards {
+		if filter == nil || filter(d) {
+			list = append(list, d)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Title != list[j].Title {
+			return list[i].Title < list[j].Title
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// bindDashboard reads and validates the dashboard of a request's body
+func bindDashboard(c *gin.Context) (*dashboard, bool) {
+	var d dashboard
+	if err := c.BindJSON(&d); err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return nil, false
+	}
+	if d.Panels == nil {
+		d.Panels = []dashboardPanel{}
+	}
+	if err := d.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return nil, false
+	}
+	return &d, true
+}
+
+// lookupDashboard finds the dashboard of the request's id, answering 404 if the request's identity can't see it
+func lookupDashboard(c *gin.Context) (*dashboard, bool) {
+	if err := dashboards.load(); err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return nil, false
+	}
+	d, ok := dashboards.dashboards[c.Param("id")]
+	if !ok || !d.visibleTo(requestIdentity(c)) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "dashboard not found"})
+		return nil, false
+	}
+	return d, true
+}
+
+func handleListDashboards(c *gin.Context) {
+	dashboards.mu.Lock()
+	defer dashboards.mu.Unlock()
+	if err := dashboards.load(); err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	identity := requestIdentity(c)
+	c.JSON(http.StatusOK, dashboards.sorted(func(d *dashboard) bool { return d.visibleTo(identity) }))
+}
+
+func handleCreateDashboard(c *gin.Context) {
+	d, ok := bindDashboard(c)
+	if !ok {
+		return
+	}
+	dashboards.mu.Lock()
+	defer dashboards.mu.Unlock()
+	if err := dashboards.load(); err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	id, err := newRecordID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	d.ID = id
+	d.Owner = ""
+	if identity := requestIdentity(c); identity != nil {
+		d.Owner = identity.User
+	}
+	d.UpdatedAt = time.Now().UTC()
+	dashboards.dashboards[d.ID] = d
+	if err := dashboards.save(); err != nil {
+		delete(dashboards.dashboards, d.ID)
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	c.JSON(http.StatusCreated, d)
+}
+
+func handleGetDashboard(c *gin.Context) {
+	dashboards.mu.Lock()
+	defer dashboards.mu.Unlock()
+	if d, ok := lookupDashboard(c); ok {
+		c.JSON(http.StatusOK, d)
+	}
+}
+
+func handleUpdateDashboard(c *gin.Context) {
+	update, ok := bindDashboard(c)
+	if !ok {
+		return
+	}
+	dashboards.mu.Lock()
+	defer dashboards.mu.Unlock()
+	d, ok := lookupDashboard(c)
+	if !ok {
+		return
+	}
+	if !d.editableBy(requestIdentity(c)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the owner of a dashboard may change it"})
+		return
+	}
+	// The id and owner of a dashboard never change
+	update.ID, update.Owner = d.ID, d.Owner
+	update.UpdatedAt = time.Now().UTC()
+	dashboards.dashboards[d.ID] = update
+	if err := dashboards.save(); err != nil {
+		dashboards.dashboards[d.ID] = d
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	c.JSON(http.StatusOK, update)
+}
+
+func handleDeleteDashboard(c *gin.Context) {
+	dashboards.mu.Lock()
+	defer dashboards.mu.Unlock()
+	d, ok := lookupDashboard(c)
+	if !ok {
+		return
+	}
+	if !d.editableBy(requestIdentity(c)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the owner of a dashboard may delete it"})
+		return
+	}
+	delete(dashboards.dashboards, d.ID)
+	if err := dashboards.save(); err != nil {
+		dashboards.dashboards[d.ID] = d
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
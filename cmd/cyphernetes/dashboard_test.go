@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiRequest sends a request to the API as the user of token, returning the response
+func apiRequest(router *gin.Engine, token, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestDashboards(t *testing.T) {
+	originalAuthenticators, originalDashboards := apiAuthenticators, dashboards
+	defer func() { apiAuthenticators, dashboards = originalAuthenticators, originalDashboards }()
+	apiAuthenticators = []authenticator{&staticTokenAuthenticator{tokens: map[string]*apiIdentity{
+		"alice": {User: "alice", Groups: []string{"sre"}},
+		"bob":   {User: "bob", Groups: []string{"sre"}},
+		"carol": {User: "carol", Groups: []string{"dev"}},
+	}}}
+	store := &fileStore{dir: t.TempDir()}
+	dashboards = &dashboardStore{store: store}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	setupAPIRoutes(router)
+
+	// Panels must have a known type and a query that parses
+	for _, body := range []string{
+		`{"panels": []}`,
+		`{"title": "Pods", "panels": [{"title": "Pods", "query": "MATCH (p:Pod) RETURN p", "type": "pie"}]}`,
+		`{"title": "Pods", "panels": [{"title": "Pods", "query": "MATCH (p:Pod RETURN p", "type": "table"}]}`,
+	} {
+		if w := apiRequest(router, "alice", http.MethodPost, "/api/dashboards", body); w.Code != http.StatusBadRequest {
+			t.Errorf("expected %s to be rejected, got %d", body, w.Code)
+		}
+	}
+
+	w := apiRequest(router, "alice", http.MethodPost, "/api/dashboards",
+		`{"title": "Failing pods", "roles": ["sre"], "refreshSeconds": 30, "panels": [{"title": "Failed", "query": "MATCH (p:Pod) WHERE p.status.phase = \"Failed\" RETURN COUNT{p}", "type": "stat"}]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected the dashboard to be saved, got %d: %s", w.Code, w.Body.String())
+	}
+	var saved dashboard
+	if err := json.Unmarshal(w.Body.Bytes(), &saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved.ID == "" || saved.Owner != "alice" || len(saved.Panels) != 1 || saved.UpdatedAt.IsZero() {
+		t.Errorf("unexpected saved dashboard %+v", saved)
+	}
+	dashboardPath := "/api/dashboards/" + saved.ID
+
+	// The dashboard is shared with sre, which carol isn't in
+	for token, code := range map[string]int{"alice": http.StatusOK, "bob": http.StatusOK, "carol": http.StatusNotFound} {
+		if w := apiRequest(router, token, http.MethodGet, dashboardPath, ""); w.Code != code {
+			t.Errorf("%s: expected %d, got %d", token, code, w.Code)
+		}
+		var list []dashboard
+		json.Unmarshal(apiRequest(router, token, http.MethodGet, "/api/dashboards", "").Body.Bytes(), &list)
+		if visible := len(list) == 1; visible != (code == http.StatusOK) {
+			t.Errorf("%s: unexpected dashboards %+v", token, list)
+		}
+	}
+
+	// Only the owner may change or delete it
+	update := `{"title": "Failing workloads", "roles": ["sre", "dev"], "panels": []}`
+	if w := apiRequest(router, "bob", http.MethodPut, dashboardPath, update); w.Code != http.StatusForbidden {
+		t.Errorf("expected bob's change to be forbidden, got %d", w.Code)
+	}
+	if w := apiRequest(router, "bob", http.MethodDelete, dashboardPath, ""); w.Code != http.StatusForbidden {
+		t.Errorf("expected bob's delete to be forbidden, got %d", w.Code)
+	}
+	if w := apiRequest(router, "alice", http.MethodPut, dashboardPath, update); w.Code != http.StatusOK {
+		t.Errorf("expected alice's change to be saved, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := apiRequest(router, "carol", http.MethodGet, dashboardPath, ""); w.Code != http.StatusOK {
+		t.Errorf("expected the dashboard to be shared with dev, got %d", w.Code)
+	}
+
+	// Dashboards are kept in the file
+	dashboards = &dashboardStore{store: store}
+	w = apiRequest(router, "carol", http.MethodGet, dashboardPath, "")
+	var reloaded dashboard
+	json.Unmarshal(w.Body.Bytes(), &reloaded)
+	if reloaded.Title != "Failing workloads" || reloaded.Owner != "alice" {
+		t.Errorf("expected the changed dashboard to be read back, got %d %+v", w.Code, reloaded)
+	}
+
+	if w := apiRequest(router, "alice", http.MethodDelete, dashboardPath, ""); w.Code != http.StatusNoContent {
+		t.Errorf("expected alice's delete to succeed, got %d", w.Code)
+	}
+	if w := apiRequest(router, "alice", http.MethodGet, dashboardPath, ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected the dashboard to be gone, got %d", w.Code)
+	}
+}
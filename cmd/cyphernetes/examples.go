@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
+	"github.com/spf13/cobra"
+)
+
+//go:embed examples.txt
+var examplesContent string
+
+// exampleTopic is a category of example queries, each example is written and run like a macro
+type exampleTopic struct {
+	name        string
+	description string
+	examples    *MacroManager
+}
+
+var examplesCmd = &cobra.Command{
+	Use:   "examples [topic|example]",
+	Short: "Browse a library of example queries",
+	Long: `Use the 'examples' subcommand to browse ready-to-run example queries, grouped by topic.
+Without arguments it lists the topics, given a topic it lists its examples and given an example it shows its queries.`,
+	Example: `  cyphernetes examples
+  cyphernetes examples debugging
+  cyphernetes examples run workload nginx`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		topics, err := loadExamples(examplesContent)
+		if err != nil {
+			return fmt.Errorf("error loading examples >> %w", err)
+		}
+		if len(args) == 0 {
+			listExampleTopics(topics, os.Stdout)
+			return nil
+		}
+		return showExamples(topics, args[0], os.Stdout)
+	},
+}
+
+var examplesRunCmd = &cobra.Command{
+	Use:   "run <example> [arguments...]",
+	Short: "Run an example query by name",
+	Long:  `Use 'examples run' to run an example, passing its arguments in the order they are listed.`,
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		topics, err := loadExamples(examplesContent)
+		if err != nil {
+			return fmt.Errorf("error loading examples >> %w", err)
+		}
+		executor = parser.GetQueryExecutorInstance()
+		if executor == nil {
+			return errNoQueryExecutor
+		}
+		parser.CleanOutput = true
+		initResourceSpecsOrWarn()
+		runExample(topics, args[0], args[1:], os.Stdout)
+		return nil
+	},
+}
+
+// loadExamples splits the library into "[topic] description" sections and loads each section's examples
+func loadExamples(content string) ([]exampleTopic, error) {
+	var topics []exampleTopic
+	var body strings.Builder
+	addTopic := func() error {
+		if len(topics) == 0 {
+			return nil
+		}
+		topic := &topics[len(topics)-1]
+		if err := topic.examples.LoadMacrosFromString("examples.txt", body.String()); err != nil {
+			return fmt.Errorf("topic %s: %w", topic.name, err)
+		}
+		body.Reset()
+		return nil
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			if err := addTopic(); err != nil {
+				return nil, err
+			}
+			end := strings.Index(line, "]")
+			if end < 2 {
+				return nil, fmt.Errorf("invalid topic %q", line)
+			}
+			topics = append(topics, exampleTopic{
+				name:        line[1:end],
+				description: strings.TrimSpace(line[end+1:]),
+				examples:    NewMacroManager(),
+			})
+			continue
+		}
+		if len(topics) == 0 {
+			if line != "" && !strings.HasPrefix(line, "#") {
+				return nil, fmt.Errorf("example found outside of a topic: %q", line)
+			}
+			continue
+		}
+		body.WriteString(line + "\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := addTopic(); err != nil {
+		return nil, err
+	}
+	return topics, nil
+}
+
+// findExample returns the example with the given name, whatever its topic
+func findExample(topics []exampleTopic, name string) (*exampleTopic, *Macro) {
+	for i := range topics {
+		if example, ok := topics[i].examples.Macros[name]; ok {
+			return &topics[i], example
+		}
+	}
+	return nil, nil
+}
+
+func sortedExamples(topic exampleTopic) []*Macro {
+	var examples []*Macro
+	for _, example := range topic.examples.Macros {
+		examples = append(examples, example)
+	}
+	sort.Slice(examples, func(i, j int) bool { return examples[i].Name < examples[j].Name })
+	return examples
+}
+
+// exampleUsage is how an example is invoked, e.g. "workload <deployment>"
+func exampleUsage(example *Macro) string {
+	usage := example.Name
+	for _, arg := range example.Args {
+		usage += " <" + arg + ">"
+	}
+	return usage
+}
+
+func listExampleTopics(topics []exampleTopic, w io.Writer) {
+	fmt.Fprintln(w, "Example topics:")
+	for _, topic := range topics {
+		fmt.Fprintf(w, "  %-12s %s (%d examples)\n", topic.name, topic.description, len(topic.examples.Macros))
+	}
+	fmt.Fprintln(w, "\nList a topic's examples with: cyphernetes examples <topic>")
+}
+
+func showExamples(topics []exampleTopic, name string, w io.Writer) error {
+	for _, topic := range topics {
+		if topic.name != name {
+			continue
+		}
+		fmt.Fprintf(w, "%s - %s\n", topic.name, topic.description)
+		for _, example := range sortedExamples(topic) {
+			fmt.Fprintf(w, "\n  %s - %s\n", exampleUsage(example), example.Description)
+			for _, stmt := range example.Statements {
+				fmt.Fprintf(w, "    %s\n", stmt)
+			}
+		}
+		fmt.Fprintln(w, "\nRun an example with: cyphernetes examples run <example> [arguments...]")
+		return nil
+	}
+
+	topic, example := findExample(topics, name)
+	if example == nil {
+		return fmt.Errorf("no topic or example named '%s'", name)
+	}
+	fmt.Fprintf(w, "%s (%s) - %s\n", exampleUsage(example), topic.name, example.Description)
+	for _, stmt := range example.Statements {
+		fmt.Fprintf(w, "  %s\n", stmt)
+	}
+	return nil
+}
+
+// runExample fills in the example's arguments and runs its statements like the query command
+func runExample(topics []exampleTopic, name string, args []string, w io.Writer) {
+	topic, example := findExample(topics, name)
+	if example == nil {
+		fmt.Fprintf(w, "Error: no example named '%s'\n", name)
+		return
+	}
+	if len(args) != len(example.Args) {
+		fmt.Fprintf(w, "Error: usage: cyphernetes examples run %s\n", exampleUsage(example))
+		return
+	}
+	statements, err := topic.examples.ExecuteMacro(name, args)
+	if err != nil {
+		fmt.Fprintln(w, "Error: ", err)
+		return
+	}
+	for _, stmt := range statements {
+		runQuery([]string{strings.TrimSuffix(stmt, ";")}, w)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(examplesCmd)
+	examplesCmd.AddCommand(examplesRunCmd)
+	examplesRunCmd.Flags().BoolVarP(&disableColorJsonOutput, "raw-output", "r", false, "Disable colorized JSON output")
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
+)
+
+func TestExamplesParse(t *testing.T) {
+	topics, err := loadExamples(examplesContent)
+	if err != nil {
+		t.Fatalf("loadExamples() error = %v", err)
+	}
+	if len(topics) == 0 {
+		t.Fatalf("Expected example topics")
+	}
+
+	for _, topic := range topics {
+		if len(topic.examples.Macros) == 0 {
+			t.Errorf("Topic %s has no examples", topic.name)
+		}
+		for _, example := range topic.examples.Macros {
+			if example.Description == "" {
+				t.Errorf("Example %s has no description", example.Name)
+			}
+			for _, arg := range example.Args {
+				for _, other := range example.Args {
+					if arg != other && strings.HasPrefix(other, arg) {
+						t.Errorf("Example %s: argument $%s would also replace $%s", example.Name, arg, other)
+					}
+				}
+			}
+
+			args := make([]string, len(example.Args))
+			for i := range args {
+				args[i] = "example"
+			}
+			statements, err := topic.examples.ExecuteMacro(example.Name, args)
+			if err != nil {
+				t.Fatalf("ExecuteMacro(%s) error = %v", example.Name, err)
+			}
+			for _, stmt := range statements {
+				if _, err := parser.ParseQuery(strings.TrimSuffix(stmt, ";")); err != nil {
+					t.Errorf("Example %s doesn't parse: %v\n%s", example.Name, err, stmt)
+				}
+			}
+		}
+	}
+}
+
+func TestLoadExamplesErrors(t *testing.T) {
+	if _, err := loadExamples("MATCH (p:Pod) RETURN p;"); err == nil {
+		t.Errorf("Expected an error for an example outside of a topic")
+	}
+	if _, err := loadExamples("[debugging] Debugging\nMATCH (p:Pod) RETURN p;"); err == nil {
+		t.Errorf("Expected an error for a statement outside of an example")
+	}
+}
+
+func TestShowExamples(t *testing.T) {
+	topics, err := loadExamples(`[debugging] Find problems
+:pending # Pending pods
+MATCH (p:Pod)
+WHERE p.status.phase = "Pending"
+RETURN p;
+
+:podsonnode node # Pods on a node
+MATCH (p:Pod) WHERE p.spec.nodeName = "$node" RETURN p;
+`)
+	if err != nil {
+		t.Fatalf("loadExamples() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	listExampleTopics(topics, &buf)
+	if !strings.Contains(buf.String(), "debugging    Find problems (2 examples)") {
+		t.Errorf("Unexpected topics:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := showExamples(topics, "debugging", &buf); err != nil {
+		t.Fatalf("showExamples() error = %v", err)
+	}
+	expected := `debugging - Find problems
+
+  pending - Pending pods
+    MATCH (p:Pod) WHERE p.status.phase = "Pending" RETURN p;
+
+  podsonnode <node> - Pods on a node
+    MATCH (p:Pod) WHERE p.spec.nodeName = "$node" RETURN p;
+
+Run an example with: cyphernetes examples run <example> [arguments...]
+`
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+
+	buf.Reset()
+	if err := showExamples(topics, "podsonnode", &buf); err != nil {
+		t.Fatalf("showExamples() error = %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), "podsonnode <node> (debugging) - Pods on a node\n") {
+		t.Errorf("Unexpected example:\n%s", buf.String())
+	}
+
+	if err := showExamples(topics, "missing", &buf); err == nil {
+		t.Errorf("Expected an error for an unknown topic")
+	}
+}
+
+func TestRunExample(t *testing.T) {
+	topics, err := loadExamples("[debugging] Find problems\n:podsonnode node # Pods on a node\nMATCH (p:Pod) WHERE p.spec.nodeName = \"$node\" RETURN p;\n")
+	if err != nil {
+		t.Fatalf("loadExamples() error = %v", err)
+	}
+
+	originalParseQuery := parseQuery
+	originalNewQueryExecutor := newQueryExecutor
+	originalExecuteMethod := executeMethod
+	defer func() {
+		parseQuery = originalParseQuery
+		newQueryExecutor = originalNewQueryExecutor
+		executeMethod = originalExecuteMethod
+	}()
+
+	var queries []string
+	parseQuery = func(query string) (*parser.Expression, error) {
+		queries = append(queries, query)
+		return &parser.Expression{}, nil
+	}
+	newQueryExecutor = func() (*parser.QueryExecutor, error) {
+		return &parser.QueryExecutor{}, nil
+	}
+	executeMethod = func(qe *parser.QueryExecutor, ctx context.Context, expr *parser.Expression, namespace string) (parser.QueryResult, error) {
+		return parser.QueryResult{Data: map[string]interface{}{}}, nil
+	}
+
+	var buf bytes.Buffer
+	runExample(topics, "podsonnode", []string{"worker-1"}, &buf)
+	if len(queries) != 1 || queries[0] != `MATCH (p:Pod) WHERE p.spec.nodeName = "worker-1" RETURN p` {
+		t.Errorf("Unexpected queries: %q", queries)
+	}
+
+	buf.Reset()
+	runExample(topics, "podsonnode", nil, &buf)
+	if buf.String() != "Error: usage: cyphernetes examples run podsonnode <node>\n" {
+		t.Errorf("Unexpected output: %q", buf.String())
+	}
+
+	buf.Reset()
+	runExample(topics, "missing", nil, &buf)
+	if buf.String() != "Error: no example named 'missing'\n" {
+		t.Errorf("Unexpected output: %q", buf.String())
+	}
+}
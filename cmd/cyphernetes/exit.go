@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
+)
+
+// The exit codes of the query command, so that scripts can tell why a query failed
+const (
+	exitOK = 0
+	// exitError is for errors before the query runs, e.g. in flags or the kubeconfig
+	exitError          = 1
+	exitParseError     = 2
+	exitExecutionError = 3
+	// exitEmpty is for queries that returned no results, with --fail-on-empty
+	exitEmpty = 4
+)
+
+// errorFormats are the formats of the --error-format flag
+var errorFormats = []string{"text", "json"}
+
+// errorFormat is the --error-format flag, and failOnEmpty the --fail-on-empty flag
+var errorFormat = "text"
+var failOnEmpty bool
+
+// errorOutput is where errors go as JSON, with --error-format json
+var errorOutput io.Writer = os.Stderr
+
+// queryError is an error of the query command as --error-format json prints it, e.g.
+// {"error": "...", "code": "CYP-0020", "exitCode": 3, "details": {...}}
+type queryError struct {
+	Error    string                 `json:"error"`
+	Code     parser.DiagnosticCode  `json:"code,omitempty"`
+	ExitCode int                    `json:"exitCode"`
+	Line     int                    `json:"line,omitempty"`
+	Column   int                    `json:"column,omitempty"`
+	Details  map[string]interface{} `json:"details,omitempty"`
+	Hint     string                 `json:"hint,omitempty"`
+}
+
+// printError reports an error of the query command and returns its exit code. As text, it's printed to w after
+// prefix, e.g. "Error parsing query: ", and followed by the hint if there's one; as JSON, it goes to errorOutput.
+func printError(w io.Writer, exitCode int, prefix string, err error, hint string) int {
+	if errorFormat != "json" {
+		fmt.Fprintln(w, prefix, errorMessage(err))
+		if hint != "" {
+			fmt.Fprintln(w, hint)
+		}
+		return exitCode
+	}
+	report := queryError{Error: err.Error(), Code: parser.DiagnosticCodeOf(err), ExitCode: exitCode, Hint: hint}
+	var parseErr *parser.ParseError
+	if errors.As(err, &parseErr) {
+		report.Line, report.Column = parseErr.Line, parseErr.Column
+	}
+	var diagnostic *parser.DiagnosticError
+	if errors.As(err, &diagnostic) {
+		report.Details = diagnostic.Details
+	}
+	encoded, marshalErr := json.Marshal(report)
+	if marshalErr != nil {
+		// Details that can't be marshalled are left out rather than losing the error
+		report.Details = nil
+		encoded, _ = json.Marshal(report)
+	}
+	fmt.Fprintln(errorOutput, string(encoded))
+	return exitCode
+}
+
+// emptyResults tells whether a query returned nothing: no rows for any of its variables, and no aggregates
+func emptyResults(data map[string]interface{}) bool {
+	for _, value := range data {
+		switch value := value.(type) {
+		case nil:
+		case []interface{}:
+			if len(value) > 0 {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
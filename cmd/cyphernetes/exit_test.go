@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
+)
+
+func TestRunQueryErrorFormat(t *testing.T) {
+	originalNewQueryExecutor := newQueryExecutor
+	originalExecuteMethod := executeMethod
+	originalErrorOutput := errorOutput
+	defer func() {
+		newQueryExecutor = originalNewQueryExecutor
+		executeMethod = originalExecuteMethod
+		errorOutput = originalErrorOutput
+		errorFormat = "text"
+	}()
+	newQueryExecutor = func() (*parser.QueryExecutor, error) {
+		return &parser.QueryExecutor{}, nil
+	}
+	executeMethod = func(qe *parser.QueryExecutor, ctx context.Context, expr *parser.Expression, namespace string) (parser.QueryResult, error) {
+		details := map[string]interface{}{"error": "pods is forbidden", "verb": "list", "resource": "pods"}
+		return parser.QueryResult{}, &parser.DiagnosticError{Code: parser.CodeForbidden, Details: details}
+	}
+
+	errorFormat = "json"
+	stderr := new(bytes.Buffer)
+	errorOutput = stderr
+	buf := new(bytes.Buffer)
+	if code := runQuery([]string{"MATCH (p:Pod"}, buf); code != exitParseError {
+		t.Errorf("expected exit code %d for a parse error, got %d", exitParseError, code)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected nothing on stdout, got %s", buf.String())
+	}
+	var report queryError
+	if err := json.Unmarshal(stderr.Bytes(), &report); err != nil {
+		t.Fatalf("expected the error as JSON, got %s: %v", stderr.String(), err)
+	}
+	if report.ExitCode != exitParseError || report.Line != 1 || report.Column == 0 || report.Hint == "" {
+		t.Errorf("expected the position of the parse error, got %+v", report)
+	}
+
+	stderr.Reset()
+	if code := runQuery([]string{"MATCH (p:Pod) RETURN p"}, buf); code != exitExecutionError {
+		t.Errorf("expected exit code %d for an execution error, got %d", exitExecutionError, code)
+	}
+	report = queryError{}
+	if err := json.Unmarshal(stderr.Bytes(), &report); err != nil {
+		t.Fatalf("expected the error as JSON, got %s: %v", stderr.String(), err)
+	}
+	if report.Code != parser.CodeForbidden || report.Details["verb"] != "list" || !strings.HasPrefix(report.Hint, "Hint: check your permissions") {
+		t.Errorf("expected the diagnostic of the error, got %+v", report)
+	}
+
+	errorFormat = "yaml"
+	buf.Reset()
+	if code := runQuery([]string{"MATCH (p:Pod) RETURN p"}, buf); code != exitError || !strings.Contains(buf.String(), `unknown error format "yaml"`) {
+		t.Errorf("expected an unknown format to be rejected, got %d: %s", code, buf.String())
+	}
+}
+
+func TestRunQueryFailOnEmpty(t *testing.T) {
+	originalParseQuery := parseQuery
+	originalNewQueryExecutor := newQueryExecutor
+	originalExecuteMethod := executeMethod
+	defer func() {
+		parseQuery = originalParseQuery
+		newQueryExecutor = originalNewQueryExecutor
+		executeMethod = originalExecuteMethod
+		failOnEmpty = false
+	}()
+	parseQuery = func(query string) (*parser.Expression, error) {
+		return &parser.Expression{}, nil
+	}
+	newQueryExecutor = func() (*parser.QueryExecutor, error) {
+		return &parser.QueryExecutor{}, nil
+	}
+	var data map[string]interface{}
+	executeMethod = func(qe *parser.QueryExecutor, ctx context.Context, expr *parser.Expression, namespace string) (parser.QueryResult, error) {
+		return parser.QueryResult{Data: data}, nil
+	}
+
+	for _, tt := range []struct {
+		data        map[string]interface{}
+		failOnEmpty bool
+		code        int
+	}{
+		{map[string]interface{}{"p": []interface{}{}}, false, exitOK},
+		{map[string]interface{}{"p": []interface{}{}}, true, exitEmpty},
+		{map[string]interface{}{}, true, exitEmpty},
+		{map[string]interface{}{"p": []interface{}{"web-1"}}, true, exitOK},
+		{map[string]interface{}{"p": []interface{}{}, "aggregate": map[string]interface{}{"count(p)": 0}}, true, exitOK},
+	} {
+		data, failOnEmpty = tt.data, tt.failOnEmpty
+		if code := runQuery([]string{"MATCH (p:Pod) RETURN p"}, new(bytes.Buffer)); code != tt.code {
+			t.Errorf("%v with --fail-on-empty=%v: expected exit code %d, got %d", tt.data, tt.failOnEmpty, tt.code, code)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
+	"github.com/spf13/cobra"
+)
+
+var explainJson bool
+
+// planFormats are the formats the plans of EXPLAIN queries are printed in
+var planFormats = []string{"json", "tree", "dot"}
+
+// explainFormat is the format of the plans the query command prints, given with --explain-format
+var explainFormat = "json"
+
+var explainCmd = &cobra.Command{
+	Use:   "explain [code]",
+	Short: "Explain an error or warning code",
+	Long: `Use the 'explain' subcommand to see what an error or warning code (e.g. CYP-0020) means and how to fix it.
+Without arguments it lists every code. Codes don't change between releases, so scripts can rely on them.`,
+	Example: `  cyphernetes explain CYP-0020
+  cyphernetes explain --json`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		code := ""
+		if len(args) == 1 {
+			code = args[0]
+		}
+		return explainDiagnostics(code, explainJson, os.Stdout)
+	},
+}
+
+func explainDiagnostics(code string, asJson bool, w io.Writer) error {
+	diagnostics := parser.Diagnostics()
+	if code != "" {
+		diagnostic, ok := parser.LookupDiagnostic(parser.DiagnosticCode(strings.ToUpper(code)))
+		if !ok {
+			return fmt.Errorf("unknown code %s, run 'cyphernetes explain' to list the codes", code)
+		}
+		diagnostics = []parser.Diagnostic{diagnostic}
+	}
+
+	if asJson {
+		var data []byte
+		var err error
+		if code != "" {
+			data, err = json.MarshalIndent(diagnostics[0], "", "  ")
+		} else {
+			data, err = json.MarshalIndent(diagnostics, "", "  ")
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(data))
+		return nil
+	}
+
+	if code == "" {
+		for _, diagnostic := range diagnostics {
+			fmt.Fprintf(w, "%s  %-7s  %s\n", diagnostic.Code, diagnostic.Severity, diagnostic.Title)
+		}
+		fmt.Fprintln(w, "\nExplain a code with: cyphernetes explain <code>")
+		return nil
+	}
+
+	diagnostic := diagnostics[0]
+	fmt.Fprintf(w, "%s: %s (%s)\n\n", diagnostic.Code, diagnostic.Title, diagnostic.Severity)
+	fmt.Fprintf(w, "Message: %s\n\n", diagnostic.Message)
+	fmt.Fprintln(w, diagnostic.Explanation)
+	return nil
+}
+
+// formatPlan renders the plan of an EXPLAIN query as a tree or as a Graphviz DOT graph
+func formatPlan(plan *parser.QueryPlan, format string) (string, error) {
+	switch format {
+	case "tree":
+		return plan.Tree(), nil
+	case "dot":
+		return plan.DOT(), nil
+	}
+	return "", fmt.Errorf("unknown plan format %q, expected one of %s", format, strings.Join(planFormats, ", "))
+}
+
+// errorMessage prefixes the message of an error with its diagnostic code, if it has one
+func errorMessage(err error) string {
+	if code := parser.DiagnosticCodeOf(err); code != "" {
+		return fmt.Sprintf("[%s] %s", code, err)
+	}
+	return err.Error()
+}
+
+// errorHint suggests how to fix an error of a query: it points at the position of a syntax error, lists the
+// tokens expected there and suggests a fix, and says what to check for the kinds of errors people run into most.
+// It's empty when there's nothing to add.
+func errorHint(query string, err error) string {
+	var parseErr *parser.ParseError
+	var diagnostic *parser.DiagnosticError
+	switch {
+	case errors.As(err, &parseErr):
+		lines := strings.Split(query, "\n")
+		if parseErr.Line < 1 || parseErr.Line > len(lines) || parseErr.Column < 1 {
+			return ""
+		}
+		hint := fmt.Sprintf("  %s\n  %s^", lines[parseErr.Line-1], strings.Repeat(" ", parseErr.Column-1))
+		if len(parseErr.Expected) > 0 {
+			hint += "\n  expected " + joinExpected(parseErr.Expected)
+		}
+		if parseErr.Suggestion != "" {
+			hint += "\nHint: " + parseErr.Suggestion
+		}
+		return hint
+	case errors.As(err, &diagnostic) && diagnostic.Code == parser.CodeRollbackFailed:
+		undo, _ := diagnostic.Details["undo"].([]string)
+		return "Hint: check the objects, then undo the remaining changes with:\n" + strings.Join(undo, "\n")
+	case errors.Is(err, parser.ErrKindNotFound):
+		return "Hint: check the spelling of the kind, and that its CRD is installed (kubectl api-resources lists the kinds)"
+	case errors.Is(err, parser.ErrAmbiguousKind):
+		return "Hint: qualify the kind with its API group, e.g. deployments.apps, or run :resolve <kind> to list the matches"
+	case errors.Is(err, parser.ErrForbidden):
+		return "Hint: check your permissions, e.g. with kubectl auth can-i list pods"
+	}
+	return ""
+}
+
+// joinExpected lists the tokens a syntax error expected, e.g. ')', ':' or '{'
+func joinExpected(expected []string) string {
+	if len(expected) == 1 {
+		return expected[0]
+	}
+	return strings.Join(expected[:len(expected)-1], ", ") + " or " + expected[len(expected)-1]
+}
+
+func init() {
+	rootCmd.AddCommand(explainCmd)
+	explainCmd.Flags().BoolVar(&explainJson, "json", false, "Print the codes as JSON")
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
+)
+
+func TestExplainDiagnostics(t *testing.T) {
+	var buf bytes.Buffer
+	if err := explainDiagnostics("cyp-0020", false, &buf); err != nil {
+		t.Fatalf("explainDiagnostics() error = %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), "CYP-0020: Unknown kind (error)") {
+		t.Errorf("unexpected explanation %q", buf.String())
+	}
+
+	buf.Reset()
+	if err := explainDiagnostics("", true, &buf); err != nil {
+		t.Fatalf("explainDiagnostics() error = %v", err)
+	}
+	var diagnostics []parser.Diagnostic
+	if err := json.Unmarshal(buf.Bytes(), &diagnostics); err != nil {
+		t.Fatalf("expected a JSON list, got %q: %v", buf.String(), err)
+	}
+	if len(diagnostics) != len(parser.Diagnostics()) {
+		t.Errorf("expected %d codes, got %d", len(parser.Diagnostics()), len(diagnostics))
+	}
+
+	if err := explainDiagnostics("CYP-9999", false, &buf); err == nil {
+		t.Errorf("expected an error for an unknown code")
+	}
+}
+
+func TestErrorMessage(t *testing.T) {
+	_, err := parser.ParseQuery("MATCH (p:Pod RETURN p")
+	wrapped := fmt.Errorf("error parsing query >> %w", err)
+	if message := errorMessage(wrapped); !strings.HasPrefix(message, "[CYP-0001] error parsing query >> parsing failed") {
+		t.Errorf("unexpected message %q", message)
+	}
+	if message := errorMessage(errors.New("plain")); message != "plain" {
+		t.Errorf("expected errors without a code to be unchanged, got %q", message)
+	}
+
+	response := errorResponse(wrapped)
+	if response["code"] != parser.CodeParseFailed || response["details"] == nil {
+		t.Errorf("unexpected error response %v", response)
+	}
+	if _, ok := errorResponse(errors.New("plain"))["code"]; ok {
+		t.Errorf("expected no code for a plain error")
+	}
+}
+
+func TestErrorHint(t *testing.T) {
+	query := "MATCH (p:Pod {name: 'web'}) RETURN p"
+	_, err := parser.ParseQuery(query)
+	if hint := errorHint(query, err); hint != "  "+query+"\n  "+strings.Repeat(" ", 20)+"^\n  expected a string or a number\nHint: strings are in double quotes, e.g. \"web\"" {
+		t.Errorf("unexpected hint %q", hint)
+	}
+
+	if hint := errorHint("", fmt.Errorf("error finding API resource >> %w", parser.ErrKindNotFound)); !strings.Contains(hint, "api-resources") {
+		t.Errorf("unexpected hint for an unknown kind %q", hint)
+	}
+	if hint := errorHint("", errors.New("plain")); hint != "" {
+		t.Errorf("expected no hint, got %q", hint)
+	}
+}
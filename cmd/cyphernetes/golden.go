@@ -0,0 +1,550 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+// A test suite is a directory of queries and the results they're expected to give on a cluster holding the suite's
+// fixtures. Each .cql file holds a query, which may span several lines, and the .golden.json file next to it its
+// results, or the diagnostic code of its error. The manifests under fixtures/ are created before the queries run,
+// in the namespace of the suite, and deleted after them. An optional suite.yaml names the namespace, the relationship
+// packs the queries run with, and how results are normalized before they're compared: fields such as uids differ
+// from one cluster to the next. `cyphernetes test` runs suites on a cluster it brings up with envtest or kind, so
+// that contributors can check the language against a real API server and users the relationship packs they write.
+
+// testSuite is the suite.yaml of a suite directory
+type testSuite struct {
+	// Namespace is where the fixtures are created and the queries run
+	Namespace string `yaml:"namespace"`
+	// Relationships are the relationship packs the queries run with, relative to the suite directory
+	Relationships []string       `yaml:"relationships"`
+	Normalize     normalizeRules `yaml:"normalize"`
+
+	dir          string
+	rules        []parser.RelationshipRule
+	replacements []*regexp.Regexp
+}
+
+// normalizeRules remove from results what differs between clusters and runs
+type normalizeRules struct {
+	// Ignore are paths removed from every row of the results, e.g. metadata.uid
+	Ignore []string `yaml:"ignore"`
+	// Replace replaces the matches of regular expressions in the string values of the results, e.g. IP addresses
+	Replace []replaceRule `yaml:"replace"`
+}
+
+type replaceRule struct {
+	Pattern string `yaml:"pattern"`
+	With    string `yaml:"with"`
+}
+
+// defaultTestNamespace is the namespace of the suites that don't name one
+const defaultTestNamespace = "cyphernetes-test"
+
+// kindClusterName is the name of the kind cluster suites run on
+const kindClusterName = "cyphernetes-test"
+
+var (
+	testClusterType string
+	testUpdate      bool
+)
+
+var executeSuiteQuery = querySuite
+
+var testCmd = &cobra.Command{
+	Use:   "test <suite directory>...",
+	Short: "Run query test suites and compare their results to golden files",
+	Long: `Use the 'test' subcommand to run test suites: directories of fixture manifests, under fixtures/, and of .cql
+queries whose expected results are in the .golden.json file next to each query. The suites run on a cluster brought
+up with envtest, which needs the binaries installed by setup-envtest in KUBEBUILDER_ASSETS, or kind, or on the
+current cluster. --update writes the golden files from the results instead of comparing them.`,
+	Example: `  cyphernetes test test/e2e
+  cyphernetes test --cluster kind --update ./my-relationships-tests`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var suites []*testSuite
+		for _, dir := range args {
+			suite, err := loadTestSuite(dir)
+			if err != nil {
+				return fmt.Errorf("error loading test suite >> %w", err)
+			}
+			suites = append(suites, suite)
+		}
+		parser.CleanOutput = true
+		failures, err := runTestSuites(suites, testClusterType, os.Stdout)
+		if err != nil {
+			return err
+		}
+		if failures > 0 {
+			return fmt.Errorf("%d queries failed", failures)
+		}
+		return nil
+	},
+}
+
+func loadTestSuite(dir string) (*testSuite, error) {
+	suite := &testSuite{}
+	data, err := os.ReadFile(filepath.Join(dir, "suite.yaml"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err := yaml.UnmarshalStrict(data, suite); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", filepath.Join(dir, "suite.yaml"), err)
+	}
+	suite.dir = dir
+	if suite.Namespace == "" {
+		suite.Namespace = defaultTestNamespace
+	}
+	for _, pack := range suite.Relationships {
+		rules, err := loadRelationshipPack(filepath.Join(dir, pack))
+		if err != nil {
+			return nil, fmt.Errorf("error loading relationship pack %s: %w", pack, err)
+		}
+		suite.rules = append(suite.rules, rules...)
+	}
+	for _, rule := range suite.Normalize.Replace {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid replace pattern %q: %w", rule.Pattern, err)
+		}
+		suite.replacements = append(suite.replacements, re)
+	}
+	return suite, nil
+}
+
+// queries returns the query files of the suite, sorted by name
+func (s *testSuite) queries() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.cql"))
+	sort.Strings(files)
+	return files, err
+}
+
+// testCluster is a cluster suites run on
+type testCluster struct {
+	// kubeconfig is the kubeconfig file of the cluster, empty for the current cluster
+	kubeconfig string
+	// stop tears the cluster down, if it was brought up for the suites
+	stop func() error
+}
+
+func startTestCluster(clusterType string) (*testCluster, error) {
+	switch clusterType {
+	case "current":
+		return &testCluster{stop: func() error { return nil }}, nil
+	case "envtest":
+		return startEnvtestCluster()
+	case "kind":
+		return startKindCluster()
+	}
+	return nil, fmt.Errorf("unknown cluster %q, expected envtest, kind or current", clusterType)
+}
+
+// startEnvtestCluster runs an API server and etcd, without controllers, as an administrator
+func startEnvtestCluster() (*testCluster, error) {
+	env := &envtest.Environment{}
+	if _, err := env.Start(); err != nil {
+		return nil, fmt.Errorf("error starting envtest, is KUBEBUILDER_ASSETS set? >> %w", err)
+	}
+	user, err := env.AddUser(envtest.User{Name: "cyphernetes", Groups: []string{"system:masters"}}, nil)
+	if err != nil {
+		env.Stop()
+		return nil, fmt.Errorf("error adding envtest user >> %w", err)
+	}
+	kubeconfig, err := user.KubeConfig()
+	if err != nil {
+		env.Stop()
+		return nil, err
+	}
+	dir, err := os.MkdirTemp("", "cyphernetes-test")
+	if err != nil {
+		env.Stop()
+		return nil, err
+	}
+	file := filepath.Join(dir, "kubeconfig")
+	if err := os.WriteFile(file, kubeconfig, 0600); err != nil {
+		env.Stop()
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return &testCluster{kubeconfig: file, stop: func() error {
+		defer os.RemoveAll(dir)
+		return env.Stop()
+	}}, nil
+}
+
+// startKindCluster creates a kind cluster, which is deleted when the suites are done
+func startKindCluster() (*testCluster, error) {
+	dir, err := os.MkdirTemp("", "cyphernetes-test")
+	if err != nil {
+		return nil, err
+	}
+	file := filepath.Join(dir, "kubeconfig")
+	create := exec.Command("kind", "create", "cluster", "--name", kindClusterName, "--kubeconfig", file, "--wait", "2m")
+	create.Stdout, create.Stderr = os.Stderr, os.Stderr
+	if err := create.Run(); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("error creating kind cluster >> %w", err)
+	}
+	return &testCluster{kubeconfig: file, stop: func() error {
+		defer os.RemoveAll(dir)
+		return exec.Command("kind", "delete", "cluster", "--name", kindClusterName).Run()
+	}}, nil
+}
+
+// runTestSuites runs the suites on a cluster of the type, returning the number of queries that failed
+func runTestSuites(suites []*testSuite, clusterType string, w io.Writer) (int, error) {
+	cluster, err := startTestCluster(clusterType)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := cluster.stop(); err != nil {
+			parser.Logger().Warn("Error stopping the test cluster", "error", err)
+		}
+	}()
+	if cluster.kubeconfig != "" {
+		parser.Kubeconfig, parser.KubeContext = cluster.kubeconfig, ""
+	}
+	config, err := parser.KubeClientConfig("").ClientConfig()
+	if err != nil {
+		return 0, err
+	}
+
+	failures := 0
+	for _, suite := range suites {
+		fmt.Fprintf(w, "Suite %s\n", suite.dir)
+		created, err := createFixtures(context.Background(), config, suite)
+		if err != nil {
+			deleteFixtures(context.Background(), config, created)
+			return failures, err
+		}
+		// The executor discovers the kinds of the fixtures, e.g. those of their CustomResourceDefinitions
+		parser.RestoreClusterState(parser.ClusterState{})
+		executor, err := parser.NewQueryExecutor()
+		if err != nil {
+			return failures, err
+		}
+		parser.SetQueryExecutorInstance(executor)
+		initResourceSpecsOrWarn()
+		if err := parser.SetCustomRelationships(suite.rules); err != nil {
+			deleteFixtures(context.Background(), config, created)
+			return failures, fmt.Errorf("invalid custom relationships: %w", err)
+		}
+		n, err := runTestSuite(suite, testUpdate, w)
+		failures += n
+		deleteFixtures(context.Background(), config, created)
+		if err != nil {
+			return failures, err
+		}
+	}
+	return failures, nil
+}
+
+// runTestSuite runs the queries of a suite whose fixtures were created, comparing their results to their golden
+// files or, with update, writing them. It returns the number of queries whose results differ.
+func runTestSuite(suite *testSuite, update bool, w io.Writer) (int, error) {
+	files, err := suite.queries()
+	if err != nil {
+		return 0, err
+	}
+	failures := 0
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return failures, err
+		}
+		// The lines of a query are read as one
+		query := strings.TrimSpace(strings.NewReplacer("\r\n", " ", "\n", " ").Replace(string(data)))
+		name := strings.TrimSuffix(filepath.Base(file), ".cql")
+
+		results, err := executeSuiteQuery(query, suite.Namespace)
+		if err != nil {
+			code := string(parser.DiagnosticCodeOf(err))
+			if code == "" {
+				code = err.Error()
+			}
+			results = map[string]interface{}{"error": code}
+		}
+		results = suite.normalize(results)
+
+		golden := strings.TrimSuffix(file, ".cql") + ".golden.json"
+		if update {
+			encoded, err := json.MarshalIndent(results, "", "  ")
+			if err != nil {
+				return failures, err
+			}
+			if err := os.WriteFile(golden, append(encoded, '\n'), 0644); err != nil {
+				return failures, err
+			}
+			fmt.Fprintf(w, "  UPDATED %s\n", name)
+			continue
+		}
+
+		expected := map[string]interface{}{}
+		if data, err := os.ReadFile(golden); err != nil {
+			fmt.Fprintf(w, "  FAIL %s: %v, run with --update to write it\n", name, err)
+			failures++
+			continue
+		} else if err := json.Unmarshal(data, &expected); err != nil {
+			return failures, fmt.Errorf("error parsing %s: %w", golden, err)
+		}
+		if reflect.DeepEqual(expected, results) {
+			fmt.Fprintf(w, "  PASS %s\n", name)
+			continue
+		}
+		failures++
+		fmt.Fprintf(w, "  FAIL %s\n", name)
+		renderDiff(w, compareResults(expected, results, "name"), filepath.Base(golden), "results")
+	}
+	return failures, nil
+}
+
+// querySuite runs a query of a suite, whose results are returned as the plain values they're encoded to
+func querySuite(query, namespace string) (map[string]interface{}, error) {
+	ast, err := parser.ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	results, err := parser.GetQueryExecutorInstance().Execute(ast, namespace)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(results.Data)
+	if err != nil {
+		return nil, err
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, err
+	}
+	return decoded, nil
+}
+
+// normalize removes the ignored paths from the rows of the results, replaces the patterns of the suite in their
+// strings, and sorts the rows of each variable, whose order the API server doesn't guarantee
+func (s *testSuite) normalize(results map[string]interface{}) map[string]interface{} {
+	for variable, value := range results {
+		if rows, ok := value.([]interface{}); ok {
+			for _, row := range rows {
+				if row, ok := row.(map[string]interface{}); ok {
+					for _, path := range s.Normalize.Ignore {
+						removePath(row, strings.Split(path, "."))
+					}
+				}
+			}
+		}
+		value = s.replaceStrings(value)
+		if rows, ok := value.([]interface{}); ok {
+			sort.SliceStable(rows, func(i, j int) bool {
+				a, _ := json.Marshal(rows[i])
+				b, _ := json.Marshal(rows[j])
+				return string(a) < string(b)
+			})
+		}
+		results[variable] = value
+	}
+	return results
+}
+
+func removePath(row map[string]interface{}, path []string) {
+	if len(path) == 1 {
+		delete(row, path[0])
+		return
+	}
+	if child, ok := row[path[0]].(map[string]interface{}); ok {
+		removePath(child, path[1:])
+	}
+}
+
+func (s *testSuite) replaceStrings(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		for i, re := range s.replacements {
+			v = re.ReplaceAllString(v, s.Normalize.Replace[i].With)
+		}
+		return v
+	case []interface{}:
+		for i, child := range v {
+			v[i] = s.replaceStrings(child)
+		}
+	case map[string]interface{}:
+		for key, child := range v {
+			v[key] = s.replaceStrings(child)
+		}
+	}
+	return value
+}
+
+// fixture is an object created for a suite
+type fixture struct {
+	gvr       schema.GroupVersionResource
+	namespace string
+	name      string
+}
+
+// loadFixtures reads the manifests under the fixtures directory of a suite, in the order of their files
+func loadFixtures(dir string) ([]*unstructured.Unstructured, error) {
+	var files []string
+	for _, pattern := range []string{"*.yaml", "*.yml", "*.json"} {
+		matches, err := filepath.Glob(filepath.Join(dir, "fixtures", pattern))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+
+	var objects []*unstructured.Unstructured
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		decoder := k8syaml.NewYAMLOrJSONDecoder(f, 4096)
+		for {
+			object := map[string]interface{}{}
+			if err := decoder.Decode(&object); errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				f.Close()
+				return nil, fmt.Errorf("error parsing %s: %w", file, err)
+			}
+			// Documents holding only comments are empty
+			if len(object) > 0 {
+				objects = append(objects, &unstructured.Unstructured{Object: object})
+			}
+		}
+		f.Close()
+	}
+	return objects, nil
+}
+
+// createFixtures creates the namespace of a suite and its fixtures, returning what it created, which is deleted
+// in the reverse order
+func createFixtures(ctx context.Context, config *rest.Config, suite *testSuite) ([]fixture, error) {
+	objects, err := loadFixtures(suite.dir)
+	if err != nil {
+		return nil, err
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("error creating discovery client: %w", err)
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("error creating dynamic client: %w", err)
+	}
+
+	var created []fixture
+	namespace := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Namespace",
+		"metadata":   map[string]interface{}{"name": suite.Namespace},
+	}}
+	namespaces := schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+	if _, err := dynamicClient.Resource(namespaces).Create(ctx, namespace, metav1.CreateOptions{}); err == nil {
+		// Without a namespace controller, as on envtest, a deleted namespace is never removed and the suites after
+		// couldn't create their fixtures in it
+		if testClusterType != "envtest" {
+			created = append(created, fixture{gvr: namespaces, name: suite.Namespace})
+		}
+	} else if !apierrors.IsAlreadyExists(err) {
+		return nil, fmt.Errorf("error creating namespace %s: %w", suite.Namespace, err)
+	}
+
+	for _, object := range objects {
+		gvk := object.GroupVersionKind()
+		resource, err := fixtureResource(discoveryClient, gvk)
+		if err != nil {
+			return created, err
+		}
+		gvr := gvk.GroupVersion().WithResource(resource.Name)
+		var client dynamic.ResourceInterface = dynamicClient.Resource(gvr)
+		if resource.Namespaced {
+			if object.GetNamespace() == "" {
+				object.SetNamespace(suite.Namespace)
+			}
+			client = dynamicClient.Resource(gvr).Namespace(object.GetNamespace())
+		}
+		if _, err := client.Create(ctx, object, metav1.CreateOptions{}); err != nil {
+			return created, fmt.Errorf("error creating fixture %s %s: %w", gvk.Kind, object.GetName(), err)
+		}
+		created = append(created, fixture{gvr: gvr, namespace: object.GetNamespace(), name: object.GetName()})
+	}
+	return created, nil
+}
+
+// fixtureResource finds the resource of a kind. The kinds of CustomResourceDefinitions created by the fixtures
+// before are served after a moment.
+func fixtureResource(discoveryClient discovery.DiscoveryInterface, gvk schema.GroupVersionKind) (*metav1.APIResource, error) {
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		resources, err := discoveryClient.ServerResourcesForGroupVersion(gvk.GroupVersion().String())
+		if err == nil {
+			for _, resource := range resources.APIResources {
+				if resource.Kind == gvk.Kind && !strings.Contains(resource.Name, "/") {
+					return &resource, nil
+				}
+			}
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("resource not found for %s", gvk)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// deleteFixtures deletes what createFixtures created, without waiting for pods to terminate
+func deleteFixtures(ctx context.Context, config *rest.Config, created []fixture) {
+	if len(created) == 0 {
+		return
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		parser.Logger().Warn("Error deleting fixtures", "error", err)
+		return
+	}
+	immediately := int64(0)
+	for i := len(created) - 1; i >= 0; i-- {
+		f := created[i]
+		var client dynamic.ResourceInterface = dynamicClient.Resource(f.gvr)
+		if f.namespace != "" {
+			client = dynamicClient.Resource(f.gvr).Namespace(f.namespace)
+		}
+		err := client.Delete(ctx, f.name, metav1.DeleteOptions{GracePeriodSeconds: &immediately})
+		if err != nil && !apierrors.IsNotFound(err) {
+			parser.Logger().Warn("Error deleting fixture", "resource", f.gvr.Resource, "name", f.name, "error", err)
+		}
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(testCmd)
+	testCmd.Flags().StringVar(&testClusterType, "cluster", "envtest", "The cluster suites run on (envtest, kind, current)")
+	testCmd.Flags().BoolVar(&testUpdate, "update", false, "Write the golden files from the results instead of comparing them")
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func stubSuiteQuery(t *testing.T, results map[string]map[string]interface{}) *[]string {
+	originalExecuteSuiteQuery := executeSuiteQuery
+	t.Cleanup(func() { executeSuiteQuery = originalExecuteSuiteQuery })
+
+	var queries []string
+	executeSuiteQuery = func(query, namespace string) (map[string]interface{}, error) {
+		queries = append(queries, namespace+": "+query)
+		result, ok := results[query]
+		if !ok {
+			return nil, fmt.Errorf("unexpected query %s", query)
+		}
+		return result, nil
+	}
+	return &queries
+}
+
+func writeSuite(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadTestSuite(t *testing.T) {
+	suite, err := loadTestSuite("../../test/e2e")
+	if err != nil {
+		t.Fatalf("loadTestSuite() error = %v", err)
+	}
+	if suite.Namespace != "cyphernetes-e2e" || len(suite.Normalize.Ignore) == 0 {
+		t.Errorf("suite = %+v", suite)
+	}
+	queries, err := suite.queries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, query := range queries {
+		golden := strings.TrimSuffix(query, ".cql") + ".golden.json"
+		if _, err := os.Stat(golden); err != nil {
+			t.Errorf("%s has no golden file: %v", query, err)
+		}
+	}
+	objects, err := loadFixtures(suite.dir)
+	if err != nil {
+		t.Fatalf("loadFixtures() error = %v", err)
+	}
+	if len(objects) != 9 {
+		t.Errorf("Expected 9 fixtures, got %d", len(objects))
+	}
+}
+
+func TestLoadTestSuiteDefaults(t *testing.T) {
+	suite, err := loadTestSuite(writeSuite(t, nil))
+	if err != nil {
+		t.Fatalf("loadTestSuite() error = %v", err)
+	}
+	if suite.Namespace != defaultTestNamespace {
+		t.Errorf("Expected namespace %s, got %s", defaultTestNamespace, suite.Namespace)
+	}
+
+	if _, err := loadTestSuite(writeSuite(t, map[string]string{"suite.yaml": "namespaces: x\n"})); err == nil {
+		t.Error("Expected an error for an unknown field")
+	}
+	if _, err := loadTestSuite(writeSuite(t, map[string]string{"suite.yaml": "normalize:\n  replace:\n    - pattern: \"(\"\n"})); err == nil {
+		t.Error("Expected an error for an invalid pattern")
+	}
+}
+
+func TestNormalizeResults(t *testing.T) {
+	suite, err := loadTestSuite(writeSuite(t, map[string]string{"suite.yaml": `
+normalize:
+  ignore: [metadata.uid, status]
+  replace:
+    - pattern: '\d+\.\d+\.\d+\.\d+'
+      with: <ip>
+`}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := suite.normalize(map[string]interface{}{
+		"p": []interface{}{
+			map[string]interface{}{"name": "web-2", "metadata": map[string]interface{}{"uid": "b"}, "status": map[string]interface{}{"podIP": "10.0.0.2"}},
+			map[string]interface{}{"name": "web-1", "metadata": map[string]interface{}{"uid": "a"}, "ips": []interface{}{"10.0.0.1"}},
+		},
+		"aggregate": map[string]interface{}{"count": float64(2)},
+	})
+	expected := map[string]interface{}{
+		"p": []interface{}{
+			map[string]interface{}{"name": "web-1", "metadata": map[string]interface{}{}, "ips": []interface{}{"<ip>"}},
+			map[string]interface{}{"name": "web-2", "metadata": map[string]interface{}{}},
+		},
+		"aggregate": map[string]interface{}{"count": float64(2)},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("Expected %v, got %v", expected, results)
+	}
+}
+
+func TestRunTestSuite(t *testing.T) {
+	dir := writeSuite(t, map[string]string{
+		"suite.yaml":       "namespace: e2e\n",
+		"pods.cql":         "MATCH (p:Pod)\nRETURN p.metadata.name\n",
+		"pods.golden.json": `{"p": [{"name": "web-1"}, {"name": "web-2"}]}`,
+	})
+	suite, err := loadTestSuite(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := map[string]map[string]interface{}{
+		"MATCH (p:Pod) RETURN p.metadata.name": {"p": []interface{}{
+			map[string]interface{}{"name": "web-2"},
+			map[string]interface{}{"name": "web-1"},
+		}},
+	}
+	queries := stubSuiteQuery(t, results)
+
+	var buf bytes.Buffer
+	failures, err := runTestSuite(suite, false, &buf)
+	if err != nil || failures != 0 {
+		t.Fatalf("runTestSuite() = %d, %v:\n%s", failures, err, buf.String())
+	}
+	if !reflect.DeepEqual(*queries, []string{"e2e: MATCH (p:Pod) RETURN p.metadata.name"}) {
+		t.Errorf("Unexpected queries %v", *queries)
+	}
+	if buf.String() != "  PASS pods\n" {
+		t.Errorf("Unexpected output:\n%s", buf.String())
+	}
+
+	results["MATCH (p:Pod) RETURN p.metadata.name"] = map[string]interface{}{"p": []interface{}{
+		map[string]interface{}{"name": "web-1"},
+		map[string]interface{}{"name": "web-3"},
+	}}
+	buf.Reset()
+	failures, err = runTestSuite(suite, false, &buf)
+	if err != nil || failures != 1 {
+		t.Fatalf("runTestSuite() = %d, %v", failures, err)
+	}
+	expected := `  FAIL pods
+--- pods.golden.json
++++ results
+@@ p @@
+- web-2
++ web-3
+`
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+
+	buf.Reset()
+	if failures, err := runTestSuite(suite, true, &buf); err != nil || failures != 0 {
+		t.Fatalf("runTestSuite() = %d, %v", failures, err)
+	}
+	golden, err := os.ReadFile(filepath.Join(dir, "pods.golden.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = `{
+  "p": [
+    {
+      "name": "web-1"
+    },
+    {
+      "name": "web-3"
+    }
+  ]
+}
+`
+	if string(golden) != expected {
+		t.Errorf("Expected golden file:\n%s\nGot:\n%s", expected, golden)
+	}
+}
+
+func TestRunTestSuiteErrors(t *testing.T) {
+	dir := writeSuite(t, map[string]string{
+		"unknown.cql":         "MATCH (x:NoSuchKind) RETURN x",
+		"unknown.golden.json": `{"error": "no such kind"}`,
+		"missing.cql":         "MATCH (p:Pod) RETURN p",
+	})
+	suite, err := loadTestSuite(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stubSuiteQuery(t, map[string]map[string]interface{}{"MATCH (p:Pod) RETURN p": {}})
+	originalExecuteSuiteQuery := executeSuiteQuery
+	executeSuiteQuery = func(query, namespace string) (map[string]interface{}, error) {
+		if strings.Contains(query, "NoSuchKind") {
+			return nil, fmt.Errorf("no such kind")
+		}
+		return originalExecuteSuiteQuery(query, namespace)
+	}
+
+	var buf bytes.Buffer
+	failures, err := runTestSuite(suite, false, &buf)
+	if err != nil || failures != 1 {
+		t.Fatalf("runTestSuite() = %d, %v", failures, err)
+	}
+	output := buf.String()
+	if !strings.Contains(output, "FAIL missing") || !strings.Contains(output, "--update") || !strings.Contains(output, "PASS unknown") {
+		t.Errorf("Unexpected output:\n%s", output)
+	}
+}
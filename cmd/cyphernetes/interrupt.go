@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// interruptibleQuery lets Ctrl-C cancel the query the shell is running, instead of exiting the shell
+type interruptibleQuery struct {
+	mu     sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+var shellQuery interruptibleQuery
+
+// start begins a query, which runs with context() until stop is called
+func (i *interruptibleQuery) start() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.ctx, i.cancel = context.WithCancel(context.Background())
+}
+
+func (i *interruptibleQuery) stop() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.cancel != nil {
+		i.cancel()
+	}
+	i.ctx, i.cancel = nil, nil
+}
+
+func (i *interruptibleQuery) context() context.Context {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.ctx == nil {
+		return context.Background()
+	}
+	return i.ctx
+}
+
+// interrupt cancels the running query, reporting whether there was one
+func (i *interruptibleQuery) interrupt() bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.cancel == nil {
+		return false
+	}
+	i.cancel()
+	return true
+}
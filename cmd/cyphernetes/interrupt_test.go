@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestInterruptibleQuery(t *testing.T) {
+	var query interruptibleQuery
+	if query.interrupt() {
+		t.Errorf("expected nothing to interrupt before a query starts")
+	}
+
+	query.start()
+	ctx := query.context()
+	if !query.interrupt() {
+		t.Errorf("expected the running query to be interrupted")
+	}
+	if ctx.Err() != context.Canceled {
+		t.Errorf("expected the query's context to be cancelled, got %v", ctx.Err())
+	}
+
+	query.stop()
+	if query.context().Err() != nil || query.interrupt() {
+		t.Errorf("expected no running query after stop")
+	}
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// An inventory is an export of the resources of a cluster: a newline-delimited JSON file holding one resource per
+// line, as the API server returned it, and a manifest counting the resources of each kind. Crawling a large cluster
+// takes a while, so the crawl lists a page of resources at a time, at a bounded rate, and records its progress in
+// the manifest after each page. An interrupted crawl is resumed from the manifest: the export is cut back to the
+// last page the manifest counts and the crawl goes on from the next one.
+
+// inventoryManifestVersion is the version of the manifests written, resuming from another version fails
+const inventoryManifestVersion = 1
+
+type inventoryManifest struct {
+	Version int `json:"version"`
+	// Namespace is the namespace crawled, all of them when empty
+	Namespace   string     `json:"namespace,omitempty"`
+	StartedAt   time.Time  `json:"startedAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	// Total is the number of resources exported, and Bytes the size of the export holding them
+	Total int             `json:"total"`
+	Bytes int64           `json:"bytes"`
+	Kinds []inventoryKind `json:"kinds"`
+}
+
+// inventoryKind is the progress of the crawl of a kind
+type inventoryKind struct {
+	Kind       string `json:"kind"`
+	Group      string `json:"group,omitempty"`
+	Version    string `json:"version"`
+	Resource   string `json:"resource"`
+	Namespaced bool   `json:"namespaced"`
+	Count      int    `json:"count"`
+	Complete   bool   `json:"complete"`
+	// Error is why the kind couldn't be listed, e.g. it's forbidden, it's then skipped
+	Error string `json:"error,omitempty"`
+	// Continue is the token of the next page of a kind whose crawl is underway
+	Continue string `json:"continue,omitempty"`
+	// Start is the size of the export when the crawl of the kind started
+	Start int64 `json:"start"`
+}
+
+func (k inventoryKind) gvr() schema.GroupVersionResource {
+	return schema.GroupVersionResource{Group: k.Group, Version: k.Version, Resource: k.Resource}
+}
+
+var (
+	inventoryOut          string
+	inventoryKinds        []string
+	inventoryExcludeKinds []string
+	inventoryQPS          float64
+	inventoryPageSize     int64
+	inventoryResume       bool
+)
+
+var inventoryCmd = &cobra.Command{
+	Use:   "inventory",
+	Short: "Export the resources of the cluster to a newline-delimited JSON file",
+	Long: `Use the 'inventory' subcommand to crawl every kind of the cluster, or those given with --kinds, and write
+their resources to a newline-delimited JSON file, one resource per line, along with a manifest counting the resources
+of each kind. The whole cluster is crawled unless --namespace is given. Kinds that can't be listed, e.g. because
+you may not list them, are skipped and noted in the manifest. An interrupted crawl is resumed with --resume.`,
+	Example: `  cyphernetes inventory --out inventory.jsonl
+  cyphernetes inventory --out inventory.jsonl --kinds deployments,pods,services --qps 2
+  cyphernetes inventory --out inventory.jsonl --exclude-kinds secrets,events --resume`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if inventoryOut == "" {
+			return errors.New("--out is required")
+		}
+		executor := parser.GetQueryExecutorInstance()
+		if executor == nil {
+			return errNoQueryExecutor
+		}
+		namespace := ""
+		if cmd.Flags().Changed("namespace") && !parser.AllNamespaces {
+			namespace = parser.Namespace
+		}
+		// Ctrl-C stops the crawl after recording its progress, so that it can be resumed
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := runInventory(ctx, executor, namespace, os.Stderr); err != nil {
+			return fmt.Errorf("error crawling the inventory >> %w", err)
+		}
+		return nil
+	},
+}
+
+// inventoryManifestPath is the manifest of an export, e.g. inventory.manifest.json for inventory.jsonl
+func inventoryManifestPath(out string) string {
+	return strings.TrimSuffix(out, filepath.Ext(out)) + ".manifest.json"
+}
+
+func runInventory(ctx context.Context, executor *parser.QueryExecutor, namespace string, progress io.Writer) error {
+	manifestPath := inventoryManifestPath(inventoryOut)
+	var manifest *inventoryManifest
+	if inventoryResume {
+		manifest = &inventoryManifest{}
+		if _, err := os.Stat(manifestPath); err != nil {
+			return fmt.Errorf("no crawl to resume: %w", err)
+		}
+		if err := readJSONFile(manifestPath, manifest); err != nil {
+			return err
+		}
+		if manifest.Version != inventoryManifestVersion {
+			return fmt.Errorf("%s was written by another version of cyphernetes, it can't be resumed", manifestPath)
+		}
+		if manifest.Namespace != namespace {
+			return fmt.Errorf("%s is the inventory of another namespace, it can't be resumed", manifestPath)
+		}
+	} else {
+		kinds, err := parser.ListableKinds(executor.Clientset, namespace)
+		if err != nil {
+			return err
+		}
+		kinds, err = selectInventoryKinds(kinds, inventoryKinds, inventoryExcludeKinds, func(identifier string) ([]parser.KindResolution, error) {
+			return parser.ResolveKind(executor.Clientset, identifier)
+		})
+		if err != nil {
+			return err
+		}
+		manifest = newInventoryManifest(kinds, namespace, time.Now())
+	}
+
+	crawl := &inventoryCrawl{
+		client:       executor.DynamicClient,
+		limiter:      newInventoryLimiter(inventoryQPS),
+		pageSize:     inventoryPageSize,
+		manifest:     manifest,
+		manifestPath: manifestPath,
+		progress:     progress,
+	}
+	if err := crawl.open(inventoryOut, inventoryResume); err != nil {
+		return err
+	}
+	defer crawl.out.Close()
+	if err := crawl.run(ctx); err != nil {
+		return fmt.Errorf("%w, rerun the command with --resume to go on from where it stopped", err)
+	}
+	fmt.Fprintf(progress, "Exported %d resources of %d kinds to %s, counted in %s\n", manifest.Total, len(manifest.Kinds), inventoryOut, manifestPath)
+	return nil
+}
+
+func newInventoryManifest(kinds []parser.SchemaKind, namespace string, now time.Time) *inventoryManifest {
+	manifest := &inventoryManifest{Version: inventoryManifestVersion, Namespace: namespace, StartedAt: now.UTC(), Kinds: []inventoryKind{}}
+	for _, kind := range kinds {
+		manifest.Kinds = append(manifest.Kinds, inventoryKind{
+			Kind:       kind.Kind,
+			Group:      kind.Group,
+			Version:    kind.Version,
+			Resource:   kind.Resource,
+			Namespaced: kind.Namespaced,
+		})
+	}
+	return manifest
+}
+
+// selectInventoryKinds keeps the kinds matching the identifiers of --kinds, all of them if it's empty, and drops
+// those matching --exclude-kinds
+func selectInventoryKinds(kinds []parser.SchemaKind, include, exclude []string, resolve func(string) ([]parser.KindResolution, error)) ([]parser.SchemaKind, error) {
+	resolveAll := func(identifiers []string) (map[schema.GroupVersionResource]bool, error) {
+		gvrs := make(map[schema.GroupVersionResource]bool)
+		for _, identifier := range identifiers {
+			resolutions, err := resolve(identifier)
+			if err != nil {
+				return nil, err
+			}
+			for _, resolution := range resolutions {
+				gvrs[resolution.GVR] = true
+			}
+		}
+		return gvrs, nil
+	}
+	included, err := resolveAll(include)
+	if err != nil {
+		return nil, err
+	}
+	excluded, err := resolveAll(exclude)
+	if err != nil {
+		return nil, err
+	}
+	var selected []parser.SchemaKind
+	for _, kind := range kinds {
+		gvr := schema.GroupVersionResource{Group: kind.Group, Version: kind.Version, Resource: kind.Resource}
+		if (len(include) == 0 || included[gvr]) && !excluded[gvr] {
+			selected = append(selected, kind)
+		}
+	}
+	return selected, nil
+}
+
+// newInventoryLimiter bounds the list calls of a crawl to qps per second, or doesn't when qps isn't positive
+func newInventoryLimiter(qps float64) flowcontrol.RateLimiter {
+	if qps <= 0 {
+		return flowcontrol.NewFakeAlwaysRateLimiter()
+	}
+	return flowcontrol.NewTokenBucketRateLimiter(float32(qps), 1)
+}
+
+// inventoryCrawl writes the resources of the kinds of its manifest to the export a page at a time
+type inventoryCrawl struct {
+	client       dynamic.Interface
+	limiter      flowcontrol.RateLimiter
+	pageSize     int64
+	manifest     *inventoryManifest
+	manifestPath string
+	progress     io.Writer
+
+	out *os.File
+}
+
+// open creates the export, or opens it to resume the crawl, cut back to the resources the manifest counts
+func (c *inventoryCrawl) open(path string, resume bool) error {
+	if !resume {
+		out, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		c.out = out
+		return c.save()
+	}
+	out, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	info, err := out.Stat()
+	if err != nil {
+		out.Close()
+		return err
+	}
+	if info.Size() < c.manifest.Bytes {
+		out.Close()
+		return fmt.Errorf("%s is shorter than its manifest counts, it can't be resumed", path)
+	}
+	c.out = out
+	return c.truncate(c.manifest.Bytes)
+}
+
+// truncate cuts the export back to size bytes, the following resources are written after them
+func (c *inventoryCrawl) truncate(size int64) error {
+	if err := c.out.Truncate(size); err != nil {
+		return err
+	}
+	_, err := c.out.Seek(size, io.SeekStart)
+	return err
+}
+
+func (c *inventoryCrawl) run(ctx context.Context) error {
+	for i := range c.manifest.Kinds {
+		kind := &c.manifest.Kinds[i]
+		if kind.Complete {
+			continue
+		}
+		if err := c.crawlKind(ctx, kind); err != nil {
+			return err
+		}
+		if kind.Error != "" {
+			fmt.Fprintf(c.progress, "%s: skipped, %s\n", kind.gvr().GroupResource(), kind.Error)
+		} else {
+			fmt.Fprintf(c.progress, "%s: %d\n", kind.gvr().GroupResource(), kind.Count)
+		}
+	}
+	completedAt := time.Now().UTC()
+	c.manifest.CompletedAt = &completedAt
+	return c.save()
+}
+
+// crawlKind writes the resources of a kind, from the page its crawl stopped at if it was interrupted
+func (c *inventoryCrawl) crawlKind(ctx context.Context, kind *inventoryKind) error {
+	if kind.Count == 0 && kind.Continue == "" {
+		kind.Start = c.manifest.Bytes
+	}
+	resource := c.client.Resource(kind.gvr())
+	var client dynamic.ResourceInterface = resource
+	if kind.Namespaced && c.manifest.Namespace != "" {
+		client = resource.Namespace(c.manifest.Namespace)
+	}
+	for {
+		if err := c.limiter.Wait(ctx); err != nil {
+			return err
+		}
+		list, err := client.List(ctx, metav1.ListOptions{Limit: c.pageSize, Continue: kind.Continue})
+		switch {
+		case apierrors.IsResourceExpired(err) && kind.Continue != "":
+			// The snapshot the kind was paged through is gone, it's listed again from the start
+			if err := c.truncate(kind.Start); err != nil {
+				return err
+			}
+			c.manifest.Bytes = kind.Start
+			kind.Count, kind.Continue = 0, ""
+			continue
+		case apierrors.IsForbidden(err) || apierrors.IsNotFound(err) || apierrors.IsMethodNotSupported(err):
+			kind.Error, kind.Complete = err.Error(), true
+			return c.save()
+		case err != nil:
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("error listing %s: %w", kind.gvr().GroupResource(), err)
+		}
+
+		w := bufio.NewWriter(c.out)
+		var written int64
+		for _, item := range list.Items {
+			if item.GetKind() == "" {
+				item.SetAPIVersion(schema.GroupVersion{Group: kind.Group, Version: kind.Version}.String())
+				item.SetKind(kind.Kind)
+			}
+			line, err := json.Marshal(item.Object)
+			if err != nil {
+				return err
+			}
+			n, _ := w.Write(append(line, '\n'))
+			written += int64(n)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		// The page is on disk before the manifest counts it
+		if err := c.out.Sync(); err != nil {
+			return err
+		}
+		c.manifest.Bytes += written
+		kind.Count += len(list.Items)
+		kind.Continue = list.GetContinue()
+		kind.Complete = kind.Continue == ""
+		if err := c.save(); err != nil {
+			return err
+		}
+		if kind.Complete {
+			return nil
+		}
+	}
+}
+
+// save writes the manifest with the progress of the crawl
+func (c *inventoryCrawl) save() error {
+	c.manifest.Total = 0
+	for _, kind := range c.manifest.Kinds {
+		c.manifest.Total += kind.Count
+	}
+	return writeJSONFile(c.manifestPath, c.manifest)
+}
+
+func init() {
+	rootCmd.AddCommand(inventoryCmd)
+	inventoryCmd.Flags().StringVarP(&inventoryOut, "out", "o", "", "The file the resources are written to, one JSON object per line")
+	inventoryCmd.Flags().StringSliceVar(&inventoryKinds, "kinds", nil, "Only crawl these kinds, e.g. deployments,pods (default: every kind that can be listed)")
+	inventoryCmd.Flags().StringSliceVar(&inventoryExcludeKinds, "exclude-kinds", nil, "Don't crawl these kinds, e.g. secrets,events")
+	inventoryCmd.Flags().Float64Var(&inventoryQPS, "qps", 5, "The most list calls made per second, 0 for no limit")
+	inventoryCmd.Flags().Int64Var(&inventoryPageSize, "page-size", 500, "The most resources listed per call")
+	inventoryCmd.Flags().BoolVar(&inventoryResume, "resume", false, "Resume an interrupted crawl from the manifest next to --out")
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// pagedInventory lists resources page by page as the API server does, the continue token being the offset of the
+// page, which the fake client doesn't. The list call numbered failAt fails.
+type pagedInventory struct {
+	dynamic.Interface
+	failAt int
+	calls  int
+}
+
+type pagedInventoryResource struct {
+	dynamic.NamespaceableResourceInterface
+	client *pagedInventory
+}
+
+func (c *pagedInventory) Resource(gvr schema.GroupVersionResource) dynamic.NamespaceableResourceInterface {
+	return pagedInventoryResource{c.Interface.Resource(gvr), c}
+}
+
+func (r pagedInventoryResource) Namespace(string) dynamic.ResourceInterface {
+	return r
+}
+
+func (r pagedInventoryResource) List(ctx context.Context, options metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	r.client.calls++
+	if r.client.calls == r.client.failAt {
+		return nil, errors.New("connection reset by peer")
+	}
+	if options.Continue == "expired" {
+		return nil, apierrors.NewResourceExpired("continue token expired")
+	}
+	all, err := r.NamespaceableResourceInterface.List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	offset, _ := strconv.Atoi(options.Continue)
+	end := min(offset+int(options.Limit), len(all.Items))
+	page := &unstructured.UnstructuredList{Object: all.Object, Items: all.Items[offset:end]}
+	if end < len(all.Items) {
+		page.SetContinue(strconv.Itoa(end))
+	}
+	return page, nil
+}
+
+func newInventoryClient(pods int) *pagedInventory {
+	objects := []runtime.Object{newInventoryObject("apps/v1", "Deployment", "web")}
+	for i := 1; i <= pods; i++ {
+		objects = append(objects, newInventoryObject("v1", "Pod", fmt.Sprintf("web-%d", i)))
+	}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		{Version: "v1", Resource: "pods"}:                       "PodList",
+		{Version: "v1", Resource: "secrets"}:                    "SecretList",
+		{Group: "apps", Version: "v1", Resource: "deployments"}: "DeploymentList",
+	}, objects...)
+	client.PrependReactor("list", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "secrets"}, "", errors.New("denied"))
+	})
+	return &pagedInventory{Interface: client}
+}
+
+func newInventoryObject(apiVersion, kind, name string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": apiVersion,
+		"kind":       kind,
+		"metadata":   map[string]interface{}{"name": name, "namespace": "default"},
+	}}
+}
+
+var inventoryTestKinds = []parser.SchemaKind{
+	{Kind: "Pod", Resource: "pods", Version: "v1", Namespaced: true},
+	{Kind: "Secret", Resource: "secrets", Version: "v1", Namespaced: true},
+	{Kind: "Deployment", Resource: "deployments", Group: "apps", Version: "v1", Namespaced: true},
+}
+
+func newInventoryCrawl(t *testing.T, client dynamic.Interface, manifest *inventoryManifest, out string, resume bool) *inventoryCrawl {
+	t.Helper()
+	crawl := &inventoryCrawl{
+		client:       client,
+		limiter:      flowcontrol.NewFakeAlwaysRateLimiter(),
+		pageSize:     2,
+		manifest:     manifest,
+		manifestPath: inventoryManifestPath(out),
+		progress:     io.Discard,
+	}
+	if err := crawl.open(out, resume); err != nil {
+		t.Fatalf("open() error = %v", err)
+	}
+	t.Cleanup(func() { crawl.out.Close() })
+	return crawl
+}
+
+// exportedNames are the kinds and names of the resources of an export, one per line
+func exportedNames(t *testing.T, path string) []string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var names []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var object unstructured.Unstructured
+		if err := object.UnmarshalJSON(scanner.Bytes()); err != nil {
+			t.Fatalf("invalid line %q: %v", scanner.Text(), err)
+		}
+		names = append(names, object.GetKind()+"/"+object.GetName())
+	}
+	return names
+}
+
+func TestInventoryCrawl(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "inventory.jsonl")
+	client := newInventoryClient(5)
+	crawl := newInventoryCrawl(t, client, newInventoryManifest(inventoryTestKinds, "", time.Now()), out, false)
+
+	if err := crawl.run(context.Background()); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	expected := []string{"Pod/web-1", "Pod/web-2", "Pod/web-3", "Pod/web-4", "Pod/web-5", "Deployment/web"}
+	if names := exportedNames(t, out); !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+	// 3 pages of pods, and one of secrets and deployments each
+	if client.calls != 5 {
+		t.Errorf("expected 5 list calls, got %d", client.calls)
+	}
+
+	var manifest inventoryManifest
+	if err := readJSONFile(filepath.Join(filepath.Dir(out), "inventory.manifest.json"), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	info, _ := os.Stat(out)
+	if manifest.Total != 6 || manifest.Bytes != info.Size() || manifest.CompletedAt == nil {
+		t.Errorf("expected a complete manifest of the 6 resources, got %+v", manifest)
+	}
+	counts := map[string]int{}
+	for _, kind := range manifest.Kinds {
+		counts[kind.Resource] = kind.Count
+		if !kind.Complete {
+			t.Errorf("expected %s to be complete", kind.Resource)
+		}
+	}
+	if !reflect.DeepEqual(counts, map[string]int{"pods": 5, "secrets": 0, "deployments": 1}) {
+		t.Errorf("unexpected counts %v", counts)
+	}
+	if manifest.Kinds[1].Error == "" {
+		t.Errorf("expected the forbidden secrets to be noted, got %+v", manifest.Kinds[1])
+	}
+}
+
+func TestInventoryResume(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "inventory.jsonl")
+	client := newInventoryClient(5)
+	client.failAt = 2
+	crawl := newInventoryCrawl(t, client, newInventoryManifest(inventoryTestKinds, "", time.Now()), out, false)
+	if err := crawl.run(context.Background()); err == nil {
+		t.Fatal("expected the crawl to fail on the second page")
+	}
+	crawl.out.Close()
+	// A page written after the manifest was last saved is cut
+	file, err := os.OpenFile(out, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"kind":"Pod","metadata":{"name":"web-3"}}` + "\n" + `{"kind":"Po`)
+	file.Close()
+
+	var manifest inventoryManifest
+	if err := readJSONFile(inventoryManifestPath(out), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Kinds[0].Count != 2 || manifest.Kinds[0].Continue != "2" || manifest.CompletedAt != nil {
+		t.Fatalf("expected the progress of the first page, got %+v", manifest)
+	}
+	client.failAt = 0
+	crawl = newInventoryCrawl(t, client, &manifest, out, true)
+	if err := crawl.run(context.Background()); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	expected := []string{"Pod/web-1", "Pod/web-2", "Pod/web-3", "Pod/web-4", "Pod/web-5", "Deployment/web"}
+	if names := exportedNames(t, out); !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+	if manifest.Total != 6 || manifest.CompletedAt == nil {
+		t.Errorf("expected a complete manifest, got %+v", manifest)
+	}
+}
+
+func TestInventoryResumeExpired(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "inventory.jsonl")
+	client := newInventoryClient(3)
+	crawl := newInventoryCrawl(t, client, newInventoryManifest(inventoryTestKinds[:1], "", time.Now()), out, false)
+	if err := crawl.run(context.Background()); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	crawl.out.Close()
+
+	// The snapshot of the pods is gone by the time the crawl resumes, they're listed again
+	manifest := *crawl.manifest
+	manifest.CompletedAt = nil
+	manifest.Kinds = []inventoryKind{manifest.Kinds[0]}
+	manifest.Kinds[0].Complete, manifest.Kinds[0].Count, manifest.Kinds[0].Continue = false, 2, "expired"
+	info, _ := os.Stat(out)
+	manifest.Bytes = info.Size()
+	crawl = newInventoryCrawl(t, client, &manifest, out, true)
+	if err := crawl.run(context.Background()); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if names := exportedNames(t, out); !reflect.DeepEqual(names, []string{"Pod/web-1", "Pod/web-2", "Pod/web-3"}) {
+		t.Errorf("expected the pods once, got %v", names)
+	}
+	if manifest.Total != 3 {
+		t.Errorf("expected 3 pods, got %+v", manifest)
+	}
+}
+
+func TestSelectInventoryKinds(t *testing.T) {
+	resolve := func(identifier string) ([]parser.KindResolution, error) {
+		for _, kind := range inventoryTestKinds {
+			if kind.Resource == identifier || kind.Kind == identifier {
+				gvr := schema.GroupVersionResource{Group: kind.Group, Version: kind.Version, Resource: kind.Resource}
+				return []parser.KindResolution{{GVR: gvr}}, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown kind %s", identifier)
+	}
+	kindNames := func(kinds []parser.SchemaKind) []string {
+		var names []string
+		for _, kind := range kinds {
+			names = append(names, kind.Kind)
+		}
+		return names
+	}
+
+	kinds, err := selectInventoryKinds(inventoryTestKinds, nil, []string{"secrets"}, resolve)
+	if err != nil || !reflect.DeepEqual(kindNames(kinds), []string{"Pod", "Deployment"}) {
+		t.Errorf("expected every kind but secrets, got %v, %v", kindNames(kinds), err)
+	}
+	kinds, err = selectInventoryKinds(inventoryTestKinds, []string{"Deployment", "pods"}, nil, resolve)
+	if err != nil || !reflect.DeepEqual(kindNames(kinds), []string{"Pod", "Deployment"}) {
+		t.Errorf("expected the given kinds, got %v, %v", kindNames(kinds), err)
+	}
+	if _, err := selectInventoryKinds(inventoryTestKinds, []string{"widgets"}, nil, resolve); err == nil {
+		t.Error("expected an unknown kind to fail")
+	}
+}
@@ -45,6 +45,34 @@ func executeMacro(input string) (string, error) {
 	macroName = parts[0]
 	args := parts[1:]
 
+	if macroName == "resolve" {
+		return resolveIdentifier(args)
+	}
+	if macroName == "describe" || macroName == "schema" {
+		return describeKindCommand(args)
+	}
+	if macroName == "explain" {
+		return explainQuery(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(input), ":explain")))
+	}
+	if macroName == "session" {
+		return runSessionCommand(args)
+	}
+	if macroName == "cache" {
+		return runCacheCommand(args)
+	}
+	if macroName == "context" {
+		return runContextCommand(args)
+	}
+	if macroName == "contexts" {
+		return runContextsCommand(args)
+	}
+	if macroName == "namespace" {
+		return runNamespaceCommand(args)
+	}
+	if macroName == "namespaces" {
+		return runNamespacesCommand(args)
+	}
+
 	statements, err := macroManager.ExecuteMacro(macroName, args)
 	if err != nil {
 		return "", err
@@ -98,6 +126,11 @@ func (mm *MacroManager) ExecuteMacro(name string, args []string) ([]string, erro
 	return statements, nil
 }
 
+// macroStatement is a statement of a macro file as it runs: its lines joined, without their // and /* */ comments
+func macroStatement(lines string) string {
+	return strings.TrimSpace(strings.ReplaceAll(parser.StripComments(lines), "\n", " "))
+}
+
 func (mm *MacroManager) LoadMacrosFromFile(filename string) error {
 	file, err := os.Open(filename)
 	if err != nil {
@@ -115,7 +148,7 @@ func (mm *MacroManager) LoadMacrosFromFile(filename string) error {
 		line := strings.TrimSpace(scanner.Text())
 
 		// Skip empty lines and comments
-		if line == "" || strings.HasPrefix(line, "#") {
+		if line == "" || strings.HasPrefix(line, "#") || (currentStatement.Len() == 0 && macroStatement(line) == "") {
 			continue
 		}
 
@@ -123,7 +156,7 @@ func (mm *MacroManager) LoadMacrosFromFile(filename string) error {
 			// If we were processing a macro, add it to the manager
 			if currentMacro != nil {
 				if currentStatement.Len() > 0 {
-					currentMacro.Statements = append(currentMacro.Statements, currentStatement.String())
+					currentMacro.Statements = append(currentMacro.Statements, macroStatement(currentStatement.String()))
 				}
 				if len(currentMacro.Statements) == 0 {
 					return fmt.Errorf("macro '%s' has no statements (line %d)", currentMacro.Name, lineNumber)
@@ -155,13 +188,13 @@ func (mm *MacroManager) LoadMacrosFromFile(filename string) error {
 		} else {
 			// Add the line to the current statement
 			if currentStatement.Len() > 0 {
-				currentStatement.WriteString(" ")
+				currentStatement.WriteString("\n")
 			}
 			currentStatement.WriteString(line)
 
 			// If the line ends with a semicolon, add the statement to the macro
-			if strings.HasSuffix(line, ";") {
-				currentMacro.Statements = append(currentMacro.Statements, currentStatement.String())
+			if statement := macroStatement(currentStatement.String()); strings.HasSuffix(statement, ";") {
+				currentMacro.Statements = append(currentMacro.Statements, statement)
 				currentStatement.Reset()
 			}
 		}
@@ -170,7 +203,7 @@ func (mm *MacroManager) LoadMacrosFromFile(filename string) error {
 	// Add the last macro if there is one
 	if currentMacro != nil {
 		if currentStatement.Len() > 0 {
-			currentMacro.Statements = append(currentMacro.Statements, currentStatement.String())
+			currentMacro.Statements = append(currentMacro.Statements, macroStatement(currentStatement.String()))
 		}
 		if len(currentMacro.Statements) == 0 {
 			return fmt.Errorf("macro '%s' has no statements (line %d)", currentMacro.Name, lineNumber)
@@ -199,7 +232,7 @@ func (mm *MacroManager) loadMacros(source string, reader io.Reader) error {
 		line := strings.TrimSpace(scanner.Text())
 
 		// Skip empty lines and comments
-		if line == "" || strings.HasPrefix(line, "#") {
+		if line == "" || strings.HasPrefix(line, "#") || (currentStatement.Len() == 0 && macroStatement(line) == "") {
 			continue
 		}
 
@@ -207,7 +240,7 @@ func (mm *MacroManager) loadMacros(source string, reader io.Reader) error {
 			// If we were processing a macro, add it to the manager
 			if currentMacro != nil {
 				if currentStatement.Len() > 0 {
-					currentMacro.Statements = append(currentMacro.Statements, currentStatement.String())
+					currentMacro.Statements = append(currentMacro.Statements, macroStatement(currentStatement.String()))
 					currentStatement.Reset()
 				}
 				if len(currentMacro.Statements) == 0 {
@@ -244,12 +277,13 @@ func (mm *MacroManager) loadMacros(source string, reader io.Reader) error {
 			return fmt.Errorf("statement found outside of macro definition at line %d", lineNumber)
 		} else {
 			// Add the line to the current statement
+			if currentStatement.Len() > 0 {
+				currentStatement.WriteString("\n")
+			}
 			currentStatement.WriteString(line)
-			if strings.HasSuffix(line, ";") {
-				currentMacro.Statements = append(currentMacro.Statements, currentStatement.String())
+			if statement := macroStatement(currentStatement.String()); strings.HasSuffix(statement, ";") {
+				currentMacro.Statements = append(currentMacro.Statements, statement)
 				currentStatement.Reset()
-			} else {
-				currentStatement.WriteString(" ")
 			}
 		}
 	}
@@ -257,7 +291,7 @@ func (mm *MacroManager) loadMacros(source string, reader io.Reader) error {
 	// Add the last macro if there is one
 	if currentMacro != nil {
 		if currentStatement.Len() > 0 {
-			currentMacro.Statements = append(currentMacro.Statements, currentStatement.String())
+			currentMacro.Statements = append(currentMacro.Statements, macroStatement(currentStatement.String()))
 		}
 		if len(currentMacro.Statements) == 0 {
 			return fmt.Errorf("macro '%s' has no statements (line %d)", currentMacro.Name, lineNumber)
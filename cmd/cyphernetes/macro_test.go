@@ -5,6 +5,8 @@ import (
 	"os"
 	"strings"
 	"testing"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
 )
 
 //go:embed default_macros.txt
@@ -209,6 +211,26 @@ stmt2`
 	}
 }
 
+func TestLoadMacrosWithComments(t *testing.T) {
+	mm := NewMacroManager()
+	macroString := `// Macros of the on-call team
+:failing # Pods that aren't running
+MATCH (p:Pod) // in every namespace
+WHERE p.status.phase != "Running" /* Pending too;
+   and Unknown */
+RETURN p.metadata.name; // their names`
+	if err := mm.LoadMacrosFromString("test", macroString); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	macro, exists := mm.Macros["failing"]
+	if !exists || len(macro.Statements) != 1 {
+		t.Fatalf("Expected the failing macro with 1 statement, got %v", macro)
+	}
+	if _, err := parser.ParseQuery(strings.TrimSuffix(macro.Statements[0], ";")); err != nil {
+		t.Errorf("Expected the statement %q to parse, got %v", macro.Statements[0], err)
+	}
+}
+
 func TestExecuteNonExistentMacro(t *testing.T) {
 	mm := NewMacroManager()
 	_, err := mm.ExecuteMacro("non_existent", []string{})
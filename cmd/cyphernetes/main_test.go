@@ -89,9 +89,26 @@ Flags:
   -h, --help   help for shell
 
 Global Flags:
-  -A, --all-namespaces     Query all namespaces
-  -l, --loglevel string    The log level to use (debug, info, warn, error, fatal, panic) (default "info")
-  -n, --namespace string   The namespace to query against (default "default")`
+      --adaptive-throttling          Slow the API calls of queries down while the API server rejects them with 429 Too Many Requests (default true)
+  -A, --all-namespaces               Query all namespaces
+      --api-burst int                How many Kubernetes API calls queries may make at once above --api-qps (default 10)
+      --api-qps float32              How many Kubernetes API calls a second queries make on average, 0 for no limit (default 5)
+      --api-workers int              How many Kubernetes API calls queries make at once, e.g. to list the node patterns of a MATCH clause together (default 4)
+      --audit-events                 Record every change queries make as an Event of the changed object
+      --audit-log string             Record every change queries make, who made it and with which query, in this file
+      --cache-ttl duration           Reuse the resources a query listed in the next queries for this long, e.g. 30s in a shell session (0 to list them every time)
+      --compat int                   The language version queries without a CYPHERNETES pragma are checked against (default: the latest)
+      --context string               The kubeconfig context to use
+      --discovery-cache-dir string   Persist API discovery results in this directory (e.g. ~/.kube/cache) instead of only in memory
+      --explain-fields               Annotate returned values with where they came from (live API, cache, computed)
+      --field-manager string         The field manager of the changes queries make (default "cyphernetes")
+      --index-fields strings         Fields WHERE equality predicates look up in an index of the listed resources (empty to disable) (default [metadata.labels,status.phase,spec.nodeName])
+      --kubeconfig string            Path to the kubeconfig file to use (default: $KUBECONFIG or ~/.kube/config)
+      --list-timeout strings         Fail list calls that take longer than this, e.g. 30s, or than the deadline of their API group or resource, e.g. metrics.k8s.io=5s
+      --log-format string            The format of log records (text, json) (default "text")
+  -l, --log-level string             The log level to use (debug, info, warn, error) (default "info")
+      --match-all-gvrs               When a kind matches several API groups, return resources from all of them (tagged with _gvr) instead of those of the core group, or an error
+  -n, --namespace string             The namespace to query against (default "default")`
 	checkOutput(t, output, expectedContent, "\"cyphernetes shell -h\"")
 }
 
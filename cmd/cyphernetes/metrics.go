@@ -0,0 +1,149 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// serverMetrics are the Prometheus metrics exposed by the web server on /metrics
+type serverMetrics struct {
+	registry *prometheus.Registry
+
+	queries       *prometheus.CounterVec
+	queryDuration prometheus.Histogram
+	queryAPICalls prometheus.Histogram
+	apiCalls      *prometheus.CounterVec
+	queryErrors   *prometheus.CounterVec
+	cacheLookups  *prometheus.CounterVec
+
+	// Cache lookups since startup, for the hit ratio
+	cacheHits   atomic.Int64
+	cacheMisses atomic.Int64
+}
+
+var metrics = newServerMetrics()
+
+func newServerMetrics() *serverMetrics {
+	m := &serverMetrics{
+		registry: prometheus.NewRegistry(),
+		queries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "cyphernetes_queries_total",
+			Help: "Number of queries run, by status (success, error).",
+		}, []string{"status"}),
+		queryDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "cyphernetes_query_duration_seconds",
+			Help:    "Time taken to parse and execute a query.",
+			Buckets: prometheus.DefBuckets,
+		}),
+		queryAPICalls: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "cyphernetes_api_calls_per_query",
+			Help:    "Number of Kubernetes API calls made by a query.",
+			Buckets: []float64{0, 1, 2, 5, 10, 25, 50, 100, 250},
+		}),
+		apiCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "cyphernetes_api_calls_total",
+			Help: "Number of Kubernetes API calls made by queries, by verb.",
+		}, []string{"verb"}),
+		queryErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "cyphernetes_query_errors_total",
+			Help: "Number of failed queries, by the clause they failed in (parse for syntax errors).",
+		}, []string{"clause"}),
+		cacheLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "cyphernetes_cache_lookups_total",
+			Help: "Number of result cache lookups, by result (hit, miss).",
+		}, []string{"result"}),
+	}
+
+	cacheHitRatio := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "cyphernetes_cache_hit_ratio",
+		Help: "Ratio of result cache lookups that were hits since the server started.",
+	}, m.cacheHitRatio)
+	runningQueries := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "cyphernetes_queries_running",
+		Help: "Number of queries running on the workers of the web server.",
+	}, func() float64 {
+		running, _ := scheduler.stats()
+		return float64(running)
+	})
+	waitingQueries := []prometheus.Collector{}
+	for _, class := range []queryClass{interactiveQuery, scheduledQuery} {
+		waitingQueries = append(waitingQueries, prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name:        "cyphernetes_queries_waiting",
+			Help:        "Number of queries waiting for a worker of the web server, by class (interactive, scheduled).",
+			ConstLabels: prometheus.Labels{"class": class.String()},
+		}, func() float64 {
+			_, waiting := scheduler.stats()
+			return float64(waiting[class])
+		}))
+	}
+
+	m.registry.MustRegister(
+		m.queries,
+		m.queryDuration,
+		m.queryAPICalls,
+		m.apiCalls,
+		m.queryErrors,
+		m.cacheLookups,
+		cacheHitRatio,
+		runningQueries,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	m.registry.MustRegister(waitingQueries...)
+	return m
+}
+
+// hooks returns the parser hooks feeding these metrics
+func (m *serverMetrics) hooks() parser.QueryHooks {
+	return parser.QueryHooks{
+		OnAPICall: func(verb string, gvr schema.GroupVersionResource) {
+			m.apiCalls.WithLabelValues(verb).Inc()
+		},
+		OnCacheLookup: func(hit bool) {
+			if hit {
+				m.cacheHits.Add(1)
+				m.cacheLookups.WithLabelValues("hit").Inc()
+			} else {
+				m.cacheMisses.Add(1)
+				m.cacheLookups.WithLabelValues("miss").Inc()
+			}
+		},
+		OnClauseError: func(clause string, err error) {
+			m.queryErrors.WithLabelValues(clause).Inc()
+		},
+	}
+}
+
+func (m *serverMetrics) cacheHitRatio() float64 {
+	hits, misses := m.cacheHits.Load(), m.cacheMisses.Load()
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
+// startQuery starts measuring a query, the returned func records it once it ended with err after making apiCalls
+func (m *serverMetrics) startQuery() func(apiCalls int64, err error) {
+	start := time.Now()
+	return func(apiCalls int64, err error) {
+		m.queryDuration.Observe(time.Since(start).Seconds())
+		m.queryAPICalls.Observe(float64(apiCalls))
+		if err != nil {
+			m.queries.WithLabelValues("error").Inc()
+		} else {
+			m.queries.WithLabelValues("success").Inc()
+		}
+	}
+}
+
+func setupMetricsRoute(router *gin.Engine) {
+	parser.Hooks = metrics.hooks()
+	router.GET("/metrics", gin.WrapH(promhttp.HandlerFor(metrics.registry, promhttp.HandlerOpts{})))
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
+	"github.com/gin-gonic/gin"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	originalMetrics := metrics
+	originalHooks := parser.Hooks
+	defer func() {
+		metrics = originalMetrics
+		parser.Hooks = originalHooks
+	}()
+	metrics = newServerMetrics()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	setupAPIRoutes(router)
+	setupMetricsRoute(router)
+
+	// A query that fails to parse never reaches the executor
+	req := httptest.NewRequest(http.MethodPost, "/api/query", bytes.NewBufferString(`{"query": "MATCH (p:Pod"}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected a parse error, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Simulate a query as the executor reports it
+	endQuery := metrics.startQuery()
+	pods := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	parser.Hooks.OnCacheLookup(false)
+	parser.Hooks.OnAPICall("list", pods)
+	parser.Hooks.OnAPICall("patch", pods)
+	parser.Hooks.OnCacheLookup(true)
+	parser.Hooks.OnCacheLookup(true)
+	parser.Hooks.OnCacheLookup(true)
+	parser.Hooks.OnClauseError("set", fmt.Errorf("forbidden"))
+	endQuery(2, fmt.Errorf("forbidden"))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected metrics, got %d", w.Code)
+	}
+
+	body := w.Body.String()
+	for _, expected := range []string{
+		`cyphernetes_queries_total{status="error"} 2`,
+		`cyphernetes_query_duration_seconds_count 2`,
+		`cyphernetes_api_calls_per_query_sum 2`,
+		`cyphernetes_api_calls_total{verb="list"} 1`,
+		`cyphernetes_api_calls_total{verb="patch"} 1`,
+		`cyphernetes_query_errors_total{clause="parse"} 1`,
+		`cyphernetes_query_errors_total{clause="set"} 1`,
+		`cyphernetes_cache_lookups_total{result="hit"} 3`,
+		`cyphernetes_cache_hit_ratio 0.75`,
+		`cyphernetes_queries_running 0`,
+		`cyphernetes_queries_waiting{class="scheduled"} 0`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", expected, body)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// outputFormat is the -o flag, the format results are printed in
+var outputFormat = "json"
+
+// resultsPrinter prints the results of queries to w
+type resultsPrinter func(data interface{}, w io.Writer)
+
+// newResultsPrinter returns the printer of an output format, mirroring those of kubectl:
+//
+//	json                     pretty JSON, colorized unless --raw-output is set
+//	table                    a table of the rows of the query's variable, see alignedTablePrinter
+//	csv, tsv                 the table as CSV or TSV, see tablePrinter
+//	go-template=<template>   a Go template, e.g. {{range .p}}{{.name}}{{"\n"}}{{end}}
+//	go-template-file=<file>  the Go template in a file
+//	jsonpath=<expression>    a JSONPath expression, e.g. {.p[*].name}
+//	jsonpath-file=<file>     the JSONPath expression in a file
+//
+// Templates and expressions see the results as they're printed as JSON, keyed by the variables of the query, or with
+// --rows the list of its rows, e.g. {{range .}}{{.deployment}} {{.pod}}{{"\n"}}{{end}}.
+func newResultsPrinter(format string) (resultsPrinter, error) {
+	kind, text, _ := strings.Cut(format, "=")
+	if strings.HasSuffix(kind, "-file") {
+		data, err := os.ReadFile(text)
+		if err != nil {
+			return nil, fmt.Errorf("error reading the %s of -o %s: %v", strings.TrimSuffix(kind, "-file"), kind, err)
+		}
+		kind, text = strings.TrimSuffix(kind, "-file"), string(data)
+	}
+	switch kind {
+	case "", "json":
+		return printResults, nil
+	case "table":
+		return alignedTablePrinter, nil
+	case "csv", "tsv":
+		return tablePrinter(kind == "tsv"), nil
+	case "go-template":
+		if text == "" {
+			return nil, fmt.Errorf("-o go-template needs a template, e.g. -o go-template='{{range .p}}{{.name}}{{\"\\n\"}}{{end}}'")
+		}
+		tmpl, err := template.New("output").Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing the template of -o go-template: %v", err)
+		}
+		return templatePrinter(func(w io.Writer, data interface{}) error { return tmpl.Execute(w, data) }), nil
+	case "jsonpath":
+		if text == "" {
+			return nil, fmt.Errorf("-o jsonpath needs an expression, e.g. -o jsonpath='{.p[*].name}'")
+		}
+		path := jsonpath.New("output").AllowMissingKeys(true)
+		if err := path.Parse(jsonpathTemplate(text)); err != nil {
+			return nil, fmt.Errorf("error parsing the expression of -o jsonpath: %v", err)
+		}
+		return templatePrinter(path.Execute), nil
+	}
+	return nil, fmt.Errorf("unknown output format %q, expected json, table, csv, tsv, go-template=..., go-template-file=..., jsonpath=... or jsonpath-file=...", format)
+}
+
+// templatePrinter prints results with a template, handing it the results as JSON would decode them, so that numbers,
+// lists and objects are those the JSON output shows rather than the types the query built them with
+func templatePrinter(execute func(w io.Writer, data interface{}) error) resultsPrinter {
+	return func(data interface{}, w io.Writer) {
+		decoded, err := decodeResults(data)
+		if err != nil {
+			fmt.Fprintln(w, "Error marshalling results: ", err)
+			return
+		}
+		if err := execute(w, decoded); err != nil {
+			fmt.Fprintln(w, "Error formatting results: ", err)
+		}
+	}
+}
+
+// decodeResults returns the results as JSON decodes them
+func decodeResults(data interface{}) (interface{}, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var decoded interface{}
+	err = json.Unmarshal(encoded, &decoded)
+	return decoded, err
+}
+
+// jsonpathTemplate wraps a bare JSONPath expression in braces like kubectl does, so that -o jsonpath=.p[*].name is
+// -o jsonpath={.p[*].name}
+func jsonpathTemplate(expression string) string {
+	if strings.Contains(expression, "{") {
+		return expression
+	}
+	if !strings.HasPrefix(expression, ".") {
+		expression = "." + expression
+	}
+	return "{" + expression + "}"
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResultsPrinter(t *testing.T) {
+	data := map[string]interface{}{
+		"p": []interface{}{
+			map[string]interface{}{"name": "web-1", "restarts": int64(2)},
+			map[string]interface{}{"name": "web-2", "restarts": int64(0)},
+		},
+	}
+	file := filepath.Join(t.TempDir(), "names.tmpl")
+	if err := os.WriteFile(file, []byte(`{{range .p}}{{.name}} {{end}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{`go-template={{range .p}}{{.name}}{{"\n"}}{{end}}`, "web-1\nweb-2\n"},
+		{`go-template={{range .p}}{{if gt .restarts 0.0}}{{.name}}{{end}}{{end}}`, "web-1"},
+		{"go-template-file=" + file, "web-1 web-2 "},
+		{`jsonpath={.p[*].name}`, "web-1 web-2"},
+		{`jsonpath=.p[0].restarts`, "2"},
+		{`jsonpath={range .p[*]}{.name}={.restarts}{"\n"}{end}`, "web-1=2\nweb-2=0\n"},
+		{`jsonpath={.p[*].missing}`, ""},
+	}
+	for _, tt := range tests {
+		printer, err := newResultsPrinter(tt.format)
+		if err != nil {
+			t.Errorf("%s: %v", tt.format, err)
+			continue
+		}
+		buf := new(bytes.Buffer)
+		printer(data, buf)
+		if buf.String() != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.format, tt.expected, buf.String())
+		}
+	}
+
+	for format, expected := range map[string]string{
+		"yaml":                     `unknown output format "yaml"`,
+		"go-template":              "-o go-template needs a template",
+		"go-template={{.p":         "error parsing the template of -o go-template",
+		"jsonpath={.p[":            "error parsing the expression of -o jsonpath",
+		"jsonpath-file=missing.jp": "error reading the jsonpath of -o jsonpath-file",
+	} {
+		if _, err := newResultsPrinter(format); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected an error containing %q, got %v", format, expected, err)
+		}
+	}
+}
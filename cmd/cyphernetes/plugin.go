@@ -0,0 +1,50 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
+	"github.com/spf13/cobra"
+)
+
+// kubectl runs executables named kubectl-<plugin> found in the PATH, so installing this binary as
+// kubectl-cyphernetes or kubectl-cypher makes `kubectl cyphernetes` and `kubectl cypher` run it.
+
+// pluginCommandName is how kubectl invokes the binary, e.g. "kubectl cypher", if it's installed as a plugin
+func pluginCommandName(executable string) (string, bool) {
+	name := strings.TrimSuffix(filepath.Base(executable), ".exe")
+	plugin, ok := strings.CutPrefix(name, "kubectl-")
+	if !ok || plugin == "" {
+		return "", false
+	}
+	// kubectl maps dashes in plugin commands to underscores in executable names
+	return "kubectl " + strings.ReplaceAll(plugin, "_", "-"), true
+}
+
+// setupPlugin makes the root command behave like a kubectl plugin: a query can be given without the query
+// subcommand (kubectl cypher 'MATCH ...'), and without --namespace queries run in the namespace of the kubeconfig
+// context, like kubectl does.
+func setupPlugin(root *cobra.Command, name string) {
+	root.Use = name
+	root.Args = cobra.ArbitraryArgs
+	root.Run = func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			cmd.Help()
+			return
+		}
+		queryCmd.Run(cmd, args)
+	}
+	root.Flags().BoolVarP(&disableColorJsonOutput, "raw-output", "r", false, "Disable colorized JSON output")
+
+	validateFlags := root.PersistentPreRunE
+	root.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if !cmd.Flags().Changed("namespace") {
+			namespace, _, err := parser.KubeClientConfig("").Namespace()
+			if err == nil {
+				parser.Namespace = namespace
+			}
+		}
+		return validateFlags(cmd, args)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
+	"github.com/spf13/cobra"
+)
+
+func TestPluginCommandName(t *testing.T) {
+	tests := []struct {
+		executable string
+		name       string
+		ok         bool
+	}{
+		{"/usr/local/bin/kubectl-cyphernetes", "kubectl cyphernetes", true},
+		{"kubectl-cypher.exe", "kubectl cypher", true},
+		{"/home/me/.krew/bin/kubectl-cypher_query", "kubectl cypher-query", true},
+		{"/usr/local/bin/cyphernetes", "", false},
+		{"kubectl-", "", false},
+	}
+	for _, tt := range tests {
+		name, ok := pluginCommandName(tt.executable)
+		if name != tt.name || ok != tt.ok {
+			t.Errorf("pluginCommandName(%q) = %q, %v, want %q, %v", tt.executable, name, ok, tt.name, tt.ok)
+		}
+	}
+}
+
+func TestSetupPluginNamespace(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	err := os.WriteFile(kubeconfig, []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: dev
+  cluster:
+    server: https://dev.example.com
+users:
+- name: dev
+contexts:
+- name: dev
+  context:
+    cluster: dev
+    user: dev
+    namespace: team-a
+- name: prod
+  context:
+    cluster: dev
+    user: dev
+    namespace: team-b
+current-context: dev
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	originalKubeconfig, originalContext, originalNamespace := parser.Kubeconfig, parser.KubeContext, parser.Namespace
+	defer func() {
+		parser.Kubeconfig, parser.KubeContext, parser.Namespace = originalKubeconfig, originalContext, originalNamespace
+	}()
+	parser.Kubeconfig = kubeconfig
+
+	tests := []struct {
+		args      []string
+		namespace string
+	}{
+		{nil, "team-a"},
+		{[]string{"--context", "prod"}, "team-b"},
+		{[]string{"-n", "other"}, "other"},
+	}
+	for _, tt := range tests {
+		parser.KubeContext, parser.Namespace = "", "default"
+		root := &cobra.Command{
+			Use:               "cyphernetes",
+			PersistentPreRunE: func(cmd *cobra.Command, args []string) error { return nil },
+		}
+		root.PersistentFlags().StringVarP(&parser.Namespace, "namespace", "n", "default", "")
+		root.PersistentFlags().StringVar(&parser.KubeContext, "context", "", "")
+		setupPlugin(root, "kubectl cypher")
+		root.SetArgs(tt.args)
+		root.SetOut(new(bytes.Buffer))
+		if err := root.Execute(); err != nil {
+			t.Fatalf("%v: Execute() error = %v", tt.args, err)
+		}
+		if parser.Namespace != tt.namespace {
+			t.Errorf("%v: expected namespace %s, got %s", tt.args, tt.namespace, parser.Namespace)
+		}
+	}
+}
@@ -1,19 +1,46 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/avitaltamir/cyphernetes/pkg/parser"
 	"github.com/spf13/cobra"
 )
 
+// queryLedger and queryResume are the ledger files --ledger writes and --resume resumes from
+var queryLedger, queryResume string
+
+// queryAtomic is the --atomic flag, rolling back the changes of a query that fails
+var queryAtomic bool
+
+// queryPage holds the --max-rows and --continue flags, and queryTimeout the --timeout flag
+var queryPage parser.PageOptions
+var queryTimeout time.Duration
+
+// queryParams are the --param flags, giving the parameters of the query their values
+var queryParams []string
+
+// queryRollout holds the --batch-size, --pause, --stop-on-error and --health-query flags
+var queryRollout parser.Rollout
+
+// returnRows is the --rows flag, printing the results of RETURN as rows rather than keyed by variable
+var returnRows bool
+
 var (
 	parseQuery       = parser.ParseQuery
 	newQueryExecutor = parser.NewQueryExecutor
-	executeMethod    = (*parser.QueryExecutor).Execute
+	executeMethod    = (*parser.QueryExecutor).ExecuteContext
+	executePage      = (*parser.QueryExecutor).ExecutePage
 )
 
 var queryCmd = &cobra.Command{
@@ -27,38 +54,196 @@ var queryCmd = &cobra.Command{
 			os.Exit(1)
 		}
 		parser.CleanOutput = true
-		parser.InitResourceSpecs()
-		runQuery(args, os.Stdout)
+		initResourceSpecsOrWarn()
+		if code := runQuery(args, os.Stdout); code != exitOK {
+			os.Exit(code)
+		}
 	},
 }
 
-func runQuery(args []string, w io.Writer) {
+// runQuery runs the query of the query command, printing its results to w, and returns the exit code of the command
+func runQuery(args []string, w io.Writer) int {
+	printer, err := newResultsPrinter(outputFormat)
+	if err != nil {
+		return printError(w, exitError, "Error:", err, "")
+	}
+	return runStatement(args[0], w, printer)
+}
+
+// runStatement runs a query like the query command, handing its results to output, and returns the exit code of the
+// command
+func runStatement(query string, w io.Writer, output resultsPrinter) int {
+	if !slices.Contains(errorFormats, errorFormat) {
+		fmt.Fprintf(w, "Error: unknown error format %q, expected one of %s\n", errorFormat, strings.Join(errorFormats, ", "))
+		return exitError
+	}
+
 	// Parse the query to get an AST.
-	ast, err := parseQuery(args[0])
+	ast, err := parseQuery(query)
 	if err != nil {
-		fmt.Fprintln(w, "Error parsing query: ", err)
-		return
+		recordQuery("query", nil, err)
+		return printError(w, exitParseError, "Error parsing query: ", err, errorHint(query, err))
+	}
+
+	if len(queryParams) > 0 {
+		parameters, err := parseQueryParams(queryParams)
+		if err == nil {
+			ast, err = parser.BindParameters(ast, parameters)
+		}
+		if err != nil {
+			recordQuery("query", nil, err)
+			return printError(w, exitParseError, "Error in query parameters: ", err, "")
+		}
+	}
+
+	if !slices.Contains(planFormats, explainFormat) {
+		return printError(w, exitError, "Error:", fmt.Errorf("unknown plan format %q, expected one of %s", explainFormat, strings.Join(planFormats, ", ")), "")
 	}
 
 	// Execute the query against the Kubernetes API.
 	executor, err := newQueryExecutor()
 	if err != nil {
-		fmt.Fprintln(w, "Error creating query executor: ", err)
-		return
+		return printError(w, exitError, "Error creating query executor: ", err, "")
+	}
+	ledger, err := openLedger(query)
+	if err != nil {
+		return printError(w, exitError, "Error opening ledger: ", err, "")
+	}
+	executor.Ledger = ledger
+	rollout, err := newRollout()
+	if err != nil {
+		return printError(w, exitError, "Error in rollout flags: ", err, "")
+	}
+	executor.Rollout = rollout
+	executor.Atomic = queryAtomic
+	executor.Rows = returnRows
+	maxMemory, err := parseMaxMemory(queryMaxMemory)
+	if err != nil {
+		return printError(w, exitError, "Error: ", err, "")
+	}
+	// Ctrl-C stops the query, rather than the process, so that what it did can be reported
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if queryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, queryTimeout)
+		defer cancel()
+	}
+	ctx, usage := monitorUsage(ctx, maxMemory, queryMaxMemory)
+	var results parser.QueryResult
+	if queryPage.MaxRows > 0 || queryPage.Continue != "" {
+		results, err = executePage(executor, ctx, ast, "", queryPage)
+	} else {
+		results, err = executeMethod(executor, ctx, ast, "")
+	}
+	report := usage.stop()
+	recordQuery("query", ast, err)
+	if queryProfile {
+		defer printProfile(w, report, executor.APICalls())
 	}
-	results, err := executeMethod(executor, ast, "")
 	if err != nil {
-		fmt.Fprintln(w, "Error executing query: ", err)
+		var memoryErr *memoryLimitError
+		if errors.As(context.Cause(ctx), &memoryErr) {
+			// Printing the rows returned so far would take yet more memory
+			return printError(w, exitExecutionError, "Error executing query: ", err, withLedgerHint(memoryLimitHint(memoryErr), ledger))
+		}
+		if results.Truncated {
+			output(printedResults(results), w)
+			printTruncated(results, w)
+		} else if parser.DiagnosticCodeOf(err) == parser.CodeRolloutFailures {
+			// The rollout went on past the failed changes, its results are complete
+			output(printedResults(results), w)
+		}
+		return printError(w, exitExecutionError, "Error executing query: ", err, withLedgerHint(errorHint(query, err), ledger))
+	}
+	if plan, ok := results.Data["plan"].(*parser.QueryPlan); ok && ast.Explain && explainFormat != "json" {
+		rendered, err := formatPlan(plan, explainFormat)
+		if err != nil {
+			return printError(w, exitError, "Error: ", err, "")
+		}
+		fmt.Fprint(w, rendered)
+		return exitOK
+	}
+	output(printedResults(results), w)
+	if results.Truncated {
+		printTruncated(results, w)
+	}
+	if failOnEmpty && !ast.Explain && emptyResults(results.Data) {
+		return exitEmpty
+	}
+	return exitOK
+}
+
+// printedResults are the results of a query as they're printed: their Rows with --rows, or else their data keyed by
+// the variables of the query, which is all queries without a RETURN clause have
+func printedResults(results parser.QueryResult) interface{} {
+	if returnRows && results.Rows != nil {
+		return results.Rows
+	}
+	return results.Data
+}
+
+// printTruncated notes that the results are partial, and how to get the rest if the query can be resumed
+func printTruncated(results parser.QueryResult, w io.Writer) {
+	if results.Continue == "" {
+		fmt.Fprintln(w, "... results truncated")
 		return
 	}
+	fmt.Fprintf(w, "... results truncated, rerun the query with --continue %s for the next rows\n", results.Continue)
+}
+
+// withLedgerHint adds how to resume the query from its ledger to the hint of its error, if it has one
+func withLedgerHint(hint string, ledger *parser.Ledger) string {
+	if ledger == nil {
+		return hint
+	}
+	resume := fmt.Sprintf("Changes were recorded in %s, rerun the query with --resume %s to skip them", ledger.Path(), ledger.Path())
+	if hint == "" {
+		return resume
+	}
+	return hint + "\n" + resume
+}
 
-	// Print the results as pretty JSON.
-	json, err := json.MarshalIndent(results.Data, "", "  ")
+// openLedger returns the ledger to record the query's changes in, if --ledger or --resume was given
+func openLedger(query string) (*parser.Ledger, error) {
+	namespace := parser.Namespace
+	if parser.AllNamespaces {
+		namespace = ""
+	}
+	if queryResume != "" {
+		return parser.LoadLedger(queryResume, query, namespace)
+	}
+	if queryLedger != "" {
+		return parser.NewLedger(queryLedger, query, namespace)
+	}
+	return nil, nil
+}
+
+// newRollout returns the rollout to apply the query's changes with, if --batch-size was given
+func newRollout() (*parser.Rollout, error) {
+	if queryRollout.BatchSize <= 0 {
+		if queryRollout.Pause > 0 || queryRollout.HealthQuery != "" {
+			return nil, fmt.Errorf("--pause and --health-query require --batch-size")
+		}
+		return nil, nil
+	}
+	if queryRollout.HealthQuery != "" {
+		if _, err := parser.ParseHealthQuery(queryRollout.HealthQuery); err != nil {
+			return nil, err
+		}
+	}
+	rollout := queryRollout
+	return &rollout, nil
+}
+
+// printResults prints the results as pretty JSON
+func printResults(data interface{}, w io.Writer) {
+	json, err := json.MarshalIndent(data, "", "  ")
 	if err != nil {
 		fmt.Fprintln(w, "Error marshalling results: ", err)
 		return
 	}
-	if !disableColorJsonOutput {
+	if !disableColorJsonOutput && colorEnabled() {
 		json = []byte(colorizeJson(string(json)))
 	}
 
@@ -67,7 +252,48 @@ func runQuery(args []string, w io.Writer) {
 	}
 }
 
+// parseQueryParams parses name=value parameters, values being JSON, e.g. 3 or true, or else strings
+func parseQueryParams(params []string) (map[string]interface{}, error) {
+	parameters := make(map[string]interface{}, len(params))
+	for _, param := range params {
+		name, value, ok := strings.Cut(param, "=")
+		name = strings.TrimPrefix(name, "$")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("expected a parameter as name=value, got %q", param)
+		}
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+			decoded = value
+		}
+		parameters[name] = decoded
+	}
+	return parameters, nil
+}
+
 func init() {
 	rootCmd.AddCommand(queryCmd)
 	queryCmd.PersistentFlags().BoolVarP(&disableColorJsonOutput, "raw-output", "r", false, "Disable colorized JSON output")
+	queryCmd.Flags().StringVarP(&outputFormat, "output", "o", "json", "Print the results as json, a table, csv, tsv, or with go-template=..., go-template-file=..., jsonpath=... or jsonpath-file=...")
+	queryCmd.Flags().BoolVar(&tableWide, "wide", false, "Print the values of -o table in full, rather than truncating them to fit the terminal")
+	queryCmd.Flags().BoolVar(&noColor, "no-color", false, "Print the results without colors, as the NO_COLOR environment variable does")
+	queryCmd.Flags().StringVar(&explainFormat, "explain-format", "json", "Print the plans of EXPLAIN queries as json, a tree, or a Graphviz dot graph")
+	queryCmd.Flags().StringVar(&errorFormat, "error-format", "text", "Print errors as text, or as JSON on stderr")
+	queryCmd.Flags().BoolVar(&failOnEmpty, "fail-on-empty", false, "Exit with code 4 if the query returns no results")
+	queryCmd.Flags().StringVar(&queryLedger, "ledger", "", "Record the changes the query makes in this file, so an interrupted run can be resumed")
+	queryCmd.Flags().StringVar(&queryResume, "resume", "", "Resume an interrupted run from its ledger, skipping the changes it already made")
+	queryCmd.MarkFlagsMutuallyExclusive("ledger", "resume")
+	queryCmd.Flags().BoolVar(&queryAtomic, "atomic", false, "Roll back the changes the query made if it fails")
+	// A rolled back run has nothing to resume
+	queryCmd.MarkFlagsMutuallyExclusive("atomic", "ledger")
+	queryCmd.MarkFlagsMutuallyExclusive("atomic", "resume")
+	queryCmd.Flags().StringArrayVar(&queryParams, "param", nil, "Give a $parameter of the query a value, as name=value")
+	queryCmd.Flags().DurationVar(&queryTimeout, "timeout", 0, "Stop the query after this long, printing the results returned until then")
+	queryCmd.Flags().IntVar(&queryPage.MaxRows, "max-rows", 0, "Stop the query once it returned this many rows")
+	queryCmd.Flags().StringVar(&queryPage.Continue, "continue", "", "Resume a query whose results were truncated from the token it printed")
+	queryCmd.Flags().StringVar(&queryMaxMemory, "max-memory", "", "Stop the query if the process uses more than this much memory, e.g. 512Mi")
+	queryCmd.Flags().BoolVar(&queryProfile, "profile", false, "Print the time, CPU, peak memory and API calls the query took")
+	queryCmd.Flags().IntVar(&queryRollout.BatchSize, "batch-size", 0, "Apply the changes of the query in waves of this many changes")
+	queryCmd.Flags().DurationVar(&queryRollout.Pause, "pause", 0, "Wait this long between waves")
+	queryCmd.Flags().BoolVar(&queryRollout.StopOnError, "stop-on-error", false, "Stop at the first change that fails, instead of reporting the failed changes at the end")
+	queryCmd.Flags().StringVar(&queryRollout.HealthQuery, "health-query", "", "Query run between waves, the rollout stops if it returns any resources")
 }
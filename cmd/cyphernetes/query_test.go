@@ -2,9 +2,11 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/avitaltamir/cyphernetes/pkg/parser"
 )
@@ -26,6 +28,7 @@ func TestRunQuery(t *testing.T) {
 		newExecutorErr error
 		executeErr     error
 		expectedOutput string
+		expectedCode   int
 	}{
 		{
 			name: "Successful query",
@@ -39,18 +42,21 @@ func TestRunQuery(t *testing.T) {
 			args:           []string{"INVALID QUERY"},
 			parseQueryErr:  fmt.Errorf("parse error"),
 			expectedOutput: "Error parsing query:  parse error",
+			expectedCode:   exitParseError,
 		},
 		{
 			name:           "New executor error",
 			args:           []string{"MATCH (n:Pod)"},
 			newExecutorErr: fmt.Errorf("executor error"),
 			expectedOutput: "Error creating query executor:  executor error",
+			expectedCode:   exitError,
 		},
 		{
 			name:           "Execute error",
 			args:           []string{"MATCH (n:Pod)"},
 			executeErr:     fmt.Errorf("execution error"),
 			expectedOutput: "Error executing query:  execution error",
+			expectedCode:   exitExecutionError,
 		},
 	}
 
@@ -89,7 +95,7 @@ func TestRunQuery(t *testing.T) {
 			}
 
 			// Replace the Execute method
-			executeMethod = func(qe *parser.QueryExecutor, expr *parser.Expression, namespace string) (parser.QueryResult, error) {
+			executeMethod = func(qe *parser.QueryExecutor, ctx context.Context, expr *parser.Expression, namespace string) (parser.QueryResult, error) {
 				return mockExecutor.Execute(expr, "")
 			}
 
@@ -103,7 +109,7 @@ func TestRunQuery(t *testing.T) {
 			// Execute the command
 			buf := new(bytes.Buffer)
 
-			runQuery(tt.args, buf)
+			code := runQuery(tt.args, buf)
 
 			// Check the output
 			got := strings.TrimSpace(buf.String())
@@ -111,6 +117,184 @@ func TestRunQuery(t *testing.T) {
 			if got != want {
 				t.Errorf("unexpected output:\ngot:\n%s\nwant:\n%s", got, want)
 			}
+			if code != tt.expectedCode {
+				t.Errorf("expected exit code %d, got %d", tt.expectedCode, code)
+			}
 		})
 	}
 }
+
+func TestRunQueryInterrupted(t *testing.T) {
+	originalParseQuery := parseQuery
+	originalNewQueryExecutor := newQueryExecutor
+	originalExecuteMethod := executeMethod
+	defer func() {
+		parseQuery = originalParseQuery
+		newQueryExecutor = originalNewQueryExecutor
+		executeMethod = originalExecuteMethod
+	}()
+
+	parseQuery = func(query string) (*parser.Expression, error) {
+		return &parser.Expression{}, nil
+	}
+	newQueryExecutor = func() (*parser.QueryExecutor, error) {
+		return &parser.QueryExecutor{}, nil
+	}
+	executeMethod = func(qe *parser.QueryExecutor, ctx context.Context, expr *parser.Expression, namespace string) (parser.QueryResult, error) {
+		err := &parser.DiagnosticError{
+			Code:    parser.CodeInterrupted,
+			Details: map[string]interface{}{"changes": "1 change was applied: deleted pods default/web-1"},
+			Err:     context.Canceled,
+		}
+		return parser.QueryResult{Data: map[string]interface{}{"p": []interface{}{"web-1"}}, Truncated: true}, err
+	}
+
+	disableColorJsonOutput = true
+	defer func() { disableColorJsonOutput = false }()
+	buf := new(bytes.Buffer)
+	runQuery([]string{"MATCH (p:Pod) DELETE p"}, buf)
+
+	want := `{
+  "p": [
+    "web-1"
+  ]
+}
+... results truncated
+Error executing query:  [CYP-0080] query interrupted, 1 change was applied: deleted pods default/web-1`
+	if got := strings.TrimSpace(buf.String()); got != want {
+		t.Errorf("unexpected output:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRunQueryPage(t *testing.T) {
+	originalParseQuery := parseQuery
+	originalNewQueryExecutor := newQueryExecutor
+	originalExecutePage := executePage
+	defer func() {
+		parseQuery = originalParseQuery
+		newQueryExecutor = originalNewQueryExecutor
+		executePage = originalExecutePage
+		queryPage = parser.PageOptions{}
+		queryTimeout = 0
+	}()
+
+	parseQuery = func(query string) (*parser.Expression, error) {
+		return &parser.Expression{}, nil
+	}
+	newQueryExecutor = func() (*parser.QueryExecutor, error) {
+		return &parser.QueryExecutor{}, nil
+	}
+	var options parser.PageOptions
+	var deadline bool
+	executePage = func(qe *parser.QueryExecutor, ctx context.Context, expr *parser.Expression, namespace string, o parser.PageOptions) (parser.QueryResult, error) {
+		options = o
+		_, deadline = ctx.Deadline()
+		return parser.QueryResult{Data: map[string]interface{}{"p": []interface{}{"web-1"}}, Truncated: true, Continue: "token-2"}, nil
+	}
+
+	disableColorJsonOutput = true
+	defer func() { disableColorJsonOutput = false }()
+	queryPage = parser.PageOptions{MaxRows: 1, Continue: "token-1"}
+	queryTimeout = time.Minute
+	buf := new(bytes.Buffer)
+	runQuery([]string{"MATCH (p:Pod) RETURN p"}, buf)
+
+	if options != queryPage || !deadline {
+		t.Errorf("expected the query to run with %+v and a deadline, got %+v, %v", queryPage, options, deadline)
+	}
+	want := `{
+  "p": [
+    "web-1"
+  ]
+}
+... results truncated, rerun the query with --continue token-2 for the next rows`
+	if got := strings.TrimSpace(buf.String()); got != want {
+		t.Errorf("unexpected output:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRunQueryExplainFormat(t *testing.T) {
+	originalParseQuery := parseQuery
+	originalNewQueryExecutor := newQueryExecutor
+	originalExecuteMethod := executeMethod
+	defer func() {
+		parseQuery = originalParseQuery
+		newQueryExecutor = originalNewQueryExecutor
+		executeMethod = originalExecuteMethod
+		explainFormat = "json"
+	}()
+
+	parseQuery = func(query string) (*parser.Expression, error) {
+		return &parser.Expression{Explain: true}, nil
+	}
+	newQueryExecutor = func() (*parser.QueryExecutor, error) {
+		return &parser.QueryExecutor{}, nil
+	}
+	plan := &parser.QueryPlan{
+		Nodes: []parser.NodePlan{{Node: "p", Kind: "Pod", APICalls: []string{"LIST v1/pods in namespace default"}}},
+		Cost:  parser.PlanCost{APICalls: 1},
+	}
+	executeMethod = func(qe *parser.QueryExecutor, ctx context.Context, expr *parser.Expression, namespace string) (parser.QueryResult, error) {
+		return parser.QueryResult{Data: map[string]interface{}{"plan": plan}}, nil
+	}
+
+	explainFormat = "tree"
+	buf := new(bytes.Buffer)
+	runQuery([]string{"EXPLAIN MATCH (p:Pod) RETURN p"}, buf)
+	if buf.String() != plan.Tree() || !strings.HasPrefix(buf.String(), "Query (1 API call") {
+		t.Errorf("expected the plan as a tree, got:\n%s", buf.String())
+	}
+
+	explainFormat = "dot"
+	buf.Reset()
+	runQuery([]string{"EXPLAIN MATCH (p:Pod) RETURN p"}, buf)
+	if !strings.HasPrefix(buf.String(), "digraph plan {") {
+		t.Errorf("expected the plan as a DOT graph, got:\n%s", buf.String())
+	}
+
+	explainFormat = "svg"
+	buf.Reset()
+	runQuery([]string{"EXPLAIN MATCH (p:Pod) RETURN p"}, buf)
+	if !strings.Contains(buf.String(), `unknown plan format "svg"`) {
+		t.Errorf("expected an unknown format to be rejected, got:\n%s", buf.String())
+	}
+}
+
+func TestNewRollout(t *testing.T) {
+	defer func() { queryRollout = parser.Rollout{} }()
+
+	queryRollout = parser.Rollout{Pause: time.Second}
+	if _, err := newRollout(); err == nil {
+		t.Errorf("expected --pause without --batch-size to fail")
+	}
+
+	queryRollout = parser.Rollout{BatchSize: 10, HealthQuery: `MATCH (d:Deployment) DELETE d`}
+	if _, err := newRollout(); parser.DiagnosticCodeOf(err) != parser.CodeInvalidHealthQuery {
+		t.Errorf("expected a health query that deletes to fail, got %v", err)
+	}
+
+	queryRollout = parser.Rollout{BatchSize: 10, Pause: 30 * time.Second, StopOnError: true}
+	rollout, err := newRollout()
+	if err != nil || rollout == nil || rollout.BatchSize != 10 || rollout.Pause != 30*time.Second || !rollout.StopOnError {
+		t.Errorf("unexpected rollout %+v, error %v", rollout, err)
+	}
+
+	queryRollout = parser.Rollout{}
+	if rollout, err := newRollout(); rollout != nil || err != nil {
+		t.Errorf("expected no rollout without --batch-size, got %+v, %v", rollout, err)
+	}
+}
+
+func TestParseQueryParams(t *testing.T) {
+	parameters, err := parseQueryParams([]string{"app=web", "$replicas=3", "ready=true", `name="3"`, "tier="})
+	if err != nil {
+		t.Fatalf("parseQueryParams() error = %v", err)
+	}
+	expected := map[string]interface{}{"app": "web", "replicas": float64(3), "ready": true, "name": "3", "tier": ""}
+	if fmt.Sprint(parameters) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, parameters)
+	}
+	if _, err := parseQueryParams([]string{"app"}); err == nil {
+		t.Errorf("expected a parameter without a value to fail")
+	}
+}
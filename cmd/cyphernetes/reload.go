@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v2"
+)
+
+// The web server's configuration file, given with --config, holds the settings that can change while the server
+// runs: the admin groups, the sizes of the query pool and the deadlines of queries, the token file and OpenID Connect settings, the relationship
+// packs extending the relationships queries know about, the audit policies served to dashboards, the chain of
+// plugins authorizing queries, the sinks publishing the events of watch queries, and whether the server is
+// read-only. Settings the file leaves out keep the values of the flags. The server loads the file again on SIGHUP,
+// and whenever the file or one of the files it names changes. A file that fails to load leaves the running
+// configuration as it was. Requests and watches already running aren't interrupted, later requests get the new
+// configuration.
+
+// serverConfigFile is the configuration file of the web server, if any
+var serverConfigFile string
+
+// configPollInterval is how often the configuration files are checked for changes
+var configPollInterval = 5 * time.Second
+
+// serverConfigMutex guards the settings a reload changes, apiAuthenticators, apiAuthorizers, adminGroups,
+// servedPolicies and webQueryTimeout
+var serverConfigMutex sync.RWMutex
+
+// webQueryTimeout is how long queries of the API may run, 0 for no limit
+var webQueryTimeout time.Duration
+
+// servedPolicies are the audit policies of the configuration, whose rules reports are run by
+var servedPolicies []*auditPolicy
+
+// errUnknownRule is returned for a report without a query of a rule no served policy has
+var errUnknownRule = errors.New("no policy of the server has this rule, the report needs a query")
+
+type serverConfig struct {
+	AdminGroups  []string `yaml:"adminGroups"`
+	QueryWorkers int      `yaml:"queryWorkers"`
+	QueryQueue   int      `yaml:"queryQueue"`
+	// QueryTimeout is how long queries may run, and ListTimeout and ListTimeouts the deadlines of their list calls,
+	// by default and by API group or resource
+	QueryTimeout  time.Duration            `yaml:"queryTimeout"`
+	ListTimeout   time.Duration            `yaml:"listTimeout"`
+	ListTimeouts  map[string]time.Duration `yaml:"listTimeouts"`
+	TokenFile     string                   `yaml:"tokenFile"`
+	OIDC          *oidcConfig              `yaml:"oidc"`
+	Relationships []string                 `yaml:"relationships"`
+	Policies      []string                 `yaml:"policies"`
+	// Authorization is the chain of plugins authorizing queries, in order
+	Authorization []authorizationConfig `yaml:"authorization"`
+	// Sinks publish the events of watch queries to message buses
+	Sinks []sinkConfig `yaml:"sinks"`
+	// ReadOnly rejects queries that would change resources, nil keeps the value of --read-only
+	ReadOnly *bool `yaml:"readOnly"`
+}
+
+type oidcConfig struct {
+	IssuerURL     string            `yaml:"issuerURL"`
+	ClientID      string            `yaml:"clientID"`
+	UsernameClaim string            `yaml:"usernameClaim"`
+	GroupsClaim   string            `yaml:"groupsClaim"`
+	GroupsPrefix  string            `yaml:"groupsPrefix"`
+	GroupMap      map[string]string `yaml:"groupMap"`
+}
+
+// relationshipPack is a file of custom relationships, e.g. those of the custom resources of an operator
+type relationshipPack struct {
+	Relationships []packRelationship `yaml:"relationships"`
+}
+
+// packRelationship relates the resources of kindA to those of kindB, the relationship pointing from kindB to kindA
+type packRelationship struct {
+	KindA    string          `yaml:"kindA"`
+	KindB    string          `yaml:"kindB"`
+	Type     string          `yaml:"type"`
+	MatchAny bool            `yaml:"matchAny"`
+	Criteria []packCriterion `yaml:"criteria"`
+}
+
+type packCriterion struct {
+	FieldA string `yaml:"fieldA"`
+	FieldB string `yaml:"fieldB"`
+	// Comparison is ExactMatch, the default, or ContainsAll for selectors
+	Comparison string `yaml:"comparison"`
+}
+
+// serverSettings are the settings of a running server, from its flags and configuration file
+type serverSettings struct {
+	auth          webAuthOptions
+	adminGroups   []string
+	queryWorkers  int
+	queryQueue    int
+	queryTimeout  time.Duration
+	listTimeout   time.Duration
+	listTimeouts  map[string]time.Duration
+	relationships []parser.RelationshipRule
+	policies      []*auditPolicy
+	authorizers   []*authorizationPlugin
+	sinks         []*querySink
+	readOnly      bool
+	// files are the files the settings were read from, watched for changes, and versions their versions when read
+	files    []string
+	versions []string
+}
+
+// loadServerSettings reads the configuration file over the settings of the flags
+func loadServerSettings(filename string, flags serverSettings) (*serverSettings, error) {
+	settings := flags
+	settings.files = []string{filename}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	config := &serverConfig{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", filename, err)
+	}
+
+	if config.AdminGroups != nil {
+		settings.adminGroups = config.AdminGroups
+	}
+	if config.QueryWorkers > 0 {
+		settings.queryWorkers = config.QueryWorkers
+	}
+	if config.QueryQueue > 0 {
+		settings.queryQueue = config.QueryQueue
+	}
+	if config.QueryTimeout > 0 {
+		settings.queryTimeout = config.QueryTimeout
+	}
+	if config.ListTimeout > 0 {
+		settings.listTimeout = config.ListTimeout
+	}
+	if config.ListTimeouts != nil {
+		settings.listTimeouts = config.ListTimeouts
+	}
+	if config.ReadOnly != nil {
+		settings.readOnly = *config.ReadOnly
+	}
+	if config.TokenFile != "" {
+		settings.auth.tokenFile = config.TokenFile
+	}
+	if oidc := config.OIDC; oidc != nil {
+		for _, setting := range []struct{ value, field *string }{
+			{&oidc.IssuerURL, &settings.auth.oidcIssuerURL},
+			{&oidc.ClientID, &settings.auth.oidcClientID},
+			{&oidc.UsernameClaim, &settings.auth.oidcUsernameClaim},
+			{&oidc.GroupsClaim, &settings.auth.oidcGroupsClaim},
+			{&oidc.GroupsPrefix, &settings.auth.oidcGroupsPrefix},
+		} {
+			if *setting.value != "" {
+				*setting.field = *setting.value
+			}
+		}
+		if oidc.GroupMap != nil {
+			settings.auth.oidcGroupMap = oidc.GroupMap
+		}
+	}
+	if settings.auth.tokenFile != "" {
+		settings.files = append(settings.files, settings.auth.tokenFile)
+	}
+
+	settings.relationships = nil
+	for _, file := range config.Relationships {
+		rules, err := loadRelationshipPack(file)
+		if err != nil {
+			return nil, fmt.Errorf("error loading relationship pack %s: %w", file, err)
+		}
+		settings.relationships = append(settings.relationships, rules...)
+		settings.files = append(settings.files, file)
+	}
+	settings.policies = nil
+	for _, file := range config.Policies {
+		policy, err := loadAuditPolicy(file)
+		if err != nil {
+			return nil, fmt.Errorf("error loading policy %s: %w", file, err)
+		}
+		policy.Name = auditPolicyName(policy, file)
+		settings.policies = append(settings.policies, policy)
+		settings.files = append(settings.files, file)
+	}
+	settings.authorizers, err = newAuthorizationPlugins(config.Authorization)
+	if err != nil {
+		return nil, err
+	}
+	settings.sinks, err = newQuerySinks(config.Sinks)
+	if err != nil {
+		return nil, err
+	}
+	settings.versions = fileVersions(settings.files)
+	return &settings, nil
+}
+
+func loadRelationshipPack(filename string) ([]parser.RelationshipRule, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	pack := &relationshipPack{}
+	if err := yaml.UnmarshalStrict(data, pack); err != nil {
+		return nil, err
+	}
+	rules := []parser.RelationshipRule{}
+	for _, relationship := range pack.Relationships {
+		rule := parser.RelationshipRule{
+			KindA:        relationship.KindA,
+			KindB:        relationship.KindB,
+			Relationship: parser.RelationshipType(relationship.Type),
+			MatchAny:     relationship.MatchAny,
+		}
+		for _, criterion := range relationship.Criteria {
+			comparison := parser.ComparisonType(criterion.Comparison)
+			if comparison == "" {
+				comparison = parser.ExactMatch
+			}
+			rule.MatchCriteria = append(rule.MatchCriteria, parser.MatchCriterion{
+				FieldA:         criterion.FieldA,
+				FieldB:         criterion.FieldB,
+				ComparisonType: comparison,
+			})
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// applyServerSettings makes the settings those of the running server
+func applyServerSettings(settings *serverSettings) error {
+	authenticators, err := newAuthenticators(settings.auth)
+	if err != nil {
+		return err
+	}
+	if err := parser.SetCustomRelationships(settings.relationships); err != nil {
+		return fmt.Errorf("invalid custom relationships: %w", err)
+	}
+	parser.SetReadOnly(settings.readOnly)
+	parser.SetListTimeouts(settings.listTimeout, settings.listTimeouts)
+	serverConfigMutex.Lock()
+	apiAuthenticators = authenticators
+	apiAuthorizers = settings.authorizers
+	adminGroups = settings.adminGroups
+	servedPolicies = settings.policies
+	webQueryTimeout = settings.queryTimeout
+	serverConfigMutex.Unlock()
+	scheduler.resize(settings.queryWorkers, settings.queryQueue)
+	serverSinks.update(settings.sinks)
+	return nil
+}
+
+// watchServerConfig loads the configuration file again on SIGHUP and when one of its files changes, until ctx is
+// done
+func watchServerConfig(ctx context.Context, filename string, flags serverSettings, settings *serverSettings) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	versions := settings.versions
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+		case <-ticker.C:
+			if slices.Equal(fileVersions(settings.files), versions) {
+				continue
+			}
+		}
+		reloaded, err := loadServerSettings(filename, flags)
+		if err == nil {
+			err = applyServerSettings(reloaded)
+		}
+		if err != nil {
+			parser.Logger().Error("Error reloading the configuration, keeping the previous one", "file", filename, "error", err)
+			// The files are only checked again once they change again
+			versions = fileVersions(settings.files)
+			continue
+		}
+		settings = reloaded
+		versions = settings.versions
+		parser.Logger().Info("Configuration reloaded", "file", filename, "relationships", len(settings.relationships), "policies", len(settings.policies), "sinks", len(settings.sinks))
+	}
+}
+
+// fileVersions identifies the contents of files by their modification times and sizes
+func fileVersions(files []string) []string {
+	versions := make([]string, len(files))
+	for i, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			versions[i] = fmt.Sprintf("%d/%d", info.ModTime().UnixNano(), info.Size())
+		}
+	}
+	return versions
+}
+
+// policyRule finds a rule of the served policies by name
+func policyRule(name string) (auditRule, bool) {
+	serverConfigMutex.RLock()
+	defer serverConfigMutex.RUnlock()
+	for _, policy := range servedPolicies {
+		for _, rule := range policy.Rules {
+			if rule.Name == name {
+				return rule, true
+			}
+		}
+	}
+	return auditRule{}, false
+}
+
+// handleListPolicies lists the audit policies of the configuration, whose rules reports can be run by name
+func handleListPolicies(c *gin.Context) {
+	serverConfigMutex.RLock()
+	defer serverConfigMutex.RUnlock()
+	type policy struct {
+		Name  string      `json:"name"`
+		Rules []auditRule `json:"rules"`
+	}
+	policies := []policy{}
+	for _, p := range servedPolicies {
+		policies = append(policies, policy{Name: p.Name, Rules: p.Rules})
+	}
+	c.JSON(http.StatusOK, policies)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
+	"github.com/gin-gonic/gin"
+)
+
+func TestReloadServerConfig(t *testing.T) {
+	originalAuthenticators, originalAdminGroups, originalPolicies, originalScheduler, originalInterval := apiAuthenticators, adminGroups, servedPolicies, scheduler, configPollInterval
+	defer func() {
+		apiAuthenticators, adminGroups, servedPolicies, scheduler, configPollInterval = originalAuthenticators, originalAdminGroups, originalPolicies, originalScheduler, originalInterval
+		parser.SetCustomRelationships(nil)
+		parser.SetReadOnly(false)
+		parser.SetListTimeouts(0, nil)
+		webQueryTimeout = 0
+	}()
+	scheduler = newQueryScheduler(4, 100)
+	configPollInterval = 10 * time.Millisecond
+
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	tokens := write("tokens.csv", "alice-token,alice,1,platform\n")
+	pack := write("cert-manager.yaml", `relationships:
+  - kindA: certificates
+    kindB: secrets
+    type: SECRET_STORES_CERTIFICATE
+    criteria:
+      - fieldA: $.spec.secretName
+        fieldB: $.metadata.name
+`)
+	policy := write("baseline.yaml", `rules:
+  - name: no-latest-tag
+    query: MATCH (p:Pod) WHERE p.spec.containers[0].image =~ ".*:latest" RETURN p
+`)
+	config := write("config.yaml", `adminGroups: [platform]
+queryWorkers: 2
+tokenFile: `+tokens+`
+relationships: [`+pack+`]
+policies: [`+policy+`]
+readOnly: true
+queryTimeout: 30s
+listTimeouts:
+  metrics.k8s.io: 5s
+`)
+
+	flags := serverSettings{queryWorkers: 4, queryQueue: 100}
+	settings, err := loadServerSettings(config, flags)
+	if err != nil {
+		t.Fatalf("loadServerSettings() error = %v", err)
+	}
+	if err := applyServerSettings(settings); err != nil {
+		t.Fatalf("applyServerSettings() error = %v", err)
+	}
+	if rules := parser.CustomRelationships(); len(rules) != 1 || rules[0].Relationship != "SECRET_STORES_CERTIFICATE" {
+		t.Errorf("expected the relationship of the pack, got %+v", rules)
+	}
+	if scheduler.workers != 2 || scheduler.maxQueue != 100 {
+		t.Errorf("expected 2 workers and the queue of the flags, got %d and %d", scheduler.workers, scheduler.maxQueue)
+	}
+	if webQueryTimeout != 30*time.Second || parser.ListTimeouts["metrics.k8s.io"] != 5*time.Second {
+		t.Errorf("expected the timeouts of the configuration, got %s and %v", webQueryTimeout, parser.ListTimeouts)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	setupAPIRoutes(router)
+	if w := apiRequest(router, "", http.MethodGet, "/api/policies", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected the token file to be used, got %d", w.Code)
+	}
+	w := apiRequest(router, "alice-token", http.MethodGet, "/api/policies", "")
+	var policies []struct {
+		Name  string      `json:"name"`
+		Rules []auditRule `json:"rules"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &policies)
+	if len(policies) != 1 || policies[0].Name != "baseline" || policies[0].Rules[0].Name != "no-latest-tag" {
+		t.Errorf("expected the baseline policy, got %s", w.Body.String())
+	}
+	if w := apiRequest(router, "alice-token", http.MethodPost, "/api/query", `{"rule": "unknown"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected a report of an unknown rule without a query to be rejected, got %d", w.Code)
+	}
+	if w := apiRequest(router, "alice-token", http.MethodPost, "/api/query", `{"query": "MATCH (p:Pod) DELETE p"}`); w.Code != http.StatusForbidden {
+		t.Errorf("expected the server to be read-only, got %d", w.Code)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		watchServerConfig(ctx, config, flags, settings)
+		close(stopped)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+	waitFor := func(condition func() bool) bool {
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			if condition() {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Rotating the tokens is picked up without a restart
+	write("tokens.csv", "bob-token,bob,2,platform\n")
+	if !waitFor(func() bool {
+		return apiRequest(router, "bob-token", http.MethodGet, "/api/policies", "").Code == http.StatusOK
+	}) {
+		t.Fatal("expected the new token file to be loaded")
+	}
+
+	// An invalid configuration keeps the running one
+	write("cert-manager.yaml", "relationships:\n  - kindA: certificates\n")
+	time.Sleep(50 * time.Millisecond)
+	if rules := parser.CustomRelationships(); len(rules) != 1 {
+		t.Errorf("expected the previous relationships to be kept, got %+v", rules)
+	}
+	if apiRequest(router, "bob-token", http.MethodGet, "/api/policies", "").Code != http.StatusOK {
+		t.Error("expected the previous authentication to be kept")
+	}
+}
+
+func TestWebFailsOnBrokenConfig(t *testing.T) {
+	originalConfigFile := serverConfigFile
+	defer func() { serverConfigFile = originalConfigFile }()
+	serverConfigFile = filepath.Join(t.TempDir(), "cyphernetes.yaml")
+	if err := os.WriteFile(serverConfigFile, []byte("query_workers: [\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WebCmd.RunE(WebCmd, nil); err == nil {
+		t.Error("expected the server not to start with a broken configuration")
+	}
+}
@@ -4,6 +4,8 @@ Copyright © 2023 Avital Tamir <avital.osog@gmail.com>
 package main
 
 import (
+	"errors"
+	"fmt"
 	"os"
 
 	"github.com/avitaltamir/cyphernetes/pkg/parser"
@@ -15,11 +17,69 @@ var rootCmd = &cobra.Command{
 	Use:   "cyphernetes",
 	Short: "Cyphernetes is a tool for querying Kubernetes resources",
 	Long:  `Cyphernetes allows you to query Kubernetes resources using a Cypher-like query language.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := parser.ValidateLogFlags(); err != nil {
+			return err
+		}
+		if err := setListTimeouts(); err != nil {
+			return err
+		}
+		if err := openAuditLog(); err != nil {
+			return err
+		}
+		// The errors commands return from here on aren't about their usage
+		cmd.SilenceUsage = true
+		return nil
+	},
+}
+
+// errNoQueryExecutor is returned by the commands that query the cluster when there's no QueryExecutor to query it
+// with, GetQueryExecutorInstance having logged why
+var errNoQueryExecutor = errors.New("error creating query executor")
+
+// auditLogFile is the --audit-log flag, the file the changes of queries are recorded in
+var auditLogFile string
+
+// openAuditLog opens the audit log of --audit-log, if given, for the queries of the command
+func openAuditLog() error {
+	if auditLogFile == "" || parser.Audit != nil {
+		return nil
+	}
+	audit, err := parser.OpenAuditLog(auditLogFile)
+	if err != nil {
+		return fmt.Errorf("error opening audit log >> %w", err)
+	}
+	parser.Audit = audit
+	return nil
+}
+
+// listTimeouts is the --list-timeout flag, the deadlines of the list calls of queries
+var listTimeouts []string
+
+// setListTimeouts sets the deadlines of --list-timeout
+func setListTimeouts() error {
+	timeout, timeouts, err := parser.ParseListTimeouts(listTimeouts)
+	if err != nil {
+		return err
+	}
+	parser.SetListTimeouts(timeout, timeouts)
+	return nil
+}
+
+// initResourceSpecsOrWarn loads the OpenAPI specs of the cluster's resources, warning rather than failing when they're
+// unavailable, as commands still run without them
+func initResourceSpecsOrWarn() {
+	if err := parser.InitResourceSpecs(); err != nil {
+		parser.Logger().Warn("Resource specs unavailable, completion and relationships may be limited", "code", parser.DiagnosticCodeOf(err), "error", err)
+	}
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
+	if name, ok := pluginCommandName(os.Args[0]); ok {
+		setupPlugin(rootCmd, name)
+	}
 	err := rootCmd.Execute()
 	if err != nil {
 		os.Exit(1)
@@ -45,8 +105,34 @@ func TestExecute(args []string) error {
 
 func init() {
 	rootCmd.PersistentFlags().StringVarP(&parser.Namespace, "namespace", "n", "default", "The namespace to query against")
-	rootCmd.PersistentFlags().StringVarP(&parser.LogLevel, "loglevel", "l", "info", "The log level to use (debug, info, warn, error, fatal, panic)")
+	rootCmd.PersistentFlags().StringVarP(&parser.LogLevel, "log-level", "l", "info", "The log level to use (debug, info, warn, error)")
+	rootCmd.PersistentFlags().StringVar(&parser.LogLevel, "loglevel", "info", "The log level to use (debug, info, warn, error)")
+	rootCmd.PersistentFlags().MarkDeprecated("loglevel", "use --log-level instead")
+	rootCmd.PersistentFlags().StringVar(&parser.LogFormat, "log-format", "text", "The format of log records (text, json)")
 	rootCmd.PersistentFlags().BoolVarP(&parser.AllNamespaces, "all-namespaces", "A", false, "Query all namespaces")
+	rootCmd.PersistentFlags().IntVar(&parser.APIWorkers, "api-workers", 4, "How many Kubernetes API calls queries make at once, e.g. to list the node patterns of a MATCH clause together")
+	rootCmd.PersistentFlags().Float32Var(&parser.QPS, "api-qps", parser.QPS, "How many Kubernetes API calls a second queries make on average, 0 for no limit")
+	rootCmd.PersistentFlags().IntVar(&parser.Burst, "api-burst", parser.Burst, "How many Kubernetes API calls queries may make at once above --api-qps")
+	rootCmd.PersistentFlags().BoolVar(&parser.AdaptiveThrottling, "adaptive-throttling", parser.AdaptiveThrottling, "Slow the API calls of queries down while the API server rejects them with 429 Too Many Requests")
+	rootCmd.PersistentFlags().BoolVar(&parser.Protobuf, "protobuf", parser.Protobuf, "List the resources of built-in kinds as protobuf rather than JSON")
+	rootCmd.PersistentFlags().DurationVar(&parser.CacheTTL, "cache-ttl", 0, "Reuse the resources a query listed in the next queries for this long, e.g. 30s in a shell session (0 to list them every time)")
+	rootCmd.PersistentFlags().StringVar(&parser.KubeContext, "context", "", "The kubeconfig context to use")
+	rootCmd.PersistentFlags().StringVar(&parser.Kubeconfig, "kubeconfig", "", "Path to the kubeconfig file to use (default: $KUBECONFIG or ~/.kube/config)")
+	rootCmd.PersistentFlags().StringVar(&parser.DiscoveryCacheDir, "discovery-cache-dir", "", "Persist API discovery results in this directory (e.g. ~/.kube/cache) instead of only in memory")
+	rootCmd.PersistentFlags().BoolVar(&returnRows, "rows", false, "Print the results of RETURN as rows, one per combination of the resources the query matched together, with a column per returned item")
+	rootCmd.PersistentFlags().BoolVar(&parser.ExplainFields, "explain-fields", false, "Annotate returned values with where they came from (live API, cache, computed)")
+	rootCmd.PersistentFlags().BoolVar(&parser.MatchAllGVRs, "match-all-gvrs", false, "When a kind matches several API groups, return resources from all of them (tagged with _gvr) instead of those of the core group, or an error")
+	rootCmd.PersistentFlags().StringSliceVar(&parser.IndexedFields, "index-fields", parser.IndexedFields, "Fields WHERE equality predicates look up in an index of the listed resources (empty to disable)")
+	rootCmd.PersistentFlags().StringVar(&parser.PatchType, "patch-type", parser.PatchType, "The patch type of SET clauses that don't name one (json, merge, strategic)")
+	rootCmd.PersistentFlags().BoolVar(&parser.ServerSideApply, "server-side", false, "Make the changes of CREATE, MERGE and SET with server-side apply, so queries own the fields they set")
+	rootCmd.PersistentFlags().StringVar(&parser.FieldManager, "field-manager", parser.FieldManager, "The field manager of the changes queries make")
+	rootCmd.PersistentFlags().StringVar(&auditLogFile, "audit-log", "", "Record every change queries make, who made it and with which query, in this file")
+	rootCmd.PersistentFlags().BoolVar(&parser.AuditEvents, "audit-events", false, "Record every change queries make as an Event of the changed object")
+	rootCmd.PersistentFlags().StringSliceVar(&listTimeouts, "list-timeout", nil, "Fail list calls that take longer than this, e.g. 30s, or than the deadline of their API group or resource, e.g. metrics.k8s.io=5s")
+	rootCmd.PersistentFlags().BoolVar(&parser.PreflightAccess, "preflight", false, "Check that you may make every API request a query plans before running it, and list those you may not")
+	rootCmd.PersistentFlags().BoolVar(&parser.ReadOnly, "read-only", false, "Reject queries that would create, change or delete resources (CREATE, SET, DELETE, MERGE and rollout operations)")
+	rootCmd.PersistentFlags().IntVar(&parser.CompatVersion, "compat", 0, "The language version queries without a CYPHERNETES pragma are checked against (default: the latest)")
+	rootCmd.PersistentFlags().BoolVar(&parser.StrictFields, "strict", false, "Fail queries referring to fields the OpenAPI schema of their kind doesn't have, instead of warning about them")
 
 	// Add the web command
 	rootCmd.AddCommand(WebCmd)
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
+	"github.com/spf13/cobra"
+)
+
+// runFiles is the -f flag, the files of queries to run, - being stdin
+var runFiles []string
+
+// runCombined is the --combined flag, printing the results of all the statements as one JSON array
+var runCombined bool
+
+// stdin is where run reads queries from without -f, or with -f -
+var stdin io.Reader = os.Stdin
+
+var runCmd = &cobra.Command{
+	Use:   "run [-f file]...",
+	Short: "Run the queries of files or stdin",
+	Long: `Use the 'run' subcommand to run the queries of a file, or those piped to stdin. Queries are separated by
+semicolons, and run in order like the query command, stopping at the first one that fails.`,
+	Example: `  cyphernetes run -f cleanup.cyp
+  cat report.cyp | cyphernetes run --combined`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		input, err := readQueries(runFiles)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error reading queries: ", err)
+			os.Exit(exitError)
+		}
+		executor = parser.GetQueryExecutorInstance()
+		if executor == nil {
+			os.Exit(exitError)
+		}
+		parser.CleanOutput = true
+		initResourceSpecsOrWarn()
+		if code := runStatements(splitStatements(input), os.Stdout); code != exitOK {
+			os.Exit(code)
+		}
+	},
+}
+
+// readQueries reads the files of -f, in order, or stdin if none was given. Stdin has to be piped: a terminal would
+// wait for queries to be typed, which the shell is for.
+func readQueries(files []string) (string, error) {
+	if len(files) == 0 {
+		if f, ok := stdin.(*os.File); ok {
+			if info, err := f.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+				return "", fmt.Errorf("no queries given, pass a file with -f or pipe them to stdin")
+			}
+		}
+		files = []string{"-"}
+	}
+	var sb strings.Builder
+	for _, file := range files {
+		var data []byte
+		var err error
+		if file == "-" {
+			data, err = io.ReadAll(stdin)
+		} else {
+			data, err = os.ReadFile(file)
+		}
+		if err != nil {
+			return "", err
+		}
+		sb.Write(data)
+		// A file ending in a query without a semicolon doesn't run into the next one
+		sb.WriteString(";\n")
+	}
+	return sb.String(), nil
+}
+
+// splitStatements splits queries at the semicolons ending them, except those within strings and comments, leaving
+// out empty ones
+func splitStatements(input string) []string {
+	input = parser.StripComments(input)
+	var statements []string
+	var inString bool
+	start := 0
+	add := func(end int) {
+		if statement := strings.TrimSpace(input[start:end]); statement != "" {
+			statements = append(statements, statement)
+		}
+		start = end + 1
+	}
+	for i := 0; i < len(input); i++ {
+		switch input[i] {
+		case '\\':
+			if inString {
+				i++
+			}
+		case '"':
+			inString = !inString
+		case ';':
+			if !inString {
+				add(i)
+			}
+		}
+	}
+	if start < len(input) {
+		add(len(input))
+	}
+	return statements
+}
+
+// runStatements runs the statements in order, printing the results of each after the other, or all of them as a JSON
+// array with --combined, in the format of -o. It stops at the first statement that fails, and returns its exit code. Statements that
+// return no results with --fail-on-empty don't stop the others, but still make the exit code exitEmpty.
+func runStatements(statements []string, w io.Writer) int {
+	if len(statements) == 0 {
+		return printError(w, exitParseError, "Error parsing query: ", fmt.Errorf("no queries to run"), "")
+	}
+	printer, err := newResultsPrinter(outputFormat)
+	if err != nil {
+		return printError(w, exitError, "Error:", err, "")
+	}
+	if !runCombined {
+		code := exitOK
+		for _, statement := range statements {
+			switch statementCode := runStatement(statement, w, printer); statementCode {
+			case exitOK:
+			case exitEmpty:
+				code = exitEmpty
+			default:
+				return statementCode
+			}
+		}
+		return code
+	}
+
+	combined := make([]interface{}, 0, len(statements))
+	collect := func(data interface{}, w io.Writer) {
+		combined = append(combined, data)
+	}
+	code := exitOK
+	for _, statement := range statements {
+		before := len(combined)
+		statementCode := runStatement(statement, w, collect)
+		if statementCode != exitOK && statementCode != exitEmpty {
+			code = statementCode
+			break
+		}
+		if statementCode == exitEmpty {
+			code = exitEmpty
+		}
+		// Statements without results, e.g. EXPLAIN printed as a tree, keep their place in the array
+		if len(combined) == before {
+			combined = append(combined, map[string]interface{}{})
+		}
+	}
+	printer(combined, w)
+	return code
+}
+
+func init() {
+	rootCmd.AddCommand(runCmd)
+	runCmd.Flags().StringArrayVarP(&runFiles, "file", "f", nil, "A file of queries to run, - for stdin (default: stdin)")
+	runCmd.Flags().BoolVar(&runCombined, "combined", false, "Print the results of all the queries as one JSON array, in order")
+	runCmd.Flags().BoolVarP(&disableColorJsonOutput, "raw-output", "r", false, "Disable colorized JSON output")
+	runCmd.Flags().StringVarP(&outputFormat, "output", "o", "json", "Print the results as json, a table, csv, tsv, or with go-template=..., go-template-file=..., jsonpath=... or jsonpath-file=...")
+	runCmd.Flags().BoolVar(&tableWide, "wide", false, "Print the values of -o table in full, rather than truncating them to fit the terminal")
+	runCmd.Flags().BoolVar(&noColor, "no-color", false, "Print the results without colors, as the NO_COLOR environment variable does")
+	runCmd.Flags().StringArrayVar(&queryParams, "param", nil, "Give a $parameter of the queries a value, as name=value")
+	runCmd.Flags().DurationVar(&queryTimeout, "timeout", 0, "Stop each query after this long, printing the results returned until then")
+	runCmd.Flags().StringVar(&errorFormat, "error-format", "text", "Print errors as text, or as JSON on stderr")
+	runCmd.Flags().BoolVar(&failOnEmpty, "fail-on-empty", false, "Exit with code 4 if a query returns no results")
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
+)
+
+func TestSplitStatements(t *testing.T) {
+	input := `MATCH (p:Pod) RETURN p.metadata.name;
+MATCH (d:Deployment {name: "a;b"}) SET d.metadata.annotations.note = "say \"hi;\"" ;
+
+;MATCH (s:Service) RETURN s`
+	expected := []string{
+		"MATCH (p:Pod) RETURN p.metadata.name",
+		`MATCH (d:Deployment {name: "a;b"}) SET d.metadata.annotations.note = "say \"hi;\""`,
+		"MATCH (s:Service) RETURN s",
+	}
+	if got := splitStatements(input); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+
+	// Semicolons within comments don't end queries
+	input = `// Pods first; then services
+MATCH (p:Pod) RETURN p.metadata.name; /* services; all of them */
+MATCH (s:Service) RETURN s`
+	expected = []string{"MATCH (p:Pod) RETURN p.metadata.name", "MATCH (s:Service) RETURN s"}
+	if got := splitStatements(input); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestReadQueries(t *testing.T) {
+	originalStdin := stdin
+	defer func() { stdin = originalStdin }()
+	stdin = strings.NewReader("MATCH (s:Service) RETURN s")
+
+	file := filepath.Join(t.TempDir(), "pods.cyp")
+	if err := os.WriteFile(file, []byte("MATCH (p:Pod) RETURN p"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	input, err := readQueries([]string{file, "-"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"MATCH (p:Pod) RETURN p", "MATCH (s:Service) RETURN s"}
+	if got := splitStatements(input); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected the queries of the file then stdin, got %q", got)
+	}
+
+	if _, err := readQueries([]string{filepath.Join(t.TempDir(), "missing.cyp")}); err == nil {
+		t.Error("expected a missing file to fail")
+	}
+}
+
+func TestRunStatements(t *testing.T) {
+	originalParseQuery := parseQuery
+	originalNewQueryExecutor := newQueryExecutor
+	originalExecuteMethod := executeMethod
+	defer func() {
+		parseQuery = originalParseQuery
+		newQueryExecutor = originalNewQueryExecutor
+		executeMethod = originalExecuteMethod
+		runCombined = false
+		disableColorJsonOutput = false
+	}()
+	var ran []string
+	parseQuery = func(query string) (*parser.Expression, error) {
+		ran = append(ran, query)
+		return parser.ParseQuery(query)
+	}
+	newQueryExecutor = func() (*parser.QueryExecutor, error) {
+		return &parser.QueryExecutor{}, nil
+	}
+	executeMethod = func(qe *parser.QueryExecutor, ctx context.Context, expr *parser.Expression, namespace string) (parser.QueryResult, error) {
+		name := expr.Clauses[0].(*parser.MatchClause).Nodes[0].ResourceProperties.Name
+		return parser.QueryResult{Data: map[string]interface{}{name: []interface{}{"web"}}}, nil
+	}
+	disableColorJsonOutput = true
+
+	buf := new(bytes.Buffer)
+	statements := []string{"MATCH (p:Pod) RETURN p", "MATCH (s:Service) RETURN s"}
+	if code := runStatements(statements, buf); code != exitOK {
+		t.Errorf("expected exit code %d, got %d", exitOK, code)
+	}
+	expected := "{\n  \"p\": [\n    \"web\"\n  ]\n}\n{\n  \"s\": [\n    \"web\"\n  ]\n}\n"
+	if buf.String() != expected {
+		t.Errorf("expected the results of each statement in order, got:\n%s", buf.String())
+	}
+
+	runCombined = true
+	buf.Reset()
+	runStatements(statements, buf)
+	expected = "[\n  {\n    \"p\": [\n      \"web\"\n    ]\n  },\n  {\n    \"s\": [\n      \"web\"\n    ]\n  }\n]\n"
+	if buf.String() != expected {
+		t.Errorf("expected the results as one array, got:\n%s", buf.String())
+	}
+
+	// The statements after one that fails don't run
+	runCombined = false
+	ran = nil
+	buf.Reset()
+	code := runStatements([]string{"MATCH (p:Pod RETURN p", "MATCH (s:Service) RETURN s"}, buf)
+	if code != exitParseError || len(ran) != 1 || !strings.HasPrefix(buf.String(), "Error parsing query: ") {
+		t.Errorf("expected the run to stop at the parse error, got %d after %q:\n%s", code, ran, buf.String())
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+// runbook is a guided troubleshooting procedure: steps run in order unless a branch,
+// prompt answer or next says otherwise, and the runbook ends after its last step
+type runbook struct {
+	Name        string        `yaml:"name"`
+	Description string        `yaml:"description"`
+	Steps       []runbookStep `yaml:"steps"`
+}
+
+// runbookStep prints its message, runs its query and evaluates its branches, then asks its prompt.
+// Steps are referred to by id, or by their number (starting at 1) when they don't have one.
+type runbookStep struct {
+	ID       string          `yaml:"id"`
+	Message  string          `yaml:"message"`
+	Query    string          `yaml:"query"`
+	Branches []runbookBranch `yaml:"branches"`
+	Prompt   string          `yaml:"prompt"`
+	// Options maps the answers to the prompt to the step they lead to. Without options
+	// the prompt waits for Enter before continuing.
+	Options map[string]string `yaml:"options"`
+	Next    string            `yaml:"next"`
+	// End stops the runbook after this step, unless a branch or answer leads elsewhere
+	End bool `yaml:"end"`
+}
+
+// runbookBranch goes to another step when its condition holds for the step's query results
+type runbookBranch struct {
+	If   string `yaml:"if"`
+	Goto string `yaml:"goto"`
+}
+
+// maxRunbookSteps stops runbooks that loop forever
+const maxRunbookSteps = 100
+
+// A condition compares a value of the results to a literal, e.g. "count(p) > 0" or "crashing = 0"
+var conditionRegex = regexp.MustCompile(`^\s*([A-Za-z_][\w.]*(?:\([A-Za-z_]\w*\))?)\s*(==|=|!=|>=|<=|>|<)\s*(.+?)\s*$`)
+
+var executeRunbookQuery = queryRunbookStep
+
+var runbookCmd = &cobra.Command{
+	Use:   "runbook <file>",
+	Short: "Run a guided troubleshooting runbook",
+	Long: `Use the 'runbook' subcommand to walk through a runbook: a YAML file of steps that run queries,
+branch on their results and ask for decisions along the way.`,
+	Example: `  cyphernetes runbook crashloop.yaml`,
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		rb, err := loadRunbook(args[0])
+		if err != nil {
+			return fmt.Errorf("error loading runbook >> %w", err)
+		}
+		executor = parser.GetQueryExecutorInstance()
+		if executor == nil {
+			return errNoQueryExecutor
+		}
+		parser.CleanOutput = true
+		initResourceSpecsOrWarn()
+		return runRunbook(rb, os.Stdin, os.Stdout)
+	},
+}
+
+func loadRunbook(filename string) (*runbook, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return parseRunbook(data)
+}
+
+func parseRunbook(data []byte) (*runbook, error) {
+	rb := &runbook{}
+	if err := yaml.UnmarshalStrict(data, rb); err != nil {
+		return nil, err
+	}
+	if len(rb.Steps) == 0 {
+		return nil, fmt.Errorf("runbook has no steps")
+	}
+
+	ids := map[string]bool{}
+	for i, step := range rb.Steps {
+		if step.ID == "" {
+			continue
+		}
+		if ids[step.ID] {
+			return nil, fmt.Errorf("step %d: duplicate step id %s", i+1, step.ID)
+		}
+		ids[step.ID] = true
+	}
+
+	for i, step := range rb.Steps {
+		name := rb.stepName(i)
+		if step.Message == "" && step.Query == "" && step.Prompt == "" {
+			return nil, fmt.Errorf("step %s: needs a message, query or prompt", name)
+		}
+		if step.Query != "" {
+			if _, err := parser.ParseQuery(step.Query); err != nil {
+				return nil, fmt.Errorf("step %s: error parsing query >> %w", name, err)
+			}
+		} else if len(step.Branches) > 0 {
+			return nil, fmt.Errorf("step %s: branches need a query", name)
+		}
+		if step.Prompt == "" && len(step.Options) > 0 {
+			return nil, fmt.Errorf("step %s: options need a prompt", name)
+		}
+
+		targets := []string{step.Next}
+		for _, branch := range step.Branches {
+			if !conditionRegex.MatchString(branch.If) {
+				return nil, fmt.Errorf("step %s: invalid condition %q", name, branch.If)
+			}
+			if branch.Goto == "" {
+				return nil, fmt.Errorf("step %s: branch %q has no goto", name, branch.If)
+			}
+			targets = append(targets, branch.Goto)
+		}
+		for _, target := range step.Options {
+			targets = append(targets, target)
+		}
+		for _, target := range targets {
+			if _, ok := rb.stepIndex(target); target != "" && !ok {
+				return nil, fmt.Errorf("step %s: unknown step %s", name, target)
+			}
+		}
+	}
+	return rb, nil
+}
+
+// stepName is the step's id, or its number when it has none
+func (rb *runbook) stepName(i int) string {
+	if rb.Steps[i].ID != "" {
+		return rb.Steps[i].ID
+	}
+	return strconv.Itoa(i + 1)
+}
+
+func (rb *runbook) stepIndex(target string) (int, bool) {
+	for i := range rb.Steps {
+		if rb.Steps[i].ID == target {
+			return i, true
+		}
+	}
+	if n, err := strconv.Atoi(target); err == nil && n >= 1 && n <= len(rb.Steps) {
+		return n - 1, true
+	}
+	return 0, false
+}
+
+func runRunbook(rb *runbook, in io.Reader, w io.Writer) error {
+	if rb.Name != "" {
+		fmt.Fprintf(w, "Runbook: %s\n", rb.Name)
+	}
+	if rb.Description != "" {
+		fmt.Fprintln(w, rb.Description)
+	}
+
+	input := bufio.NewReader(in)
+	current := 0
+	for executed := 0; current < len(rb.Steps); executed++ {
+		if executed == maxRunbookSteps {
+			return fmt.Errorf("stopped after %d steps, the runbook seems to loop", maxRunbookSteps)
+		}
+		step := rb.Steps[current]
+		fmt.Fprintf(w, "\n[%s]\n", rb.stepName(current))
+
+		next, err := runRunbookStep(step, input, w)
+		if err != nil {
+			return fmt.Errorf("step %s: %w", rb.stepName(current), err)
+		}
+		if next == "" && step.End {
+			return nil
+		}
+		if next == "" {
+			next = step.Next
+		}
+		if next == "" {
+			current++
+			continue
+		}
+		current, _ = rb.stepIndex(next)
+	}
+	return nil
+}
+
+// runRunbookStep runs a step and returns the step to go to, or "" to follow next
+func runRunbookStep(step runbookStep, input *bufio.Reader, w io.Writer) (string, error) {
+	if step.Message != "" {
+		fmt.Fprintln(w, step.Message)
+	}
+
+	if step.Query != "" {
+		results, err := executeRunbookQuery(step.Query)
+		if err != nil {
+			return "", err
+		}
+		output, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		if string(output) != "{}" {
+			if !disableColorJsonOutput {
+				output = []byte(colorizeJson(string(output)))
+			}
+			fmt.Fprintln(w, string(output))
+		}
+
+		for _, branch := range step.Branches {
+			holds, err := evaluateCondition(branch.If, results)
+			if err != nil {
+				return "", err
+			}
+			if holds {
+				fmt.Fprintf(w, "%s -> %s\n", branch.If, branch.Goto)
+				return branch.Goto, nil
+			}
+		}
+	}
+
+	if step.Prompt == "" {
+		return "", nil
+	}
+	if len(step.Options) == 0 {
+		fmt.Fprintf(w, "%s [Enter to continue] ", step.Prompt)
+		_, err := input.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		return "", nil
+	}
+
+	var answers []string
+	for answer := range step.Options {
+		answers = append(answers, answer)
+	}
+	sort.Strings(answers)
+	for {
+		fmt.Fprintf(w, "%s [%s] ", step.Prompt, strings.Join(answers, "/"))
+		answer, err := input.ReadString('\n')
+		if target, ok := step.Options[strings.TrimSpace(answer)]; ok {
+			return target, nil
+		}
+		if err != nil {
+			if err == io.EOF {
+				return "", fmt.Errorf("no answer to %q", step.Prompt)
+			}
+			return "", err
+		}
+		fmt.Fprintf(w, "Please answer one of: %s\n", strings.Join(answers, ", "))
+	}
+}
+
+// queryRunbookStep runs a step's query, returning its results as plain JSON types
+func queryRunbookStep(query string) (map[string]interface{}, error) {
+	ast, err := parser.ParseQuery(query)
+	if err != nil {
+		recordQuery("runbook", nil, err)
+		return nil, fmt.Errorf("error parsing query >> %w", err)
+	}
+	results, err := parser.GetQueryExecutorInstance().Execute(ast, "")
+	recordQuery("runbook", ast, err)
+	if err != nil {
+		return nil, fmt.Errorf("error executing query >> %w", err)
+	}
+
+	data, err := json.Marshal(results.Data)
+	if err != nil {
+		return nil, err
+	}
+	var normalized map[string]interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
+// evaluateCondition compares a value of the results to a literal. The value is count(x), the number
+// of rows returned for x, or the name of an aggregation (e.g. the alias of a COUNT).
+func evaluateCondition(condition string, results map[string]interface{}) (bool, error) {
+	match := conditionRegex.FindStringSubmatch(condition)
+	if match == nil {
+		return false, fmt.Errorf("invalid condition %q", condition)
+	}
+	name, operator, literal := match[1], match[2], strings.Trim(match[3], `"`)
+
+	var value interface{}
+	if strings.HasPrefix(name, "count(") && strings.HasSuffix(name, ")") {
+		rows, _ := results[strings.TrimSuffix(strings.TrimPrefix(name, "count("), ")")].([]interface{})
+		value = float64(len(rows))
+	} else {
+		aggregate, _ := results["aggregate"].(map[string]interface{})
+		var ok bool
+		if value, ok = aggregate[name]; !ok {
+			return false, fmt.Errorf("condition %q: %s is not an aggregation of the query", condition, name)
+		}
+	}
+
+	number, isNumber := value.(float64)
+	expected, err := strconv.ParseFloat(literal, 64)
+	if !isNumber || err != nil {
+		// Compare anything that isn't a pair of numbers as text
+		actual := fmt.Sprint(value)
+		switch operator {
+		case "=", "==":
+			return actual == literal, nil
+		case "!=":
+			return actual != literal, nil
+		}
+		return false, fmt.Errorf("condition %q: %s only applies to numbers", condition, operator)
+	}
+
+	switch operator {
+	case "=", "==":
+		return number == expected, nil
+	case "!=":
+		return number != expected, nil
+	case ">":
+		return number > expected, nil
+	case "<":
+		return number < expected, nil
+	case ">=":
+		return number >= expected, nil
+	default:
+		return number <= expected, nil
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(runbookCmd)
+	runbookCmd.Flags().BoolVarP(&disableColorJsonOutput, "raw-output", "r", false, "Disable colorized JSON output")
+}
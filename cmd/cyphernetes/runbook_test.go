@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const crashloopRunbook = `
+name: crashloop
+description: Find out why pods are crashing
+steps:
+  - id: find
+    message: Looking for crashing pods
+    query: MATCH (p:Pod) WHERE p.status.phase = "Running" RETURN COUNT{p} AS crashing
+    branches:
+      - if: crashing = 0
+        goto: healthy
+  - id: reason
+    query: MATCH (p:Pod) RETURN p.status.containerStatuses[0].lastState.terminated.reason
+    branches:
+      - if: count(p) > 2
+        goto: widespread
+    prompt: Was the last termination OOMKilled?
+    options:
+      "yes": memory
+      "no": logs
+  - id: memory
+    message: Raise the container's memory limit
+    end: true
+  - id: logs
+    prompt: Check the logs of the previous container
+    end: true
+  - id: widespread
+    message: Many pods are crashing, check recent rollouts
+    end: true
+  - id: healthy
+    message: No crashing pods
+`
+
+func stubRunbookQuery(t *testing.T, crashing float64, pods int) *[]string {
+	originalExecuteRunbookQuery := executeRunbookQuery
+	t.Cleanup(func() { executeRunbookQuery = originalExecuteRunbookQuery })
+
+	var queries []string
+	executeRunbookQuery = func(query string) (map[string]interface{}, error) {
+		queries = append(queries, query)
+		if strings.Contains(query, "COUNT") {
+			return map[string]interface{}{"aggregate": map[string]interface{}{"crashing": crashing}}, nil
+		}
+		var rows []interface{}
+		for i := 0; i < pods; i++ {
+			rows = append(rows, map[string]interface{}{"name": "web"})
+		}
+		return map[string]interface{}{"p": rows}, nil
+	}
+	return &queries
+}
+
+func TestRunRunbook(t *testing.T) {
+	disableColorJsonOutput = true
+	defer func() { disableColorJsonOutput = false }()
+
+	rb, err := parseRunbook([]byte(crashloopRunbook))
+	if err != nil {
+		t.Fatalf("parseRunbook() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		crashing float64
+		pods     int
+		input    string
+		expected []string
+		last     string
+	}{
+		{"branch on aggregation", 0, 0, "", []string{"crashing = 0 -> healthy"}, "No crashing pods\n"},
+		{"branch on row count", 3, 3, "", []string{"count(p) > 2 -> widespread"}, "Many pods are crashing, check recent rollouts\n"},
+		{"answer prompt", 1, 1, "maybe\nyes\n", []string{"Please answer one of: no, yes"}, "Raise the container's memory limit\n"},
+		{"prompt ends the runbook", 1, 1, "no\n\n", nil, "Check the logs of the previous container [Enter to continue] "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubRunbookQuery(t, tt.crashing, tt.pods)
+
+			var buf bytes.Buffer
+			if err := runRunbook(rb, strings.NewReader(tt.input), &buf); err != nil {
+				t.Fatalf("runRunbook() error = %v", err)
+			}
+			output := buf.String()
+			if !strings.HasPrefix(output, "Runbook: crashloop\nFind out why pods are crashing\n\n[find]\nLooking for crashing pods\n") {
+				t.Errorf("Unexpected start:\n%s", output)
+			}
+			for _, expected := range tt.expected {
+				if !strings.Contains(output, expected) {
+					t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+				}
+			}
+			if !strings.HasSuffix(output, tt.last) {
+				t.Errorf("Expected output to end with %q, got:\n%s", tt.last, output)
+			}
+		})
+	}
+}
+
+func TestRunRunbookErrors(t *testing.T) {
+	stubRunbookQuery(t, 1, 1)
+
+	rb, err := parseRunbook([]byte(crashloopRunbook))
+	if err != nil {
+		t.Fatalf("parseRunbook() error = %v", err)
+	}
+	var buf bytes.Buffer
+	if err := runRunbook(rb, strings.NewReader(""), &buf); err == nil || err.Error() != `step reason: no answer to "Was the last termination OOMKilled?"` {
+		t.Errorf("Expected an error for a missing answer, got %v", err)
+	}
+
+	rb, err = parseRunbook([]byte("steps:\n  - message: again\n    next: \"1\"\n"))
+	if err != nil {
+		t.Fatalf("parseRunbook() error = %v", err)
+	}
+	if err := runRunbook(rb, strings.NewReader(""), &buf); err == nil || !strings.Contains(err.Error(), "seems to loop") {
+		t.Errorf("Expected a loop error, got %v", err)
+	}
+
+	rb, err = parseRunbook([]byte("steps:\n  - query: MATCH (p:Pod) RETURN p\n    branches:\n      - if: missing > 0\n        goto: \"1\"\n"))
+	if err != nil {
+		t.Fatalf("parseRunbook() error = %v", err)
+	}
+	if err := runRunbook(rb, strings.NewReader(""), &buf); err == nil || !strings.Contains(err.Error(), "missing is not an aggregation") {
+		t.Errorf("Expected an unknown value error, got %v", err)
+	}
+}
+
+func TestParseRunbookErrors(t *testing.T) {
+	tests := map[string]string{
+		"steps: []": "runbook has no steps",
+		"steps:\n  - id: a\n    message: hi\n  - id: a\n    message: hi": "step 2: duplicate step id a",
+		"steps:\n  - id: a\n":                                "step a: needs a message, query or prompt",
+		"steps:\n  - query: MATCH (p:Pod\n":                  "step 1: error parsing query",
+		"steps:\n  - message: hi\n    next: nowhere\n":       "step 1: unknown step nowhere",
+		"steps:\n  - message: hi\n    options: {a: \"1\"}\n": "step 1: options need a prompt",
+		"steps:\n  - query: MATCH (p:Pod) RETURN p\n    branches:\n      - if: p is big\n        goto: \"1\"\n": "invalid condition",
+		"steps:\n  - mesage: hi\n": "field mesage not found",
+	}
+	for input, expected := range tests {
+		if _, err := parseRunbook([]byte(input)); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("parseRunbook(%q): expected an error containing %q, got %v", input, expected, err)
+		}
+	}
+}
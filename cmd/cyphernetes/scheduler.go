@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+)
+
+// Each query of the web server runs on a fork of the executor, with a state of its own, so that queries no longer
+// wait for each other. A scheduler bounds how many of them run at once: queries beyond --query-workers wait for a
+// worker, up to --query-queue of them, and the others are turned away. The queries users run from the query editor
+// are interactive, those dashboards run again every few seconds are scheduled. When both wait, interactive queries
+// take interactiveTurns workers for each one a scheduled query takes, so that a busy dashboard doesn't keep users
+// waiting and users don't keep dashboards from refreshing.
+
+type queryClass int
+
+const (
+	interactiveQuery queryClass = iota
+	scheduledQuery
+)
+
+func (class queryClass) String() string {
+	if class == scheduledQuery {
+		return "scheduled"
+	}
+	return "interactive"
+}
+
+// interactiveTurns is how many waiting interactive queries start for each waiting scheduled query
+const interactiveTurns = 3
+
+var (
+	queryWorkers    = 4
+	queryQueueLimit = 100
+	scheduler       = newQueryScheduler(queryWorkers, queryQueueLimit)
+)
+
+var errQueryQueueFull = errors.New("too many queries are waiting to run, try again later")
+
+type queryScheduler struct {
+	mu       sync.Mutex
+	workers  int
+	maxQueue int
+	running  int
+	// waiting holds the queries waiting for a worker by class, in the order they arrived
+	waiting [2][]chan struct{}
+	// turns counts the interactive queries started in a row while scheduled ones waited
+	turns int
+}
+
+func newQueryScheduler(workers, maxQueue int) *queryScheduler {
+	return &queryScheduler{workers: max(workers, 1), maxQueue: maxQueue}
+}
+
+// resize changes the number of workers and of queries that may wait for one. Queries running beyond the new number
+// of workers end as they would, and queries waiting beyond the new limit keep waiting.
+func (s *queryScheduler) resize(workers, maxQueue int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.workers, s.maxQueue = max(workers, 1), maxQueue
+	s.dispatch()
+}
+
+// acquire waits for a worker to run a query of class, until ctx is done. The returned func gives the worker back.
+func (s *queryScheduler) acquire(ctx context.Context, class queryClass) (func(), error) {
+	s.mu.Lock()
+	if s.running < s.workers && s.queued() == 0 {
+		s.running++
+		s.mu.Unlock()
+		return s.releaser(), nil
+	}
+	if s.queued() >= s.maxQueue {
+		s.mu.Unlock()
+		return nil, errQueryQueueFull
+	}
+	ready := make(chan struct{})
+	s.waiting[class] = append(s.waiting[class], ready)
+	s.mu.Unlock()
+
+	select {
+	case <-ready:
+		return s.releaser(), nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if i := slices.Index(s.waiting[class], ready); i >= 0 {
+			s.waiting[class] = slices.Delete(s.waiting[class], i, i+1)
+		} else {
+			// The query was given a worker as it gave up
+			s.running--
+			s.dispatch()
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// releaser gives a worker back once, however many times it's called
+func (s *queryScheduler) releaser() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.running--
+			s.dispatch()
+		})
+	}
+}
+
+func (s *queryScheduler) queued() int {
+	return len(s.waiting[interactiveQuery]) + len(s.waiting[scheduledQuery])
+}
+
+// dispatch starts waiting queries while workers are free
+func (s *queryScheduler) dispatch() {
+	for s.running < s.workers {
+		class, ok := s.next()
+		if !ok {
+			return
+		}
+		ready := s.waiting[class][0]
+		s.waiting[class] = s.waiting[class][1:]
+		s.running++
+		close(ready)
+	}
+}
+
+// next is the class of the waiting query to start next
+func (s *queryScheduler) next() (queryClass, bool) {
+	interactive, scheduled := len(s.waiting[interactiveQuery]) > 0, len(s.waiting[scheduledQuery]) > 0
+	switch {
+	case interactive && scheduled && s.turns >= interactiveTurns:
+		s.turns = 0
+		return scheduledQuery, true
+	case interactive:
+		if scheduled {
+			s.turns++
+		}
+		return interactiveQuery, true
+	case scheduled:
+		s.turns = 0
+		return scheduledQuery, true
+	}
+	return 0, false
+}
+
+// stats returns the number of running queries and of those waiting by class
+func (s *queryScheduler) stats() (int, [2]int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running, [2]int{len(s.waiting[interactiveQuery]), len(s.waiting[scheduledQuery])}
+}
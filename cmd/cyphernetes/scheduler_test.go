@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestQuerySchedulerFairness(t *testing.T) {
+	s := newQueryScheduler(1, 10)
+	release, err := s.acquire(context.Background(), interactiveQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Queue five scheduled queries, then five interactive ones, while the only worker is busy
+	started := make(chan string, 10)
+	queue := func(class queryClass, name string, position int) {
+		go func() {
+			release, err := s.acquire(context.Background(), class)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			started <- name
+			release()
+		}()
+		for {
+			if _, waiting := s.stats(); waiting[class] == position {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	for i := 1; i <= 5; i++ {
+		queue(scheduledQuery, fmt.Sprintf("s%d", i), i)
+	}
+	for i := 1; i <= 5; i++ {
+		queue(interactiveQuery, fmt.Sprintf("i%d", i), i)
+	}
+	release()
+
+	order := []string{}
+	for range 10 {
+		order = append(order, <-started)
+	}
+	expected := []string{"i1", "i2", "i3", "s1", "i4", "i5", "s2", "s3", "s4", "s5"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("expected interactive queries to take three turns for each scheduled one, got %v", order)
+	}
+}
+
+func TestQuerySchedulerLimits(t *testing.T) {
+	s := newQueryScheduler(1, 1)
+	release, err := s.acquire(context.Background(), interactiveQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A query giving up leaves the queue
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := s.acquire(ctx, scheduledQuery)
+		done <- err
+	}()
+	for {
+		if _, waiting := s.stats(); waiting[scheduledQuery] == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := s.acquire(context.Background(), interactiveQuery); !errors.Is(err, errQueryQueueFull) {
+		t.Errorf("expected the full queue to turn the query away, got %v", err)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the waiting query to give up, got %v", err)
+	}
+
+	release()
+	release()
+	if running, waiting := s.stats(); running != 0 || waiting != [2]int{} {
+		t.Errorf("expected the worker to be given back once, got %d running and %v waiting", running, waiting)
+	}
+}
+
+func TestQueryQueueFullResponse(t *testing.T) {
+	original := scheduler
+	defer func() { scheduler = original }()
+	scheduler = newQueryScheduler(1, 0)
+	release, err := scheduler.acquire(context.Background(), interactiveQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	setupAPIRoutes(router)
+	if w := apiRequest(router, "", http.MethodPost, "/api/query", `{"query": "MATCH (p:Pod) RETURN p", "scheduled": true}`); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 while the workers are busy and nothing may wait, got %d: %s", w.Code, w.Body.String())
+	}
+}
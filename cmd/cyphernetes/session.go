@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
+)
+
+// shellSession is a named connection the shell can switch to with :session.
+// Each session has its own client, namespace and cluster state (discovery and result caches).
+type shellSession struct {
+	name      string
+	context   string
+	executor  *parser.QueryExecutor
+	namespace string
+	state     parser.ClusterState
+}
+
+var sessions = make(map[string]*shellSession)
+var currentSession string
+
+var newSessionExecutor = parser.NewQueryExecutorForContext
+
+// defaultSessionName is the name given to the session the shell starts in
+const defaultSessionName = "default"
+
+// runSessionCommand backs the :session shell command.
+//
+//	:session                   list sessions
+//	:session <name>            switch to a session, creating it on the current context
+//	:session <name> <context>  create a session on the given kubeconfig context
+func runSessionCommand(args []string) (string, error) {
+	startTime := time.Now()
+	defer func() { execTime = time.Since(startTime) }()
+
+	if len(args) > 2 {
+		return "", fmt.Errorf("usage: :session [<name> [<context>]]")
+	}
+
+	if currentSession == "" {
+		// Adopt whatever the shell was running before the first :session
+		currentSession = defaultSessionName
+		sessions[currentSession] = &shellSession{name: currentSession, context: ctx, executor: executor}
+	}
+
+	if len(args) == 0 {
+		return listSessions(), nil
+	}
+
+	name := args[0]
+	contextName := ctx
+	if len(args) == 2 {
+		contextName = args[1]
+	}
+
+	if session, ok := sessions[name]; ok {
+		if len(args) == 2 && session.context != contextName {
+			return "", fmt.Errorf("session %s is already bound to context %s", name, session.context)
+		}
+		if name == currentSession {
+			return fmt.Sprintf("Already in session %s", name), nil
+		}
+		saveCurrentSession()
+		activateSession(session)
+		return fmt.Sprintf("Switched to session %s (context: %s)", name, session.context), nil
+	}
+
+	saveCurrentSession()
+	// Start the new session with empty caches so nothing leaks between clusters
+	parser.RestoreClusterState(parser.ClusterState{})
+	sessionExecutor, err := newSessionExecutor(contextName)
+	if err != nil {
+		activateSession(sessions[currentSession])
+		return "", err
+	}
+	session := &shellSession{
+		name:      name,
+		context:   contextName,
+		executor:  sessionExecutor,
+		namespace: parser.Namespace,
+		state:     parser.SaveClusterState(),
+	}
+	sessions[name] = session
+	activateSession(session)
+	return fmt.Sprintf("Created session %s (context: %s)", name, contextName), nil
+}
+
+// saveCurrentSession records the shell's live state in the current session
+func saveCurrentSession() {
+	session := sessions[currentSession]
+	session.executor = executor
+	session.namespace = parser.Namespace
+	session.state = parser.SaveClusterState()
+}
+
+// activateSession makes the session's client, namespace and caches the ones queries use
+func activateSession(session *shellSession) {
+	currentSession = session.name
+	ctx = session.context
+	useExecutor(session.executor)
+	parser.Namespace = session.namespace
+	parser.RestoreClusterState(session.state)
+}
+
+// useExecutor makes e the executor the shell's queries run on, with the options of the shell's flags
+func useExecutor(e *parser.QueryExecutor) {
+	e.Rows = returnRows
+	executor = e
+	parser.SetQueryExecutorInstance(e)
+}
+
+func listSessions() string {
+	names := make([]string, 0, len(sessions))
+	for name := range sessions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, name := range names {
+		session := sessions[name]
+		marker := " "
+		namespace := session.namespace
+		if name == currentSession {
+			marker = "*"
+			namespace = parser.Namespace
+		}
+		sb.WriteString(fmt.Sprintf("%s %s (context: %s, namespace: %s)\n", marker, name, session.context, namespaceLabel(namespace)))
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
+)
+
+func TestSessionCommand(t *testing.T) {
+	originalNewSessionExecutor := newSessionExecutor
+	originalExecutor := executor
+	originalCtx := ctx
+	originalNamespace := parser.Namespace
+	defer func() {
+		newSessionExecutor = originalNewSessionExecutor
+		executor = originalExecutor
+		ctx = originalCtx
+		parser.Namespace = originalNamespace
+		sessions = make(map[string]*shellSession)
+		currentSession = ""
+		parser.RestoreClusterState(parser.ClusterState{})
+	}()
+
+	executors := map[string]*parser.QueryExecutor{}
+	newSessionExecutor = func(contextName string) (*parser.QueryExecutor, error) {
+		if contextName == "missing" {
+			return nil, fmt.Errorf("context missing not found")
+		}
+		executors[contextName] = &parser.QueryExecutor{}
+		return executors[contextName], nil
+	}
+
+	startExecutor := &parser.QueryExecutor{}
+	executor = startExecutor
+	ctx = "dev-cluster"
+	parser.Namespace = "default"
+
+	if _, err := executeMacro(":session prod prod-cluster"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ctx != "prod-cluster" || executor != executors["prod-cluster"] {
+		t.Errorf("Expected to be on prod-cluster with its own executor, got context %s", ctx)
+	}
+	if parser.GetQueryExecutorInstance() != executor {
+		t.Errorf("Expected the shared executor instance to follow the session")
+	}
+	parser.Namespace = "payments"
+
+	if _, err := executeMacro(":session default"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ctx != "dev-cluster" || executor != startExecutor || parser.Namespace != "default" {
+		t.Errorf("Expected the original session back, got context %s, namespace %s", ctx, parser.Namespace)
+	}
+
+	if _, err := executeMacro(":session prod"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if parser.Namespace != "payments" {
+		t.Errorf("Expected the prod session to keep its namespace, got %s", parser.Namespace)
+	}
+
+	list, err := executeMacro(":session")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "  default (context: dev-cluster, namespace: default)\n* prod (context: prod-cluster, namespace: payments)"
+	if list != expected {
+		t.Errorf("Expected session list:\n%s\ngot:\n%s", expected, list)
+	}
+
+	if _, err := executeMacro(":session prod other-cluster"); err == nil {
+		t.Errorf("Expected an error when rebinding a session to another context")
+	}
+	if _, err := executeMacro(":session broken missing"); err == nil {
+		t.Errorf("Expected an error for an unknown context")
+	}
+	if currentSession != "prod" || ctx != "prod-cluster" {
+		t.Errorf("Expected a failed create to leave the prod session active, got %s", currentSession)
+	}
+}
+
+func TestSessionExecutorsReturnRows(t *testing.T) {
+	originalNewSessionExecutor := newSessionExecutor
+	originalExecutor := executor
+	originalCtx := ctx
+	defer func() {
+		newSessionExecutor = originalNewSessionExecutor
+		executor = originalExecutor
+		ctx = originalCtx
+		returnRows = false
+		sessions = make(map[string]*shellSession)
+		currentSession = ""
+		parser.RestoreClusterState(parser.ClusterState{})
+	}()
+
+	newSessionExecutor = func(contextName string) (*parser.QueryExecutor, error) {
+		return &parser.QueryExecutor{}, nil
+	}
+	returnRows = true
+	useExecutor(&parser.QueryExecutor{})
+	ctx = "dev-cluster"
+
+	// --rows applies to the executor of every session the shell switches to
+	for _, command := range []string{":session prod prod-cluster", ":session default", ":session prod"} {
+		if _, err := executeMacro(command); err != nil {
+			t.Fatalf("%s: unexpected error: %v", command, err)
+		}
+		if !executor.Rows {
+			t.Errorf("%s: expected the session's executor to return rows", command)
+		}
+	}
+}
@@ -137,7 +137,7 @@ func (c *CyphernetesCompleter) Do(line []rune, pos int) ([][]rune, int) {
 			// Handle other autocompletion cases (like keywords)
 
 			// Keywords
-			keywords := []string{"match", "where", "return", "set", "delete", "create", "as", "sum", "count"}
+			keywords := []string{"match", "optional", "where", "return", "set", "delete", "create", "merge", "with", "unwind", "apply", "while", "as", "distinct", "order", "by", "asc", "desc", "union", "contains", "starts", "ends", "sum", "count"}
 
 			for _, k := range keywords {
 				if strings.HasPrefix(k, prefix) {
@@ -160,7 +160,7 @@ func isMacroContext(line string) bool {
 }
 
 func getMacros() []string {
-	macros := []string{}
+	macros := []string{"cache", "context", "contexts", "describe", "explain", "namespace", "namespaces", "resolve", "schema", "session"}
 	for _, macro := range macroManager.Macros {
 		macros = append(macros, macro.Name)
 	}
@@ -220,19 +220,7 @@ func fetchResourceAPIDefinition(gvr schema.GroupVersionResource) ([]string, erro
 
 // Helper function to get the kind from GVR
 func getKindFromGVR(gvr schema.GroupVersionResource) (string, error) {
-	discoveryClient := parser.GetQueryExecutorInstance().Clientset.Discovery()
-	apiResourceList, err := discoveryClient.ServerResourcesForGroupVersion(gvr.GroupVersion().String())
-	if err != nil {
-		return "", err
-	}
-
-	for _, apiResource := range apiResourceList.APIResources {
-		if apiResource.Name == gvr.Resource || apiResource.Name == strings.TrimSuffix(gvr.Resource, "s") {
-			return apiResource.Kind, nil
-		}
-	}
-
-	return "", fmt.Errorf("kind not found for GVR %v", gvr)
+	return parser.KindForGVR(parser.GetQueryExecutorInstance().Clientset, gvr)
 }
 
 // Helper function to build the schema name
@@ -8,7 +8,9 @@ import (
 	"os"
 	"reflect"
 	"regexp"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"os/signal"
@@ -19,7 +21,6 @@ import (
 	cobra "github.com/spf13/cobra"
 	"github.com/wader/readline"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/oidc"
-	"k8s.io/client-go/tools/clientcmd"
 )
 
 //go:embed default_macros.txt
@@ -89,16 +90,15 @@ func getCurrentContext() (string, string, error) {
 }
 
 func getCurrentContextFromConfig() (string, string, error) {
-	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
-	configOverrides := &clientcmd.ConfigOverrides{}
-	kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, configOverrides)
-
-	config, err := kubeConfig.RawConfig()
+	config, err := parser.KubeClientConfig("").RawConfig()
 	if err != nil {
 		return "", "", fmt.Errorf("error getting current context from kubeconfig: %v", err)
 	}
 
 	currentContextName := config.CurrentContext
+	if parser.KubeContext != "" {
+		currentContextName = parser.KubeContext
+	}
 	currentContext, exists := config.Contexts[currentContextName]
 	if !exists {
 		return "", "", fmt.Errorf("current context %s does not exist in kubeconfig", currentContextName)
@@ -110,16 +110,30 @@ func getCurrentContextFromConfig() (string, string, error) {
 	return currentContextName, namespace, nil
 }
 
-type syntaxHighlighter struct{}
+// syntaxCheckDelay is how long a line must stay unchanged before the shell checks it for a syntax error to underline
+const syntaxCheckDelay = 300 * time.Millisecond
+
+type syntaxHighlighter struct {
+	mu sync.Mutex
+	// checked is the last query checked for a syntax error, and syntaxErr its error, if it has one
+	checked   string
+	syntaxErr *parser.ParseError
+	timer     *time.Timer
+	// refresh repaints the line once it's checked
+	refresh func()
+}
 
 var (
-	keywordsRegex       = regexp.MustCompile(`(?i)\b(match|where|set|delete|create|sum|count|as)\b`)
+	keywordsRegex       = regexp.MustCompile(`(?i)\b(explain|apply|while|optional|match|merge|with|unwind|where|set|delete|create|contains|starts|ends|sum|count|as|distinct|order|by|asc|desc|union)\b`)
 	bracketsRegex       = regexp.MustCompile(`[\(\)\[\]\{\}\<\>]`)
-	variableRegex       = regexp.MustCompile(`"(.*?)"`)
+	variableRegex       = regexp.MustCompile(`"(.*?)"|'(.*?)'`)
+	propertyPathRegex   = regexp.MustCompile(`("(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*')|\b([A-Za-z_]\w*)((?:\.\w[\w\-/]*|\[[^\]\x1b]*\])+)`)
 	identifierRegex     = regexp.MustCompile(`0m(\w+):(\w+)`)
 	propertiesRegex     = regexp.MustCompile(`\{((?:[^{}]|\{[^{}]*\})*)\}`)
 	returnRegex         = regexp.MustCompile(`(?i)(return)(\s+.*)`)
 	returnJsonPathRegex = regexp.MustCompile(`(\.|\*)`)
+	queryStartRegex     = regexp.MustCompile(`(?i)^\s*(explain|match|create|merge)\b`)
+	escapeRegex         = regexp.MustCompile(`^\x1b[^a-zA-Z]*[a-zA-Z]`)
 )
 
 func (h *syntaxHighlighter) Paint(line []rune, pos int) []rune {
@@ -137,12 +151,25 @@ func (h *syntaxHighlighter) Paint(line []rune, pos int) []rune {
 		return match
 	})
 
-	// Coloring for quoted variables
-	lineStr = variableRegex.ReplaceAllString(lineStr, "\033[90m$0\033[0m") // Dark grey for quoted variables
+	// Coloring for strings, in double or single quotes
+	lineStr = variableRegex.ReplaceAllString(lineStr, "\033[90m$0\033[0m") // Dark grey for strings
 
 	// Coloring for identifiers (left and right of the colon)
 	lineStr = identifierRegex.ReplaceAllString(lineStr, "\033[33m$1\033[0m:\033[94m$2\033[0m") // Orange for left, Light blue for right
 
+	// Coloring for property paths before RETURN, e.g. in WHERE and SET, which RETURN colors itself
+	before, after := lineStr, ""
+	if loc := returnRegex.FindStringIndex(lineStr); loc != nil {
+		before, after = lineStr[:loc[0]], lineStr[loc[0]:]
+	}
+	lineStr = propertyPathRegex.ReplaceAllStringFunc(before, func(match string) string {
+		parts := propertyPathRegex.FindStringSubmatch(match)
+		if parts[1] != "" {
+			return match
+		}
+		return "\033[33m" + parts[2] + "\033[0m\033[96m" + parts[3] + "\033[0m" // Orange for the variable, light cyan for the path
+	}) + after
+
 	// Coloring everything after RETURN in purple
 	lineStr = returnRegex.ReplaceAllStringFunc(lineStr, func(match string) string {
 		parts := returnRegex.FindStringSubmatch(match)
@@ -162,11 +189,85 @@ func (h *syntaxHighlighter) Paint(line []rune, pos int) []rune {
 		return colorizeProperties(match)
 	})
 
+	// Underline where the query fails to parse
+	lineStr = h.underlineSyntaxError(string(line), lineStr)
+
 	// Ensure color is reset at the end of the entire line
 	lineStr += "\033[0m"
 	return []rune(lineStr)
 }
 
+// underlineSyntaxError underlines the token a query fails to parse at in its painted line. Lines are checked once
+// they stay unchanged for syntaxCheckDelay, rather than on every key, and repainted then. Nothing is underlined when
+// the parser only ran out of input, as it does while the query is being typed.
+func (h *syntaxHighlighter) underlineSyntaxError(line, painted string) string {
+	if !queryStartRegex.MatchString(line) {
+		return painted
+	}
+	query := strings.TrimSuffix(strings.TrimRight(line, " \t"), ";")
+	h.mu.Lock()
+	checked, parseErr := h.checked, h.syntaxErr
+	if checked != query {
+		h.scheduleCheck(query)
+	}
+	h.mu.Unlock()
+	if checked != query || parseErr == nil {
+		return painted
+	}
+	return underlineAt(painted, query, parseErr)
+}
+
+// scheduleCheck checks query for a syntax error after syntaxCheckDelay, unless another query is scheduled first. It's
+// called with mu held.
+func (h *syntaxHighlighter) scheduleCheck(query string) {
+	if h.timer != nil {
+		h.timer.Stop()
+	}
+	h.timer = time.AfterFunc(syntaxCheckDelay, func() {
+		parseErr := parser.CheckSyntax(query)
+		h.mu.Lock()
+		h.checked, h.syntaxErr = query, parseErr
+		refresh := h.refresh
+		h.mu.Unlock()
+		if refresh != nil {
+			refresh()
+		}
+	})
+}
+
+// underlineAt underlines the token of a syntax error of query in its painted line
+func underlineAt(painted, query string, parseErr *parser.ParseError) string {
+	if parseErr.Line != 1 || parseErr.Column < 1 || parseErr.Column > len(query) {
+		return painted
+	}
+	start := parseErr.Column - 1
+	end := start + len(parseErr.Found)
+
+	var sb strings.Builder
+	visible := 0
+	for i := 0; i < len(painted); {
+		if escape := escapeRegex.FindString(painted[i:]); escape != "" {
+			sb.WriteString(escape)
+			i += len(escape)
+			// Colors reset the underline
+			if visible > start && visible < end {
+				sb.WriteString("\033[4m")
+			}
+			continue
+		}
+		switch visible {
+		case start:
+			sb.WriteString("\033[4m")
+		case end:
+			sb.WriteString("\033[24m")
+		}
+		sb.WriteByte(painted[i])
+		visible++
+		i++
+	}
+	return sb.String()
+}
+
 func colorizeProperties(obj string) string {
 	// Remove existing color codes
 	stripped := regexp.MustCompile(`\x1b\[[0-9;]*[mK]`).ReplaceAllString(obj, "")
@@ -209,13 +310,14 @@ func runShell(cmd *cobra.Command, args []string) {
 	}
 
 	historyFile := os.Getenv("HOME") + "/.cyphernetes/history"
+	highlighter := &syntaxHighlighter{}
 	rl, err := readline.NewEx(&readline.Config{
 		Prompt:                 shellPrompt(),
 		HistoryFile:            historyFile,
 		AutoComplete:           completer,
 		InterruptPrompt:        "", // Set this to empty string
 		EOFPrompt:              "exit",
-		Painter:                &syntaxHighlighter{},
+		Painter:                highlighter,
 		DisableAutoSaveHistory: true,
 		HistorySearchFold:      true,
 		FuncFilterInputRune:    filterInput,
@@ -225,6 +327,9 @@ func runShell(cmd *cobra.Command, args []string) {
 		panic(err)
 	}
 	defer rl.Close()
+	highlighter.mu.Lock()
+	highlighter.refresh = rl.Refresh
+	highlighter.mu.Unlock()
 
 	rl.Config.SetListener(func(line []rune, pos int, key rune) (newLine []rune, newPos int, ok bool) {
 		rl.Refresh()
@@ -248,8 +353,9 @@ func runShell(cmd *cobra.Command, args []string) {
 	if executor == nil {
 		os.Exit(1)
 	}
+	useExecutor(executor)
 	parser.FetchAndCacheGVRs(executor.Clientset)
-	parser.InitResourceSpecs()
+	initResourceSpecsOrWarn()
 	initResourceSpecs()
 
 	fmt.Println("")
@@ -287,7 +393,7 @@ func runShell(cmd *cobra.Command, args []string) {
 			// Execute macro immediately
 			result, err := executeMacro(line)
 			if err != nil {
-				fmt.Printf("Error >> %s\n", err)
+				fmt.Printf("Error >> %s\n", errorMessage(err))
 			} else {
 				if !disableColorJsonOutput {
 					result = colorizeJson(result)
@@ -298,6 +404,8 @@ func runShell(cmd *cobra.Command, args []string) {
 				}
 			}
 			rl.SaveHistory(line)
+			// :session, :context and :namespace may have switched context or namespace
+			rl.SetPrompt(shellPrompt())
 			continue
 		}
 
@@ -316,11 +424,17 @@ func runShell(cmd *cobra.Command, args []string) {
 				fmt.Print(multiLinePrompt())
 			}
 			fmt.Println(string(lastLine))
-			if !strings.HasSuffix(line, ";") && !strings.HasPrefix(line, "\\") && line != "exit" && line != "help" {
+			// Comments are left out, so a query ends at a semicolon followed by one
+			cmd := macroStatement(strings.Join(cmds, "\n"))
+			if cmd == "" {
+				cmds = cmds[:0]
+				rl.SetPrompt(shellPrompt())
+				continue
+			}
+			if !strings.HasSuffix(cmd, ";") && !strings.HasPrefix(line, "\\") && line != "exit" && line != "help" {
 				rl.SetPrompt(multiLinePrompt())
 				continue
 			}
-			cmd := strings.Join(cmds, " ")
 			cmd = strings.TrimSuffix(cmd, ";")
 			cmds = cmds[:0]
 			rl.SetPrompt(shellPrompt())
@@ -339,12 +453,7 @@ func runShell(cmd *cobra.Command, args []string) {
 		}
 
 		if strings.HasPrefix(input, "\\n ") {
-			input = strings.TrimPrefix(input, "\\n ")
-			if strings.ToLower(input) == "all" {
-				parser.Namespace = ""
-			} else {
-				parser.Namespace = strings.ToLower(input)
-			}
+			switchNamespace(strings.TrimPrefix(input, "\\n "))
 			rl.SetPrompt(shellPrompt())
 		} else if input == "\\d" {
 			// Toggle debug mode
@@ -368,7 +477,12 @@ func runShell(cmd *cobra.Command, args []string) {
 		} else if input == "\\cc" {
 			// Clear the cache
 			parser.ClearCache()
+			executor.ClearCachedLists()
 			fmt.Println("Cache cleared")
+		} else if input == "\\dc" {
+			// Invalidate the discovery cache
+			parser.InvalidateDiscoveryCache()
+			fmt.Println("Discovery cache invalidated")
 		} else if input == "\\lm" {
 			fmt.Println("Registered macros:")
 			for name, macro := range macroManager.Macros {
@@ -411,22 +525,37 @@ func runShell(cmd *cobra.Command, args []string) {
 			fmt.Println("\\r                 - Toggle raw output (disable colorized JSON)")
 			fmt.Println("\\d                 - Toggle debug mode")
 			fmt.Println("\\cc                - Clear the cache")
+			fmt.Println(":cache [clear]     - Show the resources queries reuse within --cache-ttl, or clear them")
 			fmt.Println("\\pc                - Print the cache")
+			fmt.Println("\\dc                - Invalidate the API discovery cache")
 			fmt.Println("\\lm                - List all registered macros")
 			fmt.Println(":macro_name [args] - Execute a macro")
+			fmt.Println(":resolve <name>    - Show which API resources a kind name resolves to and why")
+			fmt.Println(":describe <kind>   - Show the resource of a kind, its short names and the tree of its fields")
+			fmt.Println(":explain [tree|dot|json] <query> - Show the query plan without running the query, as a tree by default")
+			fmt.Println(":session [<name> [<context>]] - List sessions, or switch to (creating if needed) a named session")
+			fmt.Println(":context [<name>]  - Show the kubeconfig context, or switch the session to another one")
+			fmt.Println(":contexts          - List the contexts of the kubeconfig")
+			fmt.Println(":namespace [<name>|all] - Show the namespace, or switch to another one or to all of them")
+			fmt.Println(":namespaces        - List the namespaces of the cluster")
 		} else if input != "" {
 			executing = true
+			shellQuery.start()
 			// Process the input if not empty
 			result, graph, err := processQuery(input)
+			shellQuery.stop()
 			executing = false
 			if err != nil {
-				fmt.Printf("Error >> %s\n", err)
+				fmt.Printf("Error >> %s\n", errorMessage(err))
+				if hint := errorHint(input, err); hint != "" {
+					fmt.Println(hint)
+				}
 				continue
 			}
 			if !disableGraphOutput {
 				graphAscii, err := drawGraph(graph, result)
 				if err != nil {
-					fmt.Printf("Error >> %s\n", err)
+					fmt.Printf("Error >> %s\n", errorMessage(err))
 				} else {
 					fmt.Println(graphAscii)
 				}
@@ -537,7 +666,11 @@ func buildDataAndGraph(resultMap map[string]interface{}, result *string, graph *
 		}
 	}
 
-	if data, ok := resultMap["Data"]; ok {
+	data, ok := resultMap["Data"]
+	if rows, hasRows := resultMap["Rows"]; hasRows && returnRows {
+		data, ok = rows, true
+	}
+	if ok {
 		resultBytes, err := json.Marshal(data)
 		if err != nil {
 			return fmt.Errorf("error marshalling data: %w", err)
@@ -552,12 +685,14 @@ func buildDataAndGraph(resultMap map[string]interface{}, result *string, graph *
 func executeStatement(query string) (string, error) {
 	ast, err := parser.ParseQuery(query)
 	if err != nil {
-		return "", fmt.Errorf("error parsing query >> %s", err)
+		recordQuery("shell", nil, err)
+		return "", fmt.Errorf("error parsing query >> %w", err)
 	}
 
-	results, err := executor.Execute(ast, "")
+	results, err := executor.ExecuteContext(shellQuery.context(), ast, "")
+	recordQuery("shell", ast, err)
 	if err != nil {
-		return "", fmt.Errorf("error executing query >> %s", err)
+		return "", fmt.Errorf("error executing query >> %w", err)
 	}
 
 	// Check if results is nil or empty
@@ -572,6 +707,176 @@ func executeStatement(query string) (string, error) {
 	return string(json), nil
 }
 
+var resolveKind = parser.ResolveKind
+
+// resolveIdentifier backs the :resolve shell command
+func resolveIdentifier(args []string) (string, error) {
+	startTime := time.Now()
+	defer func() { execTime = time.Since(startTime) }()
+
+	if len(args) != 1 {
+		return "", fmt.Errorf("usage: :resolve <identifier>")
+	}
+
+	resolutions, err := resolveKind(executor.Clientset, args[0])
+	if err != nil {
+		return "", err
+	}
+
+	json, err := json.MarshalIndent(resolutions, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error marshalling resolutions >> %s", err)
+	}
+	return string(json), nil
+}
+
+var describeKind = parser.DescribeKind
+
+// describeKindCommand backs the :describe shell command, and its :schema alias
+func describeKindCommand(args []string) (string, error) {
+	startTime := time.Now()
+	defer func() { execTime = time.Since(startTime) }()
+
+	if len(args) != 1 {
+		return "", fmt.Errorf("usage: :describe <kind>")
+	}
+	description, err := describeKind(executor.Clientset, args[0])
+	if err != nil {
+		return "", err
+	}
+
+	groupVersion := description.Version
+	if description.Group != "" {
+		groupVersion = description.Group + "/" + description.Version
+	}
+	shortNames := strings.Join(description.ShortNames, ", ")
+	if shortNames == "" {
+		shortNames = "none"
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Kind:        %s\n", description.Kind)
+	fmt.Fprintf(&sb, "Resource:    %s (%s)\n", description.Resource, groupVersion)
+	fmt.Fprintf(&sb, "Namespaced:  %t\n", description.Namespaced)
+	fmt.Fprintf(&sb, "Short names: %s\n", shortNames)
+	if len(description.Fields) == 0 {
+		sb.WriteString("Fields:      unknown, the OpenAPI schema of the kind isn't loaded")
+		return sb.String(), nil
+	}
+	sb.WriteString("Fields:")
+	root := &fieldNode{}
+	for _, field := range description.Fields {
+		root.add(strings.Split(field, "."))
+	}
+	root.write(&sb, 0)
+	return sb.String(), nil
+}
+
+// fieldNode is a field of a kind's schema, in the tree :describe prints
+type fieldNode struct {
+	name string
+	// suffix is [] for arrays and {} for maps, of the items listed below them
+	suffix   string
+	children []*fieldNode
+}
+
+// add adds the field of the given path segments, e.g. spec, containers[] and image, below n
+func (n *fieldNode) add(segments []string) {
+	if len(segments) == 0 {
+		return
+	}
+	name, suffix := segments[0], ""
+	for _, s := range []string{"[]", "{}"} {
+		if strings.HasSuffix(name, s) {
+			name, suffix = strings.TrimSuffix(name, s), s
+		}
+	}
+	var child *fieldNode
+	for _, c := range n.children {
+		if c.name == name {
+			child = c
+		}
+	}
+	if child == nil {
+		child = &fieldNode{name: name}
+		n.children = append(n.children, child)
+	}
+	if suffix != "" {
+		child.suffix = suffix
+	}
+	child.add(segments[1:])
+}
+
+func (n *fieldNode) write(sb *strings.Builder, depth int) {
+	for _, child := range n.children {
+		fmt.Fprintf(sb, "\n%s%s%s", strings.Repeat("  ", depth+1), child.name, child.suffix)
+		child.write(sb, depth+1)
+	}
+}
+
+// explainQuery backs the :explain shell command, its query may start with the format of the plan
+func explainQuery(query string) (string, error) {
+	format := "tree"
+	if word, rest, _ := strings.Cut(query, " "); slices.Contains(planFormats, strings.ToLower(word)) {
+		format, query = strings.ToLower(word), strings.TrimSpace(rest)
+	}
+	query = strings.TrimSuffix(query, ";")
+	if query == "" {
+		return "", fmt.Errorf("usage: :explain <query>")
+	}
+	result, _, err := processQuery("EXPLAIN " + query)
+	if err != nil || format == "json" {
+		return result, err
+	}
+	var data struct {
+		Plan *parser.QueryPlan `json:"plan"`
+	}
+	if err := json.Unmarshal([]byte(result), &data); err != nil || data.Plan == nil {
+		return result, nil
+	}
+	return formatPlan(data.Plan, format)
+}
+
+// runCacheCommand backs the :cache shell command.
+//
+//	:cache        show the resources the next queries would reuse
+//	:cache clear  list everything again on the next queries
+func runCacheCommand(args []string) (string, error) {
+	switch {
+	case len(args) == 1 && args[0] == "clear":
+		return fmt.Sprintf("Cache cleared (%d lists)", executor.ClearCachedLists()), nil
+	case len(args) > 0:
+		return "", fmt.Errorf("usage: :cache [clear]")
+	}
+	if parser.CacheTTL <= 0 {
+		return "The cache is off, set --cache-ttl to reuse listed resources between queries", nil
+	}
+	entries := executor.CachedLists()
+	if len(entries) == 0 {
+		return fmt.Sprintf("The cache is empty (TTL %s)", parser.CacheTTL), nil
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Cached lists (TTL %s):", parser.CacheTTL)
+	for _, entry := range entries {
+		scope := "in all namespaces"
+		if entry.Namespace != "" {
+			scope = "in " + entry.Namespace
+		}
+		var selectors []string
+		if entry.FieldSelector != "" {
+			selectors = append(selectors, "fieldSelector: "+entry.FieldSelector)
+		}
+		if entry.LabelSelector != "" {
+			selectors = append(selectors, "labelSelector: "+entry.LabelSelector)
+		}
+		if len(selectors) > 0 {
+			scope += " (" + strings.Join(selectors, ", ") + ")"
+		}
+		fmt.Fprintf(&sb, "\n  %s %s, %d resources, listed %s ago, expires in %s", entry.Kind, scope, entry.Resources,
+			entry.Age.Round(time.Second), entry.ExpiresIn.Round(time.Second))
+	}
+	return sb.String(), nil
+}
+
 func colorizeJson(jsonString string) string {
 	var obj interface{}
 	err := json.Unmarshal([]byte(jsonString), &obj)
@@ -630,12 +935,16 @@ func init() {
 
 func handleInterrupt(rl *readline.Instance, cmds *[]string, executing *bool) {
 	if *executing {
-		// If we're executing a query, do nothing
+		// If we're executing a query, cancel it and get back to the prompt
+		if shellQuery.interrupt() {
+			fmt.Println("\nInterrupting query...")
+		}
 		return
 	}
 
 	if len(*cmds) == 0 {
-		// If the input is empty, exit the program
+		// If the input is empty, exit the program, restoring the terminal first
+		rl.Close()
 		os.Exit(0)
 	}
 
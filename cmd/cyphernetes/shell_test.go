@@ -5,9 +5,11 @@ import (
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/avitaltamir/cyphernetes/pkg/parser"
 	"github.com/wader/readline"
+	"k8s.io/client-go/kubernetes"
 )
 
 func TestShellPrompt(t *testing.T) {
@@ -97,7 +99,12 @@ func TestSyntaxHighlighterPaint(t *testing.T) {
 		{
 			name:     "Keywords",
 			input:    "MATCH (n:Node) WHERE n.property = 'value' RETURN n",
-			expected: "\x1b[35mMATCH\x1b[0m \x1b[37m(\x1b[\x1b[33mn\x1b[0m:\x1b[94mNode\x1b[0m\x1b[37m)\x1b[0m \x1b[35mWHERE\x1b[0m n.property = 'value' \x1b[35mRETURN n\x1b[0m",
+			expected: "\x1b[35mMATCH\x1b[0m \x1b[37m(\x1b[\x1b[33mn\x1b[0m:\x1b[94mNode\x1b[0m\x1b[37m)\x1b[0m \x1b[35mWHERE\x1b[0m \x1b[33mn\x1b[0m\x1b[96m.property\x1b[0m = \x1b[90m'value'\x1b[0m \x1b[35mRETURN n\x1b[0m",
+		},
+		{
+			name:     "Strings and property paths",
+			input:    `SET d.spec.replicas = 3, d.metadata.labels.app = "web.v2"`,
+			expected: "\x1b[35mSET\x1b[0m \x1b[33md\x1b[0m\x1b[96m.spec.replicas\x1b[0m = 3, \x1b[33md\x1b[0m\x1b[96m.metadata.labels.app\x1b[0m = \x1b[90m\"web.v2\"\x1b[0m\x1b[0m",
 		},
 		{
 			name:     "Properties",
@@ -121,6 +128,51 @@ func TestSyntaxHighlighterPaint(t *testing.T) {
 	}
 }
 
+func TestSyntaxHighlighterUnderline(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "Syntax error",
+			input:    "MATCH (n:Node) WHERE n.name = 'web' RETURN n",
+			expected: "\x1b[33mn\x1b[0m\x1b[96m.name\x1b[0m = \x1b[90m\x1b[4m'web'\x1b[0m\x1b[24m \x1b[35mRETURN",
+		},
+		{
+			name:  "Incomplete query",
+			input: "MATCH (n:Node",
+		},
+		{
+			name:  "Valid query",
+			input: "MATCH (n:Node) RETURN n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checked := make(chan struct{}, 1)
+			h := &syntaxHighlighter{refresh: func() { checked <- struct{}{} }}
+			// Lines are underlined once they've been checked, not as they're typed
+			if painted := string(h.Paint([]rune(tt.input), 0)); strings.Contains(painted, "\x1b[4m") {
+				t.Fatalf("expected no underline before the line is checked, got %q", painted)
+			}
+			select {
+			case <-checked:
+			case <-time.After(5 * time.Second):
+				t.Fatal("the line wasn't checked")
+			}
+			painted := string(h.Paint([]rune(tt.input), 0))
+			if tt.expected == "" {
+				if strings.Contains(painted, "\x1b[4m") {
+					t.Errorf("expected no underline, got %q", painted)
+				}
+			} else if !strings.Contains(painted, tt.expected) {
+				t.Errorf("expected %q to contain %q", painted, tt.expected)
+			}
+		})
+	}
+}
+
 func TestExecuteMacro(t *testing.T) {
 	// Create a new MacroManager
 	mm := NewMacroManager()
@@ -179,3 +231,142 @@ func TestExecuteMacro(t *testing.T) {
 		})
 	}
 }
+
+func TestResolveIdentifier(t *testing.T) {
+	originalResolveKind := resolveKind
+	originalExecutor := executor
+	defer func() {
+		resolveKind = originalResolveKind
+		executor = originalExecutor
+	}()
+	executor = &parser.QueryExecutor{}
+
+	resolveKind = func(clientset kubernetes.Interface, identifier string) ([]parser.KindResolution, error) {
+		if identifier != "deploy" {
+			return nil, fmt.Errorf("resource identifier not found: %s", identifier)
+		}
+		return []parser.KindResolution{{
+			Identifier: "deploy",
+			Group:      "apps",
+			Version:    "v1",
+			Resource:   "deployments",
+			Kind:       "Deployment",
+			Namespaced: true,
+			MatchedBy:  parser.MatchedByShortName,
+		}}, nil
+	}
+
+	result, err := executeMacro(":resolve deploy")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := `[
+  {
+    "identifier": "deploy",
+    "group": "apps",
+    "version": "v1",
+    "resource": "deployments",
+    "kind": "Deployment",
+    "namespaced": true,
+    "matchedBy": "short name"
+  }
+]`
+	if result != expected {
+		t.Errorf("Expected result %s, but got %s", expected, result)
+	}
+
+	if _, err := executeMacro(":resolve unknown"); err == nil {
+		t.Errorf("Expected an error for an unknown identifier, but got none")
+	}
+	if _, err := executeMacro(":resolve"); err == nil {
+		t.Errorf("Expected a usage error without an identifier, but got none")
+	}
+}
+
+func TestDescribeKindCommand(t *testing.T) {
+	originalDescribeKind := describeKind
+	originalExecutor := executor
+	defer func() {
+		describeKind = originalDescribeKind
+		executor = originalExecutor
+	}()
+	executor = &parser.QueryExecutor{}
+
+	fields := []string{"metadata", "metadata.name", "spec", "spec.replicas", "spec.template", "spec.template.spec",
+		"spec.template.spec.containers", "spec.template.spec.containers[].image", "spec.template.spec.containers[].name"}
+	describeKind = func(clientset kubernetes.Interface, identifier string) (*parser.KindDescription, error) {
+		if identifier != "deploy" {
+			return nil, fmt.Errorf("resource identifier not found: %s", identifier)
+		}
+		return &parser.KindDescription{
+			SchemaKind: parser.SchemaKind{Kind: "Deployment", Resource: "deployments", Group: "apps", Version: "v1", Namespaced: true, ShortNames: []string{"deploy"}},
+			Fields:     fields,
+		}, nil
+	}
+
+	expected := `Kind:        Deployment
+Resource:    deployments (apps/v1)
+Namespaced:  true
+Short names: deploy
+Fields:
+  metadata
+    name
+  spec
+    replicas
+    template
+      spec
+        containers[]
+          image
+          name`
+	for _, input := range []string{":describe deploy", ":schema deploy"} {
+		result, err := executeMacro(input)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result != expected {
+			t.Errorf("%s: expected\n%s\ngot\n%s", input, expected, result)
+		}
+	}
+
+	fields = nil
+	result, err := executeMacro(":describe deploy")
+	if err != nil || !strings.HasSuffix(result, "Fields:      unknown, the OpenAPI schema of the kind isn't loaded") {
+		t.Errorf("Expected the fields to be unknown without schemas, got %s, %v", result, err)
+	}
+	if _, err := executeMacro(":describe"); err == nil || err.Error() != "usage: :describe <kind>" {
+		t.Errorf("Expected a usage error without a kind, but got %v", err)
+	}
+}
+
+func TestExplainQueryUsage(t *testing.T) {
+	for _, input := range []string{":explain", ":explain ;"} {
+		if _, err := executeMacro(input); err == nil || err.Error() != "usage: :explain <query>" {
+			t.Errorf("Expected a usage error for %q, but got %v", input, err)
+		}
+	}
+}
+
+func TestCacheCommand(t *testing.T) {
+	originalExecutor := executor
+	originalTTL := parser.CacheTTL
+	defer func() {
+		executor = originalExecutor
+		parser.CacheTTL = originalTTL
+	}()
+	executor = &parser.QueryExecutor{}
+
+	parser.CacheTTL = 0
+	if result, err := executeMacro(":cache"); err != nil || !strings.HasPrefix(result, "The cache is off") {
+		t.Errorf("Expected the cache to be off, got %q, %v", result, err)
+	}
+	parser.CacheTTL = 30 * time.Second
+	if result, err := executeMacro(":cache"); err != nil || result != "The cache is empty (TTL 30s)" {
+		t.Errorf("Expected an empty cache, got %q, %v", result, err)
+	}
+	if result, err := executeMacro(":cache clear"); err != nil || result != "Cache cleared (0 lists)" {
+		t.Errorf("Expected the cache to be cleared, got %q, %v", result, err)
+	}
+	if _, err := executeMacro(":cache flush"); err == nil || err.Error() != "usage: :cache [clear]" {
+		t.Errorf("Expected a usage error, got %v", err)
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
+)
+
+// stubSinkWatch makes every watch of a sink send events, recording the resume tokens the watches start from. The
+// watches send nothing more until they're stopped.
+func stubSinkWatch(t *testing.T, events ...parser.WatchEvent) *[]string {
+	original := sinkWatch
+	t.Cleanup(func() { sinkWatch = original })
+	var resumeTokens []string
+	sinkWatch = func(ctx context.Context, ast *parser.Expression, namespace string, opts parser.WatchOptions) (<-chan parser.WatchEvent, <-chan error) {
+		resumeTokens = append(resumeTokens, opts.ResumeToken)
+		sent, errs := make(chan parser.WatchEvent), make(chan error, 1)
+		go func() {
+			defer close(errs)
+			defer close(sent)
+			for _, event := range events {
+				if event.ResumeToken <= opts.ResumeToken {
+					continue
+				}
+				select {
+				case sent <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+			<-ctx.Done()
+		}()
+		return sent, errs
+	}
+	return &resumeTokens
+}
+
+var sinkTestEvents = []parser.WatchEvent{
+	{Type: parser.WatchAdded, Node: "d", Key: "uid-1", Data: map[string]interface{}{"name": "web"}, ResumeToken: "1"},
+	{Type: parser.WatchBookmark, ResumeToken: "2"},
+	{Type: parser.WatchDeleted, Node: "d", Key: "uid-1", Data: map[string]interface{}{"name": "web"}, ResumeToken: "3"},
+}
+
+// failingPublisher fails to publish the message of its failure, passing the others to messages
+type failingPublisher struct {
+	failure  int
+	messages chan sinkMessage
+}
+
+func (p *failingPublisher) publish(ctx context.Context, key string, payload []byte) error {
+	p.failure--
+	if p.failure == 0 {
+		return errors.New("bus unavailable")
+	}
+	var message sinkMessage
+	json.Unmarshal(payload, &message)
+	p.messages <- message
+	return nil
+}
+
+func (p *failingPublisher) close() error { return nil }
+
+func TestQuerySinkResumes(t *testing.T) {
+	resumeTokens := stubSinkWatch(t, sinkTestEvents...)
+	originalRetryInterval := sinkRetryInterval
+	t.Cleanup(func() { sinkRetryInterval = originalRetryInterval })
+	sinkRetryInterval = time.Millisecond
+
+	sink, err := newQuerySink(sinkConfig{Name: "cmdb", Type: "nats", URL: "nats://localhost:4222", Topic: "cluster.deployments", Query: "MATCH (d:Deployment) RETURN d.metadata.name"})
+	if err != nil {
+		t.Fatalf("newQuerySink() error = %v", err)
+	}
+	publisher := &failingPublisher{failure: 2, messages: make(chan sinkMessage, 10)}
+	sink.publisher = publisher
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	go sink.run(ctx)
+
+	var types []string
+	for len(types) < 2 {
+		select {
+		case message := <-publisher.messages:
+			if message.Schema != sinkSchema || message.Sink != "cmdb" || message.Key != "uid-1" {
+				t.Errorf("unexpected message %+v", message)
+			}
+			types = append(types, message.Type)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected the events to be published, got %v", types)
+		}
+	}
+	stop()
+	// The deletion failed to publish, so the watch resumes after the bookmark
+	if !reflect.DeepEqual(types, []string{"added", "deleted"}) || !reflect.DeepEqual((*resumeTokens)[:2], []string{"", "2"}) {
+		t.Errorf("expected the deletion to be published again after resuming, got %v from %v", types, *resumeTokens)
+	}
+}
+
+func TestKafkaRESTPublisher(t *testing.T) {
+	var paths, contentTypes []string
+	var bodies []map[string]interface{}
+	failing := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		paths, contentTypes, bodies = append(paths, r.URL.Path), append(contentTypes, r.Header.Get("Content-Type")), append(bodies, body)
+		if failing {
+			w.Write([]byte(`{"offsets": [{"partition": null, "offset": null, "error_code": 50003, "error": "broker unavailable"}]}`))
+			return
+		}
+		w.Write([]byte(`{"offsets": [{"partition": 0, "offset": 7}]}`))
+	}))
+	defer server.Close()
+
+	sink, err := newQuerySink(sinkConfig{Name: "lake", Type: "kafka-rest", URL: server.URL + "/", Topic: "cluster-events", Query: "MATCH (p:Pod) RETURN p"})
+	if err != nil {
+		t.Fatalf("newQuerySink() error = %v", err)
+	}
+	if err := sink.publisher.publish(context.Background(), "uid-1", []byte(`{"schema": "cyphernetes.watch-event.v1"}`)); err != nil {
+		t.Fatalf("publish() error = %v", err)
+	}
+	expected := map[string]interface{}{"records": []interface{}{map[string]interface{}{"key": "uid-1", "value": map[string]interface{}{"schema": "cyphernetes.watch-event.v1"}}}}
+	if paths[0] != "/topics/cluster-events" || contentTypes[0] != "application/vnd.kafka.json.v2+json" || !reflect.DeepEqual(bodies[0], expected) {
+		t.Errorf("unexpected request to %s (%s): %v", paths[0], contentTypes[0], bodies[0])
+	}
+
+	failing = true
+	if err := sink.publisher.publish(context.Background(), "uid-1", []byte(`{}`)); err == nil || !strings.Contains(err.Error(), "broker unavailable") {
+		t.Errorf("expected the error of the record, got %v", err)
+	}
+}
+
+// natsServer accepts a NATS client, greeting it with info and sending the lines it receives to received
+func natsServer(t *testing.T, info string, received chan<- string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.WriteString(conn, "INFO "+info+"\r\n")
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimSpace(line)
+			switch {
+			case line == "PING":
+				io.WriteString(conn, "PONG\r\n")
+			case strings.HasPrefix(line, "PUB "):
+				var subject string
+				var size int
+				fmt.Sscanf(line, "PUB %s %d", &subject, &size)
+				payload := make([]byte, size+2)
+				io.ReadFull(reader, payload)
+				line = fmt.Sprintf("PUB %s %s", subject, payload[:size])
+			}
+			received <- line
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestNATSPublisher(t *testing.T) {
+	received := make(chan string, 10)
+	address := natsServer(t, `{"server_id": "test", "max_payload": 1048576}`, received)
+	sink, err := newQuerySink(sinkConfig{Name: "cmdb", Type: "nats", URL: "nats://bot:secret@" + address, Topic: "cluster.pods", Query: "MATCH (p:Pod) RETURN p"})
+	if err != nil {
+		t.Fatalf("newQuerySink() error = %v", err)
+	}
+	defer sink.publisher.close()
+	if err := sink.publisher.publish(context.Background(), "uid-1", []byte(`{"type":"added"}`)); err != nil {
+		t.Fatalf("publish() error = %v", err)
+	}
+
+	var connect map[string]interface{}
+	json.Unmarshal([]byte(strings.TrimPrefix(<-received, "CONNECT ")), &connect)
+	if connect["user"] != "bot" || connect["pass"] != "secret" || connect["verbose"] != false {
+		t.Errorf("unexpected CONNECT options %v", connect)
+	}
+	var lines []string
+	for len(lines) < 3 {
+		lines = append(lines, <-received)
+	}
+	if !reflect.DeepEqual(lines, []string{"PING", `PUB cluster.pods {"type":"added"}`, "PING"}) {
+		t.Errorf("expected the message to be published to the subject, got %v", lines)
+	}
+}
+
+func TestNATSPublisherRequiresTLS(t *testing.T) {
+	received := make(chan string, 10)
+	address := natsServer(t, `{"server_id": "test", "max_payload": 1048576, "tls_required": true}`, received)
+	sink, err := newQuerySink(sinkConfig{Name: "cmdb", Type: "nats", URL: "nats://bot:secret@" + address, Topic: "cluster.pods", Query: "MATCH (p:Pod) RETURN p"})
+	if err != nil {
+		t.Fatalf("newQuerySink() error = %v", err)
+	}
+	defer sink.publisher.close()
+	// The server doesn't speak TLS, so the handshake fails before the credentials are sent
+	if err := sink.publisher.publish(context.Background(), "uid-1", []byte(`{"type":"added"}`)); err == nil {
+		t.Fatal("expected the connection to fail without TLS")
+	}
+	select {
+	case line := <-received:
+		if strings.HasPrefix(line, "CONNECT") {
+			t.Errorf("expected the credentials not to be sent in clear text, got %q", line)
+		}
+	default:
+	}
+}
+
+func TestLoadSinkConfig(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config.yaml")
+	os.WriteFile(config, []byte(`sinks:
+  - name: cmdb
+    type: kafka-rest
+    url: http://kafka-rest:8082
+    topic: cluster-deployments
+    query: MATCH (d:Deployment) RETURN d.metadata.name, d.spec.replicas
+    namespace: prod
+`), 0600)
+	settings, err := loadServerSettings(config, serverSettings{})
+	if err != nil {
+		t.Fatalf("loadServerSettings() error = %v", err)
+	}
+	if len(settings.sinks) != 1 || settings.sinks[0].config.Namespace != "prod" {
+		t.Fatalf("expected the cmdb sink, got %+v", settings.sinks)
+	}
+	if _, ok := settings.sinks[0].publisher.(*kafkaRESTPublisher); !ok {
+		t.Errorf("expected a Kafka REST publisher, got %T", settings.sinks[0].publisher)
+	}
+
+	for _, sinks := range [][]sinkConfig{
+		{{Name: "a", Type: "rabbitmq", URL: "amqp://localhost", Topic: "t", Query: "MATCH (p:Pod) RETURN p"}},
+		{{Name: "a", Type: "kafka", URL: "kafka:9092", Topic: "t", Query: "MATCH (p:Pod) RETURN p"}},
+		{{Name: "a", Type: "kafka-rest", URL: "kafka:9092", Topic: "t", Query: "MATCH (p:Pod) RETURN p"}},
+		{{Name: "a", Type: "nats", URL: "localhost:4222", Topic: "t", Query: "MATCH (p:Pod) RETURN p"}},
+		{{Name: "a", Type: "nats", URL: "nats://localhost:4222", Topic: "t"}},
+		{{Name: "a", Type: "nats", URL: "nats://localhost:4222", Topic: "t", Query: "MATCH (p:Pod"}},
+		{
+			{Name: "a", Type: "nats", URL: "nats://localhost:4222", Topic: "t", Query: "MATCH (p:Pod) RETURN p"},
+			{Name: "a", Type: "nats", URL: "nats://localhost:4222", Topic: "u", Query: "MATCH (p:Pod) RETURN p"},
+		},
+	} {
+		if _, err := newQuerySinks(sinks); err == nil {
+			t.Errorf("expected %+v to be invalid", sinks)
+		}
+	}
+}
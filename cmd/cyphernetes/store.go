@@ -0,0 +1,331 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+// The web and audit commands keep what users save, such as dashboards, and what they need to remember between
+// runs, such as the findings of audits, as JSON documents in a state store. --store picks the store:
+//
+//   - file, the default, keeps each document in a JSON file under ~/.cyphernetes
+//   - memory keeps them until the command exits, e.g. for demos
+//   - sqlite:<path> keeps them in a SQLite database file
+//   - postgres://... keeps them in a PostgreSQL database, for servers that must not lose their state
+//
+// Documents are named after what they hold, e.g. dashboards or audit/<policy name>, and are read and written whole.
+
+// stateStore keeps JSON documents by name
+type stateStore interface {
+	// Load decodes the document of a name into v, leaving v untouched if there is none
+	Load(name string, v interface{}) error
+	// Save replaces the document of a name with v
+	Save(name string, v interface{}) error
+	// Names lists the names of the documents, sorted
+	Names() ([]string, error)
+	Close() error
+}
+
+// stateDocuments are the documents the commands keep, and stateCollections the prefixes of the names of documents
+// kept per item, e.g. audit/<policy name>
+var (
+	stateDocuments   = []string{"dashboards", "acknowledgements"}
+	stateCollections = []string{"audit"}
+)
+
+// storeURL is the --store flag of the web and audit commands
+var storeURL string
+
+// stateStorage is the store the commands opened, the files under ~/.cyphernetes until they open one
+var stateStorage stateStore
+
+func serverState() stateStore {
+	if stateStorage == nil {
+		stateStorage = defaultFileStore()
+	}
+	return stateStorage
+}
+
+// openStateStore opens the store of a --store value, see above
+func openStateStore(url string) (stateStore, error) {
+	switch {
+	case url == "" || url == "file":
+		return defaultFileStore(), nil
+	case url == "memory":
+		return &memoryStore{documents: map[string][]byte{}}, nil
+	case strings.HasPrefix(url, "sqlite:"):
+		path := strings.TrimPrefix(strings.TrimPrefix(url, "sqlite:"), "//")
+		if path == "" {
+			return nil, fmt.Errorf("sqlite store needs a database file, e.g. sqlite:/var/lib/cyphernetes/state.db")
+		}
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			return nil, fmt.Errorf("error opening sqlite store: %w", err)
+		}
+		return openSQLStore("sqlite", path)
+	case strings.HasPrefix(url, "postgres://") || strings.HasPrefix(url, "postgresql://"):
+		return openSQLStore("postgres", url)
+	}
+	return nil, fmt.Errorf("unknown store %q, expected file, memory, sqlite:<path> or postgres://<url>", url)
+}
+
+// fileStore keeps each document in a JSON file named after it, under dir
+type fileStore struct {
+	dir string
+	// files overrides the files of documents, e.g. --dashboards-file
+	files map[string]string
+}
+
+func defaultFileStore() *fileStore {
+	return &fileStore{dir: webStoreFile(""), files: map[string]string{
+		"dashboards":       dashboardsFile,
+		"acknowledgements": acknowledgementsFile,
+	}}
+}
+
+func (s *fileStore) file(name string) string {
+	if file := s.files[name]; file != "" {
+		return file
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(name)+".json")
+}
+
+func (s *fileStore) Load(name string, v interface{}) error {
+	return readJSONFile(s.file(name), v)
+}
+
+func (s *fileStore) Save(name string, v interface{}) error {
+	return writeJSONFile(s.file(name), v)
+}
+
+// Names lists the documents of the file store. ~/.cyphernetes holds more than documents, e.g. the shell's history,
+// so only the files of the known documents and collections of documents are listed.
+func (s *fileStore) Names() ([]string, error) {
+	names := []string{}
+	for _, name := range stateDocuments {
+		if _, err := os.Stat(s.file(name)); err == nil {
+			names = append(names, name)
+		}
+	}
+	for name := range s.files {
+		if _, err := os.Stat(s.files[name]); err == nil && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	for _, collection := range stateCollections {
+		files, err := filepath.Glob(filepath.Join(s.dir, collection, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			name := collection + "/" + strings.TrimSuffix(filepath.Base(file), ".json")
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *fileStore) Close() error {
+	return nil
+}
+
+// memoryStore keeps documents encoded, so that what is loaded doesn't share anything with what was saved
+type memoryStore struct {
+	mu        sync.Mutex
+	documents map[string][]byte
+}
+
+func (s *memoryStore) Load(name string, v interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.documents[name]
+	if !ok {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (s *memoryStore) Save(name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("error saving %s: %w", name, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.documents[name] = data
+	return nil
+}
+
+func (s *memoryStore) Names() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := []string{}
+	for name := range s.documents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
+
+// sqlStore keeps documents in the cyphernetes_state table of a SQLite or PostgreSQL database, which it creates
+type sqlStore struct {
+	db     *sql.DB
+	driver string
+}
+
+func openSQLStore(driver, dataSource string) (*sqlStore, error) {
+	db, err := sql.Open(driver, dataSource)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s store: %w", driver, err)
+	}
+	s := &sqlStore{db: db, driver: driver}
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS cyphernetes_state (name TEXT PRIMARY KEY, data TEXT NOT NULL, updated_at TIMESTAMP NOT NULL)`); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error opening %s store: %w", driver, err)
+	}
+	return s, nil
+}
+
+// query replaces the ? placeholders of a query with PostgreSQL's $1, $2...
+func (s *sqlStore) query(query string) string {
+	if s.driver != "postgres" {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, ch := range query {
+		if ch == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(ch)
+	}
+	return b.String()
+}
+
+func (s *sqlStore) Load(name string, v interface{}) error {
+	var data string
+	err := s.db.QueryRow(s.query(`SELECT data FROM cyphernetes_state WHERE name = ?`), name).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", name, err)
+	}
+	if err := json.Unmarshal([]byte(data), v); err != nil {
+		return fmt.Errorf("error parsing %s: %w", name, err)
+	}
+	return nil
+}
+
+func (s *sqlStore) Save(name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("error saving %s: %w", name, err)
+	}
+	_, err = s.db.Exec(s.query(`INSERT INTO cyphernetes_state (name, data, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET data = excluded.data, updated_at = excluded.updated_at`), name, string(data), time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("error saving %s: %w", name, err)
+	}
+	return nil
+}
+
+func (s *sqlStore) Names() ([]string, error) {
+	rows, err := s.db.Query(`SELECT name FROM cyphernetes_state ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("error listing documents: %w", err)
+	}
+	defer rows.Close()
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("error listing documents: %w", err)
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
+
+func webStoreFile(name string) string {
+	return filepath.Join(os.Getenv("HOME"), ".cyphernetes", name)
+}
+
+// readJSONFile decodes a file into v, leaving v untouched if the file doesn't exist
+func readJSONFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	return nil
+}
+
+// writeJSONFile writes v to a temporary file first, so that a failed write doesn't lose what the file held
+func writeJSONFile(path string, v interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	return nil
+}
+
+// newRecordID is a random id for a saved record
+func newRecordID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// requestIdentity is the identity of an authenticated API request, nil if the server doesn't authenticate them
+func requestIdentity(c *gin.Context) *apiIdentity {
+	value, ok := c.Get(identityKey)
+	if !ok {
+		return nil
+	}
+	return value.(*apiIdentity)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func testStateStore(t *testing.T, store stateStore) {
+	t.Helper()
+	var missing []string
+	if err := store.Load("dashboards", &missing); err != nil || missing != nil {
+		t.Fatalf("expected a missing document to load nothing, got %v, %v", missing, err)
+	}
+
+	saved := []map[string]interface{}{{"id": "1", "title": "Pods"}}
+	if err := store.Save("dashboards", saved); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	saved[0]["title"] = "Changed after saving"
+	if err := store.Save("audit/baseline", map[string]interface{}{"ranAt": "2026-01-01T00:00:00Z"}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	var loaded []map[string]interface{}
+	if err := store.Load("dashboards", &loaded); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if expected := []map[string]interface{}{{"id": "1", "title": "Pods"}}; !reflect.DeepEqual(loaded, expected) {
+		t.Errorf("expected %v, got %v", expected, loaded)
+	}
+
+	// Saving replaces the document
+	if err := store.Save("dashboards", []map[string]interface{}{}); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	loaded = nil
+	if err := store.Load("dashboards", &loaded); err != nil || len(loaded) != 0 {
+		t.Errorf("expected the document to be replaced, got %v, %v", loaded, err)
+	}
+	var state map[string]interface{}
+	if err := store.Load("audit/baseline", &state); err != nil || state["ranAt"] != "2026-01-01T00:00:00Z" {
+		t.Errorf("expected the other document to be kept, got %v, %v", state, err)
+	}
+	if names, err := store.Names(); err != nil || !reflect.DeepEqual(names, []string{"audit/baseline", "dashboards"}) {
+		t.Errorf("expected both documents to be listed, got %v, %v", names, err)
+	}
+}
+
+func TestStateStores(t *testing.T) {
+	dir := t.TempDir()
+	stores := map[string]string{
+		"memory": "memory",
+		"sqlite": "sqlite:" + filepath.Join(dir, "state", "cyphernetes.db"),
+	}
+	// PostgreSQL is only tested against a database given by the environment
+	if url := os.Getenv("CYPHERNETES_TEST_POSTGRES_URL"); url != "" {
+		stores["postgres"] = url
+	}
+	for name, url := range stores {
+		t.Run(name, func(t *testing.T) {
+			store, err := openStateStore(url)
+			if err != nil {
+				t.Fatalf("openStateStore(%q) error = %v", url, err)
+			}
+			defer store.Close()
+			testStateStore(t, store)
+		})
+	}
+
+	t.Run("file", func(t *testing.T) {
+		store := &fileStore{dir: filepath.Join(dir, "files"), files: map[string]string{"dashboards": filepath.Join(dir, "dashboards.json")}}
+		testStateStore(t, store)
+		for _, file := range []string{filepath.Join(dir, "dashboards.json"), filepath.Join(dir, "files", "audit", "baseline.json")} {
+			if _, err := os.Stat(file); err != nil {
+				t.Errorf("expected the document in %s: %v", file, err)
+			}
+		}
+	})
+
+	// A SQLite database keeps its documents once closed
+	url := "sqlite:" + filepath.Join(dir, "state", "cyphernetes.db")
+	store, err := openStateStore(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	var state map[string]interface{}
+	if err := store.Load("audit/baseline", &state); err != nil || state == nil {
+		t.Errorf("expected the document to be kept, got %v, %v", state, err)
+	}
+
+	for _, url := range []string{"sqlite:", "mysql://localhost/cyphernetes", "s3"} {
+		if _, err := openStateStore(url); err == nil {
+			t.Errorf("expected %q to be rejected", url)
+		}
+	}
+}
+
+func TestSQLStoreQuery(t *testing.T) {
+	query := `INSERT INTO cyphernetes_state (name, data) VALUES (?, ?)`
+	if got := (&sqlStore{driver: "sqlite"}).query(query); got != query {
+		t.Errorf("expected the query to be kept, got %s", got)
+	}
+	if got := (&sqlStore{driver: "postgres"}).query(query); got != `INSERT INTO cyphernetes_state (name, data) VALUES ($1, $2)` {
+		t.Errorf("unexpected query %s", got)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/wader/readline"
+)
+
+// -o table prints the table -o csv would as aligned columns for people to read, under an upper-cased header like
+// kubectl's. The table is fitted to the width of the terminal by truncating the values of its widest columns with an
+// ellipsis, unless --wide is given; when the output isn't a terminal, $COLUMNS is the width if set, and nothing is
+// truncated otherwise. Status-like columns, e.g. status.phase or reason, are colored by their values, Running green
+// and CrashLoopBackOff red, unless --no-color is given or NO_COLOR is set.
+
+// tableWide is the --wide flag
+var tableWide bool
+
+// noColor is the --no-color flag, printing results without colors
+var noColor bool
+
+// terminalWidth is the width -o table fits tables to, or 0 for none
+var terminalWidth = func() int {
+	fd := int(os.Stdout.Fd())
+	if readline.IsTerminal(fd) {
+		if width, _, err := readline.GetSize(fd); err == nil && width > 0 {
+			return width
+		}
+	}
+	width, _ := strconv.Atoi(os.Getenv("COLUMNS"))
+	return width
+}
+
+const (
+	// tableGap is the space between the columns of a table
+	tableGap = "  "
+	// minColumnWidth is the narrowest a column is truncated to
+	minColumnWidth = 8
+)
+
+// colorEnabled tells whether results may be printed with colors, which --no-color and NO_COLOR turn off
+func colorEnabled() bool {
+	return !noColor && os.Getenv("NO_COLOR") == ""
+}
+
+// alignedTablePrinter prints results as a table of aligned columns
+func alignedTablePrinter(data interface{}, w io.Writer) {
+	decoded, err := decodeResults(data)
+	if err != nil {
+		fmt.Fprintln(w, "Error marshalling results: ", err)
+		return
+	}
+	header, rows, err := tabulate(decoded)
+	if err != nil {
+		fmt.Fprintln(w, "Error formatting results: ", err)
+		return
+	}
+	if len(header) == 0 {
+		return
+	}
+	statuses := make([]bool, len(header))
+	for i, column := range header {
+		statuses[i] = isStatusColumn(column)
+		header[i] = strings.ToUpper(column)
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			row[i] = tsvEscaper.Replace(cell)
+		}
+	}
+
+	widths := make([]int, len(header))
+	for _, record := range append([][]string{header}, rows...) {
+		for i, cell := range record {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+	if !tableWide {
+		fitColumns(widths, terminalWidth())
+	}
+
+	color := colorEnabled()
+	for r, record := range append([][]string{header}, rows...) {
+		var sb strings.Builder
+		for i, cell := range record {
+			cell = truncateCell(cell, widths[i])
+			padding := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+			if color && r > 0 && statuses[i] {
+				cell = colorizeStatus(cell)
+			}
+			if i == len(record)-1 {
+				padding = ""
+			} else {
+				padding += tableGap
+			}
+			sb.WriteString(cell + padding)
+		}
+		fmt.Fprintln(w, sb.String())
+	}
+}
+
+// fitColumns narrows the widest columns until the table fits in width, as far as minColumnWidth allows
+func fitColumns(widths []int, width int) {
+	if width <= 0 {
+		return
+	}
+	total := func() int {
+		sum := len(tableGap) * (len(widths) - 1)
+		for _, w := range widths {
+			sum += w
+		}
+		return sum
+	}
+	for total() > width {
+		widest := 0
+		for i, w := range widths {
+			if w > widths[widest] {
+				widest = i
+			}
+		}
+		if widths[widest] <= minColumnWidth {
+			return
+		}
+		widths[widest]--
+	}
+}
+
+// truncateCell shortens a cell to width, ending it with an ellipsis
+func truncateCell(cell string, width int) string {
+	if utf8.RuneCountInString(cell) <= width {
+		return cell
+	}
+	runes := []rune(cell)
+	return string(runes[:width-1]) + "…"
+}
+
+// isStatusColumn tells whether a column holds statuses, e.g. status.phase or the reason of a container's state
+func isStatusColumn(column string) bool {
+	name := strings.ToLower(column[strings.LastIndex(column, ".")+1:])
+	for _, status := range []string{"phase", "status", "state", "reason"} {
+		if strings.HasSuffix(name, status) {
+			return true
+		}
+	}
+	return false
+}
+
+// The colors of statuses, by how healthy what they describe is
+var (
+	healthyStatuses = []string{"Running", "Succeeded", "Completed", "Ready", "Active", "Bound", "Available", "True"}
+	pendingStatuses = []string{"Pending", "ContainerCreating", "PodInitializing", "Terminating", "Unknown", "Progressing"}
+	failedStatuses  = []string{"Failed", "CrashLoopBackOff", "Error", "ImagePullBackOff", "ErrImagePull", "OOMKilled",
+		"Evicted", "Lost", "False", "CreateContainerConfigError", "InvalidImageName"}
+)
+
+// colorizeStatus colors a status green if it's healthy, yellow if it's pending and red if it failed. Lists of
+// statuses are colored by the worst of them.
+func colorizeStatus(cell string) string {
+	color := ""
+	for _, status := range strings.Split(strings.TrimSuffix(cell, "…"), ";") {
+		switch {
+		case containsStatus(failedStatuses, status):
+			color = "31"
+		case containsStatus(pendingStatuses, status) && color != "31":
+			color = "33"
+		case containsStatus(healthyStatuses, status) && color == "":
+			color = "32"
+		}
+	}
+	if color == "" {
+		return cell
+	}
+	return fmt.Sprintf("\033[%sm%s\033[0m", color, cell)
+}
+
+func containsStatus(statuses []string, status string) bool {
+	for _, s := range statuses {
+		if strings.EqualFold(s, status) {
+			return true
+		}
+	}
+	return false
+}
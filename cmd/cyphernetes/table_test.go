@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAlignedTablePrinter(t *testing.T) {
+	originalTerminalWidth := terminalWidth
+	defer func() {
+		terminalWidth = originalTerminalWidth
+		tableWide = false
+		noColor = false
+	}()
+	t.Setenv("NO_COLOR", "")
+	pods := map[string]interface{}{
+		"p": []interface{}{
+			map[string]interface{}{"name": "web-5d8f-x", "status": map[string]interface{}{"phase": "Running"}, "image": "registry.example.com/team/web:1.25.3"},
+			map[string]interface{}{"name": "api-7c9b-y", "status": map[string]interface{}{"phase": "Failed"}, "image": "api:2"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		width    int
+		wide     bool
+		noColor  bool
+		expected string
+	}{
+		{
+			name:    "Fits",
+			width:   0,
+			noColor: true,
+			expected: "NAME        IMAGE                                 STATUS.PHASE\n" +
+				"web-5d8f-x  registry.example.com/team/web:1.25.3  Running\n" +
+				"api-7c9b-y  api:2                                 Failed\n",
+		},
+		{
+			name:    "Truncated to the terminal",
+			width:   40,
+			noColor: true,
+			expected: "NAME        IMAGE           STATUS.PHASE\n" +
+				"web-5d8f-x  registry.exam…  Running\n" +
+				"api-7c9b-y  api:2           Failed\n",
+		},
+		{
+			name:    "Wide",
+			width:   40,
+			wide:    true,
+			noColor: true,
+			expected: "NAME        IMAGE                                 STATUS.PHASE\n" +
+				"web-5d8f-x  registry.example.com/team/web:1.25.3  Running\n" +
+				"api-7c9b-y  api:2                                 Failed\n",
+		},
+		{
+			name:  "Colored statuses",
+			width: 40,
+			expected: "NAME        IMAGE           STATUS.PHASE\n" +
+				"web-5d8f-x  registry.exam…  \033[32mRunning\033[0m\n" +
+				"api-7c9b-y  api:2           \033[31mFailed\033[0m\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			terminalWidth = func() int { return tt.width }
+			tableWide, noColor = tt.wide, tt.noColor
+			buf := new(bytes.Buffer)
+			alignedTablePrinter(pods, buf)
+			if buf.String() != tt.expected {
+				t.Errorf("expected:\n%q\ngot:\n%q", tt.expected, buf.String())
+			}
+		})
+	}
+
+	// NO_COLOR turns colors off like --no-color
+	t.Setenv("NO_COLOR", "1")
+	noColor = false
+	if colorEnabled() {
+		t.Error("expected NO_COLOR to turn colors off")
+	}
+}
+
+func TestColorizeStatus(t *testing.T) {
+	for cell, expected := range map[string]string{
+		"Running":                  "\033[32mRunning\033[0m",
+		"CrashLoopBackOff":         "\033[31mCrashLoopBackOff\033[0m",
+		"Pending":                  "\033[33mPending\033[0m",
+		"Running;CrashLoopBackOff": "\033[31mRunning;CrashLoopBackOff\033[0m",
+		"Running;Pending":          "\033[33mRunning;Pending\033[0m",
+		"Tuesday":                  "Tuesday",
+	} {
+		if got := colorizeStatus(cell); got != expected {
+			t.Errorf("%s: expected %q, got %q", cell, expected, got)
+		}
+	}
+}
@@ -0,0 +1,472 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
+	"github.com/spf13/cobra"
+)
+
+// Telemetry is off unless enabled with `cyphernetes telemetry enable`. Events are anonymized: they only
+// hold the shape of a query and the features it used, never names, kinds, values or cluster details.
+// They are kept locally for `cyphernetes stats`, and sent to the configured endpoint if there is one.
+
+// telemetryConfig is stored in ~/.cyphernetes/telemetry.json
+type telemetryConfig struct {
+	Enabled  bool   `json:"enabled"`
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// telemetryEvent is one anonymized query
+type telemetryEvent struct {
+	// Date is the day the query ran, without a time of day
+	Date     string   `json:"date"`
+	Command  string   `json:"command"`
+	Shape    string   `json:"shape,omitempty"`
+	Features []string `json:"features,omitempty"`
+	// Error is the class of error the query failed with (parse, execute)
+	Error string `json:"error,omitempty"`
+}
+
+// telemetryDisabledEnv turns telemetry off whatever the configuration says
+const telemetryDisabledEnv = "CYPHERNETES_TELEMETRY"
+
+var telemetryEndpoint string
+
+var telemetryClient = &http.Client{Timeout: time.Second}
+
+func telemetryDir() string {
+	return filepath.Join(os.Getenv("HOME"), ".cyphernetes")
+}
+
+func telemetryConfigFile() string {
+	return filepath.Join(telemetryDir(), "telemetry.json")
+}
+
+func telemetryEventsFile() string {
+	return filepath.Join(telemetryDir(), "telemetry.jsonl")
+}
+
+func loadTelemetryConfig() telemetryConfig {
+	config := telemetryConfig{}
+	data, err := os.ReadFile(telemetryConfigFile())
+	if err != nil {
+		return config
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return telemetryConfig{}
+	}
+	return config
+}
+
+func saveTelemetryConfig(config telemetryConfig) error {
+	if err := os.MkdirAll(telemetryDir(), os.ModePerm); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(telemetryConfigFile(), data, 0600)
+}
+
+// telemetryEnabled reports whether the user opted in, and didn't opt out through the environment
+func telemetryEnabled(config telemetryConfig) bool {
+	switch strings.ToLower(os.Getenv(telemetryDisabledEnv)) {
+	case "0", "off", "false", "no":
+		return false
+	}
+	if os.Getenv("DO_NOT_TRACK") == "1" {
+		return false
+	}
+	return config.Enabled
+}
+
+// recordQuery records a query run by command, if telemetry is enabled. ast is nil when the query
+// didn't parse. Failing to record is never reported, telemetry mustn't get in the way of queries.
+func recordQuery(command string, ast *parser.Expression, err error) {
+	config := loadTelemetryConfig()
+	if !telemetryEnabled(config) {
+		return
+	}
+
+	event := telemetryEvent{Date: time.Now().UTC().Format("2006-01-02"), Command: command}
+	if ast != nil {
+		event.Shape, event.Features = queryShape(ast)
+	}
+	if err != nil {
+		event.Error = "execute"
+		if ast == nil {
+			event.Error = "parse"
+		}
+	}
+
+	data, marshalErr := json.Marshal(event)
+	if marshalErr != nil {
+		return
+	}
+	if os.MkdirAll(telemetryDir(), os.ModePerm) == nil {
+		if file, err := os.OpenFile(telemetryEventsFile(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600); err == nil {
+			file.Write(append(data, '\n'))
+			file.Close()
+		}
+	}
+	if config.Endpoint != "" {
+		if resp, err := telemetryClient.Post(config.Endpoint, "application/json", bytes.NewReader(data)); err == nil {
+			resp.Body.Close()
+		}
+	}
+}
+
+// queryShape describes a query without any of its identifiers or values,
+// e.g. "MATCH(2n,1r) WHERE(1) RETURN(3)", along with the language features it uses
+func queryShape(ast *parser.Expression) (string, []string) {
+	features := map[string]bool{}
+	var parts []string
+	if ast.Explain {
+		parts = append(parts, "EXPLAIN")
+		features["explain"] = true
+	}
+	if ast.Apply != nil {
+		parts = append(parts, "APPLY")
+		features["apply"] = true
+	}
+
+	nodeFeatures := func(nodes []*parser.NodePattern) {
+		for _, node := range nodes {
+			kind := node.ResourceProperties.Kind
+			if kind == "*" {
+				features["wildcard-kind"] = true
+			} else if strings.Contains(kind, "|") {
+				features["multi-kind"] = true
+			}
+			if node.ResourceProperties.Properties != nil {
+				for _, prop := range node.ResourceProperties.Properties.PropertyList {
+					features["property-selector"] = true
+					if prop.Operator != "" {
+						features["selector-"+strings.ToLower(prop.Operator)] = true
+					}
+				}
+			}
+			if node.ResourceProperties.JsonData != "" {
+				features["json-data"] = true
+			}
+		}
+	}
+
+	// The clauses of the queries combined by UNION follow those of the first query, each after a nil clause
+	clauses := ast.Clauses
+	union := "UNION"
+	if ast.Union != nil {
+		clauses = slices.Clone(ast.Clauses)
+		features["union"] = true
+		if ast.Union.All {
+			union = "UNION-ALL"
+			features["union-all"] = true
+		}
+		for _, query := range ast.Union.Queries {
+			clauses = append(append(clauses, nil), query.Clauses...)
+		}
+	}
+
+	for _, clause := range clauses {
+		switch c := clause.(type) {
+		case nil:
+			parts = append(parts, union)
+		case *parser.MatchClause:
+			features["match"] = true
+			nodeFeatures(c.Nodes)
+			if len(c.Relationships) > 0 {
+				features["relationship"] = true
+			}
+			for _, rel := range c.Relationships {
+				if rel.Hops != nil {
+					features["variable-length"] = true
+				}
+				if rel.ResourceProperties != nil && rel.ResourceProperties.Kind == "" {
+					features["relationship-variable"] = true
+				}
+				if rel.Hops == nil && rel.LeftNode != nil && rel.RightNode != nil &&
+					(rel.LeftNode.ResourceProperties.Kind == "" || rel.RightNode.ResourceProperties.Kind == "") {
+					features["kindless-relationship"] = true
+				}
+			}
+			match := "MATCH"
+			if c.Optional {
+				features["optional-match"] = true
+				match = "OPTIONAL-MATCH"
+			}
+			parts = append(parts, fmt.Sprintf("%s(%dn,%dr)", match, len(c.Nodes), len(c.Relationships)))
+			if len(c.ExtraFilters) > 0 {
+				features["where"] = true
+				for _, filter := range c.ExtraFilters {
+					features["where-"+strings.ToLower(filter.Operator)] = true
+					if filter.Function != "" {
+						features["function-"+strings.ToLower(filter.Function)] = true
+					}
+					if _, ok := filter.Value.(*parser.TemporalExpression); ok {
+						features["temporal"] = true
+					}
+				}
+				parts = append(parts, fmt.Sprintf("WHERE(%d)", len(c.ExtraFilters)))
+			}
+		case *parser.SetClause:
+			features["set"] = true
+			if c.Status {
+				features["set-status"] = true
+			}
+			parts = append(parts, fmt.Sprintf("SET(%d)", len(c.KeyValuePairs)))
+		case *parser.DeleteClause:
+			features["delete"] = true
+			parts = append(parts, fmt.Sprintf("DELETE(%d)", len(c.NodeIds)))
+		case *parser.OperationClause:
+			features[c.Operation] = true
+			parts = append(parts, fmt.Sprintf("%s(%d)", strings.ToUpper(c.Operation), len(c.NodeIds)))
+		case *parser.CreateClause:
+			features["create"] = true
+			nodeFeatures(c.Nodes)
+			parts = append(parts, fmt.Sprintf("CREATE(%dn,%dr)", len(c.Nodes), len(c.Relationships)))
+		case *parser.MergeClause:
+			features["merge"] = true
+			nodeFeatures([]*parser.NodePattern{c.Node})
+			parts = append(parts, "MERGE")
+		case *parser.WithClause:
+			features["with"] = true
+			for _, item := range c.Items {
+				if item.Aggregate != "" {
+					features["aggregate-"+strings.ToLower(item.Aggregate)] = true
+				}
+			}
+			parts = append(parts, fmt.Sprintf("WITH(%d)", len(c.Items)))
+			if len(c.ExtraFilters) > 0 {
+				features["where"] = true
+				parts = append(parts, fmt.Sprintf("WHERE(%d)", len(c.ExtraFilters)))
+			}
+		case *parser.UnwindClause:
+			features["unwind"] = true
+			parts = append(parts, "UNWIND")
+		case *parser.ReturnClause:
+			features["return"] = true
+			if c.Distinct {
+				features["distinct"] = true
+			}
+			for _, item := range c.Items {
+				if item.Aggregate != "" {
+					features["aggregate-"+strings.ToLower(item.Aggregate)] = true
+				}
+				if item.Function != "" {
+					features["function-"+strings.ToLower(item.Function)] = true
+				}
+				if item.Alias != "" {
+					features["alias"] = true
+				}
+			}
+			parts = append(parts, fmt.Sprintf("RETURN(%d)", len(c.Items)))
+		}
+	}
+
+	if ast.Apply != nil {
+		parts = append(parts, "WHILE")
+	}
+
+	var featureList []string
+	for feature := range features {
+		featureList = append(featureList, feature)
+	}
+	sort.Strings(featureList)
+	return strings.Join(parts, " "), featureList
+}
+
+var telemetryCmd = &cobra.Command{
+	Use:   "telemetry",
+	Short: "Show whether anonymized usage telemetry is enabled",
+	Long: `Telemetry is off unless you enable it. Once enabled, each query is recorded locally as an anonymized
+event holding the shape of the query, the language features it used and the class of error it failed with,
+if any. Names, kinds, values and cluster details are never recorded. Events are summarized by 'cyphernetes stats'
+and, if an endpoint is configured, sent to it. Set ` + telemetryDisabledEnv + `=off (or DO_NOT_TRACK=1) to turn
+telemetry off regardless of this setting.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		printTelemetryStatus(os.Stdout)
+	},
+}
+
+var telemetryEnableCmd = &cobra.Command{
+	Use:   "enable",
+	Short: "Opt in to anonymized usage telemetry",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config := loadTelemetryConfig()
+		config.Enabled = true
+		if cmd.Flags().Changed("endpoint") {
+			config.Endpoint = telemetryEndpoint
+		}
+		if err := saveTelemetryConfig(config); err != nil {
+			return fmt.Errorf("error saving telemetry settings >> %w", err)
+		}
+		printTelemetryStatus(os.Stdout)
+		return nil
+	},
+}
+
+var telemetryDisableCmd = &cobra.Command{
+	Use:   "disable",
+	Short: "Turn usage telemetry off",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config := loadTelemetryConfig()
+		config.Enabled = false
+		if err := saveTelemetryConfig(config); err != nil {
+			return fmt.Errorf("error saving telemetry settings >> %w", err)
+		}
+		printTelemetryStatus(os.Stdout)
+		return nil
+	},
+}
+
+var telemetryClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Delete the locally recorded telemetry events",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := os.Remove(telemetryEventsFile()); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error deleting telemetry events >> %w", err)
+		}
+		fmt.Println("Telemetry events deleted")
+		return nil
+	},
+}
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Summarize your own usage, as recorded by telemetry",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := printStats(os.Stdout); err != nil {
+			return fmt.Errorf("error reading telemetry events >> %w", err)
+		}
+		return nil
+	},
+}
+
+func printTelemetryStatus(w io.Writer) {
+	config := loadTelemetryConfig()
+	switch {
+	case telemetryEnabled(config):
+		fmt.Fprintln(w, "Telemetry is enabled, events are recorded in "+telemetryEventsFile())
+		if config.Endpoint != "" {
+			fmt.Fprintln(w, "Events are sent to "+config.Endpoint)
+		}
+		fmt.Fprintln(w, "Turn it off with: cyphernetes telemetry disable")
+	case config.Enabled:
+		fmt.Fprintln(w, "Telemetry is disabled by the environment ("+telemetryDisabledEnv+" or DO_NOT_TRACK)")
+	default:
+		fmt.Fprintln(w, "Telemetry is disabled, opt in with: cyphernetes telemetry enable")
+	}
+}
+
+type statsCount struct {
+	name  string
+	count int
+}
+
+func printStats(w io.Writer) error {
+	file, err := os.Open(telemetryEventsFile())
+	if os.IsNotExist(err) {
+		fmt.Fprintln(w, "No usage recorded yet.")
+		if !telemetryEnabled(loadTelemetryConfig()) {
+			fmt.Fprintln(w, "Usage is only recorded with telemetry enabled: cyphernetes telemetry enable")
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	total, failed := 0, 0
+	var firstDate, lastDate string
+	commands, features, shapes, errorClasses := map[string]int{}, map[string]int{}, map[string]int{}, map[string]int{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event telemetryEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+		total++
+		if firstDate == "" || event.Date < firstDate {
+			firstDate = event.Date
+		}
+		if event.Date > lastDate {
+			lastDate = event.Date
+		}
+		commands[event.Command]++
+		for _, feature := range event.Features {
+			features[feature]++
+		}
+		if event.Shape != "" {
+			shapes[event.Shape]++
+		}
+		if event.Error != "" {
+			failed++
+			errorClasses[event.Error]++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if total == 0 {
+		fmt.Fprintln(w, "No usage recorded yet.")
+		return nil
+	}
+
+	fmt.Fprintf(w, "%d queries from %s to %s, %d failed\n", total, firstDate, lastDate, failed)
+	printStatsSection(w, "Commands", commands, 0)
+	printStatsSection(w, "Features", features, 0)
+	printStatsSection(w, "Top query shapes", shapes, 5)
+	printStatsSection(w, "Errors", errorClasses, 0)
+	return nil
+}
+
+// printStatsSection prints counts from most to least frequent, limited to the top entries if limit > 0
+func printStatsSection(w io.Writer, title string, counts map[string]int, limit int) {
+	if len(counts) == 0 {
+		return
+	}
+	var sorted []statsCount
+	for name, count := range counts {
+		sorted = append(sorted, statsCount{name, count})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].count != sorted[j].count {
+			return sorted[i].count > sorted[j].count
+		}
+		return sorted[i].name < sorted[j].name
+	})
+	if limit > 0 && len(sorted) > limit {
+		sorted = sorted[:limit]
+	}
+
+	fmt.Fprintf(w, "\n%s:\n", title)
+	for _, entry := range sorted {
+		fmt.Fprintf(w, "  %5d  %s\n", entry.count, entry.name)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(telemetryCmd)
+	rootCmd.AddCommand(statsCmd)
+	telemetryCmd.AddCommand(telemetryEnableCmd, telemetryDisableCmd, telemetryClearCmd)
+	telemetryEnableCmd.Flags().StringVar(&telemetryEndpoint, "endpoint", "", "URL to send anonymized events to (default: keep them local)")
+}
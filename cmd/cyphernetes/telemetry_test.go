@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
+)
+
+func TestRecordQuery(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(telemetryDisabledEnv, "")
+	t.Setenv("DO_NOT_TRACK", "")
+
+	ast, err := parser.ParseQuery(`MATCH (d:Deployment {name: "nginx", app IN ["web"]})->(s:Service) WHERE d.spec.replicas > 2 RETURN d.metadata.name AS secret, COUNT{s} AS services`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+
+	recordQuery("query", ast, nil)
+	if _, err := os.Stat(telemetryEventsFile()); !os.IsNotExist(err) {
+		t.Fatalf("Expected nothing to be recorded before opting in")
+	}
+
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, string(body))
+	}))
+	defer server.Close()
+	if err := saveTelemetryConfig(telemetryConfig{Enabled: true, Endpoint: server.URL}); err != nil {
+		t.Fatalf("saveTelemetryConfig() error = %v", err)
+	}
+
+	recordQuery("query", ast, nil)
+	recordQuery("shell", nil, fmt.Errorf("unexpected token"))
+	t.Setenv(telemetryDisabledEnv, "off")
+	recordQuery("shell", ast, nil)
+
+	data, err := os.ReadFile(telemetryEventsFile())
+	if err != nil {
+		t.Fatalf("Expected events to be recorded: %v", err)
+	}
+	events := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(events) != 2 || len(received) != 2 {
+		t.Fatalf("Expected 2 events recorded and sent, got %d and %d:\n%s", len(events), len(received), data)
+	}
+	if !strings.Contains(events[0], `"shape":"MATCH(2n,1r) WHERE(1) RETURN(2)"`) ||
+		!strings.Contains(events[0], `"features":["aggregate-count","alias","match","property-selector","relationship","return","selector-in","where","where-greater_than"]`) {
+		t.Errorf("Unexpected event: %s", events[0])
+	}
+	if !strings.Contains(events[1], `"command":"shell"`) || !strings.Contains(events[1], `"error":"parse"`) {
+		t.Errorf("Unexpected event: %s", events[1])
+	}
+	for _, identifier := range []string{"nginx", "Deployment", "Service", "web", "replicas", "secret", "unexpected token"} {
+		if strings.Contains(string(data), identifier) || strings.Contains(received[0], identifier) {
+			t.Errorf("Expected %q to be redacted from the events:\n%s", identifier, data)
+		}
+	}
+}
+
+func TestPrintStats(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(telemetryDisabledEnv, "")
+	t.Setenv("DO_NOT_TRACK", "")
+
+	var buf bytes.Buffer
+	if err := printStats(&buf); err != nil {
+		t.Fatalf("printStats() error = %v", err)
+	}
+	if buf.String() != "No usage recorded yet.\nUsage is only recorded with telemetry enabled: cyphernetes telemetry enable\n" {
+		t.Errorf("Unexpected output: %q", buf.String())
+	}
+
+	os.MkdirAll(telemetryDir(), os.ModePerm)
+	events := `{"date":"2026-10-02","command":"shell","shape":"MATCH(1n,0r) RETURN(1)","features":["match","return"]}
+{"date":"2026-10-01","command":"query","shape":"MATCH(1n,0r) RETURN(1)","features":["match","return"]}
+{"date":"2026-10-03","command":"shell","error":"parse"}
+`
+	if err := os.WriteFile(telemetryEventsFile(), []byte(events), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	buf.Reset()
+	if err := printStats(&buf); err != nil {
+		t.Fatalf("printStats() error = %v", err)
+	}
+	expected := `3 queries from 2026-10-01 to 2026-10-03, 1 failed
+
+Commands:
+      2  shell
+      1  query
+
+Features:
+      2  match
+      2  return
+
+Top query shapes:
+      2  MATCH(1n,0r) RETURN(1)
+
+Errors:
+      1  parse
+`
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+}
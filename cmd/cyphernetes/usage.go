@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"runtime/debug"
+	runtimemetrics "runtime/metrics"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// queryMaxMemory holds the --max-memory flag, and queryProfile the --profile flag
+var queryMaxMemory string
+var queryProfile bool
+
+// usageInterval is how often the memory of the process is sampled while a query runs
+var usageInterval = 50 * time.Millisecond
+
+// usageSamples are the runtime metrics read by the usage monitor: the memory the Go runtime holds minus what it
+// returned to the OS, as bounded by debug.SetMemoryLimit, and the CPU time spent, idle time included
+var usageSamples = []string{
+	"/memory/classes/total:bytes",
+	"/memory/classes/heap/released:bytes",
+	"/cpu/classes/total:cpu-seconds",
+	"/cpu/classes/idle:cpu-seconds",
+}
+
+// memoryLimitError is the cause of a query cancelled for using more memory than --max-memory allows
+type memoryLimitError struct {
+	limit string
+}
+
+func (e *memoryLimitError) Error() string {
+	return fmt.Sprintf("the query used more than %s of memory", e.limit)
+}
+
+// usageReport is what a query cost the process, as printed by --profile
+type usageReport struct {
+	Elapsed    time.Duration
+	CPU        time.Duration
+	PeakMemory uint64
+}
+
+// usageMonitor tracks the memory and CPU the process uses while a query runs, and cancels the query if its memory
+// goes over a limit
+type usageMonitor struct {
+	limit     uint64
+	limitFlag string
+	cancel    context.CancelCauseFunc
+	done      chan struct{}
+	wg        sync.WaitGroup
+	start     time.Time
+	startCPU  float64
+	peak      uint64
+	prevLimit int64
+	samples   []runtimemetrics.Sample
+}
+
+// parseMaxMemory parses --max-memory, a quantity such as 512Mi or 2G. It's 0 when the flag isn't set.
+func parseMaxMemory(value string) (uint64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil || quantity.Sign() <= 0 {
+		return 0, fmt.Errorf("invalid --max-memory %q, expected a size such as 512Mi or 2G", value)
+	}
+	return uint64(quantity.Value()), nil
+}
+
+// monitorUsage starts tracking the usage of the process. With a limit, the runtime is asked to collect garbage
+// harder as memory nears it, and the returned context is cancelled with a memoryLimitError once memory goes over it.
+func monitorUsage(ctx context.Context, limit uint64, limitFlag string) (context.Context, *usageMonitor) {
+	m := &usageMonitor{limit: limit, limitFlag: limitFlag, done: make(chan struct{}), start: time.Now()}
+	m.samples = make([]runtimemetrics.Sample, len(usageSamples))
+	for i, name := range usageSamples {
+		m.samples[i].Name = name
+	}
+	memory, cpu := m.read()
+	m.peak, m.startCPU = memory, cpu
+	ctx, m.cancel = context.WithCancelCause(ctx)
+	if limit > 0 {
+		m.prevLimit = debug.SetMemoryLimit(int64(min(limit, math.MaxInt64)))
+	}
+	m.wg.Add(1)
+	go m.run()
+	return ctx, m
+}
+
+func (m *usageMonitor) run() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(usageInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+			m.sample()
+		}
+	}
+}
+
+// sample records the memory in use, cancelling the query if it's over the limit
+func (m *usageMonitor) sample() {
+	memory, _ := m.read()
+	m.peak = max(m.peak, memory)
+	if m.limit > 0 && memory > m.limit {
+		m.cancel(&memoryLimitError{limit: m.limitFlag})
+	}
+}
+
+// read returns the memory in use and the CPU time spent by the process so far, in seconds
+func (m *usageMonitor) read() (uint64, float64) {
+	runtimemetrics.Read(m.samples)
+	var values [4]float64
+	for i, sample := range m.samples {
+		switch sample.Value.Kind() {
+		case runtimemetrics.KindUint64:
+			values[i] = float64(sample.Value.Uint64())
+		case runtimemetrics.KindFloat64:
+			values[i] = sample.Value.Float64()
+		}
+	}
+	return uint64(max(values[0]-values[1], 0)), max(values[2]-values[3], 0)
+}
+
+// stop stops tracking usage, restoring the memory limit of the runtime, and reports the usage of the query
+func (m *usageMonitor) stop() usageReport {
+	close(m.done)
+	m.wg.Wait()
+	m.cancel(nil)
+	if m.limit > 0 {
+		debug.SetMemoryLimit(m.prevLimit)
+	}
+	memory, cpu := m.read()
+	m.peak = max(m.peak, memory)
+	return usageReport{
+		Elapsed:    time.Since(m.start),
+		CPU:        time.Duration((cpu - m.startCPU) * float64(time.Second)),
+		PeakMemory: m.peak,
+	}
+}
+
+// printProfile prints the usage of a query, for --profile
+func printProfile(w io.Writer, report usageReport, apiCalls int64) {
+	fmt.Fprintf(w, "Profile: %s elapsed, %s CPU, %s peak memory, %d API calls\n",
+		report.Elapsed.Round(time.Millisecond), report.CPU.Round(time.Millisecond), formatBytes(report.PeakMemory), apiCalls)
+}
+
+// formatBytes formats a size in binary units, e.g. 85.3MiB
+func formatBytes(bytes uint64) string {
+	value := float64(bytes)
+	for _, unit := range []string{"B", "KiB", "MiB", "GiB"} {
+		if value < 1024 || unit == "GiB" {
+			if unit == "B" {
+				return fmt.Sprintf("%d%s", bytes, unit)
+			}
+			return fmt.Sprintf("%.1f%s", value, unit)
+		}
+		value /= 1024
+	}
+	return ""
+}
+
+// memoryLimitHint suggests how to make a query that went over --max-memory fit in it
+func memoryLimitHint(cause *memoryLimitError) string {
+	return fmt.Sprintf("Hint: %s (--max-memory). Bound its rows with --max-rows, which pages through the results of "+
+		"queries matching a single node; return only the fields you need, e.g. RETURN p.metadata.name rather than p; or "+
+		"narrow the match with WHERE, labels or a namespace", cause)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"runtime/debug"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
+)
+
+func TestParseMaxMemory(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    uint64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"512Mi", 512 << 20, false},
+		{"2G", 2000000000, false},
+		{"0", 0, true},
+		{"lots", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseMaxMemory(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseMaxMemory(%q) = %d, %v, want %d (error: %v)", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for value, want := range map[uint64]string{512: "512B", 1536: "1.5KiB", 85 << 20: "85.0MiB", 3 << 30: "3.0GiB"} {
+		if got := formatBytes(value); got != want {
+			t.Errorf("formatBytes(%d) = %s, want %s", value, got, want)
+		}
+	}
+}
+
+func TestMonitorUsageMemoryLimit(t *testing.T) {
+	originalInterval := usageInterval
+	usageInterval = time.Millisecond
+	defer func() { usageInterval = originalInterval }()
+
+	initialLimit := debug.SetMemoryLimit(-1)
+	ctx, usage := monitorUsage(context.Background(), 1, "1")
+	if limit := debug.SetMemoryLimit(-1); limit != 1 {
+		t.Errorf("expected the runtime's memory limit to be set, got %d", limit)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the query to be cancelled")
+	}
+	var memoryErr *memoryLimitError
+	if !errors.As(context.Cause(ctx), &memoryErr) {
+		t.Errorf("expected a memory limit error, got %v", context.Cause(ctx))
+	}
+	report := usage.stop()
+	if report.PeakMemory <= 1 {
+		t.Errorf("expected the peak memory to be reported, got %+v", report)
+	}
+	if limit := debug.SetMemoryLimit(-1); limit != initialLimit {
+		t.Errorf("expected the runtime's memory limit to be restored, got %d", limit)
+	}
+
+	// Without a limit, queries aren't cancelled
+	ctx, usage = monitorUsage(context.Background(), 0, "")
+	time.Sleep(10 * time.Millisecond)
+	if ctx.Err() != nil {
+		t.Errorf("expected the query to run, got %v", context.Cause(ctx))
+	}
+	usage.stop()
+}
+
+func TestRunQueryMaxMemory(t *testing.T) {
+	originalParseQuery := parseQuery
+	originalNewQueryExecutor := newQueryExecutor
+	originalExecuteMethod := executeMethod
+	originalInterval := usageInterval
+	defer func() {
+		parseQuery = originalParseQuery
+		newQueryExecutor = originalNewQueryExecutor
+		executeMethod = originalExecuteMethod
+		usageInterval = originalInterval
+		queryMaxMemory = ""
+		queryProfile = false
+	}()
+
+	parseQuery = func(query string) (*parser.Expression, error) {
+		return &parser.Expression{}, nil
+	}
+	newQueryExecutor = func() (*parser.QueryExecutor, error) {
+		return &parser.QueryExecutor{}, nil
+	}
+	executeMethod = func(qe *parser.QueryExecutor, ctx context.Context, expr *parser.Expression, namespace string) (parser.QueryResult, error) {
+		<-ctx.Done()
+		return parser.QueryResult{Data: map[string]interface{}{"p": []interface{}{"web-1"}}, Truncated: true}, ctx.Err()
+	}
+	usageInterval = time.Millisecond
+	queryMaxMemory = "1Ki"
+	queryProfile = true
+	buf := new(bytes.Buffer)
+	runQuery([]string{"MATCH (p:Pod) RETURN p"}, buf)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected an error, a hint and a profile, got:\n%s", buf.String())
+	}
+	if !strings.HasPrefix(lines[0], "Error executing query: ") {
+		t.Errorf("expected the query to fail, got %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "Hint: the query used more than 1Ki of memory (--max-memory)") || !strings.Contains(lines[1], "--max-rows") {
+		t.Errorf("expected a hint about bounding the query, got %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], "Profile: ") || !strings.HasSuffix(lines[2], "peak memory, 0 API calls") {
+		t.Errorf("expected the usage of the query, got %q", lines[2])
+	}
+
+	queryMaxMemory = "lots"
+	buf.Reset()
+	runQuery([]string{"MATCH (p:Pod) RETURN p"}, buf)
+	if !strings.Contains(buf.String(), `invalid --max-memory "lots"`) {
+		t.Errorf("expected an invalid flag error, got %q", buf.String())
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/avitaltamir/cyphernetes/pkg/parser"
+	"github.com/gin-gonic/gin"
+)
+
+// watchHeartbeat is how often a watch stream sends a heartbeat, so clients and proxies see it's alive
+var watchHeartbeat = 15 * time.Second
+
+// watchEvent is the data of a server-sent event of a watch stream
+type watchEvent struct {
+	Node string                 `json:"node,omitempty"`
+	Key  string                 `json:"key,omitempty"`
+	Data map[string]interface{} `json:"data,omitempty"`
+	// ResumeToken is also the id of the event, so browsers resume from it when they reconnect
+	ResumeToken string `json:"resumeToken,omitempty"`
+}
+
+// handleWatch streams the changes of the rows of a query as server-sent events, until the client goes away
+func handleWatch(c *gin.Context) {
+	ast, err := parser.ParseQuery(c.Query("query"))
+	if err != nil {
+		recordQuery("web", nil, err)
+		c.JSON(parseErrorStatus(err), errorResponse(err))
+		return
+	}
+	// The parameters of the query are given as a JSON object
+	var parameters map[string]interface{}
+	if value := c.Query("parameters"); value != "" {
+		if err := json.Unmarshal([]byte(value), &parameters); err != nil {
+			c.JSON(http.StatusBadRequest, errorResponse(fmt.Errorf("invalid parameters: %w", err)))
+			return
+		}
+	}
+	bound, err := parser.BindParameters(ast, parameters)
+	if err != nil {
+		recordQuery("web", ast, err)
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	ast = bound
+	shared, release, err := requestExecutor(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	defer release()
+	// A watch runs for as long as the client stays, on a fork of its own rather than one of the query workers
+	executor := shared.Fork()
+	if err := authorizeQuery(c, executor, c.Query("query"), ast, "default"); err != nil {
+		recordQuery("web", ast, err)
+		c.JSON(authorizationStatus(err), errorResponse(err))
+		return
+	}
+
+	// Browsers send the id of the last event they received when they reconnect
+	resumeToken := c.Query("resume")
+	if resumeToken == "" {
+		resumeToken = c.GetHeader("Last-Event-ID")
+	}
+
+	ctx := c.Request.Context()
+	events, errs := executor.Watch(ctx, ast, "default", parser.WatchOptions{ResumeToken: resumeToken})
+	// Errors found before the watch starts are still sent as an error response
+	var first parser.WatchEvent
+	var ok bool
+	select {
+	case first, ok = <-events:
+	case <-ctx.Done():
+		return
+	}
+	if !ok {
+		err := <-errs
+		recordQuery("web", ast, err)
+		status := http.StatusInternalServerError
+		if parser.DiagnosticCodeOf(err) == parser.CodeWatchUnsupported {
+			status = http.StatusBadRequest
+		}
+		if err != nil {
+			c.JSON(status, errorResponse(err))
+		}
+		return
+	}
+	recordQuery("web", ast, nil)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// Keep proxies such as nginx from buffering the stream
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	heartbeat := time.NewTicker(watchHeartbeat)
+	defer heartbeat.Stop()
+	lastToken := resumeToken
+	event, pending := first, true
+	for {
+		if pending {
+			if event.ResumeToken != "" {
+				lastToken = event.ResumeToken
+			}
+			writeWatchEvent(c, event.Type, event.ResumeToken, watchEvent{Node: event.Node, Key: event.Key, Data: event.Data, ResumeToken: event.ResumeToken})
+			pending = false
+		}
+
+		select {
+		case event, ok = <-events:
+			if !ok {
+				if err := <-errs; err != nil {
+					writeWatchEvent(c, "error", "", errorResponse(err))
+				}
+				return
+			}
+			pending = true
+		case <-heartbeat.C:
+			writeWatchEvent(c, "heartbeat", "", watchEvent{ResumeToken: lastToken})
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// writeWatchEvent writes a server-sent event and flushes it to the client
+func writeWatchEvent(c *gin.Context, event, id string, data interface{}) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		encoded, _ = json.Marshal(errorResponse(err))
+		event = "error"
+	}
+	if id != "" {
+		fmt.Fprintf(c.Writer, "id: %s\n", id)
+	}
+	fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event, encoded)
+	c.Writer.Flush()
+}
@@ -22,14 +22,63 @@ var webFS embed.FS
 var WebCmd = &cobra.Command{
 	Use:   "web",
 	Short: "Start the Cyphernetes web interface",
-	Run:   runWeb,
+	RunE:  runWeb,
 }
 
-func runWeb(cmd *cobra.Command, args []string) {
+func init() {
+	WebCmd.Flags().StringVar(&webAuth.tokenFile, "token-file", "", "Authenticate API requests with the bearer tokens of this CSV file (token,user,uid,\"group1,group2\")")
+	WebCmd.Flags().StringVar(&webAuth.oidcIssuerURL, "oidc-issuer-url", "", "Authenticate API requests with the ID tokens of this OpenID Connect issuer")
+	WebCmd.Flags().StringVar(&webAuth.oidcClientID, "oidc-client-id", "", "Client ID the OpenID Connect ID tokens must be issued for")
+	WebCmd.Flags().StringVar(&webAuth.oidcUsernameClaim, "oidc-username-claim", "sub", "ID token claim holding the user name")
+	WebCmd.Flags().StringVar(&webAuth.oidcGroupsClaim, "oidc-groups-claim", "groups", "ID token claim holding the groups")
+	WebCmd.Flags().StringVar(&webAuth.oidcGroupsPrefix, "oidc-groups-prefix", "oidc:", "Prefix added to the ID token groups that --oidc-group-map doesn't map")
+	WebCmd.Flags().StringToStringVar(&webAuth.oidcGroupMap, "oidc-group-map", nil, "Map ID token groups to cluster groups, e.g. platform-team=cluster-admins")
+	WebCmd.Flags().StringVar(&webAuth.tlsCertFile, "tls-cert-file", "", "Serve HTTPS with this certificate")
+	WebCmd.Flags().StringVar(&webAuth.tlsKeyFile, "tls-key-file", "", "Private key of --tls-cert-file")
+	WebCmd.Flags().StringVar(&webAuth.clientCAFile, "client-ca-file", "", "Authenticate API requests with client certificates signed by this CA (requires --tls-cert-file)")
+	WebCmd.Flags().StringSliceVar(&adminGroups, "admin-group", nil, "Groups whose members may export and restore the server's state through /api/admin/state, which requires authentication")
+	WebCmd.Flags().StringVar(&storeURL, "store", "file", "Where saved dashboards and acknowledgements are kept (file, memory, sqlite:<path>, postgres://<url>)")
+	WebCmd.Flags().StringVar(&dashboardsFile, "dashboards-file", "", "File the saved dashboards are kept in by the file store (default ~/.cyphernetes/dashboards.json)")
+	WebCmd.Flags().StringVar(&serverConfigFile, "config", "", "Configuration file reloaded on SIGHUP and when it changes: admin groups, query pool, query and list timeouts, token file, OIDC settings, relationship packs, policies, authorization plugins and sinks")
+	WebCmd.Flags().IntVar(&queryWorkers, "query-workers", 4, "How many queries run at once, the others wait for one of them to end")
+	WebCmd.Flags().IntVar(&queryQueueLimit, "query-queue", 100, "How many queries may wait to run before the server answers 503 Service Unavailable")
+	WebCmd.Flags().DurationVar(&webQueryTimeout, "query-timeout", 0, "Stop queries that run longer than this, answering 504 Gateway Timeout (default: no limit)")
+	WebCmd.Flags().StringVar(&acknowledgementsFile, "acknowledgements-file", "", "File the acknowledged findings of reports are kept in by the file store (default ~/.cyphernetes/acknowledgements.json)")
+}
+
+func runWeb(cmd *cobra.Command, args []string) error {
 	port := "8080"
-	url := fmt.Sprintf("http://localhost:%s", port)
+	scheme := "http"
+	if webAuth.tlsCertFile != "" {
+		scheme = "https"
+	}
+	url := fmt.Sprintf("%s://localhost:%s", scheme, port)
+
+	flags := serverSettings{auth: webAuth, adminGroups: adminGroups, queryWorkers: queryWorkers, queryQueue: queryQueueLimit, queryTimeout: webQueryTimeout,
+		listTimeout: parser.ListTimeout, listTimeouts: parser.ListTimeouts, readOnly: parser.ReadOnly}
+	settings := &flags
+	if serverConfigFile != "" {
+		var err error
+		settings, err = loadServerSettings(serverConfigFile, flags)
+		if err != nil {
+			return fmt.Errorf("error loading configuration >> %w", err)
+		}
+	}
+	if err := applyServerSettings(settings); err != nil {
+		return fmt.Errorf("error configuring the server >> %w", err)
+	}
+	defer serverSinks.stop()
+	store, err := openStateStore(storeURL)
+	if err != nil {
+		return fmt.Errorf("error opening store >> %w", err)
+	}
+	stateStorage = store
+	defer store.Close()
+	if (settings.auth.tokenFile != "" || settings.auth.oidcIssuerURL != "") && webAuth.tlsCertFile == "" {
+		parser.Logger().Warn("Bearer tokens are sent in clear text, serve HTTPS with --tls-cert-file and --tls-key-file")
+	}
 
-	parser.InitResourceSpecs()
+	initResourceSpecsOrWarn()
 	resourceSpecs = parser.ResourceSpecs
 
 	// Set Gin to release mode to disable logging
@@ -38,12 +87,12 @@ func runWeb(cmd *cobra.Command, args []string) {
 
 	// Setup API routes first
 	setupAPIRoutes(router)
+	setupMetricsRoute(router)
 
 	// Serve embedded files from the 'web' directory
 	webContent, err := fs.Sub(webFS, "web")
 	if err != nil {
-		fmt.Printf("Error accessing embedded web files: %v\n", err)
-		return
+		return fmt.Errorf("error accessing embedded web files >> %w", err)
 	}
 	router.NoRoute(gin.WrapH(http.FileServer(http.FS(webContent))))
 
@@ -52,24 +101,47 @@ func runWeb(cmd *cobra.Command, args []string) {
 		Addr:    ":" + port,
 		Handler: router,
 	}
+	if webAuth.tlsCertFile != "" {
+		srv.TLSConfig, err = serverTLSConfig(webAuth)
+		if err != nil {
+			return fmt.Errorf("error configuring TLS >> %w", err)
+		}
+	}
 
-	// Create a channel to signal when the server has finished shutting down
+	// Create a channel to signal when the server has finished shutting down, and the error it stopped with
 	serverClosed := make(chan struct{})
+	var serveErr error
 
 	// Start the server in a goroutine
 	go func() {
 		fmt.Printf("Starting Cyphernetes web interface at %s\n", url)
 		fmt.Println("Press Ctrl+C to stop")
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			fmt.Printf("Error starting server: %v\n", err)
+		var err error
+		if webAuth.tlsCertFile != "" {
+			err = srv.ListenAndServeTLS(webAuth.tlsCertFile, webAuth.tlsKeyFile)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			serveErr = fmt.Errorf("error starting server >> %w", err)
 		}
 		close(serverClosed)
 	}()
 
-	// Wait for interrupt signal to gracefully shutdown the server
+	if serverConfigFile != "" {
+		reloadCtx, stopReloading := context.WithCancel(context.Background())
+		defer stopReloading()
+		go watchServerConfig(reloadCtx, serverConfigFile, flags, settings)
+	}
+
+	// Wait for interrupt signal to gracefully shutdown the server, unless it failed to start
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	select {
+	case <-quit:
+	case <-serverClosed:
+		return serveErr
+	}
 
 	fmt.Println("Shutting down server...")
 
@@ -87,4 +159,5 @@ func runWeb(cmd *cobra.Command, args []string) {
 	<-serverClosed
 
 	fmt.Println("Server exiting")
+	return serveErr
 }
@@ -3,20 +3,9 @@ package parser
 
 import (
     "fmt"
-    "log"
     "strings"
     "strconv"
 )
-
-func yyerror(s string) {
-    fmt.Printf("Syntax error: %s\n", s)
-}
-
-func debugLog(v ...interface{}) {
-	if LogLevel == "debug" {
-		log.Println(v...)
-	}
-}
 %}
 
 %union {
@@ -25,20 +14,35 @@ func debugLog(v ...interface{}) {
     nodePattern            *NodePattern
     clause                 *Clause
     expression             *Expression
+    union                  *Union
     matchClause            *MatchClause
+    clauses                []Clause
+    intVal                 int
     setClause              *SetClause
     deleteClause           *DeleteClause
+    operationClause        *OperationClause
     createClause           *CreateClause
+    mergeClause            *MergeClause
+    withClause             *WithClause
+    unwindClause           *UnwindClause
     returnClause           *ReturnClause
     returnItems            []*ReturnItem
     returnItem             *ReturnItem
+    orderItems             []*OrderItem
+    orderItem              *OrderItem
     properties             *Properties
     jsonPathValue          *Property
     jsonPathValueList      []*Property
     keyValuePairs          []*KeyValuePair
     keyValuePair           *KeyValuePair
+    functionArgs           []*FunctionArg
+    functionArg            *FunctionArg
+    temporalExpression     *TemporalExpression
+    temporalTerm           *TemporalTerm
     value                  interface{}
+    values                 []interface{}
     relationship           *Relationship
+    hops                   *Hops
     resourceProperties     *ResourceProperties
     nodeRelationshipList   *NodeRelationshipList
     nodeIds        []string
@@ -50,15 +54,45 @@ func debugLog(v ...interface{}) {
 %token <strVal> BOOLEAN
 %token <strVal> STRING
 %token <strVal> JSONDATA
-%token LPAREN RPAREN COLON MATCH WHERE SET DELETE CREATE RETURN EOF LBRACE RBRACE COMMA EQUALS AS
+%token <strVal> FUNCTION
+%token <strVal> PATCH_TYPE
+%token <strVal> PARAMETER
+%token <hops> HOPS
+%token LPAREN RPAREN COLON MATCH WHERE SET DELETE CREATE MERGE RETURN EOF LBRACE RBRACE COMMA EQUALS AS
 %token REL_NOPROPS_RIGHT REL_NOPROPS_LEFT REL_NOPROPS_BOTH REL_NOPROPS_NONE REL_BEGINPROPS_LEFT REL_BEGINPROPS_NONE REL_ENDPROPS_RIGHT REL_ENDPROPS_NONE
+%token IN NOT EXISTS LBRACKET RBRACKET
+%token EXPLAIN
+%token OPTIONAL
+%token APPLY BATCH WHILE
+%token WITH UNWIND
+%token DISTINCT
+%token ORDER_BY ASC DESC
+%token UNION ALL
+%token CONTAINS STARTS ENDS REGEX_MATCH
+%token PLUS MINUS
+%token NULL
+%token RESTART SCALE TO PAUSE RESUME
+%token STATUS
 %token COUNT SUM NOT_EQUALS GREATER_THAN LESS_THAN GREATER_THAN_EQUALS LESS_THAN_EQUALS
 
 %type<expression> Expression
+%type<expression> ReadQuery
+%type<union> UnionQueries
+%type<union> UnionAllQueries
 %type<matchClause> MatchClause
+%type<matchClause> OptionalMatchClause
+%type<clauses> OptionalMatchClauses
+%type<clauses> MutationClauses
+%type<intVal> ApplyBatch
 %type<setClause> SetClause
 %type<deleteClause> DeleteClause
+%type<operationClause> OperationClause
 %type<createClause> CreateClause
+%type<mergeClause> MergeClause
+%type<withClause> WithClause
+%type<unwindClause> UnwindClause
+%type<clauses> Chain
+%type<clauses> ChainedClauses
 %type<returnClause> ReturnClause
 %type<nodePattern> NodePattern
 %type<strVal> IDENT
@@ -66,6 +100,7 @@ func debugLog(v ...interface{}) {
 %type<jsonPathValueList> JSONPathValueList
 %type<jsonPathValue> JSONPathValue
 %type<value> Value
+%type<values> ValueList
 %type<properties> Properties
 %type<strVal> STRING
 %type<strVal> INT
@@ -75,15 +110,62 @@ func debugLog(v ...interface{}) {
 %type<nodeRelationshipList> NodeRelationshipList
 %type<keyValuePairs> KeyValuePairs
 %type<keyValuePair> KeyValuePair
+%type<keyValuePair> FilterSubject
+%type<functionArgs> FunctionArgs
+%type<functionArg> FunctionArg
+%type<temporalExpression> TemporalExpression
+%type<temporalTerm> TemporalTerm
 %type<nodeIds> NodeIds
 %type<returnItems> ReturnItems
 %type<returnItem> ReturnItem
+%type<orderItems> OrderBy
+%type<orderItems> OrderItems
+%type<orderItem> OrderItem
 
 %%
 
+Query:
+    Expression
+    | EXPLAIN Expression {
+        result.Explain = true
+    }
+    | APPLY ApplyBatch MutationClauses WHILE MatchClause ReturnClause EOF {
+        result = &Expression{Clauses: $3, Apply: &Apply{BatchSize: $2, While: &Expression{Clauses: []Clause{$5, $6}}}}
+    }
+;
+
+ApplyBatch:
+    /* empty */ {
+        $$ = 1
+    }
+    | BATCH INT {
+        $$, _ = strconv.Atoi($2)
+    }
+;
+
+MutationClauses:
+    MatchClause SetClause {
+        $$ = []Clause{$1, $2}
+    }
+    | MatchClause DeleteClause {
+        $$ = []Clause{$1, $2}
+    }
+    | MatchClause OperationClause {
+        $$ = []Clause{$1, $2}
+    }
+;
+
 Expression:
-    MatchClause ReturnClause EOF {
-        result = &Expression{Clauses: []Clause{$1, $2}}
+    ReadQuery EOF {
+        result = $1
+    }
+    | ReadQuery UnionQueries EOF {
+        $1.Union = $2
+        result = $1
+    }
+    | ReadQuery UnionAllQueries EOF {
+        $1.Union = $2
+        result = $1
     }
     | MatchClause SetClause EOF {
         result = &Expression{Clauses: []Clause{$1, $2}}
@@ -94,6 +176,12 @@ Expression:
     | MatchClause DeleteClause EOF {
         result = &Expression{Clauses: []Clause{$1, $2}}
     }
+    | MatchClause OperationClause EOF {
+        result = &Expression{Clauses: []Clause{$1, $2}}
+    }
+    | MatchClause OperationClause ReturnClause EOF {
+        result = &Expression{Clauses: []Clause{$1, $2, $3}}
+    }
     | CreateClause EOF {
         result = &Expression{Clauses: []Clause{$1}}
     }
@@ -106,6 +194,55 @@ Expression:
     | MatchClause CreateClause ReturnClause EOF {
         result = &Expression{Clauses: []Clause{$1, $2, $3}}
     }
+    | MergeClause EOF {
+        result = &Expression{Clauses: []Clause{$1}}
+    }
+    | MergeClause ReturnClause EOF {
+        result = &Expression{Clauses: []Clause{$1, $2}}
+    }
+    | MergeClause SetClause EOF {
+        result = &Expression{Clauses: []Clause{$1, $2}}
+    }
+    | MergeClause SetClause ReturnClause EOF {
+        result = &Expression{Clauses: []Clause{$1, $2, $3}}
+    }
+;
+
+// ReadQuery is a query that only returns resources, which UNION may combine with others
+ReadQuery:
+    MatchClause ReturnClause {
+        $$ = &Expression{Clauses: []Clause{$1, $2}}
+    }
+    | MatchClause OptionalMatchClauses ReturnClause {
+        $$ = &Expression{Clauses: append(append([]Clause{$1}, $2...), $3)}
+    }
+    | MatchClause Chain ReturnClause {
+        $$ = &Expression{Clauses: append(append([]Clause{$1}, $2...), $3)}
+    }
+    | MatchClause OptionalMatchClauses Chain ReturnClause {
+        $$ = &Expression{Clauses: append(append(append([]Clause{$1}, $2...), $3...), $4)}
+    }
+;
+
+// UNION and UNION ALL can't be mixed in a query
+UnionQueries:
+    UNION ReadQuery {
+        $$ = &Union{Queries: []*Expression{$2}}
+    }
+    | UnionQueries UNION ReadQuery {
+        $1.Queries = append($1.Queries, $3)
+        $$ = $1
+    }
+;
+
+UnionAllQueries:
+    UNION ALL ReadQuery {
+        $$ = &Union{All: true, Queries: []*Expression{$3}}
+    }
+    | UnionAllQueries UNION ALL ReadQuery {
+        $1.Queries = append($1.Queries, $4)
+        $$ = $1
+    }
 ;
 
 MatchClause:
@@ -117,16 +254,90 @@ MatchClause:
     }
 ;
 
+OptionalMatchClauses:
+    OptionalMatchClause {
+        $$ = []Clause{$1}
+    }
+    | OptionalMatchClauses OptionalMatchClause {
+        $$ = append($1, $2)
+    }
+;
+
+OptionalMatchClause:
+    OPTIONAL MatchClause {
+        $2.Optional = true
+        $$ = $2
+    }
+;
+
+WithClause:
+    WITH ReturnItems {
+        $$ = &WithClause{Items: $2}
+    }
+    | WITH ReturnItems WHERE KeyValuePairs {
+        $$ = &WithClause{Items: $2, ExtraFilters: $4}
+    }
+;
+
+UnwindClause:
+    UNWIND JSONPATH AS IDENT {
+        $$ = &UnwindClause{JsonPath: $2, Alias: $4}
+    }
+;
+
+// Chain is a WITH or UNWIND clause and the clauses that follow it, up to the RETURN clause
+Chain:
+    WithClause ChainedClauses {
+        $$ = append([]Clause{$1}, $2...)
+    }
+    | UnwindClause ChainedClauses {
+        $$ = append([]Clause{$1}, $2...)
+    }
+;
+
+ChainedClauses:
+    /* empty */ {
+        $$ = []Clause{}
+    }
+    | ChainedClauses WithClause {
+        $$ = append($1, $2)
+    }
+    | ChainedClauses UnwindClause {
+        $$ = append($1, $2)
+    }
+    | ChainedClauses MatchClause {
+        $$ = append($1, $2)
+    }
+    | ChainedClauses OptionalMatchClause {
+        $$ = append($1, $2)
+    }
+;
+
 CreateClause:
     CREATE NodeRelationshipList {
         $$ = &CreateClause{Nodes: $2.Nodes, Relationships: $2.Relationships}
     }
 ;
 
+MergeClause:
+    MERGE NodePattern {
+        $$ = &MergeClause{Node: $2}
+    }
+;
+
 SetClause:
     SET KeyValuePairs {
         $$ = &SetClause{KeyValuePairs: $2}
     }
+    | SET PATCH_TYPE KeyValuePairs {
+        $$ = &SetClause{KeyValuePairs: $3, PatchType: strings.ToLower($2)}
+    }
+    | SET STATUS KeyValuePairs {
+        $$ = &SetClause{KeyValuePairs: $3, Status: true}
+    }
+    | SET STATUS PATCH_TYPE KeyValuePairs {
+        $$ = &SetClause{KeyValuePairs: $4, PatchType: strings.ToLower($3), Status: true}
+    }
 ;
 
 DeleteClause:
@@ -135,6 +346,22 @@ DeleteClause:
     }
 ;
 
+OperationClause:
+    RESTART NodeIds {
+        $$ = &OperationClause{Operation: "restart", NodeIds: $2}
+    }
+    | SCALE NodeIds TO INT {
+        replicas, _ := strconv.Atoi($4)
+        $$ = &OperationClause{Operation: "scale", NodeIds: $2, Replicas: replicas}
+    }
+    | PAUSE NodeIds {
+        $$ = &OperationClause{Operation: "pause", NodeIds: $2}
+    }
+    | RESUME NodeIds {
+        $$ = &OperationClause{Operation: "resume", NodeIds: $2}
+    }
+;
+
 NodeIds:
     IDENT {
         $$ = []string{$1}
@@ -155,23 +382,86 @@ KeyValuePairs:
 
 // JSONPathValue represents a JSONPath=Value pair
 KeyValuePair:
-    JSONPATH EQUALS Value {
-        $$ = &KeyValuePair{Key: $1, Value: $3, Operator: "EQUALS"} // ==
+    FilterSubject EQUALS Value {
+        $1.Value, $1.Operator = $3, "EQUALS" // ==
+        $$ = $1
     }
-    | JSONPATH NOT_EQUALS Value {
-        $$ = &KeyValuePair{Key: $1, Value: $3, Operator: "NOT_EQUALS"} // !=
+    | FilterSubject NOT_EQUALS Value {
+        $1.Value, $1.Operator = $3, "NOT_EQUALS" // !=
+        $$ = $1
     }
-    | JSONPATH GREATER_THAN Value {
-        $$ = &KeyValuePair{Key: $1, Value: $3, Operator: "GREATER_THAN"} // >
+    | FilterSubject GREATER_THAN Value {
+        $1.Value, $1.Operator = $3, "GREATER_THAN" // >
+        $$ = $1
     }
-    | JSONPATH LESS_THAN Value {
-        $$ = &KeyValuePair{Key: $1, Value: $3, Operator: "LESS_THAN"} // <
+    | FilterSubject LESS_THAN Value {
+        $1.Value, $1.Operator = $3, "LESS_THAN" // <
+        $$ = $1
     }
-    | JSONPATH GREATER_THAN_EQUALS Value {
-        $$ = &KeyValuePair{Key: $1, Value: $3, Operator: "GREATER_THAN_EQUALS"} // >=
+    | FilterSubject GREATER_THAN_EQUALS Value {
+        $1.Value, $1.Operator = $3, "GREATER_THAN_EQUALS" // >=
+        $$ = $1
     }
-    | JSONPATH LESS_THAN_EQUALS Value {
-        $$ = &KeyValuePair{Key: $1, Value: $3, Operator: "LESS_THAN_EQUALS"} // <=
+    | FilterSubject LESS_THAN_EQUALS Value {
+        $1.Value, $1.Operator = $3, "LESS_THAN_EQUALS" // <=
+        $$ = $1
+    }
+    | FilterSubject REGEX_MATCH Value {
+        $1.Value, $1.Operator = $3, "REGEX" // =~
+        $$ = $1
+    }
+    | FilterSubject CONTAINS Value {
+        $1.Value, $1.Operator = $3, "CONTAINS"
+        $$ = $1
+    }
+    | FilterSubject STARTS WITH Value {
+        $1.Value, $1.Operator = $4, "STARTS_WITH"
+        $$ = $1
+    }
+    | FilterSubject ENDS WITH Value {
+        $1.Value, $1.Operator = $4, "ENDS_WITH"
+        $$ = $1
+    }
+    | FUNCTION LPAREN JSONPATH FunctionArgs RPAREN {
+        // A function alone must be true, e.g. WHERE startsWith(p.metadata.name, "web")
+        $$ = &KeyValuePair{Key: $3, Function: strings.ToUpper($1), Args: $4, Value: true, Operator: "EQUALS"}
+    }
+;
+
+// FilterSubject is what a WHERE filter compares: a JSONPath, or a function of one
+FilterSubject:
+    JSONPATH {
+        $$ = &KeyValuePair{Key: $1}
+    }
+    | FUNCTION LPAREN JSONPATH FunctionArgs RPAREN {
+        $$ = &KeyValuePair{Key: $3, Function: strings.ToUpper($1), Args: $4}
+    }
+;
+
+// FunctionArgs are the arguments of a function call after the first, e.g. "-" in split(p.spec.nodeName, "-")
+FunctionArgs:
+    /* empty */ {
+        $$ = nil
+    }
+    | FunctionArgs COMMA FunctionArg {
+        $$ = append($1, $3)
+    }
+;
+
+FunctionArg:
+    JSONPATH {
+        $$ = &FunctionArg{JsonPath: $1}
+    }
+    | STRING {
+        $$ = &FunctionArg{Value: unquote($1)}
+    }
+    | INT {
+        i, err := strconv.Atoi($1)
+        if err != nil {
+            yylex.Error(fmt.Sprintf("integer %s is out of range", $1))
+            return 1
+        }
+        $$ = &FunctionArg{Value: i}
     }
 ;
 
@@ -226,8 +516,41 @@ NodePattern:
 ;
 
 ReturnClause:
-    RETURN ReturnItems {
-        $$ = &ReturnClause{Items: $2}
+    RETURN ReturnItems OrderBy {
+        $$ = &ReturnClause{Items: $2, OrderBy: $3}
+    }
+    | RETURN DISTINCT ReturnItems OrderBy {
+        $$ = &ReturnClause{Items: $3, Distinct: true, OrderBy: $4}
+    }
+;
+
+OrderBy:
+    /* empty */ {
+        $$ = nil
+    }
+    | ORDER_BY OrderItems {
+        $$ = $2
+    }
+;
+
+OrderItems:
+    OrderItem {
+        $$ = []*OrderItem{$1}
+    }
+    | OrderItems COMMA OrderItem {
+        $$ = append($1, $3)
+    }
+;
+
+OrderItem:
+    JSONPATH {
+        $$ = &OrderItem{JsonPath: $1}
+    }
+    | JSONPATH ASC {
+        $$ = &OrderItem{JsonPath: $1}
+    }
+    | JSONPATH DESC {
+        $$ = &OrderItem{JsonPath: $1, Descending: true}
     }
 ;
 
@@ -256,9 +579,27 @@ ReturnItem:
     | COUNT LBRACE JSONPATH RBRACE AS IDENT {
         $$ = &ReturnItem{Aggregate: "COUNT", JsonPath: $3, Alias: $6}
     }
+    | COUNT LPAREN JSONPATH RPAREN {
+        $$ = &ReturnItem{Aggregate: "COUNT", JsonPath: $3}
+    }
+    | COUNT LPAREN JSONPATH RPAREN AS IDENT {
+        $$ = &ReturnItem{Aggregate: "COUNT", JsonPath: $3, Alias: $6}
+    }
     | SUM LBRACE JSONPATH RBRACE AS IDENT {
         $$ = &ReturnItem{Aggregate: "SUM", JsonPath: $3, Alias: $6}
     }
+    | SUM LPAREN JSONPATH RPAREN {
+        $$ = &ReturnItem{Aggregate: "SUM", JsonPath: $3}
+    }
+    | SUM LPAREN JSONPATH RPAREN AS IDENT {
+        $$ = &ReturnItem{Aggregate: "SUM", JsonPath: $3, Alias: $6}
+    }
+    | FUNCTION LPAREN JSONPATH FunctionArgs RPAREN {
+        $$ = &ReturnItem{Function: strings.ToUpper($1), JsonPath: $3, Args: $4}
+    }
+    | FUNCTION LPAREN JSONPATH FunctionArgs RPAREN AS IDENT {
+        $$ = &ReturnItem{Function: strings.ToUpper($1), JsonPath: $3, Args: $4, Alias: $7}
+    }
 ;
 
 Relationship:
@@ -286,6 +627,54 @@ Relationship:
 |   REL_BEGINPROPS_LEFT ResourceProperties REL_ENDPROPS_RIGHT { 
         $$ = &Relationship{ResourceProperties: $2, Direction: Both, LeftNode: nil, RightNode: nil}
     }
+|   REL_BEGINPROPS_NONE IDENT REL_ENDPROPS_NONE {
+        $$ = &Relationship{ResourceProperties: &ResourceProperties{Name: $2}, Direction: None}
+    }
+|   REL_BEGINPROPS_LEFT IDENT REL_ENDPROPS_NONE {
+        $$ = &Relationship{ResourceProperties: &ResourceProperties{Name: $2}, Direction: Left}
+    }
+|   REL_BEGINPROPS_NONE IDENT REL_ENDPROPS_RIGHT {
+        $$ = &Relationship{ResourceProperties: &ResourceProperties{Name: $2}, Direction: Right}
+    }
+|   REL_BEGINPROPS_LEFT IDENT REL_ENDPROPS_RIGHT {
+        $$ = &Relationship{ResourceProperties: &ResourceProperties{Name: $2}, Direction: Both}
+    }
+|   REL_BEGINPROPS_NONE COLON IDENT REL_ENDPROPS_NONE {
+        $$ = &Relationship{ResourceProperties: &ResourceProperties{Kind: $3}, Direction: None}
+    }
+|   REL_BEGINPROPS_LEFT COLON IDENT REL_ENDPROPS_NONE {
+        $$ = &Relationship{ResourceProperties: &ResourceProperties{Kind: $3}, Direction: Left}
+    }
+|   REL_BEGINPROPS_NONE COLON IDENT REL_ENDPROPS_RIGHT {
+        $$ = &Relationship{ResourceProperties: &ResourceProperties{Kind: $3}, Direction: Right}
+    }
+|   REL_BEGINPROPS_LEFT COLON IDENT REL_ENDPROPS_RIGHT {
+        $$ = &Relationship{ResourceProperties: &ResourceProperties{Kind: $3}, Direction: Both}
+    }
+|   REL_BEGINPROPS_NONE IDENT HOPS REL_ENDPROPS_NONE {
+        $$ = &Relationship{ResourceProperties: &ResourceProperties{Name: $2}, Direction: None, Hops: $3}
+    }
+|   REL_BEGINPROPS_LEFT IDENT HOPS REL_ENDPROPS_NONE {
+        $$ = &Relationship{ResourceProperties: &ResourceProperties{Name: $2}, Direction: Left, Hops: $3}
+    }
+|   REL_BEGINPROPS_NONE IDENT HOPS REL_ENDPROPS_RIGHT {
+        $$ = &Relationship{ResourceProperties: &ResourceProperties{Name: $2}, Direction: Right, Hops: $3}
+    }
+|   REL_BEGINPROPS_LEFT IDENT HOPS REL_ENDPROPS_RIGHT {
+        $$ = &Relationship{ResourceProperties: &ResourceProperties{Name: $2}, Direction: Both, Hops: $3}
+    }
+|   REL_BEGINPROPS_NONE HOPS REL_ENDPROPS_NONE {
+        $$ = &Relationship{Direction: None, Hops: $2}
+    }
+|   REL_BEGINPROPS_LEFT HOPS REL_ENDPROPS_NONE {
+        $$ = &Relationship{Direction: Left, Hops: $2}
+    }
+|   REL_BEGINPROPS_NONE HOPS REL_ENDPROPS_RIGHT {
+        $$ = &Relationship{Direction: Right, Hops: $2}
+    }
+|   REL_BEGINPROPS_LEFT HOPS REL_ENDPROPS_RIGHT {
+        $$ = &Relationship{Direction: Both, Hops: $2}
+    }
 ;
 
 ResourceProperties:
@@ -319,18 +708,39 @@ JSONPathValue:
     JSONPATH COLON Value {
         $$ = &Property{Key: $1, Value: $3}
     }
+    | JSONPATH IN LBRACKET ValueList RBRACKET {
+        $$ = &Property{Key: $1, Value: $4, Operator: "IN"}
+    }
+    | JSONPATH NOT IN LBRACKET ValueList RBRACKET {
+        $$ = &Property{Key: $1, Value: $5, Operator: "NOT_IN"}
+    }
+    | JSONPATH EXISTS {
+        $$ = &Property{Key: $1, Operator: "EXISTS"}
+    }
+    | JSONPATH NOT EXISTS {
+        $$ = &Property{Key: $1, Operator: "NOT_EXISTS"}
+    }
+;
+
+ValueList:
+    Value {
+        $$ = []interface{}{$1}
+    }
+    | ValueList COMMA Value {
+        $$ = append($1, $3)
+    }
 ;
 
 Value:
     STRING { 
-        $$ = strings.Trim($1, "\"")
+        $$ = unquote($1)
     }
     | INT { 
         // Parse the int from the string
         i, err := strconv.Atoi($1)
         if err != nil {
-            // ... handle error
-            panic(err)
+            yylex.Error(fmt.Sprintf("integer %s is out of range", $1))
+            return 1
         }
         $$ = i
     }
@@ -341,5 +751,41 @@ Value:
     | JSONDATA {
         $$ = $1
     }
+    | NULL {
+        // Only SET values may be null, which removes the field
+        $$ = nil
+    }
+    | PARAMETER {
+        // Given when the query runs, see PreparedQuery
+        $$ = &Parameter{Name: $1}
+    }
+    | TemporalExpression {
+        $$ = $1
+    }
+;
+
+// TemporalExpression is a point in time or a duration computed when the query runs, e.g. now() - duration("24h")
+TemporalExpression:
+    TemporalTerm {
+        $$ = &TemporalExpression{Terms: []*TemporalTerm{$1}}
+    }
+    | TemporalExpression PLUS TemporalTerm {
+        $1.Terms = append($1.Terms, $3)
+        $$ = $1
+    }
+    | TemporalExpression MINUS TemporalTerm {
+        $3.Negative = true
+        $1.Terms = append($1.Terms, $3)
+        $$ = $1
+    }
+;
+
+TemporalTerm:
+    FUNCTION LPAREN RPAREN {
+        $$ = &TemporalTerm{Function: strings.ToUpper($1)}
+    }
+    | FUNCTION LPAREN STRING RPAREN {
+        $$ = &TemporalTerm{Function: strings.ToUpper($1), Arg: unquote($3)}
+    }
 ;
 %%
@@ -0,0 +1,276 @@
+// Package client is a Go client of the HTTP API served by cyphernetes web, as documented by its OpenAPI document
+// at /api/openapi.json.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Client sends requests to a cyphernetes web server
+type Client struct {
+	// BaseURL is the address of the server, e.g. http://localhost:8080
+	BaseURL string
+	// Token, if set, is sent as a bearer token: a static token of --token-file, or an OpenID Connect ID token
+	Token string
+	// HTTPClient sends the requests, http.DefaultClient if nil. Give it a TLS config with a client certificate to
+	// authenticate with one.
+	HTTPClient *http.Client
+}
+
+// New returns a client of the server at baseURL
+func New(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+// Node is a resource of the graph of a query result
+type Node struct {
+	Id        string
+	Kind      string
+	Name      string
+	Namespace string
+}
+
+// Edge is a relationship between resources of the graph of a query result
+type Edge struct {
+	From string
+	To   string
+	Type string
+}
+
+// Graph is the resources a query result is made of, and their relationships
+type Graph struct {
+	Nodes []Node
+	Edges []Edge
+}
+
+// QueryResult is the result of a query: the returned values keyed by node name, and their graph
+type QueryResult struct {
+	Data  map[string]interface{}
+	Graph Graph
+}
+
+// Error is an error response of the API
+type Error struct {
+	StatusCode int
+	Message    string `json:"error"`
+	// Code is the diagnostic code of the error, e.g. CYP-0020, if it has one
+	Code    string                 `json:"code,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("%s: %s", e.Code, e.Message)
+	}
+	return e.Message
+}
+
+type queryRequest struct {
+	Query string `json:"query"`
+}
+
+type queryResponse struct {
+	Result string `json:"result"`
+	Graph  string `json:"graph"`
+}
+
+// Query runs a query
+func (c *Client) Query(ctx context.Context, query string) (*QueryResult, error) {
+	var response queryResponse
+	if err := c.do(ctx, http.MethodPost, "/api/query", nil, queryRequest{Query: query}, &response); err != nil {
+		return nil, err
+	}
+	// The result and graph are JSON documents within the response
+	result := &QueryResult{}
+	if err := json.Unmarshal([]byte(response.Result), &result.Data); err != nil {
+		return nil, fmt.Errorf("error decoding query result >> %w", err)
+	}
+	if err := json.Unmarshal([]byte(response.Graph), &result.Graph); err != nil {
+		return nil, fmt.Errorf("error decoding query graph >> %w", err)
+	}
+	return result, nil
+}
+
+// Autocomplete returns the suggestions for the word at position in query
+func (c *Client) Autocomplete(ctx context.Context, query string, position int) ([]string, error) {
+	var response struct {
+		Suggestions []string `json:"suggestions"`
+	}
+	params := url.Values{"query": {query}, "position": {strconv.Itoa(position)}}
+	if err := c.do(ctx, http.MethodGet, "/api/autocomplete", params, nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Suggestions, nil
+}
+
+// ConvertResourceName resolves a kind, plural, singular or short name to the plural name of its resource
+func (c *Client) ConvertResourceName(ctx context.Context, name string) (string, error) {
+	var response struct {
+		Singular string `json:"singular"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/convert-resource-name", url.Values{"name": {name}}, nil, &response); err != nil {
+		return "", err
+	}
+	return response.Singular, nil
+}
+
+// WatchEvent is an event of a watch: a change of a row, with Type added, modified or deleted, or one of
+// synced, reset, bookmark and heartbeat
+type WatchEvent struct {
+	Type string `json:"-"`
+	// Node is the name of the node the row is of
+	Node string `json:"node,omitempty"`
+	// Key identifies the resource of the row across events
+	Key  string                 `json:"key,omitempty"`
+	Data map[string]interface{} `json:"data,omitempty"`
+	// ResumeToken resumes the watch after this event when given to Watch
+	ResumeToken string `json:"resumeToken,omitempty"`
+}
+
+// Watch runs a query and sends the changes of its rows until ctx is cancelled. Give the resume token of the
+// last event received to resume a watch, or an empty one to start with the rows of the matching resources.
+// The events channel is closed when the watch ends, after which the error channel yields the error that
+// ended it, if any.
+func (c *Client) Watch(ctx context.Context, query, resumeToken string) (<-chan WatchEvent, <-chan error) {
+	events := make(chan WatchEvent)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(events)
+		if err := c.watch(ctx, query, resumeToken, events); err != nil && ctx.Err() == nil {
+			errs <- err
+		}
+	}()
+
+	return events, errs
+}
+
+func (c *Client) watch(ctx context.Context, query, resumeToken string, events chan<- WatchEvent) error {
+	params := url.Values{"query": {query}}
+	if resumeToken != "" {
+		params.Set("resume", resumeToken)
+	}
+	resp, err := c.send(ctx, http.MethodGet, "/api/watch", params, nil, "text/event-stream")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Server-sent events are blocks of "field: value" lines separated by an empty line
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var eventType, data string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line != "" {
+			field, value, _ := strings.Cut(line, ":")
+			switch field {
+			case "event":
+				eventType = strings.TrimPrefix(value, " ")
+			case "data":
+				data += strings.TrimPrefix(value, " ")
+			}
+			continue
+		}
+		if eventType == "error" {
+			apiErr := &Error{StatusCode: resp.StatusCode}
+			if err := json.Unmarshal([]byte(data), apiErr); err != nil {
+				apiErr.Message = data
+			}
+			return apiErr
+		}
+		if eventType != "" {
+			event := WatchEvent{}
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				return fmt.Errorf("error decoding watch event >> %w", err)
+			}
+			event.Type = eventType
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		eventType, data = "", ""
+	}
+	return scanner.Err()
+}
+
+// do sends a request with a JSON body, if any, and decodes the JSON response into out
+func (c *Client) do(ctx context.Context, method, path string, params url.Values, body, out interface{}) error {
+	resp, err := c.send(ctx, method, path, params, body, "application/json")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("error decoding response >> %w", err)
+	}
+	return nil
+}
+
+// send sends a request with a JSON body, if any, and returns the response if it succeeded
+func (c *Client) send(ctx context.Context, method, path string, params url.Values, body interface{}, accept string) (*http.Response, error) {
+	endpoint := strings.TrimSuffix(c.BaseURL, "/") + path
+	if len(params) > 0 {
+		endpoint += "?" + params.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		if err := json.Unmarshal(data, apiErr); err != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(data))
+			if apiErr.Message == "" {
+				apiErr.Message = resp.Status
+			}
+		}
+		return nil, apiErr
+	}
+	return resp, nil
+}
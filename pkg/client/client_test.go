@@ -0,0 +1,110 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/query" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("expected the bearer token, got %q", got)
+		}
+		var req queryRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Query != "MATCH (d:Deployment) RETURN d.metadata.name" {
+			t.Errorf("unexpected body %+v (%v)", req, err)
+		}
+		json.NewEncoder(w).Encode(queryResponse{
+			Result: `{"d":[{"name":"web"}]}`,
+			Graph:  `{"Nodes":[{"Id":"d","Kind":"Deployment","Name":"web","Namespace":"default"}],"Edges":null}`,
+		})
+	}))
+	defer server.Close()
+
+	c := New(server.URL + "/")
+	c.Token = "secret"
+	result, err := c.Query(context.Background(), "MATCH (d:Deployment) RETURN d.metadata.name")
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	expected := map[string]interface{}{"d": []interface{}{map[string]interface{}{"name": "web"}}}
+	if !reflect.DeepEqual(result.Data, expected) {
+		t.Errorf("unexpected data %v", result.Data)
+	}
+	if len(result.Graph.Nodes) != 1 || result.Graph.Nodes[0].Kind != "Deployment" {
+		t.Errorf("unexpected graph %+v", result.Graph)
+	}
+}
+
+func TestErrorResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"resource identifier not found: foo","code":"CYP-0020","details":{"identifier":"foo"}}`))
+	}))
+	defer server.Close()
+
+	_, err := New(server.URL).ConvertResourceName(context.Background(), "foo")
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected an API error, got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusBadRequest || apiErr.Code != "CYP-0020" || apiErr.Details["identifier"] != "foo" {
+		t.Errorf("unexpected error %+v", apiErr)
+	}
+	if err.Error() != "CYP-0020: resource identifier not found: foo" {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+}
+
+func TestAutocomplete(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("query") != "MATCH (d:Dep" || r.URL.Query().Get("position") != "12" {
+			t.Errorf("unexpected parameters %v", r.URL.Query())
+		}
+		w.Write([]byte(`{"suggestions":["Deployment"]}`))
+	}))
+	defer server.Close()
+
+	suggestions, err := New(server.URL).Autocomplete(context.Background(), "MATCH (d:Dep", 12)
+	if err != nil || !reflect.DeepEqual(suggestions, []string{"Deployment"}) {
+		t.Errorf("Autocomplete() = %v, %v", suggestions, err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/watch" || r.URL.Query().Get("resume") != "7" || r.Header.Get("Accept") != "text/event-stream" {
+			t.Errorf("unexpected request %s %v", r.URL.Path, r.URL.Query())
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("id: 8\nevent: added\ndata: {\"node\":\"p\",\"key\":\"uid\",\"data\":{\"name\":\"web\"},\"resumeToken\":\"8\"}\n\n" +
+			"event: heartbeat\ndata: {\"resumeToken\":\"8\"}\n\n" +
+			"event: error\ndata: {\"error\":\"watch failed\",\"code\":\"CYP-0030\"}\n\n"))
+	}))
+	defer server.Close()
+
+	events, errs := New(server.URL).Watch(context.Background(), "MATCH (p:Pod) RETURN p.metadata.name", "7")
+	var received []WatchEvent
+	for event := range events {
+		received = append(received, event)
+	}
+	expected := []WatchEvent{
+		{Type: "added", Node: "p", Key: "uid", Data: map[string]interface{}{"name": "web"}, ResumeToken: "8"},
+		{Type: "heartbeat", ResumeToken: "8"},
+	}
+	if !reflect.DeepEqual(received, expected) {
+		t.Errorf("unexpected events %+v", received)
+	}
+	var apiErr *Error
+	if err := <-errs; !errors.As(err, &apiErr) || apiErr.Code != "CYP-0030" {
+		t.Errorf("expected the error event, got %v", err)
+	}
+}
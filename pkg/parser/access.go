@@ -0,0 +1,299 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ResourceAccess is a kind of API request a query makes, e.g. listing the pods of a namespace
+type ResourceAccess struct {
+	Verb        string `json:"verb"`
+	Group       string `json:"group"`
+	Version     string `json:"version"`
+	Resource    string `json:"resource"`
+	Subresource string `json:"subresource,omitempty"`
+	// Namespace is empty for requests across all namespaces and for cluster-scoped resources
+	Namespace string `json:"namespace,omitempty"`
+}
+
+func (a ResourceAccess) String() string {
+	resource := a.Resource
+	if a.Group != "" {
+		resource += "." + a.Group
+	}
+	if a.Subresource != "" {
+		resource += "/" + a.Subresource
+	}
+	if a.Namespace == "" {
+		return fmt.Sprintf("%s %s", a.Verb, resource)
+	}
+	return fmt.Sprintf("%s %s in namespace %s", a.Verb, resource, a.Namespace)
+}
+
+// Access lists the API requests a query would make running in namespace, as EXPLAIN plans them: the kinds its
+// nodes list or get by name, and those it creates, patches and deletes. Like EXPLAIN, nothing is listed while building it except
+// for API discovery. Nodes whose kind is only known once their relationships are followed aren't listed.
+func (q *QueryExecutor) Access(ast *Expression, namespace string) ([]ResourceAccess, error) {
+	if namespace == "" && !AllNamespaces {
+		namespace = Namespace
+	}
+	access := &queryAccess{q: q, namespace: namespace, nodes: map[string][]ResourceAccess{}, named: map[string]bool{}}
+	if err := access.add(ast); err != nil {
+		return nil, err
+	}
+	return access.requests, nil
+}
+
+// queryAccess gathers the requests of a query, nodes being the resources of its nodes by name
+type queryAccess struct {
+	q         *QueryExecutor
+	namespace string
+	nodes     map[string][]ResourceAccess
+	// named are the nodes fetched by name, with a get rather than a list
+	named    map[string]bool
+	requests []ResourceAccess
+}
+
+func (a *queryAccess) add(ast *Expression) error {
+	for _, clause := range ast.Clauses {
+		switch c := clause.(type) {
+		case *MatchClause:
+			for _, node := range c.Nodes {
+				if err := a.list(node); err != nil {
+					return err
+				}
+			}
+		case *MergeClause:
+			if err := a.list(c.Node); err != nil {
+				return err
+			}
+			a.create(c.Node.ResourceProperties.Name)
+		case *CreateClause:
+			for _, node := range c.Nodes {
+				if _, ok := a.nodes[node.ResourceProperties.Name]; ok {
+					continue
+				}
+				if err := a.resolve(node); err != nil {
+					return err
+				}
+				a.create(node.ResourceProperties.Name)
+			}
+		case *SetClause:
+			for _, kvp := range c.KeyValuePairs {
+				if c.Status {
+					a.subresource("patch", strings.Split(kvp.Key, ".")[0], "status")
+					continue
+				}
+				a.mutate("patch", strings.Split(kvp.Key, ".")[0])
+			}
+		case *DeleteClause:
+			for _, nodeId := range c.NodeIds {
+				a.mutate("delete", nodeId)
+			}
+		case *OperationClause:
+			for _, nodeId := range c.NodeIds {
+				if c.Operation == "scale" {
+					a.subresource("patch", nodeId, "scale")
+					continue
+				}
+				a.mutate("patch", nodeId)
+			}
+		case *ReturnClause:
+			for _, item := range c.Items {
+				if item.Function == "LOGS" {
+					a.subresource("get", strings.Split(item.JsonPath, ".")[0], "log")
+				}
+			}
+		}
+	}
+	if ast.Apply != nil && ast.Apply.While != nil {
+		if err := a.add(ast.Apply.While); err != nil {
+			return err
+		}
+	}
+	if ast.Union != nil {
+		for _, query := range ast.Union.Queries {
+			if err := a.add(query); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// list adds the list requests of a node, or the get requests of a node fetched by name
+func (a *queryAccess) list(node *NodePattern) error {
+	if _, ok := a.nodes[node.ResourceProperties.Name]; ok {
+		return nil
+	}
+	if err := a.resolve(node); err != nil {
+		return err
+	}
+	verb := "list"
+	if a.named[node.ResourceProperties.Name] {
+		verb = "get"
+	}
+	a.mutate(verb, node.ResourceProperties.Name)
+	return nil
+}
+
+// resolve finds the resources of a node, in the namespace it names if it names one
+func (a *queryAccess) resolve(node *NodePattern) error {
+	kind := node.ResourceProperties.Kind
+	if kind == "" {
+		return nil
+	}
+	namespace := a.namespace
+	if node.ResourceProperties.Properties != nil {
+		for _, prop := range node.ResourceProperties.Properties.PropertyList {
+			if isNamespaceProperty(prop) {
+				namespace = fmt.Sprint(prop.Value)
+			}
+		}
+	}
+	targets, err := listTargetsForKind(a.q.Clientset, kind, namespace)
+	if err != nil {
+		return err
+	}
+	fieldSelector, labelSelector, err := a.q.nodeSelectors(node)
+	_, named := namedResource(fieldSelector, labelSelector)
+	named = named && err == nil && kind != "*"
+	var resources []ResourceAccess
+	for _, target := range targets {
+		named = named && target.gets(namespace)
+		resource := ResourceAccess{Group: target.gvr.Group, Version: target.gvr.Version, Resource: target.gvr.Resource}
+		if target.namespaced {
+			resource.Namespace = namespace
+		}
+		resources = append(resources, resource)
+	}
+	a.nodes[node.ResourceProperties.Name] = resources
+	a.named[node.ResourceProperties.Name] = named
+	return nil
+}
+
+// mutate adds the requests of a verb for the resources of a node
+func (a *queryAccess) mutate(verb, nodeId string) {
+	for _, resource := range a.nodes[nodeId] {
+		resource.Verb = verb
+		a.request(resource)
+	}
+}
+
+// create adds the requests creating the resources of a node, which server-side apply creates with a patch
+func (a *queryAccess) create(nodeId string) {
+	a.mutate("create", nodeId)
+	if ServerSideApply {
+		a.mutate("patch", nodeId)
+	}
+}
+
+// subresource adds the requests of a verb for a subresource of the resources of a node
+func (a *queryAccess) subresource(verb, nodeId, subresource string) {
+	for _, resource := range a.nodes[nodeId] {
+		resource.Verb, resource.Subresource = verb, subresource
+		a.request(resource)
+	}
+}
+
+func (a *queryAccess) request(request ResourceAccess) {
+	if !slices.Contains(a.requests, request) {
+		a.requests = append(a.requests, request)
+	}
+}
+
+// AccessDenial is a request of a query the executor's identity isn't allowed to make
+type AccessDenial struct {
+	ResourceAccess
+	Reason string `json:"reason,omitempty"`
+}
+
+func (d AccessDenial) String() string {
+	if d.Reason == "" {
+		return d.ResourceAccess.String()
+	}
+	return fmt.Sprintf("%s (%s)", d.ResourceAccess, d.Reason)
+}
+
+// accessReviewFunc asks the API server whether the executor's identity may make a request
+type accessReviewFunc func(ctx context.Context, review *authorizationv1.SelfSubjectAccessReview) (*authorizationv1.SelfSubjectAccessReview, error)
+
+// ReviewAccess returns the requests the executor's identity isn't allowed to make, asking the API server with a
+// SelfSubjectAccessReview of each. An impersonating executor reviews the access of the identity it impersonates.
+func (q *QueryExecutor) ReviewAccess(ctx context.Context, requests []ResourceAccess) ([]AccessDenial, error) {
+	review := q.accessReview
+	if review == nil {
+		review = func(ctx context.Context, review *authorizationv1.SelfSubjectAccessReview) (*authorizationv1.SelfSubjectAccessReview, error) {
+			return q.Clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+		}
+	}
+	var denials []AccessDenial
+	for _, request := range requests {
+		reviewed, err := review(ctx, &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace:   request.Namespace,
+				Verb:        request.Verb,
+				Group:       request.Group,
+				Version:     request.Version,
+				Resource:    request.Resource,
+				Subresource: request.Subresource,
+			}},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error reviewing access to %s: %w", request, err)
+		}
+		if !reviewed.Status.Allowed {
+			denials = append(denials, AccessDenial{ResourceAccess: request, Reason: reviewed.Status.Reason})
+		}
+	}
+	return denials, nil
+}
+
+// PreflightAccess has queries review that the executor's identity may make every API request they plan before
+// they run, so that a query missing permissions fails at once, listing them all, rather than partway through
+var PreflightAccess bool
+
+// preflight checks a query about to run: that its parameters were given values, and its access if
+// PreflightAccess is set. A watch also needs to watch the resources it lists.
+func (q *QueryExecutor) preflight(ctx context.Context, ast *Expression, namespace string, watch bool) error {
+	if err := unboundParameters(ast); err != nil {
+		return err
+	}
+	if !PreflightAccess || ast.Explain {
+		return nil
+	}
+	requests, err := q.Access(ast, namespace)
+	if err != nil {
+		return err
+	}
+	if watch {
+		for i, request := range requests {
+			if request.Verb == "get" {
+				// Watches list their resources, even those named
+				request.Verb = "list"
+				requests[i] = request
+			}
+			if request.Verb == "list" {
+				request.Verb = "watch"
+				requests = append(requests, request)
+			}
+		}
+	}
+	denials, err := q.ReviewAccess(ctx, requests)
+	if err != nil {
+		return err
+	}
+	if len(denials) == 0 {
+		return nil
+	}
+	denied := make([]string, len(denials))
+	for i, denial := range denials {
+		denied[i] = denial.String()
+	}
+	return newDiagnosticError(CodeAccessDenied, nil, "denials", strings.Join(denied, ", "), "requests", denials)
+}
@@ -0,0 +1,146 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+)
+
+func TestAccess(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected []ResourceAccess
+	}{
+		{
+			query: `MATCH (d:Deployment {namespace: "prod"}), (pv:PersistentVolume) SET d.spec.replicas = 2 RETURN d, pv`,
+			expected: []ResourceAccess{
+				{Verb: "list", Group: "apps", Version: "v1", Resource: "deployments", Namespace: "prod"},
+				{Verb: "list", Version: "v1", Resource: "persistentvolumes"},
+				{Verb: "patch", Group: "apps", Version: "v1", Resource: "deployments", Namespace: "prod"},
+			},
+		},
+		{
+			query: `MATCH (p:Pod) WHERE p.status.phase = "Failed" DELETE p`,
+			expected: []ResourceAccess{
+				{Verb: "list", Version: "v1", Resource: "pods", Namespace: "default"},
+				{Verb: "delete", Version: "v1", Resource: "pods", Namespace: "default"},
+			},
+		},
+		{
+			query: `MATCH (d:Deployment) SET STATUS d.status.phase = "Ready"`,
+			expected: []ResourceAccess{
+				{Verb: "list", Group: "apps", Version: "v1", Resource: "deployments", Namespace: "default"},
+				{Verb: "patch", Group: "apps", Version: "v1", Resource: "deployments", Subresource: "status", Namespace: "default"},
+			},
+		},
+		{
+			query: `MATCH (d:Deployment) SCALE d TO 3`,
+			expected: []ResourceAccess{
+				{Verb: "list", Group: "apps", Version: "v1", Resource: "deployments", Namespace: "default"},
+				{Verb: "patch", Group: "apps", Version: "v1", Resource: "deployments", Subresource: "scale", Namespace: "default"},
+			},
+		},
+		{
+			query: `CREATE (c:ConfigMap {name: "settings"})`,
+			expected: []ResourceAccess{
+				{Verb: "create", Version: "v1", Resource: "configmaps", Namespace: "default"},
+			},
+		},
+		{
+			query: `MATCH (p:Pod) RETURN logs(p) UNION MATCH (s:Service) RETURN s`,
+			expected: []ResourceAccess{
+				{Verb: "list", Version: "v1", Resource: "pods", Namespace: "default"},
+				{Verb: "get", Version: "v1", Resource: "pods", Subresource: "log", Namespace: "default"},
+				{Verb: "list", Version: "v1", Resource: "services", Namespace: "default"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q := newTestQueryExecutor(t)
+			ast, err := ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+			access, err := q.Access(ast, "default")
+			if err != nil {
+				t.Fatalf("Access() error = %v", err)
+			}
+			if !reflect.DeepEqual(access, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, access)
+			}
+		})
+	}
+}
+
+func TestReviewAccess(t *testing.T) {
+	q := newTestQueryExecutor(t)
+	var reviewed []string
+	q.accessReview = func(ctx context.Context, review *authorizationv1.SelfSubjectAccessReview) (*authorizationv1.SelfSubjectAccessReview, error) {
+		attributes := review.Spec.ResourceAttributes
+		reviewed = append(reviewed, attributes.Verb+" "+attributes.Resource)
+		review.Status.Allowed = attributes.Verb == "list"
+		if !review.Status.Allowed {
+			review.Status.Reason = "no RBAC policy matched"
+		}
+		return review, nil
+	}
+	denials, err := q.ReviewAccess(context.Background(), []ResourceAccess{
+		{Verb: "list", Group: "apps", Version: "v1", Resource: "deployments", Namespace: "prod"},
+		{Verb: "patch", Group: "apps", Version: "v1", Resource: "deployments", Namespace: "prod"},
+	})
+	if err != nil {
+		t.Fatalf("ReviewAccess() error = %v", err)
+	}
+	if !reflect.DeepEqual(reviewed, []string{"list deployments", "patch deployments"}) {
+		t.Errorf("expected each request to be reviewed, got %v", reviewed)
+	}
+	if len(denials) != 1 || denials[0].String() != "patch deployments.apps in namespace prod (no RBAC policy matched)" {
+		t.Errorf("expected the patch to be denied, got %v", denials)
+	}
+}
+
+func TestPreflight(t *testing.T) {
+	PreflightAccess = true
+	t.Cleanup(func() { PreflightAccess = false })
+	q := newTestQueryExecutor(t, newPatchTestDeployment())
+	var reviewed []string
+	q.accessReview = func(ctx context.Context, review *authorizationv1.SelfSubjectAccessReview) (*authorizationv1.SelfSubjectAccessReview, error) {
+		attributes := review.Spec.ResourceAttributes
+		reviewed = append(reviewed, attributes.Verb+" "+attributes.Resource)
+		review.Status.Allowed = attributes.Verb != "patch"
+		return review, nil
+	}
+	patches := recordMergePatches(t, q)
+
+	ast, err := ParseQuery(`MATCH (d:Deployment) SCALE d TO 3`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = q.Execute(ast, "default")
+	if DiagnosticCodeOf(err) != CodeAccessDenied || !errors.Is(err, ErrForbidden) {
+		t.Fatalf("expected the query not to be allowed, got %v", err)
+	}
+	if err.Error() != "the query isn't allowed to patch deployments.apps/scale in namespace default" {
+		t.Errorf("expected the denied request to be listed, got %q", err)
+	}
+	if len(*patches) > 0 || !reflect.DeepEqual(reviewed, []string{"list deployments", "patch deployments"}) {
+		t.Errorf("expected the query not to run once its access was reviewed, got %v after reviewing %v", *patches, reviewed)
+	}
+
+	// A watch also reviews watching what it lists
+	reviewed = nil
+	ast, err = ParseQuery(`MATCH (d:Deployment) RETURN d.metadata.name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.preflight(context.Background(), ast, "default", true); err != nil {
+		t.Fatalf("preflight() error = %v", err)
+	}
+	if !reflect.DeepEqual(reviewed, []string{"list deployments", "watch deployments"}) {
+		t.Errorf("expected the list and watch to be reviewed, got %v", reviewed)
+	}
+}
@@ -0,0 +1,100 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestParseApply(t *testing.T) {
+	expr, err := ParseQuery(`APPLY BATCH 5 MATCH (d:Deployment {tier: "batch"}) SET d.spec.replicas = 0 WHILE MATCH (p:Pod {app: "api"}) WHERE p.status.phase = "Running" RETURN p`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	if len(expr.Clauses) != 2 || expr.Apply == nil || expr.Apply.BatchSize != 5 || len(expr.Apply.While.Clauses) != 2 {
+		t.Fatalf("unexpected APPLY query %+v", expr)
+	}
+	if _, ok := expr.Clauses[1].(*SetClause); !ok {
+		t.Errorf("expected the SET clause to be applied, got %T", expr.Clauses[1])
+	}
+
+	expr, err = ParseQuery(`APPLY MATCH (d:Deployment) DELETE d WHILE MATCH (p:Pod) RETURN p`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	if expr.Apply.BatchSize != 1 {
+		t.Errorf("expected batches of 1 change by default, got %d", expr.Apply.BatchSize)
+	}
+
+	// The WHILE query can only read resources
+	if _, err := ParseQuery(`APPLY MATCH (d:Deployment) DELETE d WHILE MATCH (p:Pod) DELETE p`); err == nil {
+		t.Errorf("expected a WHILE query that deletes to fail to parse")
+	}
+}
+
+func TestApplyWhile(t *testing.T) {
+	deploymentsGVR := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	tests := []struct {
+		name string
+		// breakAfter deletes the canary deployment after this many patches, so the WHILE query stops holding
+		breakAfter int
+		patched    []string
+		report     map[string]interface{}
+	}{
+		{
+			name:    "condition holds",
+			patched: []string{"web-1", "web-2", "web-3"},
+			report:  map[string]interface{}{"changes": 3, "batches": 2, "stopped": false},
+		},
+		{
+			name:       "condition stops holding",
+			breakAfter: 2,
+			patched:    []string{"web-1", "web-2"},
+			report:     map[string]interface{}{"changes": 2, "batches": 1, "stopped": true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newTestQueryExecutor(t,
+				newTestObject("apps/v1", "Deployment", "default", "canary", nil),
+				newTestObject("v1", "Pod", "default", "web-1", nil),
+				newTestObject("v1", "Pod", "default", "web-2", nil),
+				newTestObject("v1", "Pod", "default", "web-3", nil),
+			)
+			fake := q.DynamicClient.(*dynamicfake.FakeDynamicClient)
+			var patched []string
+			fake.PrependReactor("patch", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				patched = append(patched, action.(k8stesting.PatchAction).GetName())
+				if len(patched) == tt.breakAfter {
+					if err := fake.Tracker().Delete(deploymentsGVR, "default", "canary"); err != nil {
+						t.Errorf("error deleting the canary: %v", err)
+					}
+				}
+				return false, nil, nil
+			})
+
+			result := executeTestQuery(t, q, `APPLY BATCH 2 MATCH (p:Pod) SET p.metadata.labels.tier = "web" WHILE MATCH (d:Deployment) RETURN d.metadata.name`)
+			if !reflect.DeepEqual(patched, tt.patched) {
+				t.Errorf("expected %v to be patched, got %v", tt.patched, patched)
+			}
+			if !reflect.DeepEqual(result.Data["apply"], tt.report) {
+				t.Errorf("expected report %v, got %v", tt.report, result.Data["apply"])
+			}
+		})
+	}
+}
+
+func TestApplyInvalidBatchSize(t *testing.T) {
+	q := newTestQueryExecutor(t, newTestObject("v1", "Pod", "default", "web-1", nil))
+	ast, err := ParseQuery(`APPLY BATCH 0 MATCH (p:Pod) DELETE p WHILE MATCH (p:Pod) RETURN p`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	if _, err := q.Execute(ast, "default"); DiagnosticCodeOf(err) != CodeInvalidBatchSize {
+		t.Errorf("expected code %s, got %v", CodeInvalidBatchSize, err)
+	}
+}
@@ -0,0 +1,266 @@
+package parser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+// An Atomic query undoes the changes it made if it fails. Each change records how to undo it as it's made, from
+// the state the query found the object in:
+//
+//	created   the object is deleted, provided it's still the one created
+//	deleted   the object is created again, without its status and server-set metadata
+//	patched   a merge patch sets the fields the patch changed back, provided the object wasn't changed since
+//
+// The undo steps run latest first. Undoing can itself fail, e.g. if someone changed the object meanwhile, in
+// which case the error lists the steps that failed as kubectl commands to run by hand.
+
+// serverMetadata are the metadata fields set by the API server, which an undo doesn't restore
+var serverMetadata = []string{"uid", "resourceVersion", "generation", "creationTimestamp", "deletionTimestamp", "deletionGracePeriodSeconds", "managedFields", "selfLink"}
+
+// undoStep is the API call undoing a change of an atomic query
+type undoStep struct {
+	// change is the change undone, e.g. "patched deployments default/web"
+	change    string
+	gvr       schema.GroupVersionResource
+	namespace string
+	name      string
+	// object is created again if set, otherwise patch is applied to subresource if set, otherwise the object
+	// with uid is deleted
+	object      map[string]interface{}
+	patch       []byte
+	subresource string
+	uid         types.UID
+}
+
+// recordUndo records how to undo the change the running query just made, if it's atomic. undo returns nil if
+// the change changed nothing.
+func (q *QueryExecutor) recordUndo(entry LedgerEntry, undo func() (*undoStep, error)) error {
+	if !q.Atomic {
+		return nil
+	}
+	step, err := undo()
+	if err != nil {
+		return fmt.Errorf("error recording how to undo %s >> %w", q.applied[len(q.applied)-1], err)
+	}
+	if step == nil {
+		return nil
+	}
+	step.change = q.applied[len(q.applied)-1]
+	step.gvr = schema.GroupVersionResource{Group: entry.Group, Version: entry.Version, Resource: entry.Resource}
+	step.namespace, step.name = entry.Namespace, entry.Name
+	q.undo = append(q.undo, *step)
+	return nil
+}
+
+// createUndo undoes the creation of an object by deleting it
+func createUndo(created map[string]interface{}) (*undoStep, error) {
+	uid := (&unstructured.Unstructured{Object: created}).GetUID()
+	return &undoStep{uid: uid}, nil
+}
+
+// deleteUndo undoes the deletion of an object by creating it again
+func deleteUndo(prior map[string]interface{}) (*undoStep, error) {
+	object, err := undoCopy(prior)
+	if err != nil {
+		return nil, err
+	}
+	delete(object, "status")
+	return &undoStep{object: object}, nil
+}
+
+// patchUndo undoes a patch with a merge patch from the patched object back to its prior state, or returns nil if
+// the patch changed nothing. The merge patch carries the resourceVersion the patch left the object in, so that it
+// fails rather than overwrite a later change.
+func patchUndo(prior, patched map[string]interface{}, subresource string) (*undoStep, error) {
+	from, err := undoCopy(patched)
+	if err != nil {
+		return nil, err
+	}
+	to, err := undoCopy(prior)
+	if err != nil {
+		return nil, err
+	}
+	var diff map[string]interface{}
+	switch subresource {
+	case "":
+		delete(from, "status")
+		delete(to, "status")
+		diff = mergeDiff(from, to)
+	case "status":
+		diff = mergeDiff(map[string]interface{}{"status": from["status"]}, map[string]interface{}{"status": to["status"]})
+	case "scale":
+		// The scale subresource is a Scale object, only its replicas are set back
+		spec, _ := to["spec"].(map[string]interface{})
+		diff = map[string]interface{}{"spec": map[string]interface{}{"replicas": spec["replicas"]}}
+	default:
+		return nil, fmt.Errorf("the %s subresource can't be undone", subresource)
+	}
+	if len(diff) == 0 {
+		return nil, nil
+	}
+	if resourceVersion := (&unstructured.Unstructured{Object: patched}).GetResourceVersion(); resourceVersion != "" && subresource != "scale" {
+		metadata, _ := diff["metadata"].(map[string]interface{})
+		if metadata == nil {
+			metadata = map[string]interface{}{}
+			diff["metadata"] = metadata
+		}
+		metadata["resourceVersion"] = resourceVersion
+	}
+	patch, err := json.Marshal(diff)
+	if err != nil {
+		return nil, err
+	}
+	return &undoStep{patch: patch, subresource: subresource}, nil
+}
+
+// undoCopy copies an object through JSON, so that its values compare alike whichever client they came from,
+// without its server-set metadata
+func undoCopy(object map[string]interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+	var copied map[string]interface{}
+	if err := json.Unmarshal(data, &copied); err != nil {
+		return nil, err
+	}
+	if metadata, ok := copied["metadata"].(map[string]interface{}); ok {
+		for _, field := range serverMetadata {
+			delete(metadata, field)
+		}
+	}
+	return copied, nil
+}
+
+// mergeDiff is the merge patch turning from into to: changed values are set, removed ones set to null, and maps
+// are patched field by field
+func mergeDiff(from, to map[string]interface{}) map[string]interface{} {
+	diff := map[string]interface{}{}
+	for key, value := range to {
+		fromValue, ok := from[key]
+		fromMap, fromIsMap := fromValue.(map[string]interface{})
+		toMap, toIsMap := value.(map[string]interface{})
+		if fromIsMap && toIsMap {
+			if fieldDiff := mergeDiff(fromMap, toMap); len(fieldDiff) > 0 {
+				diff[key] = fieldDiff
+			}
+			continue
+		}
+		if !ok || !reflect.DeepEqual(fromValue, value) {
+			diff[key] = value
+		}
+	}
+	for key := range from {
+		if _, ok := to[key]; !ok {
+			diff[key] = nil
+		}
+	}
+	return diff
+}
+
+// rollBack undoes the changes of a failed atomic query, latest first, and returns its error noting the rollback
+func (q *QueryExecutor) rollBack(ctx context.Context, err error) error {
+	if len(q.undo) == 0 {
+		return err
+	}
+	undo := q.undo
+	q.undo = nil
+	var failures, commands []string
+	for i := len(undo) - 1; i >= 0; i-- {
+		step := undo[i]
+		verb := step.verb()
+		q.observeAPICall(verb, step.gvr)
+		if undoErr := step.apply(ctx, q.DynamicClient); undoErr != nil {
+			undoErr = apiError(verb, step.gvr, undoErr)
+			logWarn("Rolling back change failed", "change", step.change, "code", string(DiagnosticCodeOf(undoErr)), "error", undoErr)
+			failures = append(failures, step.change+" ("+undoErr.Error()+")")
+			commands = append(commands, step.command())
+			continue
+		}
+		Logger().Info("Rolled back change", "change", step.change)
+		if auditErr := q.audit(step.entry(), true); auditErr != nil {
+			logWarn("Couldn't audit the rollback", "change", step.change, "error", auditErr)
+		}
+	}
+	if len(failures) > 0 {
+		return newDiagnosticError(CodeRollbackFailed, err, "count", len(failures), "failures", strings.Join(failures, ", "), "undo", commands)
+	}
+	return newDiagnosticError(CodeRolledBack, err, "changes", rolledBackChanges(len(undo)))
+}
+
+// verb is the verb of the API call of the step
+func (s undoStep) verb() string {
+	switch {
+	case s.object != nil:
+		return "create"
+	case s.patch != nil:
+		return "patch"
+	}
+	return "delete"
+}
+
+// entry describes the change the step makes, e.g. to audit it
+func (s undoStep) entry() LedgerEntry {
+	verb := map[string]string{"create": "created", "patch": "patched", "delete": "deleted"}[s.verb()]
+	return LedgerEntry{Verb: verb, Group: s.gvr.Group, Version: s.gvr.Version, Resource: s.gvr.Resource, Namespace: s.namespace, Name: s.name, UID: string(s.uid)}
+}
+
+// apply makes the API call of the step
+func (s undoStep) apply(ctx context.Context, client dynamic.Interface) error {
+	resource := client.Resource(s.gvr).Namespace(s.namespace)
+	switch s.verb() {
+	case "create":
+		_, err := resource.Create(ctx, &unstructured.Unstructured{Object: s.object}, metav1.CreateOptions{FieldManager: FieldManager})
+		return err
+	case "patch":
+		var subresources []string
+		if s.subresource != "" {
+			subresources = []string{s.subresource}
+		}
+		_, err := resource.Patch(ctx, s.name, types.MergePatchType, s.patch, metav1.PatchOptions{FieldManager: FieldManager}, subresources...)
+		return err
+	}
+	return resource.Delete(ctx, s.name, metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &s.uid}})
+}
+
+// command is the kubectl command making the API call of the step
+func (s undoStep) command() string {
+	resource := s.gvr.Resource
+	if s.gvr.Group != "" {
+		resource += "." + s.gvr.Group
+	}
+	namespace := ""
+	if s.namespace != "" {
+		namespace = " -n " + s.namespace
+	}
+	switch s.verb() {
+	case "create":
+		object, _ := json.Marshal(s.object)
+		return fmt.Sprintf("kubectl create%s -f - <<'EOF'\n%s\nEOF", namespace, object)
+	case "patch":
+		subresource := ""
+		if s.subresource != "" {
+			subresource = " --subresource " + s.subresource
+		}
+		return fmt.Sprintf("kubectl patch %s %s%s%s --type merge -p '%s'", resource, s.name, namespace, subresource, strings.ReplaceAll(string(s.patch), "'", `'\''`))
+	}
+	return fmt.Sprintf("kubectl delete %s %s%s", resource, s.name, namespace)
+}
+
+// rolledBackChanges describes how many changes were rolled back, e.g. "2 changes were rolled back"
+func rolledBackChanges(count int) string {
+	if count == 1 {
+		return "1 change was rolled back"
+	}
+	return fmt.Sprintf("%d changes were rolled back", count)
+}
@@ -0,0 +1,171 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// failCalls fails the calls of a verb to a resource whose number is in failing, counting from 1
+func failCalls(q *QueryExecutor, verb, resource string, failing ...int) {
+	calls := 0
+	q.DynamicClient.(*dynamicfake.FakeDynamicClient).PrependReactor(verb, resource, func(action k8stesting.Action) (bool, runtime.Object, error) {
+		calls++
+		for _, call := range failing {
+			if calls == call {
+				return true, nil, errors.New("admission webhook denied the request")
+			}
+		}
+		return false, nil, nil
+	})
+}
+
+func TestAtomicRollsBackPatches(t *testing.T) {
+	deployment := func(name string) runtime.Object {
+		return newTestObject("apps/v1", "Deployment", "default", name, map[string]interface{}{
+			"spec": map[string]interface{}{"replicas": int64(2)},
+		})
+	}
+	q := newTestQueryExecutor(t, deployment("api"), deployment("web"))
+	q.Atomic = true
+	// The replicas of both are set, and the label of api, then the label of web fails
+	failCalls(q, "patch", "deployments", 4)
+
+	ast, err := ParseQuery(`MATCH (d:Deployment) SET d.spec.replicas = 5, d.metadata.labels.tier = "web"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = q.Execute(ast, "default")
+	if DiagnosticCodeOf(err) != CodeRolledBack || !strings.Contains(err.Error(), "admission webhook denied the request, 3 changes were rolled back") {
+		t.Fatalf("expected the query to be rolled back, got %v", err)
+	}
+
+	gvr := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	for _, name := range []string{"api", "web"} {
+		object, err := q.DynamicClient.Resource(gvr).Namespace("default").Get(context.Background(), name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if replicas := object.Object["spec"].(map[string]interface{})["replicas"]; replicas != int64(2) {
+			t.Errorf("expected the replicas of %s to be set back, got %v", name, replicas)
+		}
+		if labels := object.GetLabels(); len(labels) > 0 {
+			t.Errorf("expected the labels of %s to be removed, got %v", name, labels)
+		}
+	}
+
+	// Without Atomic, the changes already made stay
+	q.Atomic = false
+	failCalls(q, "patch", "deployments", 4)
+	if _, err := q.Execute(ast, "default"); err == nil || DiagnosticCodeOf(err) == CodeRolledBack {
+		t.Fatalf("expected the query to fail without rolling back, got %v", err)
+	}
+	object, err := q.DynamicClient.Resource(gvr).Namespace("default").Get(context.Background(), "api", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if object.GetLabels()["tier"] != "web" {
+		t.Errorf("expected the change to api to stay, got %v", object.GetLabels())
+	}
+}
+
+func TestAtomicRollsBackDeletes(t *testing.T) {
+	pod := func(name string) runtime.Object {
+		return newTestObject("v1", "Pod", "default", name, map[string]interface{}{
+			"spec":   map[string]interface{}{"nodeName": "node-a"},
+			"status": map[string]interface{}{"phase": "Running"},
+		})
+	}
+	q := newTestQueryExecutor(t, pod("web-1"), pod("web-2"))
+	q.Atomic = true
+	failCalls(q, "delete", "pods", 2)
+
+	ast, err := ParseQuery(`MATCH (p:Pod) DELETE p`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Execute(ast, "default"); DiagnosticCodeOf(err) != CodeRolledBack {
+		t.Fatalf("expected the query to be rolled back, got %v", err)
+	}
+	pods, err := q.DynamicClient.Resource(schema.GroupVersionResource{Version: "v1", Resource: "pods"}).Namespace("default").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods.Items) != 2 {
+		t.Fatalf("expected the deleted pod to be created again, got %d pods", len(pods.Items))
+	}
+	for _, pod := range pods.Items {
+		if pod.GetName() == "web-1" && (pod.Object["status"] != nil || pod.Object["spec"].(map[string]interface{})["nodeName"] != "node-a") {
+			t.Errorf("expected web-1 to be created from its spec, got %v", pod.Object)
+		}
+	}
+}
+
+func TestAtomicRollbackFailed(t *testing.T) {
+	q := newTestQueryExecutor(t, newPatchTestDeployment(), newTestObject("v1", "Pod", "default", "web-1", nil))
+	q.Atomic = true
+	// The label is set, then the pod's patch fails, then undoing the label fails
+	failCalls(q, "patch", "deployments", 2)
+	failCalls(q, "patch", "pods", 1)
+
+	ast, err := ParseQuery(`MATCH (d:Deployment), (p:Pod) SET d.metadata.labels.tier = "web", p.metadata.labels.tier = "web"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = q.Execute(ast, "default")
+	var diagnostic *DiagnosticError
+	if !errors.As(err, &diagnostic) || diagnostic.Code != CodeRollbackFailed {
+		t.Fatalf("expected the rollback to fail, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "1 of its changes couldn't be rolled back: patched deployments default/web") {
+		t.Errorf("expected the change that wasn't undone to be listed, got %v", err)
+	}
+	undo := diagnostic.Details["undo"].([]string)
+	expected := []string{`kubectl patch deployments.apps web -n default --type merge -p '{"metadata":{"labels":null}}'`}
+	if !reflect.DeepEqual(undo, expected) {
+		t.Errorf("expected the command undoing the change, got %v", undo)
+	}
+}
+
+func TestPatchUndo(t *testing.T) {
+	prior := map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "web", "resourceVersion": "1", "labels": map[string]interface{}{"app": "web"}},
+		"spec":     map[string]interface{}{"replicas": 2, "paused": true},
+		"status":   map[string]interface{}{"phase": "Pending"},
+	}
+	patched := map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "web", "resourceVersion": "2", "labels": map[string]interface{}{"app": "web", "tier": "web"}},
+		"spec":     map[string]interface{}{"replicas": int64(2)},
+		"status":   map[string]interface{}{"phase": "Running"},
+	}
+	tests := []struct {
+		subresource string
+		patch       string
+	}{
+		{"", `{"metadata":{"labels":{"tier":null},"resourceVersion":"2"},"spec":{"paused":true}}`},
+		{"status", `{"metadata":{"resourceVersion":"2"},"status":{"phase":"Pending"}}`},
+		{"scale", `{"spec":{"replicas":2}}`},
+	}
+	for _, tt := range tests {
+		step, err := patchUndo(prior, patched, tt.subresource)
+		if err != nil {
+			t.Fatalf("patchUndo(%q) error = %v", tt.subresource, err)
+		}
+		if string(step.patch) != tt.patch || step.subresource != tt.subresource {
+			t.Errorf("expected patch %s of %q, got %s of %q", tt.patch, tt.subresource, step.patch, step.subresource)
+		}
+	}
+
+	// A patch that changed nothing has nothing to undo
+	if step, err := patchUndo(prior, prior, ""); step != nil || err != nil {
+		t.Errorf("expected nothing to undo, got %+v, %v", step, err)
+	}
+}
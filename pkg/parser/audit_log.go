@@ -0,0 +1,221 @@
+package parser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// The audit log records every change queries make, who made it and with which query, so that operators can
+// tell later who changed an object and how. It's a file of JSON lines, one per created, deleted or patched
+// object, appended to as the changes are made:
+//
+//	{"time":"2026-10-16T09:30:00Z","user":"alice","query":"MATCH (d:Deployment) SET d.spec.replicas = 3",
+//	 "verb":"patched","group":"apps","version":"v1","resource":"deployments","namespace":"default","name":"web",...}
+//
+// With AuditEvents, each change is also recorded as an Event of the changed object, which kubectl describe
+// shows along with the object.
+
+// Audit, if set, records the changes of every query
+var Audit *AuditLog
+
+// AuditEvents records the changes of every query as Events of the changed objects
+var AuditEvents bool
+
+// auditTime is when changes are recorded, replaced by tests
+var auditTime = func() time.Time { return time.Now() }
+
+// eventsGVR is the resource the Events of AuditEvents are created as
+var eventsGVR = schema.GroupVersionResource{Version: "v1", Resource: "events"}
+
+// maxEventMessage is the length of Event messages the API server accepts
+const maxEventMessage = 1024
+
+// AuditRecord is a change in the audit log
+type AuditRecord struct {
+	Time time.Time `json:"time"`
+	// User is who the change was made as, empty if it couldn't be told
+	User  string `json:"user,omitempty"`
+	Query string `json:"query"`
+	// Rollback is set for the changes an Atomic query made to undo its earlier ones
+	Rollback bool `json:"rollback,omitempty"`
+	LedgerEntry
+}
+
+// AuditLog is an audit log file, which the queries of several executors may record their changes in at once
+type AuditLog struct {
+	path  string
+	mutex sync.Mutex
+	file  *os.File
+}
+
+// OpenAuditLog opens the audit log at path, creating it if needed, to append the changes of queries to it
+func OpenAuditLog(path string) (*AuditLog, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{path: path, file: file}, nil
+}
+
+// Path is the file the audit log is written to
+func (l *AuditLog) Path() string {
+	return l.path
+}
+
+func (l *AuditLog) Close() error {
+	return l.file.Close()
+}
+
+func (l *AuditLog) record(record AuditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	_, err = l.file.Write(append(data, '\n'))
+	return err
+}
+
+// ReadAuditLog reads the records of an audit log, oldest first
+func ReadAuditLog(path string) ([]AuditRecord, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var records []AuditRecord
+	for i, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var record AuditRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			return nil, fmt.Errorf("error reading audit log %s: line %d >> %w", path, i+1, err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// executorUser is who the API calls of an executor are made as, found once when its first change is audited
+type executorUser struct {
+	once sync.Once
+	name string
+	// lookup asks the API server who the user is, unless name is already known
+	lookup func(ctx context.Context) (string, error)
+}
+
+// newExecutorUser is the user of the executor of config: the impersonated user, or whoever the API server
+// authenticates its credentials as
+func newExecutorUser(config *rest.Config, clientset kubernetes.Interface) *executorUser {
+	user := &executorUser{name: config.Impersonate.UserName}
+	user.lookup = func(ctx context.Context) (string, error) {
+		review, err := clientset.AuthenticationV1().SelfSubjectReviews().Create(ctx, &authenticationv1.SelfSubjectReview{}, metav1.CreateOptions{})
+		if err != nil {
+			// Clusters before 1.28 can't tell, the kubeconfig's user name is the best guess
+			return config.Username, err
+		}
+		return review.Status.UserInfo.Username, nil
+	}
+	return user
+}
+
+func (u *executorUser) get(ctx context.Context) string {
+	if u == nil {
+		return ""
+	}
+	u.once.Do(func() {
+		if u.name != "" || u.lookup == nil {
+			return
+		}
+		name, err := u.lookup(ctx)
+		if err != nil {
+			logWarn("Couldn't tell who changes are made as", "error", err)
+		}
+		u.name = name
+	})
+	return u.name
+}
+
+// audit records a change of the running query in the audit log and as an Event, if enabled. The change is
+// already made, an Event that can't be created is only logged, but failing to write the audit log stops the
+// query from making more changes.
+func (q *QueryExecutor) audit(entry LedgerEntry, rollback bool) error {
+	if Audit == nil && !AuditEvents {
+		return nil
+	}
+	record := AuditRecord{Time: auditTime().UTC(), User: q.user.get(q.context()), Rollback: rollback, LedgerEntry: entry}
+	if q.expression != nil {
+		record.Query = FormatQuery(q.expression)
+	}
+	if AuditEvents {
+		if err := q.createAuditEvent(record); err != nil {
+			logWarn("Couldn't record the change as an Event", "resource", entry.Resource, "name", entry.Name, "error", err)
+		}
+	}
+	if Audit != nil {
+		if err := Audit.record(record); err != nil {
+			return fmt.Errorf("error writing audit log %s >> %w", Audit.Path(), err)
+		}
+	}
+	return nil
+}
+
+// createAuditEvent records a change as an Event of the changed object. Events of cluster-scoped objects are
+// created in the default namespace, as kubectl does.
+func (q *QueryExecutor) createAuditEvent(record AuditRecord) error {
+	gvr := schema.GroupVersionResource{Group: record.Group, Version: record.Version, Resource: record.Resource}
+	kind, _ := KindForGVR(q.Clientset, gvr)
+	namespace := record.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+	user := record.User
+	if user == "" {
+		user = "an unknown user"
+	}
+	message := fmt.Sprintf("%s by %s with %s", record.Verb, user, record.Query)
+	if record.Rollback {
+		message = fmt.Sprintf("%s by %s, rolling back %s", record.Verb, user, record.Query)
+	}
+	if len(message) > maxEventMessage {
+		message = message[:maxEventMessage-3] + "..."
+	}
+	timestamp := record.Time.Format(time.RFC3339)
+	event := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Event",
+		"metadata":   map[string]interface{}{"generateName": record.Name + ".", "namespace": namespace},
+		"involvedObject": map[string]interface{}{
+			"apiVersion": gvr.GroupVersion().String(),
+			"kind":       kind,
+			"namespace":  record.Namespace,
+			"name":       record.Name,
+			"uid":        record.UID,
+		},
+		// e.g. CyphernetesPatched
+		"reason":             "Cyphernetes" + strings.ToUpper(record.Verb[:1]) + record.Verb[1:],
+		"message":            message,
+		"type":               "Normal",
+		"source":             map[string]interface{}{"component": FieldManager},
+		"reportingComponent": FieldManager,
+		"firstTimestamp":     timestamp,
+		"lastTimestamp":      timestamp,
+		"count":              int64(1),
+	}}
+	q.observeAPICall("create", eventsGVR)
+	_, err := q.DynamicClient.Resource(eventsGVR).Namespace(namespace).Create(q.context(), event, metav1.CreateOptions{FieldManager: FieldManager})
+	return err
+}
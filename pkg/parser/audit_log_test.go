@@ -0,0 +1,90 @@
+package parser
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func stubAuditTime(t *testing.T) {
+	original := auditTime
+	t.Cleanup(func() { auditTime = original })
+	auditTime = func() time.Time { return time.Date(2026, 10, 16, 9, 30, 0, 0, time.UTC) }
+}
+
+func TestAuditLog(t *testing.T) {
+	stubAuditTime(t)
+	path := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := OpenAuditLog(path)
+	if err != nil {
+		t.Fatalf("OpenAuditLog() error = %v", err)
+	}
+	defer audit.Close()
+	Audit = audit
+	t.Cleanup(func() { Audit = nil })
+
+	pod := newTestObject("v1", "Pod", "default", "web-1", nil)
+	pod.SetUID("uid-web-1")
+	q := newTestQueryExecutor(t, pod)
+	q.user = &executorUser{name: "alice"}
+	executeTestQuery(t, q, `MATCH (p:Pod) SET p.metadata.labels.tier = "web"`)
+	executeTestQuery(t, q, `MATCH (p:Pod) DELETE p`)
+
+	records, err := ReadAuditLog(path)
+	if err != nil {
+		t.Fatalf("ReadAuditLog() error = %v", err)
+	}
+	at := time.Date(2026, 10, 16, 9, 30, 0, 0, time.UTC)
+	expected := []AuditRecord{
+		{Time: at, User: "alice", Query: `MATCH (p:Pod) SET p.metadata.labels.tier = "web"`,
+			LedgerEntry: LedgerEntry{Verb: "patched", Version: "v1", Resource: "pods", Namespace: "default", Name: "web-1", UID: "uid-web-1", Patch: records[0].Patch}},
+		{Time: at, User: "alice", Query: `MATCH (p:Pod) DELETE p`,
+			LedgerEntry: LedgerEntry{Verb: "deleted", Version: "v1", Resource: "pods", Namespace: "default", Name: "web-1", UID: "uid-web-1"}},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("expected records %+v, got %+v", expected, records)
+	}
+}
+
+func TestAuditEvents(t *testing.T) {
+	stubAuditTime(t)
+	AuditEvents = true
+	t.Cleanup(func() { AuditEvents = false })
+
+	q := newTestQueryExecutor(t, newTestObject("v1", "Pod", "default", "web-1", nil))
+	lookups := 0
+	q.user = &executorUser{lookup: func(ctx context.Context) (string, error) {
+		lookups++
+		return "system:serviceaccount:ops:release-bot", nil
+	}}
+	var events []*unstructured.Unstructured
+	q.DynamicClient.(*dynamicfake.FakeDynamicClient).PrependReactor("create", "events", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		event := action.(k8stesting.CreateAction).GetObject().(*unstructured.Unstructured)
+		events = append(events, event)
+		return true, event, nil
+	})
+
+	executeTestQuery(t, q, `MATCH (p:Pod) SET p.metadata.labels.tier = "web"`)
+	executeTestQuery(t, q, `CREATE (c:ConfigMap {"name": "settings"})`)
+	if len(events) != 2 || lookups != 1 {
+		t.Fatalf("expected an event per change and a single lookup of the user, got %d events and %d lookups", len(events), lookups)
+	}
+	event := events[0].Object
+	involved := map[string]interface{}{"apiVersion": "v1", "kind": "Pod", "namespace": "default", "name": "web-1", "uid": ""}
+	if !reflect.DeepEqual(event["involvedObject"], involved) || event["reason"] != "CyphernetesPatched" || events[0].GetNamespace() != "default" {
+		t.Errorf("expected a CyphernetesPatched event of the pod, got %v", event)
+	}
+	if message := `patched by system:serviceaccount:ops:release-bot with MATCH (p:Pod) SET p.metadata.labels.tier = "web"`; event["message"] != message {
+		t.Errorf("expected message %q, got %q", message, event["message"])
+	}
+	if reason := events[1].Object["reason"]; reason != "CyphernetesCreated" {
+		t.Errorf("expected a CyphernetesCreated event of the config map, got %v", reason)
+	}
+}
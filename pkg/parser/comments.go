@@ -0,0 +1,62 @@
+package parser
+
+import "strings"
+
+// Queries can be documented with comments, // to the end of the line and /* ... */ over as many lines as needed.
+// They're blanked out before the query is lexed, rather than cut, so the positions of syntax errors are those of the
+// query as written.
+
+// StripComments returns the query with its comments replaced by spaces, newlines aside. Comment markers within
+// strings are kept, e.g. in "http://example.com", and a block comment that isn't closed runs to the end of the query.
+func StripComments(query string) string {
+	stripped, _ := stripComments(query)
+	return stripped
+}
+
+// stripComments strips the comments of a query like StripComments, and also returns the offset of the block comment
+// that isn't closed, -1 if there's none
+func stripComments(query string) (string, int) {
+	if !strings.Contains(query, "//") && !strings.Contains(query, "/*") {
+		return query, -1
+	}
+	stripped := []byte(query)
+	var quote byte
+	for i := 0; i < len(stripped); i++ {
+		c := stripped[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case strings.HasPrefix(query[i:], "//"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query) - i
+			}
+			blank(stripped[i : i+end])
+			i += end - 1
+		case strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				blank(stripped[i:])
+				return string(stripped), i
+			}
+			blank(stripped[i : i+2+end+2])
+			i += 2 + end + 1
+		}
+	}
+	return string(stripped), -1
+}
+
+// blank replaces the bytes of a comment with spaces, keeping its newlines so lines are still counted
+func blank(comment []byte) {
+	for i, c := range comment {
+		if c != '\n' {
+			comment[i] = ' '
+		}
+	}
+}
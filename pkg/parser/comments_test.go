@@ -0,0 +1,37 @@
+package parser
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestComments(t *testing.T) {
+	plain, err := ParseQuery(`MATCH (p:Pod {name: "http://web"}) RETURN p.metadata.name`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	documented, err := ParseQuery(`// Pods serving the web
+CYPHERNETES 1
+MATCH (p:Pod {name: "http://web"}) /* named after their URL */
+RETURN p.metadata.name // the name only`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	documented.Version = 0
+	if !reflect.DeepEqual(plain, documented) {
+		t.Errorf("expected comments to be ignored, got %+v", documented)
+	}
+
+	// Errors are reported at their position in the query as written
+	_, err = ParseQuery("/* pods\n   on the node */ MATCH (p:Pod RETURN p")
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.Line != 2 || parseErr.Column != 32 {
+		t.Errorf("expected a syntax error at RETURN, got %v", err)
+	}
+
+	_, err = ParseQuery("MATCH (p:Pod) /* not closed RETURN p")
+	if !errors.As(err, &parseErr) || parseErr.Column != 15 || parseErr.Suggestion != "the comment isn't closed, end it with */" {
+		t.Errorf("expected a block comment that isn't closed to fail, got %v", err)
+	}
+}
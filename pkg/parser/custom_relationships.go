@@ -0,0 +1,77 @@
+package parser
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Custom relationships extend the built-in ones and those found in the resource specs, e.g. with the relationships
+// between the custom resources of an operator. They're kept apart from the others so that a long-running program,
+// such as the web server, can replace them while queries run: queries see the new rules from their next
+// relationship on. Custom rules are looked up after the others, so one relating the same kinds as a built-in rule
+// takes precedence over it.
+
+var (
+	customRelationshipRules []RelationshipRule
+	customRelationshipMutex sync.RWMutex
+)
+
+// activeRelationshipRules lists the rules relationships are resolved with, the custom ones last. The list mustn't
+// be changed.
+func activeRelationshipRules() []RelationshipRule {
+	customRelationshipMutex.RLock()
+	defer customRelationshipMutex.RUnlock()
+	if len(customRelationshipRules) == 0 {
+		return relationshipRules
+	}
+	return slices.Concat(relationshipRules, customRelationshipRules)
+}
+
+// SetCustomRelationships replaces the custom relationship rules. A rule relates resources of KindA to those of
+// KindB, both plural resource names such as "certificates", and its relationship points from KindB to KindA. The
+// rules are checked first, and none are replaced if one of them is invalid.
+func SetCustomRelationships(rules []RelationshipRule) error {
+	normalized := make([]RelationshipRule, 0, len(rules))
+	for i, rule := range rules {
+		if err := validateRelationshipRule(rule); err != nil {
+			return fmt.Errorf("relationship %d: %w", i+1, err)
+		}
+		rule.KindA, rule.KindB = strings.ToLower(rule.KindA), strings.ToLower(rule.KindB)
+		rule.MatchCriteria = slices.Clone(rule.MatchCriteria)
+		normalized = append(normalized, rule)
+	}
+	customRelationshipMutex.Lock()
+	defer customRelationshipMutex.Unlock()
+	customRelationshipRules = normalized
+	return nil
+}
+
+// CustomRelationships lists the custom relationship rules
+func CustomRelationships() []RelationshipRule {
+	customRelationshipMutex.RLock()
+	defer customRelationshipMutex.RUnlock()
+	return slices.Clone(customRelationshipRules)
+}
+
+func validateRelationshipRule(rule RelationshipRule) error {
+	if rule.KindA == "" || rule.KindB == "" {
+		return fmt.Errorf("needs both kinds")
+	}
+	if rule.Relationship == "" {
+		return fmt.Errorf("needs a relationship type")
+	}
+	if len(rule.MatchCriteria) == 0 {
+		return fmt.Errorf("%s needs match criteria", rule.Relationship)
+	}
+	for _, criterion := range rule.MatchCriteria {
+		if !strings.HasPrefix(criterion.FieldA, "$.") || !strings.HasPrefix(criterion.FieldB, "$.") {
+			return fmt.Errorf("%s: fields must be JSONPaths starting with $., got %q and %q", rule.Relationship, criterion.FieldA, criterion.FieldB)
+		}
+		if criterion.ComparisonType != ExactMatch && criterion.ComparisonType != ContainsAll {
+			return fmt.Errorf("%s: unknown comparison %q, expected %s or %s", rule.Relationship, criterion.ComparisonType, ExactMatch, ContainsAll)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package parser
+
+import "testing"
+
+func TestCustomRelationships(t *testing.T) {
+	t.Cleanup(func() { SetCustomRelationships(nil) })
+	q := newTestQueryExecutor(t,
+		newTestObject("v1", "Service", "default", "web", map[string]interface{}{
+			"spec": map[string]interface{}{"tls": map[string]interface{}{"secretName": "web-tls"}},
+		}),
+		newTestObject("v1", "Secret", "default", "web-tls", nil),
+		newTestObject("v1", "Secret", "default", "db-password", nil),
+	)
+
+	err := SetCustomRelationships([]RelationshipRule{{
+		KindA:        "Services",
+		KindB:        "secrets",
+		Relationship: "SECRET_SECURES_SERVICE",
+		MatchCriteria: []MatchCriterion{{
+			FieldA:         "$.spec.tls.secretName",
+			FieldB:         "$.metadata.name",
+			ComparisonType: ExactMatch,
+		}},
+	}})
+	if err != nil {
+		t.Fatalf("SetCustomRelationships() error = %v", err)
+	}
+	result := executeTestQuery(t, q, `MATCH (svc:Service)<-[r]-(s:Secret) RETURN s.metadata.name, type(r)`)
+	if secrets := result.Data["s"].([]interface{}); len(secrets) != 1 || secrets[0].(map[string]interface{})["name"] != "web-tls" {
+		t.Errorf("expected the secret the custom relationship relates, got %v", secrets)
+	}
+
+	for _, invalid := range []RelationshipRule{
+		{KindA: "services", Relationship: "X", MatchCriteria: []MatchCriterion{{FieldA: "$.a", FieldB: "$.b", ComparisonType: ExactMatch}}},
+		{KindA: "services", KindB: "secrets", Relationship: "X"},
+		{KindA: "services", KindB: "secrets", Relationship: "X", MatchCriteria: []MatchCriterion{{FieldA: "spec.a", FieldB: "$.b", ComparisonType: ExactMatch}}},
+		{KindA: "services", KindB: "secrets", Relationship: "X", MatchCriteria: []MatchCriterion{{FieldA: "$.a", FieldB: "$.b", ComparisonType: "Fuzzy"}}},
+	} {
+		if err := SetCustomRelationships([]RelationshipRule{invalid}); err == nil {
+			t.Errorf("expected %+v to be rejected", invalid)
+		}
+	}
+	if rules := CustomRelationships(); len(rules) != 1 || rules[0].KindA != "services" {
+		t.Errorf("expected the invalid rules to leave the custom ones as they were, got %+v", rules)
+	}
+
+	SetCustomRelationships(nil)
+	ast, err := ParseQuery(`MATCH (svc:Service)<-(s:Secret) RETURN s`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Execute(ast, "default"); err == nil {
+		t.Errorf("expected the relationship to be gone once the custom rules are cleared")
+	}
+}
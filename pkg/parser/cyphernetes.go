@@ -1,26 +1,19 @@
-// Code generated by goyacc - DO NOT EDIT.
+// Code generated by goyacc -o pkg/parser/cyphernetes.go -p yy grammar/cyphernetes.y. DO NOT EDIT.
 
+//line grammar/cyphernetes.y:2
 package parser
 
 import __yyfmt__ "fmt"
 
+//line grammar/cyphernetes.y:2
+
 import (
 	"fmt"
-	"log"
 	"strconv"
 	"strings"
 )
 
-func yyerror(s string) {
-	fmt.Printf("Syntax error: %s\n", s)
-}
-
-func debugLog(v ...interface{}) {
-	if LogLevel == "debug" {
-		log.Println(v...)
-	}
-}
-
+//line grammar/cyphernetes.y:11
 type yySymType struct {
 	yys                  int
 	strVal               string
@@ -28,462 +21,608 @@ type yySymType struct {
 	nodePattern          *NodePattern
 	clause               *Clause
 	expression           *Expression
+	union                *Union
 	matchClause          *MatchClause
+	clauses              []Clause
+	intVal               int
 	setClause            *SetClause
 	deleteClause         *DeleteClause
+	operationClause      *OperationClause
 	createClause         *CreateClause
+	mergeClause          *MergeClause
+	withClause           *WithClause
+	unwindClause         *UnwindClause
 	returnClause         *ReturnClause
 	returnItems          []*ReturnItem
 	returnItem           *ReturnItem
+	orderItems           []*OrderItem
+	orderItem            *OrderItem
 	properties           *Properties
 	jsonPathValue        *Property
 	jsonPathValueList    []*Property
 	keyValuePairs        []*KeyValuePair
 	keyValuePair         *KeyValuePair
+	functionArgs         []*FunctionArg
+	functionArg          *FunctionArg
+	temporalExpression   *TemporalExpression
+	temporalTerm         *TemporalTerm
 	value                interface{}
+	values               []interface{}
 	relationship         *Relationship
+	hops                 *Hops
 	resourceProperties   *ResourceProperties
 	nodeRelationshipList *NodeRelationshipList
 	nodeIds              []string
 }
 
-type yyXError struct {
-	state, xsym int
+const IDENT = 57346
+const JSONPATH = 57347
+const INT = 57348
+const BOOLEAN = 57349
+const STRING = 57350
+const JSONDATA = 57351
+const FUNCTION = 57352
+const PATCH_TYPE = 57353
+const PARAMETER = 57354
+const HOPS = 57355
+const LPAREN = 57356
+const RPAREN = 57357
+const COLON = 57358
+const MATCH = 57359
+const WHERE = 57360
+const SET = 57361
+const DELETE = 57362
+const CREATE = 57363
+const MERGE = 57364
+const RETURN = 57365
+const EOF = 57366
+const LBRACE = 57367
+const RBRACE = 57368
+const COMMA = 57369
+const EQUALS = 57370
+const AS = 57371
+const REL_NOPROPS_RIGHT = 57372
+const REL_NOPROPS_LEFT = 57373
+const REL_NOPROPS_BOTH = 57374
+const REL_NOPROPS_NONE = 57375
+const REL_BEGINPROPS_LEFT = 57376
+const REL_BEGINPROPS_NONE = 57377
+const REL_ENDPROPS_RIGHT = 57378
+const REL_ENDPROPS_NONE = 57379
+const IN = 57380
+const NOT = 57381
+const EXISTS = 57382
+const LBRACKET = 57383
+const RBRACKET = 57384
+const EXPLAIN = 57385
+const OPTIONAL = 57386
+const APPLY = 57387
+const BATCH = 57388
+const WHILE = 57389
+const WITH = 57390
+const UNWIND = 57391
+const DISTINCT = 57392
+const ORDER_BY = 57393
+const ASC = 57394
+const DESC = 57395
+const UNION = 57396
+const ALL = 57397
+const CONTAINS = 57398
+const STARTS = 57399
+const ENDS = 57400
+const REGEX_MATCH = 57401
+const PLUS = 57402
+const MINUS = 57403
+const NULL = 57404
+const RESTART = 57405
+const SCALE = 57406
+const TO = 57407
+const PAUSE = 57408
+const RESUME = 57409
+const STATUS = 57410
+const COUNT = 57411
+const SUM = 57412
+const NOT_EQUALS = 57413
+const GREATER_THAN = 57414
+const LESS_THAN = 57415
+const GREATER_THAN_EQUALS = 57416
+const LESS_THAN_EQUALS = 57417
+
+var yyToknames = [...]string{
+	"$end",
+	"error",
+	"$unk",
+	"IDENT",
+	"JSONPATH",
+	"INT",
+	"BOOLEAN",
+	"STRING",
+	"JSONDATA",
+	"FUNCTION",
+	"PATCH_TYPE",
+	"PARAMETER",
+	"HOPS",
+	"LPAREN",
+	"RPAREN",
+	"COLON",
+	"MATCH",
+	"WHERE",
+	"SET",
+	"DELETE",
+	"CREATE",
+	"MERGE",
+	"RETURN",
+	"EOF",
+	"LBRACE",
+	"RBRACE",
+	"COMMA",
+	"EQUALS",
+	"AS",
+	"REL_NOPROPS_RIGHT",
+	"REL_NOPROPS_LEFT",
+	"REL_NOPROPS_BOTH",
+	"REL_NOPROPS_NONE",
+	"REL_BEGINPROPS_LEFT",
+	"REL_BEGINPROPS_NONE",
+	"REL_ENDPROPS_RIGHT",
+	"REL_ENDPROPS_NONE",
+	"IN",
+	"NOT",
+	"EXISTS",
+	"LBRACKET",
+	"RBRACKET",
+	"EXPLAIN",
+	"OPTIONAL",
+	"APPLY",
+	"BATCH",
+	"WHILE",
+	"WITH",
+	"UNWIND",
+	"DISTINCT",
+	"ORDER_BY",
+	"ASC",
+	"DESC",
+	"UNION",
+	"ALL",
+	"CONTAINS",
+	"STARTS",
+	"ENDS",
+	"REGEX_MATCH",
+	"PLUS",
+	"MINUS",
+	"NULL",
+	"RESTART",
+	"SCALE",
+	"TO",
+	"PAUSE",
+	"RESUME",
+	"STATUS",
+	"COUNT",
+	"SUM",
+	"NOT_EQUALS",
+	"GREATER_THAN",
+	"LESS_THAN",
+	"GREATER_THAN_EQUALS",
+	"LESS_THAN_EQUALS",
 }
 
-const (
-	yyDefault           = 57382
-	yyEofCode           = 57344
-	AS                  = 57366
-	BOOLEAN             = 57349
-	COLON               = 57354
-	COMMA               = 57364
-	COUNT               = 57375
-	CREATE              = 57359
-	DELETE              = 57358
-	EOF                 = 57361
-	EQUALS              = 57365
-	GREATER_THAN        = 57378
-	GREATER_THAN_EQUALS = 57380
-	IDENT               = 57346
-	INT                 = 57348
-	JSONDATA            = 57351
-	JSONPATH            = 57347
-	LBRACE              = 57362
-	LESS_THAN           = 57379
-	LESS_THAN_EQUALS    = 57381
-	LPAREN              = 57352
-	MATCH               = 57355
-	NOT_EQUALS          = 57377
-	RBRACE              = 57363
-	REL_BEGINPROPS_LEFT = 57371
-	REL_BEGINPROPS_NONE = 57372
-	REL_ENDPROPS_NONE   = 57374
-	REL_ENDPROPS_RIGHT  = 57373
-	REL_NOPROPS_BOTH    = 57369
-	REL_NOPROPS_LEFT    = 57368
-	REL_NOPROPS_NONE    = 57370
-	REL_NOPROPS_RIGHT   = 57367
-	RETURN              = 57360
-	RPAREN              = 57353
-	SET                 = 57357
-	STRING              = 57350
-	SUM                 = 57376
-	WHERE               = 57356
-	yyErrCode           = 57345
-
-	yyMaxDepth = 200
-	yyTabOfs   = -59
-)
+var yyStatenames = [...]string{}
 
-var (
-	yyPrec = map[int]int{}
-
-	yyXLAT = map[int]int{
-		57361: 0,  // EOF (41x)
-		57364: 1,  // COMMA (34x)
-		57360: 2,  // RETURN (27x)
-		57359: 3,  // CREATE (23x)
-		57358: 4,  // DELETE (22x)
-		57357: 5,  // SET (22x)
-		57352: 6,  // LPAREN (14x)
-		57363: 7,  // RBRACE (10x)
-		57344: 8,  // $end (9x)
-		57346: 9,  // IDENT (9x)
-		57347: 10, // JSONPATH (9x)
-		57351: 11, // JSONDATA (8x)
-		57356: 12, // WHERE (8x)
-		57349: 13, // BOOLEAN (7x)
-		57348: 14, // INT (7x)
-		57350: 15, // STRING (7x)
-		57401: 16, // Value (7x)
-		57392: 17, // NodePattern (6x)
-		57374: 18, // REL_ENDPROPS_NONE (6x)
-		57373: 19, // REL_ENDPROPS_RIGHT (6x)
-		57353: 20, // RPAREN (6x)
-		57393: 21, // NodeRelationshipList (5x)
-		57371: 22, // REL_BEGINPROPS_LEFT (4x)
-		57372: 23, // REL_BEGINPROPS_NONE (4x)
-		57369: 24, // REL_NOPROPS_BOTH (4x)
-		57368: 25, // REL_NOPROPS_LEFT (4x)
-		57370: 26, // REL_NOPROPS_NONE (4x)
-		57367: 27, // REL_NOPROPS_RIGHT (4x)
-		57397: 28, // ReturnClause (4x)
-		57366: 29, // AS (3x)
-		57354: 30, // COLON (3x)
-		57388: 31, // KeyValuePair (3x)
-		57362: 32, // LBRACE (3x)
-		57396: 33, // ResourceProperties (3x)
-		57375: 34, // COUNT (2x)
-		57383: 35, // CreateClause (2x)
-		57386: 36, // JSONPathValue (2x)
-		57389: 37, // KeyValuePairs (2x)
-		57395: 38, // Relationship (2x)
-		57398: 39, // ReturnItem (2x)
-		57376: 40, // SUM (2x)
-		57384: 41, // DeleteClause (1x)
-		57365: 42, // EQUALS (1x)
-		57385: 43, // Expression (1x)
-		57378: 44, // GREATER_THAN (1x)
-		57380: 45, // GREATER_THAN_EQUALS (1x)
-		57387: 46, // JSONPathValueList (1x)
-		57379: 47, // LESS_THAN (1x)
-		57381: 48, // LESS_THAN_EQUALS (1x)
-		57355: 49, // MATCH (1x)
-		57390: 50, // MatchClause (1x)
-		57391: 51, // NodeIds (1x)
-		57377: 52, // NOT_EQUALS (1x)
-		57394: 53, // Properties (1x)
-		57399: 54, // ReturnItems (1x)
-		57400: 55, // SetClause (1x)
-		57382: 56, // $default (0x)
-		57345: 57, // error (0x)
-	}
+const yyEofCode = 1
+const yyErrCode = 2
+const yyInitialStackSize = 16
 
-	yySymNames = []string{
-		"EOF",
-		"COMMA",
-		"RETURN",
-		"CREATE",
-		"DELETE",
-		"SET",
-		"LPAREN",
-		"RBRACE",
-		"$end",
-		"IDENT",
-		"JSONPATH",
-		"JSONDATA",
-		"WHERE",
-		"BOOLEAN",
-		"INT",
-		"STRING",
-		"Value",
-		"NodePattern",
-		"REL_ENDPROPS_NONE",
-		"REL_ENDPROPS_RIGHT",
-		"RPAREN",
-		"NodeRelationshipList",
-		"REL_BEGINPROPS_LEFT",
-		"REL_BEGINPROPS_NONE",
-		"REL_NOPROPS_BOTH",
-		"REL_NOPROPS_LEFT",
-		"REL_NOPROPS_NONE",
-		"REL_NOPROPS_RIGHT",
-		"ReturnClause",
-		"AS",
-		"COLON",
-		"KeyValuePair",
-		"LBRACE",
-		"ResourceProperties",
-		"COUNT",
-		"CreateClause",
-		"JSONPathValue",
-		"KeyValuePairs",
-		"Relationship",
-		"ReturnItem",
-		"SUM",
-		"DeleteClause",
-		"EQUALS",
-		"Expression",
-		"GREATER_THAN",
-		"GREATER_THAN_EQUALS",
-		"JSONPathValueList",
-		"LESS_THAN",
-		"LESS_THAN_EQUALS",
-		"MATCH",
-		"MatchClause",
-		"NodeIds",
-		"NOT_EQUALS",
-		"Properties",
-		"ReturnItems",
-		"SetClause",
-		"$default",
-		"error",
-	}
+//line grammar/cyphernetes.y:791
 
-	yyTokenLiteralStrings = map[int]string{}
-
-	yyReductions = map[int]struct{ xsym, components int }{
-		0:  {0, 1},
-		1:  {43, 3},
-		2:  {43, 3},
-		3:  {43, 4},
-		4:  {43, 3},
-		5:  {43, 2},
-		6:  {43, 3},
-		7:  {43, 3},
-		8:  {43, 4},
-		9:  {50, 2},
-		10: {50, 4},
-		11: {35, 2},
-		12: {55, 2},
-		13: {41, 2},
-		14: {51, 1},
-		15: {51, 3},
-		16: {37, 1},
-		17: {37, 3},
-		18: {31, 3},
-		19: {31, 3},
-		20: {31, 3},
-		21: {31, 3},
-		22: {31, 3},
-		23: {31, 3},
-		24: {21, 1},
-		25: {21, 3},
-		26: {21, 5},
-		27: {21, 5},
-		28: {21, 3},
-		29: {17, 3},
-		30: {17, 3},
-		31: {28, 2},
-		32: {54, 1},
-		33: {54, 3},
-		34: {39, 1},
-		35: {39, 3},
-		36: {39, 4},
-		37: {39, 4},
-		38: {39, 6},
-		39: {39, 6},
-		40: {38, 1},
-		41: {38, 1},
-		42: {38, 1},
-		43: {38, 1},
-		44: {38, 3},
-		45: {38, 3},
-		46: {38, 3},
-		47: {38, 3},
-		48: {33, 3},
-		49: {33, 4},
-		50: {33, 5},
-		51: {53, 3},
-		52: {46, 1},
-		53: {46, 3},
-		54: {36, 3},
-		55: {16, 1},
-		56: {16, 1},
-		57: {16, 1},
-		58: {16, 1},
-	}
+//line yacctab:1
+var yyExca = [...]int16{
+	-1, 1,
+	1, -1,
+	-2, 0,
+	-1, 259,
+	28, 75,
+	56, 75,
+	57, 75,
+	58, 75,
+	59, 75,
+	71, 75,
+	72, 75,
+	73, 75,
+	74, 75,
+	75, 75,
+	-2, 73,
+}
 
-	yyXErrors = map[yyXError]string{}
-
-	yyParseTab = [112][]uint16{
-		// 0
-		{3: 64, 35: 62, 43: 60, 49: 63, 61},
-		{8: 59},
-		{2: 131, 64, 157, 156, 28: 152, 35: 155, 41: 154, 55: 153},
-		{129, 2: 131, 28: 130},
-		{6: 67, 17: 66, 21: 110},
-		// 5
-		{6: 67, 17: 66, 21: 65},
-		{48, 2: 48},
-		{35, 90, 35, 35, 35, 35, 12: 35, 22: 96, 95, 94, 92, 91, 93, 38: 89},
-		{9: 69, 33: 68},
-		{20: 88},
-		// 10
-		{20: 70, 30: 71},
-		{29, 29, 29, 29, 29, 29, 12: 29, 22: 29, 29, 29, 29, 29, 29},
-		{9: 72},
-		{18: 11, 11, 11, 32: 74, 53: 73},
-		{18: 10, 10, 10},
-		// 15
-		{10: 78, 75, 36: 77, 46: 76},
-		{18: 9, 9, 9},
-		{1: 86, 7: 85},
-		{1: 7, 7: 7},
-		{30: 79},
-		// 20
-		{11: 84, 13: 83, 82, 81, 80},
-		{1: 5, 7: 5},
-		{4, 4, 4, 4, 4, 4, 7: 4},
-		{3, 3, 3, 3, 3, 3, 7: 3},
-		{2, 2, 2, 2, 2, 2, 7: 2},
-		// 25
-		{1, 1, 1, 1, 1, 1, 7: 1},
-		{18: 8, 8, 8},
-		{10: 78, 36: 87},
-		{1: 6, 7: 6},
-		{30, 30, 30, 30, 30, 30, 12: 30, 22: 30, 30, 30, 30, 30, 30},
-		// 30
-		{6: 67, 17: 105},
-		{6: 67, 17: 66, 21: 104},
-		{6: 19},
-		{6: 18},
-		{6: 17},
-		// 35
-		{6: 16},
-		{9: 98, 33: 101},
-		{9: 98, 33: 97},
-		{18: 99, 100},
-		{30: 71},
-		// 40
-		{6: 14},
-		{6: 12},
-		{18: 102, 103},
-		{6: 15},
-		{6: 13},
-		// 45
-		{31, 2: 31, 31, 31, 31, 12: 31},
-		{34, 106, 34, 34, 34, 34, 12: 34, 22: 96, 95, 94, 92, 91, 93, 38: 107},
-		{6: 67, 17: 66, 21: 109},
-		{6: 67, 17: 66, 21: 108},
-		{32, 2: 32, 32, 32, 32, 12: 32},
-		// 50
-		{33, 2: 33, 33, 33, 33, 12: 33},
-		{2: 50, 50, 50, 50, 12: 111},
-		{10: 114, 31: 113, 37: 112},
-		{1: 127, 49, 49, 49, 49},
-		{43, 43, 43, 43, 43, 43},
-		// 55
-		{42: 115, 44: 117, 119, 47: 118, 120, 52: 116},
-		{11: 84, 13: 83, 82, 81, 126},
-		{11: 84, 13: 83, 82, 81, 125},
-		{11: 84, 13: 83, 82, 81, 124},
-		{11: 84, 13: 83, 82, 81, 123},
-		// 60
-		{11: 84, 13: 83, 82, 81, 122},
-		{11: 84, 13: 83, 82, 81, 121},
-		{36, 36, 36, 36, 36, 36},
-		{37, 37, 37, 37, 37, 37},
-		{38, 38, 38, 38, 38, 38},
-		// 65
-		{39, 39, 39, 39, 39, 39},
-		{40, 40, 40, 40, 40, 40},
-		{41, 41, 41, 41, 41, 41},
-		{10: 114, 31: 128},
-		{42, 42, 42, 42, 42, 42},
-		// 70
-		{8: 54},
-		{151},
-		{10: 134, 34: 135, 39: 133, 136, 54: 132},
-		{28, 149},
-		{27, 27},
-		// 75
-		{25, 25, 29: 147},
-		{32: 142},
-		{32: 137},
-		{10: 138},
-		{7: 139},
-		// 80
-		{22, 22, 29: 140},
-		{9: 141},
-		{20, 20},
-		{10: 143},
-		{7: 144},
-		// 85
-		{23, 23, 29: 145},
-		{9: 146},
-		{21, 21},
-		{9: 148},
-		{24, 24},
-		// 90
-		{10: 134, 34: 135, 39: 150, 136},
-		{26, 26},
-		{8: 53},
-		{170},
-		{167, 2: 131, 28: 168},
-		// 95
-		{166},
-		{163, 2: 131, 28: 164},
-		{10: 114, 31: 113, 37: 162},
-		{9: 159, 51: 158},
-		{46, 160},
-		// 100
-		{45, 45},
-		{9: 161},
-		{44, 44},
-		{47, 127, 47},
-		{8: 52},
-		// 105
-		{165},
-		{8: 51},
-		{8: 55},
-		{8: 57},
-		{169},
-		// 110
-		{8: 56},
-		{8: 58},
-	}
-)
+const yyPrivate = 57344
+
+const yyLast = 355
+
+var yyAct = [...]int16{
+	294, 293, 269, 197, 181, 44, 233, 100, 138, 23,
+	70, 85, 73, 108, 35, 125, 47, 40, 42, 83,
+	5, 45, 33, 86, 34, 115, 58, 6, 89, 60,
+	6, 63, 65, 48, 66, 69, 54, 86, 136, 56,
+	50, 52, 89, 132, 133, 134, 131, 68, 228, 229,
+	26, 27, 10, 98, 32, 9, 191, 93, 126, 127,
+	128, 129, 130, 92, 26, 27, 55, 139, 84, 190,
+	15, 53, 235, 236, 114, 36, 137, 120, 116, 37,
+	38, 110, 122, 123, 76, 14, 280, 87, 88, 75,
+	71, 140, 9, 57, 28, 29, 295, 30, 31, 290,
+	18, 87, 88, 21, 141, 149, 149, 157, 28, 29,
+	155, 30, 31, 151, 151, 148, 148, 150, 150, 36,
+	158, 162, 156, 37, 38, 20, 173, 183, 184, 185,
+	186, 187, 188, 189, 171, 172, 170, 169, 175, 176,
+	174, 177, 182, 297, 179, 32, 19, 72, 251, 250,
+	199, 195, 9, 297, 113, 43, 10, 11, 300, 283,
+	249, 248, 265, 206, 209, 291, 36, 292, 296, 264,
+	37, 38, 247, 246, 245, 244, 112, 263, 3, 227,
+	4, 284, 285, 286, 222, 262, 214, 168, 153, 168,
+	142, 231, 232, 90, 178, 208, 239, 111, 104, 103,
+	105, 102, 107, 106, 121, 225, 224, 221, 220, 213,
+	212, 77, 241, 101, 242, 243, 104, 103, 105, 102,
+	107, 106, 234, 219, 218, 217, 216, 211, 210, 91,
+	281, 282, 266, 255, 256, 259, 152, 136, 261, 237,
+	79, 80, 81, 82, 260, 139, 146, 260, 144, 26,
+	253, 32, 97, 32, 41, 25, 32, 145, 99, 143,
+	32, 64, 32, 62, 32, 59, 32, 39, 254, 154,
+	119, 118, 117, 96, 95, 61, 9, 9, 163, 159,
+	67, 10, 11, 271, 289, 288, 240, 165, 161, 258,
+	164, 160, 167, 168, 238, 166, 257, 298, 299, 46,
+	230, 147, 135, 76, 182, 76, 287, 194, 75, 124,
+	75, 273, 275, 270, 274, 7, 51, 267, 270, 198,
+	205, 204, 22, 203, 202, 201, 192, 94, 279, 278,
+	277, 276, 226, 223, 215, 207, 200, 193, 109, 78,
+	2, 1, 196, 180, 12, 272, 74, 252, 268, 8,
+	13, 49, 24, 17, 16,
+}
+
+var yyPact = [...]int16{
+	135, -1000, -1000, 260, 39, 46, 31, 243, 230, 285,
+	285, 285, -1000, 259, 310, -1000, 17, 12, 38, 241,
+	251, 239, 237, -1000, 122, 233, 79, 335, 335, 335,
+	335, 335, 18, -1000, -1000, -1000, 259, 32, 322, -1000,
+	250, -1000, 249, 228, 240, 186, 334, -1000, -1000, 34,
+	45, -1000, -1000, 259, -1000, -30, -1000, 259, 122, -1000,
+	248, -1000, -1000, 247, -1000, 246, -1000, 233, -1000, -1000,
+	177, 300, 298, -1000, -13, 288, -1000, 210, -1000, 210,
+	11, 210, 210, 40, 32, -1000, 161, 234, 232, 287,
+	75, 75, -1000, 218, 159, -1000, -1000, -1000, 245, 300,
+	285, 285, -1000, -1000, -1000, -1000, 275, 274, 280, 277,
+	259, -1000, -1000, -1000, -1000, 259, -1000, -1000, -1000, -1000,
+	-1000, 300, 177, 177, 300, 132, 132, 132, 132, 132,
+	132, 132, 132, 21, 8, 321, 333, 301, -1000, 32,
+	314, 40, 332, 320, 319, 318, 316, 315, -1000, -1000,
+	-1000, -1000, 300, 331, -1000, 177, 168, -1000, 191, 173,
+	330, 189, 187, 171, 329, 169, -1000, -1000, 328, 233,
+	-1000, -1000, 177, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
+	-12, -1000, 286, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
+	132, 132, -1000, -1000, -1000, -1000, 195, -1000, 20, -1000,
+	-1000, 213, 279, 170, 271, -1000, 177, -1000, 285, 285,
+	-1000, -1000, -1000, -1000, 138, 136, -1000, -1000, -1000, -1000,
+	-1000, -1000, 124, 112, -1000, -1000, 225, 244, 294, 294,
+	281, -1000, -1000, 220, 314, -1000, -1000, 156, 148, 140,
+	133, 217, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
+	-1000, -1000, -1000, 308, -1000, -1000, -1000, -1000, 268, -1000,
+	306, -1000, 327, 326, 325, 324, 57, -1000, 204, -1000,
+	143, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000, -1000,
+	302, -1000, 313, 132, 58, 127, -1000, -1000, -1000, -1000,
+	132, 55, -1000, 126, -1000, 132, -1000, 132, 116, -1000,
+	-1000,
+}
+
+var yyPgo = [...]int16{
+	0, 340, 20, 354, 353, 26, 22, 352, 351, 350,
+	146, 125, 103, 315, 349, 24, 14, 255, 193, 9,
+	21, 348, 2, 0, 1, 347, 7, 13, 5, 10,
+	12, 346, 6, 345, 343, 4, 211, 19, 11, 8,
+	342, 3, 341,
+}
+
+var yyR1 = [...]int8{
+	0, 42, 42, 42, 9, 9, 8, 8, 8, 1,
+	1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+	1, 1, 1, 1, 1, 2, 2, 2, 2, 3,
+	3, 4, 4, 5, 5, 7, 7, 6, 15, 15,
+	16, 17, 17, 18, 18, 18, 18, 18, 13, 14,
+	10, 10, 10, 10, 11, 12, 12, 12, 12, 36,
+	36, 29, 29, 30, 30, 30, 30, 30, 30, 30,
+	30, 30, 30, 30, 31, 31, 32, 32, 33, 33,
+	33, 28, 28, 28, 28, 28, 20, 20, 19, 19,
+	39, 39, 40, 40, 41, 41, 41, 37, 37, 38,
+	38, 38, 38, 38, 38, 38, 38, 38, 38, 38,
+	38, 26, 26, 26, 26, 26, 26, 26, 26, 26,
+	26, 26, 26, 26, 26, 26, 26, 26, 26, 26,
+	26, 26, 26, 26, 26, 27, 27, 27, 25, 21,
+	21, 22, 22, 22, 22, 22, 24, 24, 23, 23,
+	23, 23, 23, 23, 23, 34, 34, 34, 35, 35,
+}
+
+var yyR2 = [...]int8{
+	0, 1, 2, 7, 0, 2, 2, 2, 2, 2,
+	3, 3, 3, 4, 3, 3, 4, 2, 3, 3,
+	4, 2, 3, 3, 4, 2, 3, 3, 4, 2,
+	3, 3, 4, 2, 4, 1, 2, 2, 2, 4,
+	4, 2, 2, 0, 2, 2, 2, 2, 2, 2,
+	2, 3, 3, 4, 2, 2, 4, 2, 2, 1,
+	3, 1, 3, 3, 3, 3, 3, 3, 3, 3,
+	3, 4, 4, 5, 1, 5, 0, 3, 1, 1,
+	1, 1, 3, 5, 5, 3, 3, 3, 3, 4,
+	0, 2, 1, 3, 1, 2, 2, 1, 3, 1,
+	3, 4, 4, 6, 4, 6, 6, 4, 6, 5,
+	7, 1, 1, 1, 1, 3, 3, 3, 3, 3,
+	3, 3, 3, 4, 4, 4, 4, 4, 4, 4,
+	4, 3, 3, 3, 3, 3, 4, 5, 3, 1,
+	3, 3, 5, 6, 2, 3, 1, 3, 1, 1,
+	1, 1, 1, 1, 1, 1, 3, 3, 3, 4,
+}
+
+var yyChk = [...]int16{
+	-1000, -42, -1, 43, 45, -2, -5, -13, -14, 17,
+	21, 22, -1, -9, 46, 24, -3, -4, 54, -10,
+	-11, -12, -13, -19, -7, -17, 19, 20, 63, 64,
+	66, 67, 23, -6, -15, -16, 44, 48, 49, 24,
+	-19, 24, -19, -10, -28, -20, 14, -28, -20, -8,
+	-5, 6, 24, 54, 24, 54, -2, 55, -5, 24,
+	-19, 24, 24, -19, 24, -19, -19, -17, -6, -19,
+	-29, 11, 68, -30, -31, 10, 5, -36, 4, -36,
+	-36, -36, -36, -37, 50, -38, 5, 69, 70, 10,
+	-18, -18, -5, -37, 5, 24, 24, 24, -19, 18,
+	-26, 27, 33, 31, 30, 32, 35, 34, -27, 4,
+	47, -10, -11, -12, -2, 55, -2, 24, 24, 24,
+	-19, 27, -29, -29, 11, 28, 71, 72, 73, 74,
+	75, 59, 56, 57, 58, 14, 27, 65, -39, 27,
+	51, -37, 29, 25, 14, 25, 14, 14, -15, -16,
+	-5, -6, 18, 29, 24, -29, -20, -28, -27, 4,
+	16, 13, -27, 4, 16, 13, 15, 15, 16, -5,
+	-2, -30, -29, -23, 8, 6, 7, 9, 62, 12,
+	-34, -35, 10, -23, -23, -23, -23, -23, -23, -23,
+	48, 48, 5, 4, 6, -38, -40, -41, 5, -39,
+	4, 5, 5, 5, 5, 5, -29, 4, 27, -26,
+	37, 36, 37, 36, 13, 4, 37, 36, 37, 36,
+	37, 36, 13, 4, 37, 36, 4, -19, 60, 61,
+	14, -23, -23, -32, 27, 52, 53, 26, 15, 26,
+	15, -32, -28, -28, 37, 36, 37, 36, 37, 36,
+	37, 36, -25, 25, 24, -35, -35, 15, 8, 15,
+	27, -41, 29, 29, 29, 29, 15, 9, -21, -22,
+	5, 15, -33, 5, 8, 6, 4, 4, 4, 4,
+	29, 26, 27, 16, 38, 39, 40, 4, -22, -23,
+	41, 38, 40, -24, -23, 41, 42, 27, -24, -23,
+	42,
+}
+
+var yyDef = [...]int16{
+	0, -2, 1, 0, 4, 0, 0, 0, 0, 0,
+	0, 0, 2, 0, 0, 9, 0, 0, 0, 0,
+	0, 0, 0, 25, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 35, 43, 43, 0, 0, 0, 17,
+	0, 21, 0, 0, 33, 81, 0, 48, 49, 0,
+	0, 5, 10, 0, 11, 0, 29, 0, 0, 12,
+	0, 14, 15, 0, 19, 0, 26, 0, 36, 27,
+	50, 0, 0, 61, 0, 0, 74, 54, 59, 55,
+	0, 57, 58, 90, 0, 97, 99, 0, 0, 0,
+	41, 42, 37, 38, 0, 18, 22, 23, 0, 0,
+	0, 0, 111, 112, 113, 114, 0, 0, 0, 0,
+	0, 6, 7, 8, 30, 0, 31, 13, 16, 20,
+	28, 0, 51, 52, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 88, 0,
+	0, 90, 0, 0, 0, 0, 0, 0, 44, 45,
+	46, 47, 0, 0, 24, 34, 82, 85, 0, 0,
+	0, 0, 0, 0, 0, 0, 86, 87, 0, 0,
+	32, 62, 53, 63, 148, 149, 150, 151, 152, 153,
+	154, 155, 0, 64, 65, 66, 67, 68, 69, 70,
+	0, 0, 76, 60, 56, 98, 91, 92, 94, 89,
+	100, 0, 0, 0, 0, 76, 39, 40, 0, 0,
+	115, 117, 119, 121, 0, 0, 131, 133, 116, 118,
+	120, 122, 0, 0, 132, 134, 135, 0, 0, 0,
+	0, 71, 72, 0, 0, 95, 96, 101, 104, 102,
+	107, 0, 83, 84, 127, 129, 123, 125, 128, 130,
+	124, 126, 136, 0, 3, 156, 157, 158, 0, -2,
+	0, 93, 0, 0, 0, 0, 109, 137, 0, 139,
+	0, 159, 77, 78, 79, 80, 103, 105, 106, 108,
+	0, 138, 0, 0, 0, 0, 144, 110, 140, 141,
+	0, 0, 145, 0, 146, 0, 142, 0, 0, 147,
+	143,
+}
+
+var yyTok1 = [...]int8{
+	1,
+}
 
-var yyDebug = 0
+var yyTok2 = [...]int8{
+	2, 3, 4, 5, 6, 7, 8, 9, 10, 11,
+	12, 13, 14, 15, 16, 17, 18, 19, 20, 21,
+	22, 23, 24, 25, 26, 27, 28, 29, 30, 31,
+	32, 33, 34, 35, 36, 37, 38, 39, 40, 41,
+	42, 43, 44, 45, 46, 47, 48, 49, 50, 51,
+	52, 53, 54, 55, 56, 57, 58, 59, 60, 61,
+	62, 63, 64, 65, 66, 67, 68, 69, 70, 71,
+	72, 73, 74, 75,
+}
+
+var yyTok3 = [...]int8{
+	0,
+}
+
+var yyErrorMessages = [...]struct {
+	state int
+	token int
+	msg   string
+}{}
+
+//line yaccpar:1
+
+/*	parser for yacc output	*/
+
+var (
+	yyDebug        = 0
+	yyErrorVerbose = false
+)
 
 type yyLexer interface {
 	Lex(lval *yySymType) int
 	Error(s string)
 }
 
-type yyLexerEx interface {
-	yyLexer
-	Reduced(rule, state int, lval *yySymType) bool
+type yyParser interface {
+	Parse(yyLexer) int
+	Lookahead() int
 }
 
-func yySymName(c int) (s string) {
-	x, ok := yyXLAT[c]
-	if ok {
-		return yySymNames[x]
+type yyParserImpl struct {
+	lval  yySymType
+	stack [yyInitialStackSize]yySymType
+	char  int
+}
+
+func (p *yyParserImpl) Lookahead() int {
+	return p.char
+}
+
+func yyNewParser() yyParser {
+	return &yyParserImpl{}
+}
+
+const yyFlag = -1000
+
+func yyTokname(c int) string {
+	if c >= 1 && c-1 < len(yyToknames) {
+		if yyToknames[c-1] != "" {
+			return yyToknames[c-1]
+		}
+	}
+	return __yyfmt__.Sprintf("tok-%v", c)
+}
+
+func yyStatname(s int) string {
+	if s >= 0 && s < len(yyStatenames) {
+		if yyStatenames[s] != "" {
+			return yyStatenames[s]
+		}
+	}
+	return __yyfmt__.Sprintf("state-%v", s)
+}
+
+func yyErrorMessage(state, lookAhead int) string {
+	const TOKSTART = 4
+
+	if !yyErrorVerbose {
+		return "syntax error"
 	}
 
-	if c < 0x7f {
-		return __yyfmt__.Sprintf("%q", c)
+	for _, e := range yyErrorMessages {
+		if e.state == state && e.token == lookAhead {
+			return "syntax error: " + e.msg
+		}
 	}
 
-	return __yyfmt__.Sprintf("%d", c)
+	res := "syntax error: unexpected " + yyTokname(lookAhead)
+
+	// To match Bison, suggest at most four expected tokens.
+	expected := make([]int, 0, 4)
+
+	// Look for shiftable tokens.
+	base := int(yyPact[state])
+	for tok := TOKSTART; tok-1 < len(yyToknames); tok++ {
+		if n := base + tok; n >= 0 && n < yyLast && int(yyChk[int(yyAct[n])]) == tok {
+			if len(expected) == cap(expected) {
+				return res
+			}
+			expected = append(expected, tok)
+		}
+	}
+
+	if yyDef[state] == -2 {
+		i := 0
+		for yyExca[i] != -1 || int(yyExca[i+1]) != state {
+			i += 2
+		}
+
+		// Look for tokens that we accept or reduce.
+		for i += 2; yyExca[i] >= 0; i += 2 {
+			tok := int(yyExca[i])
+			if tok < TOKSTART || yyExca[i+1] == 0 {
+				continue
+			}
+			if len(expected) == cap(expected) {
+				return res
+			}
+			expected = append(expected, tok)
+		}
+
+		// If the default action is to accept or reduce, give up.
+		if yyExca[i+1] != 0 {
+			return res
+		}
+	}
+
+	for i, tok := range expected {
+		if i == 0 {
+			res += ", expecting "
+		} else {
+			res += " or "
+		}
+		res += yyTokname(tok)
+	}
+	return res
 }
 
-func yylex1(yylex yyLexer, lval *yySymType) (n int) {
-	n = yylex.Lex(lval)
-	if n <= 0 {
-		n = yyEofCode
+func yylex1(lex yyLexer, lval *yySymType) (char, token int) {
+	token = 0
+	char = lex.Lex(lval)
+	if char <= 0 {
+		token = int(yyTok1[0])
+		goto out
+	}
+	if char < len(yyTok1) {
+		token = int(yyTok1[char])
+		goto out
+	}
+	if char >= yyPrivate {
+		if char < yyPrivate+len(yyTok2) {
+			token = int(yyTok2[char-yyPrivate])
+			goto out
+		}
+	}
+	for i := 0; i < len(yyTok3); i += 2 {
+		token = int(yyTok3[i+0])
+		if token == char {
+			token = int(yyTok3[i+1])
+			goto out
+		}
+	}
+
+out:
+	if token == 0 {
+		token = int(yyTok2[1]) /* unknown char */
 	}
 	if yyDebug >= 3 {
-		__yyfmt__.Printf("\nlex %s(%#x %d), lval: %+v\n", yySymName(n), n, n, lval)
+		__yyfmt__.Printf("lex %s(%d)\n", yyTokname(token), uint(char))
 	}
-	return n
+	return char, token
 }
 
 func yyParse(yylex yyLexer) int {
-	const yyError = 57
+	return yyNewParser().Parse(yylex)
+}
 
-	yyEx, _ := yylex.(yyLexerEx)
+func (yyrcvr *yyParserImpl) Parse(yylex yyLexer) int {
 	var yyn int
-	var yylval yySymType
 	var yyVAL yySymType
-	yyS := make([]yySymType, 200)
+	var yyDollar []yySymType
+	_ = yyDollar // silence set and not used
+	yyS := yyrcvr.stack[:]
 
 	Nerrs := 0   /* number of errors */
 	Errflag := 0 /* error recovery flag */
-	yyerrok := func() {
-		if yyDebug >= 2 {
-			__yyfmt__.Printf("yyerrok()\n")
-		}
-		Errflag = 0
-	}
-	_ = yyerrok
 	yystate := 0
-	yychar := -1
-	var yyxchar int
-	var yyshift int
+	yyrcvr.char = -1
+	yytoken := -1 // yyrcvr.char translated into internal numbering
+	defer func() {
+		// Make sure we report no lookahead when not parsing.
+		yystate = -1
+		yyrcvr.char = -1
+		yytoken = -1
+	}()
 	yyp := -1
 	goto yystack
 
@@ -495,6 +634,10 @@ ret1:
 
 yystack:
 	/* put a state and value onto the stack */
+	if yyDebug >= 4 {
+		__yyfmt__.Printf("char %v in %v\n", yyTokname(yytoken), yyStatname(yystate))
+	}
+
 	yyp++
 	if yyp >= len(yyS) {
 		nyys := make([]yySymType, len(yyS)*2)
@@ -505,85 +648,66 @@ yystack:
 	yyS[yyp].yys = yystate
 
 yynewstate:
-	if yychar < 0 {
-		yylval.yys = yystate
-		yychar = yylex1(yylex, &yylval)
-		var ok bool
-		if yyxchar, ok = yyXLAT[yychar]; !ok {
-			yyxchar = len(yySymNames) // > tab width
-		}
+	yyn = int(yyPact[yystate])
+	if yyn <= yyFlag {
+		goto yydefault /* simple state */
 	}
-	if yyDebug >= 4 {
-		var a []int
-		for _, v := range yyS[:yyp+1] {
-			a = append(a, v.yys)
-		}
-		__yyfmt__.Printf("state stack %v\n", a)
+	if yyrcvr.char < 0 {
+		yyrcvr.char, yytoken = yylex1(yylex, &yyrcvr.lval)
 	}
-	row := yyParseTab[yystate]
-	yyn = 0
-	if yyxchar < len(row) {
-		if yyn = int(row[yyxchar]); yyn != 0 {
-			yyn += yyTabOfs
-		}
+	yyn += yytoken
+	if yyn < 0 || yyn >= yyLast {
+		goto yydefault
 	}
-	switch {
-	case yyn > 0: // shift
-		yychar = -1
-		yyVAL = yylval
+	yyn = int(yyAct[yyn])
+	if int(yyChk[yyn]) == yytoken { /* valid shift */
+		yyrcvr.char = -1
+		yytoken = -1
+		yyVAL = yyrcvr.lval
 		yystate = yyn
-		yyshift = yyn
-		if yyDebug >= 2 {
-			__yyfmt__.Printf("shift, and goto state %d\n", yystate)
-		}
 		if Errflag > 0 {
 			Errflag--
 		}
 		goto yystack
-	case yyn < 0: // reduce
-	case yystate == 1: // accept
-		if yyDebug >= 2 {
-			__yyfmt__.Println("accept")
-		}
-		goto ret0
 	}
 
+yydefault:
+	/* default state action */
+	yyn = int(yyDef[yystate])
+	if yyn == -2 {
+		if yyrcvr.char < 0 {
+			yyrcvr.char, yytoken = yylex1(yylex, &yyrcvr.lval)
+		}
+
+		/* look through exception table */
+		xi := 0
+		for {
+			if yyExca[xi+0] == -1 && int(yyExca[xi+1]) == yystate {
+				break
+			}
+			xi += 2
+		}
+		for xi += 2; ; xi += 2 {
+			yyn = int(yyExca[xi+0])
+			if yyn < 0 || yyn == yytoken {
+				break
+			}
+		}
+		yyn = int(yyExca[xi+1])
+		if yyn < 0 {
+			goto ret0
+		}
+	}
 	if yyn == 0 {
 		/* error ... attempt to resume parsing */
 		switch Errflag {
 		case 0: /* brand new error */
+			yylex.Error(yyErrorMessage(yystate, yytoken))
+			Nerrs++
 			if yyDebug >= 1 {
-				__yyfmt__.Printf("no action for %s in state %d\n", yySymName(yychar), yystate)
+				__yyfmt__.Printf("%s", yyStatname(yystate))
+				__yyfmt__.Printf(" saw %s\n", yyTokname(yytoken))
 			}
-			msg, ok := yyXErrors[yyXError{yystate, yyxchar}]
-			if !ok {
-				msg, ok = yyXErrors[yyXError{yystate, -1}]
-			}
-			if !ok && yyshift != 0 {
-				msg, ok = yyXErrors[yyXError{yyshift, yyxchar}]
-			}
-			if !ok {
-				msg, ok = yyXErrors[yyXError{yyshift, -1}]
-			}
-			if yychar > 0 {
-				ls := yyTokenLiteralStrings[yychar]
-				if ls == "" {
-					ls = yySymName(yychar)
-				}
-				if ls != "" {
-					switch {
-					case msg == "":
-						msg = __yyfmt__.Sprintf("unexpected %s", ls)
-					default:
-						msg = __yyfmt__.Sprintf("unexpected %s, %s", ls, msg)
-					}
-				}
-			}
-			if msg == "" {
-				msg = "syntax error"
-			}
-			yylex.Error(msg)
-			Nerrs++
 			fallthrough
 
 		case 1, 2: /* incompletely recovered error ... try again */
@@ -591,14 +715,10 @@ yynewstate:
 
 			/* find a state where "error" is a legal shift action */
 			for yyp >= 0 {
-				row := yyParseTab[yyS[yyp].yys]
-				if yyError < len(row) {
-					yyn = int(row[yyError]) + yyTabOfs
-					if yyn > 0 { // hit
-						if yyDebug >= 2 {
-							__yyfmt__.Printf("error recovery found error shift in state %d\n", yyS[yyp].yys)
-						}
-						yystate = yyn /* simulate a shift of "error" */
+				yyn = int(yyPact[yyS[yyp].yys]) + yyErrCode
+				if yyn >= 0 && yyn < yyLast {
+					yystate = int(yyAct[yyn]) /* simulate a shift of "error" */
+					if int(yyChk[yystate]) == yyErrCode {
 						goto yystack
 					}
 				}
@@ -610,31 +730,33 @@ yynewstate:
 				yyp--
 			}
 			/* there is no state on the stack with an error shift ... abort */
-			if yyDebug >= 2 {
-				__yyfmt__.Printf("error recovery failed\n")
-			}
 			goto ret1
 
 		case 3: /* no shift yet; clobber input char */
 			if yyDebug >= 2 {
-				__yyfmt__.Printf("error recovery discards %s\n", yySymName(yychar))
+				__yyfmt__.Printf("error recovery discards %s\n", yyTokname(yytoken))
 			}
-			if yychar == yyEofCode {
+			if yytoken == yyEofCode {
 				goto ret1
 			}
-
-			yychar = -1
+			yyrcvr.char = -1
+			yytoken = -1
 			goto yynewstate /* try again in the same state */
 		}
 	}
 
-	r := -yyn
-	x0 := yyReductions[r]
-	x, n := x0.xsym, x0.components
+	/* reduction by production yyn */
+	if yyDebug >= 2 {
+		__yyfmt__.Printf("reduce %v in:\n\t%v\n", yyn, yyStatname(yystate))
+	}
+
+	yynt := yyn
 	yypt := yyp
 	_ = yypt // guard against "declared and not used"
 
-	yyp -= n
+	yyp -= int(yyR2[yyn])
+	// yyp is now the index of $0. Perform the default action. Iff the
+	// reduced production is ε, $1 is possibly out of range.
 	if yyp+1 >= len(yyS) {
 		nyys := make([]yySymType, len(yyS)*2)
 		copy(nyys, yyS)
@@ -643,281 +765,1026 @@ yynewstate:
 	yyVAL = yyS[yyp+1]
 
 	/* consult goto table to find next state */
-	exState := yystate
-	yystate = int(yyParseTab[yyS[yyp].yys][x]) + yyTabOfs
-	/* reduction by production r */
-	if yyDebug >= 2 {
-		__yyfmt__.Printf("reduce using rule %v (%s), and goto state %d\n", r, yySymNames[x], yystate)
-	}
+	yyn = int(yyR1[yyn])
+	yyg := int(yyPgo[yyn])
+	yyj := yyg + yyS[yyp].yys + 1
 
-	switch r {
-	case 1:
-		{
-			result = &Expression{Clauses: []Clause{yyS[yypt-2].matchClause, yyS[yypt-1].returnClause}}
+	if yyj >= yyLast {
+		yystate = int(yyAct[yyg])
+	} else {
+		yystate = int(yyAct[yyj])
+		if int(yyChk[yystate]) != -yyn {
+			yystate = int(yyAct[yyg])
 		}
+	}
+	// dummy call; replaced with literal code
+	switch yynt {
+
 	case 2:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line grammar/cyphernetes.y:129
 		{
-			result = &Expression{Clauses: []Clause{yyS[yypt-2].matchClause, yyS[yypt-1].setClause}}
+			result.Explain = true
 		}
 	case 3:
+		yyDollar = yyS[yypt-7 : yypt+1]
+//line grammar/cyphernetes.y:132
 		{
-			result = &Expression{Clauses: []Clause{yyS[yypt-3].matchClause, yyS[yypt-2].setClause, yyS[yypt-1].returnClause}}
+			result = &Expression{Clauses: yyDollar[3].clauses, Apply: &Apply{BatchSize: yyDollar[2].intVal, While: &Expression{Clauses: []Clause{yyDollar[5].matchClause, yyDollar[6].returnClause}}}}
 		}
 	case 4:
+		yyDollar = yyS[yypt-0 : yypt+1]
+//line grammar/cyphernetes.y:138
 		{
-			result = &Expression{Clauses: []Clause{yyS[yypt-2].matchClause, yyS[yypt-1].deleteClause}}
+			yyVAL.intVal = 1
 		}
 	case 5:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line grammar/cyphernetes.y:141
 		{
-			result = &Expression{Clauses: []Clause{yyS[yypt-1].createClause}}
+			yyVAL.intVal, _ = strconv.Atoi(yyDollar[2].strVal)
 		}
 	case 6:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line grammar/cyphernetes.y:147
 		{
-			result = &Expression{Clauses: []Clause{yyS[yypt-2].createClause, yyS[yypt-1].returnClause}}
+			yyVAL.clauses = []Clause{yyDollar[1].matchClause, yyDollar[2].setClause}
 		}
 	case 7:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line grammar/cyphernetes.y:150
 		{
-			result = &Expression{Clauses: []Clause{yyS[yypt-2].matchClause, yyS[yypt-1].createClause}}
+			yyVAL.clauses = []Clause{yyDollar[1].matchClause, yyDollar[2].deleteClause}
 		}
 	case 8:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line grammar/cyphernetes.y:153
 		{
-			result = &Expression{Clauses: []Clause{yyS[yypt-3].matchClause, yyS[yypt-2].createClause, yyS[yypt-1].returnClause}}
+			yyVAL.clauses = []Clause{yyDollar[1].matchClause, yyDollar[2].operationClause}
 		}
 	case 9:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line grammar/cyphernetes.y:159
 		{
-			yyVAL.matchClause = &MatchClause{Nodes: yyS[yypt-0].nodeRelationshipList.Nodes, Relationships: yyS[yypt-0].nodeRelationshipList.Relationships, ExtraFilters: nil}
+			result = yyDollar[1].expression
 		}
 	case 10:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:162
 		{
-			yyVAL.matchClause = &MatchClause{Nodes: yyS[yypt-2].nodeRelationshipList.Nodes, Relationships: yyS[yypt-2].nodeRelationshipList.Relationships, ExtraFilters: yyS[yypt-0].keyValuePairs}
+			yyDollar[1].expression.Union = yyDollar[2].union
+			result = yyDollar[1].expression
 		}
 	case 11:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:166
 		{
-			yyVAL.createClause = &CreateClause{Nodes: yyS[yypt-0].nodeRelationshipList.Nodes, Relationships: yyS[yypt-0].nodeRelationshipList.Relationships}
+			yyDollar[1].expression.Union = yyDollar[2].union
+			result = yyDollar[1].expression
 		}
 	case 12:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:170
 		{
-			yyVAL.setClause = &SetClause{KeyValuePairs: yyS[yypt-0].keyValuePairs}
+			result = &Expression{Clauses: []Clause{yyDollar[1].matchClause, yyDollar[2].setClause}}
 		}
 	case 13:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line grammar/cyphernetes.y:173
 		{
-			yyVAL.deleteClause = &DeleteClause{NodeIds: yyS[yypt-0].nodeIds}
+			result = &Expression{Clauses: []Clause{yyDollar[1].matchClause, yyDollar[2].setClause, yyDollar[3].returnClause}}
 		}
 	case 14:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:176
 		{
-			yyVAL.nodeIds = []string{yyS[yypt-0].strVal}
+			result = &Expression{Clauses: []Clause{yyDollar[1].matchClause, yyDollar[2].deleteClause}}
 		}
 	case 15:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:179
 		{
-			yyVAL.nodeIds = append(yyS[yypt-2].nodeIds, yyS[yypt-0].strVal)
+			result = &Expression{Clauses: []Clause{yyDollar[1].matchClause, yyDollar[2].operationClause}}
 		}
 	case 16:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line grammar/cyphernetes.y:182
 		{
-			yyVAL.keyValuePairs = []*KeyValuePair{yyS[yypt-0].keyValuePair} // Start with one Property element
+			result = &Expression{Clauses: []Clause{yyDollar[1].matchClause, yyDollar[2].operationClause, yyDollar[3].returnClause}}
 		}
 	case 17:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line grammar/cyphernetes.y:185
 		{
-			yyVAL.keyValuePairs = append(yyS[yypt-2].keyValuePairs, yyS[yypt-0].keyValuePair) // $1 and $3 are the left and right operands of COMMA
+			result = &Expression{Clauses: []Clause{yyDollar[1].createClause}}
 		}
 	case 18:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:188
 		{
-			yyVAL.keyValuePair = &KeyValuePair{Key: yyS[yypt-2].strVal, Value: yyS[yypt-0].value, Operator: "EQUALS"} // ==
+			result = &Expression{Clauses: []Clause{yyDollar[1].createClause, yyDollar[2].returnClause}}
 		}
 	case 19:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:191
 		{
-			yyVAL.keyValuePair = &KeyValuePair{Key: yyS[yypt-2].strVal, Value: yyS[yypt-0].value, Operator: "NOT_EQUALS"} // !=
+			result = &Expression{Clauses: []Clause{yyDollar[1].matchClause, yyDollar[2].createClause}}
 		}
 	case 20:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line grammar/cyphernetes.y:194
 		{
-			yyVAL.keyValuePair = &KeyValuePair{Key: yyS[yypt-2].strVal, Value: yyS[yypt-0].value, Operator: "GREATER_THAN"} // >
+			result = &Expression{Clauses: []Clause{yyDollar[1].matchClause, yyDollar[2].createClause, yyDollar[3].returnClause}}
 		}
 	case 21:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line grammar/cyphernetes.y:197
 		{
-			yyVAL.keyValuePair = &KeyValuePair{Key: yyS[yypt-2].strVal, Value: yyS[yypt-0].value, Operator: "LESS_THAN"} // <
+			result = &Expression{Clauses: []Clause{yyDollar[1].mergeClause}}
 		}
 	case 22:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:200
 		{
-			yyVAL.keyValuePair = &KeyValuePair{Key: yyS[yypt-2].strVal, Value: yyS[yypt-0].value, Operator: "GREATER_THAN_EQUALS"} // >=
+			result = &Expression{Clauses: []Clause{yyDollar[1].mergeClause, yyDollar[2].returnClause}}
 		}
 	case 23:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:203
 		{
-			yyVAL.keyValuePair = &KeyValuePair{Key: yyS[yypt-2].strVal, Value: yyS[yypt-0].value, Operator: "LESS_THAN_EQUALS"} // <=
+			result = &Expression{Clauses: []Clause{yyDollar[1].mergeClause, yyDollar[2].setClause}}
 		}
 	case 24:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line grammar/cyphernetes.y:206
 		{
-			yyVAL.nodeRelationshipList = &NodeRelationshipList{
-				Nodes:         []*NodePattern{yyS[yypt-0].nodePattern},
-				Relationships: []*Relationship{},
-			}
+			result = &Expression{Clauses: []Clause{yyDollar[1].mergeClause, yyDollar[2].setClause, yyDollar[3].returnClause}}
 		}
 	case 25:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line grammar/cyphernetes.y:213
 		{
-			yyS[yypt-1].relationship.LeftNode = yyS[yypt-2].nodePattern
-			yyS[yypt-1].relationship.RightNode = yyS[yypt-0].nodePattern
-			yyVAL.nodeRelationshipList = &NodeRelationshipList{
-				Nodes:         []*NodePattern{yyS[yypt-2].nodePattern, yyS[yypt-0].nodePattern},
-				Relationships: []*Relationship{yyS[yypt-1].relationship},
-			}
+			yyVAL.expression = &Expression{Clauses: []Clause{yyDollar[1].matchClause, yyDollar[2].returnClause}}
 		}
 	case 26:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:216
 		{
-			yyS[yypt-3].relationship.LeftNode = yyS[yypt-4].nodePattern
-			yyS[yypt-3].relationship.RightNode = yyS[yypt-2].nodePattern
-			yyVAL.nodeRelationshipList = &NodeRelationshipList{
-				Nodes:         append([]*NodePattern{yyS[yypt-4].nodePattern, yyS[yypt-2].nodePattern}, yyS[yypt-0].nodeRelationshipList.Nodes...),
-				Relationships: append([]*Relationship{yyS[yypt-3].relationship}, yyS[yypt-0].nodeRelationshipList.Relationships...),
-			}
+			yyVAL.expression = &Expression{Clauses: append(append([]Clause{yyDollar[1].matchClause}, yyDollar[2].clauses...), yyDollar[3].returnClause)}
 		}
 	case 27:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:219
 		{
-			yyS[yypt-3].relationship.LeftNode = yyS[yypt-4].nodePattern
-			yyS[yypt-3].relationship.RightNode = yyS[yypt-2].nodePattern
-			yyS[yypt-1].relationship.LeftNode = yyS[yypt-2].nodePattern
-			yyS[yypt-1].relationship.RightNode = yyS[yypt-0].nodeRelationshipList.Nodes[0]
-			yyVAL.nodeRelationshipList = &NodeRelationshipList{
-				Nodes:         append([]*NodePattern{yyS[yypt-4].nodePattern, yyS[yypt-2].nodePattern}, yyS[yypt-0].nodeRelationshipList.Nodes...),
-				Relationships: append([]*Relationship{yyS[yypt-3].relationship, yyS[yypt-1].relationship}, yyS[yypt-0].nodeRelationshipList.Relationships...),
-			}
+			yyVAL.expression = &Expression{Clauses: append(append([]Clause{yyDollar[1].matchClause}, yyDollar[2].clauses...), yyDollar[3].returnClause)}
 		}
 	case 28:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line grammar/cyphernetes.y:222
 		{
-			yyVAL.nodeRelationshipList = &NodeRelationshipList{
-				Nodes:         append([]*NodePattern{yyS[yypt-2].nodePattern}, yyS[yypt-0].nodeRelationshipList.Nodes...),
-				Relationships: yyS[yypt-0].nodeRelationshipList.Relationships,
-			}
+			yyVAL.expression = &Expression{Clauses: append(append(append([]Clause{yyDollar[1].matchClause}, yyDollar[2].clauses...), yyDollar[3].clauses...), yyDollar[4].returnClause)}
 		}
 	case 29:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line grammar/cyphernetes.y:229
 		{
-			yyVAL.nodePattern = &NodePattern{ResourceProperties: yyS[yypt-1].resourceProperties}
+			yyVAL.union = &Union{Queries: []*Expression{yyDollar[2].expression}}
 		}
 	case 30:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:232
 		{
-			yyVAL.nodePattern = &NodePattern{&ResourceProperties{Name: yyS[yypt-1].strVal, Kind: "", Properties: nil, JsonData: ""}}
+			yyDollar[1].union.Queries = append(yyDollar[1].union.Queries, yyDollar[3].expression)
+			yyVAL.union = yyDollar[1].union
 		}
 	case 31:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:239
 		{
-			yyVAL.returnClause = &ReturnClause{Items: yyS[yypt-0].returnItems}
+			yyVAL.union = &Union{All: true, Queries: []*Expression{yyDollar[3].expression}}
 		}
 	case 32:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line grammar/cyphernetes.y:242
 		{
-			yyVAL.returnItems = []*ReturnItem{yyS[yypt-0].returnItem}
+			yyDollar[1].union.Queries = append(yyDollar[1].union.Queries, yyDollar[4].expression)
+			yyVAL.union = yyDollar[1].union
 		}
 	case 33:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line grammar/cyphernetes.y:249
 		{
-			yyVAL.returnItems = append(yyS[yypt-2].returnItems, yyS[yypt-0].returnItem)
+			yyVAL.matchClause = &MatchClause{Nodes: yyDollar[2].nodeRelationshipList.Nodes, Relationships: yyDollar[2].nodeRelationshipList.Relationships, ExtraFilters: nil}
 		}
 	case 34:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line grammar/cyphernetes.y:252
 		{
-			yyVAL.returnItem = &ReturnItem{JsonPath: yyS[yypt-0].strVal}
+			yyVAL.matchClause = &MatchClause{Nodes: yyDollar[2].nodeRelationshipList.Nodes, Relationships: yyDollar[2].nodeRelationshipList.Relationships, ExtraFilters: yyDollar[4].keyValuePairs}
 		}
 	case 35:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line grammar/cyphernetes.y:258
 		{
-			yyVAL.returnItem = &ReturnItem{JsonPath: yyS[yypt-2].strVal, Alias: yyS[yypt-0].strVal}
+			yyVAL.clauses = []Clause{yyDollar[1].matchClause}
 		}
 	case 36:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line grammar/cyphernetes.y:261
 		{
-			yyVAL.returnItem = &ReturnItem{Aggregate: "COUNT", JsonPath: yyS[yypt-1].strVal}
+			yyVAL.clauses = append(yyDollar[1].clauses, yyDollar[2].matchClause)
 		}
 	case 37:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line grammar/cyphernetes.y:267
 		{
-			yyVAL.returnItem = &ReturnItem{Aggregate: "SUM", JsonPath: yyS[yypt-1].strVal}
+			yyDollar[2].matchClause.Optional = true
+			yyVAL.matchClause = yyDollar[2].matchClause
 		}
 	case 38:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line grammar/cyphernetes.y:274
 		{
-			yyVAL.returnItem = &ReturnItem{Aggregate: "COUNT", JsonPath: yyS[yypt-3].strVal, Alias: yyS[yypt-0].strVal}
+			yyVAL.withClause = &WithClause{Items: yyDollar[2].returnItems}
 		}
 	case 39:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line grammar/cyphernetes.y:277
 		{
-			yyVAL.returnItem = &ReturnItem{Aggregate: "SUM", JsonPath: yyS[yypt-3].strVal, Alias: yyS[yypt-0].strVal}
+			yyVAL.withClause = &WithClause{Items: yyDollar[2].returnItems, ExtraFilters: yyDollar[4].keyValuePairs}
 		}
 	case 40:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line grammar/cyphernetes.y:283
 		{
-			yyVAL.relationship = &Relationship{ResourceProperties: nil, Direction: None, LeftNode: nil, RightNode: nil}
+			yyVAL.unwindClause = &UnwindClause{JsonPath: yyDollar[2].strVal, Alias: yyDollar[4].strVal}
 		}
 	case 41:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line grammar/cyphernetes.y:290
 		{
-			yyVAL.relationship = &Relationship{ResourceProperties: nil, Direction: Left, LeftNode: nil, RightNode: nil}
+			yyVAL.clauses = append([]Clause{yyDollar[1].withClause}, yyDollar[2].clauses...)
 		}
 	case 42:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line grammar/cyphernetes.y:293
 		{
-			yyVAL.relationship = &Relationship{ResourceProperties: nil, Direction: Right, LeftNode: nil, RightNode: nil}
+			yyVAL.clauses = append([]Clause{yyDollar[1].unwindClause}, yyDollar[2].clauses...)
 		}
 	case 43:
+		yyDollar = yyS[yypt-0 : yypt+1]
+//line grammar/cyphernetes.y:299
 		{
-			yyVAL.relationship = &Relationship{ResourceProperties: nil, Direction: Both, LeftNode: nil, RightNode: nil}
+			yyVAL.clauses = []Clause{}
 		}
 	case 44:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line grammar/cyphernetes.y:302
 		{
-			yyVAL.relationship = &Relationship{ResourceProperties: yyS[yypt-1].resourceProperties, Direction: None, LeftNode: nil, RightNode: nil}
+			yyVAL.clauses = append(yyDollar[1].clauses, yyDollar[2].withClause)
 		}
 	case 45:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line grammar/cyphernetes.y:305
 		{
-			yyVAL.relationship = &Relationship{ResourceProperties: yyS[yypt-1].resourceProperties, Direction: Left, LeftNode: nil, RightNode: nil}
+			yyVAL.clauses = append(yyDollar[1].clauses, yyDollar[2].unwindClause)
 		}
 	case 46:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line grammar/cyphernetes.y:308
 		{
-			yyVAL.relationship = &Relationship{ResourceProperties: yyS[yypt-1].resourceProperties, Direction: Right, LeftNode: nil, RightNode: nil}
+			yyVAL.clauses = append(yyDollar[1].clauses, yyDollar[2].matchClause)
 		}
 	case 47:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line grammar/cyphernetes.y:311
 		{
-			yyVAL.relationship = &Relationship{ResourceProperties: yyS[yypt-1].resourceProperties, Direction: Both, LeftNode: nil, RightNode: nil}
+			yyVAL.clauses = append(yyDollar[1].clauses, yyDollar[2].matchClause)
 		}
 	case 48:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line grammar/cyphernetes.y:317
 		{
-			yyVAL.resourceProperties = &ResourceProperties{Name: yyS[yypt-2].strVal, Kind: yyS[yypt-0].strVal, Properties: nil, JsonData: ""}
+			yyVAL.createClause = &CreateClause{Nodes: yyDollar[2].nodeRelationshipList.Nodes, Relationships: yyDollar[2].nodeRelationshipList.Relationships}
 		}
 	case 49:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line grammar/cyphernetes.y:323
 		{
-			yyVAL.resourceProperties = &ResourceProperties{Name: yyS[yypt-3].strVal, Kind: yyS[yypt-1].strVal, Properties: yyS[yypt-0].properties, JsonData: ""}
+			yyVAL.mergeClause = &MergeClause{Node: yyDollar[2].nodePattern}
 		}
 	case 50:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line grammar/cyphernetes.y:329
 		{
-			yyVAL.resourceProperties = &ResourceProperties{Name: yyS[yypt-4].strVal, Kind: yyS[yypt-2].strVal, Properties: nil, JsonData: yyS[yypt-0].strVal}
+			yyVAL.setClause = &SetClause{KeyValuePairs: yyDollar[2].keyValuePairs}
 		}
 	case 51:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:332
 		{
-			yyVAL.properties = &Properties{PropertyList: yyS[yypt-1].jsonPathValueList}
+			yyVAL.setClause = &SetClause{KeyValuePairs: yyDollar[3].keyValuePairs, PatchType: strings.ToLower(yyDollar[2].strVal)}
 		}
 	case 52:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:335
 		{
-			yyVAL.jsonPathValueList = []*Property{yyS[yypt-0].jsonPathValue} // Start with one Property element
+			yyVAL.setClause = &SetClause{KeyValuePairs: yyDollar[3].keyValuePairs, Status: true}
 		}
 	case 53:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line grammar/cyphernetes.y:338
 		{
-			yyVAL.jsonPathValueList = append(yyS[yypt-2].jsonPathValueList, yyS[yypt-0].jsonPathValue) // $1 and $3 are the left and right operands of COMMA
+			yyVAL.setClause = &SetClause{KeyValuePairs: yyDollar[4].keyValuePairs, PatchType: strings.ToLower(yyDollar[3].strVal), Status: true}
 		}
 	case 54:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line grammar/cyphernetes.y:344
 		{
-			yyVAL.jsonPathValue = &Property{Key: yyS[yypt-2].strVal, Value: yyS[yypt-0].value}
+			yyVAL.deleteClause = &DeleteClause{NodeIds: yyDollar[2].nodeIds}
 		}
 	case 55:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line grammar/cyphernetes.y:350
 		{
-			yyVAL.value = strings.Trim(yyS[yypt-0].strVal, "\"")
+			yyVAL.operationClause = &OperationClause{Operation: "restart", NodeIds: yyDollar[2].nodeIds}
 		}
 	case 56:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line grammar/cyphernetes.y:353
+		{
+			replicas, _ := strconv.Atoi(yyDollar[4].strVal)
+			yyVAL.operationClause = &OperationClause{Operation: "scale", NodeIds: yyDollar[2].nodeIds, Replicas: replicas}
+		}
+	case 57:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line grammar/cyphernetes.y:357
+		{
+			yyVAL.operationClause = &OperationClause{Operation: "pause", NodeIds: yyDollar[2].nodeIds}
+		}
+	case 58:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line grammar/cyphernetes.y:360
+		{
+			yyVAL.operationClause = &OperationClause{Operation: "resume", NodeIds: yyDollar[2].nodeIds}
+		}
+	case 59:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line grammar/cyphernetes.y:366
+		{
+			yyVAL.nodeIds = []string{yyDollar[1].strVal}
+		}
+	case 60:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:369
+		{
+			yyVAL.nodeIds = append(yyDollar[1].nodeIds, yyDollar[3].strVal)
+		}
+	case 61:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line grammar/cyphernetes.y:375
+		{
+			yyVAL.keyValuePairs = []*KeyValuePair{yyDollar[1].keyValuePair} // Start with one Property element
+		}
+	case 62:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:378
+		{
+			yyVAL.keyValuePairs = append(yyDollar[1].keyValuePairs, yyDollar[3].keyValuePair) // $1 and $3 are the left and right operands of COMMA
+		}
+	case 63:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:385
+		{
+			yyDollar[1].keyValuePair.Value, yyDollar[1].keyValuePair.Operator = yyDollar[3].value, "EQUALS" // ==
+			yyVAL.keyValuePair = yyDollar[1].keyValuePair
+		}
+	case 64:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:389
+		{
+			yyDollar[1].keyValuePair.Value, yyDollar[1].keyValuePair.Operator = yyDollar[3].value, "NOT_EQUALS" // !=
+			yyVAL.keyValuePair = yyDollar[1].keyValuePair
+		}
+	case 65:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:393
+		{
+			yyDollar[1].keyValuePair.Value, yyDollar[1].keyValuePair.Operator = yyDollar[3].value, "GREATER_THAN" // >
+			yyVAL.keyValuePair = yyDollar[1].keyValuePair
+		}
+	case 66:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:397
+		{
+			yyDollar[1].keyValuePair.Value, yyDollar[1].keyValuePair.Operator = yyDollar[3].value, "LESS_THAN" // <
+			yyVAL.keyValuePair = yyDollar[1].keyValuePair
+		}
+	case 67:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:401
+		{
+			yyDollar[1].keyValuePair.Value, yyDollar[1].keyValuePair.Operator = yyDollar[3].value, "GREATER_THAN_EQUALS" // >=
+			yyVAL.keyValuePair = yyDollar[1].keyValuePair
+		}
+	case 68:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:405
+		{
+			yyDollar[1].keyValuePair.Value, yyDollar[1].keyValuePair.Operator = yyDollar[3].value, "LESS_THAN_EQUALS" // <=
+			yyVAL.keyValuePair = yyDollar[1].keyValuePair
+		}
+	case 69:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:409
+		{
+			yyDollar[1].keyValuePair.Value, yyDollar[1].keyValuePair.Operator = yyDollar[3].value, "REGEX" // =~
+			yyVAL.keyValuePair = yyDollar[1].keyValuePair
+		}
+	case 70:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:413
+		{
+			yyDollar[1].keyValuePair.Value, yyDollar[1].keyValuePair.Operator = yyDollar[3].value, "CONTAINS"
+			yyVAL.keyValuePair = yyDollar[1].keyValuePair
+		}
+	case 71:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line grammar/cyphernetes.y:417
+		{
+			yyDollar[1].keyValuePair.Value, yyDollar[1].keyValuePair.Operator = yyDollar[4].value, "STARTS_WITH"
+			yyVAL.keyValuePair = yyDollar[1].keyValuePair
+		}
+	case 72:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line grammar/cyphernetes.y:421
+		{
+			yyDollar[1].keyValuePair.Value, yyDollar[1].keyValuePair.Operator = yyDollar[4].value, "ENDS_WITH"
+			yyVAL.keyValuePair = yyDollar[1].keyValuePair
+		}
+	case 73:
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line grammar/cyphernetes.y:425
+		{
+			// A function alone must be true, e.g. WHERE startsWith(p.metadata.name, "web")
+			yyVAL.keyValuePair = &KeyValuePair{Key: yyDollar[3].strVal, Function: strings.ToUpper(yyDollar[1].strVal), Args: yyDollar[4].functionArgs, Value: true, Operator: "EQUALS"}
+		}
+	case 74:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line grammar/cyphernetes.y:433
+		{
+			yyVAL.keyValuePair = &KeyValuePair{Key: yyDollar[1].strVal}
+		}
+	case 75:
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line grammar/cyphernetes.y:436
+		{
+			yyVAL.keyValuePair = &KeyValuePair{Key: yyDollar[3].strVal, Function: strings.ToUpper(yyDollar[1].strVal), Args: yyDollar[4].functionArgs}
+		}
+	case 76:
+		yyDollar = yyS[yypt-0 : yypt+1]
+//line grammar/cyphernetes.y:443
+		{
+			yyVAL.functionArgs = nil
+		}
+	case 77:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:446
+		{
+			yyVAL.functionArgs = append(yyDollar[1].functionArgs, yyDollar[3].functionArg)
+		}
+	case 78:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line grammar/cyphernetes.y:452
+		{
+			yyVAL.functionArg = &FunctionArg{JsonPath: yyDollar[1].strVal}
+		}
+	case 79:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line grammar/cyphernetes.y:455
+		{
+			yyVAL.functionArg = &FunctionArg{Value: unquote(yyDollar[1].strVal)}
+		}
+	case 80:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line grammar/cyphernetes.y:458
+		{
+			i, err := strconv.Atoi(yyDollar[1].strVal)
+			if err != nil {
+				yylex.Error(fmt.Sprintf("integer %s is out of range", yyDollar[1].strVal))
+				return 1
+			}
+			yyVAL.functionArg = &FunctionArg{Value: i}
+		}
+	case 81:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line grammar/cyphernetes.y:469
+		{
+			yyVAL.nodeRelationshipList = &NodeRelationshipList{
+				Nodes:         []*NodePattern{yyDollar[1].nodePattern},
+				Relationships: []*Relationship{},
+			}
+		}
+	case 82:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:475
+		{
+			yyDollar[2].relationship.LeftNode = yyDollar[1].nodePattern
+			yyDollar[2].relationship.RightNode = yyDollar[3].nodePattern
+			yyVAL.nodeRelationshipList = &NodeRelationshipList{
+				Nodes:         []*NodePattern{yyDollar[1].nodePattern, yyDollar[3].nodePattern},
+				Relationships: []*Relationship{yyDollar[2].relationship},
+			}
+		}
+	case 83:
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line grammar/cyphernetes.y:483
+		{
+			yyDollar[2].relationship.LeftNode = yyDollar[1].nodePattern
+			yyDollar[2].relationship.RightNode = yyDollar[3].nodePattern
+			yyVAL.nodeRelationshipList = &NodeRelationshipList{
+				Nodes:         append([]*NodePattern{yyDollar[1].nodePattern, yyDollar[3].nodePattern}, yyDollar[5].nodeRelationshipList.Nodes...),
+				Relationships: append([]*Relationship{yyDollar[2].relationship}, yyDollar[5].nodeRelationshipList.Relationships...),
+			}
+		}
+	case 84:
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line grammar/cyphernetes.y:491
+		{
+			yyDollar[2].relationship.LeftNode = yyDollar[1].nodePattern
+			yyDollar[2].relationship.RightNode = yyDollar[3].nodePattern
+			yyDollar[4].relationship.LeftNode = yyDollar[3].nodePattern
+			yyDollar[4].relationship.RightNode = yyDollar[5].nodeRelationshipList.Nodes[0]
+			yyVAL.nodeRelationshipList = &NodeRelationshipList{
+				Nodes:         append([]*NodePattern{yyDollar[1].nodePattern, yyDollar[3].nodePattern}, yyDollar[5].nodeRelationshipList.Nodes...),
+				Relationships: append([]*Relationship{yyDollar[2].relationship, yyDollar[4].relationship}, yyDollar[5].nodeRelationshipList.Relationships...),
+			}
+		}
+	case 85:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:501
+		{
+			yyVAL.nodeRelationshipList = &NodeRelationshipList{
+				Nodes:         append([]*NodePattern{yyDollar[1].nodePattern}, yyDollar[3].nodeRelationshipList.Nodes...),
+				Relationships: yyDollar[3].nodeRelationshipList.Relationships,
+			}
+		}
+	case 86:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:510
+		{
+			yyVAL.nodePattern = &NodePattern{ResourceProperties: yyDollar[2].resourceProperties}
+		}
+	case 87:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:513
+		{
+			yyVAL.nodePattern = &NodePattern{&ResourceProperties{Name: yyDollar[2].strVal, Kind: "", Properties: nil, JsonData: ""}}
+		}
+	case 88:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:519
+		{
+			yyVAL.returnClause = &ReturnClause{Items: yyDollar[2].returnItems, OrderBy: yyDollar[3].orderItems}
+		}
+	case 89:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line grammar/cyphernetes.y:522
+		{
+			yyVAL.returnClause = &ReturnClause{Items: yyDollar[3].returnItems, Distinct: true, OrderBy: yyDollar[4].orderItems}
+		}
+	case 90:
+		yyDollar = yyS[yypt-0 : yypt+1]
+//line grammar/cyphernetes.y:528
+		{
+			yyVAL.orderItems = nil
+		}
+	case 91:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line grammar/cyphernetes.y:531
+		{
+			yyVAL.orderItems = yyDollar[2].orderItems
+		}
+	case 92:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line grammar/cyphernetes.y:537
+		{
+			yyVAL.orderItems = []*OrderItem{yyDollar[1].orderItem}
+		}
+	case 93:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:540
+		{
+			yyVAL.orderItems = append(yyDollar[1].orderItems, yyDollar[3].orderItem)
+		}
+	case 94:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line grammar/cyphernetes.y:546
+		{
+			yyVAL.orderItem = &OrderItem{JsonPath: yyDollar[1].strVal}
+		}
+	case 95:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line grammar/cyphernetes.y:549
+		{
+			yyVAL.orderItem = &OrderItem{JsonPath: yyDollar[1].strVal}
+		}
+	case 96:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line grammar/cyphernetes.y:552
+		{
+			yyVAL.orderItem = &OrderItem{JsonPath: yyDollar[1].strVal, Descending: true}
+		}
+	case 97:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line grammar/cyphernetes.y:558
+		{
+			yyVAL.returnItems = []*ReturnItem{yyDollar[1].returnItem}
+		}
+	case 98:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:561
+		{
+			yyVAL.returnItems = append(yyDollar[1].returnItems, yyDollar[3].returnItem)
+		}
+	case 99:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line grammar/cyphernetes.y:567
+		{
+			yyVAL.returnItem = &ReturnItem{JsonPath: yyDollar[1].strVal}
+		}
+	case 100:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:570
+		{
+			yyVAL.returnItem = &ReturnItem{JsonPath: yyDollar[1].strVal, Alias: yyDollar[3].strVal}
+		}
+	case 101:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line grammar/cyphernetes.y:573
+		{
+			yyVAL.returnItem = &ReturnItem{Aggregate: "COUNT", JsonPath: yyDollar[3].strVal}
+		}
+	case 102:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line grammar/cyphernetes.y:576
+		{
+			yyVAL.returnItem = &ReturnItem{Aggregate: "SUM", JsonPath: yyDollar[3].strVal}
+		}
+	case 103:
+		yyDollar = yyS[yypt-6 : yypt+1]
+//line grammar/cyphernetes.y:579
+		{
+			yyVAL.returnItem = &ReturnItem{Aggregate: "COUNT", JsonPath: yyDollar[3].strVal, Alias: yyDollar[6].strVal}
+		}
+	case 104:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line grammar/cyphernetes.y:582
+		{
+			yyVAL.returnItem = &ReturnItem{Aggregate: "COUNT", JsonPath: yyDollar[3].strVal}
+		}
+	case 105:
+		yyDollar = yyS[yypt-6 : yypt+1]
+//line grammar/cyphernetes.y:585
+		{
+			yyVAL.returnItem = &ReturnItem{Aggregate: "COUNT", JsonPath: yyDollar[3].strVal, Alias: yyDollar[6].strVal}
+		}
+	case 106:
+		yyDollar = yyS[yypt-6 : yypt+1]
+//line grammar/cyphernetes.y:588
+		{
+			yyVAL.returnItem = &ReturnItem{Aggregate: "SUM", JsonPath: yyDollar[3].strVal, Alias: yyDollar[6].strVal}
+		}
+	case 107:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line grammar/cyphernetes.y:591
+		{
+			yyVAL.returnItem = &ReturnItem{Aggregate: "SUM", JsonPath: yyDollar[3].strVal}
+		}
+	case 108:
+		yyDollar = yyS[yypt-6 : yypt+1]
+//line grammar/cyphernetes.y:594
+		{
+			yyVAL.returnItem = &ReturnItem{Aggregate: "SUM", JsonPath: yyDollar[3].strVal, Alias: yyDollar[6].strVal}
+		}
+	case 109:
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line grammar/cyphernetes.y:597
+		{
+			yyVAL.returnItem = &ReturnItem{Function: strings.ToUpper(yyDollar[1].strVal), JsonPath: yyDollar[3].strVal, Args: yyDollar[4].functionArgs}
+		}
+	case 110:
+		yyDollar = yyS[yypt-7 : yypt+1]
+//line grammar/cyphernetes.y:600
+		{
+			yyVAL.returnItem = &ReturnItem{Function: strings.ToUpper(yyDollar[1].strVal), JsonPath: yyDollar[3].strVal, Args: yyDollar[4].functionArgs, Alias: yyDollar[7].strVal}
+		}
+	case 111:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line grammar/cyphernetes.y:606
+		{
+			yyVAL.relationship = &Relationship{ResourceProperties: nil, Direction: None, LeftNode: nil, RightNode: nil}
+		}
+	case 112:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line grammar/cyphernetes.y:609
+		{
+			yyVAL.relationship = &Relationship{ResourceProperties: nil, Direction: Left, LeftNode: nil, RightNode: nil}
+		}
+	case 113:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line grammar/cyphernetes.y:612
+		{
+			yyVAL.relationship = &Relationship{ResourceProperties: nil, Direction: Right, LeftNode: nil, RightNode: nil}
+		}
+	case 114:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line grammar/cyphernetes.y:615
+		{
+			yyVAL.relationship = &Relationship{ResourceProperties: nil, Direction: Both, LeftNode: nil, RightNode: nil}
+		}
+	case 115:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:618
+		{
+			yyVAL.relationship = &Relationship{ResourceProperties: yyDollar[2].resourceProperties, Direction: None, LeftNode: nil, RightNode: nil}
+		}
+	case 116:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:621
+		{
+			yyVAL.relationship = &Relationship{ResourceProperties: yyDollar[2].resourceProperties, Direction: Left, LeftNode: nil, RightNode: nil}
+		}
+	case 117:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:624
+		{
+			yyVAL.relationship = &Relationship{ResourceProperties: yyDollar[2].resourceProperties, Direction: Right, LeftNode: nil, RightNode: nil}
+		}
+	case 118:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:627
+		{
+			yyVAL.relationship = &Relationship{ResourceProperties: yyDollar[2].resourceProperties, Direction: Both, LeftNode: nil, RightNode: nil}
+		}
+	case 119:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:630
+		{
+			yyVAL.relationship = &Relationship{ResourceProperties: &ResourceProperties{Name: yyDollar[2].strVal}, Direction: None}
+		}
+	case 120:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:633
+		{
+			yyVAL.relationship = &Relationship{ResourceProperties: &ResourceProperties{Name: yyDollar[2].strVal}, Direction: Left}
+		}
+	case 121:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:636
+		{
+			yyVAL.relationship = &Relationship{ResourceProperties: &ResourceProperties{Name: yyDollar[2].strVal}, Direction: Right}
+		}
+	case 122:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:639
+		{
+			yyVAL.relationship = &Relationship{ResourceProperties: &ResourceProperties{Name: yyDollar[2].strVal}, Direction: Both}
+		}
+	case 123:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line grammar/cyphernetes.y:642
+		{
+			yyVAL.relationship = &Relationship{ResourceProperties: &ResourceProperties{Kind: yyDollar[3].strVal}, Direction: None}
+		}
+	case 124:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line grammar/cyphernetes.y:645
+		{
+			yyVAL.relationship = &Relationship{ResourceProperties: &ResourceProperties{Kind: yyDollar[3].strVal}, Direction: Left}
+		}
+	case 125:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line grammar/cyphernetes.y:648
+		{
+			yyVAL.relationship = &Relationship{ResourceProperties: &ResourceProperties{Kind: yyDollar[3].strVal}, Direction: Right}
+		}
+	case 126:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line grammar/cyphernetes.y:651
+		{
+			yyVAL.relationship = &Relationship{ResourceProperties: &ResourceProperties{Kind: yyDollar[3].strVal}, Direction: Both}
+		}
+	case 127:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line grammar/cyphernetes.y:654
+		{
+			yyVAL.relationship = &Relationship{ResourceProperties: &ResourceProperties{Name: yyDollar[2].strVal}, Direction: None, Hops: yyDollar[3].hops}
+		}
+	case 128:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line grammar/cyphernetes.y:657
+		{
+			yyVAL.relationship = &Relationship{ResourceProperties: &ResourceProperties{Name: yyDollar[2].strVal}, Direction: Left, Hops: yyDollar[3].hops}
+		}
+	case 129:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line grammar/cyphernetes.y:660
+		{
+			yyVAL.relationship = &Relationship{ResourceProperties: &ResourceProperties{Name: yyDollar[2].strVal}, Direction: Right, Hops: yyDollar[3].hops}
+		}
+	case 130:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line grammar/cyphernetes.y:663
+		{
+			yyVAL.relationship = &Relationship{ResourceProperties: &ResourceProperties{Name: yyDollar[2].strVal}, Direction: Both, Hops: yyDollar[3].hops}
+		}
+	case 131:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:666
+		{
+			yyVAL.relationship = &Relationship{Direction: None, Hops: yyDollar[2].hops}
+		}
+	case 132:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:669
+		{
+			yyVAL.relationship = &Relationship{Direction: Left, Hops: yyDollar[2].hops}
+		}
+	case 133:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:672
+		{
+			yyVAL.relationship = &Relationship{Direction: Right, Hops: yyDollar[2].hops}
+		}
+	case 134:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:675
+		{
+			yyVAL.relationship = &Relationship{Direction: Both, Hops: yyDollar[2].hops}
+		}
+	case 135:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:681
+		{
+			yyVAL.resourceProperties = &ResourceProperties{Name: yyDollar[1].strVal, Kind: yyDollar[3].strVal, Properties: nil, JsonData: ""}
+		}
+	case 136:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line grammar/cyphernetes.y:684
+		{
+			yyVAL.resourceProperties = &ResourceProperties{Name: yyDollar[1].strVal, Kind: yyDollar[3].strVal, Properties: yyDollar[4].properties, JsonData: ""}
+		}
+	case 137:
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line grammar/cyphernetes.y:687
+		{
+			yyVAL.resourceProperties = &ResourceProperties{Name: yyDollar[1].strVal, Kind: yyDollar[3].strVal, Properties: nil, JsonData: yyDollar[5].strVal}
+		}
+	case 138:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:693
+		{
+			yyVAL.properties = &Properties{PropertyList: yyDollar[2].jsonPathValueList}
+		}
+	case 139:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line grammar/cyphernetes.y:699
+		{
+			yyVAL.jsonPathValueList = []*Property{yyDollar[1].jsonPathValue} // Start with one Property element
+		}
+	case 140:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:702
+		{
+			yyVAL.jsonPathValueList = append(yyDollar[1].jsonPathValueList, yyDollar[3].jsonPathValue) // $1 and $3 are the left and right operands of COMMA
+		}
+	case 141:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:708
+		{
+			yyVAL.jsonPathValue = &Property{Key: yyDollar[1].strVal, Value: yyDollar[3].value}
+		}
+	case 142:
+		yyDollar = yyS[yypt-5 : yypt+1]
+//line grammar/cyphernetes.y:711
+		{
+			yyVAL.jsonPathValue = &Property{Key: yyDollar[1].strVal, Value: yyDollar[4].values, Operator: "IN"}
+		}
+	case 143:
+		yyDollar = yyS[yypt-6 : yypt+1]
+//line grammar/cyphernetes.y:714
+		{
+			yyVAL.jsonPathValue = &Property{Key: yyDollar[1].strVal, Value: yyDollar[5].values, Operator: "NOT_IN"}
+		}
+	case 144:
+		yyDollar = yyS[yypt-2 : yypt+1]
+//line grammar/cyphernetes.y:717
+		{
+			yyVAL.jsonPathValue = &Property{Key: yyDollar[1].strVal, Operator: "EXISTS"}
+		}
+	case 145:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:720
+		{
+			yyVAL.jsonPathValue = &Property{Key: yyDollar[1].strVal, Operator: "NOT_EXISTS"}
+		}
+	case 146:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line grammar/cyphernetes.y:726
+		{
+			yyVAL.values = []interface{}{yyDollar[1].value}
+		}
+	case 147:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:729
+		{
+			yyVAL.values = append(yyDollar[1].values, yyDollar[3].value)
+		}
+	case 148:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line grammar/cyphernetes.y:735
+		{
+			yyVAL.value = unquote(yyDollar[1].strVal)
+		}
+	case 149:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line grammar/cyphernetes.y:738
 		{
 			// Parse the int from the string
-			i, err := strconv.Atoi(yyS[yypt-0].strVal)
+			i, err := strconv.Atoi(yyDollar[1].strVal)
 			if err != nil {
-				// ... handle error
-				panic(err)
+				yylex.Error(fmt.Sprintf("integer %s is out of range", yyDollar[1].strVal))
+				return 1
 			}
 			yyVAL.value = i
 		}
-	case 57:
+	case 150:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line grammar/cyphernetes.y:747
 		{
 			// Parse the boolean from the string
-			yyVAL.value = strings.ToUpper(yyS[yypt-0].strVal) == "TRUE"
+			yyVAL.value = strings.ToUpper(yyDollar[1].strVal) == "TRUE"
 		}
-	case 58:
+	case 151:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line grammar/cyphernetes.y:751
 		{
-			yyVAL.value = yyS[yypt-0].strVal
+			yyVAL.value = yyDollar[1].strVal
+		}
+	case 152:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line grammar/cyphernetes.y:754
+		{
+			// Only SET values may be null, which removes the field
+			yyVAL.value = nil
+		}
+	case 153:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line grammar/cyphernetes.y:758
+		{
+			// Given when the query runs, see PreparedQuery
+			yyVAL.value = &Parameter{Name: yyDollar[1].strVal}
+		}
+	case 154:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line grammar/cyphernetes.y:762
+		{
+			yyVAL.value = yyDollar[1].temporalExpression
+		}
+	case 155:
+		yyDollar = yyS[yypt-1 : yypt+1]
+//line grammar/cyphernetes.y:769
+		{
+			yyVAL.temporalExpression = &TemporalExpression{Terms: []*TemporalTerm{yyDollar[1].temporalTerm}}
+		}
+	case 156:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:772
+		{
+			yyDollar[1].temporalExpression.Terms = append(yyDollar[1].temporalExpression.Terms, yyDollar[3].temporalTerm)
+			yyVAL.temporalExpression = yyDollar[1].temporalExpression
+		}
+	case 157:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:776
+		{
+			yyDollar[3].temporalTerm.Negative = true
+			yyDollar[1].temporalExpression.Terms = append(yyDollar[1].temporalExpression.Terms, yyDollar[3].temporalTerm)
+			yyVAL.temporalExpression = yyDollar[1].temporalExpression
+		}
+	case 158:
+		yyDollar = yyS[yypt-3 : yypt+1]
+//line grammar/cyphernetes.y:784
+		{
+			yyVAL.temporalTerm = &TemporalTerm{Function: strings.ToUpper(yyDollar[1].strVal)}
+		}
+	case 159:
+		yyDollar = yyS[yypt-4 : yypt+1]
+//line grammar/cyphernetes.y:787
+		{
+			yyVAL.temporalTerm = &TemporalTerm{Function: strings.ToUpper(yyDollar[1].strVal), Arg: unquote(yyDollar[3].strVal)}
 		}
-
-	}
-
-	if yyEx != nil && yyEx.Reduced(r, exState, &yyVAL) {
-		return -1
 	}
 	goto yystack /* stack new state and value */
 }
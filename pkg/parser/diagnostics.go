@@ -0,0 +1,459 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// DiagnosticCode identifies a class of errors and warnings. Codes are stable across releases,
+// so scripts can branch on them instead of on messages, which may change or be translated.
+type DiagnosticCode string
+
+// Diagnostic codes, see the catalog below for what each means
+const (
+	CodeParseFailed             DiagnosticCode = "CYP-0001"
+	CodeUnknownFunction         DiagnosticCode = "CYP-0002"
+	CodeFunctionExpectsNode     DiagnosticCode = "CYP-0003"
+	CodeUnknownReturnNode       DiagnosticCode = "CYP-0004"
+	CodeUnknownMutationNode     DiagnosticCode = "CYP-0005"
+	CodeMissingKind             DiagnosticCode = "CYP-0006"
+	CodeMultiKindRelationship   DiagnosticCode = "CYP-0007"
+	CodeSelectorEqualityOnly    DiagnosticCode = "CYP-0008"
+	CodeNameSelectorCombination DiagnosticCode = "CYP-0009"
+	CodeInvalidLabelSelector    DiagnosticCode = "CYP-0010"
+	CodeInvalidJSONData         DiagnosticCode = "CYP-0011"
+	CodeUnknownClause           DiagnosticCode = "CYP-0012"
+	CodeInvalidWith             DiagnosticCode = "CYP-0013"
+	CodeInvalidUnwind           DiagnosticCode = "CYP-0014"
+	CodeFunctionArguments       DiagnosticCode = "CYP-0015"
+	CodeInvalidRegex            DiagnosticCode = "CYP-0016"
+	CodeInvalidTemporal         DiagnosticCode = "CYP-0017"
+	CodeUnionAggregate          DiagnosticCode = "CYP-0018"
+	CodeTypeExpectsRelationship DiagnosticCode = "CYP-0019"
+
+	CodeUnknownKind     DiagnosticCode = "CYP-0020"
+	CodeUnknownGVR      DiagnosticCode = "CYP-0021"
+	CodeAmbiguousKind   DiagnosticCode = "CYP-0022"
+	CodeKindUnavailable DiagnosticCode = "CYP-0023"
+	CodeUnknownField    DiagnosticCode = "CYP-0024"
+
+	CodeAPIRequestFailed     DiagnosticCode = "CYP-0030"
+	CodeForbidden            DiagnosticCode = "CYP-0031"
+	CodeNotFound             DiagnosticCode = "CYP-0032"
+	CodeConflict             DiagnosticCode = "CYP-0033"
+	CodeInvalidPatch         DiagnosticCode = "CYP-0034"
+	CodeInvalidPatchType     DiagnosticCode = "CYP-0035"
+	CodeUnsupportedOperation DiagnosticCode = "CYP-0036"
+	CodeInvalidStatusSet     DiagnosticCode = "CYP-0037"
+	CodeAccessDenied         DiagnosticCode = "CYP-0038"
+	CodeReadOnly             DiagnosticCode = "CYP-0039"
+
+	CodeRelationshipNotFound       DiagnosticCode = "CYP-0040"
+	CodeRelationshipRuleMissing    DiagnosticCode = "CYP-0041"
+	CodeCreateBothNodesExist       DiagnosticCode = "CYP-0042"
+	CodeCreateNoNodeExists         DiagnosticCode = "CYP-0043"
+	CodeCreateNodeExists           DiagnosticCode = "CYP-0044"
+	CodeMergeUnsupported           DiagnosticCode = "CYP-0045"
+	CodeInvalidHops                DiagnosticCode = "CYP-0046"
+	CodeCreateVariableLength       DiagnosticCode = "CYP-0047"
+	CodeRelationshipVariable       DiagnosticCode = "CYP-0048"
+	CodeCreateAnalyzedRelationship DiagnosticCode = "CYP-0049"
+
+	CodeAggregationFailed DiagnosticCode = "CYP-0050"
+
+	CodeKubeconfigNotFound DiagnosticCode = "CYP-0060"
+	CodeContextConfig      DiagnosticCode = "CYP-0061"
+	CodeClientCreation     DiagnosticCode = "CYP-0062"
+
+	CodeOpenAPIUnavailable  DiagnosticCode = "CYP-0070"
+	CodeSchemaUnavailable   DiagnosticCode = "CYP-0071"
+	CodeResourceSpecsFailed DiagnosticCode = "CYP-0072"
+	CodeMetricsUnavailable  DiagnosticCode = "CYP-0073"
+	CodeGroupUnavailable    DiagnosticCode = "CYP-0074"
+
+	CodeInterrupted        DiagnosticCode = "CYP-0080"
+	CodeInvalidHealthQuery DiagnosticCode = "CYP-0081"
+	CodeRolloutUnhealthy   DiagnosticCode = "CYP-0082"
+	CodeRolloutFailures    DiagnosticCode = "CYP-0083"
+	CodeInvalidBatchSize   DiagnosticCode = "CYP-0084"
+	CodeWatchUnsupported   DiagnosticCode = "CYP-0085"
+	CodeInvalidContinue    DiagnosticCode = "CYP-0086"
+	CodeContinueExpired    DiagnosticCode = "CYP-0087"
+	CodeRolledBack         DiagnosticCode = "CYP-0088"
+	CodeRollbackFailed     DiagnosticCode = "CYP-0089"
+
+	CodeInvalidLogLevel  DiagnosticCode = "CYP-0090"
+	CodeInvalidLogFormat DiagnosticCode = "CYP-0091"
+
+	CodeUnsupportedVersion DiagnosticCode = "CYP-0100"
+	CodeVersionRequired    DiagnosticCode = "CYP-0101"
+
+	CodeTimedOut     DiagnosticCode = "CYP-0110"
+	CodeListTimedOut DiagnosticCode = "CYP-0111"
+
+	CodeMissingParameter DiagnosticCode = "CYP-0120"
+	CodeUnknownParameter DiagnosticCode = "CYP-0121"
+	CodeInvalidParameter DiagnosticCode = "CYP-0122"
+)
+
+// Severities of diagnostics
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Diagnostic documents a code, as shown by `cyphernetes explain <code>`
+type Diagnostic struct {
+	Code     DiagnosticCode `json:"code"`
+	Severity string         `json:"severity"`
+	Title    string         `json:"title"`
+	// Message is the template of the message, its {placeholders} are filled from the details
+	Message     string `json:"message"`
+	Explanation string `json:"explanation"`
+}
+
+var diagnosticCatalog = map[DiagnosticCode]Diagnostic{
+	CodeParseFailed: {Severity: SeverityError, Title: "Syntax error",
+		Message:     "parsing failed: {error}",
+		Explanation: "The query isn't valid Cyphernetes. Check for unbalanced parentheses, braces or quotes, and that clauses come in the order MATCH, WHERE, SET/DELETE/CREATE, RETURN."},
+	CodeUnknownFunction: {Severity: SeverityError, Title: "Unknown function",
+		Message:     "unknown function {function}()",
+		Explanation: "The functions of nodes are id(), name(), namespace(), kind() and uid(), logs() that of pods, and type() that of relationships. The functions of values, usable in WHERE, WITH and RETURN, are toUpper(), toLower(), split(), replace(), contains(), startsWith(), endsWith(), size(), keys() and coalesce()."},
+	CodeFunctionExpectsNode: {Severity: SeverityError, Title: "Function argument isn't a node",
+		Message:     "{function}() expects a node identifier, got {argument}",
+		Explanation: "The functions of nodes, id(), name(), namespace(), kind() and uid(), take the identifier of a matched node, e.g. name(p), not a path within it."},
+	CodeUnknownReturnNode: {Severity: SeverityError, Title: "Unknown node in RETURN",
+		Message:     "node identifier {node} not found in return clause",
+		Explanation: "A RETURN item refers to an identifier that isn't matched or created by the query."},
+	CodeUnknownMutationNode: {Severity: SeverityError, Title: "Unknown node in a mutation",
+		Message:     "node identifier {node} not found in result map",
+		Explanation: "A SET, DELETE, RESTART, SCALE, PAUSE or RESUME clause refers to an identifier that isn't matched by the query."},
+	CodeMissingKind: {Severity: SeverityError, Title: "Node without a kind",
+		Message:     "must specify kind for all nodes in match clause",
+		Explanation: "Nodes only get their kind implied when they are connected to a node of known kind by a relationship."},
+	CodeMultiKindRelationship: {Severity: SeverityError, Title: "Multi-kind node in a relationship",
+		Message:     "node {node} matches multiple kinds ({kind}), which is not supported in relationships",
+		Explanation: "Nodes matching several kinds (Kind1|Kind2 or *) can't take part in relationships, match each kind separately."},
+	CodeSelectorEqualityOnly: {Severity: SeverityError, Title: "Operator not supported by a selector",
+		Message:     "the '{selector}' selector only supports equality",
+		Explanation: "The name and namespace selectors are field selectors, they can't be used with IN, NOT IN, EXISTS or NOT EXISTS. Use a WHERE clause instead."},
+	CodeNameSelectorCombination: {Severity: SeverityError, Title: "Name selector combined with labels",
+		Message:     "the 'name' selector can be used by itself or combined with 'namespace', but not with other label selectors",
+		Explanation: "Matching by name and by labels at once isn't supported, filter the labels in a WHERE clause instead."},
+	CodeInvalidLabelSelector: {Severity: SeverityError, Title: "Invalid label selector",
+		Message:     "error parsing label selector >> {error}",
+		Explanation: "The properties of a node don't form a valid Kubernetes label selector, e.g. a label value has characters labels can't hold."},
+	CodeInvalidJSONData: {Severity: SeverityError, Title: "Invalid JSON in CREATE",
+		Message:     "error unmarshalling node JsonData >> {error}",
+		Explanation: "The JSON given to a node in a CREATE clause isn't valid JSON."},
+	CodeUnknownClause: {Severity: SeverityError, Title: "Unknown clause",
+		Message:     "unknown clause type: {clause}",
+		Explanation: "The query holds a clause the executor doesn't know about. This is a bug, please report it."},
+	CodeInvalidWith: {Severity: SeverityError, Title: "Invalid WITH clause",
+		Message:     "invalid WITH item {item}: {reason}",
+		Explanation: "A WITH clause either passes matched nodes on, e.g. WITH d, or groups the values of a single node into named rows, e.g. WITH p.spec.nodeName AS node, COUNT{p} AS pods. Only what it passes on can be used by the clauses that follow."},
+	CodeInvalidUnwind: {Severity: SeverityError, Title: "Invalid UNWIND clause",
+		Message:     "can't unwind {path}: {reason}",
+		Explanation: "UNWIND expands a list of a matched node, e.g. UNWIND p.spec.containers AS c, or of a value passed on by WITH or UNWIND, into one row per element. A node can't be unwound once WITH has grouped values into rows, and the name given by AS must not be in use."},
+	CodeFunctionArguments: {Severity: SeverityError, Title: "Invalid function arguments",
+		Message:     "{function}() {reason}",
+		Explanation: "A function was given the wrong number of arguments, or an argument that refers to another node than its first argument. Arguments are JSONPaths, strings or integers, e.g. replace(p.metadata.name, \"-\", \"_\")."},
+	CodeInvalidRegex: {Severity: SeverityError, Title: "Invalid regular expression",
+		Message:     "invalid regular expression {pattern}: {error}",
+		Explanation: "The pattern of a =~ filter isn't a valid Go regular expression, see https://pkg.go.dev/regexp/syntax."},
+	CodeInvalidTemporal: {Severity: SeverityError, Title: "Invalid temporal value",
+		Message:     "invalid temporal value {expression}: {reason}",
+		Explanation: "A WHERE filter compares with a sum of now(), datetime() and duration() calls, e.g. now() - duration(\"24h\"). datetime() takes an RFC 3339 timestamp, duration() a Go duration that may also count days, e.g. 7d or 1h30m. The sum must be a point in time plus or minus durations, a difference of two points in time, or durations."},
+	CodeUnionAggregate: {Severity: SeverityError, Title: "Aggregate returned twice by UNION",
+		Message:     "aggregate {aggregate} is returned by more than one query of the UNION",
+		Explanation: "The aggregates of the queries combined by UNION are returned together, so each needs its own name. Name them with AS, e.g. RETURN COUNT{d} AS deployments."},
+	CodeTypeExpectsRelationship: {Severity: SeverityError, Title: "Function argument isn't a relationship",
+		Message:     "type() expects a relationship identifier, got {argument}",
+		Explanation: "type() returns the type of the links bound to a relationship variable, e.g. type(r) for (s:Service)-[r]->(p:Pod). Nodes have kinds, which kind() returns."},
+	CodeUnknownKind: {Severity: SeverityError, Title: "Unknown kind",
+		Message:     "resource identifier not found: {identifier}",
+		Explanation: "No API resource has this kind, plural, singular or short name. Check the spelling, and that the CRD is installed. Use :resolve in the shell to see what an identifier resolves to."},
+	CodeUnknownGVR: {Severity: SeverityError, Title: "Unknown resource",
+		Message:     "kind not found for GVR {gvr}",
+		Explanation: "API discovery doesn't list this group, version and resource. The discovery cache may be stale, try invalidating it."},
+	CodeAmbiguousKind: {Severity: SeverityError, Title: "Ambiguous kind",
+		Message:     "resource identifier {identifier} is ambiguous, it matches {candidates}; qualify it with the group of the one you mean",
+		Explanation: "More than one API resource has this name, e.g. a CRD sharing its kind with another, and none of them is of the core group, which would be picked as kubectl does. Qualify it with the group of the one you mean, e.g. certificates.cert-manager.io, or pass --match-all-gvrs to query all of them. Use :resolve in the shell to list the matches."},
+	CodeKindUnavailable: {Severity: SeverityError, Title: "Kind in an unavailable group",
+		Message:     "resource identifier not found: {identifier}, it may be served by the unavailable API groups {groups}",
+		Explanation: "No API resource discovered has this name, and discovery failed for some API groups, usually because the aggregated API server serving them is down (e.g. metrics-server for metrics.k8s.io). Check the APIService of the groups with kubectl get apiservices."},
+	CodeUnknownField: {Severity: SeverityWarning, Title: "Unknown field",
+		Message:     "{path} isn't a field of {kind}{hint}",
+		Explanation: "The OpenAPI schema of the kind has no such field, which is usually a typo: the path matches nothing, so WHERE filters never match and RETURN items are empty. The closest field of the schema is suggested when there's one. Queries still run with the field, unless --strict is passed."},
+	CodeAPIRequestFailed: {Severity: SeverityError, Title: "API request failed",
+		Message:     "{error}",
+		Explanation: "The Kubernetes API server rejected a {verb} of {resource}. Details hold the reason it gave."},
+	CodeForbidden: {Severity: SeverityError, Title: "Forbidden",
+		Message:     "{error}",
+		Explanation: "Your credentials aren't allowed to {verb} {resource}. Check your RBAC permissions, e.g. with kubectl auth can-i."},
+	CodeNotFound: {Severity: SeverityError, Title: "Not found",
+		Message:     "{error}",
+		Explanation: "The resource or namespace doesn't exist, or was deleted while the query ran."},
+	CodeConflict: {Severity: SeverityError, Title: "Conflict",
+		Message:     "{error}",
+		Explanation: "The resource already exists, or was changed by someone else while the query ran. Run the query again."},
+	CodeInvalidPatch: {Severity: SeverityError, Title: "Invalid SET",
+		Message:     "error marshalling patches: {error}",
+		Explanation: "The values of a SET clause can't be turned into a JSON patch."},
+	CodeInvalidPatchType: {Severity: SeverityError, Title: "Invalid patch type",
+		Message:     "{reason}",
+		Explanation: "SET patches with a json, merge or strategic patch, as named after SET or by --patch-type. Only json patches can set or remove the elements of lists by index, merge and strategic patches set lists as a whole."},
+	CodeUnsupportedOperation: {Severity: SeverityError, Title: "Unsupported rollout operation",
+		Message:     "{operation} doesn't apply to {kind} {name}: {reason}",
+		Explanation: "RESTART restarts the pods of workloads with a pod template, e.g. Deployments, StatefulSets and DaemonSets. SCALE scales the resources with a scale subresource, e.g. Deployments, StatefulSets and ReplicaSets. PAUSE and RESUME pause the rollouts of Deployments, and suspend Jobs and CronJobs."},
+	CodeInvalidStatusSet: {Severity: SeverityError, Title: "SET STATUS outside the status",
+		Message:     "SET STATUS only sets the status of resources, {key} is outside it",
+		Explanation: "SET STATUS patches the status subresource, which only changes the values under status, e.g. SET STATUS r.status.phase = \"Ready\". Set the other values with a SET clause of their own."},
+	CodeAccessDenied: {Severity: SeverityError, Title: "Query not allowed",
+		Message:     "the query isn't allowed to {denials}",
+		Explanation: "Before running the query, --preflight asked the API server whether your identity may make each request the query plans, with SelfSubjectAccessReviews, and some were denied. Nothing was run. Ask for the missing permissions, or narrow the query, e.g. to a namespace you may list."},
+	CodeReadOnly: {Severity: SeverityError, Title: "Read-only mode",
+		Message:     "{clause} isn't allowed in read-only mode, queries can only read resources",
+		Explanation: "Cyphernetes runs in read-only mode, with --read-only or the readOnly setting of the web server, and rejects queries that create, change or delete resources before running them. Nothing was changed. Use MATCH and RETURN to explore the cluster, or EXPLAIN to see what the query would do."},
+	CodeRelationshipNotFound: {Severity: SeverityError, Title: "No relationship between kinds",
+		Message:     "relationship type not found between {left} and {right}",
+		Explanation: "Cyphernetes doesn't know how these kinds relate. See the list of supported relationships in the documentation."},
+	CodeRelationshipRuleMissing: {Severity: SeverityError, Title: "Missing relationship rule",
+		Message:     "relationship rule not found for {left} and {right} - This code path should be invalid, likely problem with rule definitions",
+		Explanation: "A relationship type is known but has no rule to evaluate it. This is a bug, please report it."},
+	CodeCreateBothNodesExist: {Severity: SeverityError, Title: "Both nodes of a created relationship exist",
+		Message:     "both nodes '{left}', '{right}' of relationship in create clause already exist",
+		Explanation: "CREATE creates the missing node of a relationship, one of its nodes must be new."},
+	CodeCreateNoNodeExists: {Severity: SeverityError, Title: "No node of a created relationship exists",
+		Message:     "not yet supported: neither node '{left}', '{right}' of relationship in create clause already exist",
+		Explanation: "CREATE can only create a node related to a matched node, match one of them first."},
+	CodeCreateNodeExists: {Severity: SeverityError, Title: "Created node is matched",
+		Message:     "can't create: node '{node}' already exists in match clause",
+		Explanation: "A node can't be both matched and created, use another identifier for the new node."},
+	CodeMergeUnsupported: {Severity: SeverityError, Title: "Node can't be merged",
+		Message:     "can't merge node '{node}': {reason}",
+		Explanation: "MERGE creates the resource its pattern describes when none matches, so the pattern must have a single kind, a name property and only equality properties, e.g. MERGE (cm:ConfigMap {name: \"settings\"})."},
+	CodeInvalidHops: {Severity: SeverityError, Title: "Invalid variable-length relationship",
+		Message:     "invalid hops {hops} in the relationship of {left} and {right}: {reason}",
+		Explanation: "A variable-length relationship, e.g. -[*1..3]->, spans at least 1 and at most 5 relationships, and its minimum can't be more than its maximum."},
+	CodeCreateVariableLength: {Severity: SeverityError, Title: "Variable-length relationship in CREATE",
+		Message:     "the relationship of {left} and {right} in create clause is variable-length",
+		Explanation: "CREATE fills in the spec of the new node from the one relationship joining its kind to the existing node's, so the relationship can't go through intermediate kinds."},
+	CodeRelationshipVariable: {Severity: SeverityError, Title: "Relationship variable is a node",
+		Message:     "relationship variable {name} is also the name of a node",
+		Explanation: "A relationship variable, e.g. r in (s:Service)-[r]->(p:Pod), binds the links between resources, so it needs a name no node of the clause has."},
+	CodeCreateAnalyzedRelationship: {Severity: SeverityError, Title: "Relationship can't be created",
+		Message:     "{relationship} relationships can't be created",
+		Explanation: "Some relationships aren't made by a field of one resource referring to the other, but evaluated from other resources of the cluster, e.g. CAN_REACH from the NetworkPolicies of pods. CREATE can't set them up, create or change those resources instead."},
+	CodeAggregationFailed: {Severity: SeverityError, Title: "Aggregation failed",
+		Message:     "{message}",
+		Explanation: "SUM could not add up the values, e.g. a CPU or memory quantity is malformed or the values aren't numbers."},
+	CodeKubeconfigNotFound: {Severity: SeverityError, Title: "No cluster configuration",
+		Message:     "failed to create config: not found in $KUBECONFIG, ~/.kube/config, or in-cluster",
+		Explanation: "No kubeconfig was found and Cyphernetes isn't running in a cluster. Set KUBECONFIG or create ~/.kube/config."},
+	CodeContextConfig: {Severity: SeverityError, Title: "Unusable kubeconfig context",
+		Message:     "failed to create config for context {context}: {error}",
+		Explanation: "The kubeconfig context doesn't exist or is incomplete. List the contexts with kubectl config get-contexts."},
+	CodeClientCreation: {Severity: SeverityError, Title: "Client creation failed",
+		Message:     "error creating {client}: {error}",
+		Explanation: "A Kubernetes client couldn't be created from the configuration, which is likely malformed."},
+	CodeOpenAPIUnavailable: {Severity: SeverityError, Title: "OpenAPI unavailable",
+		Message:     "failed to retrieve OpenAPI paths: {error}",
+		Explanation: "The API server didn't serve its OpenAPI v3 schemas, which completion and relationships rely on."},
+	CodeSchemaUnavailable: {Severity: SeverityWarning, Title: "Schema unavailable",
+		Message:     "error retrieving schema for group version {groupVersion}: {error}",
+		Explanation: "The OpenAPI schema of one group version couldn't be read, its fields won't be completed."},
+	CodeResourceSpecsFailed: {Severity: SeverityWarning, Title: "Resource specs unavailable",
+		Message:     "error fetching resource specs >> {error}",
+		Explanation: "The fields of resources couldn't be loaded, completion and relationships may be limited."},
+	CodeGroupUnavailable: {Severity: SeverityWarning, Title: "API group unavailable",
+		Message:     "error discovering the resources of group version {groupVersion}: {error}",
+		Explanation: "Discovery failed for one API group, usually because the aggregated API server serving it is down. Queries of other kinds run as usual, those of its kinds fail until it's back and the discovery cache is invalidated, e.g. with \\dc in the shell."},
+	CodeMetricsUnavailable: {Severity: SeverityError, Title: "Metrics unavailable",
+		Message:     "error listing the metrics of {resource} >> {error}",
+		Explanation: "The query refers to the metrics field of pods or nodes, whose usage is read from the metrics API (metrics.k8s.io). Check that metrics-server, or another provider of the API, runs in the cluster and that you may list its resources."},
+	CodeInterrupted: {Severity: SeverityError, Title: "Query interrupted",
+		Message:     "query interrupted, {changes}",
+		Explanation: "The query was cancelled, e.g. with Ctrl-C, before it completed. Its results are partial, and it stopped making changes: the changes listed in the details were applied, any other change wasn't."},
+	CodeInvalidHealthQuery: {Severity: SeverityError, Title: "Invalid health query",
+		Message:     "health query must only MATCH and RETURN resources",
+		Explanation: "The health query of a rollout runs between its waves and must not change anything, it may only have MATCH and RETURN clauses."},
+	CodeRolloutUnhealthy: {Severity: SeverityError, Title: "Rollout halted",
+		Message:     "rollout halted after wave {wave}, the health query returned {count} unhealthy resources: {changes}",
+		Explanation: "The health query of the rollout returned resources after a wave, so the following waves weren't applied. Fix the unhealthy resources and rerun the query, with --resume to skip the changes already made if a ledger was written."},
+	CodeRolloutFailures: {Severity: SeverityError, Title: "Rollout changes failed",
+		Message:     "{count} changes of the rollout failed: {failures}",
+		Explanation: "Some changes of the rollout failed, and the rollout went on with the others. Use --stop-on-error to stop at the first failed change instead."},
+	CodeInvalidBatchSize: {Severity: SeverityError, Title: "Invalid APPLY batch size",
+		Message:     "invalid batch size {size}, APPLY BATCH takes a number of changes of at least 1",
+		Explanation: "The changes of an APPLY query are made in batches of the given number of changes, e.g. APPLY BATCH 5, which must be at least 1."},
+	CodeWatchUnsupported: {Severity: SeverityError, Title: "Query can't be watched",
+		Message:     "only queries that MATCH a single kind and RETURN its values without aggregations can be watched",
+		Explanation: "A watched query is evaluated for each change of a resource, so it must match a single node of one kind, without relationships, and return its values without aggregating them, e.g. MATCH (p:Pod) WHERE p.status.phase = \"Failed\" RETURN p.metadata.name."},
+	CodeInvalidContinue: {Severity: SeverityError, Title: "Invalid continue token",
+		Message:     "the continue token can't resume this query: {reason}",
+		Explanation: "A continue token resumes the query that returned it, in the same namespace, from where its truncated results ended. Run the query again with the exact token it printed, or without one to start over."},
+	CodeContinueExpired: {Severity: SeverityError, Title: "Continue token expired",
+		Message:     "the continue token expired while listing {resource}, run the query again without it",
+		Explanation: "The API server only keeps the snapshot a paged listing reads from for a few minutes. Once it's gone the query can't be resumed and has to start over."},
+	CodeRolledBack: {Severity: SeverityError, Title: "Query rolled back",
+		Message:     "{error}, {changes}",
+		Explanation: "The atomic query failed, so the changes it had made were undone, latest first: the objects it created were deleted, those it deleted created again, and those it patched set back to how it found them."},
+	CodeRollbackFailed: {Severity: SeverityError, Title: "Rollback failed",
+		Message:     "{error}, and {count} of its changes couldn't be rolled back: {failures}",
+		Explanation: "The atomic query failed, and undoing some of its changes failed too, e.g. because the objects were changed by someone else meanwhile. The other changes were rolled back. The undo detail holds the kubectl commands that undo the remaining changes, check the objects before running them."},
+	CodeInvalidLogLevel: {Severity: SeverityError, Title: "Invalid log level",
+		Message:     "unknown log level {level}, expected debug, info, warn or error",
+		Explanation: "--log-level only accepts debug, info, warn and error."},
+	CodeInvalidLogFormat: {Severity: SeverityError, Title: "Invalid log format",
+		Message:     "unknown log format {format}, expected text or json",
+		Explanation: "--log-format only accepts text and json."},
+	CodeUnsupportedVersion: {Severity: SeverityError, Title: "Unsupported language version",
+		Message:     "language version {version} isn't supported, the latest is {latest}",
+		Explanation: "The CYPHERNETES pragma of a query, e.g. CYPHERNETES 1 MATCH (p:Pod) RETURN p, and --compat take a language version from 1 to the latest this release knows. A query written for a later version needs a later release."},
+	CodeVersionRequired: {Severity: SeverityError, Title: "Query needs a later language version",
+		Message:     "{feature} requires language version {required}, the query is checked against version {version}",
+		Explanation: "The query uses a construct introduced, or whose meaning changed, after the language version it declares with its CYPHERNETES pragma, or that of --compat if it declares none. Check the query against the construct's meaning in the required version, then declare that version."},
+	CodeTimedOut: {Severity: SeverityError, Title: "Query timed out",
+		Message:     "query timed out in {clause}, {changes}",
+		Explanation: "The query ran past its deadline, e.g. that of --timeout, before it completed. Its results are partial, and it stopped making changes: the changes listed in the details were applied, any other change wasn't. The clause it was running is the one that waited on the API server, often for an API that doesn't answer."},
+	CodeListTimedOut: {Severity: SeverityError, Title: "List call timed out",
+		Message:     "listing {resource} timed out after {timeout} in {clause}",
+		Explanation: "The API server didn't answer a list call of the resource before its deadline, set with --list-timeout or the listTimeout settings of the web server. Aggregated APIs whose server is down or unreachable, e.g. metrics.k8s.io with a broken metrics-server, are the usual cause: check the APIService of the resource's group with kubectl get apiservices. Raise the deadline of the resource if it's only slow."},
+	CodeMissingParameter: {Severity: SeverityError, Title: "Missing parameter",
+		Message:     "parameter {parameter} has no value",
+		Explanation: "The query has a parameter, e.g. $name, that wasn't given a value. Give every parameter of the query a value when running it, e.g. with --param name=web or the parameters of the web API's query requests."},
+	CodeUnknownParameter: {Severity: SeverityError, Title: "Unknown parameter",
+		Message:     "the query has no parameter {parameter}",
+		Explanation: "A value was given for a parameter the query doesn't have. Check the spelling of the parameter against the query, names are case-sensitive."},
+	CodeInvalidParameter: {Severity: SeverityError, Title: "Invalid parameter value",
+		Message:     "parameter {parameter} can't be a {type}",
+		Explanation: "Parameters stand for the values of properties, WHERE filters and SET clauses, which are strings, numbers, booleans or null."},
+}
+
+// LookupDiagnostic returns the documentation of a code
+func LookupDiagnostic(code DiagnosticCode) (Diagnostic, bool) {
+	diagnostic, ok := diagnosticCatalog[code]
+	diagnostic.Code = code
+	return diagnostic, ok
+}
+
+// Diagnostics returns every documented code, in order
+func Diagnostics() []Diagnostic {
+	var diagnostics []Diagnostic
+	for code := range diagnosticCatalog {
+		diagnostic, _ := LookupDiagnostic(code)
+		diagnostics = append(diagnostics, diagnostic)
+	}
+	sort.Slice(diagnostics, func(i, j int) bool { return diagnostics[i].Code < diagnostics[j].Code })
+	return diagnostics
+}
+
+// DiagnosticError is an error with a stable code and the details its message is built from
+type DiagnosticError struct {
+	Code    DiagnosticCode
+	Details map[string]interface{}
+	// Err is the underlying error, if any
+	Err error
+}
+
+func (e *DiagnosticError) Error() string {
+	return renderDiagnosticMessage(diagnosticCatalog[e.Code].Message, e.Details)
+}
+
+func (e *DiagnosticError) Unwrap() error {
+	return e.Err
+}
+
+// MarshalJSON renders the error for machines, e.g. {"code": "CYP-0020", "message": "...", "details": {...}}
+func (e *DiagnosticError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Code    DiagnosticCode         `json:"code"`
+		Message string                 `json:"message"`
+		Details map[string]interface{} `json:"details,omitempty"`
+	}{e.Code, e.Error(), e.Details})
+}
+
+// newDiagnosticError builds an error from key-value details, e.g.
+// newDiagnosticError(CodeUnknownKind, nil, "identifier", "foo"). The underlying error, if any, is in the "error" detail.
+func newDiagnosticError(code DiagnosticCode, err error, details ...interface{}) *DiagnosticError {
+	e := &DiagnosticError{Code: code, Details: map[string]interface{}{}, Err: err}
+	for i := 0; i+1 < len(details); i += 2 {
+		e.Details[fmt.Sprint(details[i])] = details[i+1]
+	}
+	if err != nil {
+		e.Details["error"] = err.Error()
+	}
+	return e
+}
+
+// DiagnosticCodeOf returns the code of the first diagnostic in err's chain, or "" if it has none
+func DiagnosticCodeOf(err error) DiagnosticCode {
+	var diagnostic *DiagnosticError
+	if errors.As(err, &diagnostic) {
+		return diagnostic.Code
+	}
+	return ""
+}
+
+var placeholderRegex = regexp.MustCompile(`\{(\w+)\}`)
+
+func renderDiagnosticMessage(template string, details map[string]interface{}) string {
+	return placeholderRegex.ReplaceAllStringFunc(template, func(placeholder string) string {
+		value, ok := details[placeholder[1:len(placeholder)-1]]
+		if !ok {
+			return placeholder
+		}
+		return fmt.Sprint(value)
+	})
+}
+
+// apiError gives an error returned by the API server the code matching its reason
+func apiError(verb string, gvr schema.GroupVersionResource, err error) error {
+	code := CodeAPIRequestFailed
+	switch {
+	case apierrors.IsForbidden(err), apierrors.IsUnauthorized(err):
+		code = CodeForbidden
+	case apierrors.IsNotFound(err):
+		code = CodeNotFound
+	case apierrors.IsConflict(err), apierrors.IsAlreadyExists(err):
+		code = CodeConflict
+	}
+	return newDiagnosticError(code, err, "verb", verb, "resource", gvr.Resource, "reason", string(apierrors.ReasonForError(err)))
+}
+
+// logDiagnostic logs a warning under its title, with its code and details as attributes
+func logDiagnostic(code DiagnosticCode, err error, details ...interface{}) {
+	args := append([]interface{}{"code", string(code)}, details...)
+	if err != nil {
+		args = append(args, "error", err)
+	}
+	logWarn(diagnosticCatalog[code].Title, args...)
+}
+
+// aggregationError is an error of SUM, its message says which values couldn't be added up
+func aggregationError(err error, format string, args ...interface{}) error {
+	return newDiagnosticError(CodeAggregationFailed, err, "message", fmt.Sprintf(format, args...))
+}
+
+// interruptedError is the error of a query cancelled after applying the given changes
+func interruptedError(err error, applied []string) error {
+	return newDiagnosticError(CodeInterrupted, err, "changes", appliedChanges(applied), "applied", append([]string{}, applied...))
+}
+
+// appliedChanges describes the changes a query applied, e.g. "1 change was applied: deleted pods default/web-1"
+func appliedChanges(applied []string) string {
+	if len(applied) == 1 {
+		return "1 change was applied: " + applied[0]
+	} else if len(applied) > 1 {
+		return fmt.Sprintf("%d changes were applied: %s", len(applied), strings.Join(applied, ", "))
+	}
+	return "no changes were applied"
+}
@@ -0,0 +1,108 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestDiagnosticsCatalog(t *testing.T) {
+	diagnostics := Diagnostics()
+	if len(diagnostics) != len(diagnosticCatalog) {
+		t.Fatalf("expected %d diagnostics, got %d", len(diagnosticCatalog), len(diagnostics))
+	}
+	for i, diagnostic := range diagnostics {
+		if i > 0 && diagnostics[i-1].Code >= diagnostic.Code {
+			t.Errorf("expected diagnostics sorted by code, got %s after %s", diagnostic.Code, diagnostics[i-1].Code)
+		}
+		if !strings.HasPrefix(string(diagnostic.Code), "CYP-") || len(diagnostic.Code) != len("CYP-0000") {
+			t.Errorf("invalid code %q", diagnostic.Code)
+		}
+		if diagnostic.Severity != SeverityError && diagnostic.Severity != SeverityWarning {
+			t.Errorf("%s: invalid severity %q", diagnostic.Code, diagnostic.Severity)
+		}
+		if diagnostic.Title == "" || diagnostic.Message == "" || diagnostic.Explanation == "" {
+			t.Errorf("%s: missing title, message or explanation", diagnostic.Code)
+		}
+	}
+
+	if _, ok := LookupDiagnostic("CYP-9999"); ok {
+		t.Errorf("expected CYP-9999 not to be documented")
+	}
+}
+
+func TestDiagnosticError(t *testing.T) {
+	cause := fmt.Errorf("boom")
+	err := fmt.Errorf("error finding API resource >> %w", newDiagnosticError(CodeContextConfig, cause, "context", "staging"))
+
+	if err.Error() != "error finding API resource >> failed to create config for context staging: boom" {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+	if code := DiagnosticCodeOf(err); code != CodeContextConfig {
+		t.Errorf("DiagnosticCodeOf() = %q, want %q", code, CodeContextConfig)
+	}
+	if DiagnosticCodeOf(cause) != "" {
+		t.Errorf("expected a plain error to have no code")
+	}
+
+	data, err := json.Marshal(newDiagnosticError(CodeUnknownKind, nil, "identifier", "Pdo"))
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	expected := `{"code":"CYP-0020","message":"resource identifier not found: Pdo","details":{"identifier":"Pdo"}}`
+	if string(data) != expected {
+		t.Errorf("expected %s, got %s", expected, data)
+	}
+}
+
+func TestExecuteDiagnosticCodes(t *testing.T) {
+	q := newTestQueryExecutor(t, newTestObject("v1", "Pod", "default", "web-1", nil))
+
+	tests := []struct {
+		query string
+		code  DiagnosticCode
+	}{
+		{`MATCH (p:Pod RETURN p`, CodeParseFailed},
+		{`MATCH (p:Podd) RETURN p`, CodeUnknownKind},
+		{`MATCH (p:Pod) RETURN q.metadata.name`, CodeUnknownReturnNode},
+		{`MATCH (p:Pod) RETURN foo(p)`, CodeUnknownFunction},
+		{`MATCH (p:Pod) DELETE q`, CodeUnknownMutationNode},
+		{`MATCH (p:Pod) SET x.a = 1`, CodeUnknownMutationNode},
+		{`MATCH (p:Pod) SET p.metadata.labels.a = "1", x.a = 1`, CodeUnknownMutationNode},
+	}
+	for _, tt := range tests {
+		ast, err := ParseQuery(tt.query)
+		if err == nil {
+			_, err = q.Execute(ast, "default")
+		}
+		if code := DiagnosticCodeOf(err); code != tt.code {
+			t.Errorf("%s: expected code %s, got %q (%v)", tt.query, tt.code, code, err)
+		}
+	}
+}
+
+func TestAPIErrorCodes(t *testing.T) {
+	q := newTestQueryExecutor(t, newTestObject("v1", "Pod", "default", "web-1", nil))
+	q.DynamicClient.(*dynamicfake.FakeDynamicClient).PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "pods"}, "", fmt.Errorf("no access"))
+	})
+
+	ast, err := ParseQuery(`MATCH (p:Pod) RETURN p`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	_, err = q.Execute(ast, "default")
+	if code := DiagnosticCodeOf(err); code != CodeForbidden {
+		t.Fatalf("expected code %s, got %q (%v)", CodeForbidden, code, err)
+	}
+	if !apierrors.IsForbidden(err) {
+		t.Errorf("expected the API error to stay in the chain, got %v", err)
+	}
+}
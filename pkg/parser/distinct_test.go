@@ -0,0 +1,67 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestParseDistinct(t *testing.T) {
+	expr, err := ParseQuery(`MATCH (p:Pod) RETURN DISTINCT p.metadata.namespace, p.spec.nodeName AS node`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	expected := &ReturnClause{
+		Items:    []*ReturnItem{{JsonPath: "p.metadata.namespace"}, {JsonPath: "p.spec.nodeName", Alias: "node"}},
+		Distinct: true,
+	}
+	if !reflect.DeepEqual(expr.Clauses[1], expected) {
+		t.Errorf("unexpected RETURN clause %+v", expr.Clauses[1])
+	}
+
+	// A node may still be called distinct
+	expr, err = ParseQuery(`MATCH (distinct:Pod) RETURN distinct.metadata.name`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	if c := expr.Clauses[1].(*ReturnClause); c.Distinct || c.Items[0].JsonPath != "distinct.metadata.name" {
+		t.Errorf("unexpected RETURN clause %+v", c)
+	}
+}
+
+func TestReturnDistinct(t *testing.T) {
+	pod := func(name, app string, images ...string) runtime.Object {
+		containers := []interface{}{}
+		for _, image := range images {
+			containers = append(containers, map[string]interface{}{"name": name, "image": image})
+		}
+		return newTestObject("v1", "Pod", "default", name, map[string]interface{}{
+			"metadata": map[string]interface{}{"name": name, "namespace": "default", "labels": map[string]interface{}{"app": app}},
+			"spec":     map[string]interface{}{"containers": containers},
+		})
+	}
+	q := newTestQueryExecutor(t, pod("api-1", "api", "api:2.0", "envoy:1.29"), pod("api-2", "api", "api:2.0", "envoy:1.29"), pod("web-1", "web", "nginx:1.25", "envoy:1.29"))
+
+	result := executeTestQuery(t, q, `MATCH (p:Pod) RETURN DISTINCT p.metadata.labels.app AS app`)
+	expected := []interface{}{map[string]interface{}{"app": "api"}, map[string]interface{}{"app": "web"}}
+	if !reflect.DeepEqual(result.Data["p"], expected) {
+		t.Errorf("expected the distinct apps, got %v", result.Data["p"])
+	}
+
+	result = executeTestQuery(t, q, `MATCH (p:Pod) UNWIND p.spec.containers AS c RETURN DISTINCT c.image`)
+	expected = []interface{}{
+		map[string]interface{}{"c": map[string]interface{}{"image": "api:2.0"}},
+		map[string]interface{}{"c": map[string]interface{}{"image": "envoy:1.29"}},
+		map[string]interface{}{"c": map[string]interface{}{"image": "nginx:1.25"}},
+	}
+	if !reflect.DeepEqual(result.Data[withRowsNode], expected) {
+		t.Errorf("expected the distinct images, got %v", result.Data[withRowsNode])
+	}
+
+	// Without DISTINCT every row is kept, along with the resource's name
+	result = executeTestQuery(t, q, `MATCH (p:Pod) RETURN p.metadata.labels.app AS app`)
+	if rows := result.Data["p"].([]interface{}); len(rows) != 3 || rows[0].(map[string]interface{})["name"] != "api-1" {
+		t.Errorf("expected a row per pod, got %v", rows)
+	}
+}
@@ -0,0 +1,85 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors to test for with errors.Is, e.g. errors.Is(err, parser.ErrKindNotFound). Every error they match is a
+// *DiagnosticError, whose details say more (e.g. the identifier that wasn't found).
+var (
+	// ErrParse matches syntax errors, which wrap a *ParseError with the position of the error
+	ErrParse = errors.New("parse error")
+	// ErrKindNotFound matches identifiers that don't name any API resource
+	ErrKindNotFound = errors.New("kind not found")
+	// ErrAmbiguousKind matches identifiers that name more than one API resource
+	ErrAmbiguousKind = errors.New("ambiguous kind")
+	// ErrForbidden matches requests the API server refused for lack of permissions, and queries whose preflight
+	// found some they lack
+	ErrForbidden = errors.New("forbidden")
+	// ErrInterrupted matches queries cancelled or timed out before they completed, which also match the context's
+	// error
+	ErrInterrupted = errors.New("interrupted")
+)
+
+// diagnosticSentinels maps codes to the error they match
+var diagnosticSentinels = map[DiagnosticCode]error{
+	CodeParseFailed:   ErrParse,
+	CodeUnknownKind:   ErrKindNotFound,
+	CodeAmbiguousKind: ErrAmbiguousKind,
+	CodeForbidden:     ErrForbidden,
+	CodeAccessDenied:  ErrForbidden,
+	CodeInterrupted:   ErrInterrupted,
+	CodeTimedOut:      ErrInterrupted,
+}
+
+// Is lets errors.Is match a diagnostic against the Err sentinel of its code
+func (e *DiagnosticError) Is(target error) bool {
+	return target != nil && diagnosticSentinels[e.Code] == target
+}
+
+// ParseError is a syntax error, found at the token starting at Line and Column (both counted from 1)
+type ParseError struct {
+	Line    int
+	Column  int
+	Message string
+	// Found is the text of the token the parser failed at, empty at the end of the query
+	Found string
+	// Expected are the tokens the parser could have read there, e.g. ')' or RETURN
+	Expected []string
+	// Suggestion says how to fix common mistakes, e.g. a parenthesis left open or a string in single quotes
+	Suggestion string
+}
+
+func (e *ParseError) Error() string {
+	found := "end of query"
+	if e.Found != "" {
+		found = e.Found
+	}
+	return fmt.Sprintf("%s at line %d, column %d: unexpected %s", e.Message, e.Line, e.Column, found)
+}
+
+func newParseError(lexer *Lexer) error {
+	offset := lexer.errPos.Offset
+	parseErr := syntaxError(lexer)
+	parseErr.Expected = expectedTokens(lexer.input, offset)
+	parseErr.Suggestion = suggestFix(lexer.input, offset, parseErr.Found, parseErr.Expected)
+	details := []interface{}{"line", parseErr.Line, "column", parseErr.Column, "found", parseErr.Found}
+	if len(parseErr.Expected) > 0 {
+		details = append(details, "expected", parseErr.Expected)
+	}
+	if parseErr.Suggestion != "" {
+		details = append(details, "suggestion", parseErr.Suggestion)
+	}
+	return newDiagnosticError(CodeParseFailed, parseErr, details...)
+}
+
+// syntaxError is the error of the lexer's failed parse, with the position and the token it failed at only
+func syntaxError(lexer *Lexer) *ParseError {
+	parseErr := &ParseError{Line: lexer.errPos.Line, Column: lexer.errPos.Column, Message: lexer.err,
+		Found: tokenAt(lexer.input, lexer.errPos.Offset)}
+	if parseErr.Message == "" {
+		parseErr.Message = "syntax error"
+	}
+	return parseErr
+}
@@ -0,0 +1,115 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestParseErrorPosition(t *testing.T) {
+	tests := []struct {
+		query    string
+		line     int
+		column   int
+		expected []string
+	}{
+		{"MATCH (p:Pod RETURN p", 1, 14, nil},
+		{"MATCH (p:Pod {name: 'web'}) RETURN p", 1, 21, []string{"a string", "a number"}},
+		{"MATCH (p:Pod)\nRETURN p,", 2, 10, nil},
+	}
+	for _, tt := range tests {
+		_, err := ParseQuery(tt.query)
+		if !errors.Is(err, ErrParse) {
+			t.Fatalf("%q: expected ErrParse, got %v", tt.query, err)
+		}
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Fatalf("%q: expected a *ParseError, got %T", tt.query, err)
+		}
+		if parseErr.Line != tt.line || parseErr.Column != tt.column {
+			t.Errorf("%q: expected line %d, column %d, got line %d, column %d", tt.query, tt.line, tt.column, parseErr.Line, parseErr.Column)
+		}
+		if tt.expected != nil && !slices.Equal(parseErr.Expected, tt.expected) {
+			t.Errorf("%q: expected %v to be expected, got %v", tt.query, tt.expected, parseErr.Expected)
+		}
+	}
+}
+
+func TestParseErrorSuggestion(t *testing.T) {
+	tests := []struct {
+		query      string
+		found      string
+		suggestion string
+	}{
+		{"MATCH (p:Pod RETURN p", "RETURN", "add ')' to close the '(' at line 1, column 7"},
+		{"MATCH (p:Pod", "", "add ')' to close the '(' at line 1, column 7"},
+		{`MATCH (p:Pod {name: "web" RETURN p`, "RETURN", "add '}' to close the '{' at line 1, column 14"},
+		{"MATCH (p:Pod {name: 'web'}) RETURN p", "'web'", `strings are in double quotes, e.g. "web"`},
+		{`MATCH (p:Pod {name: "web}) RETURN p`, `"web}) RETURN p`, `the string isn't closed, end it with "`},
+		{"MATCH (p:Pod) RETRUN p", "RETRUN", "did you mean RETURN?"},
+		{"MATCH (p:Pod) RETURN p,", "", ""},
+	}
+	for _, tt := range tests {
+		_, err := ParseQuery(tt.query)
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Fatalf("%q: expected a *ParseError, got %v", tt.query, err)
+		}
+		if parseErr.Found != tt.found {
+			t.Errorf("%q: expected to find %q, got %q", tt.query, tt.found, parseErr.Found)
+		}
+		if parseErr.Suggestion != tt.suggestion {
+			t.Errorf("%q: expected suggestion %q, got %q", tt.query, tt.suggestion, parseErr.Suggestion)
+		}
+	}
+
+	_, err := ParseQuery("MATCH (p:Pod RETURN p")
+	if err.Error() != "parsing failed: syntax error at line 1, column 14: unexpected RETURN" {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+}
+
+func TestErrorSentinels(t *testing.T) {
+	forbidden := apiError("list", schema.GroupVersionResource{Resource: "secrets"}, apierrors.NewForbidden(schema.GroupResource{Resource: "secrets"}, "", fmt.Errorf("no access")))
+	tests := []struct {
+		err      error
+		sentinel error
+	}{
+		{newDiagnosticError(CodeUnknownKind, nil, "identifier", "Podd"), ErrKindNotFound},
+		{newDiagnosticError(CodeAmbiguousKind, nil, "identifier", "certificate"), ErrAmbiguousKind},
+		{fmt.Errorf("error getting node resources >> %w", forbidden), ErrForbidden},
+	}
+	for _, tt := range tests {
+		if !errors.Is(tt.err, tt.sentinel) {
+			t.Errorf("expected %v to match %v", tt.err, tt.sentinel)
+		}
+		for _, other := range []error{ErrParse, ErrKindNotFound, ErrAmbiguousKind, ErrForbidden} {
+			if other != tt.sentinel && errors.Is(tt.err, other) {
+				t.Errorf("expected %v not to match %v", tt.err, other)
+			}
+		}
+	}
+}
+
+func TestCheckSyntax(t *testing.T) {
+	if err := CheckSyntax("MATCH (p:Pod) RETURN p"); err != nil {
+		t.Errorf("expected no syntax error, got %v", err)
+	}
+	err := CheckSyntax("MATCH (p:Pod {name: 'web'}) RETURN p")
+	if err == nil {
+		t.Fatal("expected a syntax error")
+	}
+	if err.Line != 1 || err.Column != 21 || err.Found != "'web'" {
+		t.Errorf("expected 'web' at line 1, column 21, got %q at line %d, column %d", err.Found, err.Line, err.Column)
+	}
+	if err.Expected != nil || err.Suggestion != "" {
+		t.Errorf("expected neither expected tokens nor a suggestion, got %v and %q", err.Expected, err.Suggestion)
+	}
+	if err := CheckSyntax("MATCH (p:Pod) /* RETURN p"); err == nil || err.Found != "/*" {
+		t.Errorf("expected the unclosed comment, got %v", err)
+	}
+}
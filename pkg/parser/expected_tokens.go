@@ -0,0 +1,82 @@
+package parser
+
+import (
+	"slices"
+	"unicode"
+)
+
+// The tokens a syntax error says were expected are found by trying them: the query up to the token the parser
+// failed at is parsed again followed by each candidate, and those the parser reads past are the expected ones. The
+// lexer depends on what came before a token, e.g. whether it's in the properties of a node or in a RETURN clause,
+// which this follows as it goes through the same lexer.
+
+// tokenCandidates are the tokens tried, by the name syntax errors give them and their text
+var tokenCandidates = []struct{ name, text string }{
+	{"')'", ")"},
+	{"'('", "("},
+	{"':'", ":"},
+	{"','", ","},
+	{"'{'", "{"},
+	{"'}'", "}"},
+	{"']'", "]"},
+	{"'='", "="},
+	{"'->'", "->"},
+	{"'<-'", "<-("},
+	{"'--'", "--"},
+	{"MATCH", "MATCH"},
+	{"WHERE", "WHERE"},
+	{"SET", "SET"},
+	{"DELETE", "DELETE"},
+	{"CREATE", "CREATE"},
+	{"MERGE", "MERGE"},
+	{"WITH", "WITH"},
+	{"UNWIND", "UNWIND"},
+	{"RETURN", "RETURN"},
+	{"AS", "AS"},
+	{"IN", "IN"},
+	{"NOT", "NOT"},
+	{"CONTAINS", "CONTAINS"},
+	{"ORDER BY", "ORDER BY"},
+	{"UNION", "UNION"},
+	{"a name", "x"},
+	{"a string", `"x"`},
+	{"a number", "1"},
+}
+
+// expectedTokens are the names of the tokens the parser could have read at offset of the query instead of the one
+// it failed at. The parser's state is global, so it's only called while parseMutex is held.
+func expectedTokens(query string, offset int) []string {
+	if offset < 0 || offset > len(query) {
+		return nil
+	}
+	prefix := query[:offset]
+	var expected []string
+	name := false
+	for _, candidate := range tokenCandidates {
+		separator := ""
+		if prefix != "" && !unicode.IsSpace(rune(prefix[len(prefix)-1])) && isWordStart(candidate.text) {
+			separator = " "
+		}
+		start := len(prefix) + len(separator)
+		lexer := NewLexer(prefix + separator + candidate.text)
+		// The candidate was read if the parser went on to fail past it, at the end of the input
+		if yyParse(lexer) == 0 || lexer.errPos.Offset > start {
+			expected = append(expected, candidate.name)
+			name = name || candidate.text == "x"
+		}
+	}
+	// Where a name is expected, e.g. in a RETURN item, keywords are read as names too
+	if name {
+		expected = slices.DeleteFunc(expected, isKeyword)
+	}
+	return expected
+}
+
+// isKeyword tells whether a token name is a keyword, e.g. RETURN
+func isKeyword(name string) bool {
+	return unicode.IsUpper(rune(name[0]))
+}
+
+func isWordStart(text string) bool {
+	return text != "" && (unicode.IsLetter(rune(text[0])) || unicode.IsDigit(rune(text[0])) || text[0] == '"')
+}
@@ -0,0 +1,551 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// QueryPlan describes how a query would run, as reported by EXPLAIN. Nothing is listed or changed
+// while building it, except for API discovery.
+type QueryPlan struct {
+	Nodes         []NodePlan         `json:"nodes"`
+	Relationships []RelationshipPlan `json:"relationships,omitempty"`
+	Mutations     []string           `json:"mutations,omitempty"`
+	// Projections are the values RETURN projects
+	Projections []string `json:"projections,omitempty"`
+	Cost        PlanCost `json:"cost"`
+	// Union holds the plans of the queries UNION combines with this one
+	Union []*QueryPlan `json:"union,omitempty"`
+}
+
+// NodePlan describes how the resources of a node are fetched and filtered.
+type NodePlan struct {
+	Node string `json:"node"`
+	Kind string `json:"kind"`
+	// APICalls is empty when the node is served from the result cache
+	APICalls []string `json:"apiCalls"`
+	Cached   bool     `json:"cached"`
+	// ListCache tells whether the resources would be reused from an earlier query, when CacheTTL is set
+	ListCache         string   `json:"listCache,omitempty"`
+	ServerSideFilters []string `json:"serverSideFilters,omitempty"`
+	ClientSideFilters []string `json:"clientSideFilters,omitempty"`
+	// IndexLookups are the client-side filters looked up in the index of the cached resources instead
+	IndexLookups []string `json:"indexLookups,omitempty"`
+	// Index describes the index of the cached resources once it's built
+	Index *IndexStats `json:"index,omitempty"`
+	// JoinedFrom is the node listed before this one whose resources narrow its list call, with the JoinSelectors
+	JoinedFrom    string   `json:"joinedFrom,omitempty"`
+	JoinSelectors []string `json:"joinSelectors,omitempty"`
+	// EstimatedCardinality is only known for cached nodes, and is null otherwise
+	EstimatedCardinality *int `json:"estimatedCardinality"`
+}
+
+// PlanCost estimates the work of a query: the API calls it makes, and how many pairs of resources its nested loop
+// joins compare at most, which is only known when the cardinality of every joined node is.
+type PlanCost struct {
+	APICalls    int  `json:"apiCalls"`
+	Comparisons *int `json:"comparisons"`
+}
+
+// RelationshipPlan describes how the resources of two nodes are joined.
+type RelationshipPlan struct {
+	Left         string   `json:"left"`
+	Right        string   `json:"right"`
+	Relationship string   `json:"relationship"`
+	Strategy     string   `json:"strategy"`
+	Criteria     []string `json:"criteria,omitempty"`
+	// Optional relationships, of OPTIONAL MATCH clauses, don't filter out the nodes matched before them
+	Optional bool `json:"optional,omitempty"`
+}
+
+// Join strategies reported for relationships
+const (
+	JoinStrategyNamespace  = "namespace lookup"
+	JoinStrategyNestedLoop = "nested loop"
+)
+
+var filterOperatorSymbols = map[string]string{
+	"EQUALS":              "=",
+	"NOT_EQUALS":          "!=",
+	"GREATER_THAN":        ">",
+	"LESS_THAN":           "<",
+	"GREATER_THAN_EQUALS": ">=",
+	"LESS_THAN_EQUALS":    "<=",
+	"REGEX":               "=~",
+	"CONTAINS":            "CONTAINS",
+	"STARTS_WITH":         "STARTS WITH",
+	"ENDS_WITH":           "ENDS WITH",
+}
+
+// explain builds the plan for an EXPLAIN query
+func (q *QueryExecutor) explain(ast *Expression) (*QueryPlan, error) {
+	plan := &QueryPlan{Nodes: []NodePlan{}}
+	matchedNodes := map[string]string{}
+
+	for _, clause := range ast.Clauses {
+		switch c := clause.(type) {
+		case *MatchClause:
+			start, steps := q.planJoins(c)
+			joinedBy := make(map[*NodePattern]joinStep, len(steps))
+			for _, step := range steps {
+				joinedBy[step.to] = step
+			}
+			for _, node := range joinOrder(c.Nodes, start, steps) {
+				if kind, ok := matchedNodes[node.ResourceProperties.Name]; ok {
+					// Bound nodes aren't listed again, like processBoundMatch they take the kind they were matched with
+					if node.ResourceProperties.Kind == "" {
+						node.ResourceProperties.Kind = kind
+					}
+					continue
+				}
+				if node.ResourceProperties.Kind == "" {
+					continue
+				}
+				nodePlan, err := q.explainNode(node, c.ExtraFilters)
+				if err != nil {
+					return nil, err
+				}
+				if step, ok := joinedBy[node]; ok {
+					nodePlan.JoinedFrom = step.from.ResourceProperties.Name
+					for _, pushdown := range step.pushdowns {
+						nodePlan.JoinSelectors = append(nodePlan.JoinSelectors, pushdown.explain(nodePlan.JoinedFrom))
+					}
+				}
+				plan.Nodes = append(plan.Nodes, nodePlan)
+				matchedNodes[node.ResourceProperties.Name] = node.ResourceProperties.Kind
+			}
+			for _, rel := range c.Relationships {
+				relationshipPlan, err := q.explainRelationship(rel)
+				if err != nil {
+					return nil, err
+				}
+				relationshipPlan.Optional = c.Optional
+				plan.Relationships = append(plan.Relationships, relationshipPlan)
+			}
+
+		case *SetClause:
+			patchType, err := setPatchType(c)
+			if err != nil {
+				return nil, err
+			}
+			for _, kvp := range c.KeyValuePairs {
+				nodeId := strings.Split(kvp.Key, ".")[0]
+				change := fmt.Sprintf("setting %s = %v", kvp.Key, kvp.Value)
+				if kvp.Value == nil {
+					change = "removing " + kvp.Key
+				}
+				target := fmt.Sprintf("each %s (%s)", nodeId, matchedNodes[nodeId])
+				if c.Status {
+					target = "the status of " + target
+				}
+				if patchType == applyPatchType {
+					plan.Mutations = append(plan.Mutations, fmt.Sprintf("APPLY %s as %s %s", target, FieldManager, change))
+					continue
+				}
+				plan.Mutations = append(plan.Mutations, fmt.Sprintf("PATCH %s with a %s patch %s", target, patchType, change))
+			}
+
+		case *ReturnClause:
+			for _, item := range c.Items {
+				projection := returnItemLabel(&ReturnItem{JsonPath: item.JsonPath, Aggregate: item.Aggregate, Function: item.Function, Args: item.Args})
+				if item.Alias != "" {
+					projection += " AS " + item.Alias
+				}
+				if c.Distinct {
+					projection = "DISTINCT " + projection
+				}
+				plan.Projections = append(plan.Projections, projection)
+			}
+			if len(c.OrderBy) > 0 {
+				plan.Projections = append(plan.Projections, "ORDER BY "+formatOrderItems(c.OrderBy))
+			}
+
+		case *DeleteClause:
+			for _, nodeId := range c.NodeIds {
+				plan.Mutations = append(plan.Mutations, fmt.Sprintf("DELETE each %s (%s)", nodeId, matchedNodes[nodeId]))
+			}
+
+		case *OperationClause:
+			for _, nodeId := range c.NodeIds {
+				operation := fmt.Sprintf("%s each %s (%s)", strings.ToUpper(c.Operation), nodeId, matchedNodes[nodeId])
+				if c.Operation == "scale" {
+					operation += fmt.Sprintf(" to %d replicas", c.Replicas)
+				}
+				plan.Mutations = append(plan.Mutations, operation)
+			}
+
+		case *MergeClause:
+			nodePlan, err := q.explainNode(c.Node, nil)
+			if err != nil {
+				return nil, err
+			}
+			plan.Nodes = append(plan.Nodes, nodePlan)
+			matchedNodes[c.Node.ResourceProperties.Name] = c.Node.ResourceProperties.Kind
+			plan.Mutations = append(plan.Mutations, fmt.Sprintf("CREATE %s (%s) if none matches%s", c.Node.ResourceProperties.Name, c.Node.ResourceProperties.Kind, serverSideApplyLabel()))
+
+		case *CreateClause:
+			for _, node := range c.Nodes {
+				if _, ok := matchedNodes[node.ResourceProperties.Name]; ok || node.ResourceProperties.Kind == "" {
+					continue
+				}
+				plan.Mutations = append(plan.Mutations, fmt.Sprintf("CREATE %s (%s)%s", node.ResourceProperties.Name, node.ResourceProperties.Kind, serverSideApplyLabel()))
+			}
+		}
+	}
+	plan.Cost = plan.estimateCost()
+	if ast.Union != nil {
+		for _, query := range ast.Union.Queries {
+			queryPlan, err := q.explain(query)
+			if err != nil {
+				return nil, err
+			}
+			plan.Union = append(plan.Union, queryPlan)
+		}
+	}
+	return plan, nil
+}
+
+func (q *QueryExecutor) explainNode(n *NodePattern, extraFilters []*KeyValuePair) (NodePlan, error) {
+	nodePlan := NodePlan{
+		Node:     n.ResourceProperties.Name,
+		Kind:     n.ResourceProperties.Kind,
+		APICalls: []string{},
+	}
+
+	// Work on a copy, like getNodeResources the namespace property becomes the list's namespace
+	namespace := q.namespace
+	node := &NodePattern{ResourceProperties: &ResourceProperties{
+		Name: n.ResourceProperties.Name,
+		Kind: n.ResourceProperties.Kind,
+	}}
+	if n.ResourceProperties.Properties != nil {
+		node.ResourceProperties.Properties = &Properties{}
+		for _, prop := range n.ResourceProperties.Properties.PropertyList {
+			if isNamespaceProperty(prop) {
+				namespace = fmt.Sprint(prop.Value)
+				continue
+			}
+			node.ResourceProperties.Properties.PropertyList = append(node.ResourceProperties.Properties.PropertyList, prop)
+		}
+	}
+
+	fieldSelector, labelSelector, err := q.nodeSelectors(node)
+	if err != nil {
+		return nodePlan, err
+	}
+	if fieldSelector != "" {
+		nodePlan.ServerSideFilters = append(nodePlan.ServerSideFilters, "fieldSelector: "+fieldSelector)
+	}
+	if labelSelector != "" {
+		nodePlan.ServerSideFilters = append(nodePlan.ServerSideFilters, "labelSelector: "+strings.ReplaceAll(labelSelector, "\"", ""))
+	}
+
+	for _, filter := range extraFilters {
+		if filter.Key != nodePlan.Node && !strings.HasPrefix(filter.Key, nodePlan.Node+".") {
+			continue
+		}
+		subject := filter.Key
+		if filter.Function != "" {
+			subject = functionCallLabel(filter.Function, filter.Key, filter.Args)
+		}
+		description := fmt.Sprintf("%s %s %v", subject, filterOperatorSymbols[filter.Operator], filter.Value)
+		if _, ok := indexedKey(nodePlan.Node, filter); ok {
+			nodePlan.IndexLookups = append(nodePlan.IndexLookups, description)
+			continue
+		}
+		nodePlan.ClientSideFilters = append(nodePlan.ClientSideFilters, description)
+	}
+
+	originalNamespace := q.namespace
+	q.namespace = namespace
+	cacheKey := q.resourcePropertyName(n)
+	q.namespace = originalNamespace
+	if cached, ok := q.resultCache[cacheKey].([]map[string]interface{}); ok {
+		cardinality := len(cached)
+		nodePlan.Cached = true
+		nodePlan.EstimatedCardinality = &cardinality
+		if index := q.resultIndexes[cacheKey]; index != nil {
+			nodePlan.Index = index.stats()
+		}
+		return nodePlan, nil
+	}
+	status, cardinality, hit := q.explainCache(namespace, n.ResourceProperties.Kind, fieldSelector, labelSelector)
+	nodePlan.ListCache = status
+	if hit {
+		nodePlan.Cached = true
+		nodePlan.EstimatedCardinality = &cardinality
+		return nodePlan, nil
+	}
+
+	targets, err := listTargetsForKind(q.Clientset, n.ResourceProperties.Kind, namespace)
+	if err != nil {
+		return nodePlan, err
+	}
+	scope := "in all namespaces"
+	if namespace != "" {
+		scope = "in namespace " + namespace
+	}
+	name, named := namedResource(fieldSelector, labelSelector)
+	for _, target := range targets {
+		if named && n.ResourceProperties.Kind != "*" && target.gets(namespace) {
+			nodePlan.APICalls = append(nodePlan.APICalls, fmt.Sprintf("GET %s %s %s", gvrColumnValue(target.gvr), name, scope))
+			continue
+		}
+		nodePlan.APICalls = append(nodePlan.APICalls, fmt.Sprintf("LIST %s %s", gvrColumnValue(target.gvr), scope))
+	}
+	return nodePlan, nil
+}
+
+func (q *QueryExecutor) explainRelationship(rel *Relationship) (RelationshipPlan, error) {
+	if rel.Hops != nil {
+		return q.explainVariableLengthRelationship(rel)
+	}
+	if isKindlessRelationship(rel) {
+		return q.explainKindlessRelationship(rel)
+	}
+	rule, _, _, err := q.relationshipRule(rel)
+	if err != nil {
+		return RelationshipPlan{}, err
+	}
+
+	relationshipPlan := RelationshipPlan{
+		Left:         rel.LeftNode.ResourceProperties.Name,
+		Right:        rel.RightNode.ResourceProperties.Name,
+		Relationship: string(rule.Relationship),
+		Strategy:     JoinStrategyNestedLoop,
+	}
+	if rule.Relationship == NamespaceHasResource {
+		relationshipPlan.Strategy = JoinStrategyNamespace
+	}
+	if rule.analyzer != "" {
+		relationshipPlan.Criteria = append(relationshipPlan.Criteria, analyzerDescription(rule.analyzer))
+	}
+	for i, criterion := range rule.MatchCriteria {
+		fieldA := rule.KindA + "." + strings.TrimPrefix(criterion.FieldA, "$.")
+		fieldB := rule.KindB + "." + strings.TrimPrefix(criterion.FieldB, "$.")
+		criteria := fmt.Sprintf("%s = %s", fieldA, fieldB)
+		if criterion.ComparisonType == ContainsAll {
+			criteria = fmt.Sprintf("%s contains all of %s", fieldA, fieldB)
+		}
+		if rule.MatchAny && i > 0 {
+			criteria = "or " + criteria
+		}
+		relationshipPlan.Criteria = append(relationshipPlan.Criteria, criteria)
+	}
+	return relationshipPlan, nil
+}
+
+// estimateCost adds up the API calls of the nodes of a plan, and the pairs of resources its joins compare
+func (p *QueryPlan) estimateCost() PlanCost {
+	cost := PlanCost{}
+	cardinalities := map[string]*int{}
+	for _, node := range p.Nodes {
+		cost.APICalls += len(node.APICalls)
+		cardinalities[node.Node] = node.EstimatedCardinality
+	}
+	comparisons := 0
+	for _, relationship := range p.Relationships {
+		if relationship.Strategy != JoinStrategyNestedLoop {
+			continue
+		}
+		left, right := cardinalities[relationship.Left], cardinalities[relationship.Right]
+		if left == nil || right == nil {
+			return cost
+		}
+		comparisons += *left * *right
+	}
+	cost.Comparisons = &comparisons
+	return cost
+}
+
+// Tree renders a plan as an indented tree: the scan of each node with its API calls and filters, the joins, the
+// mutations and the projections, under the estimated cost of the query.
+func (p *QueryPlan) Tree() string {
+	var b strings.Builder
+	p.treeNode().write(&b, "", "")
+	return b.String()
+}
+
+type planTreeNode struct {
+	label    string
+	children []*planTreeNode
+}
+
+func (n *planTreeNode) add(label string, children ...string) *planTreeNode {
+	child := &planTreeNode{label: label}
+	for _, grandchild := range children {
+		child.children = append(child.children, &planTreeNode{label: grandchild})
+	}
+	n.children = append(n.children, child)
+	return child
+}
+
+func (n *planTreeNode) write(b *strings.Builder, prefix, childPrefix string) {
+	b.WriteString(prefix + n.label + "\n")
+	for i, child := range n.children {
+		if i == len(n.children)-1 {
+			child.write(b, childPrefix+"└── ", childPrefix+"    ")
+		} else {
+			child.write(b, childPrefix+"├── ", childPrefix+"│   ")
+		}
+	}
+}
+
+func (p *QueryPlan) treeNode() *planTreeNode {
+	root := &planTreeNode{label: "Query (" + p.Cost.String() + ")"}
+	for _, node := range p.Nodes {
+		scan := root.add(node.scanLabel())
+		for _, call := range node.APICalls {
+			scan.add(call)
+		}
+		for _, filter := range node.ServerSideFilters {
+			scan.add("push down " + filter)
+		}
+		for _, selector := range node.JoinSelectors {
+			scan.add("push down " + selector)
+		}
+		for _, filter := range node.IndexLookups {
+			scan.add("index lookup " + filter)
+		}
+		for _, filter := range node.ClientSideFilters {
+			scan.add("filter " + filter)
+		}
+	}
+	for _, relationship := range p.Relationships {
+		root.add(relationship.joinLabel(), relationship.Criteria...)
+	}
+	if len(p.Mutations) > 0 {
+		root.add("Mutate", p.Mutations...)
+	}
+	if len(p.Projections) > 0 {
+		root.add("Project", p.Projections...)
+	}
+	if len(p.Union) > 0 {
+		union := root.add("Union")
+		for _, query := range p.Union {
+			union.children = append(union.children, query.treeNode())
+		}
+	}
+	return root
+}
+
+func (n NodePlan) scanLabel() string {
+	label := fmt.Sprintf("Scan %s (%s)", n.Node, n.Kind)
+	switch {
+	case n.ListCache != "":
+		label += ", cache " + n.ListCache
+	case n.Cached:
+		label += " from the result cache"
+	}
+	if n.JoinedFrom != "" {
+		label += ", narrowed by " + n.JoinedFrom
+	}
+	if n.EstimatedCardinality != nil {
+		label += fmt.Sprintf(", ~%d resources", *n.EstimatedCardinality)
+	}
+	if n.Index != nil {
+		label += fmt.Sprintf(", index of %d keys", n.Index.Keys)
+	}
+	return label
+}
+
+func (r RelationshipPlan) joinLabel() string {
+	label := "Join"
+	if r.Optional {
+		label = "Optional join"
+	}
+	return fmt.Sprintf("%s %s -> %s (%s), %s", label, r.Left, r.Right, r.Relationship, r.Strategy)
+}
+
+func (c PlanCost) String() string {
+	calls := fmt.Sprintf("%d API calls", c.APICalls)
+	if c.APICalls == 1 {
+		calls = "1 API call"
+	}
+	if c.Comparisons == nil {
+		return calls + ", comparisons unknown"
+	}
+	return fmt.Sprintf("%s, at most %d comparisons", calls, *c.Comparisons)
+}
+
+// DOT renders a plan as a Graphviz graph, e.g. to render it with dot -Tsvg: the scans of the nodes flow into the
+// joins relating them, and the joins and the scans that aren't joined into the mutations and projections.
+func (p *QueryPlan) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph plan {\n  rankdir=BT;\n  node [shape=box, fontname=\"Helvetica\"];\n")
+	p.writeDOT(&b, "q")
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// writeDOT writes the nodes and edges of a plan, their IDs prefixed with prefix, and returns the ID of its output
+func (p *QueryPlan) writeDOT(b *strings.Builder, prefix string) string {
+	output := prefix + "_output"
+	outputLines := []string{"Query", p.Cost.String()}
+	if len(p.Mutations) > 0 {
+		outputLines = append(outputLines, p.Mutations...)
+	}
+	if len(p.Projections) > 0 {
+		outputLines = append(outputLines, "RETURN "+strings.Join(p.Projections, ", "))
+	}
+	fmt.Fprintf(b, "  %s [shape=oval, label=%s];\n", output, dotLabel(outputLines))
+
+	joined := map[string]bool{}
+	scanned := map[string]bool{}
+	for _, node := range p.Nodes {
+		scanned[node.Node] = true
+		lines := append([]string{node.scanLabel()}, node.APICalls...)
+		for _, filter := range node.ServerSideFilters {
+			lines = append(lines, "push down "+filter)
+		}
+		for _, selector := range node.JoinSelectors {
+			lines = append(lines, "push down "+selector)
+		}
+		for _, filter := range node.IndexLookups {
+			lines = append(lines, "index lookup "+filter)
+		}
+		for _, filter := range node.ClientSideFilters {
+			lines = append(lines, "filter "+filter)
+		}
+		fmt.Fprintf(b, "  %s_%s [label=%s];\n", prefix, node.Node, dotLabel(lines))
+	}
+	for i, relationship := range p.Relationships {
+		join := fmt.Sprintf("%s_join%d", prefix, i)
+		style := ""
+		if relationship.Optional {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(b, "  %s [shape=diamond%s, label=%s];\n", join, style, dotLabel(append([]string{relationship.joinLabel()}, relationship.Criteria...)))
+		for _, node := range []string{relationship.Left, relationship.Right} {
+			if !scanned[node] {
+				// Nodes without a kind are found through the relationship rather than scanned
+				fmt.Fprintf(b, "  %s_%s [shape=plaintext, label=%s];\n", prefix, node, dotLabel([]string{node}))
+				scanned[node] = true
+			}
+			fmt.Fprintf(b, "  %s_%s -> %s;\n", prefix, node, join)
+			joined[node] = true
+		}
+		fmt.Fprintf(b, "  %s -> %s;\n", join, output)
+	}
+	for _, node := range p.Nodes {
+		if !joined[node.Node] {
+			fmt.Fprintf(b, "  %s_%s -> %s;\n", prefix, node.Node, output)
+		}
+	}
+	for i, query := range p.Union {
+		fmt.Fprintf(b, "  subgraph cluster_%s_union%d {\n  label=\"UNION\";\n", prefix, i)
+		unionOutput := query.writeDOT(b, fmt.Sprintf("%s_union%d", prefix, i))
+		b.WriteString("  }\n")
+		fmt.Fprintf(b, "  %s -> %s [style=dotted];\n", unionOutput, output)
+	}
+	return output
+}
+
+// dotLabel quotes the lines of a DOT label, left-aligned
+func dotLabel(lines []string) string {
+	escaped := make([]string, len(lines))
+	for i, line := range lines {
+		escaped[i] = strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(line) + `\l`
+	}
+	return `"` + strings.Join(escaped, "") + `"`
+}
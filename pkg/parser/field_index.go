@@ -0,0 +1,177 @@
+package parser
+
+import (
+	"slices"
+	"strings"
+)
+
+// The resources listed for a node pattern are kept in the result cache while a query runs, and the other node
+// patterns of the same kind and namespace are served from it. The first WHERE predicate comparing one of the
+// IndexedFields to a string builds an index of the cached resources by the values of those fields, so that it and
+// the later predicates on indexed fields find their resources with a lookup instead of testing each of them. A field
+// whose value is a map, such as metadata.labels, is indexed by each of its keys, e.g. p.metadata.labels.app.
+
+// IndexedFields are the fields of cached resources that WHERE equality predicates are looked up in an index for,
+// none disables the indexes
+var IndexedFields = []string{"metadata.labels", "status.phase", "spec.nodeName"}
+
+// fieldIndex indexes a cached list of resources by the values of the IndexedFields
+type fieldIndex struct {
+	fields []string
+	// positions are the positions of the resources in the list by indexed key, e.g. metadata.labels.app, and value
+	positions map[string]map[string][]int
+	// unindexed are the positions of the resources whose value isn't a string by indexed key, they're tested by
+	// the predicate as they would be without an index
+	unindexed map[string][]int
+	// lookups counts the predicates resolved with the index
+	lookups int
+}
+
+// IndexStats describes the index of the cached resources of a node, as reported by EXPLAIN
+type IndexStats struct {
+	Fields []string `json:"fields"`
+	// Keys is the number of indexed keys, each key of a map field being one
+	Keys int `json:"keys"`
+	// Lookups is the number of predicates resolved with the index so far
+	Lookups int `json:"lookups"`
+}
+
+func newFieldIndex(fields []string, resources []map[string]interface{}) *fieldIndex {
+	index := &fieldIndex{
+		fields:    slices.Clone(fields),
+		positions: make(map[string]map[string][]int),
+		unindexed: make(map[string][]int),
+	}
+	for i, resource := range resources {
+		for _, field := range index.fields {
+			value, ok := nestedFieldValue(resource, field)
+			if !ok {
+				continue
+			}
+			if entries, isMap := value.(map[string]interface{}); isMap {
+				for key, entry := range entries {
+					index.add(field+"."+key, entry, i)
+				}
+				continue
+			}
+			index.add(field, value, i)
+		}
+	}
+	return index
+}
+
+func (index *fieldIndex) add(key string, value interface{}, position int) {
+	s, ok := value.(string)
+	if !ok {
+		index.unindexed[key] = append(index.unindexed[key], position)
+		return
+	}
+	if index.positions[key] == nil {
+		index.positions[key] = make(map[string][]int)
+	}
+	index.positions[key][s] = append(index.positions[key][s], position)
+}
+
+// lookup returns the positions of the resources that may have value at key, in order
+func (index *fieldIndex) lookup(key, value string) []int {
+	index.lookups++
+	positions := slices.Concat(index.positions[key][value], index.unindexed[key])
+	slices.Sort(positions)
+	return positions
+}
+
+func (index *fieldIndex) stats() *IndexStats {
+	return &IndexStats{Fields: index.fields, Keys: len(index.positions) + len(index.unindexed), Lookups: index.lookups}
+}
+
+// nestedFieldValue reads the value of a dotted field of a resource
+func nestedFieldValue(resource map[string]interface{}, field string) (interface{}, bool) {
+	var value interface{} = resource
+	for _, part := range strings.Split(field, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[part]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// indexedKey returns the indexed key a WHERE predicate of the node named node compares, if it can be looked up in an
+// index. Only equality with a string can, and keys that aren't plain names are left to the JSONPath of the predicate.
+func indexedKey(node string, filter *KeyValuePair) (string, bool) {
+	if filter.Operator != "EQUALS" || filter.Function != "" {
+		return "", false
+	}
+	if _, ok := filter.Value.(string); !ok {
+		return "", false
+	}
+	name, path, ok := strings.Cut(filter.Key, ".")
+	if !ok || name != node {
+		return "", false
+	}
+	for _, field := range IndexedFields {
+		if path == field {
+			return field, true
+		}
+		if key, ok := strings.CutPrefix(path, field+"."); ok && key != "" && !strings.ContainsAny(key, `.[]*\"'()@$?`) {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// lookupIndexedFilters narrows the resources of a node, those of its cached list, with the predicates on indexed
+// fields, and returns the other predicates
+func (q *QueryExecutor) lookupIndexedFilters(n *NodePattern, filters []*KeyValuePair) []*KeyValuePair {
+	var remaining []*KeyValuePair
+	var lookups []*KeyValuePair
+	for _, filter := range filters {
+		if _, ok := indexedKey(n.ResourceProperties.Name, filter); ok {
+			lookups = append(lookups, filter)
+		} else {
+			remaining = append(remaining, filter)
+		}
+	}
+	cacheKey := q.resourcePropertyName(n)
+	cached, ok := q.resultCache[cacheKey].([]map[string]interface{})
+	if len(lookups) == 0 || !ok {
+		return filters
+	}
+
+	index := q.resultIndexes[cacheKey]
+	if index == nil || !slices.Equal(index.fields, IndexedFields) {
+		index = newFieldIndex(IndexedFields, cached)
+		q.resultIndexes[cacheKey] = index
+		logDebug("Indexed cached resources", "resources", cacheKey, "count", len(cached), "fields", IndexedFields)
+	}
+	var positions []int
+	for i, filter := range lookups {
+		key, _ := indexedKey(n.ResourceProperties.Name, filter)
+		found := index.lookup(key, filter.Value.(string))
+		if i == 0 {
+			positions = found
+		} else {
+			positions = slices.DeleteFunc(positions, func(position int) bool {
+				_, ok := slices.BinarySearch(found, position)
+				return !ok
+			})
+		}
+	}
+
+	// The predicates still test the resources they couldn't be looked up for, e.g. those whose value isn't a string
+	var selected []map[string]interface{}
+	for _, position := range positions {
+		selected = append(selected, cached[position])
+	}
+	q.resultMap[n.ResourceProperties.Name] = selected
+	for _, filter := range lookups {
+		key, _ := indexedKey(n.ResourceProperties.Name, filter)
+		if len(index.unindexed[key]) > 0 {
+			remaining = append(remaining, filter)
+		}
+	}
+	return remaining
+}
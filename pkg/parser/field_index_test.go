@@ -0,0 +1,90 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestFieldIndexLookups(t *testing.T) {
+	pod := func(name, app, phase, nodeName string) *unstructured.Unstructured {
+		object := newTestObject("v1", "Pod", "default", name, map[string]interface{}{
+			"spec":   map[string]interface{}{"nodeName": nodeName},
+			"status": map[string]interface{}{"phase": phase},
+		})
+		object.SetLabels(map[string]string{"app": app})
+		return object
+	}
+	q := newTestQueryExecutor(t,
+		pod("web-1", "web", "Running", "node-a"),
+		pod("web-2", "web", "Pending", "node-b"),
+		pod("web-3", "web", "Running", "node-a"),
+		pod("api-1", "api", "Running", "node-a"),
+	)
+	names := func(resources interface{}) []string {
+		list := []string{}
+		for _, resource := range resources.([]map[string]interface{}) {
+			list = append(list, resource["metadata"].(map[string]interface{})["name"].(string))
+		}
+		return list
+	}
+
+	ast, err := ParseQuery(`MATCH (p:Pod) WHERE p.metadata.labels.app = "web", p.spec.nodeName = "node-a", p.metadata.name != "web-3" RETURN p`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	match := ast.Clauses[0].(*MatchClause)
+	q.prepareQuery("default")
+	if err := getNodeResources(match.Nodes[0], q, match.ExtraFilters); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(q.resultMap["p"]); !reflect.DeepEqual(got, []string{"web-1"}) {
+		t.Errorf("expected the indexed and tested predicates to match web-1, got %v", got)
+	}
+	cacheKey := q.resourcePropertyName(match.Nodes[0])
+	if got := names(q.resultCache[cacheKey]); len(got) != 4 {
+		t.Errorf("expected the cached resources to be left as listed, got %v", got)
+	}
+	index := q.resultIndexes[cacheKey]
+	if index == nil || index.lookups != 2 {
+		t.Fatalf("expected both equality predicates to be looked up in the index, got %+v", index)
+	}
+
+	// Other nodes served from the same cached resources reuse the index
+	ast, _ = ParseQuery(`MATCH (o:Pod) WHERE o.status.phase = "Pending" RETURN o`)
+	match = ast.Clauses[0].(*MatchClause)
+	if err := getNodeResources(match.Nodes[0], q, match.ExtraFilters); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(q.resultMap["o"]); !reflect.DeepEqual(got, []string{"web-2"}) || q.resultIndexes[cacheKey] != index || index.lookups != 3 {
+		t.Errorf("expected the pending pod through the same index, got %v", got)
+	}
+
+	result := executeTestQuery(t, q, `EXPLAIN MATCH (p:Pod) WHERE p.status.phase = "Running", p.metadata.name =~ "web-.*" RETURN p`)
+	nodePlan := result.Data["plan"].(*QueryPlan).Nodes[0]
+	if !reflect.DeepEqual(nodePlan.IndexLookups, []string{`p.status.phase = Running`}) || !reflect.DeepEqual(nodePlan.ClientSideFilters, []string{`p.metadata.name =~ web-.*`}) {
+		t.Errorf("expected the phase to be looked up and the name to be tested, got %+v", nodePlan)
+	}
+	if nodePlan.Index == nil || nodePlan.Index.Keys != 3 || nodePlan.Index.Lookups != 3 {
+		t.Errorf("expected the stats of the index, got %+v", nodePlan.Index)
+	}
+}
+
+func TestFieldIndexUnindexedValues(t *testing.T) {
+	original := IndexedFields
+	defer func() { IndexedFields = original }()
+	IndexedFields = []string{"spec.priority"}
+
+	q := newTestQueryExecutor(t,
+		newTestObject("v1", "Pod", "default", "high", map[string]interface{}{"spec": map[string]interface{}{"priority": int64(10)}}),
+		newTestObject("v1", "Pod", "default", "named", map[string]interface{}{"spec": map[string]interface{}{"priority": "10"}}),
+		newTestObject("v1", "Pod", "default", "low", map[string]interface{}{"spec": map[string]interface{}{"priority": "1"}}),
+	)
+
+	// Values that aren't strings are compared as they would be without an index
+	result := executeTestQuery(t, q, `MATCH (p:Pod) WHERE p.spec.priority = "10" RETURN p.metadata.name`)
+	if pods := result.Data["p"].([]interface{}); len(pods) != 2 {
+		t.Errorf("expected the pods of priority 10 whatever the type of their value, got %v", pods)
+	}
+}
@@ -0,0 +1,186 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The paths RETURN and WITH items project are looked up here rather than by the jsonpath library when they only
+// use keys and list selectors: an index, e.g. containers[0] or containers[-1] for the last one, a wildcard,
+// containers[*], or a slice, containers[1:3]. A path selecting several elements returns the values it finds as one
+// list, however many wildcards it goes through, e.g. the ports of every container for
+// containers[*].ports[*].containerPort. Other paths, such as those with filters, are left to the library.
+
+// listSelector is a selector of the elements of a list, e.g. [0], [*] or [1:3]
+var listSelector = regexp.MustCompile(`\[(\*|-?\d+|-?\d*:-?\d*)\]`)
+
+// pathStep is a segment of a path: the key it looks up, if any, then the selectors of the list found there
+type pathStep struct {
+	key       string
+	selectors []string
+}
+
+// parseFieldPath parses a path such as $.spec.containers[*].image into its steps, if it's one looked up here
+func parseFieldPath(path string) ([]pathStep, bool) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return nil, true
+	}
+	var steps []pathStep
+	for _, segment := range splitFieldPath(path) {
+		key := segment
+		var selectors []string
+		if start := indexUnescaped(segment, '['); start >= 0 {
+			key = segment[:start]
+			brackets := segment[start:]
+			for _, match := range listSelector.FindAllStringSubmatch(brackets, -1) {
+				selectors = append(selectors, match[1])
+			}
+			if listSelector.ReplaceAllString(brackets, "") != "" {
+				return nil, false
+			}
+		}
+		if key == "" && len(selectors) == 0 {
+			return nil, false
+		}
+		steps = append(steps, pathStep{key: strings.ReplaceAll(key, `\.`, "."), selectors: selectors})
+	}
+	return steps, true
+}
+
+// indexUnescaped is the index of the first c in s that isn't escaped with a backslash, -1 if there's none
+func indexUnescaped(s string, c byte) int {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case c:
+			return i
+		}
+	}
+	return -1
+}
+
+// lookupFieldPath looks the steps of a path up in an object. A path selecting a single value returns it, or fails
+// if it isn't there; one selecting several returns the list of those found, leaving out the elements missing it.
+func lookupFieldPath(obj interface{}, steps []pathStep) (interface{}, error) {
+	values := []interface{}{obj}
+	several := false
+	for _, step := range steps {
+		var next []interface{}
+		for _, value := range values {
+			found, err := lookupPathStep(value, step, &several)
+			if err != nil {
+				if !several {
+					return nil, err
+				}
+				continue
+			}
+			next = append(next, found...)
+		}
+		values = next
+	}
+	if several {
+		if values == nil {
+			values = []interface{}{}
+		}
+		return values, nil
+	}
+	return values[0], nil
+}
+
+// lookupPathStep returns the values a step selects in a value, and sets several if the step can select more than
+// one
+func lookupPathStep(value interface{}, step pathStep, several *bool) ([]interface{}, error) {
+	if step.key != "" {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s isn't in a %T", step.key, value)
+		}
+		child, ok := object[step.key]
+		if !ok {
+			return nil, fmt.Errorf("key %s not found", step.key)
+		}
+		value = child
+	}
+	values := []interface{}{value}
+	for _, selector := range step.selectors {
+		var next []interface{}
+		for _, value := range values {
+			list, ok := value.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("[%s] of %s isn't in a list", selector, step.key)
+			}
+			selected, err := selectElements(list, selector, several)
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, selected...)
+		}
+		values = next
+	}
+	return values, nil
+}
+
+// selectElements returns the elements of a list a selector selects, negative indices counting from its end
+func selectElements(list []interface{}, selector string, several *bool) ([]interface{}, error) {
+	if selector == "*" {
+		*several = true
+		return list, nil
+	}
+	if from, to, isSlice := strings.Cut(selector, ":"); isSlice {
+		*several = true
+		start, end := 0, len(list)
+		if from != "" {
+			start, _ = strconv.Atoi(from)
+		}
+		if to != "" {
+			end, _ = strconv.Atoi(to)
+		}
+		start, end = clampIndex(start, len(list)), clampIndex(end, len(list))
+		if start >= end {
+			return nil, nil
+		}
+		return list[start:end], nil
+	}
+	index, _ := strconv.Atoi(selector)
+	if index < 0 {
+		index += len(list)
+	}
+	if index < 0 || index >= len(list) {
+		return nil, fmt.Errorf("index %s out of range of a list of %d", selector, len(list))
+	}
+	return list[index : index+1], nil
+}
+
+// clampIndex is an index of a slice within a list of length n, negative ones counting from its end
+func clampIndex(index, n int) int {
+	if index < 0 {
+		index += n
+	}
+	return max(0, min(index, n))
+}
+
+// hasListSelector tells whether a path selects elements of a list, e.g. $.spec.containers[0].image
+func hasListSelector(path string) bool {
+	steps, ok := parseFieldPath(path)
+	if !ok {
+		return false
+	}
+	for _, step := range steps {
+		if len(step.selectors) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// returnPathLookup looks up the path of a RETURN or WITH item, with lookupFieldPath if it can, or else jsonPathLookup
+func returnPathLookup(obj interface{}, path string) (interface{}, error) {
+	if steps, ok := parseFieldPath(path); ok {
+		return lookupFieldPath(obj, steps)
+	}
+	return jsonPathLookup(obj, path)
+}
@@ -0,0 +1,55 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReturnPathLookup(t *testing.T) {
+	pod := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]interface{}{"app.kubernetes.io/name": "web"},
+		},
+		"spec": map[string]interface{}{
+			"containers": []interface{}{
+				map[string]interface{}{"name": "web", "image": "nginx", "ports": []interface{}{
+					map[string]interface{}{"containerPort": 80}, map[string]interface{}{"containerPort": 443},
+				}},
+				map[string]interface{}{"name": "proxy", "image": "envoy", "ports": []interface{}{
+					map[string]interface{}{"containerPort": 9090},
+				}},
+				map[string]interface{}{"name": "logs", "image": "fluentbit"},
+			},
+		},
+	}
+	tests := []struct {
+		path     string
+		expected interface{}
+	}{
+		{"$.spec.containers[0].image", "nginx"},
+		{"$.spec.containers[-1].name", "logs"},
+		{"$.spec.containers[*].image", []interface{}{"nginx", "envoy", "fluentbit"}},
+		{"$.spec.containers[1:].name", []interface{}{"proxy", "logs"}},
+		{"$.spec.containers[:-1].name", []interface{}{"web", "proxy"}},
+		{"$.spec.containers[*].ports[*].containerPort", []interface{}{80, 443, 9090}},
+		{"$.spec.containers[0].ports[*].containerPort", []interface{}{80, 443}},
+		{"$.spec.containers[2].ports[*].containerPort", nil},
+		{"$.spec.containers[5].image", nil},
+		{`$.metadata.labels.app\.kubernetes\.io/name`, "web"},
+		{"$", pod},
+	}
+	for _, tt := range tests {
+		got, err := returnPathLookup(pod, tt.path)
+		if tt.expected == nil {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %v", tt.path, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.path, err)
+		} else if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s = %v, want %v", tt.path, got, tt.expected)
+		}
+	}
+}
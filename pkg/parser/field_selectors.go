@@ -0,0 +1,55 @@
+package parser
+
+import "strings"
+
+// fieldSelectorFields lists, per resource, the fields the API server can filter on
+// besides metadata.name and metadata.namespace (which every resource supports).
+// Node properties on these fields are sent as field selectors instead of label selectors.
+var fieldSelectorFields = map[string][]string{
+	"pods": {
+		"spec.nodeName",
+		"spec.restartPolicy",
+		"spec.schedulerName",
+		"spec.serviceAccountName",
+		"spec.hostNetwork",
+		"status.phase",
+		"status.podIP",
+		"status.nominatedNodeName",
+	},
+	"events": {
+		"involvedObject.kind",
+		"involvedObject.namespace",
+		"involvedObject.name",
+		"involvedObject.uid",
+		"involvedObject.apiVersion",
+		"involvedObject.resourceVersion",
+		"involvedObject.fieldPath",
+		"reason",
+		"reportingComponent",
+		"source",
+		"type",
+	},
+	"secrets":                    {"type"},
+	"namespaces":                 {"status.phase"},
+	"nodes":                      {"spec.unschedulable"},
+	"replicasets":                {"status.replicas"},
+	"replicationcontrollers":     {"status.replicas"},
+	"jobs":                       {"status.successful"},
+	"certificatesigningrequests": {"spec.signerName"},
+}
+
+// fieldSelectorKey returns the field selector path for a node property key, and whether
+// the resource supports filtering on it server-side
+func fieldSelectorKey(resource string, key string) (string, bool) {
+	key = strings.Trim(key, `"`)
+	switch key {
+	case "name", "metadata.name":
+		return "metadata.name", true
+	}
+	for _, field := range fieldSelectorFields[resource] {
+		if field == key {
+			return field, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,267 @@
+package parser
+
+import (
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// The fields a query refers to in WHERE, WITH, UNWIND, SET, RETURN and ORDER BY are checked against the OpenAPI
+// schema of the kind of their node, when the schemas were loaded (see InitResourceSpecs), so that a typo like
+// d.spec.replcas doesn't silently match nothing. An unknown field is warned about, with the closest field of the
+// schema if one is close enough, and fails the query with StrictFields. Fields below one the schema doesn't
+// describe, e.g. the keys of labels or of a CRD's preserved unknown fields, aren't checked.
+
+// StrictFields fails queries referring to fields the schema of their kind doesn't have, instead of warning
+var StrictFields bool
+
+// virtualFields are fields queries may refer to that no schema describes
+var virtualFields = []string{"_gvr"}
+
+// validateFields checks the fields the query refers to against the schemas of the kinds of their nodes
+func (q *QueryExecutor) validateFields(ast *Expression) error {
+	if len(ResourceSpecs) == 0 {
+		return nil
+	}
+	kinds := make(map[string]string)
+	for _, clause := range ast.Clauses {
+		if c, ok := clause.(*MatchClause); ok {
+			for _, n := range c.Nodes {
+				if kind := n.ResourceProperties.Kind; kind != "" && !IsMultiKindPattern(kind) {
+					kinds[n.ResourceProperties.Name] = kind
+				}
+			}
+		}
+	}
+	if len(kinds) == 0 {
+		return nil
+	}
+
+	trees := make(map[string]fieldTree)
+	for _, path := range referencedPaths(ast) {
+		identifier, field, found := strings.Cut(path, ".")
+		kind, ok := kinds[identifier]
+		if !found || !ok {
+			continue
+		}
+		tree, ok := trees[kind]
+		if !ok {
+			if gvr, err := FindGVR(q.Clientset, kind); err == nil {
+				tree = newFieldTree(schemaFields(gvr, kind))
+				if _, ok := metricsResources[gvr]; ok && tree != nil {
+					tree[""] = append(tree[""], metricsField)
+				}
+			}
+			trees[kind] = tree
+		}
+		closest, ok := tree.check(field)
+		if ok {
+			continue
+		}
+		var suggestion, hint string
+		if closest != "" {
+			suggestion = identifier + "." + closest
+			hint = ", did you mean " + suggestion + "?"
+		}
+		if StrictFields {
+			return newDiagnosticError(CodeUnknownField, nil, "path", path, "kind", kind, "suggestion", suggestion, "hint", hint)
+		}
+		logDiagnostic(CodeUnknownField, nil, "path", path, "kind", kind, "suggestion", suggestion)
+	}
+	return nil
+}
+
+// referencedPaths are the paths the clauses of the query refer to, e.g. d.spec.replicas
+func referencedPaths(ast *Expression) []string {
+	var paths []string
+	refer := func(path string) {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	referItems := func(items []*ReturnItem) {
+		for _, item := range items {
+			refer(item.JsonPath)
+			for _, arg := range item.Args {
+				refer(arg.JsonPath)
+			}
+		}
+	}
+	referFilters := func(filters []*KeyValuePair) {
+		for _, filter := range filters {
+			refer(filter.Key)
+			for _, arg := range filter.Args {
+				refer(arg.JsonPath)
+			}
+		}
+	}
+	for _, clause := range ast.Clauses {
+		switch c := clause.(type) {
+		case *MatchClause:
+			referFilters(c.ExtraFilters)
+		case *WithClause:
+			referItems(c.Items)
+			referFilters(c.ExtraFilters)
+		case *UnwindClause:
+			refer(c.JsonPath)
+		case *SetClause:
+			for _, pair := range c.KeyValuePairs {
+				refer(pair.Key)
+			}
+		case *ReturnClause:
+			referItems(c.Items)
+			for _, item := range c.OrderBy {
+				refer(item.JsonPath)
+			}
+		}
+	}
+	return paths
+}
+
+// schemaFields are the fields of the OpenAPI schema of a kind, e.g. io.k8s.api.apps.v1.Deployment for the
+// Deployments of apps/v1, or nil if it isn't known which schema is the kind's
+func schemaFields(gvr schema.GroupVersionResource, kind string) []string {
+	var candidates []string
+	for name := range ResourceSpecs {
+		parts := strings.Split(name, ".")
+		if len(parts) >= 3 && parts[len(parts)-1] == kind && parts[len(parts)-2] == gvr.Version {
+			candidates = append(candidates, name)
+		}
+	}
+	if len(candidates) == 1 {
+		return ResourceSpecs[candidates[0]]
+	}
+	// Schema names hold the first label of the group, or core for the core group
+	group, _, _ := strings.Cut(gvr.Group, ".")
+	if group == "" {
+		group = "core"
+	}
+	for _, name := range candidates {
+		if slices.Contains(strings.Split(name, "."), group) {
+			return ResourceSpecs[name]
+		}
+	}
+	return nil
+}
+
+// fieldTree maps the fields of a schema, e.g. spec.template, to the names of their subfields. Array items are
+// left out of the fields, so that spec.containers[0].image is spec.containers.image.
+type fieldTree map[string][]string
+
+func newFieldTree(fields []string) fieldTree {
+	if len(fields) == 0 {
+		return nil
+	}
+	tree := make(fieldTree)
+	for _, field := range fields {
+		parent := ""
+		for _, segment := range strings.Split(strings.ReplaceAll(field, "[]", ""), ".") {
+			// The keys of maps aren't known
+			if strings.HasSuffix(segment, "{}") {
+				break
+			}
+			if !slices.Contains(tree[parent], segment) {
+				tree[parent] = append(tree[parent], segment)
+			}
+			parent = joinFieldPath(parent, segment)
+		}
+	}
+	return tree
+}
+
+// check tells whether field is a field of the schema, and if it isn't, the closest one there is, if any
+func (tree fieldTree) check(field string) (string, bool) {
+	if tree == nil {
+		return "", true
+	}
+	segments := splitFieldPath(field)
+	parent := ""
+	for i, segment := range segments {
+		children := tree[parent]
+		// The schema doesn't describe what's below, e.g. the keys of a map
+		if len(children) == 0 {
+			return "", true
+		}
+		name, index, _ := strings.Cut(segment, "[")
+		if parent == "" && slices.Contains(virtualFields, name) {
+			return "", true
+		}
+		if !slices.Contains(children, name) {
+			closest, ok := closestField(name, children)
+			if !ok {
+				return "", false
+			}
+			if index != "" {
+				closest += "[" + index
+			}
+			corrected := append(append(slices.Clone(segments[:i]), closest), segments[i+1:]...)
+			return strings.Join(corrected, "."), false
+		}
+		parent = joinFieldPath(parent, name)
+	}
+	return "", true
+}
+
+// closestField is the field of candidates closest to name, if it's close enough to be a typo of it
+func closestField(name string, candidates []string) (string, bool) {
+	var closest string
+	best := max(2, len(name)/3) + 1
+	for _, candidate := range candidates {
+		if distance := editDistance(strings.ToLower(name), strings.ToLower(candidate)); distance < best {
+			closest, best = candidate, distance
+		}
+	}
+	return closest, closest != ""
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+// splitFieldPath splits a path at its dots, except those escaped, e.g. in metadata.labels.app\.kubernetes\.io/name,
+// or within brackets
+func splitFieldPath(path string) []string {
+	var segments []string
+	var depth, start int
+	for i := 0; i < len(path); i++ {
+		switch path[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case '.':
+			if depth == 0 {
+				segments = append(segments, path[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(segments, path[start:])
+}
+
+func joinFieldPath(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
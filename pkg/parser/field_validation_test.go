@@ -0,0 +1,63 @@
+package parser
+
+import "testing"
+
+func TestValidateFields(t *testing.T) {
+	originalSpecs, originalStrict := ResourceSpecs, StrictFields
+	t.Cleanup(func() {
+		ResourceSpecs, StrictFields = originalSpecs, originalStrict
+	})
+	ResourceSpecs = map[string][]string{
+		"io.k8s.api.apps.v1.Deployment": {
+			"kind", "metadata", "metadata.name", "metadata.labels", "metadata.annotations",
+			"spec", "spec.replicas", "spec.template", "spec.template.spec", "spec.template.spec.containers",
+			"spec.template.spec.containers[].name", "spec.template.spec.containers[].image",
+			"status", "status.conditions", "status.conditions[].type", "status.conditions[].status",
+		},
+		"io.k8s.api.core.v1.Pod":    {"metadata", "metadata.name", "spec", "spec.nodeName"},
+		"io.k8s.api.example.v1.Pod": {"spec", "spec.widget"},
+	}
+	q := newTestQueryExecutor(t, newTestObject("apps/v1", "Deployment", "default", "web", nil))
+
+	valid := []string{
+		`MATCH (d:Deployment) WHERE d.spec.replicas > 1 RETURN d.metadata.name`,
+		`MATCH (d:Deployment) RETURN d.spec.template.spec.containers[0].image, d.metadata.labels.app`,
+		`MATCH (d:Deployment) RETURN d.status.conditions[*].status`,
+		`MATCH (d:Deployment) RETURN d._gvr, d`,
+		`MATCH (p:Pod) RETURN p.spec.nodeName, p.metrics.cpu`,
+	}
+	StrictFields = true
+	for _, query := range valid {
+		ast, err := ParseQuery(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := q.validateFields(ast); err != nil {
+			t.Errorf("%s: expected the fields to be valid, got %v", query, err)
+		}
+	}
+
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{`MATCH (d:Deployment) WHERE d.spec.replcas > 1 RETURN d`, "d.spec.replcas isn't a field of Deployment, did you mean d.spec.replicas?"},
+		{`MATCH (d:Deployment) RETURN d.spec.template.spec.containres[0].image`, "d.spec.template.spec.containres[0].image isn't a field of Deployment, did you mean d.spec.template.spec.containers[0].image?"},
+		{`MATCH (d:Deployment) SET d.spec.paused = true`, "d.spec.paused isn't a field of Deployment"},
+		{`MATCH (p:Pod) RETURN p.spec.nodename`, "p.spec.nodename isn't a field of Pod, did you mean p.spec.nodeName?"},
+	}
+	for _, tt := range tests {
+		ast, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = q.validateFields(ast)
+		if DiagnosticCodeOf(err) != CodeUnknownField || err.Error() != tt.expected {
+			t.Errorf("%s: expected %q, got %v", tt.query, tt.expected, err)
+		}
+	}
+
+	// Without --strict the query runs
+	StrictFields = false
+	executeTestQuery(t, q, `MATCH (d:Deployment) WHERE d.spec.replcas > 1 RETURN d`)
+}
@@ -0,0 +1,307 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// filterOperators are how the operators of WHERE and SET key-value pairs are written
+var filterOperators = map[string]string{
+	"EQUALS":              "=",
+	"NOT_EQUALS":          "!=",
+	"GREATER_THAN":        ">",
+	"LESS_THAN":           "<",
+	"GREATER_THAN_EQUALS": ">=",
+	"LESS_THAN_EQUALS":    "<=",
+	"REGEX":               "=~",
+	"CONTAINS":            "CONTAINS",
+	"STARTS_WITH":         "STARTS WITH",
+	"ENDS_WITH":           "ENDS WITH",
+}
+
+// FormatQuery renders a parsed query back into Cyphernetes, on one line and with its keywords in upper case. The
+// query it renders parses to the same expression.
+func FormatQuery(e *Expression) string {
+	var b strings.Builder
+	if e.Version != 0 {
+		fmt.Fprintf(&b, "CYPHERNETES %d ", e.Version)
+	}
+	if e.Explain {
+		b.WriteString("EXPLAIN ")
+	}
+	if e.Apply != nil {
+		fmt.Fprintf(&b, "APPLY BATCH %d ", e.Apply.BatchSize)
+	}
+	b.WriteString(formatClauses(e.Clauses))
+	if e.Apply != nil && e.Apply.While != nil {
+		b.WriteString(" WHILE " + formatClauses(e.Apply.While.Clauses))
+	}
+	if e.Union != nil {
+		for _, query := range e.Union.Queries {
+			b.WriteString(" UNION ")
+			if e.Union.All {
+				b.WriteString("ALL ")
+			}
+			b.WriteString(formatClauses(query.Clauses))
+		}
+	}
+	return b.String()
+}
+
+func formatClauses(clauses []Clause) string {
+	formatted := make([]string, 0, len(clauses))
+	for _, clause := range clauses {
+		formatted = append(formatted, formatClause(clause))
+	}
+	return strings.Join(formatted, " ")
+}
+
+func formatClause(clause Clause) string {
+	switch c := clause.(type) {
+	case *MatchClause:
+		s := "MATCH " + formatPatterns(c.Nodes, c.Relationships) + formatWhere(c.ExtraFilters)
+		if c.Optional {
+			s = "OPTIONAL " + s
+		}
+		return s
+	case *SetClause:
+		s := "SET "
+		if c.Status {
+			s += "STATUS "
+		}
+		if c.PatchType != "" {
+			s += strings.ToUpper(c.PatchType) + " "
+		}
+		return s + formatKeyValuePairs(c.KeyValuePairs)
+	case *DeleteClause:
+		return "DELETE " + strings.Join(c.NodeIds, ", ")
+	case *OperationClause:
+		s := strings.ToUpper(c.Operation) + " " + strings.Join(c.NodeIds, ", ")
+		if c.Operation == "scale" {
+			s += fmt.Sprintf(" TO %d", c.Replicas)
+		}
+		return s
+	case *CreateClause:
+		return "CREATE " + formatPatterns(c.Nodes, c.Relationships)
+	case *MergeClause:
+		return "MERGE " + formatNode(c.Node)
+	case *WithClause:
+		return "WITH " + formatReturnItems(c.Items) + formatWhere(c.ExtraFilters)
+	case *UnwindClause:
+		return "UNWIND " + c.JsonPath + " AS " + c.Alias
+	case *ReturnClause:
+		s := "RETURN " + formatReturnItems(c.Items)
+		if c.Distinct {
+			s = "RETURN DISTINCT " + formatReturnItems(c.Items)
+		}
+		if len(c.OrderBy) > 0 {
+			s += " ORDER BY " + formatOrderItems(c.OrderBy)
+		}
+		return s
+	}
+	return fmt.Sprintf("%v", clause)
+}
+
+// formatPatterns renders the nodes of a clause, chained by the relationships between consecutive nodes
+func formatPatterns(nodes []*NodePattern, relationships []*Relationship) string {
+	var b strings.Builder
+	for i, node := range nodes {
+		b.WriteString(formatNode(node))
+		if i == len(nodes)-1 {
+			break
+		}
+		if rel := chainingRelationship(relationships, node, nodes[i+1]); rel != nil {
+			b.WriteString(formatRelationship(rel))
+		} else {
+			b.WriteString(", ")
+		}
+	}
+	return b.String()
+}
+
+func chainingRelationship(relationships []*Relationship, left, right *NodePattern) *Relationship {
+	for _, rel := range relationships {
+		if rel.LeftNode == left && rel.RightNode == right {
+			return rel
+		}
+	}
+	return nil
+}
+
+func formatNode(node *NodePattern) string {
+	properties := node.ResourceProperties
+	if properties.Kind == "" {
+		return "(" + properties.Name + ")"
+	}
+	s := properties.Name + ":" + properties.Kind
+	switch {
+	case properties.JsonData != "":
+		s += " " + properties.JsonData
+	case properties.Properties != nil:
+		s += " " + formatProperties(properties.Properties)
+	}
+	return "(" + s + ")"
+}
+
+func formatProperties(properties *Properties) string {
+	formatted := make([]string, 0, len(properties.PropertyList))
+	for _, property := range properties.PropertyList {
+		switch property.Operator {
+		case "IN":
+			formatted = append(formatted, property.Key+" IN "+formatValue(property.Value))
+		case "NOT_IN":
+			formatted = append(formatted, property.Key+" NOT IN "+formatValue(property.Value))
+		case "EXISTS":
+			formatted = append(formatted, property.Key+" EXISTS")
+		case "NOT_EXISTS":
+			formatted = append(formatted, property.Key+" NOT EXISTS")
+		default:
+			formatted = append(formatted, property.Key+": "+formatValue(property.Value))
+		}
+	}
+	return "{" + strings.Join(formatted, ", ") + "}"
+}
+
+func formatRelationship(rel *Relationship) string {
+	inner := ""
+	if properties := rel.ResourceProperties; properties != nil {
+		inner = properties.Name
+		if properties.Kind != "" {
+			inner += ":" + properties.Kind
+		}
+		if properties.Properties != nil {
+			inner += " " + formatProperties(properties.Properties)
+		}
+	}
+	if rel.Hops != nil {
+		inner += rel.Hops.String()
+	}
+
+	if inner == "" {
+		switch rel.Direction {
+		case Left:
+			return "<-"
+		case Right:
+			return "->"
+		}
+		return "--"
+	}
+	switch rel.Direction {
+	case Left:
+		return "<-[" + inner + "]-"
+	case Right:
+		return "-[" + inner + "]->"
+	case Both:
+		return "<-[" + inner + "]->"
+	}
+	return "-[" + inner + "]-"
+}
+
+func formatWhere(filters []*KeyValuePair) string {
+	if len(filters) == 0 {
+		return ""
+	}
+	return " WHERE " + formatKeyValuePairs(filters)
+}
+
+func formatKeyValuePairs(pairs []*KeyValuePair) string {
+	formatted := make([]string, 0, len(pairs))
+	for _, pair := range pairs {
+		subject := pair.Key
+		if pair.Function != "" {
+			subject = formatCall(pair.Function, pair.Key, pair.Args)
+			// A function alone must be true
+			if pair.Operator == "EQUALS" && pair.Value == true {
+				formatted = append(formatted, subject)
+				continue
+			}
+		}
+		operator, ok := filterOperators[pair.Operator]
+		if !ok {
+			operator = pair.Operator
+		}
+		formatted = append(formatted, subject+" "+operator+" "+formatValue(pair.Value))
+	}
+	return strings.Join(formatted, ", ")
+}
+
+func formatCall(function, jsonPath string, args []*FunctionArg) string {
+	formatted := []string{jsonPath}
+	for _, arg := range args {
+		if arg.JsonPath != "" {
+			formatted = append(formatted, arg.JsonPath)
+		} else {
+			formatted = append(formatted, formatValue(arg.Value))
+		}
+	}
+	return function + "(" + strings.Join(formatted, ", ") + ")"
+}
+
+func formatReturnItems(items []*ReturnItem) string {
+	formatted := make([]string, 0, len(items))
+	for _, item := range items {
+		s := item.JsonPath
+		switch {
+		case item.Aggregate != "":
+			s = item.Aggregate + "(" + item.JsonPath + ")"
+		case item.Function != "":
+			s = formatCall(item.Function, item.JsonPath, item.Args)
+		}
+		if item.Alias != "" {
+			s += " AS " + item.Alias
+		}
+		formatted = append(formatted, s)
+	}
+	return strings.Join(formatted, ", ")
+}
+
+func formatOrderItems(items []*OrderItem) string {
+	formatted := make([]string, 0, len(items))
+	for _, item := range items {
+		if item.Descending {
+			formatted = append(formatted, item.JsonPath+" DESC")
+		} else {
+			formatted = append(formatted, item.JsonPath)
+		}
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// formatValue renders a value as the lexer reads it: strings are quoted without escaping, as their quotes are only
+// trimmed when they're read
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return quote(v)
+	case int:
+		return strconv.Itoa(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case []interface{}:
+		formatted := make([]string, 0, len(v))
+		for _, element := range v {
+			formatted = append(formatted, formatValue(element))
+		}
+		return "[" + strings.Join(formatted, ", ") + "]"
+	case *TemporalExpression:
+		var b strings.Builder
+		for i, term := range v.Terms {
+			switch {
+			case term.Negative:
+				b.WriteString(" - ")
+			case i > 0:
+				b.WriteString(" + ")
+			}
+			b.WriteString(term.Function + "(")
+			if term.Arg != "" {
+				b.WriteString(quote(term.Arg))
+			}
+			b.WriteString(")")
+		}
+		return b.String()
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,196 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// valueFunction is a function of the value at a path, e.g. toLower(p.metadata.name), as opposed to the functions
+// of a node such as id(p)
+type valueFunction struct {
+	// name is how the function is written in queries, function names are matched case-insensitively
+	name string
+	// args is the number of arguments after the first, -1 for any number
+	args int
+	call func(value interface{}, args []interface{}) interface{}
+}
+
+var valueFunctions = map[string]valueFunction{
+	"TOUPPER": {name: "toUpper", call: func(value interface{}, _ []interface{}) interface{} {
+		return mapString(value, strings.ToUpper)
+	}},
+	"TOLOWER": {name: "toLower", call: func(value interface{}, _ []interface{}) interface{} {
+		return mapString(value, strings.ToLower)
+	}},
+	"SPLIT": {name: "split", args: 1, call: func(value interface{}, args []interface{}) interface{} {
+		if value == nil || args[0] == nil {
+			return nil
+		}
+		parts := []interface{}{}
+		for _, part := range strings.Split(toString(value), toString(args[0])) {
+			parts = append(parts, part)
+		}
+		return parts
+	}},
+	"REPLACE": {name: "replace", args: 2, call: func(value interface{}, args []interface{}) interface{} {
+		if value == nil || args[0] == nil || args[1] == nil {
+			return nil
+		}
+		return strings.ReplaceAll(toString(value), toString(args[0]), toString(args[1]))
+	}},
+	"CONTAINS": {name: "contains", args: 1, call: func(value interface{}, args []interface{}) interface{} {
+		return stringPredicate(value, args[0], strings.Contains)
+	}},
+	"STARTSWITH": {name: "startsWith", args: 1, call: func(value interface{}, args []interface{}) interface{} {
+		return stringPredicate(value, args[0], strings.HasPrefix)
+	}},
+	"ENDSWITH": {name: "endsWith", args: 1, call: func(value interface{}, args []interface{}) interface{} {
+		return stringPredicate(value, args[0], strings.HasSuffix)
+	}},
+	"SIZE": {name: "size", call: func(value interface{}, _ []interface{}) interface{} {
+		switch v := value.(type) {
+		case string:
+			return utf8.RuneCountInString(v)
+		case []interface{}:
+			return len(v)
+		case map[string]interface{}:
+			return len(v)
+		}
+		return nil
+	}},
+	"KEYS": {name: "keys", call: func(value interface{}, _ []interface{}) interface{} {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		list := make([]interface{}, len(keys))
+		for i, key := range keys {
+			list[i] = key
+		}
+		return list
+	}},
+	"COALESCE": {name: "coalesce", args: -1, call: func(value interface{}, args []interface{}) interface{} {
+		for _, v := range append([]interface{}{value}, args...) {
+			if v != nil {
+				return v
+			}
+		}
+		return nil
+	}},
+}
+
+// isValueFunction reports whether a function is a function of values rather than of nodes
+func isValueFunction(function string) bool {
+	_, ok := valueFunctions[strings.ToUpper(function)]
+	return ok
+}
+
+// functionName is how a function is written in queries, e.g. toLower for TOLOWER
+func functionName(function string) string {
+	if f, ok := valueFunctions[strings.ToUpper(function)]; ok {
+		return f.name
+	}
+	return strings.ToLower(function)
+}
+
+// evaluateValueFunction computes a function of the value at jsonPath for a record, which is a resource of the
+// node the path starts with, or a row of WITH values. The paths of args refer to the same record.
+func evaluateValueFunction(function, jsonPath string, args []*FunctionArg, record map[string]interface{}, fromRows bool) (interface{}, error) {
+	f, ok := valueFunctions[strings.ToUpper(function)]
+	if !ok {
+		return nil, newDiagnosticError(CodeUnknownFunction, nil, "function", strings.ToLower(function))
+	}
+	if f.args >= 0 && len(args) != f.args {
+		return nil, newDiagnosticError(CodeFunctionArguments, nil, "function", f.name, "reason", fmt.Sprintf("takes %d arguments, got %d", f.args+1, len(args)+1))
+	}
+
+	root := strings.Split(jsonPath, ".")[0]
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		if arg.JsonPath == "" {
+			values[i] = arg.Value
+			continue
+		}
+		if !fromRows && strings.Split(arg.JsonPath, ".")[0] != root {
+			return nil, newDiagnosticError(CodeFunctionArguments, nil, "function", f.name, "reason", fmt.Sprintf("%s doesn't refer to %s like its first argument", arg.JsonPath, root))
+		}
+		values[i] = lookupRecordPath(record, arg.JsonPath, fromRows)
+	}
+	return f.call(lookupRecordPath(record, jsonPath, fromRows), values), nil
+}
+
+// recordPath turns a path of a query into a JSONPath within a record: a resource of the node the path starts
+// with, or a row of WITH values
+func recordPath(queryPath string, fromRows bool) string {
+	parts := strings.Split(queryPath, ".")
+	if !fromRows {
+		parts = parts[1:]
+	}
+	if len(parts) == 0 {
+		return "$"
+	}
+	return "$." + strings.Join(parts, ".")
+}
+
+// lookupRecordPath is the value at a path of a query within a record, nil if there's none
+func lookupRecordPath(record map[string]interface{}, queryPath string, fromRows bool) interface{} {
+	path := recordPath(queryPath, fromRows)
+	if path == "$" {
+		return record
+	}
+	value, err := jsonPathLookup(record, path)
+	if err != nil {
+		logDebug("Path not found", "path", queryPath)
+		return nil
+	}
+	return value
+}
+
+// toString is the text of a value given to a string function
+func toString(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return fmt.Sprint(value)
+}
+
+func mapString(value interface{}, f func(string) string) interface{} {
+	if value == nil {
+		return nil
+	}
+	return f(toString(value))
+}
+
+func stringPredicate(value, arg interface{}, f func(s, substr string) bool) interface{} {
+	if value == nil || arg == nil {
+		return nil
+	}
+	return f(toString(value), toString(arg))
+}
+
+// functionCallLabel renders a function call as written in a query, e.g. split(p.spec.nodeName, "-")
+func functionCallLabel(function, jsonPath string, args []*FunctionArg) string {
+	parts := []string{jsonPath}
+	for _, arg := range args {
+		switch {
+		case arg.JsonPath != "":
+			parts = append(parts, arg.JsonPath)
+		case arg.Value == nil:
+			parts = append(parts, "null")
+		default:
+			if s, ok := arg.Value.(string); ok {
+				parts = append(parts, fmt.Sprintf("%q", s))
+			} else {
+				parts = append(parts, fmt.Sprint(arg.Value))
+			}
+		}
+	}
+	return functionName(function) + "(" + strings.Join(parts, ", ") + ")"
+}
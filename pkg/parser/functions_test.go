@@ -0,0 +1,141 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestParseFunctions(t *testing.T) {
+	tests := []struct {
+		query    string
+		filters  []*KeyValuePair
+		items    []*ReturnItem
+		clauseOf int
+	}{
+		{
+			query: `MATCH (p:Pod) WHERE p.spec.containers[0].image CONTAINS ":latest" RETURN p`,
+			filters: []*KeyValuePair{
+				{Key: "p.spec.containers[0].image", Value: ":latest", Operator: "CONTAINS"},
+			},
+		},
+		{
+			query: `MATCH (p:Pod) WHERE p.metadata.name STARTS WITH "web", p.metadata.name ENDS WITH "-1" RETURN p`,
+			filters: []*KeyValuePair{
+				{Key: "p.metadata.name", Value: "web", Operator: "STARTS_WITH"},
+				{Key: "p.metadata.name", Value: "-1", Operator: "ENDS_WITH"},
+			},
+		},
+		{
+			query: `MATCH (p:Pod) WHERE toLower(p.metadata.name) = "web", size(p.spec.containers) > 1, startsWith(p.metadata.name, "w") RETURN p`,
+			filters: []*KeyValuePair{
+				{Key: "p.metadata.name", Function: "TOLOWER", Value: "web", Operator: "EQUALS"},
+				{Key: "p.spec.containers", Function: "SIZE", Value: 1, Operator: "GREATER_THAN"},
+				{Key: "p.metadata.name", Function: "STARTSWITH", Args: []*FunctionArg{{Value: "w"}}, Value: true, Operator: "EQUALS"},
+			},
+		},
+		{
+			query: `MATCH (p:Pod) RETURN split(p.spec.nodeName, "-") AS parts, coalesce(p.spec.priority, p.spec.priorityClassName, 0), toUpper(p.metadata.name)`,
+			items: []*ReturnItem{
+				{JsonPath: "p.spec.nodeName", Function: "SPLIT", Args: []*FunctionArg{{Value: "-"}}, Alias: "parts"},
+				{JsonPath: "p.spec.priority", Function: "COALESCE", Args: []*FunctionArg{{JsonPath: "p.spec.priorityClassName"}, {Value: 0}}},
+				{JsonPath: "p.metadata.name", Function: "TOUPPER"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		expr, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) error = %v", tt.query, err)
+			continue
+		}
+		if tt.filters != nil && !reflect.DeepEqual(expr.Clauses[0].(*MatchClause).ExtraFilters, tt.filters) {
+			t.Errorf("ParseQuery(%q) filters = %+v", tt.query, expr.Clauses[0].(*MatchClause).ExtraFilters)
+		}
+		if tt.items != nil && !reflect.DeepEqual(expr.Clauses[1].(*ReturnClause).Items, tt.items) {
+			t.Errorf("ParseQuery(%q) items = %+v", tt.query, expr.Clauses[1].(*ReturnClause).Items)
+		}
+	}
+}
+
+func TestFunctions(t *testing.T) {
+	pod := func(name, image string, labels map[string]interface{}) runtime.Object {
+		return newTestObject("v1", "Pod", "default", name, map[string]interface{}{
+			"metadata": map[string]interface{}{"name": name, "namespace": "default", "labels": labels},
+			"spec": map[string]interface{}{
+				"nodeName":   "pool-a-1",
+				"containers": []interface{}{map[string]interface{}{"name": "main", "image": image}},
+			},
+		})
+	}
+	q := newTestQueryExecutor(t,
+		pod("Web-1", "nginx:latest", map[string]interface{}{"app": "web", "tier": "front"}),
+		pod("api-1", "api:2.0", nil),
+	)
+
+	names := func(result QueryResult, node string) []string {
+		names := []string{}
+		for _, row := range result.Data[node].([]interface{}) {
+			names = append(names, row.(map[string]interface{})["name"].(string))
+		}
+		return names
+	}
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{`MATCH (p:Pod) WHERE p.spec.containers[0].image CONTAINS ":latest" RETURN p.metadata.name`, []string{"Web-1"}},
+		{`MATCH (p:Pod) WHERE p.metadata.name STARTS WITH "api" RETURN p.metadata.name`, []string{"api-1"}},
+		{`MATCH (p:Pod) WHERE p.metadata.name ENDS WITH "-1" RETURN p.metadata.name`, []string{"Web-1", "api-1"}},
+		{`MATCH (p:Pod) WHERE toLower(p.metadata.name) = "web-1" RETURN p.metadata.name`, []string{"Web-1"}},
+		{`MATCH (p:Pod) WHERE size(p.metadata.labels) > 1 RETURN p.metadata.name`, []string{"Web-1"}},
+		{`MATCH (p:Pod) WHERE endsWith(p.spec.containers[0].image, "2.0") RETURN p.metadata.name`, []string{"api-1"}},
+		{`MATCH (p:Pod) WHERE coalesce(p.metadata.labels.app, "none") = "none" RETURN p.metadata.name`, []string{"api-1"}},
+	}
+	for _, tt := range tests {
+		result := executeTestQuery(t, q, tt.query)
+		if got := names(result, "p"); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s returned %v, expected %v", tt.query, got, tt.expected)
+		}
+	}
+
+	result := executeTestQuery(t, q, `MATCH (p:Pod {app: "web"}) RETURN toUpper(p.metadata.name) AS upper, split(p.spec.nodeName, "-") AS parts, replace(p.spec.containers[0].image, ":latest", ":1.25") AS image, keys(p.metadata.labels) AS labels, size(p.spec.containers)`)
+	row := result.Data["p"].([]interface{})[0].(map[string]interface{})
+	expected := map[string]interface{}{
+		"name":   "Web-1",
+		"upper":  "WEB-1",
+		"parts":  []interface{}{"pool", "a", "1"},
+		"image":  "nginx:1.25",
+		"labels": []interface{}{"app", "tier"},
+		"size":   1,
+	}
+	if !reflect.DeepEqual(row, expected) {
+		t.Errorf("unexpected row %v", row)
+	}
+
+	// Functions apply to the values of WITH too
+	result = executeTestQuery(t, q, `MATCH (p:Pod) WITH p.spec.nodeName AS node, COUNT(p) AS pods WHERE startsWith(node, "pool-a") RETURN split(node, "-") AS parts, pods`)
+	if expected := []interface{}{map[string]interface{}{"parts": []interface{}{"pool", "a", "1"}, "pods": 2}}; !reflect.DeepEqual(result.Data[withRowsNode], expected) {
+		t.Errorf("unexpected rows %v", result.Data[withRowsNode])
+	}
+}
+
+func TestFunctionArguments(t *testing.T) {
+	q := newTestQueryExecutor(t, newTestObject("v1", "Pod", "default", "web", nil))
+	for _, query := range []string{
+		`MATCH (p:Pod) RETURN split(p.spec.nodeName) AS parts`,
+		`MATCH (p:Pod) WHERE replace(p.metadata.name, "a") = "b" RETURN p`,
+		`MATCH (p:Pod), (d:Deployment) RETURN coalesce(p.spec.nodeName, d.metadata.name) AS value`,
+		`MATCH (p:Pod) RETURN id(p, "x")`,
+	} {
+		ast, err := ParseQuery(query)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q) error = %v", query, err)
+		}
+		if _, err := q.Execute(ast, "default"); DiagnosticCodeOf(err) != CodeFunctionArguments {
+			t.Errorf("expected %s for %q, got %v", CodeFunctionArguments, query, err)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package parser
+
+import (
+	"encoding/json"
+	"math/rand"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+// The fuzz targets are seeded with the queries of the language reference and those below. Run them with make fuzz,
+// or one with go test -run='^$' -fuzz=FuzzParseQuery ./pkg/parser
+
+var seedQueries = []string{
+	`MATCH (p:Pod) RETURN p`,
+	`MATCH (d:Deployment {name: "nginx", app: "web"})->(s:Service) WHERE d.spec.replicas >= 2 RETURN d.metadata.name, s`,
+	`MATCH (p:Pod {app IN ["web", "api"], env NOT IN ["dev"], tier EXISTS, canary NOT EXISTS}) RETURN p.metadata.name AS name`,
+	`MATCH (p:Pod) WHERE p.metadata.name =~ "web-.*", p.status.phase != "Running", p.spec.hostNetwork = true RETURN p`,
+	`MATCH (p:Pod) WHERE p.metadata.name STARTS WITH "web", p.metadata.name ENDS WITH "-0", p.metadata.name CONTAINS "a" RETURN p`,
+	`MATCH (p:Pod) WHERE p.metadata.name = "web", p.spec.replicas <= 3 RETURN p`,
+	`MATCH (p:Pod) WHERE p.metadata.creationTimestamp < now() - duration("24h") RETURN p`,
+	`MATCH (p:Pod) WHERE startsWith(p.spec.nodeName, "pool-a"), size(p.spec.containers) > 1 RETURN toLower(p.metadata.name) AS name`,
+	`MATCH (s:Service)-[r]->(p:Pod) RETURN type(r), r.link`,
+	`MATCH (d:Deployment)-[*1..3]->(p:Pod) RETURN p`,
+	`MATCH (d:Deployment)<-[r:OWNS {kind: "x"}]-(rs:ReplicaSet) RETURN rs`,
+	`MATCH (a:Pod)-[:CAN_REACH]->(b:Pod) RETURN a, b`,
+	`MATCH (d:Deployment) OPTIONAL MATCH (d)->(h:HorizontalPodAutoscaler) RETURN d, h`,
+	`MATCH (p:Pod) WITH p.spec.nodeName AS node, COUNT(p) AS pods WHERE pods > 50 RETURN node, pods`,
+	`MATCH (p:Pod) UNWIND p.spec.containers AS c RETURN DISTINCT c.image`,
+	`MATCH (p:Pod)-[:HAS_EVENT]->(e:Event) RETURN e.reason AS reason, e.message ORDER BY e.lastTimestamp DESC, e.reason`,
+	`MATCH (d:Deployment) RETURN COUNT{d} AS n, SUM{d.spec.replicas} AS replicas`,
+	`MATCH (d:Deployment) RETURN d UNION ALL MATCH (s:StatefulSet) RETURN s`,
+	`MATCH (d:Deployment {name: "nginx"}) SET d.spec.replicas = 4, d.metadata.labels.app = "x" RETURN d`,
+	`MATCH (d:Deployment {name: "nginx"})->(s:Service) DELETE d, s`,
+	`MATCH (d:Deployment) SET x.a = 1`,
+	`CREATE (d:Deployment {"name": "nginx", "spec": {"replicas": 1}})`,
+	`MATCH (d:Deployment {name: "nginx"}) CREATE (d)->(s:Service)`,
+	`MERGE (cm:ConfigMap {name: "settings"}) SET cm.data.key = "v" RETURN cm.data`,
+	`APPLY BATCH 5 MATCH (d:Deployment) SET d.spec.replicas = 0 WHILE MATCH (h:HorizontalPodAutoscaler) WHERE h.status.currentReplicas < 10 RETURN h`,
+	`EXPLAIN MATCH (d:Deployment)->(rs:ReplicaSet) RETURN rs`,
+	`CYPHERNETES 1 MATCH (w:Deployment|StatefulSet) RETURN w`,
+	`MATCH (p:Pod) WHERE p.metadata.labels.app\.kubernetes\.io/name = "web" RETURN p`,
+	`MATCH (p:Pod) WHERE p.spec.priority > 99999999999999999999 RETURN p`,
+	`CREATE (d:Deployment {"name": "nginx"`,
+}
+
+var queryBlock = regexp.MustCompile("(?s)```graphql\n(.*?)```")
+
+// corpusQueries returns the seed queries and the examples of the language reference, their lines joined and
+// without their comments or the results printed after them
+func corpusQueries(t testing.TB) []string {
+	queries := append([]string{}, seedQueries...)
+	doc, err := os.ReadFile("../../docs/LANGUAGE.md")
+	if err != nil {
+		t.Fatalf("error reading the language reference: %v", err)
+	}
+	for _, block := range queryBlock.FindAllStringSubmatch(string(doc), -1) {
+		var lines []string
+		for _, line := range strings.Split(strings.TrimSpace(block[1]), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				break
+			}
+			if !strings.HasPrefix(line, "#") {
+				lines = append(lines, line)
+			}
+		}
+		queries = append(queries, strings.Join(lines, " "))
+	}
+	return queries
+}
+
+func FuzzLexer(f *testing.F) {
+	for _, query := range corpusQueries(f) {
+		f.Add(query)
+	}
+	f.Fuzz(func(t *testing.T, query string) {
+		lexer := NewLexer(query)
+		// The parser stops at the first token it doesn't expect, after which the lexer may not make progress
+		for i := 0; i <= len(query)+1; i++ {
+			var lval yySymType
+			if token := lexer.Lex(&lval); token == int(EOF) || token == int(ILLEGAL) {
+				return
+			}
+		}
+	})
+}
+
+func FuzzParseQuery(f *testing.F) {
+	for _, query := range corpusQueries(f) {
+		f.Add(query)
+	}
+	f.Fuzz(func(t *testing.T, query string) {
+		ast, err := ParseQuery(query)
+		if err != nil {
+			return
+		}
+		formatted := FormatQuery(ast)
+		reparsed, err := ParseQuery(formatted)
+		if err != nil {
+			t.Fatalf("formatting %q gave %q, which doesn't parse: %v", query, formatted, err)
+		}
+		if !reflect.DeepEqual(ast, reparsed) {
+			t.Fatalf("formatting %q gave %q, which parses to a different query", query, formatted)
+		}
+	})
+}
+
+func FuzzEvaluateFilters(f *testing.F) {
+	objects := []string{
+		`{"metadata": {"name": "web-0", "labels": {"app": "web"}, "creationTimestamp": "2024-01-01T00:00:00Z"}, "spec": {"replicas": 3, "containers": [{"image": "nginx"}]}}`,
+		`{"metadata": {"name": 1, "labels": null}, "spec": {"replicas": "3", "containers": {"image": ["nginx"]}}}`,
+		`{"metadata": [], "spec": 1.5}`,
+		`{"metadata": null, "spec": {"containers": [null], "replicas": null}}`,
+	}
+	for _, query := range corpusQueries(f) {
+		ast, err := ParseQuery(query)
+		if err != nil {
+			continue
+		}
+		for _, clause := range ast.Clauses {
+			if match, ok := clause.(*MatchClause); ok && len(match.ExtraFilters) > 0 {
+				// The filters are rendered for the node p
+				where := strings.TrimPrefix(formatWhere(match.ExtraFilters), " WHERE ")
+				where = regexp.MustCompile(`\b`+regexp.QuoteMeta(match.Nodes[0].ResourceProperties.Name)+`\.`).ReplaceAllString(where, "p.")
+				for _, object := range objects {
+					f.Add(where, []byte(object))
+				}
+			}
+		}
+	}
+	f.Fuzz(func(t *testing.T, where string, object []byte) {
+		ast, err := ParseQuery("MATCH (p:Pod) WHERE " + where + " RETURN p")
+		if err != nil {
+			return
+		}
+		var resource map[string]interface{}
+		if json.Unmarshal(object, &resource) != nil {
+			return
+		}
+		evaluateFilters(ast, resource)
+	})
+}
+
+// evaluateFilters evaluates the WHERE filters of the first MATCH of a query on a resource, returning whether they
+// select it
+func evaluateFilters(ast *Expression, resource map[string]interface{}) (bool, error) {
+	match := ast.Clauses[0].(*MatchClause)
+	q := &QueryExecutor{queryState: newQueryState()}
+	name := match.Nodes[0].ResourceProperties.Name
+	q.resultMap[name] = []map[string]interface{}{resource}
+	if err := q.applyExtraFilters(match.Nodes[0], match.ExtraFilters); err != nil {
+		return false, err
+	}
+	selected, _ := q.resultMap[name].([]map[string]interface{})
+	return len(selected) == 1, nil
+}
+
+// unstructuredObject is a resource of arbitrary shape, its fields named like those of the queries of the corpus
+type unstructuredObject map[string]interface{}
+
+var unstructuredFields = []string{"metadata", "name", "labels", "app", "spec", "replicas", "containers", "image", "status", "phase", "creationTimestamp", "nodeName"}
+
+func (unstructuredObject) Generate(r *rand.Rand, size int) reflect.Value {
+	object, _ := unstructuredValue(r, 4, true).(map[string]interface{})
+	return reflect.ValueOf(unstructuredObject(object))
+}
+
+func unstructuredValue(r *rand.Rand, depth int, object bool) interface{} {
+	kind := r.Intn(8)
+	if depth <= 0 {
+		kind = 3 + r.Intn(5)
+	}
+	if object || kind < 2 {
+		value := make(map[string]interface{})
+		for i := r.Intn(5); i >= 0; i-- {
+			value[unstructuredFields[r.Intn(len(unstructuredFields))]] = unstructuredValue(r, depth-1, false)
+		}
+		return value
+	}
+	switch kind {
+	case 0, 1, 2:
+		values := make([]interface{}, r.Intn(4))
+		for i := range values {
+			values[i] = unstructuredValue(r, depth-1, false)
+		}
+		return values
+	case 3:
+		return []string{"web", "2024-01-01T00:00:00Z", "", "3", "nginx:1.25", "100m"}[r.Intn(6)]
+	case 4:
+		return r.Int63n(20) - 10
+	case 5:
+		return r.NormFloat64() * 10
+	case 6:
+		return r.Intn(2) == 0
+	}
+	return nil
+}
+
+func TestFilterEvaluationTotality(t *testing.T) {
+	for _, query := range corpusQueries(t) {
+		ast, err := ParseQuery(query)
+		if err != nil {
+			continue
+		}
+		match, ok := ast.Clauses[0].(*MatchClause)
+		if !ok || len(match.ExtraFilters) == 0 {
+			continue
+		}
+		// Filters either select a resource or fail, whatever its fields hold
+		evaluates := func(object unstructuredObject) (ok bool) {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Logf("evaluating %q on %v panicked: %v", query, object, r)
+					ok = false
+				}
+			}()
+			evaluateFilters(ast, object)
+			return true
+		}
+		if err := quick.Check(evaluates, &quick.Config{MaxCount: 200}); err != nil {
+			t.Errorf("%q: %v", query, err)
+		}
+	}
+}
+
+func TestMutationTotality(t *testing.T) {
+	q := newTestQueryExecutor(t,
+		newTestObject("apps/v1", "Deployment", "default", "nginx", map[string]interface{}{"spec": map[string]interface{}{"replicas": int64(1)}}),
+		newTestObject("v1", "Service", "default", "nginx", nil),
+	)
+	for _, query := range corpusQueries(t) {
+		ast, err := ParseQuery(query)
+		if err != nil || !mutates(ast) {
+			continue
+		}
+		// Mutations either run or fail, whichever nodes they refer to
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("executing %q panicked: %v", query, r)
+				}
+			}()
+			q.Execute(ast, "default")
+		}()
+	}
+}
+
+// mutates tells whether a query sets or deletes the resources of its nodes
+func mutates(ast *Expression) bool {
+	for _, clause := range ast.Clauses {
+		switch clause.(type) {
+		case *SetClause, *DeleteClause:
+			return true
+		}
+	}
+	return false
+}
+
+func TestFormatQueryRoundTrip(t *testing.T) {
+	for _, query := range corpusQueries(t) {
+		ast, err := ParseQuery(query)
+		if err != nil {
+			continue
+		}
+		formatted := FormatQuery(ast)
+		reparsed, err := ParseQuery(formatted)
+		if err != nil {
+			t.Errorf("formatting %q gave %q, which doesn't parse: %v", query, formatted, err)
+			continue
+		}
+		if !reflect.DeepEqual(ast, reparsed) {
+			t.Errorf("formatting %q gave %q, which parses to a different query", query, formatted)
+		}
+		// Formatting is idempotent
+		if again := FormatQuery(reparsed); again != formatted {
+			t.Errorf("formatting %q twice gave %q, then %q", query, formatted, again)
+		}
+	}
+}
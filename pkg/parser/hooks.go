@@ -0,0 +1,60 @@
+package parser
+
+import "k8s.io/apimachinery/pkg/runtime/schema"
+
+// QueryHooks lets programs embedding the executor observe queries as they run, e.g. to
+// export metrics. Hooks left nil are skipped.
+type QueryHooks struct {
+	// OnAPICall is called for every list, create, patch or delete sent to the API server
+	OnAPICall func(verb string, gvr schema.GroupVersionResource)
+	// OnCacheLookup is called whenever a node's resources are looked up in the result cache
+	OnCacheLookup func(hit bool)
+	// OnClauseError is called with the clause (match, set, delete, create, with, return) a query failed in
+	OnClauseError func(clause string, err error)
+}
+
+// Hooks are the hooks used by every executor
+var Hooks QueryHooks
+
+// APICalls is the number of API calls made by the queries the executor ran
+func (q *QueryExecutor) APICalls() int64 {
+	return q.apiCalls.Load()
+}
+
+func (q *QueryExecutor) observeAPICall(verb string, gvr schema.GroupVersionResource) {
+	q.apiCalls.Add(1)
+	if Hooks.OnAPICall != nil {
+		Hooks.OnAPICall(verb, gvr)
+	}
+}
+
+func observeCacheLookup(hit bool) {
+	if Hooks.OnCacheLookup != nil {
+		Hooks.OnCacheLookup(hit)
+	}
+}
+
+// clauseName is the name a clause is reported under in OnClauseError
+func clauseName(clause Clause) string {
+	switch c := clause.(type) {
+	case *MatchClause:
+		return "match"
+	case *SetClause:
+		return "set"
+	case *DeleteClause:
+		return "delete"
+	case *OperationClause:
+		return c.Operation
+	case *CreateClause:
+		return "create"
+	case *MergeClause:
+		return "merge"
+	case *WithClause:
+		return "with"
+	case *UnwindClause:
+		return "unwind"
+	case *ReturnClause:
+		return "return"
+	}
+	return "unknown"
+}
@@ -0,0 +1,47 @@
+package parser
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestQueryHooks(t *testing.T) {
+	q := newTestQueryExecutor(t,
+		newTestObject("v1", "Pod", "default", "web-1", nil),
+	)
+
+	var apiCalls []string
+	var lookups []bool
+	var clauses []string
+	Hooks = QueryHooks{
+		OnAPICall: func(verb string, gvr schema.GroupVersionResource) {
+			apiCalls = append(apiCalls, verb+" "+gvr.Resource)
+		},
+		OnCacheLookup: func(hit bool) { lookups = append(lookups, hit) },
+		OnClauseError: func(clause string, err error) { clauses = append(clauses, clause) },
+	}
+	defer func() { Hooks = QueryHooks{} }()
+
+	executeTestQuery(t, q, `MATCH (p:Pod) SET p.metadata.labels.team = "web" RETURN p.metadata.name`)
+	if len(apiCalls) != 2 || apiCalls[0] != "list pods" || apiCalls[1] != "patch pods" {
+		t.Errorf("expected a list and a patch of pods, got %v", apiCalls)
+	}
+	if len(lookups) == 0 || lookups[0] {
+		t.Errorf("expected the first cache lookup to miss, got %v", lookups)
+	}
+	if len(clauses) != 0 {
+		t.Errorf("expected no clause errors, got %v", clauses)
+	}
+
+	ast, err := ParseQuery(`MATCH (p:Pod) RETURN q.metadata.name`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	if _, err := q.Execute(ast, "default"); err == nil {
+		t.Fatalf("expected returning an unknown node to fail")
+	}
+	if len(clauses) != 1 || clauses[0] != "return" {
+		t.Errorf("expected an error in the return clause, got %v", clauses)
+	}
+}
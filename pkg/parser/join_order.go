@@ -0,0 +1,327 @@
+package parser
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+// The node patterns of a MATCH clause are otherwise listed whole and joined client-side, so that matching the pods
+// of a single named Deployment lists every pod of the namespace. When one of the nodes of a clause is more
+// selective than the nodes it's related to, e.g. because it has a name, it's listed first, and the resources it
+// matched narrow the list calls of the nodes related to it, which narrow those of the next ones in turn:
+//
+//   - a field of the other node compared to a field selector the API server supports, e.g. metadata.name or the
+//     spec.nodeName of pods, becomes a field selector when the resources listed have a single value for it
+//   - labels the other node's resources must have, e.g. those of the selector of a Service, become a label selector
+//     of the labels every resource listed has in common
+//   - resources owned by workloads are narrowed by the selector of their owners, which they always match
+//
+// The relationships are still evaluated as before on the narrowed lists, so narrowing only saves list calls and
+// never changes the result. EXPLAIN shows the order, and the selectors each node is narrowed with.
+
+// Estimated cardinalities of node patterns that aren't listed yet
+const (
+	namedCardinality      = 1
+	selectedCardinality   = 100
+	unselectedCardinality = 10000
+)
+
+// joinStep narrows the list call of a node pattern with the resources of another, listed before it
+type joinStep struct {
+	from, to  *NodePattern
+	pushdowns []joinPushdown
+}
+
+// joinPushdown is a selector of the node narrowed, taken from the resources of the node listed before it
+type joinPushdown struct {
+	// field is the field selector set to the value of path, or empty for a label selector of the labels at path
+	field string
+	path  string
+}
+
+// ownerSelectorKinds are the kinds of workloads whose selector the resources they own always match
+var ownerSelectorKinds = map[string]bool{"deployments": true, "replicasets": true, "statefulsets": true, "daemonsets": true, "jobs": true}
+
+const ownerReferenceNames = "$.metadata.ownerReferences[].name"
+
+// estimateCardinality estimates how many resources a node pattern matches: how many were listed if they were,
+// otherwise whether it has a name or other selectors
+func (q *QueryExecutor) estimateCardinality(n *NodePattern) int {
+	if resources, ok := q.resultCache[q.resourcePropertyName(n)].([]map[string]interface{}); ok {
+		return len(resources)
+	}
+	fieldSelector, labelSelector, err := q.nodeSelectors(n)
+	switch {
+	case err != nil:
+		return unselectedCardinality
+	case strings.Contains(","+fieldSelector, ",metadata.name="):
+		return namedCardinality
+	case fieldSelector != "" || labelSelector != "":
+		return selectedCardinality
+	}
+	return unselectedCardinality
+}
+
+// planJoins picks the node pattern of a MATCH clause to list first, and the nodes its resources narrow the list
+// calls of, in order. There are no steps when no node is more selective than those related to it.
+func (q *QueryExecutor) planJoins(c *MatchClause) (*NodePattern, []joinStep) {
+	if len(c.Relationships) == 0 {
+		return nil, nil
+	}
+	estimates := make(map[*NodePattern]int)
+	var candidates []*NodePattern
+	for _, n := range c.Nodes {
+		// A namespace property sets the namespace of the nodes evaluated after it, so the order is kept
+		if hasNamespaceProperty(n) {
+			return nil, nil
+		}
+		if n.ResourceProperties.Kind == "" || IsMultiKindPattern(n.ResourceProperties.Kind) || q.resourcePropertyName(n) == "" {
+			continue
+		}
+		estimates[n] = q.estimateCardinality(n)
+		candidates = append(candidates, n)
+	}
+	if len(candidates) < 2 {
+		return nil, nil
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return estimates[candidates[i]] < estimates[candidates[j]]
+	})
+	start := candidates[0]
+	if estimates[start] >= unselectedCardinality {
+		return nil, nil
+	}
+
+	var steps []joinStep
+	ordered := map[*NodePattern]bool{start: true}
+	for progress := true; progress; {
+		progress = false
+		for _, rel := range c.Relationships {
+			from, to := rel.LeftNode, rel.RightNode
+			if ordered[to] {
+				from, to = to, from
+			}
+			if !ordered[from] || ordered[to] {
+				continue
+			}
+			if _, ok := estimates[to]; !ok || estimates[to] <= estimates[from] {
+				continue
+			}
+			pushdowns := q.joinPushdowns(rel, from, to)
+			if len(pushdowns) == 0 {
+				continue
+			}
+			steps = append(steps, joinStep{from: from, to: to, pushdowns: pushdowns})
+			estimates[to] = min(estimates[to], selectedCardinality)
+			ordered[to] = true
+			progress = true
+		}
+	}
+	if len(steps) == 0 {
+		return nil, nil
+	}
+	return start, steps
+}
+
+// joinPushdowns are the selectors the resources of from can narrow the list call of to with, through the rule
+// relating them
+func (q *QueryExecutor) joinPushdowns(rel *Relationship, from, to *NodePattern) []joinPushdown {
+	if rel.Hops != nil || isKindlessRelationship(rel) {
+		return nil
+	}
+	rule, leftKind, rightKind, err := q.relationshipRule(rel)
+	if err != nil || rule.analyzer != "" || rule.Relationship == NamespaceHasResource || (rule.MatchAny && len(rule.MatchCriteria) > 1) {
+		return nil
+	}
+	fromKind, toKind := leftKind.Resource, rightKind.Resource
+	if from == rel.RightNode {
+		fromKind, toKind = toKind, fromKind
+	}
+	var toIsA bool
+	switch {
+	case fromKind == toKind:
+		return nil
+	case strings.EqualFold(toKind, rule.KindA) && strings.EqualFold(fromKind, rule.KindB):
+		toIsA = true
+	case strings.EqualFold(toKind, rule.KindB) && strings.EqualFold(fromKind, rule.KindA):
+	default:
+		return nil
+	}
+
+	var pushdowns []joinPushdown
+	for _, criterion := range rule.MatchCriteria {
+		toField, fromField := criterion.FieldB, criterion.FieldA
+		if toIsA {
+			toField, fromField = criterion.FieldA, criterion.FieldB
+		}
+		switch criterion.ComparisonType {
+		case ExactMatch:
+			if field, ok := fieldSelectorKey(toKind, strings.TrimPrefix(toField, "$.")); ok && !strings.Contains(fromField, "?") {
+				pushdowns = append(pushdowns, joinPushdown{field: field, path: fromField})
+			} else if toField == ownerReferenceNames && ownerSelectorKinds[fromKind] {
+				pushdowns = append(pushdowns, joinPushdown{path: "$.spec.selector.matchLabels"})
+			}
+		case ContainsAll:
+			// The resources of A have all the labels of B, which a label selector can only ask of their own labels
+			if toIsA && toField == "$.metadata.labels" {
+				pushdowns = append(pushdowns, joinPushdown{path: fromField})
+			}
+		}
+	}
+	return pushdowns
+}
+
+// selectors renders the pushdowns of a step with the resources listed for its from node, if they narrow the list
+func (s joinStep) selectors(resources []map[string]interface{}) (plannedSelectors, bool) {
+	var fieldSelectors, labelSelectors []string
+	for _, pushdown := range s.pushdowns {
+		if pushdown.field != "" {
+			values := joinFieldValues(resources, pushdown.path)
+			// Field selectors can't match one of several values
+			if len(values) == 1 {
+				fieldSelectors = append(fieldSelectors, pushdown.field+"="+fields.EscapeValue(values[0]))
+			}
+			continue
+		}
+		if labels, ok := joinCommonLabels(resources, pushdown.path); ok {
+			labelSelectors = append(labelSelectors, labels...)
+		}
+	}
+	selectors := plannedSelectors{fieldSelector: strings.Join(fieldSelectors, ","), labelSelector: strings.Join(labelSelectors, ",")}
+	return selectors, selectors.fieldSelector != "" || selectors.labelSelector != ""
+}
+
+// joinFieldValues are the distinct string values of path in resources
+func joinFieldValues(resources []map[string]interface{}, path string) []string {
+	seen := make(map[string]bool)
+	var values []string
+	var collect func(value interface{})
+	collect = func(value interface{}) {
+		switch v := value.(type) {
+		case string:
+			if !seen[v] {
+				seen[v] = true
+				values = append(values, v)
+			}
+		case []interface{}:
+			for _, item := range v {
+				collect(item)
+			}
+		}
+	}
+	for _, resource := range resources {
+		if value, err := jsonPathLookup(resource, strings.ReplaceAll(path, "[]", "")); err == nil {
+			collect(value)
+		}
+	}
+	return values
+}
+
+// joinCommonLabels are the requirements of the labels at path every resource has, sorted. Without resources, or
+// when one of them has no labels there, nothing is known of the resources they relate.
+func joinCommonLabels(resources []map[string]interface{}, path string) ([]string, bool) {
+	var common map[string]interface{}
+	for _, resource := range resources {
+		value, err := jsonPathLookup(resource, strings.ReplaceAll(path, "[]", ""))
+		labels, ok := value.(map[string]interface{})
+		if err != nil || !ok || len(labels) == 0 {
+			return nil, false
+		}
+		if common == nil {
+			common = make(map[string]interface{}, len(labels))
+			for key, value := range labels {
+				common[key] = value
+			}
+			continue
+		}
+		for key, value := range common {
+			if labels[key] != value {
+				delete(common, key)
+			}
+		}
+	}
+	var requirements []string
+	for key, value := range common {
+		if s, ok := value.(string); ok {
+			requirements = append(requirements, key+"="+s)
+		}
+	}
+	sort.Strings(requirements)
+	return requirements, len(requirements) > 0
+}
+
+// orderJoins lists the most selective node pattern of a MATCH clause first, and the nodes related to it with the
+// selectors its resources give them. Nodes whose selectors aren't known, e.g. because the resources listed have
+// several values for a field, are left to be listed as usual.
+func (q *QueryExecutor) orderJoins(c *MatchClause) error {
+	start, steps := q.planJoins(c)
+	if start == nil {
+		return nil
+	}
+	if err := getNodeResources(start, q, c.ExtraFilters); err != nil {
+		return err
+	}
+	listed := map[*NodePattern]bool{start: true}
+	for _, step := range steps {
+		if !listed[step.from] {
+			continue
+		}
+		resources, _ := q.resultMap[step.from.ResourceProperties.Name].([]map[string]interface{})
+		selectors, ok := step.selectors(resources)
+		if !ok {
+			continue
+		}
+		logDebug("Narrowing the list of a node by a related node", "node", step.to.ResourceProperties.Name, "from", step.from.ResourceProperties.Name, "fieldSelector", selectors.fieldSelector, "labelSelector", selectors.labelSelector)
+		if q.joinSelectors == nil {
+			q.joinSelectors = make(map[*NodePattern]plannedSelectors)
+		}
+		q.joinSelectors[step.to] = selectors
+		if err := getNodeResources(step.to, q, c.ExtraFilters); err != nil {
+			return err
+		}
+		listed[step.to] = true
+	}
+	return nil
+}
+
+// joinOrder orders the node patterns of a clause as they're listed: the node listed first, the nodes it narrows
+// in order, then the others
+func joinOrder(nodes []*NodePattern, start *NodePattern, steps []joinStep) []*NodePattern {
+	if start == nil {
+		return nodes
+	}
+	ordered := []*NodePattern{start}
+	for _, step := range steps {
+		ordered = append(ordered, step.to)
+	}
+	for _, n := range nodes {
+		if !slices.Contains(ordered, n) {
+			ordered = append(ordered, n)
+		}
+	}
+	return ordered
+}
+
+// explain describes the selectors a step narrows the list call of its node with
+func (p joinPushdown) explain(from string) string {
+	path := from + "." + strings.TrimPrefix(p.path, "$.")
+	if p.field == "" {
+		return "labelSelector: the labels of " + path
+	}
+	return fmt.Sprintf("fieldSelector: %s=%s", p.field, path)
+}
+
+// joinSelectorList adds the requirements of a selector pushed down by a join to those of the node pattern
+func joinSelectorList(selector, pushed string) string {
+	if selector == "" {
+		return pushed
+	}
+	if pushed == "" {
+		return selector
+	}
+	return selector + "," + pushed
+}
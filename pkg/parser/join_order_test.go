@@ -0,0 +1,77 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestJoinOrder(t *testing.T) {
+	labels := func(values ...string) map[string]interface{} {
+		m := map[string]interface{}{}
+		for i := 0; i < len(values); i += 2 {
+			m[values[i]] = values[i+1]
+		}
+		return m
+	}
+	owned := func(name, owner string, podLabels map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"metadata": map[string]interface{}{"name": name, "namespace": "default", "labels": podLabels, "ownerReferences": []interface{}{map[string]interface{}{"name": owner}}},
+			"spec":     map[string]interface{}{"selector": map[string]interface{}{"matchLabels": podLabels}},
+		}
+	}
+	q := newTestQueryExecutor(t,
+		newTestObject("apps/v1", "Deployment", "default", "web", map[string]interface{}{
+			"spec": map[string]interface{}{"selector": map[string]interface{}{"matchLabels": labels("app", "web")}},
+		}),
+		newTestObject("apps/v1", "ReplicaSet", "default", "web-5d8f", owned("web-5d8f", "web", labels("app", "web", "pod-template-hash", "5d8f"))),
+		newTestObject("apps/v1", "ReplicaSet", "default", "api-7c9b", owned("api-7c9b", "api", labels("app", "api", "pod-template-hash", "7c9b"))),
+		newTestObject("v1", "Pod", "default", "web-5d8f-x", owned("web-5d8f-x", "web-5d8f", labels("app", "web", "pod-template-hash", "5d8f"))),
+		newTestObject("v1", "Pod", "default", "api-7c9b-y", owned("api-7c9b-y", "api-7c9b", labels("app", "api", "pod-template-hash", "7c9b"))),
+	)
+	client := q.DynamicClient.(*fake.FakeDynamicClient)
+	query := `MATCH (p:Pod)->(rs:ReplicaSet)->(d:Deployment {name: "web"}) RETURN p.metadata.name`
+
+	// The named deployment is listed first, and narrows the replica sets, which narrow the pods
+	plan := executeTestQuery(t, q, "EXPLAIN "+query).Data["plan"].(*QueryPlan)
+	var order []string
+	for _, node := range plan.Nodes {
+		order = append(order, node.Node)
+	}
+	if !reflect.DeepEqual(order, []string{"d", "rs", "p"}) {
+		t.Errorf("expected the deployment to be listed first, got %v", order)
+	}
+	if rs := plan.Nodes[1]; rs.JoinedFrom != "d" || !reflect.DeepEqual(rs.JoinSelectors, []string{"labelSelector: the labels of d.spec.selector.matchLabels"}) {
+		t.Errorf("expected the replica sets to be narrowed by the deployment, got %+v", rs)
+	}
+
+	client.ClearActions()
+	result := executeTestQuery(t, q, query)
+	if rows := result.Data["p"].([]interface{}); len(rows) != 1 || rows[0].(map[string]interface{})["name"] != "web-5d8f-x" {
+		t.Errorf("expected the pod of the deployment, got %v", rows)
+	}
+	selectors := map[string]string{}
+	for _, action := range client.Actions() {
+		switch action := action.(type) {
+		case k8stesting.ListAction:
+			selectors[action.GetResource().Resource] = action.GetListRestrictions().Labels.String()
+		case k8stesting.GetAction:
+			selectors[action.GetResource().Resource] = "name=" + action.GetName()
+		}
+	}
+	expected := map[string]string{"deployments": "name=web", "replicasets": "app=web", "pods": "app=web,pod-template-hash=5d8f"}
+	if !reflect.DeepEqual(selectors, expected) {
+		t.Errorf("expected the list calls to be narrowed, got %v", selectors)
+	}
+
+	// Without a selective node, the nodes are listed as they were
+	ast, err := ParseQuery(`MATCH (p:Pod)->(rs:ReplicaSet) RETURN p`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if start, steps := q.planJoins(ast.Clauses[0].(*MatchClause)); start != nil || steps != nil {
+		t.Errorf("expected no join order, got %v", start)
+	}
+}
@@ -2,13 +2,22 @@ package parser
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/disk"
+	"k8s.io/client-go/discovery/cached/memory"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/oidc"
@@ -33,23 +42,24 @@ var ResourceSpecs = make(map[string][]string)
 // 	initResourceSpecs()
 // }
 
-func InitResourceSpecs() {
+// InitResourceSpecs loads the fields of every resource from the OpenAPI schemas, for completion and relationships.
+// On error the specs stay as they were.
+func InitResourceSpecs() error {
 	specs, err := GetOpenAPIResourceSpecs()
 	if err != nil {
-		fmt.Println("Error fetching resource specs:", err)
-		return
+		return newDiagnosticError(CodeResourceSpecsFailed, err)
 	}
 	ResourceSpecs = specs
 	// Initialize relationships after specs are loaded
 	initializeRelationships()
+	return nil
 }
 
 func GetQueryExecutorInstance() *QueryExecutor {
 	once.Do(func() {
 		executor, err := NewQueryExecutor()
 		if err != nil {
-			// Handle error
-			fmt.Println("Error creating QueryExecutor instance:", err)
+			Logger().Error("Error creating QueryExecutor instance", "error", err)
 			return
 		}
 		executorInstance = executor
@@ -62,9 +72,104 @@ type QueryExecutor struct {
 	DynamicClient  dynamic.Interface
 	requestChannel chan *apiRequest
 	semaphore      chan struct{}
+	// workers guards requestChannel against Close
+	workers *requestWorkers
+	// Ledger, if set, records the changes queries make and skips those it already holds
+	Ledger *Ledger
+	// Rollout, if set, applies the changes of queries in waves
+	Rollout *Rollout
+	// Atomic, if set, rolls back the changes a query made when it fails
+	Atomic bool
+	// Hide, if set, leaves the resources it reports out of the rows and aggregates of RETURN. It's given the UID
+	// of each resource, or kind/namespace/name for objects without one, which the rows then carry as _uid.
+	// Matching, relationships and changes aren't affected.
+	Hide func(uid string) bool
+	// Rows, if set, adds the Rows of RETURN to the results of queries. Where Data keeps the values of each node
+	// apart, nested under the keys of their paths, Rows has a row per combination of resources the query matched
+	// together, e.g. a Deployment with each of its Pods for MATCH (d:Deployment)->(rs:ReplicaSet)->(p:Pod) RETURN
+	// d.metadata.name, p.metadata.name. A row has a column per RETURN item, named by its alias or else as the item is
+	// written, e.g. p.metadata.name or count{p}. The relationships of the query's MATCH clauses decide which resources
+	// are combined: the resources of nodes no relationship connects are combined with every other, and a node an
+	// OPTIONAL MATCH found nothing for is null. Rows with aggregates have a row per distinct value of the other items,
+	// like those of WITH.
+	Rows bool
+	// podLogs, if set, reads pod logs instead of the Clientset
+	podLogs podLogsFunc
+	// accessReview, if set, reviews access instead of the Clientset
+	accessReview accessReviewFunc
+	// user is who the API calls are made as, which audited changes are recorded with
+	user *executorUser
+	// protobuf, if set, lists the resources of the built-in kinds as protobuf
+	protobuf *protobufLister
+	// listCache holds the resources listed by the executor's queries, and its forks', for CacheTTL
+	listCache *listCache
+	// prepared are the queries prepared by the executor and its forks
+	prepared *preparedQueries
+	// ctx is the context of the running query, applied the changes it made so far, and undo how to undo them if
+	// it's Atomic
+	ctx     context.Context
+	applied []string
+	undo    []undoStep
+	// apiCalls counts the API calls the executor made
+	apiCalls atomic.Int64
+	queryState
+}
+
+// Fork returns an executor making its API calls through the same clients and workers as q, with a query state of
+// its own, so that it can run a query while q and other forks run theirs. Hide and Rows are carried over, the
+// Ledger, Rollout and Atomic aren't.
+func (q *QueryExecutor) Fork() *QueryExecutor {
+	return &QueryExecutor{
+		Clientset:      q.Clientset,
+		DynamicClient:  q.DynamicClient,
+		requestChannel: q.requestChannel,
+		semaphore:      q.semaphore,
+		workers:        q.workers,
+		Hide:           q.Hide,
+		Rows:           q.Rows,
+		podLogs:        q.podLogs,
+		accessReview:   q.accessReview,
+		user:           q.user,
+		protobuf:       q.protobuf,
+		listCache:      q.listCache,
+		prepared:       q.prepared,
+		queryState:     newQueryState(),
+	}
+}
+
+// context is the context API calls of the running query are made with
+func (q *QueryExecutor) context() context.Context {
+	if q.ctx == nil {
+		return context.Background()
+	}
+	return q.ctx
+}
+
+// recordChange notes a change made by the running query, e.g. "deleted pods default/web-1", with how to undo it
+// if the query is Atomic, and writes it to the ledger and the audit log
+func (q *QueryExecutor) recordChange(entry LedgerEntry, undo func() (*undoStep, error)) error {
+	name := entry.Name
+	if entry.Namespace != "" {
+		name = entry.Namespace + "/" + name
+	}
+	q.applied = append(q.applied, entry.Verb+" "+entry.Resource+" "+name)
+	if err := q.recordUndo(entry, undo); err != nil {
+		return err
+	}
+	if q.Ledger != nil {
+		if err := q.Ledger.record(entry); err != nil {
+			return err
+		}
+	}
+	return q.audit(entry, false)
+}
+
+func newLedgerEntry(verb string, gvr schema.GroupVersionResource, namespace, name string) LedgerEntry {
+	return LedgerEntry{Verb: verb, Group: gvr.Group, Version: gvr.Version, Resource: gvr.Resource, Namespace: namespace, Name: name}
 }
 
 type apiRequest struct {
+	executor      *QueryExecutor
 	kind          string
 	fieldSelector string
 	labelSelector string
@@ -77,46 +182,129 @@ type apiResponse struct {
 }
 
 func NewQueryExecutor() (*QueryExecutor, error) {
+	return NewQueryExecutorForContext("")
+}
+
+// SetQueryExecutorInstance replaces the executor returned by GetQueryExecutorInstance,
+// e.g. when the shell switches to a session bound to another cluster.
+func SetQueryExecutorInstance(executor *QueryExecutor) {
+	once.Do(func() {})
+	executorInstance = executor
+}
+
+// Kubeconfig is the kubeconfig file to use instead of $KUBECONFIG or ~/.kube/config, like kubectl's --kubeconfig
+var Kubeconfig string
+
+// KubeContext is the kubeconfig context used instead of the current one, like kubectl's --context
+var KubeContext string
+
+// KubeClientConfig loads the kubeconfig the way kubectl does, honoring $KUBECONFIG, Kubeconfig and the
+// named context, which defaults to KubeContext and then to the current context.
+func KubeClientConfig(contextName string) clientcmd.ClientConfig {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = Kubeconfig
+	if contextName == "" {
+		contextName = KubeContext
+	}
+	configOverrides := &clientcmd.ConfigOverrides{CurrentContext: contextName}
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, configOverrides)
+}
+
+// NewQueryExecutorForContext creates an executor for the named kubeconfig context. An empty name uses
+// KubeContext if set, then the in-cluster config if available, and the current context otherwise.
+func NewQueryExecutorForContext(contextName string) (*QueryExecutor, error) {
+	config, err := restConfigForContext(contextName)
+	if err != nil {
+		return nil, err
+	}
+	executor, err := newQueryExecutorForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create the cached discovery client shared by all GVR lookups
+	discoveryClient, err := newCachedDiscoveryClient(config, executor.Clientset)
+	if err != nil {
+		return nil, newDiagnosticError(CodeClientCreation, err, "client", "discovery client")
+	}
+	setDiscoveryClient(discoveryClient)
+
+	return executor, nil
+}
+
+// NewImpersonatingQueryExecutor creates an executor like NewQueryExecutor whose API calls are made as the given
+// user and groups, e.g. for the authenticated users of the web interface. Discovery is still shared, and done as
+// the configured identity, which must be allowed to impersonate users and groups.
+func NewImpersonatingQueryExecutor(user string, groups []string) (*QueryExecutor, error) {
+	config, err := restConfigForContext("")
+	if err != nil {
+		return nil, err
+	}
+	config = rest.CopyConfig(config)
+	config.Impersonate = rest.ImpersonationConfig{UserName: user, Groups: groups}
+	return newQueryExecutorForConfig(config)
+}
+
+// restConfigForContext loads the client config of the named kubeconfig context, see NewQueryExecutorForContext
+func restConfigForContext(contextName string) (*rest.Config, error) {
 	var config *rest.Config
 	var err error
 
+	if contextName == "" {
+		contextName = KubeContext
+	}
 	// First, try to use in-cluster config
-	config, err = rest.InClusterConfig()
-	if err != nil {
+	inCluster := contextName == "" && Kubeconfig == ""
+	if inCluster {
+		config, err = rest.InClusterConfig()
+	}
+	if !inCluster || err != nil {
 		// If that fails, use the kubeconfig file(s)
-		loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
-		configOverrides := &clientcmd.ConfigOverrides{}
-		kubeConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, configOverrides)
-
-		config, err = kubeConfig.ClientConfig()
+		config, err = KubeClientConfig(contextName).ClientConfig()
 		if err != nil {
-			return nil, fmt.Errorf("failed to create config: not found in $KUBECONFIG, ~/.kube/config, or in-cluster")
+			if contextName != "" {
+				return nil, newDiagnosticError(CodeContextConfig, err, "context", contextName)
+			}
+			return nil, newDiagnosticError(CodeKubeconfigNotFound, nil)
 		}
 	}
+	return config, nil
+}
 
+func newQueryExecutorForConfig(config *rest.Config) (*QueryExecutor, error) {
+	applyRateLimits(config)
 	// Create the clientset
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
-		return nil, fmt.Errorf("error creating clientset: %v", err)
+		return nil, newDiagnosticError(CodeClientCreation, err, "client", "clientset")
 	}
 
 	// Create the dynamic client
 	dynamicClient, err := dynamic.NewForConfig(config)
 	if err != nil {
-		return nil, fmt.Errorf("error creating dynamic client: %v", err)
+		return nil, newDiagnosticError(CodeClientCreation, err, "client", "dynamic client")
 	}
 
 	// Initialize the semaphore with a desired concurrency level
-	semaphore := make(chan struct{}, 1) // Set to '1' for single concurrent request
+	workers := max(APIWorkers, 1)
+	semaphore := make(chan struct{}, workers)
 
 	executor := &QueryExecutor{
 		Clientset:      clientset,
 		DynamicClient:  dynamicClient,
 		requestChannel: make(chan *apiRequest), // Unbuffered channel
 		semaphore:      semaphore,
+		workers:        &requestWorkers{},
+		user:           newExecutorUser(config, clientset),
+		protobuf:       newProtobufLister(config),
+		listCache:      newListCache(),
+		prepared:       newPreparedQueries(),
+		queryState:     newQueryState(),
 	}
 
-	go executor.processRequests()
+	for range workers {
+		go executor.processRequests()
+	}
 
 	return executor, nil
 }
@@ -129,18 +317,54 @@ func (q *QueryExecutor) GetDynamicClient() dynamic.Interface {
 	return q.DynamicClient
 }
 
+func (q *QueryExecutor) GetDiscoveryClient() discovery.CachedDiscoveryInterface {
+	return getDiscoveryClient(q.Clientset)
+}
+
+// requestWorkers is whether the workers of an executor and its forks were stopped by Close
+type requestWorkers struct {
+	mu     sync.RWMutex
+	closed bool
+}
+
+// errExecutorClosed is the error of the API calls of an executor after Close
+var errExecutorClosed = errors.New("the query executor is closed")
+
+// Close stops the workers making the API calls of q and its forks, once the calls they were given are made. The
+// queries of q and its forks fail from then on. Executors that aren't used anymore, e.g. those impersonating users
+// that stopped making requests, must be closed for their workers not to run forever.
+func (q *QueryExecutor) Close() {
+	if q.workers == nil {
+		return
+	}
+	q.workers.mu.Lock()
+	defer q.workers.mu.Unlock()
+	if !q.workers.closed {
+		q.workers.closed = true
+		close(q.requestChannel)
+	}
+}
+
 func (q *QueryExecutor) processRequests() {
 	for request := range q.requestChannel {
 		q.semaphore <- struct{}{} // Acquire a token
-		list, err := q.fetchResources(request.kind, request.fieldSelector, request.labelSelector)
+		list, err := request.executor.fetchResources(request.kind, request.fieldSelector, request.labelSelector)
 		<-q.semaphore // Release the token
 		request.responseChan <- &apiResponse{list: &list, err: err}
 	}
 }
 
 func (q *QueryExecutor) getK8sResources(kind string, fieldSelector string, labelSelector string) (*unstructured.UnstructuredList, error) {
+	if q.workers != nil {
+		q.workers.mu.RLock()
+		defer q.workers.mu.RUnlock()
+		if q.workers.closed {
+			return nil, errExecutorClosed
+		}
+	}
 	responseChan := make(chan *apiResponse)
 	q.requestChannel <- &apiRequest{
+		executor:      q,
 		kind:          kind,
 		fieldSelector: fieldSelector,
 		labelSelector: labelSelector,
@@ -153,44 +377,247 @@ func (q *QueryExecutor) getK8sResources(kind string, fieldSelector string, label
 
 func (q *QueryExecutor) fetchResources(kind string, fieldSelector string, labelSelector string) (unstructured.UnstructuredList, error) {
 	labelSelector = strings.ReplaceAll(labelSelector, "\"", "")
-	// Use discovery client to find the GVR for the given kind
-	gvr, err := FindGVR(q.Clientset, kind)
+	// Use discovery client to find the GVR(s) for the given kind
+	targets, err := listTargetsForKind(q.Clientset, kind, q.namespace)
 	if err != nil {
 		var emptyList unstructured.UnstructuredList
 		return emptyList, err
 	}
 
 	// Use dynamic client to list resources
-	logDebug("Listing resources of kind:", kind, "with fieldSelector:", fieldSelector, "and labelSelector:", labelSelector)
-	labelSelectorParsed, err := metav1.ParseToLabelSelector(labelSelector)
+	logDebug("Listing resources", "kind", kind, "fieldSelector", fieldSelector, "labelSelector", labelSelector)
+	labelMap, err := parseLabelSelector(labelSelector)
 	if err != nil {
-		fmt.Println("Error parsing label selector: ", err)
 		var emptyList unstructured.UnstructuredList
 		return emptyList, err
 	}
+
+	name, named := namedResource(fieldSelector, labelMap)
+	var result unstructured.UnstructuredList
+	for _, target := range targets {
+		var list *unstructured.UnstructuredList
+		ctx, cancel := listContext(q.context(), target.gvr)
+		if named && kind != "*" && target.gets(q.namespace) {
+			q.observeAPICall("get", target.gvr)
+			list, err = q.getResource(ctx, target, name)
+		} else {
+			q.observeAPICall("list", target.gvr)
+			list, err = q.listResources(ctx, target, metav1.ListOptions{
+				FieldSelector: fieldSelector,
+				LabelSelector: labelMap,
+			})
+			if err != nil {
+				err = q.listError(ctx, target.gvr, err)
+			}
+		}
+		cancel()
+		if err != nil {
+			if kind == "*" {
+				// A wildcard can't expect every resource to be listable, skip the ones we can't read
+				logDebug("Skipping resource in wildcard match", "resource", target.gvr.String(), "error", err)
+				continue
+			}
+			var emptyList unstructured.UnstructuredList
+			return emptyList, err
+		}
+		if len(targets) == 1 {
+			return *list, nil
+		}
+		for _, item := range list.Items {
+			target.tag(&item)
+			result.Items = append(result.Items, item)
+		}
+	}
+	return result, nil
+}
+
+// parseLabelSelector validates a label selector and returns it in canonical form
+func parseLabelSelector(labelSelector string) (string, error) {
+	labelSelectorParsed, err := metav1.ParseToLabelSelector(labelSelector)
+	if err != nil {
+		return "", newDiagnosticError(CodeInvalidLabelSelector, err)
+	}
 	labelMap, err := metav1.LabelSelectorAsSelector(labelSelectorParsed)
 	if err != nil {
-		fmt.Println("Error converting label selector to label map: ", err)
-		var emptyList unstructured.UnstructuredList
-		return emptyList, err
+		return "", newDiagnosticError(CodeInvalidLabelSelector, err)
 	}
+	return labelMap.String(), nil
+}
 
-	list, err := q.DynamicClient.Resource(gvr).Namespace(Namespace).List(context.Background(), metav1.ListOptions{
-		FieldSelector: fieldSelector,
-		LabelSelector: labelMap.String(),
-	})
+// listTarget is a single list call made to serve a node pattern
+type listTarget struct {
+	gvr        schema.GroupVersionResource
+	kind       string
+	tagGVR     bool
+	namespaced bool
+}
+
+// resource is the client listing the target's resources in namespace, or across the cluster for cluster-scoped
+// resources such as PersistentVolumes, which no namespace holds
+func (target listTarget) resource(client dynamic.Interface, namespace string) dynamic.ResourceInterface {
+	if !target.namespaced {
+		return client.Resource(target.gvr)
+	}
+	return client.Resource(target.gvr).Namespace(namespace)
+}
+
+// tag marks an item listed for a multi-target node with its kind, and with its GVR when
+// the kind alone is ambiguous
+func (target listTarget) tag(item *unstructured.Unstructured) {
+	if item.GetKind() == "" {
+		item.SetKind(target.kind)
+	}
+	if target.tagGVR {
+		item.Object["_gvr"] = gvrColumnValue(target.gvr)
+	}
+}
+
+// IsMultiKindPattern reports whether a node's kind matches several kinds at once,
+// either as a wildcard (x:*) or as alternatives (x:Deployment|StatefulSet).
+func IsMultiKindPattern(kind string) bool {
+	return kind == "*" || strings.Contains(kind, "|")
+}
+
+func listTargetsForKind(clientset kubernetes.Interface, kind string, namespace string) ([]listTarget, error) {
+	if kind == "*" {
+		return listTargetsForWildcard(clientset, namespace)
+	}
+
+	var targets []listTarget
+	for _, identifier := range strings.Split(kind, "|") {
+		resolutions, err := ResolveKind(clientset, identifier)
+		if err != nil {
+			return nil, err
+		}
+		if len(resolutions) > 1 && !MatchAllGVRs {
+			resolution, err := resolveOne(identifier, resolutions)
+			if err != nil {
+				return nil, err
+			}
+			resolutions = []KindResolution{resolution}
+		}
+		for _, resolution := range resolutions {
+			if containsListTarget(targets, resolution.GVR) {
+				continue
+			}
+			targets = append(targets, listTarget{
+				gvr:        resolution.GVR,
+				kind:       resolution.Kind,
+				tagGVR:     len(resolutions) > 1,
+				namespaced: resolution.Namespaced,
+			})
+		}
+	}
+	return targets, nil
+}
+
+// listTargetsForWildcard returns every listable resource, limited to namespaced ones
+// when querying a single namespace
+func listTargetsForWildcard(clientset kubernetes.Interface, namespace string) ([]listTarget, error) {
+	apiResourceLists, err := loadAPIResourceList(clientset)
 	if err != nil {
-		fmt.Println("Error getting list of resources: ", err)
-		var emptyList unstructured.UnstructuredList
-		return emptyList, err
+		return nil, err
+	}
+
+	var targets []listTarget
+	for _, apiResourceList := range apiResourceLists {
+		gv, err := schema.ParseGroupVersion(apiResourceList.GroupVersion)
+		if err != nil {
+			return nil, err
+		}
+		for _, resource := range apiResourceList.APIResources {
+			if !slices.Contains(resource.Verbs, "list") || (namespace != "" && !resource.Namespaced) {
+				continue
+			}
+			targets = append(targets, listTarget{gvr: gv.WithResource(resource.Name), kind: resource.Kind, namespaced: resource.Namespaced})
+		}
 	}
-	return *list, err
+	return targets, nil
+}
+
+func containsListTarget(targets []listTarget, gvr schema.GroupVersionResource) bool {
+	for _, target := range targets {
+		if target.gvr == gvr {
+			return true
+		}
+	}
+	return false
 }
 
 var GvrCache = make(map[string]schema.GroupVersionResource)
 var GvrCacheMutex sync.RWMutex
 var apiResourceListCache []*metav1.APIResourceList
 
+// MatchAllGVRs makes a kind that maps to several GVRs (e.g. the same Kind served by two
+// API groups) return resources from all of them, each tagged with a _gvr field,
+// instead of only from the first match.
+var MatchAllGVRs bool
+
+// APIWorkers is how many API calls an executor makes at once, for the queries of all its forks
+var APIWorkers = 1
+
+// DiscoveryCacheDir, when set, persists discovery results on disk (like kubectl's ~/.kube/cache)
+// so that they survive across invocations. When empty, discovery is only cached in memory.
+var DiscoveryCacheDir string
+
+// discoveryCacheTTL matches the TTL kubectl uses for its on-disk discovery cache
+const discoveryCacheTTL = 6 * time.Hour
+
+var (
+	cachedDiscoveryClient discovery.CachedDiscoveryInterface
+	cachedDiscoveryMutex  sync.Mutex
+)
+
+// Characters which are not safe to use in a cache directory name, same as kubectl
+var unsafeCacheDirChars = regexp.MustCompile(`[^(\w/.)]`)
+
+func newCachedDiscoveryClient(config *rest.Config, clientset kubernetes.Interface) (discovery.CachedDiscoveryInterface, error) {
+	if DiscoveryCacheDir == "" {
+		return memory.NewMemCacheClient(clientset.Discovery()), nil
+	}
+
+	// Keep a separate cache per API server so switching contexts doesn't mix results
+	host := strings.TrimPrefix(strings.TrimPrefix(config.Host, "https://"), "http://")
+	host = unsafeCacheDirChars.ReplaceAllString(strings.ReplaceAll(host, ":", "_"), "_")
+	discoveryCacheDir := filepath.Join(DiscoveryCacheDir, "discovery", host)
+	httpCacheDir := filepath.Join(DiscoveryCacheDir, "http")
+
+	return disk.NewCachedDiscoveryClientForConfig(config, discoveryCacheDir, httpCacheDir, discoveryCacheTTL)
+}
+
+func setDiscoveryClient(client discovery.CachedDiscoveryInterface) {
+	cachedDiscoveryMutex.Lock()
+	defer cachedDiscoveryMutex.Unlock()
+	cachedDiscoveryClient = client
+}
+
+// getDiscoveryClient returns the shared cached discovery client, falling back to an
+// in-memory cache around the given clientset if no executor has set one up yet.
+func getDiscoveryClient(clientset kubernetes.Interface) discovery.CachedDiscoveryInterface {
+	cachedDiscoveryMutex.Lock()
+	defer cachedDiscoveryMutex.Unlock()
+	if cachedDiscoveryClient == nil {
+		cachedDiscoveryClient = memory.NewMemCacheClient(clientset.Discovery())
+	}
+	return cachedDiscoveryClient
+}
+
+// InvalidateDiscoveryCache drops all cached discovery information (memory and disk)
+// so the next lookup goes back to the API server, e.g. after installing new CRDs.
+func InvalidateDiscoveryCache() {
+	cachedDiscoveryMutex.Lock()
+	if cachedDiscoveryClient != nil {
+		cachedDiscoveryClient.Invalidate()
+	}
+	cachedDiscoveryMutex.Unlock()
+
+	GvrCacheMutex.Lock()
+	GvrCache = make(map[string]schema.GroupVersionResource)
+	apiResourceListCache = nil
+	GvrCacheMutex.Unlock()
+	resetUnavailableGroups()
+}
+
 func FindGVR(clientset *kubernetes.Clientset, resourceId string) (schema.GroupVersionResource, error) {
 	normalizedIdentifier := strings.ToLower(resourceId)
 
@@ -203,38 +630,42 @@ func FindGVR(clientset *kubernetes.Clientset, resourceId string) (schema.GroupVe
 	GvrCacheMutex.RUnlock()
 
 	// GVR not in cache, find it using discovery
-	if apiResourceListCache == nil {
-		discoveryClient := clientset.Discovery()
-		apiResourceList, err := discoveryClient.ServerPreferredResources()
-		if err != nil {
-			return schema.GroupVersionResource{}, err
-		}
-		apiResourceListCache = apiResourceList
+	resolutions, err := ResolveKind(clientset, resourceId)
+	if err != nil {
+		return schema.GroupVersionResource{}, err
 	}
+	resolution, err := resolveOne(resourceId, resolutions)
+	if err != nil {
+		return schema.GroupVersionResource{}, err
+	}
+	gvr := resolution.GVR
 
-	for _, apiResource := range apiResourceListCache {
-		for _, resource := range apiResource.APIResources {
-			if strings.EqualFold(resource.Name, normalizedIdentifier) ||
-				strings.EqualFold(resource.Kind, resourceId) ||
-				containsIgnoreCase(resource.ShortNames, normalizedIdentifier) {
+	// Update the cache
+	GvrCacheMutex.Lock()
+	GvrCache[normalizedIdentifier] = gvr
+	GvrCacheMutex.Unlock()
 
-				gv, err := schema.ParseGroupVersion(apiResource.GroupVersion)
-				if err != nil {
-					return schema.GroupVersionResource{}, err
-				}
-				gvr := gv.WithResource(resource.Name)
+	return gvr, nil
+}
 
-				// Update the cache
-				GvrCacheMutex.Lock()
-				GvrCache[normalizedIdentifier] = gvr
-				GvrCacheMutex.Unlock()
+// FindAllGVRs returns every GVR the identifier resolves to (see ResolveKind), in
+// discovery order. FindGVR picks the one it refers to, see resolveOne.
+func FindAllGVRs(clientset kubernetes.Interface, resourceId string) ([]schema.GroupVersionResource, error) {
+	resolutions, err := ResolveKind(clientset, resourceId)
+	if err != nil {
+		return nil, err
+	}
 
-				return gvr, nil
-			}
-		}
+	var gvrs []schema.GroupVersionResource
+	for _, resolution := range resolutions {
+		gvrs = append(gvrs, resolution.GVR)
 	}
+	return gvrs, nil
+}
 
-	return schema.GroupVersionResource{}, fmt.Errorf("resource identifier not found: %s", resourceId)
+// gvrColumnValue formats a GVR the way it appears in the _gvr field, e.g. "apps/v1/deployments".
+func gvrColumnValue(gvr schema.GroupVersionResource) string {
+	return gvr.GroupVersion().String() + "/" + gvr.Resource
 }
 
 // Helper function to check if a slice contains a string, case-insensitive
@@ -248,8 +679,8 @@ func containsIgnoreCase(slice []string, str string) bool {
 }
 
 func FetchAndCacheGVRs(clientset *kubernetes.Clientset) error {
-	discoveryClient := clientset.Discovery()
-	apiResourceList, err := discoveryClient.ServerPreferredResources()
+	discoveryClient := getDiscoveryClient(clientset)
+	apiResourceList, err := preferredResources(discoveryClient)
 	if err != nil {
 		return err
 	}
@@ -307,8 +738,8 @@ func fetchResourceSpecsFromOpenAPI() (map[string][]string, error) {
 
 	if openAPIDoc == nil {
 
-		// Use the existing clientset from QueryExecutor
-		discoveryClient := executorInstance.Clientset.Discovery()
+		// Use the cached discovery client from QueryExecutor
+		discoveryClient := executorInstance.GetDiscoveryClient()
 
 		// Get OpenAPI V3 client
 		openAPIV3Client := discoveryClient.OpenAPIV3()
@@ -316,7 +747,7 @@ func fetchResourceSpecsFromOpenAPI() (map[string][]string, error) {
 		// Get the OpenAPI V3 paths
 		paths, err := openAPIV3Client.Paths()
 		if err != nil {
-			return nil, fmt.Errorf("failed to retrieve OpenAPI paths: %v", err)
+			return nil, newDiagnosticError(CodeOpenAPIUnavailable, err)
 		}
 
 		// Initialize openAPIDoc with empty Components before the loop
@@ -334,7 +765,7 @@ func fetchResourceSpecsFromOpenAPI() (map[string][]string, error) {
 				if strings.Contains(err.Error(), "the backend attempted to redirect this request") {
 					continue
 				}
-				fmt.Printf("Error retrieving schema for group version %s: %v\n", groupVersion, err)
+				logDiagnostic(CodeSchemaUnavailable, err, "groupVersion", groupVersion)
 				continue
 			}
 
@@ -342,7 +773,7 @@ func fetchResourceSpecsFromOpenAPI() (map[string][]string, error) {
 			tempDoc := &openapi_v3.Document{}
 			err = proto.Unmarshal(schemaBytes, tempDoc)
 			if err != nil {
-				fmt.Printf("Error unmarshaling OpenAPI document for group version %s: %v\n", groupVersion, err)
+				logDiagnostic(CodeSchemaUnavailable, err, "groupVersion", groupVersion)
 				continue
 			}
 
@@ -0,0 +1,199 @@
+package parser
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGetDiscoveryClientIsShared(t *testing.T) {
+	originalClient := cachedDiscoveryClient
+	defer setDiscoveryClient(originalClient)
+	setDiscoveryClient(nil)
+
+	clientset := fake.NewSimpleClientset()
+	first := getDiscoveryClient(clientset)
+	second := getDiscoveryClient(clientset)
+
+	if first == nil {
+		t.Fatal("getDiscoveryClient() returned nil")
+	}
+	if first != second {
+		t.Errorf("getDiscoveryClient() returned a new client on the second call, expected the cached one")
+	}
+}
+
+func TestInvalidateDiscoveryCache(t *testing.T) {
+	originalClient := cachedDiscoveryClient
+	defer setDiscoveryClient(originalClient)
+	setDiscoveryClient(getDiscoveryClient(fake.NewSimpleClientset()))
+
+	GvrCache["pods"] = schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	apiResourceListCache = []*metav1.APIResourceList{{GroupVersion: "v1"}}
+
+	InvalidateDiscoveryCache()
+
+	if len(GvrCache) != 0 {
+		t.Errorf("expected GvrCache to be empty, got %v", GvrCache)
+	}
+	if apiResourceListCache != nil {
+		t.Errorf("expected apiResourceListCache to be nil, got %v", apiResourceListCache)
+	}
+	if cachedDiscoveryClient.Fresh() {
+		t.Errorf("expected discovery client to be stale after invalidation")
+	}
+}
+
+func TestResolveKindWhileInvalidating(t *testing.T) {
+	originalClient, originalList := cachedDiscoveryClient, apiResourceListCache
+	defer func() {
+		setDiscoveryClient(originalClient)
+		apiResourceListCache = originalList
+	}()
+	clientset := fake.NewSimpleClientset()
+	clientset.Resources = []*metav1.APIResourceList{{
+		GroupVersion: "v1",
+		APIResources: []metav1.APIResource{{Name: "pods", SingularName: "pod", Kind: "Pod", Namespaced: true, Verbs: []string{"list"}}},
+	}}
+	setDiscoveryClient(getDiscoveryClient(clientset))
+	InvalidateDiscoveryCache()
+
+	// Run with -race: resolving reloads the resources the invalidation drops
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if _, err := ResolveKind(clientset, "pods"); err != nil {
+					t.Errorf("ResolveKind() returned %v", err)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				InvalidateDiscoveryCache()
+				ClearCache()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCloseQueryExecutor(t *testing.T) {
+	q := newTestQueryExecutor(t)
+	fork := q.Fork()
+	if _, err := fork.getK8sResources("Pod", "", ""); err != nil {
+		t.Fatalf("getK8sResources() error = %v", err)
+	}
+
+	q.Close()
+	q.Close()
+	if _, err := fork.getK8sResources("Pod", "", ""); !errors.Is(err, errExecutorClosed) {
+		t.Errorf("expected the fork of a closed executor to fail, got %v", err)
+	}
+}
+
+func setDuplicateEventResources(t *testing.T) {
+	originalList := apiResourceListCache
+	t.Cleanup(func() {
+		apiResourceListCache = originalList
+		delete(GvrCache, "event")
+	})
+	apiResourceListCache = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{{Name: "events", Kind: "Event", ShortNames: []string{"ev"}}},
+		},
+		{
+			GroupVersion: "events.k8s.io/v1",
+			APIResources: []metav1.APIResource{{Name: "events", Kind: "Event", ShortNames: []string{"ev"}}},
+		},
+	}
+}
+
+func TestFindAllGVRs(t *testing.T) {
+	setDuplicateEventResources(t)
+
+	gvrs, err := FindAllGVRs(nil, "Event")
+	if err != nil {
+		t.Fatalf("FindAllGVRs() error = %v", err)
+	}
+	expected := []schema.GroupVersionResource{
+		{Version: "v1", Resource: "events"},
+		{Group: "events.k8s.io", Version: "v1", Resource: "events"},
+	}
+	if !reflect.DeepEqual(gvrs, expected) {
+		t.Errorf("FindAllGVRs() = %v, want %v", gvrs, expected)
+	}
+
+	gvr, err := FindGVR(nil, "Event")
+	if err != nil {
+		t.Fatalf("FindGVR() error = %v", err)
+	}
+	if gvr != expected[0] {
+		t.Errorf("FindGVR() = %v, want the core group's %v", gvr, expected[0])
+	}
+
+	if _, err := FindAllGVRs(nil, "nonexistent"); err == nil {
+		t.Errorf("FindAllGVRs() expected error for unknown identifier")
+	}
+}
+
+func TestFetchResourcesMatchAllGVRs(t *testing.T) {
+	setDuplicateEventResources(t)
+	originalMatchAll := MatchAllGVRs
+	defer func() { MatchAllGVRs = originalMatchAll }()
+
+	newEvent := func(apiVersion, name string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": apiVersion,
+			"kind":       "Event",
+			"metadata":   map[string]interface{}{"name": name, "namespace": Namespace},
+		}}
+	}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			{Version: "v1", Resource: "events"}:                         "EventList",
+			{Group: "events.k8s.io", Version: "v1", Resource: "events"}: "EventList",
+		},
+		newEvent("v1", "core-event"),
+		newEvent("events.k8s.io/v1", "new-event"),
+	)
+	q := &QueryExecutor{DynamicClient: dynamicClient}
+
+	MatchAllGVRs = false
+	list, err := q.fetchResources("Event", "", "")
+	if err != nil {
+		t.Fatalf("fetchResources() error = %v", err)
+	}
+	if len(list.Items) != 1 || list.Items[0].GetName() != "core-event" {
+		t.Errorf("expected only the core group's events to be listed, got %v", list.Items)
+	}
+
+	MatchAllGVRs = true
+	list, err = q.fetchResources("Event", "", "")
+	if err != nil {
+		t.Fatalf("fetchResources() error = %v", err)
+	}
+	gvrsByName := map[string]interface{}{}
+	for _, item := range list.Items {
+		gvrsByName[item.GetName()] = item.Object["_gvr"]
+	}
+	expected := map[string]interface{}{
+		"core-event": "v1/events",
+		"new-event":  "events.k8s.io/v1/events",
+	}
+	if !reflect.DeepEqual(gvrsByName, expected) {
+		t.Errorf("fetchResources() _gvr fields = %v, want %v", gvrsByName, expected)
+	}
+}
@@ -3,14 +3,20 @@ package parser
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
 	"reflect"
+	"regexp"
 	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/AvitalTamir/jsonpath"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	unstructured "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	schema "k8s.io/apimachinery/pkg/runtime/schema"
@@ -38,18 +44,186 @@ type Graph struct {
 type QueryResult struct {
 	Data  map[string]interface{}
 	Graph Graph
+	// Truncated is set when the query was interrupted, Data and Graph then only hold what was returned until then
+	Truncated bool `json:",omitempty"`
+	// Continue, set on the Truncated results of ExecutePage that can be resumed, is the token to resume them from
+	Continue string `json:",omitempty"`
+	// Hidden is the number of resources the executor's Hide left out of the rows
+	Hidden int `json:",omitempty"`
+	// Rows are the rows of RETURN, one per combination of resources the query matched together, if the executor's
+	// Rows is set
+	Rows []map[string]interface{} `json:",omitempty"`
 }
 
-var resultCache = make(map[string]interface{})
-var resultMap = make(map[string]interface{})
+// queryState is the state of a running query. Each executor has its own, so that queries running on executors
+// forked from the same one don't see each other's resources.
+type queryState struct {
+	// namespace is the namespace the query runs in
+	namespace string
+	// resultCache holds the resources listed for each node pattern, resultMap those matched so far by node variable
+	resultCache map[string]interface{}
+	resultMap   map[string]interface{}
+	// resultCacheFetchedAt records when each resultCache entry was listed from the API server
+	resultCacheFetchedAt map[string]time.Time
+	// resultIndexes index resultCache entries by the IndexedFields
+	resultIndexes map[string]*fieldIndex
+	// resultSources records, per node variable, where its resources were served from
+	resultSources map[string]resultSource
+	// withColumns are the names of the values in the rows of the last grouping WITH or UNWIND clause, if any
+	withColumns []string
+	// relationshipVariables are the names bound to relationships by the query
+	relationshipVariables []string
+	// rowRelationships are the relationships matched so far, which the Rows of RETURN are joined by
+	rowRelationships []rowRelationship
+	// reachability evaluates the NetworkPolicies of CAN_REACH relationships
+	reachability *podReachability
+	// metricsNodes are the nodes whose metrics field the query refers to, and metricsSamples the samples of the
+	// metrics API listed for them
+	metricsNodes   map[string]bool
+	metricsSamples map[schema.GroupVersionResource]map[string]map[string]interface{}
+	// expression is the query, which audited changes are recorded with
+	expression *Expression
+	// clause is the clause running, which timeouts are reported in
+	clause Clause
+	// prefetched are the node patterns of the running MATCH clause being listed ahead, by resultCache key
+	prefetched map[string]*prefetch
+	// plannedSelectors are the selectors of the node patterns of a prepared query, computed when it was prepared
+	plannedSelectors map[*NodePattern]plannedSelectors
+	// joinSelectors are the selectors the node patterns of the running query are narrowed with by the resources of
+	// those related to them, listed first
+	joinSelectors map[*NodePattern]plannedSelectors
+}
 
-func (q *QueryExecutor) Execute(ast *Expression, namespace string) (QueryResult, error) {
-	if AllNamespaces {
+func newQueryState() queryState {
+	return queryState{
+		resultCache:          make(map[string]interface{}),
+		resultMap:            make(map[string]interface{}),
+		resultCacheFetchedAt: make(map[string]time.Time),
+		resultIndexes:        make(map[string]*fieldIndex),
+		resultSources:        make(map[string]resultSource),
+	}
+}
+
+// ExplainFields adds a _provenance entry to every returned row, telling where each value came from
+var ExplainFields bool
+
+// Provenance sources reported by ExplainFields
+const (
+	ProvenanceLive     = "live"
+	ProvenanceCache    = "cache"
+	ProvenanceComputed = "computed"
+)
+
+type resultSource struct {
+	source    string
+	fetchedAt time.Time
+}
+
+func (r resultSource) provenance() map[string]interface{} {
+	provenance := map[string]interface{}{"source": r.source}
+	if !r.fetchedAt.IsZero() {
+		provenance["fetchedAt"] = r.fetchedAt.UTC().Format(time.RFC3339)
+		provenance["age"] = time.Since(r.fetchedAt).Round(time.Millisecond).String()
+	}
+	return provenance
+}
+
+// returnItemProvenance describes where the value of a RETURN item comes from
+func (q *QueryExecutor) returnItemProvenance(item *ReturnItem, nodeId string) map[string]interface{} {
+	source := q.resultSources[nodeId].provenance()
+	if item.Function == "" && item.Aggregate == "" {
+		return source
+	}
+	provenance := map[string]interface{}{"source": ProvenanceComputed, "from": source}
+	if item.Function != "" {
+		provenance["function"] = functionName(item.Function)
+	} else {
+		provenance["aggregate"] = strings.ToLower(item.Aggregate)
+	}
+	return provenance
+}
+
+// returnItemLabel is the key a RETURN item is reported under in _provenance
+func returnItemLabel(item *ReturnItem) string {
+	switch {
+	case item.Alias != "":
+		return item.Alias
+	case item.Function != "":
+		return functionCallLabel(item.Function, item.JsonPath, item.Args)
+	case item.Aggregate != "":
+		return strings.ToLower(item.Aggregate) + "{" + item.JsonPath + "}"
+	}
+	return item.JsonPath
+}
+
+// prepareQuery readies the state of the executor for a query running in namespace, Namespace unless another is
+// given, honoring --all-namespaces once
+func (q *QueryExecutor) prepareQuery(namespace string) {
+	if q.resultCache == nil {
+		// Executors that weren't made by NewQueryExecutor or Fork start without a state
+		q.queryState = newQueryState()
+	}
+	switch {
+	case AllNamespaces:
 		Namespace = ""
 		AllNamespaces = false // to reset value
-	} else if namespace != "" {
-		Namespace = namespace
+		q.namespace = ""
+	case namespace != "":
+		q.namespace = namespace
+	default:
+		q.namespace = Namespace
 	}
+}
+
+// Execute runs a query, see ExecuteContext to be able to interrupt it
+func (q *QueryExecutor) Execute(ast *Expression, namespace string) (QueryResult, error) {
+	return q.ExecuteContext(context.Background(), ast, namespace)
+}
+
+// ExecuteContext runs a query until it completes or ctx is done. Interrupting a query aborts its API calls
+// in flight and stops it from making further changes: its error matches ErrInterrupted and lists the changes
+// that were already applied, and its result holds what was returned so far, marked as Truncated.
+func (q *QueryExecutor) ExecuteContext(ctx context.Context, ast *Expression, namespace string) (queryResult QueryResult, err error) {
+	if ast.Union != nil && !ast.Explain {
+		return q.executeUnion(ctx, ast, namespace)
+	}
+	if err := q.validateFields(ast); err != nil {
+		return QueryResult{}, err
+	}
+	if err := q.preflight(ctx, ast, namespace, false); err != nil {
+		return QueryResult{}, err
+	}
+	q.ctx = ctx
+	q.expression = ast
+	q.applied, q.undo = nil, nil
+	q.Rollout.reset()
+	defer func() {
+		q.awaitPrefetches()
+		if err != nil && ctx.Err() != nil {
+			queryResult.Truncated = true
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				err = timedOutError(ctx.Err(), q.clause, q.applied)
+			} else {
+				err = interruptedError(ctx.Err(), q.applied)
+			}
+		}
+		if err != nil {
+			// The changes are rolled back even if the query was interrupted
+			err = q.rollBack(context.WithoutCancel(ctx), err)
+		}
+		if err != nil && Hooks.OnClauseError != nil {
+			Hooks.OnClauseError(clauseName(q.clause), err)
+		}
+		if len(q.applied) > 0 {
+			// The next queries list the resources again to see the changes
+			q.listCache.clear()
+		}
+		q.ctx = nil
+		q.clearQueryState()
+	}()
+
+	q.prepareQuery(namespace)
+	q.metricsNodes = metricsNodes(ast)
 	results := &QueryResult{
 		Data: make(map[string]interface{}),
 		Graph: Graph{
@@ -57,10 +231,57 @@ func (q *QueryExecutor) Execute(ast *Expression, namespace string) (QueryResult,
 			Edges: []Edge{},
 		},
 	}
+	if ast.Apply != nil {
+		rollout, rolloutErr := q.applyRollout(ast.Apply)
+		if rolloutErr != nil {
+			return *results, rolloutErr
+		}
+		executorRollout := q.Rollout
+		q.Rollout = rollout
+		defer func() {
+			// The WHILE query ending an APPLY query is how it's meant to complete
+			if errors.Is(err, errWhileStopped) {
+				err = nil
+			}
+			results.Data["apply"] = rollout.applyReport(len(q.applied))
+			q.Rollout = executorRollout
+		}()
+	}
+	if ast.Explain {
+		q.clause = ast.Clauses[0]
+		plan, err := q.explain(ast)
+		if err != nil {
+			return *results, err
+		}
+		results.Data["plan"] = plan
+		return *results, nil
+	}
+
+	// mergeCreated holds the nodes MERGE created, with the values of the following SET
+	mergeCreated := make(map[string]bool)
+	// boundNodes holds the patterns of the nodes matched so far, by name
+	boundNodes := make(map[string]*NodePattern)
+
 	// Iterate over the clauses in the AST.
-	for _, clause := range ast.Clauses {
+	for i, clause := range ast.Clauses {
+		q.clause = clause
+		if err := ctx.Err(); err != nil {
+			return *results, err
+		}
 		switch c := clause.(type) {
 		case *MatchClause:
+			if c.Optional || refersToBoundNodes(c, boundNodes) {
+				q.recordRowRelationships(c, boundNodes)
+				if err := q.processBoundMatch(c, boundNodes, results); err != nil {
+					return *results, err
+				}
+				bindNodes(boundNodes, c.Nodes)
+				break
+			}
+			if err := q.orderJoins(c); err != nil {
+				return *results, err
+			}
+			q.prefetchNodes(c)
 			var filteringOccurred bool
 			filteredResults := make(map[string][]map[string]interface{})
 
@@ -78,7 +299,7 @@ func (q *QueryExecutor) Execute(ast *Expression, namespace string) (QueryResult,
 				}
 				// Update resultMap with filtered results for the next pass
 				for k, v := range filteredResults {
-					resultMap[k] = v
+					q.resultMap[k] = v
 				}
 			}
 
@@ -87,36 +308,82 @@ func (q *QueryExecutor) Execute(ast *Expression, namespace string) (QueryResult,
 			if err != nil {
 				return *results, err
 			}
+			if err := q.bindRelationshipVariables(c); err != nil {
+				return *results, err
+			}
+			q.recordRowRelationships(c, boundNodes)
+			bindNodes(boundNodes, c.Nodes)
+			q.awaitPrefetches()
 
 		case *SetClause:
+			patchType, err := setPatchType(c)
+			if err != nil {
+				return *results, err
+			}
+			subresource, err := setSubresource(c)
+			if err != nil {
+				return *results, err
+			}
+			// Every node is checked before any is changed
+			for _, kvp := range c.KeyValuePairs {
+				nodeId := strings.Split(kvp.Key, ".")[0]
+				if _, ok := q.resultMap[nodeId].([]map[string]interface{}); !ok && !mergeCreated[nodeId] {
+					return *results, newDiagnosticError(CodeUnknownMutationNode, nil, "node", nodeId)
+				}
+			}
+			if patchType == applyPatchType {
+				if err := q.applySetClause(c, mergeCreated); err != nil {
+					return *results, err
+				}
+				break
+			}
 			for _, kvp := range c.KeyValuePairs {
 				resultMapKey := strings.Split(kvp.Key, ".")[0]
-				path := []string{}
-				parts := strings.Split(kvp.Key, ".")
-				for i := 1; i < len(parts); i++ {
-					if i > 1 && strings.HasSuffix(parts[i-1], "\\") {
-						// Combine this part with the previous one, removing the backslash
-						path[len(path)-1] = path[len(path)-1][:len(path[len(path)-1])-1] + "." + strings.ReplaceAll(parts[i], "/", "~1")
-					} else {
-						path = append(path, strings.ReplaceAll(parts[i], "/", "~1"))
-					}
+				if mergeCreated[resultMapKey] {
+					// The resource was created by MERGE with the values set
+					continue
 				}
+				path := setPath(kvp.Key)
 
-				resources := resultMap[resultMapKey].([]map[string]interface{})
+				// The patch depends on the structure of each object, the ledger identifies the change by what it sets
+				set := []interface{}{path, kvp.Value}
+				if patchType != "json" {
+					set = append(set, patchType)
+				}
+				if c.Status {
+					set = append(set, "status")
+				}
+				change, err := json.Marshal(set)
+				if err != nil {
+					return *results, newDiagnosticError(CodeInvalidPatch, err)
+				}
+				digest := patchDigest(change)
+
+				resources, ok := q.resultMap[resultMapKey].([]map[string]interface{})
+				if !ok {
+					return *results, newDiagnosticError(CodeUnknownMutationNode, nil, "node", resultMapKey)
+				}
 				for _, resource := range resources {
 					// Create a single patch that works with the existing structure
-					patches := createCompatiblePatch(resource, path, kvp.Value)
-
-					// Marshal the patches to JSON
-					patchJSON, err := json.Marshal(patches)
+					patchJSON, err := setPatch(patchType, resource, kvp.Key, path, kvp.Value)
 					if err != nil {
-						return *results, fmt.Errorf("error marshalling patches: %s", err)
+						if DiagnosticCodeOf(err) == "" {
+							err = newDiagnosticError(CodeInvalidPatch, err)
+						}
+						return *results, err
+					}
+					if patchJSON == nil {
+						// The value to remove is already missing
+						continue
 					}
 
 					// Apply the patches to the resource
-					err = q.patchK8sResource(resource, patchJSON)
+					err = q.patchK8sResource(resource, patchTypes[patchType], patchJSON, digest, subresource...)
 					if err != nil {
-						return *results, fmt.Errorf("error patching resource: %s", err)
+						if err := q.changeFailed(err); err != nil {
+							return *results, fmt.Errorf("error patching resource: %w", err)
+						}
+						continue
 					}
 
 					// Update the resultMap
@@ -128,15 +395,20 @@ func (q *QueryExecutor) Execute(ast *Expression, namespace string) (QueryResult,
 			// Execute a Kubernetes delete operation based on the DeleteClause.
 			for _, nodeId := range c.NodeIds {
 				// make sure the identifier is a key in the result map
-				if resultMap[nodeId] == nil {
-					return *results, fmt.Errorf("node identifier %s not found in result map", nodeId)
+				if q.resultMap[nodeId] == nil {
+					return *results, newDiagnosticError(CodeUnknownMutationNode, nil, "node", nodeId)
 				}
 				err := q.deleteK8sResources(nodeId)
 				if err != nil {
-					return *results, fmt.Errorf("error deleting resource >> %s", err)
+					return *results, fmt.Errorf("error deleting resource >> %w", err)
 				}
 			}
 
+		case *OperationClause:
+			if err := q.executeOperation(c); err != nil {
+				return *results, err
+			}
+
 		case *CreateClause:
 			// Same as in Match clauses, we'll first look at relationships, then nodes
 			// we'll iterates over the replationships then nodes, and from each we'll extract a spec and create the resource
@@ -146,23 +418,26 @@ func (q *QueryExecutor) Execute(ast *Expression, namespace string) (QueryResult,
 			// Iterate over the relationships in the create clause.
 			// Process Relationships
 			for idx, rel := range c.Relationships {
+				if rel.Hops != nil {
+					return *results, newDiagnosticError(CodeCreateVariableLength, nil, "left", rel.LeftNode.ResourceProperties.Name, "right", rel.RightNode.ResourceProperties.Name)
+				}
 				// Determine which (if any) of the nodes in the relationship have already been fetched in a match clause, and which are new creations
 				var node *NodePattern
 				var foreignNode *NodePattern
 
 				// If both nodes exist in the match clause, error out
-				if resultMap[rel.LeftNode.ResourceProperties.Name] != nil && resultMap[rel.RightNode.ResourceProperties.Name] != nil {
-					return *results, fmt.Errorf("both nodes '%v', '%v' of relationship in create clause already exist", rel.LeftNode.ResourceProperties.Name, rel.RightNode.ResourceProperties.Name)
+				if q.resultMap[rel.LeftNode.ResourceProperties.Name] != nil && q.resultMap[rel.RightNode.ResourceProperties.Name] != nil {
+					return *results, newDiagnosticError(CodeCreateBothNodesExist, nil, "left", rel.LeftNode.ResourceProperties.Name, "right", rel.RightNode.ResourceProperties.Name)
 				}
 
 				// TODO: create both nodes and determine the spec from the relationship instead of this:
 				// If neither node exists in the match clause, error out
-				if resultMap[rel.LeftNode.ResourceProperties.Name] == nil && resultMap[rel.RightNode.ResourceProperties.Name] == nil {
-					return *results, fmt.Errorf("not yet supported: neither node '%s', '%s' of relationship in create clause already exist", rel.LeftNode.ResourceProperties.Name, rel.RightNode.ResourceProperties.Name)
+				if q.resultMap[rel.LeftNode.ResourceProperties.Name] == nil && q.resultMap[rel.RightNode.ResourceProperties.Name] == nil {
+					return *results, newDiagnosticError(CodeCreateNoNodeExists, nil, "left", rel.LeftNode.ResourceProperties.Name, "right", rel.RightNode.ResourceProperties.Name)
 				}
 
 				// find out whice node exists in the match clause, then use it to construct the spec according to the relationship
-				if resultMap[rel.LeftNode.ResourceProperties.Name] == nil {
+				if q.resultMap[rel.LeftNode.ResourceProperties.Name] == nil {
 					node = rel.LeftNode
 					foreignNode = rel.RightNode
 				} else {
@@ -171,20 +446,20 @@ func (q *QueryExecutor) Execute(ast *Expression, namespace string) (QueryResult,
 				}
 
 				// The foreign node is currently only a name reference, we'll need to find the matching node in the result map
-				foreignNode.ResourceProperties.Kind = resultMap[foreignNode.ResourceProperties.Name].([]map[string]interface{})[0]["kind"].(string)
+				foreignNode.ResourceProperties.Kind = q.resultMap[foreignNode.ResourceProperties.Name].([]map[string]interface{})[0]["kind"].(string)
 
 				var relType RelationshipType
 				targetGVR, err := FindGVR(q.Clientset, node.ResourceProperties.Kind)
 				if err != nil {
-					return *results, fmt.Errorf("error finding API resource >> %s", err)
+					return *results, fmt.Errorf("error finding API resource >> %w", err)
 
 				}
 				foreignGVR, err := FindGVR(q.Clientset, foreignNode.ResourceProperties.Kind)
 				if err != nil {
-					return *results, fmt.Errorf("error finding API resource >> %s", err)
+					return *results, fmt.Errorf("error finding API resource >> %w", err)
 				}
 
-				for _, resourceRelationship := range relationshipRules {
+				for _, resourceRelationship := range activeRelationshipRules() {
 					if (strings.EqualFold(targetGVR.Resource, resourceRelationship.KindA) && strings.EqualFold(foreignGVR.Resource, resourceRelationship.KindB)) ||
 						(strings.EqualFold(foreignGVR.Resource, resourceRelationship.KindA) && strings.EqualFold(targetGVR.Resource, resourceRelationship.KindB)) {
 						relType = resourceRelationship.Relationship
@@ -193,12 +468,15 @@ func (q *QueryExecutor) Execute(ast *Expression, namespace string) (QueryResult,
 
 				if relType == "" {
 					// no relationship type found, error out
-					return *results, fmt.Errorf("relationship type not found between %s and %s", targetGVR.Resource, foreignGVR.Resource)
+					return *results, newDiagnosticError(CodeRelationshipNotFound, nil, "left", targetGVR.Resource, "right", foreignGVR.Resource)
 				}
 
 				rule, err := findRuleByRelationshipType(relType)
 				if err != nil {
-					return *results, fmt.Errorf("error determining relationship type >> %s", err)
+					return *results, fmt.Errorf("error determining relationship type >> %w", err)
+				}
+				if rule.analyzer != "" {
+					return *results, newDiagnosticError(CodeCreateAnalyzedRelationship, nil, "relationship", rule.Relationship)
 				}
 
 				// Now according to which is the node that needs to be created, we'll construct the spec from the node properties and from the relevant part of the spec that's defined in the relationship
@@ -231,24 +509,23 @@ func (q *QueryExecutor) Execute(ast *Expression, namespace string) (QueryResult,
 					}
 				} else {
 					// error out
-					return *results, fmt.Errorf("relationship rule not found for %s and %s - This code path should be invalid, likely problem with rule definitions", targetGVR.Resource, foreignGVR.Resource)
+					return *results, newDiagnosticError(CodeRelationshipRuleMissing, nil, "left", targetGVR.Resource, "right", foreignGVR.Resource)
 				}
 
 				var resourceTemplate map[string]interface{}
 				if node.ResourceProperties.JsonData != "" {
 					err = json.Unmarshal([]byte(node.ResourceProperties.JsonData), &resourceTemplate)
 					if err != nil {
-						fmt.Println("Error unmarshalling node JsonData: ", err)
-						return *results, err
+						return *results, newDiagnosticError(CodeInvalidJSONData, err)
 					}
 				} else {
 					resourceTemplate = make(map[string]interface{})
 				}
 
 				// loop over the resources array in the resultMap for the foreign node and create the resource
-				for _, foreignResource := range resultMap[foreignNode.ResourceProperties.Name].([]map[string]interface{}) {
+				for _, foreignResource := range q.resultMap[foreignNode.ResourceProperties.Name].([]map[string]interface{}) {
 					var name string
-					foreignSpec := resultMap[foreignNode.ResourceProperties.Name].([]map[string]interface{})[idx]
+					foreignSpec := q.resultMap[foreignNode.ResourceProperties.Name].([]map[string]interface{})[idx]
 
 					fields := append([]string{criteriaField}, defaultPropFields...)
 					foreignFields := append([]string{foreignCriteriaField}, foreignDefaultPropFields...)
@@ -326,9 +603,9 @@ func (q *QueryExecutor) Execute(ast *Expression, namespace string) (QueryResult,
 					}
 
 					name = getTargetK8sResourceName(resourceTemplate, node.ResourceProperties.Name, foreignResource["metadata"].(map[string]interface{})["name"].(string))
-					err = q.createK8sResource(node, resourceTemplate, name)
+					_, err = q.createK8sResource(node, resourceTemplate, name)
 					if err != nil {
-						return *results, fmt.Errorf("error creating resource >> %s", err)
+						return *results, fmt.Errorf("error creating resource >> %w", err)
 					}
 				}
 			}
@@ -345,269 +622,562 @@ func (q *QueryExecutor) Execute(ast *Expression, namespace string) (QueryResult,
 
 				if !ignoreNode {
 					// check if the node has already been fetched, if so, error out
-					if resultMap[node.ResourceProperties.Name] != nil {
-						return *results, fmt.Errorf("can't create: node '%s' already exists in match clause", node.ResourceProperties.Name)
+					if q.resultMap[node.ResourceProperties.Name] != nil {
+						return *results, newDiagnosticError(CodeCreateNodeExists, nil, "node", node.ResourceProperties.Name)
 					}
 
 					// unmarsall the node JsonData into a map
 					var resourceTemplate map[string]interface{}
 					err := json.Unmarshal([]byte(node.ResourceProperties.JsonData), &resourceTemplate)
 					if err != nil {
-						fmt.Println("Error unmarshalling node JsonData: ", err)
-						return *results, err
+						return *results, newDiagnosticError(CodeInvalidJSONData, err)
 					}
 
 					name := getTargetK8sResourceName(resourceTemplate, node.ResourceProperties.Name, "")
 					// create the resource
-					err = q.createK8sResource(node, resourceTemplate, name)
+					_, err = q.createK8sResource(node, resourceTemplate, name)
 					if err != nil {
-						return *results, fmt.Errorf("error creating resource >> %s", err)
+						return *results, fmt.Errorf("error creating resource >> %w", err)
 					}
 				}
 			}
 
-		case *ReturnClause:
-			nodeIds := []string{}
-			for _, item := range c.Items {
-				// generate a unique list of nodeIds
-				nodeId := strings.Split(item.JsonPath, ".")[0]
-				if !slices.Contains(nodeIds, nodeId) {
-					nodeIds = append(nodeIds, nodeId)
-				}
+		case *MergeClause:
+			var set *SetClause
+			if i+1 < len(ast.Clauses) {
+				set, _ = ast.Clauses[i+1].(*SetClause)
+			}
+			status := set != nil && set.Status
+			if status {
+				// A created resource gets its status from the SET STATUS that follows, through the subresource
+				set = nil
 			}
+			created, err := q.mergeNode(c.Node, set, results)
+			if err != nil {
+				return *results, err
+			}
+			mergeCreated[c.Node.ResourceProperties.Name] = created && !status
+			bindNodes(boundNodes, []*NodePattern{c.Node})
 
-			// Add a "name" property to each node
-			for _, nodeId := range nodeIds {
-				metadataNamePath := strings.Join([]string{nodeId, "metadata.name"}, ".")
-				c.Items = append(c.Items, &ReturnItem{JsonPath: metadataNamePath, Alias: "name"})
+		case *WithClause:
+			if err := q.processWith(c, boundNodes); err != nil {
+				return *results, err
 			}
 
-			for _, item := range c.Items {
-				nodeId := strings.Split(item.JsonPath, ".")[0]
-				if resultMap[nodeId] == nil {
-					return *results, fmt.Errorf("node identifier %s not found in return clause", nodeId)
-				}
+		case *UnwindClause:
+			if err := q.processUnwind(c, boundNodes); err != nil {
+				return *results, err
+			}
 
-				pathParts := strings.Split(item.JsonPath, ".")[1:]
-				pathStr := "$." + strings.Join(pathParts, ".")
+		case *ReturnClause:
+			if err := q.projectReturn(c, results); err != nil {
+				return *results, err
+			}
 
-				if pathStr == "$." {
-					pathStr = "$"
-				}
+		default:
+			return *results, newDiagnosticError(CodeUnknownClause, nil, "clause", fmt.Sprintf("%T", c))
+		}
+	}
+	// build the graph
+	q.buildGraph(results)
+	return *results, q.rolloutFailures()
+}
 
-				if results.Data[nodeId] == nil {
-					results.Data[nodeId] = []interface{}{}
+// clearQueryState clears the result cache and result map once a query ends
+func (q *QueryExecutor) clearQueryState() {
+	q.queryState = newQueryState()
+}
+
+// projectReturn adds the RETURN items of the matched resources in resultMap to the results
+func (q *QueryExecutor) projectReturn(c *ReturnClause, results *QueryResult) error {
+	items := []*ReturnItem{}
+	for _, item := range c.Items {
+		// Values of a WITH clause are read from its rows
+		if slices.Contains(q.withColumns, strings.Split(item.JsonPath, ".")[0]) {
+			rowItem := *item
+			rowItem.JsonPath = withRowsNode + "." + item.JsonPath
+			rowItem.Args = nil
+			for _, arg := range item.Args {
+				if arg.JsonPath != "" {
+					arg = &FunctionArg{JsonPath: withRowsNode + "." + arg.JsonPath}
 				}
-				var aggregateResult interface{}
-
-				for idx, resource := range resultMap[nodeId].([]map[string]interface{}) {
-					// Ensure that the results.Data[nodeId] slice has enough elements to store the current resource.
-					// If the current index (idx) is beyond the current length of the slice,
-					// append a new empty map to the slice to accommodate the new data.
-					if len(results.Data[nodeId].([]interface{})) <= idx {
-						results.Data[nodeId] = append(results.Data[nodeId].([]interface{}), make(map[string]interface{}))
-					}
-					currentMap := results.Data[nodeId].([]interface{})[idx].(map[string]interface{})
+				rowItem.Args = append(rowItem.Args, arg)
+			}
+			item = &rowItem
+		}
+		items = append(items, item)
+	}
+	nodeIds := []string{}
+	wholeNodeIds := []string{}
+	for _, item := range items {
+		// generate a unique list of nodeIds
+		nodeId := strings.Split(item.JsonPath, ".")[0]
+		if !slices.Contains(nodeIds, nodeId) {
+			nodeIds = append(nodeIds, nodeId)
+		}
+		// RETURN p projects the complete object
+		if item.JsonPath == nodeId && item.Alias == "" && item.Aggregate == "" && item.Function == "" {
+			wholeNodeIds = append(wholeNodeIds, nodeId)
+		}
+	}
 
-					result, err := jsonpath.JsonPathLookup(resource, pathStr)
-					if err != nil {
-						logDebug("Path not found:", item.JsonPath)
-						result = nil
-					}
+	// Add a "name" property to each node, unless it's already returned as a whole, or rows are de-duplicated by
+	// the returned values alone
+	for _, nodeId := range nodeIds {
+		if c.Distinct || slices.Contains(wholeNodeIds, nodeId) || (nodeId == withRowsNode && q.withColumns != nil) || slices.Contains(q.relationshipVariables, nodeId) {
+			continue
+		}
+		metadataNamePath := strings.Join([]string{nodeId, "metadata.name"}, ".")
+		items = append(items, &ReturnItem{JsonPath: metadataNamePath, Alias: "name"})
+	}
 
-					switch strings.ToUpper(item.Aggregate) {
-					case "COUNT":
-						if aggregateResult == nil {
-							aggregateResult = 0
-						}
-						aggregateResult = aggregateResult.(int) + 1
-					case "SUM":
-						if result != nil {
-							if aggregateResult == nil {
-								aggregateResult = reflect.ValueOf(result).Interface()
-							} else {
-								v1 := reflect.ValueOf(aggregateResult)
-								v2 := reflect.ValueOf(result)
-								v1 = reflect.ValueOf(v1.Interface()).Convert(v1.Type())
-								if v1.Kind() == reflect.Ptr {
-									v1 = v1.Elem()
-								}
-								if v2.Kind() == reflect.Ptr {
-									v2 = v2.Elem()
-								}
+	resources := map[string][]map[string]interface{}{}
+	for _, nodeId := range nodeIds {
+		resources[nodeId] = q.returnedResources(nodeId, results)
+	}
+	if err := q.orderResources(c.OrderBy, nodeIds, resources); err != nil {
+		return err
+	}
+	if q.Rows {
+		for _, nodeId := range nodeIds {
+			if q.resultMap[nodeId] == nil {
+				return newDiagnosticError(CodeUnknownReturnNode, nil, "node", nodeId)
+			}
+		}
+		// The items added for the name of each node aren't columns of the rows
+		rows, err := q.returnRows(c, items[:len(c.Items)], nodeIds, resources)
+		if err != nil {
+			return err
+		}
+		results.Rows = append(results.Rows, rows...)
+		if results.Rows == nil {
+			results.Rows = []map[string]interface{}{}
+		}
+	}
 
-								isCPUResource := strings.Contains(pathStr, "resources.limits.cpu") || strings.Contains(pathStr, "resources.requests.cpu")
-								isMemoryResource := strings.Contains(pathStr, "resources.limits.memory") || strings.Contains(pathStr, "resources.requests.memory")
-
-								switch v1.Kind() {
-								case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-									aggregateResult = v1.Int() + v2.Int()
-								case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-									aggregateResult = v1.Uint() + v2.Uint()
-								case reflect.Float32, reflect.Float64:
-									aggregateResult = v1.Float() + v2.Float()
-								case reflect.String:
-									if isCPUResource {
-										v1Cpu, err := convertToMilliCPU(v1.String())
-										if err != nil {
-											return *results, fmt.Errorf("Error processing cpu resources value: %v", err)
-										}
-										v2Cpu, err := convertToMilliCPU(v2.String())
-										if err != nil {
-											return *results, fmt.Errorf("Error processing cpu resources value: %v", err)
-										}
+	for _, item := range items {
+		nodeId := strings.Split(item.JsonPath, ".")[0]
+		if q.resultMap[nodeId] == nil {
+			return newDiagnosticError(CodeUnknownReturnNode, nil, "node", nodeId)
+		}
 
-										aggregateResult = convertMilliCPUToStandard(v1Cpu + v2Cpu)
-									} else if isMemoryResource {
-										v1Mem, err := convertMemoryToBytes(v1.String())
-										if err != nil {
-											return *results, fmt.Errorf("Error processing memory resources value: %v", err)
-										}
-										v2Mem, err := convertMemoryToBytes(v2.String())
-										if err != nil {
-											return *results, fmt.Errorf("Error processing memory resources value: %v", err)
-										}
+		// Keys with dots are escaped, e.g. labels.app\.kubernetes\.io/name
+		pathParts := splitFieldPath(item.JsonPath)[1:]
+		pathStr := "$." + strings.Join(pathParts, ".")
+		for i, part := range pathParts {
+			pathParts[i] = strings.ReplaceAll(part, "\\.", ".")
+		}
 
-										aggregateResult = convertBytesToMemory(v1Mem + v2Mem)
-									}
-								case reflect.Slice:
-									v1Strs, err := convertToStringSlice(v1)
-									if err != nil {
-										return *results, fmt.Errorf("error converting v1 to string slice: %v", err)
-									}
+		if pathStr == "$." {
+			pathStr = "$"
+		}
 
-									v2Strs, err := convertToStringSlice(v2)
-									if err != nil {
-										return *results, fmt.Errorf("error converting v2 to string slice: %v", err)
-									}
+		if results.Data[nodeId] == nil {
+			results.Data[nodeId] = []interface{}{}
+		}
+		var aggregateResult interface{}
+
+		for idx, resource := range resources[nodeId] {
+			// Ensure that the results.Data[nodeId] slice has enough elements to store the current resource.
+			// If the current index (idx) is beyond the current length of the slice,
+			// append a new empty map to the slice to accommodate the new data.
+			if len(results.Data[nodeId].([]interface{})) <= idx {
+				results.Data[nodeId] = append(results.Data[nodeId].([]interface{}), make(map[string]interface{}))
+			}
+			currentMap := results.Data[nodeId].([]interface{})[idx].(map[string]interface{})
 
-									if isCPUResource {
-										v1CpuSum, err := sumMilliCPU(v1Strs)
-										if err != nil {
-											return *results, fmt.Errorf("error processing v1 cpu value: %v", err)
-										}
+			if ExplainFields && item.Aggregate == "" {
+				if currentMap["_provenance"] == nil {
+					currentMap["_provenance"] = make(map[string]interface{})
+				}
+				currentMap["_provenance"].(map[string]interface{})[returnItemLabel(item)] = q.returnItemProvenance(item, nodeId)
+			}
 
-										v2CpuSum, err := sumMilliCPU(v2Strs)
-										if err != nil {
-											return *results, fmt.Errorf("error processing v2 cpu value: %v", err)
-										}
+			if item.Function != "" {
+				value, err := q.returnFunctionValue(item, resource)
+				if err != nil {
+					return err
+				}
+				key := item.Alias
+				if key == "" {
+					key = functionName(item.Function)
+				}
+				currentMap[key] = value
+				continue
+			}
 
-										aggregateResult = []string{convertMilliCPUToStandard(v1CpuSum + v2CpuSum)}
-									} else if isMemoryResource {
-										v1MemSum, err := sumMemoryBytes(v1Strs)
-										if err != nil {
-											return *results, fmt.Errorf("error processing v1 memory value: %v", err)
-										}
+			result, err := returnPathLookup(resource, pathStr)
+			if err != nil {
+				logDebug("Path not found", "path", item.JsonPath)
+				result = nil
+			}
 
-										v2MemSum, err := sumMemoryBytes(v2Strs)
-										if err != nil {
-											return *results, fmt.Errorf("error processing v2 memory value: %v", err)
-										}
+			switch strings.ToUpper(item.Aggregate) {
+			case "COUNT":
+				if aggregateResult == nil {
+					aggregateResult = 0
+				}
+				aggregateResult = aggregateResult.(int) + 1
+			case "SUM":
+				aggregateResult, err = addToSum(aggregateResult, result, pathStr)
+				if err != nil {
+					return err
+				}
+			}
 
-										aggregateResult = []string{convertBytesToMemory(v1MemSum + v2MemSum)}
-									}
-								default:
-									// Handle unsupported types or error out
-									return *results, fmt.Errorf("unsupported type for SUM: %v", v1.Kind())
-								}
+			if item.Aggregate == "" {
+				key := item.Alias
+				if key == "" && hasListSelector(pathStr) {
+					// The values a path selects in lists are those of the path as a whole, not of its fields
+					key = strings.Join(pathParts, ".")
+				}
+				if key == "" {
+					if len(pathParts) == 1 {
+						key = pathParts[0]
+					} else if len(pathParts) > 1 {
+						nestedMap := currentMap
+						for i := 0; i < len(pathParts)-1; i++ {
+							if _, exists := nestedMap[pathParts[i]]; !exists {
+								nestedMap[pathParts[i]] = make(map[string]interface{})
 							}
+							nestedMap = nestedMap[pathParts[i]].(map[string]interface{})
 						}
-					}
-
-					if item.Aggregate == "" {
-						key := item.Alias
-						if key == "" {
-							if len(pathParts) == 1 {
-								key = pathParts[0]
-							} else if len(pathParts) > 1 {
-								nestedMap := currentMap
-								for i := 0; i < len(pathParts)-1; i++ {
-									if _, exists := nestedMap[pathParts[i]]; !exists {
-										nestedMap[pathParts[i]] = make(map[string]interface{})
-									}
-									nestedMap = nestedMap[pathParts[i]].(map[string]interface{})
-								}
-								nestedMap[pathParts[len(pathParts)-1]] = result
-								continue
-							} else {
-								key = "$"
-							}
+						nestedMap[pathParts[len(pathParts)-1]] = result
+						continue
+					} else {
+						// Whole-node projection, merge the object's fields into the row
+						for k, v := range resource {
+							currentMap[k] = v
 						}
-						currentMap[key] = result
+						continue
 					}
 				}
-				if item.Aggregate != "" {
-					if results.Data["aggregate"] == nil {
-						results.Data["aggregate"] = make(map[string]interface{})
-					}
-					aggregateMap := results.Data["aggregate"].(map[string]interface{})
+				currentMap[key] = result
+			}
+		}
+		if item.Aggregate != "" {
+			if results.Data["aggregate"] == nil {
+				results.Data["aggregate"] = make(map[string]interface{})
+			}
+			aggregateMap := results.Data["aggregate"].(map[string]interface{})
 
-					key := item.Alias
-					if key == "" {
-						key = strings.ToLower(item.Aggregate) + ":" + nodeId + "." + strings.Replace(pathStr, "$.", "", 1)
-					}
+			key := item.Alias
+			if key == "" {
+				key = strings.ToLower(item.Aggregate) + ":" + nodeId + "." + strings.Replace(pathStr, "$.", "", 1)
+			}
 
-					if slice, ok := aggregateResult.([]interface{}); ok && len(slice) == 0 {
-						aggregateResult = nil
-					} else if strSlice, ok := aggregateResult.([]string); ok && len(strSlice) == 1 {
-						aggregateResult = strSlice[0]
-					}
-					aggregateMap[key] = aggregateResult
+			if slice, ok := aggregateResult.([]interface{}); ok && len(slice) == 0 {
+				aggregateResult = nil
+			} else if strSlice, ok := aggregateResult.([]string); ok && len(strSlice) == 1 {
+				aggregateResult = strSlice[0]
+			}
+			aggregateMap[key] = aggregateResult
+			if ExplainFields {
+				if aggregateMap["_provenance"] == nil {
+					aggregateMap["_provenance"] = make(map[string]interface{})
 				}
+				aggregateMap["_provenance"].(map[string]interface{})[key] = q.returnItemProvenance(item, nodeId)
 			}
-
-		default:
-			return *results, fmt.Errorf("unknown clause type: %T", c)
 		}
 	}
-	// build the graph
-	q.buildGraph(results)
+	if q.Hide != nil {
+		for _, nodeId := range nodeIds {
+			// The rows of WITH and UNWIND and the links of relationships aren't resources
+			if nodeId == withRowsNode || slices.Contains(q.relationshipVariables, nodeId) {
+				continue
+			}
+			rows, _ := results.Data[nodeId].([]interface{})
+			for idx, resource := range resources[nodeId] {
+				if idx < len(rows) {
+					rows[idx].(map[string]interface{})["_uid"] = resourceIdentity(resource)
+				}
+			}
+		}
+	}
+	if c.Distinct {
+		for _, nodeId := range nodeIds {
+			if rows, ok := results.Data[nodeId].([]interface{}); ok {
+				results.Data[nodeId] = distinctRows(rows)
+			}
+		}
+	}
+	return nil
+}
 
-	// clear the result cache and result map
-	resultCache = make(map[string]interface{})
-	resultMap = make(map[string]interface{})
-	return *results, nil
+// returnFunctionValue computes the function of a RETURN item for a resource of the node it's called on
+func (q *QueryExecutor) returnFunctionValue(item *ReturnItem, resource map[string]interface{}) (interface{}, error) {
+	nodeId := strings.Split(item.JsonPath, ".")[0]
+	switch {
+	case isValueFunction(item.Function):
+		return evaluateValueFunction(item.Function, item.JsonPath, item.Args, resource, false)
+	case item.JsonPath != nodeId:
+		return nil, newDiagnosticError(CodeFunctionExpectsNode, nil, "function", strings.ToLower(item.Function), "argument", item.JsonPath)
+	case item.Function == "LOGS":
+		return q.podLogLines(resource, item.Args)
+	case item.Function == "TYPE" && !slices.Contains(q.relationshipVariables, nodeId):
+		return nil, newDiagnosticError(CodeTypeExpectsRelationship, nil, "argument", item.JsonPath)
+	case len(item.Args) > 0:
+		return nil, newDiagnosticError(CodeFunctionArguments, nil, "function", strings.ToLower(item.Function), "reason", fmt.Sprintf("takes 1 argument, got %d", len(item.Args)+1))
+	}
+	return evaluateReturnFunction(item.Function, resource)
 }
 
-func (q *QueryExecutor) processRelationship(rel *Relationship, c *MatchClause, results *QueryResult, filteredResults map[string][]map[string]interface{}) (bool, error) {
-	// fmt.Printf("Debug: Processing relationship: %+v\n", rel)
+// orderResources sorts the resources of the returned nodes by the ORDER BY items naming them, keeping the order of
+// those that compare equal
+func (q *QueryExecutor) orderResources(orderBy []*OrderItem, nodeIds []string, resources map[string][]map[string]interface{}) error {
+	byNode := map[string][]*OrderItem{}
+	for _, item := range orderBy {
+		// Values of a WITH clause are read from its rows
+		if slices.Contains(q.withColumns, strings.Split(item.JsonPath, ".")[0]) {
+			item = &OrderItem{JsonPath: withRowsNode + "." + item.JsonPath, Descending: item.Descending}
+		}
+		nodeId := strings.Split(item.JsonPath, ".")[0]
+		if !slices.Contains(nodeIds, nodeId) {
+			return newDiagnosticError(CodeUnknownReturnNode, nil, "node", nodeId)
+		}
+		byNode[nodeId] = append(byNode[nodeId], item)
+	}
+	for nodeId, items := range byNode {
+		keys := make([]string, len(items))
+		for i, item := range items {
+			keys[i] = "$"
+			if _, path, ok := strings.Cut(item.JsonPath, "."); ok {
+				keys[i] = "$." + path
+			}
+		}
+		// The rows of WITH aren't resources, each is sorted along with its values
+		type orderedResource struct {
+			resource map[string]interface{}
+			values   []interface{}
+		}
+		ordered := make([]orderedResource, len(resources[nodeId]))
+		for i, resource := range resources[nodeId] {
+			ordered[i] = orderedResource{resource: resource, values: make([]interface{}, len(keys))}
+			for j, key := range keys {
+				ordered[i].values[j], _ = jsonPathLookup(resource, key)
+			}
+		}
+		slices.SortStableFunc(ordered, func(a, b orderedResource) int {
+			for i, item := range items {
+				c := compareOrderValues(a.values[i], b.values[i])
+				if item.Descending {
+					c = -c
+				}
+				if c != 0 {
+					return c
+				}
+			}
+			return 0
+		})
+		// resultMap keeps its order, the clauses after RETURN may read it
+		sorted := make([]map[string]interface{}, len(ordered))
+		for i, o := range ordered {
+			sorted[i] = o.resource
+		}
+		resources[nodeId] = sorted
+	}
+	return nil
+}
 
-	// Determine relationship type and fetch related resources
-	var relType RelationshipType
-	if rel.LeftNode.ResourceProperties.Kind == "" || rel.RightNode.ResourceProperties.Kind == "" {
-		// error out
-		return false, fmt.Errorf("must specify kind for all nodes in match clause")
+// compareOrderValues orders the values ORDER BY sorts by: numbers by value, then strings, which sort timestamps
+// chronologically, then booleans, then the others by their JSON encoding, with missing values last
+func compareOrderValues(a, b interface{}) int {
+	rank := func(v interface{}) int {
+		switch v.(type) {
+		case float64, float32, int, int32, int64:
+			return 0
+		case string:
+			return 1
+		case bool:
+			return 2
+		case nil:
+			return 4
+		}
+		return 3
 	}
-	leftKind, err := FindGVR(q.Clientset, rel.LeftNode.ResourceProperties.Kind)
-	if err != nil {
-		return false, fmt.Errorf("error finding API resource >> %s", err)
+	if rank(a) != rank(b) {
+		return rank(a) - rank(b)
 	}
-	rightKind, err := FindGVR(q.Clientset, rel.RightNode.ResourceProperties.Kind)
-	if err != nil {
-		return false, fmt.Errorf("error finding API resource >> %s", err)
+	switch a := a.(type) {
+	case string:
+		return strings.Compare(a, b.(string))
+	case bool:
+		if a == b.(bool) {
+			return 0
+		} else if a {
+			return 1
+		}
+		return -1
+	case nil:
+		return 0
+	}
+	if rank(a) == 0 {
+		x, _ := toFloat64(a)
+		y, _ := toFloat64(b)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
 	}
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return strings.Compare(string(x), string(y))
+}
 
-	if rightKind.Resource == "namespaces" || leftKind.Resource == "namespaces" {
-		relType = NamespaceHasResource
+// returnedResources are the resources of a node RETURN projects: those of resultMap that the executor's Hide doesn't
+// hide, which are counted in the result's Hidden
+func (q *QueryExecutor) returnedResources(nodeId string, results *QueryResult) []map[string]interface{} {
+	all, _ := q.resultMap[nodeId].([]map[string]interface{})
+	if q.Hide == nil || nodeId == withRowsNode || slices.Contains(q.relationshipVariables, nodeId) {
+		return all
+	}
+	shown := make([]map[string]interface{}, 0, len(all))
+	for _, resource := range all {
+		if q.Hide(resourceIdentity(resource)) {
+			results.Hidden++
+			continue
+		}
+		shown = append(shown, resource)
 	}
+	return shown
+}
 
-	if relType == "" {
-		for _, resourceRelationship := range relationshipRules {
-			if (strings.EqualFold(leftKind.Resource, resourceRelationship.KindA) && strings.EqualFold(rightKind.Resource, resourceRelationship.KindB)) ||
-				(strings.EqualFold(rightKind.Resource, resourceRelationship.KindA) && strings.EqualFold(leftKind.Resource, resourceRelationship.KindB)) {
-				relType = resourceRelationship.Relationship
+// distinctRows drops the rows that repeat an earlier row's values, keeping the order of the first occurrences
+func distinctRows(rows []interface{}) []interface{} {
+	distinct := []interface{}{}
+	seen := map[string]bool{}
+	for _, row := range rows {
+		values := row
+		if m, ok := row.(map[string]interface{}); ok && m["_provenance"] != nil {
+			values = maps.Clone(m)
+			delete(values.(map[string]interface{}), "_provenance")
+		}
+		key, err := json.Marshal(values)
+		if err != nil {
+			distinct = append(distinct, row)
+			continue
+		}
+		if !seen[string(key)] {
+			seen[string(key)] = true
+			distinct = append(distinct, row)
+		}
+	}
+	return distinct
+}
+
+// addToSum adds a value to the running SUM of a RETURN item, pathStr is the item's path
+func addToSum(sum, value interface{}, pathStr string) (interface{}, error) {
+	if value == nil {
+		return sum, nil
+	}
+	if sum == nil {
+		return reflect.ValueOf(value).Interface(), nil
+	}
+	v1 := reflect.ValueOf(sum)
+	v2 := reflect.ValueOf(value)
+	v1 = reflect.ValueOf(v1.Interface()).Convert(v1.Type())
+	if v1.Kind() == reflect.Ptr {
+		v1 = v1.Elem()
+	}
+	if v2.Kind() == reflect.Ptr {
+		v2 = v2.Elem()
+	}
+
+	isCPUResource := strings.Contains(pathStr, "resources.limits.cpu") || strings.Contains(pathStr, "resources.requests.cpu")
+	isMemoryResource := strings.Contains(pathStr, "resources.limits.memory") || strings.Contains(pathStr, "resources.requests.memory")
+
+	switch v1.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		sum = v1.Int() + v2.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		sum = v1.Uint() + v2.Uint()
+	case reflect.Float32, reflect.Float64:
+		sum = v1.Float() + v2.Float()
+	case reflect.String:
+		if isCPUResource {
+			v1Cpu, err := convertToMilliCPU(v1.String())
+			if err != nil {
+				return nil, aggregationError(err, "Error processing cpu resources value: %v", err)
 			}
+			v2Cpu, err := convertToMilliCPU(v2.String())
+			if err != nil {
+				return nil, aggregationError(err, "Error processing cpu resources value: %v", err)
+			}
+
+			sum = convertMilliCPUToStandard(v1Cpu + v2Cpu)
+		} else if isMemoryResource {
+			v1Mem, err := convertMemoryToBytes(v1.String())
+			if err != nil {
+				return nil, aggregationError(err, "Error processing memory resources value: %v", err)
+			}
+			v2Mem, err := convertMemoryToBytes(v2.String())
+			if err != nil {
+				return nil, aggregationError(err, "Error processing memory resources value: %v", err)
+			}
+
+			sum = convertBytesToMemory(v1Mem + v2Mem)
 		}
+	case reflect.Slice:
+		v1Strs, err := convertToStringSlice(v1)
+		if err != nil {
+			return nil, aggregationError(err, "error converting v1 to string slice: %v", err)
+		}
+
+		v2Strs, err := convertToStringSlice(v2)
+		if err != nil {
+			return nil, aggregationError(err, "error converting v2 to string slice: %v", err)
+		}
+
+		if isCPUResource {
+			v1CpuSum, err := sumMilliCPU(v1Strs)
+			if err != nil {
+				return nil, aggregationError(err, "error processing v1 cpu value: %v", err)
+			}
+
+			v2CpuSum, err := sumMilliCPU(v2Strs)
+			if err != nil {
+				return nil, aggregationError(err, "error processing v2 cpu value: %v", err)
+			}
+
+			sum = []string{convertMilliCPUToStandard(v1CpuSum + v2CpuSum)}
+		} else if isMemoryResource {
+			v1MemSum, err := sumMemoryBytes(v1Strs)
+			if err != nil {
+				return nil, aggregationError(err, "error processing v1 memory value: %v", err)
+			}
+
+			v2MemSum, err := sumMemoryBytes(v2Strs)
+			if err != nil {
+				return nil, aggregationError(err, "error processing v2 memory value: %v", err)
+			}
+
+			sum = []string{convertBytesToMemory(v1MemSum + v2MemSum)}
+		}
+	default:
+		// Handle unsupported types or error out
+		return nil, aggregationError(nil, "unsupported type for SUM: %v", v1.Kind())
 	}
+	return sum, nil
+}
 
-	if relType == "" {
-		// no relationship type found, error out
-		return false, fmt.Errorf("relationship type not found between %s and %s", leftKind, rightKind)
+func (q *QueryExecutor) processRelationship(rel *Relationship, c *MatchClause, results *QueryResult, filteredResults map[string][]map[string]interface{}) (bool, error) {
+	// fmt.Printf("Debug: Processing relationship: %+v\n", rel)
+	if rel.Hops != nil {
+		return q.processVariableLengthRelationship(rel, c, results, filteredResults)
+	}
+	if isKindlessRelationship(rel) {
+		return q.processKindlessRelationship(rel, c, results, filteredResults)
 	}
 
-	rule, err := findRuleByRelationshipType(relType)
+	rule, leftKind, rightKind, err := q.relationshipRule(rel)
 	if err != nil {
-		return false, fmt.Errorf("error determining relationship type >> %s", err)
+		return false, err
+	}
+	if rule, err = q.analyzeRelationship(rule, rel); err != nil {
+		return false, err
 	}
 
 	// Fetch and process related resources
@@ -626,15 +1196,15 @@ func (q *QueryExecutor) processRelationship(rel *Relationship, c *MatchClause, r
 	var filteredDirection Direction
 
 	if rule.KindA == rightKind.Resource {
-		resourcesA = getResourcesFromMap(filteredResults, rel.RightNode.ResourceProperties.Name)
-		resourcesB = getResourcesFromMap(filteredResults, rel.LeftNode.ResourceProperties.Name)
+		resourcesA = q.getResourcesFromMap(filteredResults, rel.RightNode.ResourceProperties.Name)
+		resourcesB = q.getResourcesFromMap(filteredResults, rel.LeftNode.ResourceProperties.Name)
 		filteredDirection = Left
 	} else if rule.KindA == leftKind.Resource {
-		resourcesA = getResourcesFromMap(filteredResults, rel.LeftNode.ResourceProperties.Name)
-		resourcesB = getResourcesFromMap(filteredResults, rel.RightNode.ResourceProperties.Name)
+		resourcesA = q.getResourcesFromMap(filteredResults, rel.LeftNode.ResourceProperties.Name)
+		resourcesB = q.getResourcesFromMap(filteredResults, rel.RightNode.ResourceProperties.Name)
 		filteredDirection = Right
 	} else {
-		return false, fmt.Errorf("relationship rule not found for %s and %s - This code path should be invalid, likely problem with rule definitions", rel.LeftNode.ResourceProperties.Kind, rel.RightNode.ResourceProperties.Kind)
+		return false, newDiagnosticError(CodeRelationshipRuleMissing, nil, "left", rel.LeftNode.ResourceProperties.Kind, "right", rel.RightNode.ResourceProperties.Kind)
 	}
 
 	matchedResources := applyRelationshipRule(resourcesA, resourcesB, rule, filteredDirection)
@@ -647,19 +1217,19 @@ func (q *QueryExecutor) processRelationship(rel *Relationship, c *MatchClause, r
 
 	// if resultMap[rel.RightNode.ResourceProperties.Name] already contains items, we need to check which has a smaller number of items, and use the smaller of the two lists
 	// this is to ensure that we don't end up with unflitered items which should have been filtered out in the relationship rule application
-	if resultMap[rel.RightNode.ResourceProperties.Name] != nil {
-		if len(resultMap[rel.RightNode.ResourceProperties.Name].([]map[string]interface{})) > len(matchedResources["right"].([]map[string]interface{})) {
-			resultMap[rel.RightNode.ResourceProperties.Name] = matchedResources["right"]
+	if q.resultMap[rel.RightNode.ResourceProperties.Name] != nil {
+		if len(q.resultMap[rel.RightNode.ResourceProperties.Name].([]map[string]interface{})) > len(matchedResources["right"].([]map[string]interface{})) {
+			q.resultMap[rel.RightNode.ResourceProperties.Name] = matchedResources["right"]
 		}
 	} else {
-		resultMap[rel.RightNode.ResourceProperties.Name] = matchedResources["right"]
+		q.resultMap[rel.RightNode.ResourceProperties.Name] = matchedResources["right"]
 	}
-	if resultMap[rel.LeftNode.ResourceProperties.Name] != nil {
-		if len(resultMap[rel.LeftNode.ResourceProperties.Name].([]map[string]interface{})) > len(matchedResources["left"].([]map[string]interface{})) {
-			resultMap[rel.LeftNode.ResourceProperties.Name] = matchedResources["left"]
+	if q.resultMap[rel.LeftNode.ResourceProperties.Name] != nil {
+		if len(q.resultMap[rel.LeftNode.ResourceProperties.Name].([]map[string]interface{})) > len(matchedResources["left"].([]map[string]interface{})) {
+			q.resultMap[rel.LeftNode.ResourceProperties.Name] = matchedResources["left"]
 		}
 	} else {
-		resultMap[rel.LeftNode.ResourceProperties.Name] = matchedResources["left"]
+		q.resultMap[rel.LeftNode.ResourceProperties.Name] = matchedResources["left"]
 	}
 
 	// fmt.Printf("Debug: Matched resources: %+v\n", matchedResources)
@@ -670,7 +1240,7 @@ func (q *QueryExecutor) processRelationship(rel *Relationship, c *MatchClause, r
 				if name, ok := metadata["name"].(string); ok {
 					node := Node{
 						Id:   rel.RightNode.ResourceProperties.Name,
-						Kind: resultMap[rel.RightNode.ResourceProperties.Name].([]map[string]interface{})[idx]["kind"].(string),
+						Kind: q.resultMap[rel.RightNode.ResourceProperties.Name].([]map[string]interface{})[idx]["kind"].(string),
 						Name: name,
 					}
 					if node.Kind != "Namespace" {
@@ -688,7 +1258,7 @@ func (q *QueryExecutor) processRelationship(rel *Relationship, c *MatchClause, r
 				if name, ok := metadata["name"].(string); ok {
 					node := Node{
 						Id:   rel.LeftNode.ResourceProperties.Name,
-						Kind: resultMap[rel.LeftNode.ResourceProperties.Name].([]map[string]interface{})[idx]["kind"].(string),
+						Kind: q.resultMap[rel.LeftNode.ResourceProperties.Name].([]map[string]interface{})[idx]["kind"].(string),
 						Name: name,
 					}
 					if node.Kind != "Namespace" {
@@ -702,8 +1272,8 @@ func (q *QueryExecutor) processRelationship(rel *Relationship, c *MatchClause, r
 
 	// Only add edge if both nodes exist
 	if len(matchedResources["right"].([]map[string]interface{})) > 0 && len(matchedResources["left"].([]map[string]interface{})) > 0 {
-		rightNodeResources := resultMap[rel.RightNode.ResourceProperties.Name].([]map[string]interface{})
-		leftNodeResources := resultMap[rel.LeftNode.ResourceProperties.Name].([]map[string]interface{})
+		rightNodeResources := q.resultMap[rel.RightNode.ResourceProperties.Name].([]map[string]interface{})
+		leftNodeResources := q.resultMap[rel.LeftNode.ResourceProperties.Name].([]map[string]interface{})
 
 		for _, rightNodeResource := range rightNodeResources {
 			rightNodeId := fmt.Sprintf("%s/%s", rightNodeResource["kind"].(string), rightNodeResource["metadata"].(map[string]interface{})["name"].(string))
@@ -728,7 +1298,7 @@ func (q *QueryExecutor) processRelationship(rel *Relationship, c *MatchClause, r
 				results.Graph.Edges = append(results.Graph.Edges, Edge{
 					From: rightNodeId,
 					To:   leftNodeId,
-					Type: string(relType),
+					Type: string(rule.Relationship),
 				})
 			}
 		}
@@ -737,11 +1307,76 @@ func (q *QueryExecutor) processRelationship(rel *Relationship, c *MatchClause, r
 	return filteredA || filteredB, nil
 }
 
-func getResourcesFromMap(filteredResults map[string][]map[string]interface{}, key string) []map[string]interface{} {
+// relationshipRule determines which rule joins the two nodes of a relationship, returning it
+// along with the resources both sides resolve to
+func (q *QueryExecutor) relationshipRule(rel *Relationship) (RelationshipRule, schema.GroupVersionResource, schema.GroupVersionResource, error) {
+	var relType RelationshipType
+	leftKind, rightKind, err := q.relationshipKinds(rel)
+	if err != nil {
+		return RelationshipRule{}, schema.GroupVersionResource{}, schema.GroupVersionResource{}, err
+	}
+
+	if rightKind.Resource == "namespaces" || leftKind.Resource == "namespaces" {
+		relType = NamespaceHasResource
+	}
+
+	if relType == "" {
+		for _, resourceRelationship := range activeRelationshipRules() {
+			if (strings.EqualFold(leftKind.Resource, resourceRelationship.KindA) && strings.EqualFold(rightKind.Resource, resourceRelationship.KindB)) ||
+				(strings.EqualFold(rightKind.Resource, resourceRelationship.KindA) && strings.EqualFold(leftKind.Resource, resourceRelationship.KindB)) {
+				relType = resourceRelationship.Relationship
+			}
+		}
+	}
+
+	if relType == "" {
+		// Rules relating a kind to every other kind, e.g. Events to the resources they're about, apply last
+		for _, resourceRelationship := range activeRelationshipRules() {
+			if resourceRelationship.KindB == "*" && (strings.EqualFold(leftKind.Resource, resourceRelationship.KindA) || strings.EqualFold(rightKind.Resource, resourceRelationship.KindA)) {
+				relType = resourceRelationship.Relationship
+			}
+		}
+	}
+
+	if relType == "" {
+		// no relationship type found, error out
+		return RelationshipRule{}, schema.GroupVersionResource{}, schema.GroupVersionResource{}, newDiagnosticError(CodeRelationshipNotFound, nil, "left", leftKind, "right", rightKind)
+	}
+
+	rule, err := findRuleByRelationshipType(relType)
+	if err != nil {
+		return RelationshipRule{}, schema.GroupVersionResource{}, schema.GroupVersionResource{}, fmt.Errorf("error determining relationship type >> %w", err)
+	}
+	return rule, leftKind, rightKind, nil
+}
+
+// relationshipKinds resolves the resources of the two nodes of a relationship, which must each have a single kind
+func (q *QueryExecutor) relationshipKinds(rel *Relationship) (schema.GroupVersionResource, schema.GroupVersionResource, error) {
+	if rel.LeftNode.ResourceProperties.Kind == "" || rel.RightNode.ResourceProperties.Kind == "" {
+		// error out
+		return schema.GroupVersionResource{}, schema.GroupVersionResource{}, newDiagnosticError(CodeMissingKind, nil)
+	}
+	for _, node := range []*NodePattern{rel.LeftNode, rel.RightNode} {
+		if IsMultiKindPattern(node.ResourceProperties.Kind) {
+			return schema.GroupVersionResource{}, schema.GroupVersionResource{}, newDiagnosticError(CodeMultiKindRelationship, nil, "node", node.ResourceProperties.Name, "kind", node.ResourceProperties.Kind)
+		}
+	}
+	leftKind, err := FindGVR(q.Clientset, rel.LeftNode.ResourceProperties.Kind)
+	if err != nil {
+		return schema.GroupVersionResource{}, schema.GroupVersionResource{}, fmt.Errorf("error finding API resource >> %w", err)
+	}
+	rightKind, err := FindGVR(q.Clientset, rel.RightNode.ResourceProperties.Kind)
+	if err != nil {
+		return schema.GroupVersionResource{}, schema.GroupVersionResource{}, fmt.Errorf("error finding API resource >> %w", err)
+	}
+	return leftKind, rightKind, nil
+}
+
+func (q *QueryExecutor) getResourcesFromMap(filteredResults map[string][]map[string]interface{}, key string) []map[string]interface{} {
 	if filtered, ok := filteredResults[key]; ok {
 		return filtered
 	}
-	if resources, ok := resultMap[key].([]map[string]interface{}); ok {
+	if resources, ok := q.resultMap[key].([]map[string]interface{}); ok {
 		return resources
 	}
 	return nil
@@ -750,17 +1385,21 @@ func getResourcesFromMap(filteredResults map[string][]map[string]interface{}, ke
 func (q *QueryExecutor) processNodes(c *MatchClause, results *QueryResult) error {
 	for _, node := range c.Nodes {
 		if node.ResourceProperties.Kind == "" {
+			// A node without a kind is matched by its relationship to a node with one
+			if q.resultMap[node.ResourceProperties.Name] != nil {
+				continue
+			}
 			// error out
-			return fmt.Errorf("must specify kind for all nodes in match clause")
+			return newDiagnosticError(CodeMissingKind, nil)
 		}
-		debugLog("Node pattern found. Name:", node.ResourceProperties.Name, "Kind:", node.ResourceProperties.Kind)
+		logDebug("Node pattern found", "name", node.ResourceProperties.Name, "kind", node.ResourceProperties.Kind)
 		// check if the node has already been fetched
-		if resultCache[q.resourcePropertyName(node)] == nil {
+		if q.resultCache[q.resourcePropertyName(node)] == nil {
 			err := getNodeResources(node, q, c.ExtraFilters)
 			if err != nil {
-				return fmt.Errorf("error getting node resources >> %s", err)
+				return fmt.Errorf("error getting node resources >> %w", err)
 			}
-			resources := resultMap[node.ResourceProperties.Name].([]map[string]interface{})
+			resources := q.resultMap[node.ResourceProperties.Name].([]map[string]interface{})
 			for _, resource := range resources {
 				metadata, ok := resource["metadata"].(map[string]interface{})
 				if !ok {
@@ -776,8 +1415,10 @@ func (q *QueryExecutor) processNodes(c *MatchClause, results *QueryResult) error
 				}
 				results.Graph.Nodes = append(results.Graph.Nodes, node)
 			}
-		} else if resultMap[node.ResourceProperties.Name] == nil {
-			resultMap[node.ResourceProperties.Name] = resultCache[q.resourcePropertyName(node)]
+		} else if q.resultMap[node.ResourceProperties.Name] == nil {
+			observeCacheLookup(true)
+			q.resultMap[node.ResourceProperties.Name] = q.resultCache[q.resourcePropertyName(node)]
+			q.resultSources[node.ResourceProperties.Name] = resultSource{source: ProvenanceCache, fetchedAt: q.resultCacheFetchedAt[q.resourcePropertyName(node)]}
 		}
 	}
 	return nil
@@ -846,6 +1487,57 @@ func (q *QueryExecutor) buildGraph(result *QueryResult) {
 	result.Graph.Edges = newEdges
 }
 
+// evaluateReturnFunction computes a function call in the RETURN clause for a single resource
+func evaluateReturnFunction(function string, resource map[string]interface{}) (interface{}, error) {
+	metadata, _ := resource["metadata"].(map[string]interface{})
+	switch function {
+	case "ID":
+		return map[string]interface{}{
+			"namespace": getNamespaceName(metadata),
+			"name":      metadata["name"],
+			"uid":       metadata["uid"],
+		}, nil
+	case "NAME":
+		return metadata["name"], nil
+	case "NAMESPACE":
+		return getNamespaceName(metadata), nil
+	case "KIND":
+		return resource["kind"], nil
+	case "UID":
+		return metadata["uid"], nil
+	case "TYPE":
+		// The type of a relationship variable's link
+		return resource["type"], nil
+	default:
+		return nil, newDiagnosticError(CodeUnknownFunction, nil, "function", strings.ToLower(function))
+	}
+}
+
+// resourceIdentity returns a key that is unique per Kubernetes object: its UID,
+// or kind/namespace/name for objects that don't have one (e.g. in tests or dry runs)
+func resourceIdentity(resource map[string]interface{}) string {
+	metadata, _ := resource["metadata"].(map[string]interface{})
+	if uid, ok := metadata["uid"].(string); ok && uid != "" {
+		return uid
+	}
+	return fmt.Sprintf("%v/%s/%v", resource["kind"], getNamespaceName(metadata), metadata["name"])
+}
+
+// dedupeResources drops objects that appear more than once, keeping the first occurrence
+func dedupeResources(resources []map[string]interface{}) []map[string]interface{} {
+	seen := make(map[string]bool, len(resources))
+	deduped := resources[:0]
+	for _, resource := range resources {
+		identity := resourceIdentity(resource)
+		if seen[identity] {
+			continue
+		}
+		seen[identity] = true
+		deduped = append(deduped, resource)
+	}
+	return deduped
+}
+
 func getNamespaceName(metadata map[string]interface{}) string {
 	namespace, ok := metadata["namespace"].(string)
 	if !ok {
@@ -872,15 +1564,16 @@ func getTargetK8sResourceName(resourceTemplate map[string]interface{}, resourceN
 	return name
 }
 
-func (q *QueryExecutor) createK8sResource(node *NodePattern, template map[string]interface{}, name string) error {
+// createK8sResource creates the node's resource from the template, and returns the created object
+func (q *QueryExecutor) createK8sResource(node *NodePattern, template map[string]interface{}, name string) (map[string]interface{}, error) {
 	// Look up the resource kind and name in the cache
 	gvr, err := FindGVR(q.Clientset, node.ResourceProperties.Kind)
 	if err != nil {
-		return fmt.Errorf("error finding API resource >> %v", err)
+		return nil, fmt.Errorf("error finding API resource >> %w", err)
 	}
 	kind := q.getSingularNameForGVR(gvr)
 	if kind == "" {
-		return fmt.Errorf("error finding singular name for resource >> %v", err)
+		return nil, fmt.Errorf("error finding singular name for resource >> %w", err)
 	}
 
 	// Construct the resource from the spec
@@ -888,111 +1581,168 @@ func (q *QueryExecutor) createK8sResource(node *NodePattern, template map[string
 	resource := template
 	resource["apiVersion"] = gvr.GroupVersion().String()
 	resource["kind"] = kind
-	resource["metadata"] = make(map[string]interface{})
-	resource["metadata"].(map[string]interface{})["name"] = name
-	resource["metadata"].(map[string]interface{})["namespace"] = Namespace
+	metadata, ok := resource["metadata"].(map[string]interface{})
+	if !ok {
+		metadata = make(map[string]interface{})
+		resource["metadata"] = metadata
+	}
+	metadata["name"] = name
+	metadata["namespace"] = q.namespace
 
 	// Create the resource
-	_, err = q.DynamicClient.Resource(gvr).Namespace(Namespace).Create(context.Background(), &unstructured.Unstructured{Object: resource}, metav1.CreateOptions{})
-	if err != nil {
-		return err
+	if err := q.context().Err(); err != nil {
+		return nil, err
+	}
+	if len(q.Ledger.find("created", gvr, q.namespace, name, "")) > 0 {
+		Logger().Info("Skipping resource created by the resumed run", "resource", gvr.Resource, "name", name)
+		return resource, nil
+	}
+	var created, existing *unstructured.Unstructured
+	if ServerSideApply {
+		if q.Atomic {
+			// An apply updates the resource if it exists, which is undone by setting its fields back
+			q.observeAPICall("get", gvr)
+			existing, err = q.DynamicClient.Resource(gvr).Namespace(q.namespace).Get(q.context(), name, metav1.GetOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				return nil, apiError("get", gvr, err)
+			}
+		}
+		// The resource is created, or updated if it exists, with the fields of the template owned by the field manager
+		configuration, err := json.Marshal(resource)
+		if err != nil {
+			return nil, err
+		}
+		q.observeAPICall("patch", gvr)
+		created, err = q.DynamicClient.Resource(gvr).Namespace(q.namespace).Patch(q.context(), name, types.ApplyPatchType, configuration, metav1.PatchOptions{FieldManager: FieldManager})
+		if err != nil {
+			return nil, apiError("apply", gvr, err)
+		}
+	} else {
+		q.observeAPICall("create", gvr)
+		created, err = q.DynamicClient.Resource(gvr).Namespace(q.namespace).Create(q.context(), &unstructured.Unstructured{Object: resource}, metav1.CreateOptions{FieldManager: FieldManager})
+		if err != nil {
+			return nil, apiError("create", gvr, err)
+		}
 	}
-	fmt.Printf("Created %s/%s\n", gvr.Resource, name)
+	Logger().Info("Created resource", "resource", gvr.Resource, "name", name)
+	entry := newLedgerEntry("created", gvr, q.namespace, name)
+	entry.UID, entry.ResourceVersion = string(created.GetUID()), created.GetResourceVersion()
 
-	return nil
+	return created.Object, q.recordChange(entry, func() (*undoStep, error) {
+		if existing != nil && existing.GetUID() == created.GetUID() {
+			return patchUndo(existing.Object, created.Object, "")
+		}
+		return createUndo(created.Object)
+	})
 }
 
 func (q *QueryExecutor) getSingularNameForGVR(gvr schema.GroupVersionResource) string {
-	// Get the singular name for the resource
-	// This is a workaround for the fact that the k8s API doesn't provide a way to get the singular name
-	// See
-	apiResourceList, err := q.Clientset.DiscoveryClient.ServerPreferredResources()
+	kind, err := KindForGVR(q.Clientset, gvr)
 	if err != nil {
-		panic(err.Error())
-	}
-	for _, resourceGroup := range apiResourceList {
-		for _, resource := range resourceGroup.APIResources {
-			if resource.Name == gvr.Resource {
-				return resource.Kind
-			}
-		}
+		return ""
 	}
-
-	return ""
+	return kind
 }
 
 func (q *QueryExecutor) deleteK8sResources(nodeId string) error {
-	resources := resultMap[nodeId].([]map[string]interface{})
+	resources := q.resultMap[nodeId].([]map[string]interface{})
 
 	for i := range resources {
 		// Look up the resource kind and name in the cache
 		gvr, err := FindGVR(q.Clientset, resources[i]["kind"].(string))
 		if err != nil {
-			return fmt.Errorf("error finding API resource >> %v", err)
+			return fmt.Errorf("error finding API resource >> %w", err)
 		}
-		resourceName := resultMap[nodeId].([]map[string]interface{})[i]["metadata"].(map[string]interface{})["name"].(string)
-		resourceNamespace := resultMap[nodeId].([]map[string]interface{})[i]["metadata"].(map[string]interface{})["namespace"].(string)
+		resourceName := q.resultMap[nodeId].([]map[string]interface{})[i]["metadata"].(map[string]interface{})["name"].(string)
+		resourceNamespace := q.resultMap[nodeId].([]map[string]interface{})[i]["metadata"].(map[string]interface{})["namespace"].(string)
 
-		err = q.DynamicClient.Resource(gvr).Namespace(resourceNamespace).Delete(context.Background(), resourceName, metav1.DeleteOptions{})
+		if err := q.context().Err(); err != nil {
+			return err
+		}
+		// An object deleted by the resumed run may still be listed while its finalizers run
+		uid, _ := resources[i]["metadata"].(map[string]interface{})["uid"].(string)
+		if uid != "" && len(q.Ledger.find("deleted", gvr, resourceNamespace, resourceName, uid)) > 0 {
+			Logger().Info("Skipping resource deleted by the resumed run", "resource", gvr.Resource, "name", resourceName)
+			continue
+		}
+		if err := q.nextChange(); err != nil {
+			return err
+		}
+		q.observeAPICall("delete", gvr)
+		err = q.DynamicClient.Resource(gvr).Namespace(resourceNamespace).Delete(q.context(), resourceName, metav1.DeleteOptions{})
 		if err != nil {
-			return fmt.Errorf("error deleting resource >> %v", err)
+			if err := q.changeFailed(apiError("delete", gvr, err)); err != nil {
+				return fmt.Errorf("error deleting resource >> %w", err)
+			}
+			continue
+		}
+		Logger().Info("Deleted resource", "resource", gvr.Resource, "name", resourceName)
+		entry := newLedgerEntry("deleted", gvr, resourceNamespace, resourceName)
+		entry.UID = uid
+		if err := q.recordChange(entry, func() (*undoStep, error) { return deleteUndo(resources[i]) }); err != nil {
+			return err
 		}
-		fmt.Printf("Deleted %s/%s\n", gvr.Resource, resourceName)
 	}
 
 	// remove the resource from the result map
-	delete(resultMap, nodeId)
+	delete(q.resultMap, nodeId)
 	return nil
 }
 
 func getNodeResources(n *NodePattern, q *QueryExecutor, extraFilters []*KeyValuePair) (err error) {
-	if n.ResourceProperties.Properties != nil && len(n.ResourceProperties.Properties.PropertyList) > 0 {
-		for i, prop := range n.ResourceProperties.Properties.PropertyList {
-			if prop.Key == "namespace" || prop.Key == "metadata.namespace" {
-				Namespace = prop.Value.(string)
-				// Remove the namespace slice from the properties
-				n.ResourceProperties.Properties.PropertyList = append(n.ResourceProperties.Properties.PropertyList[:i], n.ResourceProperties.Properties.PropertyList[i+1:]...)
-			}
+	q.applyNamespaceProperty(n)
+
+	fieldSelector, labelSelector, err := q.nodeSelectors(n)
+	if err != nil {
+		return err
+	}
+
+	// Check if the resource has already been fetched
+	observeCacheLookup(q.resultCache[q.resourcePropertyName(n)] != nil)
+	if q.resultCache[q.resourcePropertyName(n)] == nil {
+		// Get the list of resources of the specified kind, unless it's being listed ahead
+		resources, source, err := q.listNode(q.resourcePropertyName(n), n.ResourceProperties.Kind, fieldSelector, labelSelector)
+		if err != nil {
+			return err
 		}
+		q.resultCache[q.resourcePropertyName(n)] = resources
+		q.resultCacheFetchedAt[q.resourcePropertyName(n)] = source.fetchedAt
+		q.resultSources[n.ResourceProperties.Name] = source
+	} else if _, ok := q.resultSources[n.ResourceProperties.Name]; !ok {
+		q.resultSources[n.ResourceProperties.Name] = resultSource{source: ProvenanceCache, fetchedAt: q.resultCacheFetchedAt[q.resourcePropertyName(n)]}
 	}
 
-	var fieldSelector string
-	var labelSelector string
-	var hasNameSelector bool
-	var hasLabelSelector bool
+	q.resultMap[n.ResourceProperties.Name] = q.resultCache[q.resourcePropertyName(n)]
+	resources, _ := q.resultMap[n.ResourceProperties.Name].([]map[string]interface{})
+	if err := q.addMetrics(n, resources); err != nil {
+		return err
+	}
+
+	return q.applyExtraFilters(n, q.lookupIndexedFilters(n, extraFilters))
+}
 
+// applyNamespaceProperty makes a node's namespace property the namespace it's listed in. The property stays
+// in the pattern, so that a query can run again, but isn't a selector.
+func (q *QueryExecutor) applyNamespaceProperty(n *NodePattern) {
 	if n.ResourceProperties.Properties != nil {
 		for _, prop := range n.ResourceProperties.Properties.PropertyList {
-			if prop.Key == "name" || prop.Key == "metadata.name" || prop.Key == `"name"` || prop.Key == `"metadata.name"` {
-				fieldSelector += fmt.Sprintf("metadata.name=%s,", prop.Value)
-				hasNameSelector = true
-			} else {
-				hasLabelSelector = true
-				labelSelector += fmt.Sprintf("%s=%s,", prop.Key, prop.Value)
+			if isNamespaceProperty(prop) {
+				q.namespace = prop.Value.(string)
 			}
 		}
-		fieldSelector = strings.TrimSuffix(fieldSelector, ",")
-		labelSelector = strings.TrimSuffix(labelSelector, ",")
-	}
-	if hasNameSelector && hasLabelSelector {
-		// both name and label selectors are specified, error out
-		return fmt.Errorf("the 'name' selector can be used by itself or combined with 'namespace', but not with other label selectors")
-	}
-
-	// Check if the resource has already been fetched
-	if resultCache[q.resourcePropertyName(n)] == nil {
-		// Get the list of resources of the specified kind.
-		resultCache[q.resourcePropertyName(n)], err = q.getResources(n.ResourceProperties.Kind, fieldSelector, labelSelector)
-		if err != nil {
-			fmt.Println("Error marshalling results to JSON: ", err)
-			return err
-		}
 	}
+}
 
-	resultMap[n.ResourceProperties.Name] = resultCache[q.resourcePropertyName(n)]
+func isNamespaceProperty(prop *Property) bool {
+	return (prop.Key == "namespace" || prop.Key == "metadata.namespace") && prop.Operator == ""
+}
 
-	// Apply extra filters
+// applyExtraFilters drops the node's resources in resultMap that don't match the WHERE clause
+func (q *QueryExecutor) applyExtraFilters(n *NodePattern, extraFilters []*KeyValuePair) error {
 	for _, filter := range extraFilters {
+		if err := validateFilter(filter); err != nil {
+			return err
+		}
 		// The first part of the key is the node name
 		var resultMapKey string
 		dotIndex := strings.Index(filter.Key, ".")
@@ -1011,8 +1761,8 @@ func getNodeResources(n *NodePattern, q *QueryExecutor, extraFilters []*KeyValue
 			}
 			resultMapKey = filter.Key[:len(resultMapKey)+1+nextDotIndex]
 		}
-		if resultMap[resultMapKey] == nil {
-			logDebug(fmt.Sprintf("node identifier %s not found in where clause", resultMapKey))
+		if q.resultMap[resultMapKey] == nil {
+			logDebug("Node identifier not found in where clause", "node", resultMapKey)
 		} else if resultMapKey == n.ResourceProperties.Name {
 			// // The rest of the key is the JSONPath
 			// path := strings.Join(strings.Split(filter.Key, ".")[1:], ".")
@@ -1026,71 +1776,208 @@ func getNodeResources(n *NodePattern, q *QueryExecutor, extraFilters []*KeyValue
 
 			compiledPath, err := jsonpath.Compile(path)
 			if err != nil {
-				logDebug("Error compiling JSONPath:", path)
+				logDebug("Error compiling JSONPath", "path", path)
 				continue
 			}
 
 			// we'll iterate on each resource in the resultMap[node.ResourceProperties.Name] and if the resource doesn't match the filter, we'll remove it from the slice
-			for j, resource := range resultMap[n.ResourceProperties.Name].([]map[string]interface{}) {
+			// The slice may be the one of the result cache, which other nodes are served from
+			q.resultMap[n.ResourceProperties.Name] = slices.Clone(q.resultMap[n.ResourceProperties.Name].([]map[string]interface{}))
+			for j, resource := range q.resultMap[n.ResourceProperties.Name].([]map[string]interface{}) {
+				// A function is computed from the value at the key, which may be missing, e.g. coalesce()
+				if filter.Function != "" {
+					result, err := evaluateValueFunction(filter.Function, filter.Key, filter.Args, resource, false)
+					if err != nil {
+						return err
+					}
+					if !matchesFilter(result, filter) {
+						q.resultMap[n.ResourceProperties.Name].([]map[string]interface{})[j] = nil
+					}
+					continue
+				}
 				// Fix compiledPath to handle escaped dots
 				compiledPath = fixCompiledPath(compiledPath)
 				// Drill down to create nested map structure
-				result, err := compiledPath.Lookup(resource)
+				result, err := lookupPath(compiledPath, resource)
 				if err != nil {
-					logDebug("Path not found:", filter.Key)
+					logDebug("Path not found", "path", filter.Key)
 					// remove the resource from the slice
-					resultMap[n.ResourceProperties.Name].([]map[string]interface{})[j] = nil
-					continue
-				}
-
-				// Convert result and filter.Value to comparable types
-				resultValue, filterValue, err := convertToComparableTypes(result, filter.Value)
-				if err != nil {
-					logDebug(fmt.Sprintf("Error converting types: %v", err))
+					q.resultMap[n.ResourceProperties.Name].([]map[string]interface{})[j] = nil
 					continue
 				}
 
-				keep := false
-				switch filter.Operator {
-				case "EQUALS":
-					keep = reflect.DeepEqual(resultValue, filterValue)
-				case "NOT_EQUALS":
-					keep = !reflect.DeepEqual(resultValue, filterValue)
-				case "GREATER_THAN", "LESS_THAN", "GREATER_THAN_EQUALS", "LESS_THAN_EQUALS":
-					if resultNum, ok := resultValue.(float64); ok {
-						if filterNum, ok := filterValue.(float64); ok {
-							keep = compareNumbers(resultNum, filterNum, filter.Operator)
-						} else {
-							logDebug(fmt.Sprintf("Invalid comparison: %v is not a number", filterValue))
-						}
-					} else {
-						logDebug(fmt.Sprintf("Invalid comparison: %v is not a number", resultValue))
-					}
-				default:
-					logDebug(fmt.Sprintf("Unknown operator: %s", filter.Operator))
-				}
-
-				if !keep {
+				if !matchesFilter(result, filter) {
 					// remove the resource from the slice
-					resultMap[n.ResourceProperties.Name].([]map[string]interface{})[j] = nil
+					q.resultMap[n.ResourceProperties.Name].([]map[string]interface{})[j] = nil
 				}
 			}
 
 			// remove nil values from the slice
 			var filtered []map[string]interface{}
-			for _, resource := range resultMap[n.ResourceProperties.Name].([]map[string]interface{}) {
+			for _, resource := range q.resultMap[n.ResourceProperties.Name].([]map[string]interface{}) {
 				if resource != nil {
 					filtered = append(filtered, resource)
 				}
 			}
 
-			resultMap[n.ResourceProperties.Name] = filtered
+			q.resultMap[n.ResourceProperties.Name] = filtered
+		}
+	}
+	return nil
+}
+
+// matchesFilter reports whether the value found at the key of a WHERE filter satisfies it. Values that can't
+// be compared to the filter's are kept.
+func matchesFilter(result interface{}, filter *KeyValuePair) bool {
+	if temporal, ok := filter.Value.(*TemporalExpression); ok {
+		return matchesTemporal(result, filter, temporal)
+	}
+	switch filter.Operator {
+	case "REGEX":
+		s, ok := result.(string)
+		if !ok {
+			return false
+		}
+		re, err := filterRegexp(filter.Value)
+		if err != nil {
+			logDebug("Invalid regular expression", "pattern", filter.Value, "error", err)
+			return false
+		}
+		return re.MatchString(s)
+	case "CONTAINS", "STARTS_WITH", "ENDS_WITH":
+		// String operators only apply to strings
+		s, ok := result.(string)
+		if !ok {
+			return false
+		}
+		switch filter.Operator {
+		case "CONTAINS":
+			return strings.Contains(s, toString(filter.Value))
+		case "STARTS_WITH":
+			return strings.HasPrefix(s, toString(filter.Value))
+		default:
+			return strings.HasSuffix(s, toString(filter.Value))
+		}
+	}
+
+	// Convert result and filter.Value to comparable types
+	resultValue, filterValue, err := convertToComparableTypes(result, filter.Value)
+	if err != nil {
+		logDebug("Error converting types", "error", err)
+		return true
+	}
+
+	keep := false
+	switch filter.Operator {
+	case "EQUALS":
+		keep = reflect.DeepEqual(resultValue, filterValue)
+	case "NOT_EQUALS":
+		keep = !reflect.DeepEqual(resultValue, filterValue)
+	case "GREATER_THAN", "LESS_THAN", "GREATER_THAN_EQUALS", "LESS_THAN_EQUALS":
+		if resultNum, ok := resultValue.(float64); ok {
+			if filterNum, ok := filterValue.(float64); ok {
+				keep = compareNumbers(resultNum, filterNum, filter.Operator)
+			} else {
+				logDebug("Invalid comparison, not a number", "value", filterValue)
+			}
+		} else {
+			logDebug("Invalid comparison, not a number", "value", resultValue)
 		}
+	default:
+		logDebug("Unknown operator", "operator", filter.Operator)
+	}
+	return keep
+}
+
+// filterRegexps caches the compiled patterns of =~ filters
+var filterRegexps sync.Map
+
+// filterRegexp compiles the pattern of a =~ filter, which like in Cypher must match the whole value
+func filterRegexp(pattern interface{}) (*regexp.Regexp, error) {
+	p := toString(pattern)
+	if re, ok := filterRegexps.Load(p); ok {
+		return re.(*regexp.Regexp), nil
 	}
+	if _, err := regexp.Compile(p); err != nil {
+		return nil, newDiagnosticError(CodeInvalidRegex, err, "pattern", p, "error", err)
+	}
+	re := regexp.MustCompile("^(?:" + p + ")$")
+	filterRegexps.Store(p, re)
+	return re, nil
+}
 
+// validateFilter reports the errors of a WHERE filter that would otherwise only make it match nothing
+func validateFilter(filter *KeyValuePair) error {
+	if filter.Operator == "REGEX" {
+		_, err := filterRegexp(filter.Value)
+		return err
+	}
+	if temporal, ok := filter.Value.(*TemporalExpression); ok {
+		_, err := temporal.evaluate(time.Now())
+		return err
+	}
 	return nil
 }
 
+// nodeSelectors are the field and label selectors sent to the API server for a node: those of its properties, and
+// those a join narrows it with
+func (q *QueryExecutor) nodeSelectors(n *NodePattern) (string, string, error) {
+	fieldSelector, labelSelector, err := q.patternSelectors(n)
+	if err != nil {
+		return "", "", err
+	}
+	if pushed, ok := q.joinSelectors[n]; ok {
+		fieldSelector = joinSelectorList(fieldSelector, pushed.fieldSelector)
+		labelSelector = joinSelectorList(labelSelector, pushed.labelSelector)
+	}
+	return fieldSelector, labelSelector, nil
+}
+
+// patternSelectors splits a node's properties into field and label selectors
+func (q *QueryExecutor) patternSelectors(n *NodePattern) (string, string, error) {
+	if planned, ok := q.plannedSelectors[n]; ok {
+		return planned.fieldSelector, planned.labelSelector, nil
+	}
+	var fieldSelector string
+	var labelSelector string
+	var hasNameSelector bool
+	var hasLabelSelector bool
+
+	if n.ResourceProperties.Properties != nil {
+		// Field selectors depend on the resource, multi-kind patterns only get metadata.name
+		var resource string
+		if !IsMultiKindPattern(n.ResourceProperties.Kind) {
+			if gvr, err := FindGVR(q.Clientset, n.ResourceProperties.Kind); err == nil {
+				resource = gvr.Resource
+			}
+		}
+		for _, prop := range n.ResourceProperties.Properties.PropertyList {
+			if isNamespaceProperty(prop) {
+				continue
+			}
+			if field, ok := fieldSelectorKey(resource, prop.Key); ok {
+				if prop.Operator != "" {
+					return "", "", newDiagnosticError(CodeSelectorEqualityOnly, nil, "selector", strings.Trim(prop.Key, `"`))
+				}
+				fieldSelector += fmt.Sprintf("%s=%v,", field, prop.Value)
+				if field == "metadata.name" {
+					hasNameSelector = true
+				}
+			} else {
+				hasLabelSelector = true
+				labelSelector += labelSelectorRequirement(prop) + ","
+			}
+		}
+		fieldSelector = strings.TrimSuffix(fieldSelector, ",")
+		labelSelector = strings.TrimSuffix(labelSelector, ",")
+	}
+	if hasNameSelector && hasLabelSelector {
+		// both name and label selectors are specified, error out
+		return "", "", newDiagnosticError(CodeNameSelectorCombination, nil)
+	}
+	return fieldSelector, labelSelector, nil
+}
+
 // This is a lazy fix for the jsonpath library which doesn't handle escaped dots in compiled paths
 // Let's patch the jsonpath library to handle this in the future
 func fixCompiledPath(compiledPath *jsonpath.Compiled) *jsonpath.Compiled {
@@ -1109,10 +1996,38 @@ func fixCompiledPath(compiledPath *jsonpath.Compiled) *jsonpath.Compiled {
 	return compiledPath
 }
 
+// lookupPath looks a compiled path up in an object. The jsonpath library panics when the path goes through a null
+// value, e.g. spec.containers[0] of a resource whose containers are null, which is reported as an error instead.
+func lookupPath(compiledPath *jsonpath.Compiled, obj interface{}) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, fmt.Errorf("error looking up path: %v", r)
+		}
+	}()
+	return compiledPath.Lookup(obj)
+}
+
+// jsonPathLookup is jsonpath.JsonPathLookup, with the panics of lookupPath reported as errors and the escaped dots of
+// keys, e.g. labels.app\.kubernetes\.io/name, kept in them
+func jsonPathLookup(obj interface{}, path string) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, fmt.Errorf("error looking up %s: %v", path, r)
+		}
+	}()
+	if strings.Contains(path, "\\.") {
+		compiledPath, err := jsonpath.Compile(path)
+		if err != nil {
+			return nil, err
+		}
+		return lookupPath(fixCompiledPath(compiledPath), obj)
+	}
+	return jsonpath.JsonPathLookup(obj, path)
+}
+
 func (q *QueryExecutor) getResources(kind, fieldSelector, labelSelector string) (interface{}, error) {
 	list, err := q.getK8sResources(kind, fieldSelector, labelSelector)
 	if err != nil {
-		fmt.Println("Error getting list of resources: ", err)
 		return nil, err
 	}
 	// merge list into resultCache
@@ -1120,20 +2035,31 @@ func (q *QueryExecutor) getResources(kind, fieldSelector, labelSelector string)
 	for _, u := range list.Items {
 		converted = append(converted, u.UnstructuredContent())
 	}
-	return converted, nil
+	// The same object can be listed more than once, e.g. through several GVRs of one kind
+	return dedupeResources(converted), nil
 }
 
 func (q *QueryExecutor) resourcePropertyName(n *NodePattern) string {
 	var ns string
 
-	gvr, err := FindGVR(q.Clientset, n.ResourceProperties.Kind)
-	if err != nil {
-		fmt.Println("Error finding API resource: ", err)
-		return ""
+	resource := strings.ToLower(n.ResourceProperties.Kind)
+	if !IsMultiKindPattern(n.ResourceProperties.Kind) {
+		gvr, err := FindGVR(q.Clientset, n.ResourceProperties.Kind)
+		if err != nil {
+			// The same error is returned when the resources are listed
+			logDebug("Error finding API resource", "kind", n.ResourceProperties.Kind, "error", err)
+			return ""
+		}
+		resource = gvr.Resource
+	}
+
+	if pushed, ok := q.joinSelectors[n]; ok {
+		// The resources of a node narrowed by a join are only those related to the resources of another node
+		resource += "_join_" + pushed.fieldSelector + "_" + pushed.labelSelector
 	}
 
 	if n.ResourceProperties.Properties == nil {
-		return fmt.Sprintf("%s_%s", Namespace, gvr.Resource)
+		return fmt.Sprintf("%s_%s", q.namespace, resource)
 	}
 	for _, prop := range n.ResourceProperties.Properties.PropertyList {
 		if prop.Key == "namespace" || prop.Key == "metadata.namespace" {
@@ -1141,13 +2067,16 @@ func (q *QueryExecutor) resourcePropertyName(n *NodePattern) string {
 		}
 	}
 	if ns == "" {
-		ns = Namespace
+		ns = q.namespace
 	}
 
 	var keyValuePairs []string
 	for _, prop := range n.ResourceProperties.Properties.PropertyList {
 		// Convert the value to a string regardless of its actual type
 		valueStr := fmt.Sprint(prop.Value)
+		if prop.Operator != "" {
+			valueStr = prop.Operator + "_" + valueStr
+		}
 		keyValuePairs = append(keyValuePairs, prop.Key+"_"+valueStr)
 	}
 
@@ -1158,12 +2087,37 @@ func (q *QueryExecutor) resourcePropertyName(n *NodePattern) string {
 	joinedPairs := strings.Join(keyValuePairs, "_")
 
 	// Return the formatted string
-	return fmt.Sprintf("%s_%s_%s", ns, gvr.Resource, joinedPairs)
+	return fmt.Sprintf("%s_%s_%s", ns, resource, joinedPairs)
+}
+
+// labelSelectorRequirement renders a node property as a Kubernetes label selector requirement,
+// e.g. app=web, app in (web,api), tier or !tier
+func labelSelectorRequirement(prop *Property) string {
+	switch prop.Operator {
+	case "IN", "NOT_IN":
+		var values []string
+		if list, ok := prop.Value.([]interface{}); ok {
+			for _, value := range list {
+				values = append(values, fmt.Sprint(value))
+			}
+		}
+		operator := "in"
+		if prop.Operator == "NOT_IN" {
+			operator = "notin"
+		}
+		return fmt.Sprintf("%s %s (%s)", prop.Key, operator, strings.Join(values, ","))
+	case "EXISTS":
+		return prop.Key
+	case "NOT_EXISTS":
+		return "!" + prop.Key
+	default:
+		return fmt.Sprintf("%s=%s", prop.Key, prop.Value)
+	}
 }
 
 func convertToComparableTypes(result, filterValue interface{}) (interface{}, interface{}, error) {
-	// If both are already the same type, return them as is
-	if reflect.TypeOf(result) == reflect.TypeOf(filterValue) {
+	// If both are already the same type, return them as is, except ints such as counts which are compared as numbers
+	if _, isInt := result.(int); !isInt && reflect.TypeOf(result) == reflect.TypeOf(filterValue) {
 		return result, filterValue, nil
 	}
 
@@ -1216,38 +2170,43 @@ func compareNumbers(a, b float64, operator string) bool {
 func createCompatiblePatch(resource map[string]interface{}, path []string, value interface{}) []map[string]interface{} {
 	var patches []map[string]interface{}
 	currentPath := ""
-	current := resource
+	var current interface{} = resource
 
 	for i, segment := range path {
-		if currentPath == "" {
-			currentPath = "/" + segment
-		} else {
-			currentPath = currentPath + "/" + segment
-		}
+		currentPath = currentPath + "/" + segment
+		_, isList := current.([]interface{})
+		next, exists := lookupPathSegment(current, segment)
 
 		if i == len(path)-1 {
-			// This is the final segment, so we set the value
-			patches = append(patches, map[string]interface{}{
-				"op":    "add",
-				"path":  currentPath,
-				"value": value,
-			})
-		} else {
-			// Check if this path exists
-			if _, exists := getNestedValue(current, []string{segment}); !exists {
-				// This is an intermediate segment that doesn't exist, so we ensure it exists
+			// This is the final segment, so we set or remove the value
+			switch {
+			case value == nil && !exists:
+				// There's nothing to remove
+				return nil
+			case value == nil:
+				patches = append(patches, map[string]interface{}{"op": "remove", "path": currentPath})
+			case isList && exists:
+				// Adding at an index of a list would insert the value before the element there
+				patches = append(patches, map[string]interface{}{"op": "replace", "path": currentPath, "value": value})
+			default:
+				patches = append(patches, map[string]interface{}{"op": "add", "path": currentPath, "value": value})
+			}
+		} else if !exists {
+			if value == nil {
+				return nil
+			}
+			// This is an intermediate segment that doesn't exist, so we ensure it exists. Lists aren't
+			// extended, the API server rejects indices past their end.
+			if !isList {
 				patches = append(patches, map[string]interface{}{
 					"op":    "add",
 					"path":  currentPath,
 					"value": map[string]interface{}{},
 				})
 			}
-			if next, ok := current[segment].(map[string]interface{}); ok {
-				current = next
-			} else {
-				current[segment] = make(map[string]interface{})
-				current = current[segment].(map[string]interface{})
-			}
+			current = map[string]interface{}{}
+		} else {
+			current = next
 		}
 	}
 
@@ -1268,40 +2227,67 @@ func getNestedValue(resource map[string]interface{}, path []string) (interface{}
 	return current, true
 }
 
-func updateResultMap(resource map[string]interface{}, path []string, value interface{}) {
-	current := resource
-	for i, key := range path {
-		if i == len(path)-1 {
-			current[key] = value
-			return
-		}
-		if _, ok := current[key]; !ok {
-			current[key] = make(map[string]interface{})
+// setPath is the JSON patch path a SET key sets in its node's resources, e.g. p.metadata.labels.app\.kubernetes\.io/name
+// sets ["metadata", "labels", "app.kubernetes.io~1name"] and p.spec.containers[0].image ["spec", "containers", "0", "image"]
+func setPath(key string) []string {
+	path := []string{}
+	parts := strings.Split(key, ".")
+	for i := 1; i < len(parts); i++ {
+		if i > 1 && strings.HasSuffix(parts[i-1], "\\") {
+			// Combine this part with the previous one, removing the backslash
+			path[len(path)-1] = path[len(path)-1][:len(path[len(path)-1])-1] + "." + strings.ReplaceAll(parts[i], "/", "~1")
+		} else {
+			path = append(path, strings.ReplaceAll(parts[i], "/", "~1"))
 		}
-		current = current[key].(map[string]interface{})
 	}
+	return splitListIndices(path)
+}
+
+// updateResultMap sets the value at a path of a resource, removing it when the value is nil, as a SET did
+func updateResultMap(resource map[string]interface{}, path []string, value interface{}) {
+	keys := make([]string, len(path))
+	for i, segment := range path {
+		keys[i] = unescapePathSegment(segment)
+	}
+	setValue(resource, keys, value)
 }
 
-func (q *QueryExecutor) patchK8sResource(resource map[string]interface{}, patchesJSON []byte) error {
+func (q *QueryExecutor) patchK8sResource(resource map[string]interface{}, patchType types.PatchType, patchesJSON []byte, digest string, subresources ...string) error {
 	gvr, err := FindGVR(q.Clientset, resource["kind"].(string))
 	if err != nil {
-		return fmt.Errorf("error finding API resource: %v", err)
+		return fmt.Errorf("error finding API resource: %w", err)
 	}
 	resourceName := resource["metadata"].(map[string]interface{})["name"].(string)
 	resourceNamespace := resource["metadata"].(map[string]interface{})["namespace"].(string)
 
-	_, err = q.DynamicClient.Resource(gvr).Namespace(resourceNamespace).Patch(
-		context.Background(),
+	if err := q.context().Err(); err != nil {
+		return err
+	}
+	if q.Ledger.patched(gvr, resource["metadata"].(map[string]interface{}), digest) {
+		Logger().Info("Skipping resource patched by the resumed run", "resource", gvr.Resource, "name", resourceName)
+		return nil
+	}
+	if err := q.nextChange(); err != nil {
+		return err
+	}
+	q.observeAPICall("patch", gvr)
+	patched, err := q.DynamicClient.Resource(gvr).Namespace(resourceNamespace).Patch(
+		q.context(),
 		resourceName,
-		types.JSONPatchType,
+		patchType,
 		patchesJSON,
-		metav1.PatchOptions{},
+		metav1.PatchOptions{FieldManager: FieldManager},
+		subresources...,
 	)
 	if err != nil {
-		return fmt.Errorf("error patching resource: %v", err)
+		return fmt.Errorf("error patching resource: %w", apiError("patch", gvr, err))
 	}
+	entry := newLedgerEntry("patched", gvr, resourceNamespace, resourceName)
+	entry.UID, entry.ResourceVersion, entry.Patch = string(patched.GetUID()), patched.GetResourceVersion(), digest
 
-	return nil
+	return q.recordChange(entry, func() (*undoStep, error) {
+		return patchUndo(resource, patched.Object, strings.Join(subresources, "/"))
+	})
 }
 
 // convertToMilliCPU converts a CPU value string to milliCPU (integer format).
@@ -1,12 +1,22 @@
 package parser
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/AvitalTamir/jsonpath"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 func TestJsonPath(t *testing.T) {
@@ -481,3 +491,726 @@ func TestSumMemoryBytes(t *testing.T) {
 		})
 	}
 }
+
+// newTestQueryExecutor returns an executor backed by a fake dynamic client serving the given
+// objects, with discovery primed for pods, deployments and horizontal pod autoscalers.
+func newTestQueryExecutor(t *testing.T, objects ...runtime.Object) *QueryExecutor {
+	t.Helper()
+
+	originalList := apiResourceListCache
+	originalNamespace := Namespace
+	t.Cleanup(func() {
+		apiResourceListCache = originalList
+		Namespace = originalNamespace
+		GvrCacheMutex.Lock()
+		GvrCache = make(map[string]schema.GroupVersionResource)
+		GvrCacheMutex.Unlock()
+		ClearCache()
+	})
+	apiResourceListCache = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "pods", SingularName: "pod", Kind: "Pod", Namespaced: true, ShortNames: []string{"po"}, Verbs: []string{"get", "list"}},
+				{Name: "services", SingularName: "service", Kind: "Service", Namespaced: true, ShortNames: []string{"svc"}, Verbs: []string{"get", "list"}},
+				{Name: "configmaps", SingularName: "configmap", Kind: "ConfigMap", Namespaced: true, ShortNames: []string{"cm"}, Verbs: []string{"get", "list"}},
+				{Name: "secrets", SingularName: "secret", Kind: "Secret", Namespaced: true, Verbs: []string{"get", "list"}},
+				{Name: "persistentvolumeclaims", SingularName: "persistentvolumeclaim", Kind: "PersistentVolumeClaim", Namespaced: true, ShortNames: []string{"pvc"}, Verbs: []string{"get", "list"}},
+				{Name: "persistentvolumes", SingularName: "persistentvolume", Kind: "PersistentVolume", ShortNames: []string{"pv"}, Verbs: []string{"get", "list"}},
+				{Name: "serviceaccounts", SingularName: "serviceaccount", Kind: "ServiceAccount", Namespaced: true, ShortNames: []string{"sa"}, Verbs: []string{"get", "list"}},
+				{Name: "namespaces", SingularName: "namespace", Kind: "Namespace", ShortNames: []string{"ns"}, Verbs: []string{"get", "list"}},
+				{Name: "nodes", SingularName: "node", Kind: "Node", ShortNames: []string{"no"}, Verbs: []string{"get", "list"}},
+				{Name: "events", SingularName: "event", Kind: "Event", Namespaced: true, ShortNames: []string{"ev"}, Verbs: []string{"get", "list"}},
+			},
+		},
+		{
+			GroupVersion: "apps/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "deployments", SingularName: "deployment", Kind: "Deployment", Namespaced: true, ShortNames: []string{"deploy"}, Verbs: []string{"get", "list"}},
+				{Name: "replicasets", SingularName: "replicaset", Kind: "ReplicaSet", Namespaced: true, ShortNames: []string{"rs"}, Verbs: []string{"get", "list"}},
+			},
+		},
+		{
+			GroupVersion: "storage.k8s.io/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "storageclasses", SingularName: "storageclass", Kind: "StorageClass", ShortNames: []string{"sc"}, Verbs: []string{"get", "list"}},
+			},
+		},
+		{
+			GroupVersion: "rbac.authorization.k8s.io/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "roles", SingularName: "role", Kind: "Role", Namespaced: true, Verbs: []string{"get", "list"}},
+				{Name: "rolebindings", SingularName: "rolebinding", Kind: "RoleBinding", Namespaced: true, Verbs: []string{"get", "list"}},
+				{Name: "clusterroles", SingularName: "clusterrole", Kind: "ClusterRole", Verbs: []string{"get", "list"}},
+				{Name: "clusterrolebindings", SingularName: "clusterrolebinding", Kind: "ClusterRoleBinding", Verbs: []string{"get", "list"}},
+			},
+		},
+		{
+			GroupVersion: "networking.k8s.io/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "ingresses", SingularName: "ingress", Kind: "Ingress", Namespaced: true, ShortNames: []string{"ing"}, Verbs: []string{"get", "list"}},
+				{Name: "networkpolicies", SingularName: "networkpolicy", Kind: "NetworkPolicy", Namespaced: true, ShortNames: []string{"netpol"}, Verbs: []string{"get", "list"}},
+			},
+		},
+		{
+			GroupVersion: "gateway.networking.k8s.io/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "httproutes", SingularName: "httproute", Kind: "HTTPRoute", Namespaced: true, Verbs: []string{"get", "list"}},
+				{Name: "gateways", SingularName: "gateway", Kind: "Gateway", Namespaced: true, ShortNames: []string{"gtw"}, Verbs: []string{"get", "list"}},
+			},
+		},
+		{
+			GroupVersion: "autoscaling/v2",
+			APIResources: []metav1.APIResource{
+				{Name: "horizontalpodautoscalers", SingularName: "horizontalpodautoscaler", Kind: "HorizontalPodAutoscaler", Namespaced: true, ShortNames: []string{"hpa"}, Verbs: []string{"get", "list"}},
+			},
+		},
+	}
+
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			{Version: "v1", Resource: "pods"}:                                                    "PodList",
+			{Version: "v1", Resource: "services"}:                                                "ServiceList",
+			{Version: "v1", Resource: "configmaps"}:                                              "ConfigMapList",
+			{Version: "v1", Resource: "secrets"}:                                                 "SecretList",
+			{Version: "v1", Resource: "persistentvolumeclaims"}:                                  "PersistentVolumeClaimList",
+			{Version: "v1", Resource: "persistentvolumes"}:                                       "PersistentVolumeList",
+			{Group: "storage.k8s.io", Version: "v1", Resource: "storageclasses"}:                 "StorageClassList",
+			{Group: "apps", Version: "v1", Resource: "deployments"}:                              "DeploymentList",
+			{Group: "apps", Version: "v1", Resource: "replicasets"}:                              "ReplicaSetList",
+			{Version: "v1", Resource: "serviceaccounts"}:                                         "ServiceAccountList",
+			{Version: "v1", Resource: "namespaces"}:                                              "NamespaceList",
+			{Version: "v1", Resource: "nodes"}:                                                   "NodeList",
+			{Version: "v1", Resource: "events"}:                                                  "EventList",
+			{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "roles"}:               "RoleList",
+			{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "rolebindings"}:        "RoleBindingList",
+			{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterroles"}:        "ClusterRoleList",
+			{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterrolebindings"}: "ClusterRoleBindingList",
+			{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"}:                   "IngressList",
+			{Group: "networking.k8s.io", Version: "v1", Resource: "networkpolicies"}:             "NetworkPolicyList",
+			{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "httproutes"}:          "HTTPRouteList",
+			{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "gateways"}:            "GatewayList",
+			{Group: "autoscaling", Version: "v2", Resource: "horizontalpodautoscalers"}:          "HorizontalPodAutoscalerList",
+			{Group: "metrics.k8s.io", Version: "v1beta1", Resource: "pods"}:                      "PodMetricsList",
+			{Group: "metrics.k8s.io", Version: "v1beta1", Resource: "nodes"}:                     "NodeMetricsList",
+		},
+		objects...,
+	)
+	q := &QueryExecutor{
+		queryState:     newQueryState(),
+		DynamicClient:  dynamicClient,
+		requestChannel: make(chan *apiRequest),
+		semaphore:      make(chan struct{}, 1),
+		workers:        &requestWorkers{},
+	}
+	go q.processRequests()
+	t.Cleanup(q.Close)
+	return q
+}
+
+func newTestObject(apiVersion, kind, namespace, name string, fields map[string]interface{}) *unstructured.Unstructured {
+	object := map[string]interface{}{
+		"apiVersion": apiVersion,
+		"kind":       kind,
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": namespace,
+		},
+	}
+	for k, v := range fields {
+		object[k] = v
+	}
+	return &unstructured.Unstructured{Object: object}
+}
+
+func executeTestQuery(t *testing.T, q *QueryExecutor, query string) QueryResult {
+	t.Helper()
+	ast, err := ParseQuery(query)
+	if err != nil {
+		t.Fatalf("ParseQuery(%q) error = %v", query, err)
+	}
+	result, err := q.Execute(ast, "default")
+	if err != nil {
+		t.Fatalf("Execute(%q) error = %v", query, err)
+	}
+	return result
+}
+
+func TestReturnWholeNode(t *testing.T) {
+	q := newTestQueryExecutor(t,
+		newTestObject("v1", "Pod", "default", "web-1", map[string]interface{}{
+			"spec": map[string]interface{}{"nodeName": "node-a"},
+		}),
+		newTestObject("apps/v1", "Deployment", "default", "web", map[string]interface{}{
+			"spec": map[string]interface{}{"replicas": int64(2)},
+		}),
+	)
+
+	result := executeTestQuery(t, q, "MATCH (p:Pod), (d:Deployment) RETURN p, d.spec.replicas")
+
+	expectedPods := []interface{}{
+		map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Pod",
+			"metadata":   map[string]interface{}{"name": "web-1", "namespace": "default"},
+			"spec":       map[string]interface{}{"nodeName": "node-a"},
+		},
+	}
+	if !reflect.DeepEqual(result.Data["p"], expectedPods) {
+		t.Errorf("RETURN p = %v, want %v", result.Data["p"], expectedPods)
+	}
+
+	expectedDeployments := []interface{}{
+		map[string]interface{}{
+			"name": "web",
+			"spec": map[string]interface{}{"replicas": int64(2)},
+		},
+	}
+	if !reflect.DeepEqual(result.Data["d"], expectedDeployments) {
+		t.Errorf("RETURN d.spec.replicas = %v, want %v", result.Data["d"], expectedDeployments)
+	}
+}
+
+func TestReturnQuotedKeys(t *testing.T) {
+	labeled := func(name, app string) *unstructured.Unstructured {
+		pod := newTestObject("v1", "Pod", "default", name, nil)
+		pod.SetLabels(map[string]string{"app.kubernetes.io/name": app})
+		return pod
+	}
+	q := newTestQueryExecutor(t, labeled("web-1", "web"), labeled("api-1", "api"))
+
+	result := executeTestQuery(t, q, "MATCH (p:Pod {`app.kubernetes.io/name`: \"web\"}) RETURN p.metadata.labels.`app.kubernetes.io/name`")
+
+	expected := []interface{}{
+		map[string]interface{}{
+			"name":     "web-1",
+			"metadata": map[string]interface{}{"labels": map[string]interface{}{"app.kubernetes.io/name": "web"}},
+		},
+	}
+	if !reflect.DeepEqual(result.Data["p"], expected) {
+		t.Errorf("RETURN of a quoted key = %v, want %v", result.Data["p"], expected)
+	}
+}
+
+func TestReturnListSelectors(t *testing.T) {
+	q := newTestQueryExecutor(t,
+		newTestObject("v1", "Pod", "default", "web-1", map[string]interface{}{
+			"spec": map[string]interface{}{"containers": []interface{}{
+				map[string]interface{}{"image": "nginx", "ports": []interface{}{map[string]interface{}{"containerPort": int64(80)}}},
+				map[string]interface{}{"image": "envoy", "ports": []interface{}{map[string]interface{}{"containerPort": int64(9090)}}},
+			}},
+		}),
+	)
+
+	result := executeTestQuery(t, q, "MATCH (p:Pod) RETURN p.spec.containers[0].image, p.spec.containers[*].image, p.spec.containers[*].ports[*].containerPort AS ports")
+
+	expected := []interface{}{
+		map[string]interface{}{
+			"name":                     "web-1",
+			"spec.containers[0].image": "nginx",
+			"spec.containers[*].image": []interface{}{"nginx", "envoy"},
+			"ports":                    []interface{}{int64(80), int64(9090)},
+		},
+	}
+	if !reflect.DeepEqual(result.Data["p"], expected) {
+		t.Errorf("RETURN of list selectors = %v, want %v", result.Data["p"], expected)
+	}
+}
+
+func TestReturnIdFunction(t *testing.T) {
+	pod := newTestObject("v1", "Pod", "default", "web-1", nil)
+	pod.SetUID("1234")
+	q := newTestQueryExecutor(t, pod)
+
+	result := executeTestQuery(t, q, "MATCH (p:Pod) RETURN id(p) AS podId")
+
+	expected := []interface{}{
+		map[string]interface{}{
+			"name":  "web-1",
+			"podId": map[string]interface{}{"namespace": "default", "name": "web-1", "uid": "1234"},
+		},
+	}
+	if !reflect.DeepEqual(result.Data["p"], expected) {
+		t.Errorf("RETURN id(p) = %v, want %v", result.Data["p"], expected)
+	}
+}
+
+func TestDedupeResources(t *testing.T) {
+	resource := func(namespace, name, uid string) map[string]interface{} {
+		metadata := map[string]interface{}{"name": name, "namespace": namespace}
+		if uid != "" {
+			metadata["uid"] = uid
+		}
+		return map[string]interface{}{"kind": "Pod", "metadata": metadata}
+	}
+
+	resources := []map[string]interface{}{
+		resource("default", "web", "a"),
+		resource("other", "web", "b"),
+		resource("default", "web", "a"),
+		resource("default", "db", ""),
+		resource("default", "db", ""),
+	}
+
+	deduped := dedupeResources(resources)
+	expected := []map[string]interface{}{
+		resource("default", "web", "a"),
+		resource("other", "web", "b"),
+		resource("default", "db", ""),
+	}
+	if !reflect.DeepEqual(deduped, expected) {
+		t.Errorf("dedupeResources() = %v, want %v", deduped, expected)
+	}
+}
+
+func TestMultiKindNodePatterns(t *testing.T) {
+	q := newTestQueryExecutor(t,
+		newTestObject("v1", "Pod", "default", "web-1", nil),
+		newTestObject("apps/v1", "Deployment", "default", "web", nil),
+	)
+
+	tests := []struct {
+		name     string
+		query    string
+		expected []interface{}
+	}{
+		{
+			name:  "Kind alternatives",
+			query: "MATCH (x:Deployment|pods) RETURN x.kind",
+			expected: []interface{}{
+				map[string]interface{}{"name": "web", "kind": "Deployment"},
+				map[string]interface{}{"name": "web-1", "kind": "Pod"},
+			},
+		},
+		{
+			name:  "Wildcard",
+			query: "MATCH (x:*) RETURN x.kind",
+			expected: []interface{}{
+				map[string]interface{}{"name": "web-1", "kind": "Pod"},
+				map[string]interface{}{"name": "web", "kind": "Deployment"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := executeTestQuery(t, q, tt.query)
+			if !reflect.DeepEqual(result.Data["x"], tt.expected) {
+				t.Errorf("%s = %v, want %v", tt.query, result.Data["x"], tt.expected)
+			}
+		})
+	}
+
+	ast, err := ParseQuery("MATCH (x:Deployment|StatefulSet)->(p:Pod) RETURN p")
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	if _, err := q.Execute(ast, "default"); err == nil {
+		t.Errorf("expected an error for a multi-kind node in a relationship")
+	}
+}
+
+func TestLabelSelectorRequirement(t *testing.T) {
+	tests := []struct {
+		prop     *Property
+		expected string
+	}{
+		{&Property{Key: "app", Value: "web"}, "app=web"},
+		{&Property{Key: "app", Value: []interface{}{"web", "api"}, Operator: "IN"}, "app in (web,api)"},
+		{&Property{Key: "app", Value: []interface{}{"web"}, Operator: "NOT_IN"}, "app notin (web)"},
+		{&Property{Key: "tier", Operator: "EXISTS"}, "tier"},
+		{&Property{Key: "tier", Operator: "NOT_EXISTS"}, "!tier"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			if got := labelSelectorRequirement(tt.prop); got != tt.expected {
+				t.Errorf("labelSelectorRequirement() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSetBasedLabelSelectors(t *testing.T) {
+	labeled := func(name string, labels map[string]string) *unstructured.Unstructured {
+		pod := newTestObject("v1", "Pod", "default", name, nil)
+		pod.SetLabels(labels)
+		return pod
+	}
+	q := newTestQueryExecutor(t,
+		labeled("web-1", map[string]string{"app": "web", "tier": "frontend"}),
+		labeled("api-1", map[string]string{"app": "api"}),
+		labeled("db-1", map[string]string{"app": "db", "tier": "backend"}),
+	)
+
+	result := executeTestQuery(t, q, `MATCH (p:Pod {app IN ["web", "db"], tier EXISTS, app NOT IN ["db"]}) RETURN p.metadata.name`)
+
+	expected := []interface{}{
+		map[string]interface{}{"name": "web-1", "metadata": map[string]interface{}{"name": "web-1"}},
+	}
+	if !reflect.DeepEqual(result.Data["p"], expected) {
+		t.Errorf("set-based selector result = %v, want %v", result.Data["p"], expected)
+	}
+}
+
+func TestEvaluateReturnFunction(t *testing.T) {
+	resource := map[string]interface{}{
+		"kind": "Pod",
+		"metadata": map[string]interface{}{
+			"name":      "web-1",
+			"namespace": "default",
+			"uid":       "1234",
+		},
+	}
+
+	tests := []struct {
+		function string
+		expected interface{}
+		wantErr  bool
+	}{
+		{function: "NAME", expected: "web-1"},
+		{function: "NAMESPACE", expected: "default"},
+		{function: "KIND", expected: "Pod"},
+		{function: "UID", expected: "1234"},
+		{function: "ID", expected: map[string]interface{}{"namespace": "default", "name": "web-1", "uid": "1234"}},
+		{function: "FOO", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.function, func(t *testing.T) {
+			got, err := evaluateReturnFunction(tt.function, resource)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("evaluateReturnFunction(%s) expected error", tt.function)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("evaluateReturnFunction(%s) error = %v", tt.function, err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("evaluateReturnFunction(%s) = %v, want %v", tt.function, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestReturnAccessorFunctions(t *testing.T) {
+	q := newTestQueryExecutor(t, newTestObject("v1", "Pod", "default", "web-1", nil))
+
+	result := executeTestQuery(t, q, "MATCH (p:Pod) RETURN kind(p), namespace(p) AS ns")
+
+	expected := []interface{}{
+		map[string]interface{}{"name": "web-1", "kind": "Pod", "ns": "default"},
+	}
+	if !reflect.DeepEqual(result.Data["p"], expected) {
+		t.Errorf("RETURN kind(p), namespace(p) = %v, want %v", result.Data["p"], expected)
+	}
+}
+
+func TestFieldSelectorsFromNodeProperties(t *testing.T) {
+	q := newTestQueryExecutor(t)
+	var listRestrictions []k8stesting.ListRestrictions
+	q.DynamicClient.(*dynamicfake.FakeDynamicClient).PrependReactor("list", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		listRestrictions = append(listRestrictions, action.(k8stesting.ListAction).GetListRestrictions())
+		return false, nil, nil
+	})
+
+	executeTestQuery(t, q, `MATCH (p:Pod {status.phase: "Running", spec.nodeName: "node-a", app: "web"}) RETURN p`)
+
+	if len(listRestrictions) != 1 {
+		t.Fatalf("expected 1 list call, got %d", len(listRestrictions))
+	}
+	if got := listRestrictions[0].Fields.String(); got != "spec.nodeName=node-a,status.phase=Running" {
+		t.Errorf("field selector = %q, want %q", got, "spec.nodeName=node-a,status.phase=Running")
+	}
+	if got := listRestrictions[0].Labels.String(); got != "app=web" {
+		t.Errorf("label selector = %q, want %q", got, "app=web")
+	}
+}
+
+func TestFieldSelectorKey(t *testing.T) {
+	tests := []struct {
+		resource string
+		key      string
+		expected string
+		ok       bool
+	}{
+		{"pods", "name", "metadata.name", true},
+		{"deployments", `"metadata.name"`, "metadata.name", true},
+		{"pods", "status.phase", "status.phase", true},
+		{"events", "involvedObject.kind", "involvedObject.kind", true},
+		{"deployments", "status.phase", "", false},
+		{"pods", "app", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.resource+"/"+tt.key, func(t *testing.T) {
+			got, ok := fieldSelectorKey(tt.resource, tt.key)
+			if got != tt.expected || ok != tt.ok {
+				t.Errorf("fieldSelectorKey(%q, %q) = %q, %v, want %q, %v", tt.resource, tt.key, got, ok, tt.expected, tt.ok)
+			}
+		})
+	}
+}
+
+func TestExplainFields(t *testing.T) {
+	originalExplainFields := ExplainFields
+	defer func() { ExplainFields = originalExplainFields }()
+	ExplainFields = true
+
+	q := newTestQueryExecutor(t, newTestObject("v1", "Pod", "default", "web-1", nil))
+
+	result := executeTestQuery(t, q, "MATCH (p:Pod) RETURN p.metadata.namespace, kind(p), COUNT{p} AS pods")
+
+	row := result.Data["p"].([]interface{})[0].(map[string]interface{})
+	provenance, ok := row["_provenance"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expected a _provenance entry, got %v", row)
+	}
+
+	namespaceSource := provenance["p.metadata.namespace"].(map[string]interface{})
+	if namespaceSource["source"] != ProvenanceLive || namespaceSource["fetchedAt"] == nil || namespaceSource["age"] == nil {
+		t.Errorf("p.metadata.namespace provenance = %v, want a live source with fetch time and age", namespaceSource)
+	}
+
+	kindSource := provenance["kind(p)"].(map[string]interface{})
+	if kindSource["source"] != ProvenanceComputed || kindSource["function"] != "kind" {
+		t.Errorf("kind(p) provenance = %v, want computed by kind", kindSource)
+	}
+
+	aggregate := result.Data["aggregate"].(map[string]interface{})
+	countSource := aggregate["_provenance"].(map[string]interface{})["pods"].(map[string]interface{})
+	if countSource["source"] != ProvenanceComputed || countSource["aggregate"] != "count" {
+		t.Errorf("COUNT{p} provenance = %v, want computed by count", countSource)
+	}
+}
+
+func TestExplainQuery(t *testing.T) {
+	q := newTestQueryExecutor(t, newTestObject("v1", "Pod", "default", "web-1", nil))
+	listCalls := 0
+	q.DynamicClient.(*dynamicfake.FakeDynamicClient).PrependReactor("list", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		listCalls++
+		return false, nil, nil
+	})
+
+	result := executeTestQuery(t, q, `EXPLAIN MATCH (p:Pod {app: "web", status.phase: "Running"}) WHERE p.spec.priority > 10 DELETE p`)
+
+	if listCalls != 0 {
+		t.Errorf("expected EXPLAIN not to list anything, got %d list calls", listCalls)
+	}
+	plan, ok := result.Data["plan"].(*QueryPlan)
+	if !ok {
+		t.Fatalf("expected a plan, got %v", result.Data)
+	}
+	expected := &QueryPlan{
+		Nodes: []NodePlan{{
+			Node:              "p",
+			Kind:              "Pod",
+			APICalls:          []string{"LIST v1/pods in namespace default"},
+			ServerSideFilters: []string{"fieldSelector: status.phase=Running", "labelSelector: app=web"},
+			ClientSideFilters: []string{"p.spec.priority > 10"},
+		}},
+		Mutations: []string{"DELETE each p (Pod)"},
+		Cost:      PlanCost{APICalls: 1, Comparisons: new(int)},
+	}
+	if !reflect.DeepEqual(plan, expected) {
+		t.Errorf("plan = %+v, want %+v", plan, expected)
+	}
+
+	// When the node's results are cached the plan reuses them and knows their size
+	cachedNode := &NodePattern{ResourceProperties: &ResourceProperties{Name: "p", Kind: "Pod"}}
+	q.prepareQuery("default")
+	q.resultCache[q.resourcePropertyName(cachedNode)] = []map[string]interface{}{{"kind": "Pod"}}
+	result = executeTestQuery(t, q, `EXPLAIN MATCH (p:Pod) RETURN p`)
+	nodePlan := result.Data["plan"].(*QueryPlan).Nodes[0]
+	if !nodePlan.Cached || len(nodePlan.APICalls) != 0 || nodePlan.EstimatedCardinality == nil || *nodePlan.EstimatedCardinality != 1 {
+		t.Errorf("expected a cached node with 1 resource, got %+v", nodePlan)
+	}
+}
+
+func TestExplainPlanRendering(t *testing.T) {
+	q := newTestQueryExecutor(t)
+	result := executeTestQuery(t, q, `EXPLAIN MATCH (d:Deployment {app: "web"})->(rs:ReplicaSet) WHERE d.spec.replicas > 1 RETURN d.metadata.name AS name, COUNT{rs}`)
+	plan := result.Data["plan"].(*QueryPlan)
+	if !reflect.DeepEqual(plan.Projections, []string{"d.metadata.name AS name", "count{rs}"}) {
+		t.Errorf("projections = %v", plan.Projections)
+	}
+	if plan.Cost.APICalls != 2 || plan.Cost.Comparisons != nil {
+		t.Errorf("expected 2 API calls and unknown comparisons, got %+v", plan.Cost)
+	}
+
+	expectedTree := `Query (2 API calls, comparisons unknown)
+├── Scan d (Deployment)
+│   ├── LIST apps/v1/deployments in namespace default
+│   ├── push down labelSelector: app=web
+│   └── filter d.spec.replicas > 1
+├── Scan rs (ReplicaSet), narrowed by d
+│   ├── LIST apps/v1/replicasets in namespace default
+│   └── push down labelSelector: the labels of d.spec.selector.matchLabels
+├── Join d -> rs (DEPLOYMENT_OWN_REPLICASET), nested loop
+│   └── replicasets.metadata.ownerReferences[].name = deployments.metadata.name
+└── Project
+    ├── d.metadata.name AS name
+    └── count{rs}
+`
+	if tree := plan.Tree(); tree != expectedTree {
+		t.Errorf("tree =\n%s\nwant\n%s", tree, expectedTree)
+	}
+
+	dot := plan.DOT()
+	for _, expected := range []string{
+		"digraph plan {",
+		`q_d [label="Scan d (Deployment)\lLIST apps/v1/deployments in namespace default\lpush down labelSelector: app=web\lfilter d.spec.replicas > 1\l"];`,
+		"q_d -> q_join0;",
+		"q_rs -> q_join0;",
+		"q_join0 -> q_output;",
+		`RETURN d.metadata.name AS name, count{rs}\l`,
+	} {
+		if !strings.Contains(dot, expected) {
+			t.Errorf("expected the DOT graph to contain %q, got\n%s", expected, dot)
+		}
+	}
+
+	// The costs of cached nodes are known
+	q.prepareQuery("default")
+	q.resultCache["default_deployments"] = []map[string]interface{}{{}, {}}
+	q.resultCache["default_replicasets"] = []map[string]interface{}{{}, {}, {}}
+	result = executeTestQuery(t, q, `EXPLAIN MATCH (d:Deployment)->(rs:ReplicaSet) RETURN d`)
+	if cost := result.Data["plan"].(*QueryPlan).Cost; cost.APICalls != 0 || cost.Comparisons == nil || *cost.Comparisons != 6 {
+		t.Errorf("expected no API calls and 6 comparisons, got %+v", cost)
+	}
+}
+
+func TestExecuteContextInterruptsMutations(t *testing.T) {
+	q := newTestQueryExecutor(t,
+		newTestObject("v1", "Pod", "default", "web-1", nil),
+		newTestObject("v1", "Pod", "default", "web-2", nil),
+		newTestObject("v1", "Pod", "default", "web-3", nil),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	deleteCalls := 0
+	q.DynamicClient.(*dynamicfake.FakeDynamicClient).PrependReactor("delete", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		// Ctrl-C while the first pod is being deleted
+		deleteCalls++
+		cancel()
+		return false, nil, nil
+	})
+
+	ast, err := ParseQuery(`MATCH (p:Pod) DELETE p`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	result, err := q.ExecuteContext(ctx, ast, "default")
+
+	if deleteCalls != 1 {
+		t.Errorf("expected no deletion after the interruption, got %d delete calls", deleteCalls)
+	}
+	if !errors.Is(err, ErrInterrupted) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected an interrupted error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "1 change was applied: deleted pods default/web-") {
+		t.Errorf("expected the applied deletion to be reported, got %q", err.Error())
+	}
+	if !result.Truncated {
+		t.Errorf("expected the result to be marked as truncated")
+	}
+	if len(q.resultMap) != 0 {
+		t.Errorf("expected the query state to be cleared, got %v", q.resultMap)
+	}
+}
+
+func TestWhereRegex(t *testing.T) {
+	expr, err := ParseQuery(`MATCH (p:Pod) WHERE p.metadata.name =~ "web-.*-canary" RETURN p.metadata.name`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	expected := []*KeyValuePair{{Key: "p.metadata.name", Value: "web-.*-canary", Operator: "REGEX"}}
+	if filters := expr.Clauses[0].(*MatchClause).ExtraFilters; !reflect.DeepEqual(filters, expected) {
+		t.Errorf("unexpected filters %+v", filters)
+	}
+
+	q := newTestQueryExecutor(t,
+		newTestObject("v1", "Pod", "default", "web-1-canary", nil),
+		newTestObject("v1", "Pod", "default", "web-1-canary-old", nil),
+		newTestObject("v1", "Pod", "default", "api-canary", nil),
+	)
+	result := executeTestQuery(t, q, `MATCH (p:Pod) WHERE p.metadata.name =~ "web-.*-canary" RETURN p.metadata.name`)
+	if rows := result.Data["p"].([]interface{}); len(rows) != 1 || rows[0].(map[string]interface{})["name"] != "web-1-canary" {
+		t.Errorf("expected the pattern to match whole names only, got %v", rows)
+	}
+
+	// Patterns are checked even when there's nothing to filter
+	ast, err := ParseQuery(`MATCH (p:Pod) WHERE p.metadata.name =~ "web-(" RETURN p`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	if _, err := q.Execute(ast, "default"); DiagnosticCodeOf(err) != CodeInvalidRegex {
+		t.Errorf("expected %s, got %v", CodeInvalidRegex, err)
+	}
+}
+
+func TestHideResources(t *testing.T) {
+	pod := func(name, uid string) runtime.Object {
+		return newTestObject("v1", "Pod", "default", name, map[string]interface{}{
+			"metadata": map[string]interface{}{"name": name, "namespace": "default", "uid": uid},
+		})
+	}
+	q := newTestQueryExecutor(t, pod("api", "uid-api"), pod("web", "uid-web"), pod("worker", "uid-worker"))
+	q.Hide = func(uid string) bool { return uid == "uid-web" }
+
+	result := executeTestQuery(t, q, `MATCH (p:Pod) RETURN p.metadata.uid AS uid, COUNT{p} AS pods`)
+	expected := []interface{}{
+		map[string]interface{}{"uid": "uid-api", "name": "api", "_uid": "uid-api"},
+		map[string]interface{}{"uid": "uid-worker", "name": "worker", "_uid": "uid-worker"},
+	}
+	if !reflect.DeepEqual(result.Data["p"], expected) {
+		t.Errorf("expected web to be hidden, got %v", result.Data["p"])
+	}
+	if pods := result.Data["aggregate"].(map[string]interface{})["pods"]; pods != 2 || result.Hidden != 1 {
+		t.Errorf("expected 2 pods counted and 1 hidden, got %v and %d", pods, result.Hidden)
+	}
+}
+
+func TestForkedExecutorsRunConcurrently(t *testing.T) {
+	q := newTestQueryExecutor(t,
+		newTestObject("v1", "Pod", "default", "web", nil),
+		newTestObject("v1", "Pod", "staging", "api", nil),
+		newTestObject("v1", "Pod", "staging", "worker", nil),
+	)
+	ast, err := ParseQuery(`MATCH (p:Pod) RETURN p.metadata.name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := range 20 {
+		namespace, expected := "default", 1
+		if i%2 == 1 {
+			namespace, expected = "staging", 2
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fork := q.Fork()
+			result, err := fork.Execute(ast, namespace)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if pods := result.Data["p"].([]interface{}); len(pods) != expected {
+				errs <- fmt.Errorf("expected %d pods in %s, got %v", expected, namespace, pods)
+			}
+			if fork.APICalls() != 1 {
+				errs <- fmt.Errorf("expected the fork to count its own API call, got %d", fork.APICalls())
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,197 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Ways an identifier can match an API resource, in the order they are tried.
+const (
+	MatchedByName      = "plural name"
+	MatchedBySingular  = "singular name"
+	MatchedByKind      = "kind"
+	MatchedByShortName = "short name"
+	MatchedByQualified = "group-qualified name"
+)
+
+// KindResolution describes what a resource identifier resolved to and why.
+type KindResolution struct {
+	Identifier string                      `json:"identifier"`
+	GVR        schema.GroupVersionResource `json:"-"`
+	Group      string                      `json:"group"`
+	Version    string                      `json:"version"`
+	Resource   string                      `json:"resource"`
+	Kind       string                      `json:"kind"`
+	Namespaced bool                        `json:"namespaced"`
+	MatchedBy  string                      `json:"matchedBy"`
+}
+
+// ResolveKind is the single place where a user supplied identifier (e.g. "Pod", "pods",
+// "po" or "deployments.apps") is mapped to API resources. Matching is case-insensitive
+// and tries the plural name, singular name, kind and short names. An identifier of the
+// form <resource>.<group> is matched against that group only.
+// All matches are returned in discovery order.
+func ResolveKind(clientset kubernetes.Interface, identifier string) ([]KindResolution, error) {
+	apiResourceLists, err := loadAPIResourceList(clientset)
+	if err != nil {
+		return nil, err
+	}
+
+	var resolutions []KindResolution
+	for _, apiResourceList := range apiResourceLists {
+		gv, err := schema.ParseGroupVersion(apiResourceList.GroupVersion)
+		if err != nil {
+			return nil, err
+		}
+		for _, resource := range apiResourceList.APIResources {
+			matchedBy, ok := matchResourceIdentifier(identifier, gv.Group, resource)
+			if !ok {
+				continue
+			}
+			gvr := gv.WithResource(resource.Name)
+			if containsResolution(resolutions, gvr) {
+				continue
+			}
+			resolutions = append(resolutions, KindResolution{
+				Identifier: identifier,
+				GVR:        gvr,
+				Group:      gvr.Group,
+				Version:    gvr.Version,
+				Resource:   gvr.Resource,
+				Kind:       resource.Kind,
+				Namespaced: resource.Namespaced,
+				MatchedBy:  matchedBy,
+			})
+		}
+	}
+
+	if len(resolutions) == 0 {
+		return nil, unknownKindError(identifier)
+	}
+	return resolutions, nil
+}
+
+// resolveOne picks the resource an identifier matching several refers to: the one of the core group if there's
+// one, as kubectl does, e.g. the v1 Events rather than those of events.k8s.io. Otherwise the identifier is
+// ambiguous, and must be qualified with the group of the resource meant.
+func resolveOne(identifier string, resolutions []KindResolution) (KindResolution, error) {
+	if len(resolutions) == 1 {
+		return resolutions[0], nil
+	}
+	var core []KindResolution
+	for _, resolution := range resolutions {
+		if resolution.Group == "" {
+			core = append(core, resolution)
+		}
+	}
+	if len(core) == 1 {
+		return core[0], nil
+	}
+	var candidates []string
+	for _, resolution := range resolutions {
+		candidates = append(candidates, fmt.Sprintf("%s (%s)", resolution.qualifiedName(), resolution.Kind))
+	}
+	return KindResolution{}, newDiagnosticError(CodeAmbiguousKind, nil, "identifier", identifier, "candidates", strings.Join(candidates, ", "))
+}
+
+// qualifiedName is the identifier of the resource qualified with its group, e.g. deployments.apps, which only
+// matches it
+func (r KindResolution) qualifiedName() string {
+	if r.Group == "" {
+		return r.Resource
+	}
+	return r.Resource + "." + r.Group
+}
+
+// loadAPIResourceList returns apiResourceListCache, filling it from discovery if it's empty. The list is replaced
+// rather than modified, so callers may iterate over the one returned without holding GvrCacheMutex.
+func loadAPIResourceList(clientset kubernetes.Interface) ([]*metav1.APIResourceList, error) {
+	GvrCacheMutex.RLock()
+	apiResourceLists := apiResourceListCache
+	GvrCacheMutex.RUnlock()
+	if apiResourceLists != nil {
+		return apiResourceLists, nil
+	}
+
+	discoveryClient := getDiscoveryClient(clientset)
+	apiResourceLists, err := preferredResources(discoveryClient)
+	if err != nil {
+		return nil, err
+	}
+	GvrCacheMutex.Lock()
+	apiResourceListCache = apiResourceLists
+	GvrCacheMutex.Unlock()
+	return apiResourceLists, nil
+}
+
+// matchResourceIdentifier reports whether identifier refers to resource, and how.
+func matchResourceIdentifier(identifier string, group string, resource metav1.APIResource) (string, bool) {
+	if matchedBy, ok := matchUnqualifiedIdentifier(identifier, resource); ok {
+		return matchedBy, true
+	}
+
+	// <resource>.<group>, e.g. deployments.apps or certificate.cert-manager.io
+	name, qualifier, found := strings.Cut(identifier, ".")
+	if !found || group == "" || !strings.EqualFold(qualifier, group) {
+		return "", false
+	}
+	if _, ok := matchUnqualifiedIdentifier(name, resource); ok {
+		return MatchedByQualified, true
+	}
+	return "", false
+}
+
+func matchUnqualifiedIdentifier(identifier string, resource metav1.APIResource) (string, bool) {
+	switch {
+	case strings.EqualFold(resource.Name, identifier):
+		return MatchedByName, true
+	case strings.EqualFold(singularName(resource), identifier):
+		return MatchedBySingular, true
+	case strings.EqualFold(resource.Kind, identifier):
+		return MatchedByKind, true
+	case containsIgnoreCase(resource.ShortNames, identifier):
+		return MatchedByShortName, true
+	}
+	return "", false
+}
+
+// singularName falls back to the lowercased kind for servers that don't publish singular names.
+func singularName(resource metav1.APIResource) string {
+	if resource.SingularName != "" {
+		return resource.SingularName
+	}
+	return strings.ToLower(resource.Kind)
+}
+
+func containsResolution(resolutions []KindResolution, gvr schema.GroupVersionResource) bool {
+	for _, resolution := range resolutions {
+		if resolution.GVR == gvr {
+			return true
+		}
+	}
+	return false
+}
+
+// KindForGVR returns the Kind served under the given GVR.
+func KindForGVR(clientset kubernetes.Interface, gvr schema.GroupVersionResource) (string, error) {
+	resolutions, err := ResolveKind(clientset, gvr.Resource)
+	if err != nil {
+		return "", err
+	}
+	for _, resolution := range resolutions {
+		if resolution.GVR == gvr {
+			return resolution.Kind, nil
+		}
+	}
+	// Different version than discovery prefers, the kind is the same
+	for _, resolution := range resolutions {
+		if resolution.GVR.GroupResource() == gvr.GroupResource() {
+			return resolution.Kind, nil
+		}
+	}
+	return "", newDiagnosticError(CodeUnknownGVR, nil, "gvr", gvr)
+}
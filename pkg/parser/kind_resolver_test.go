@@ -0,0 +1,178 @@
+package parser
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestResolveKind(t *testing.T) {
+	originalList := apiResourceListCache
+	defer func() { apiResourceListCache = originalList }()
+	apiResourceListCache = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "pods", SingularName: "pod", Kind: "Pod", Namespaced: true, ShortNames: []string{"po"}},
+				{Name: "endpoints", Kind: "Endpoints", Namespaced: true, ShortNames: []string{"ep"}},
+			},
+		},
+		{
+			GroupVersion: "apps/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "deployments", SingularName: "deployment", Kind: "Deployment", Namespaced: true, ShortNames: []string{"deploy"}},
+			},
+		},
+		{
+			GroupVersion: "metrics.k8s.io/v1beta1",
+			APIResources: []metav1.APIResource{
+				{Name: "pods", SingularName: "", Kind: "PodMetrics", Namespaced: true},
+			},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		identifier string
+		expected   []schema.GroupVersionResource
+		matchedBy  []string
+		wantErr    bool
+	}{
+		{
+			name:       "Plural name",
+			identifier: "deployments",
+			expected:   []schema.GroupVersionResource{{Group: "apps", Version: "v1", Resource: "deployments"}},
+			matchedBy:  []string{MatchedByName},
+		},
+		{
+			name:       "Singular name, any case",
+			identifier: "DePloyment",
+			expected:   []schema.GroupVersionResource{{Group: "apps", Version: "v1", Resource: "deployments"}},
+			matchedBy:  []string{MatchedBySingular},
+		},
+		{
+			name:       "Singular name falls back to the kind",
+			identifier: "podmetrics",
+			expected:   []schema.GroupVersionResource{{Group: "metrics.k8s.io", Version: "v1beta1", Resource: "pods"}},
+			matchedBy:  []string{MatchedBySingular},
+		},
+		{
+			name:       "Kind whose plural is the same word",
+			identifier: "Endpoints",
+			expected:   []schema.GroupVersionResource{{Version: "v1", Resource: "endpoints"}},
+			matchedBy:  []string{MatchedByName},
+		},
+		{
+			name:       "Short name",
+			identifier: "deploy",
+			expected:   []schema.GroupVersionResource{{Group: "apps", Version: "v1", Resource: "deployments"}},
+			matchedBy:  []string{MatchedByShortName},
+		},
+		{
+			name:       "Ambiguous plural name returns every match in discovery order",
+			identifier: "pods",
+			expected: []schema.GroupVersionResource{
+				{Version: "v1", Resource: "pods"},
+				{Group: "metrics.k8s.io", Version: "v1beta1", Resource: "pods"},
+			},
+			matchedBy: []string{MatchedByName, MatchedByName},
+		},
+		{
+			name:       "Group-qualified name",
+			identifier: "pods.metrics.k8s.io",
+			expected:   []schema.GroupVersionResource{{Group: "metrics.k8s.io", Version: "v1beta1", Resource: "pods"}},
+			matchedBy:  []string{MatchedByQualified},
+		},
+		{
+			name:       "Group-qualified singular name",
+			identifier: "Deployment.apps",
+			expected:   []schema.GroupVersionResource{{Group: "apps", Version: "v1", Resource: "deployments"}},
+			matchedBy:  []string{MatchedByQualified},
+		},
+		{
+			name:       "Wrong group",
+			identifier: "deployments.batch",
+			wantErr:    true,
+		},
+		{
+			name:       "Unknown identifier",
+			identifier: "foo",
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolutions, err := ResolveKind(nil, tt.identifier)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ResolveKind(%q) expected error, got %v", tt.identifier, resolutions)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveKind(%q) error = %v", tt.identifier, err)
+			}
+			if len(resolutions) != len(tt.expected) {
+				t.Fatalf("ResolveKind(%q) = %v, want %v", tt.identifier, resolutions, tt.expected)
+			}
+			for i, resolution := range resolutions {
+				if resolution.GVR != tt.expected[i] {
+					t.Errorf("ResolveKind(%q)[%d].GVR = %v, want %v", tt.identifier, i, resolution.GVR, tt.expected[i])
+				}
+				if resolution.MatchedBy != tt.matchedBy[i] {
+					t.Errorf("ResolveKind(%q)[%d].MatchedBy = %q, want %q", tt.identifier, i, resolution.MatchedBy, tt.matchedBy[i])
+				}
+			}
+		})
+	}
+
+	kind, err := KindForGVR(nil, schema.GroupVersionResource{Group: "metrics.k8s.io", Version: "v1beta1", Resource: "pods"})
+	if err != nil || kind != "PodMetrics" {
+		t.Errorf("KindForGVR() = %q, %v, want PodMetrics", kind, err)
+	}
+}
+
+func TestAmbiguousKind(t *testing.T) {
+	originalList := apiResourceListCache
+	originalMatchAll := MatchAllGVRs
+	defer func() {
+		apiResourceListCache = originalList
+		MatchAllGVRs = originalMatchAll
+		GvrCacheMutex.Lock()
+		GvrCache = make(map[string]schema.GroupVersionResource)
+		GvrCacheMutex.Unlock()
+	}()
+	apiResourceListCache = []*metav1.APIResourceList{
+		{
+			GroupVersion: "cert-manager.io/v1",
+			APIResources: []metav1.APIResource{{Name: "certificates", SingularName: "certificate", Kind: "Certificate", Namespaced: true, ShortNames: []string{"cert"}, Verbs: []string{"list"}}},
+		},
+		{
+			GroupVersion: "networking.internal.knative.dev/v1alpha1",
+			APIResources: []metav1.APIResource{{Name: "certificates", SingularName: "certificate", Kind: "Certificate", Namespaced: true, ShortNames: []string{"kcert"}, Verbs: []string{"list"}}},
+		},
+	}
+
+	MatchAllGVRs = false
+	expected := "resource identifier Certificate is ambiguous, it matches certificates.cert-manager.io (Certificate), certificates.networking.internal.knative.dev (Certificate); qualify it with the group of the one you mean"
+	if _, err := FindGVR(nil, "Certificate"); DiagnosticCodeOf(err) != CodeAmbiguousKind || err.Error() != expected {
+		t.Errorf("FindGVR() expected %q, got %v", expected, err)
+	}
+	if _, err := listTargetsForKind(nil, "Certificate", "default"); DiagnosticCodeOf(err) != CodeAmbiguousKind {
+		t.Errorf("listTargetsForKind() expected the kind to be ambiguous, got %v", err)
+	}
+
+	// Qualified names and short names only match one of them
+	for identifier, group := range map[string]string{"certificates.cert-manager.io": "cert-manager.io", "kcert": "networking.internal.knative.dev"} {
+		if gvr, err := FindGVR(nil, identifier); err != nil || gvr.Group != group {
+			t.Errorf("FindGVR(%q) = %v, %v, want group %s", identifier, gvr, err, group)
+		}
+	}
+
+	MatchAllGVRs = true
+	if targets, err := listTargetsForKind(nil, "Certificate", "default"); err != nil || len(targets) != 2 {
+		t.Errorf("listTargetsForKind() expected both certificates with --match-all-gvrs, got %v, %v", targets, err)
+	}
+}
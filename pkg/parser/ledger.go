@@ -0,0 +1,146 @@
+package parser
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Ledger records the changes a query makes as they are applied, in a file, so that an interrupted run of
+// the query can be resumed: changes found in the ledger are skipped instead of being applied again.
+type Ledger struct {
+	// Key identifies the query and namespace the ledger belongs to, a ledger can only resume the same query
+	Key     string        `json:"key"`
+	Query   string        `json:"query"`
+	Changes []LedgerEntry `json:"changes"`
+
+	path  string
+	mutex sync.Mutex
+}
+
+// LedgerEntry is a change applied to an object. ResourceVersion is the version of the object once changed.
+type LedgerEntry struct {
+	Verb            string `json:"verb"`
+	Group           string `json:"group,omitempty"`
+	Version         string `json:"version"`
+	Resource        string `json:"resource"`
+	Namespace       string `json:"namespace,omitempty"`
+	Name            string `json:"name"`
+	UID             string `json:"uid,omitempty"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+	// Patch is a digest of the patch applied by a SET, as a query can patch an object more than once
+	Patch string `json:"patch,omitempty"`
+}
+
+// LedgerKey is the idempotency key of a query run in a namespace
+func LedgerKey(query, namespace string) string {
+	sum := sha256.Sum256([]byte(strings.Join(strings.Fields(query), " ") + "\x00" + namespace))
+	return hex.EncodeToString(sum[:8])
+}
+
+// NewLedger starts an empty ledger for the query, written to path as changes are recorded
+func NewLedger(path, query, namespace string) (*Ledger, error) {
+	ledger := &Ledger{Key: LedgerKey(query, namespace), Query: query, Changes: []LedgerEntry{}, path: path}
+	return ledger, ledger.write()
+}
+
+// LoadLedger reads the ledger of an interrupted run of the query, to resume it. Further changes are
+// recorded in the same file.
+func LoadLedger(path, query, namespace string) (*Ledger, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ledger := &Ledger{path: path}
+	if err := json.Unmarshal(data, ledger); err != nil {
+		return nil, fmt.Errorf("error reading ledger %s: %w", path, err)
+	}
+	if ledger.Key != LedgerKey(query, namespace) {
+		return nil, fmt.Errorf("ledger %s was written by another query or namespace: %s", path, ledger.Query)
+	}
+	return ledger, nil
+}
+
+// Path is the file the ledger is written to
+func (l *Ledger) Path() string {
+	return l.path
+}
+
+func (l *Ledger) record(entry LedgerEntry) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.Changes = append(l.Changes, entry)
+	return l.write()
+}
+
+// write replaces the ledger file, through a temporary file so an interruption can't leave it half written
+func (l *Ledger) write() error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), filepath.Base(l.path)+".*")
+	if err != nil {
+		return fmt.Errorf("error writing ledger: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing ledger: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing ledger: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), l.path); err != nil {
+		return fmt.Errorf("error writing ledger: %w", err)
+	}
+	return nil
+}
+
+// find returns the recorded changes matching the verb and object, for all objects with the name when uid is empty
+func (l *Ledger) find(verb string, gvr schema.GroupVersionResource, namespace, name, uid string) []LedgerEntry {
+	if l == nil {
+		return nil
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	var entries []LedgerEntry
+	for _, entry := range l.Changes {
+		if entry.Verb == verb && entry.Group == gvr.Group && entry.Resource == gvr.Resource &&
+			entry.Namespace == namespace && entry.Name == name && (uid == "" || entry.UID == uid) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// patched reports whether the patch was applied to the object, which hasn't been changed since by anything
+// but the query: its current resource version is one the query left it in.
+func (l *Ledger) patched(gvr schema.GroupVersionResource, metadata map[string]interface{}, patch string) bool {
+	uid, _ := metadata["uid"].(string)
+	resourceVersion, _ := metadata["resourceVersion"].(string)
+	if uid == "" || resourceVersion == "" {
+		return false
+	}
+	namespace, _ := metadata["namespace"].(string)
+	name, _ := metadata["name"].(string)
+
+	applied, unchanged := false, false
+	for _, entry := range l.find("patched", gvr, namespace, name, uid) {
+		applied = applied || entry.Patch == patch
+		unchanged = unchanged || entry.ResourceVersion == resourceVersion
+	}
+	return applied && unchanged
+}
+
+func patchDigest(patch []byte) string {
+	sum := sha256.Sum256(patch)
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,76 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestLedgerResume(t *testing.T) {
+	var pods []runtime.Object
+	for _, name := range []string{"web-1", "web-2", "web-3"} {
+		pod := newTestObject("v1", "Pod", "default", name, nil)
+		pod.SetUID(types.UID(name + "-uid"))
+		pod.SetResourceVersion("1")
+		pods = append(pods, pod)
+	}
+	q := newTestQueryExecutor(t, pods...)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var patched []string
+	q.DynamicClient.(*dynamicfake.FakeDynamicClient).PrependReactor("patch", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patched = append(patched, action.(k8stesting.PatchAction).GetName())
+		// Interrupt the first run after its first change
+		cancel()
+		return false, nil, nil
+	})
+
+	query := `MATCH (p:Pod) SET p.metadata.labels.tier = "web"`
+	ast, err := ParseQuery(query)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "ledger.json")
+	q.Ledger, err = NewLedger(path, query, "default")
+	if err != nil {
+		t.Fatalf("NewLedger() error = %v", err)
+	}
+	if _, err := q.ExecuteContext(ctx, ast, "default"); !errors.Is(err, ErrInterrupted) {
+		t.Fatalf("expected the first run to be interrupted, got %v", err)
+	}
+	if len(patched) != 1 {
+		t.Fatalf("expected 1 patch before the interruption, got %v", patched)
+	}
+
+	if _, err := LoadLedger(path, `MATCH (p:Pod) DELETE p`, "default"); err == nil {
+		t.Errorf("expected a ledger not to resume another query")
+	}
+	q.Ledger, err = LoadLedger(path, query, "default")
+	if err != nil {
+		t.Fatalf("LoadLedger() error = %v", err)
+	}
+	if len(q.Ledger.Changes) != 1 || q.Ledger.Changes[0].Name != patched[0] || q.Ledger.Changes[0].UID == "" {
+		t.Fatalf("unexpected ledger changes %+v", q.Ledger.Changes)
+	}
+
+	if _, err := q.Execute(ast, "default"); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if len(patched) != 3 {
+		t.Errorf("expected the resumed run to patch the 2 remaining pods, got %v", patched)
+	}
+	for _, name := range patched[1:] {
+		if name == patched[0] {
+			t.Errorf("expected %s not to be patched again", name)
+		}
+	}
+	if len(q.Ledger.Changes) != 3 {
+		t.Errorf("expected 3 changes in the ledger, got %d", len(q.Ledger.Changes))
+	}
+}
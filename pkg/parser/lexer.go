@@ -1,9 +1,10 @@
 package parser
 
 import (
-	"log"
+	"strconv"
 	"strings"
 	"text/scanner"
+	"unicode"
 )
 
 type Token int
@@ -26,15 +27,89 @@ type Lexer struct {
 	definingMatch     bool
 	definingWhere     bool
 	definingAggregate bool
+	definingFunction  bool
+	definingList      bool
+	definingHops      bool
+	definingRelVar    bool
 	insideReturnItem  bool
+	definingOrder     bool
+	definingScale     bool
+	definingStatus    bool
+	input             string
+	// tokenStart is the offset where the token being lexed starts, give or take leading whitespace
+	tokenStart int
+	// err is the first syntax error reported by the parser, errPos where it was found
+	err    string
+	errPos scanner.Position
 }
 
 func NewLexer(input string) *Lexer {
 	var s scanner.Scanner
 	s.Init(strings.NewReader(input))
-	s.Whitespace = 1<<'\t' | 1<<'\r' | 1<<' '
-	return &Lexer{s: s}
+	s.Whitespace = 1<<'\t' | 1<<'\n' | 1<<'\r' | 1<<' '
+	// The parser reports what the scanner fails to read as syntax errors, rather than printing them to stderr
+	s.Error = func(*scanner.Scanner, string) {}
+	return &Lexer{s: s, input: input}
 }
+
+// followedBy reports whether the next word of the input, after whitespace, is the keyword
+func (l *Lexer) followedBy(keyword string) bool {
+	rest := strings.TrimLeft(l.input[l.s.Pos().Offset:], " \t\r")
+	if len(rest) < len(keyword) || !strings.EqualFold(rest[:len(keyword)], keyword) {
+		return false
+	}
+	return len(rest) == len(keyword) || unicode.IsSpace(rune(rest[len(keyword)]))
+}
+
+// stringEscapes are the escape sequences of strings, others are kept as written, e.g. \d in a regular expression
+var stringEscapes = map[byte]string{'"': "\"", '\\': "\\", 'n': "\n", 't': "\t", 'r': "\r"}
+
+// unquote returns the value of a STRING token, the quotes around it removed and its escape sequences replaced, e.g.
+// "{\"app\": \"web\"}" is {"app": "web"}
+func unquote(s string) string {
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "\""), "\"")
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			if escaped, ok := stringEscapes[s[i+1]]; ok {
+				sb.WriteString(escaped)
+				i++
+				continue
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// quote returns a string as a STRING token, the inverse of unquote
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`, "\r", `\r`).Replace(s) + `"`
+}
+
+// lexQuotedKey reads a key quoted with backticks, the opening one being next, and returns it without them. A
+// backtick within the key is escaped by doubling it. It fails if the key isn't closed.
+func (l *Lexer) lexQuotedKey() (string, bool) {
+	l.s.Next() // Consume the opening backtick
+	var key strings.Builder
+	for {
+		switch ch := l.s.Next(); ch {
+		case scanner.EOF, '\n':
+			return "`" + key.String(), false
+		case '`':
+			if l.s.Peek() != '`' {
+				return key.String(), true
+			}
+			key.WriteRune(l.s.Next())
+		default:
+			key.WriteRune(ch)
+		}
+	}
+}
+
 func consumeWhitespace(l *Lexer, ch *rune) {
 	for *ch == ' ' || *ch == '\t' || *ch == '\n' || *ch == '\r' {
 		l.s.Next() // Consume the whitespace
@@ -43,13 +118,16 @@ func consumeWhitespace(l *Lexer, ch *rune) {
 }
 
 func (l *Lexer) Lex(lval *yySymType) int {
-	debugLog("Lexing... ", l.s.Peek(), " (", string(l.s.Peek()), ")")
+	l.tokenStart = l.s.Pos().Offset
+	logDebug("Lexing", "next", string(l.s.Peek()))
 	if l.buf.tok == EOF { // If we have already returned EOF, keep returning EOF
 		logDebug("Zero (buffered EOF)")
 		return 0
 	}
 
-	if (l.definingReturn && !l.insideReturnItem) && !l.definingAggregate {
+	// identScanned is set when the first identifier of a RETURN item was already scanned
+	identScanned := false
+	if (l.definingReturn && !l.insideReturnItem) && !l.definingAggregate && !l.definingFunction {
 		ch := l.s.Peek()
 		consumeWhitespace(l, &ch)
 		tok := l.s.Scan()
@@ -68,23 +146,62 @@ func (l *Lexer) Lex(lval *yySymType) int {
 			} else if strings.ToUpper(lit) == "AS" {
 				logDebug("Returning AS token")
 				return int(AS)
+			} else if strings.ToUpper(lit) == "DISTINCT" && l.buf.tok == RETURN && unicode.IsSpace(l.s.Peek()) {
+				// RETURN DISTINCT, the first item follows
+				logDebug("Returning DISTINCT token")
+				return int(DISTINCT)
+			} else if l.s.Peek() == '(' {
+				// A function call such as id(p)
+				l.definingFunction = true
+				l.buf.tok = FUNCTION
+				lval.strVal = lit
+				logDebug("Returning FUNCTION token", "value", lit)
+				return int(FUNCTION)
 			} else {
 				lval.strVal = lit
+				identScanned = true
 			}
+		} else if tok == scanner.EOF {
+			// The item is missing
+			logDebug("Returning EOF token")
+			l.definingReturn = false
+			l.buf.tok = EOF
+			return int(EOF)
+		} else {
+			// Items start with an identifier, which a stray character isn't
+			logDebug("Returning ILLEGAL token", "value", l.s.TokenText())
+			return int(ILLEGAL)
 		}
 	}
 
+	// A literal argument of a function, e.g. split(p.spec.nodeName, "-"), isn't a JSONPATH
+	literalArg := false
+	if l.definingFunction && l.buf.tok == COMMA {
+		ch := l.s.Peek()
+		consumeWhitespace(l, &ch)
+		literalArg = ch == '"' || (ch >= '0' && ch <= '9')
+	}
+
 	// Check if we are capturing a JSONPATH
-	if l.buf.tok == RETURN || l.buf.tok == SET || l.buf.tok == WHERE || (l.buf.tok == LBRACE && l.definingAggregate) ||
-		(l.buf.tok == LBRACE && l.definingMatch) || (l.buf.tok == COMMA && l.definingProps) ||
+	if literalArg {
+		// Lexed as a normal token below, after which the function's closing parenthesis is expected
+		l.buf.tok = ILLEGAL
+	} else if l.buf.tok == RETURN || l.buf.tok == ORDER_BY || l.buf.tok == WITH || l.buf.tok == UNWIND || l.buf.tok == SET || l.buf.tok == WHERE || (l.buf.tok == LBRACE && l.definingAggregate) ||
+		(l.buf.tok == LPAREN && l.definingAggregate) ||
+		(l.buf.tok == LBRACE && l.definingMatch) || (l.buf.tok == LPAREN && l.definingFunction) || (l.buf.tok == COMMA && l.definingProps && !l.definingList) ||
 		(l.buf.tok == COMMA && l.definingReturn) || (l.buf.tok == COMMA && l.definingSet) || (l.buf.tok == COMMA && l.definingWhere) {
-		if !l.definingReturn || l.insideReturnItem || l.definingAggregate {
+		if !l.definingReturn || l.insideReturnItem || l.definingAggregate || l.definingFunction {
 			lval.strVal = ""
 		}
 
-		// Consume and ignore any whitespace
-		ch := l.s.Peek()
-		consumeWhitespace(l, &ch)
+		// Consume and ignore any whitespace, unless it ends an identifier already scanned, e.g. WITH d WHERE ...
+		if !identScanned {
+			ch := l.s.Peek()
+			consumeWhitespace(l, &ch)
+		}
+
+		// The keys of node properties are label keys or field selectors rather than paths
+		propertyKey := l.definingMatch && l.definingProps
 
 		// Capture the JSONPATH
 		for {
@@ -93,18 +210,50 @@ func (l *Lexer) Lex(lval *yySymType) int {
 				l.s.Next()           // Consume backslash
 				nextCh := l.s.Next() // Consume the escaped character
 				lval.strVal += "\\" + string(nextCh)
-			} else if isValidJsonPathChar(ch) {
+			} else if ch == '`' {
+				// A quoted key, e.g. p.metadata.labels.`app.kubernetes.io/name`, whose dots don't separate fields
+				key, ok := l.lexQuotedKey()
+				if !ok {
+					logDebug("Returning ILLEGAL token", "value", lval.strVal+key)
+					return int(ILLEGAL)
+				}
+				if !propertyKey {
+					key = strings.ReplaceAll(key, ".", "\\.")
+				}
+				lval.strVal += key
+			} else if isValidJsonPathChar(ch) || (ch == ':' && strings.Count(lval.strVal, "[") > strings.Count(lval.strVal, "]")) {
+				// Colons are only part of a path within brackets, e.g. containers[1:3]
 				l.s.Next() // Consume the character
 				lval.strVal += string(ch)
 			} else {
 				break
 			}
 		}
+		// STATUS precedes the patch type and items of a SET clause setting the status subresource, e.g.
+		// SET STATUS d.status.phase = "Ready"
+		if l.buf.tok == SET && !l.definingStatus && strings.EqualFold(lval.strVal, "STATUS") && unicode.IsSpace(l.s.Peek()) {
+			l.definingStatus = true
+			logDebug("Returning STATUS token")
+			return int(STATUS)
+		}
+		l.definingStatus = false
+		// The patch type of a SET clause precedes its items, e.g. SET STRATEGIC d.spec.replicas = 2
+		if l.buf.tok == SET && isPatchType(lval.strVal) && unicode.IsSpace(l.s.Peek()) {
+			logDebug("Returning PATCH_TYPE token", "value", lval.strVal)
+			return int(PATCH_TYPE)
+		}
+		// A function call in a WHERE clause, e.g. WHERE toLower(p.metadata.name) = "web"
+		if l.definingWhere && !l.definingFunction && l.s.Peek() == '(' && !strings.Contains(lval.strVal, ".") {
+			l.definingFunction = true
+			l.buf.tok = FUNCTION
+			logDebug("Returning FUNCTION token", "value", lval.strVal)
+			return int(FUNCTION)
+		}
 		if l.definingReturn {
 			l.insideReturnItem = true
 		}
 		l.buf.tok = ILLEGAL // Indicate that we've read a JSONPATH.
-		logDebug("Returning JSONPATH token with value:", lval.strVal)
+		logDebug("Returning JSONPATH token", "value", lval.strVal)
 		return int(JSONPATH)
 		// Check if we are capturing a JSONDATA
 	} else if l.buf.tok == LBRACE && l.definingCreate {
@@ -112,8 +261,8 @@ func (l *Lexer) Lex(lval *yySymType) int {
 		lval.strVal = "{"
 		// Consume and ignore any whitespace
 		ch := l.s.Peek()
-		// Capture the JSONDATA
-		for ch != ')' {
+		// Capture the JSONDATA, which an unterminated query ends
+		for ch != ')' && ch != scanner.EOF {
 			l.s.Next() // Consume the character
 			// ignore whitespace
 			if ch != ' ' && ch != '\t' && ch != '\n' && ch != '\r' {
@@ -123,19 +272,147 @@ func (l *Lexer) Lex(lval *yySymType) int {
 		}
 
 		l.definingCreate = false
-		logDebug("Returning JSONDATA token with value:", lval.strVal)
+		logDebug("Returning JSONDATA token", "value", lval.strVal)
 		return int(JSONDATA)
 	}
 
 	// Handle normal tokens
+	scanErrors := l.s.ErrorCount
 	tok := l.s.Scan()
-	logDebug("Scanned token:", tok)
-	logDebug("Token text:", string(tok))
+	logDebug("Scanned token", "token", tok, "text", string(tok))
 
 	switch tok {
 	case scanner.Ident:
 		lit := l.s.TokenText()
+		// Set-based selector operators may only follow a property key, e.g. {app IN ["web"], tier EXISTS}
+		if l.definingProps && (l.buf.tok == ILLEGAL || l.buf.tok == NOT) {
+			switch strings.ToUpper(lit) {
+			case "IN":
+				l.buf.tok = IN
+				logDebug("Returning IN token")
+				return int(IN)
+			case "NOT":
+				l.buf.tok = NOT
+				logDebug("Returning NOT token")
+				return int(NOT)
+			case "EXISTS":
+				l.buf.tok = EXISTS
+				logDebug("Returning EXISTS token")
+				return int(EXISTS)
+			}
+		}
+		// EXPLAIN is only a keyword in front of the query
+		if strings.ToUpper(lit) == "EXPLAIN" && l.buf.tok == ILLEGAL && !l.definingProps && !l.definingMatch &&
+			!l.definingCreate && !l.definingSet && !l.definingReturn && !l.definingWhere {
+			l.buf.tok = EXPLAIN
+			logDebug("Returning EXPLAIN token")
+			return int(EXPLAIN)
+		}
+		if strings.ToUpper(lit) == "APPLY" && l.buf.tok == ILLEGAL && !l.definingProps && !l.definingMatch &&
+			!l.definingCreate && !l.definingSet && !l.definingReturn && !l.definingWhere {
+			l.buf.tok = APPLY
+			logDebug("Returning APPLY token")
+			return int(APPLY)
+		}
+		// BATCH is only a keyword right after APPLY
+		if strings.ToUpper(lit) == "BATCH" && l.buf.tok == APPLY {
+			l.buf.tok = BATCH
+			logDebug("Returning BATCH token")
+			return int(BATCH)
+		}
+		// Temporal values compared by WHERE filters, e.g. now() - duration("24h")
+		if l.definingWhere && l.s.Peek() == '(' && isTemporalFunction(lit) {
+			lval.strVal = lit
+			logDebug("Returning FUNCTION token", "value", lit)
+			return int(FUNCTION)
+		}
+		// Operators of WHERE filters, which follow the JSONPATH or function call they compare
+		if l.definingWhere && (l.buf.tok == ILLEGAL || l.buf.tok == RPAREN) {
+			switch strings.ToUpper(lit) {
+			case "CONTAINS":
+				l.buf.tok = CONTAINS
+				logDebug("Returning CONTAINS token")
+				return int(CONTAINS)
+			case "STARTS":
+				l.buf.tok = STARTS
+				logDebug("Returning STARTS token")
+				return int(STARTS)
+			case "ENDS":
+				l.buf.tok = ENDS
+				logDebug("Returning ENDS token")
+				return int(ENDS)
+			}
+		}
+		// ORDER BY follows the items of a RETURN clause, the JSONPATHs it sorts by follow it
+		if strings.ToUpper(lit) == "ORDER" && l.definingReturn && l.insideReturnItem && !l.definingOrder && l.followedBy("BY") {
+			l.s.Scan() // Consume BY
+			l.buf.tok = ORDER_BY
+			l.definingOrder = true
+			l.insideReturnItem = false
+			l.definingAggregate = false
+			logDebug("Returning ORDER_BY token")
+			return int(ORDER_BY)
+		}
+		if l.definingOrder && l.insideReturnItem && (strings.ToUpper(lit) == "ASC" || strings.ToUpper(lit) == "DESC") {
+			if strings.ToUpper(lit) == "ASC" {
+				logDebug("Returning ASC token")
+				return int(ASC)
+			}
+			logDebug("Returning DESC token")
+			return int(DESC)
+		}
+		// UNION ends a RETURN clause, the query it adds follows. ALL is only a keyword right after it.
+		if strings.ToUpper(lit) == "UNION" && l.definingReturn {
+			l.buf.tok = UNION
+			l.definingReturn = false
+			l.definingOrder = false
+			l.insideReturnItem = false
+			l.definingAggregate = false
+			logDebug("Returning UNION token")
+			return int(UNION)
+		}
+		if strings.ToUpper(lit) == "ALL" && l.buf.tok == UNION {
+			l.buf.tok = ALL
+			logDebug("Returning ALL token")
+			return int(ALL)
+		}
+		// The WITH of STARTS WITH and ENDS WITH doesn't start a WITH clause
+		if strings.ToUpper(lit) == "WITH" && (l.buf.tok == STARTS || l.buf.tok == ENDS) {
+			l.buf.tok = ILLEGAL
+			logDebug("Returning WITH token")
+			return int(WITH)
+		}
+		// The rollout operations follow the patterns or filters of the nodes they operate on, e.g.
+		// MATCH (d:Deployment) RESTART d
+		if (l.definingMatch || l.definingWhere) && !l.definingProps && unicode.IsSpace(l.s.Peek()) {
+			if operation, ok := operationTokens[strings.ToUpper(lit)]; ok {
+				l.buf.tok = operation
+				l.definingScale = operation == SCALE
+				l.definingMatch = false
+				l.definingWhere = false
+				logDebug("Returning operation token", "value", lit)
+				return int(operation)
+			}
+		}
+		// TO precedes the replicas SCALE scales to
+		if l.definingScale && strings.ToUpper(lit) == "TO" {
+			l.definingScale = false
+			logDebug("Returning TO token")
+			return int(TO)
+		}
+		// SET removes the fields it sets to null, other clauses have no null value
+		if l.definingSet && strings.ToUpper(lit) == "NULL" {
+			logDebug("Returning NULL token")
+			return int(NULL)
+		}
 		switch strings.ToUpper(lit) {
+		case "WHILE":
+			logDebug("Returning WHILE token")
+			l.buf.tok = WHILE
+			l.definingSet = false
+			l.definingMatch = false
+			l.definingWhere = false
+			return int(WHILE)
 		case "MATCH":
 			logDebug("Returning MATCH token")
 			l.buf.tok = MATCH // Indicate that we've read a MATCH.
@@ -145,6 +422,19 @@ func (l *Lexer) Lex(lval *yySymType) int {
 			l.definingReturn = false
 			l.definingWhere = false
 			return int(MATCH)
+		case "OPTIONAL":
+			logDebug("Returning OPTIONAL token")
+			l.buf.tok = OPTIONAL
+			return int(OPTIONAL)
+		case "MERGE":
+			logDebug("Returning MERGE token")
+			l.buf.tok = MERGE // A MERGE pattern is lexed like a MATCH pattern
+			l.definingMatch = true
+			l.definingSet = false
+			l.definingCreate = false
+			l.definingReturn = false
+			l.definingWhere = false
+			return int(MERGE)
 		case "SET":
 			l.buf.tok = SET // Indicate that we've read a SET.
 			l.definingSet = true
@@ -171,9 +461,33 @@ func (l *Lexer) Lex(lval *yySymType) int {
 			l.definingReturn = false
 			l.definingWhere = false
 			return int(CREATE)
+		case "WITH":
+			// WITH items are lexed like RETURN items
+			l.buf.tok = WITH
+			l.definingReturn = true
+			l.insideReturnItem = false
+			l.definingAggregate = false
+			l.definingSet = false
+			l.definingCreate = false
+			l.definingMatch = false
+			l.definingWhere = false
+			logDebug("Returning WITH token")
+			return int(WITH)
+		case "UNWIND":
+			l.buf.tok = UNWIND // The list to unwind is a JSONPATH
+			l.definingReturn = false
+			l.definingSet = false
+			l.definingCreate = false
+			l.definingMatch = false
+			l.definingWhere = false
+			logDebug("Returning UNWIND token")
+			return int(UNWIND)
 		case "RETURN":
 			l.buf.tok = RETURN // Indicate that we've read a RETURN.
 			l.definingReturn = true
+			l.definingOrder = false
+			l.insideReturnItem = false
+			l.definingAggregate = false
 			l.definingSet = false
 			l.definingCreate = false
 			l.definingMatch = false
@@ -194,11 +508,23 @@ func (l *Lexer) Lex(lval *yySymType) int {
 			return int(WHERE)
 		case "TRUE", "FALSE":
 			lval.strVal = l.s.TokenText()
-			logDebug("Returning BOOLEAN token with value:", lval.strVal)
+			logDebug("Returning BOOLEAN token", "value", lval.strVal)
 			return int(BOOLEAN)
 		default:
 			lval.strVal = lit
-			logDebug("Returning IDENT token with value:", lval.strVal)
+			// Group-qualified kinds and kind alternatives inside a node pattern,
+			// e.g. (d:deployments.apps) or (w:Deployment|StatefulSet)
+			if l.definingProps && (l.s.Peek() == '.' || l.s.Peek() == '|') {
+				for ch := l.s.Peek(); ch == '.' || ch == '-' || ch == '_' || ch == '|' ||
+					(ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9'); ch = l.s.Peek() {
+					l.s.Next()
+					lval.strVal += string(ch)
+				}
+			}
+			// The hops of a relationship variable, e.g. -[r*1..3]->
+			l.definingHops = l.definingRelVar && l.s.Peek() == '*'
+			l.definingRelVar = false
+			logDebug("Returning IDENT token", "value", lval.strVal)
 			return int(IDENT)
 		}
 	case scanner.EOF:
@@ -214,7 +540,31 @@ func (l *Lexer) Lex(lval *yySymType) int {
 	case ':':
 		logDebug("Returning COLON token")
 		return int(COLON)
+	case '*':
+		if l.definingHops {
+			// Hops of a variable-length relationship, e.g. -[*1..3]->
+			l.definingHops = false
+			hops, ok := l.lexHops()
+			if !ok {
+				return int(ILLEGAL)
+			}
+			lval.hops = hops
+			logDebug("Returning HOPS token", "min", hops.Min, "max", hops.Max)
+			return int(HOPS)
+		}
+		if l.definingProps {
+			// Wildcard kind, e.g. (x:*)
+			lval.strVal = "*"
+			logDebug("Returning IDENT token", "value", lval.strVal)
+			return int(IDENT)
+		}
+		return int(ILLEGAL)
 	case '=':
+		if l.definingWhere && l.s.Peek() == '~' {
+			l.s.Next() // Consume '~'
+			logDebug("Returning REGEX_MATCH token")
+			return int(REGEX_MATCH)
+		}
 		logDebug("Returning EQUALS token")
 		return int(EQUALS)
 	case '!':
@@ -227,6 +577,10 @@ func (l *Lexer) Lex(lval *yySymType) int {
 	case ')':
 		logDebug("Returning RPAREN token")
 		l.definingProps = false // Indicate that we've read a RPAREN.
+		if l.definingFunction {
+			l.buf.tok = RPAREN
+		}
+		l.definingFunction = false
 		return int(RPAREN)
 	case ' ', '\t', '\r':
 		logDebug("Ignoring whitespace")
@@ -240,17 +594,35 @@ func (l *Lexer) Lex(lval *yySymType) int {
 		logDebug("Returning RBRACE token")
 		return int(RBRACE)
 	case -6: // QUOTE
+		if l.s.ErrorCount > scanErrors {
+			// The string isn't terminated before the end of the query
+			logDebug("Returning ILLEGAL token", "value", l.s.TokenText())
+			return int(ILLEGAL)
+		}
 		lval.strVal = l.s.TokenText()
-		logDebug("Returning STRING token with value:", lval.strVal)
+		logDebug("Returning STRING token", "value", lval.strVal)
 		return int(STRING)
 	case scanner.Int:
 		lval.strVal = l.s.TokenText()
-		logDebug("Returning INT token with value:", lval.strVal)
+		logDebug("Returning INT token", "value", lval.strVal)
 		return int(INT)
+	case '$':
+		// A parameter, e.g. $name, whose value is given when the query runs
+		name := ""
+		for ch := l.s.Peek(); ch == '_' || unicode.IsLetter(ch) || (name != "" && unicode.IsDigit(ch)); ch = l.s.Peek() {
+			name += string(l.s.Next())
+		}
+		if name == "" {
+			logDebug("Returning ILLEGAL token", "value", "$")
+			return int(ILLEGAL)
+		}
+		lval.strVal = name
+		logDebug("Returning PARAMETER token", "value", name)
+		return int(PARAMETER)
 	case ',':
 		logDebug("Returning COMMA token")
 		l.buf.tok = COMMA // Indicate that we've read a COMMA.
-		if l.definingReturn {
+		if l.definingReturn && !l.definingFunction {
 			l.insideReturnItem = false
 			l.definingAggregate = false
 		}
@@ -262,13 +634,24 @@ func (l *Lexer) Lex(lval *yySymType) int {
 			return int(REL_NOPROPS_RIGHT)
 		} else if ch == '[' {
 			l.s.Next() // Consume '['
+			l.definingHops = l.s.Peek() == '*'
+			l.definingRelVar = !l.definingHops
 			return int(REL_BEGINPROPS_NONE)
 		} else if ch == '-' {
 			l.s.Next() // Consume '-'
 			return int(REL_NOPROPS_NONE)
+		} else if l.definingWhere {
+			logDebug("Returning MINUS token")
+			return int(MINUS)
 		} else {
 			return int(ILLEGAL)
 		}
+	case '+':
+		if l.definingWhere {
+			logDebug("Returning PLUS token")
+			return int(PLUS)
+		}
+		return int(ILLEGAL)
 	case '<':
 		ch := l.s.Peek()
 		if ch == '-' {
@@ -276,6 +659,8 @@ func (l *Lexer) Lex(lval *yySymType) int {
 			ch = l.s.Peek()
 			if ch == '[' {
 				l.s.Next() // Consume '['
+				l.definingHops = l.s.Peek() == '*'
+				l.definingRelVar = !l.definingHops
 				return int(REL_BEGINPROPS_LEFT)
 			} else if ch == '(' {
 				return int(REL_NOPROPS_LEFT)
@@ -288,6 +673,12 @@ func (l *Lexer) Lex(lval *yySymType) int {
 		}
 		return int(LESS_THAN)
 	case ']':
+		if l.definingList {
+			l.definingList = false
+			l.buf.tok = RBRACKET
+			logDebug("Returning RBRACKET token")
+			return int(RBRACKET)
+		}
 		ch := l.s.Peek()
 		if ch == '-' {
 			l.s.Next() // Consume '-'
@@ -303,6 +694,12 @@ func (l *Lexer) Lex(lval *yySymType) int {
 		}
 		return int(ILLEGAL)
 	case '>', '[':
+		if tok == '[' && l.definingProps && l.buf.tok == IN {
+			l.definingList = true
+			l.buf.tok = LBRACKET
+			logDebug("Returning LBRACKET token")
+			return int(LBRACKET)
+		}
 		ch := l.s.Peek()
 		if ch == '=' {
 			l.s.Next() // Consume '='
@@ -310,11 +707,19 @@ func (l *Lexer) Lex(lval *yySymType) int {
 		}
 		return int(GREATER_THAN)
 	default:
-		logDebug("Illegal token:", tok)
+		logDebug("Illegal token", "token", tok)
 		return int(ILLEGAL)
 	}
 }
 
+// operationTokens are the keywords of the rollout operations
+var operationTokens = map[string]Token{
+	"RESTART": RESTART,
+	"SCALE":   SCALE,
+	"PAUSE":   PAUSE,
+	"RESUME":  RESUME,
+}
+
 // Helper function to check if a character is valid in a jsonPath
 func isValidJsonPathChar(tok rune) bool {
 	// Convert to string for easier comparison
@@ -327,8 +732,34 @@ func isValidJsonPathChar(tok rune) bool {
 		char == "/" || char == "-" || char == "\\" // Include backslash
 }
 
+// Error records a syntax error, it is returned by ParseQuery
 func (l *Lexer) Error(e string) {
-	log.Printf("Error: %v\n", e)
+	if l.err == "" {
+		l.err = e
+		l.errPos = l.lastTokenPosition()
+	}
+}
+
+// errorAt records a syntax error found at offset of the input, rather than at the last token
+func (l *Lexer) errorAt(offset int, e string) {
+	l.err = e
+	l.errPos = scanner.Position{Offset: offset}
+	l.errPos.Line, l.errPos.Column = positionAt(l.input, offset)
+}
+
+// lastTokenPosition is where the token last returned to the parser starts. Tokens read with Scan start at
+// Position, those read rune by rune after the spaces following the previous token.
+func (l *Lexer) lastTokenPosition() scanner.Position {
+	offset := l.tokenStart
+	if l.s.Position.IsValid() && l.s.Position.Offset > offset {
+		offset = l.s.Position.Offset
+	}
+	for offset < len(l.input) && strings.ContainsRune(" \t\r", rune(l.input[offset])) {
+		offset++
+	}
+	position := scanner.Position{Offset: offset}
+	position.Line, position.Column = positionAt(l.input, offset)
+	return position
 }
 
 type ASTNode struct {
@@ -339,3 +770,37 @@ type ASTNode struct {
 func NewASTNode(name, kind string) *ASTNode {
 	return &ASTNode{Name: name, Kind: kind}
 }
+
+// lexHops reads the bounds following the '*' of a variable-length relationship: *N for exactly N hops, *N..M,
+// *..M or *N.. for a range, or nothing for 1 up to maxRelationshipHops hops
+func (l *Lexer) lexHops() (*Hops, bool) {
+	hops := &Hops{Min: 1, Max: maxRelationshipHops}
+	min, hasMin := l.lexDigits()
+	if l.s.Peek() != '.' {
+		if hasMin {
+			hops.Min, hops.Max = min, min
+		}
+		return hops, true
+	}
+	l.s.Next() // Consume '.'
+	if l.s.Next() != '.' {
+		return nil, false
+	}
+	max, hasMax := l.lexDigits()
+	if hasMin {
+		hops.Min = min
+	}
+	if hasMax {
+		hops.Max = max
+	}
+	return hops, true
+}
+
+func (l *Lexer) lexDigits() (int, bool) {
+	digits := ""
+	for unicode.IsDigit(l.s.Peek()) {
+		digits += string(l.s.Next())
+	}
+	n, err := strconv.Atoi(digits)
+	return n, err == nil
+}
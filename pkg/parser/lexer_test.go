@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"errors"
 	"reflect"
 	"testing"
 )
@@ -58,6 +59,70 @@ func TestLexer(t *testing.T) {
 				"",       // EOF
 			},
 		},
+		{
+			name:  "MATCH with group-qualified kind",
+			input: "MATCH (c:certificates.cert-manager.io) RETURN c.name",
+			wantTokens: []int{
+				MATCH,
+				LPAREN,
+				IDENT,
+				COLON,
+				IDENT,
+				RPAREN,
+				RETURN,
+				JSONPATH,
+				EOF,
+			},
+			wantLiterals: []string{
+				"",                             // MATCH
+				"",                             // LPAREN
+				"c",                            // IDENT
+				"",                             // COLON
+				"certificates.cert-manager.io", // IDENT
+				"",                             // RPAREN
+				"",                             // RETURN
+				"c.name",                       // JSONPATH
+				"",                             // EOF
+			},
+		},
+		{
+			name:  "MATCH with kind alternatives and wildcard",
+			input: "MATCH (w:Deployment|StatefulSet), (x:*) RETURN w",
+			wantTokens: []int{
+				MATCH,
+				LPAREN,
+				IDENT,
+				COLON,
+				IDENT,
+				RPAREN,
+				COMMA,
+				LPAREN,
+				IDENT,
+				COLON,
+				IDENT,
+				RPAREN,
+				RETURN,
+				JSONPATH,
+				EOF,
+			},
+			wantLiterals: []string{
+				"",                       // MATCH
+				"",                       // LPAREN
+				"w",                      // IDENT
+				"",                       // COLON
+				"Deployment|StatefulSet", // IDENT
+				"",                       // RPAREN
+				"",                       // COMMA
+				"",                       // LPAREN
+				"x",                      // IDENT
+				"",                       // COLON
+				"*",                      // IDENT
+				"",                       // RPAREN
+				"",                       // RETURN
+				"w",                      // JSONPATH
+				"",                       // EOF
+			},
+		},
 		{
 			name:  "MATCH and RETURN with props",
 			input: "MATCH (k:Kind {name: \"test\"}) RETURN k.name, k.age",
@@ -534,3 +599,46 @@ func TestLexer(t *testing.T) {
 		})
 	}
 }
+
+func TestUnquote(t *testing.T) {
+	tests := []struct {
+		token    string
+		expected string
+	}{
+		{`"web"`, "web"},
+		{`"{\"app\": \"web\"}"`, `{"app": "web"}`},
+		{`"C:\\temp\\"`, `C:\temp\`},
+		{`"line\nbreak\ttab"`, "line\nbreak\ttab"},
+		// Other escapes are kept, e.g. those of regular expressions
+		{`"web-\d+"`, `web-\d+`},
+	}
+	for _, tt := range tests {
+		if got := unquote(tt.token); got != tt.expected {
+			t.Errorf("unquote(%s) = %q, want %q", tt.token, got, tt.expected)
+		}
+		if got := unquote(quote(tt.expected)); got != tt.expected {
+			t.Errorf("unquote(quote(%q)) = %q", tt.expected, got)
+		}
+	}
+}
+
+func TestQuotedKeys(t *testing.T) {
+	ast, err := ParseQuery("MATCH (p:Pod {`app.kubernetes.io/name`: \"web\"}) WHERE p.metadata.annotations.`example.com/note` = \"a\" RETURN p.metadata.labels.`app.kubernetes.io/name`")
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	match := ast.Clauses[0].(*MatchClause)
+	if key := match.Nodes[0].ResourceProperties.Properties.PropertyList[0].Key; key != "app.kubernetes.io/name" {
+		t.Errorf("expected the label key app.kubernetes.io/name, got %q", key)
+	}
+	if key := match.ExtraFilters[0].Key; key != `p.metadata.annotations.example\.com/note` {
+		t.Errorf("expected the dots of the quoted key to be escaped, got %q", key)
+	}
+	if path := ast.Clauses[1].(*ReturnClause).Items[0].JsonPath; path != `p.metadata.labels.app\.kubernetes\.io/name` {
+		t.Errorf("expected the dots of the quoted key to be escaped, got %q", path)
+	}
+
+	if _, err := ParseQuery("MATCH (p:Pod) RETURN p.metadata.labels.`app"); !errors.Is(err, ErrParse) {
+		t.Errorf("expected a quoted key that isn't closed to fail, got %v", err)
+	}
+}
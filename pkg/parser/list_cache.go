@@ -0,0 +1,194 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Within a query, the resources of a node pattern are listed once and reused by every clause matching it. With a
+// CacheTTL they're also reused by the next queries of the executor and its forks, until they're older than the
+// TTL, so that a shell or watch session running similar queries one after the other doesn't list the same
+// resources each time. A query that changes resources clears the cache, so that the next ones see its changes.
+// EXPLAIN tells which node patterns would be served from the cache, and the shell's :cache command shows or
+// clears it.
+
+// CacheTTL is how long the resources a query listed are reused by the next queries, 0 to list them every time
+var CacheTTL time.Duration
+
+// listCache holds the resources listed by the queries of an executor and its forks
+type listCache struct {
+	mutex   sync.Mutex
+	entries map[string]cachedList
+}
+
+type cachedList struct {
+	entry     CacheEntry
+	resources []map[string]interface{}
+	fetchedAt time.Time
+}
+
+// CacheEntry describes the resources of a kind the cache holds, listed in a namespace with selectors
+type CacheEntry struct {
+	Namespace     string
+	Kind          string
+	FieldSelector string
+	LabelSelector string
+	Resources     int
+	Age           time.Duration
+	// ExpiresIn is how long the resources are still reused for
+	ExpiresIn time.Duration
+}
+
+func newListCache() *listCache {
+	return &listCache{entries: make(map[string]cachedList)}
+}
+
+func listCacheKey(entry CacheEntry) string {
+	return strings.Join([]string{entry.Namespace, strings.ToLower(entry.Kind), entry.FieldSelector, entry.LabelSelector}, "|")
+}
+
+// get returns a copy of the resources listed for entry, if they're not older than CacheTTL
+func (c *listCache) get(entry CacheEntry) ([]map[string]interface{}, time.Time, bool) {
+	if c == nil || CacheTTL <= 0 {
+		return nil, time.Time{}, false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	cached, ok := c.entries[listCacheKey(entry)]
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	if time.Since(cached.fetchedAt) >= CacheTTL {
+		delete(c.entries, listCacheKey(entry))
+		return nil, time.Time{}, false
+	}
+	// Queries annotate the resources they match, e.g. with metrics, the cached ones stay as they were listed
+	return copyResources(cached.resources), cached.fetchedAt, true
+}
+
+// put caches the resources listed for entry at fetchedAt
+func (c *listCache) put(entry CacheEntry, resources []map[string]interface{}, fetchedAt time.Time) {
+	if c == nil || CacheTTL <= 0 {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries[listCacheKey(entry)] = cachedList{entry: entry, resources: copyResources(resources), fetchedAt: fetchedAt}
+}
+
+// status describes the cached resources that aren't older than CacheTTL, and drops the others
+func (c *listCache) status() []CacheEntry {
+	if c == nil {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entries := []CacheEntry{}
+	for key, cached := range c.entries {
+		age := time.Since(cached.fetchedAt)
+		if age >= CacheTTL {
+			delete(c.entries, key)
+			continue
+		}
+		entry := cached.entry
+		entry.Resources = len(cached.resources)
+		entry.Age = age
+		entry.ExpiresIn = CacheTTL - age
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return listCacheKey(entries[i]) < listCacheKey(entries[j])
+	})
+	return entries
+}
+
+// clear empties the cache, returning how many lists it held
+func (c *listCache) clear() int {
+	if c == nil {
+		return 0
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	cleared := len(c.entries)
+	c.entries = make(map[string]cachedList)
+	return cleared
+}
+
+// CachedLists describes the resources the next queries of the executor would reuse
+func (q *QueryExecutor) CachedLists() []CacheEntry {
+	return q.listCache.status()
+}
+
+// ClearCachedLists empties the cache of the executor and its forks, returning how many lists it held
+func (q *QueryExecutor) ClearCachedLists() int {
+	return q.listCache.clear()
+}
+
+// cachedResources lists the resources of kind in the namespace of the running query with the given selectors,
+// unless a previous query listed them less than CacheTTL ago. It tells when they were listed, and whether they
+// were served from the cache.
+func (q *QueryExecutor) cachedResources(kind, fieldSelector, labelSelector string) (interface{}, resultSource, error) {
+	entry := CacheEntry{Namespace: q.namespace, Kind: kind, FieldSelector: fieldSelector, LabelSelector: labelSelector}
+	if resources, fetchedAt, ok := q.listCache.get(entry); ok {
+		logDebug("Reusing cached resources", "kind", kind, "namespace", q.namespace, "age", time.Since(fetchedAt).Round(time.Millisecond))
+		return resources, resultSource{source: ProvenanceCache, fetchedAt: fetchedAt}, nil
+	}
+	resources, err := q.getResources(kind, fieldSelector, labelSelector)
+	if err != nil {
+		return nil, resultSource{}, err
+	}
+	fetchedAt := time.Now()
+	listed, _ := resources.([]map[string]interface{})
+	q.listCache.put(entry, listed, fetchedAt)
+	return resources, resultSource{source: ProvenanceLive, fetchedAt: fetchedAt}, nil
+}
+
+// explainCache describes whether the resources of kind listed in namespace with the given selectors would be
+// served from the cache, and how many it holds if they would
+func (q *QueryExecutor) explainCache(namespace, kind, fieldSelector, labelSelector string) (string, int, bool) {
+	if q.listCache == nil || CacheTTL <= 0 {
+		return "", 0, false
+	}
+	entry := CacheEntry{Namespace: namespace, Kind: kind, FieldSelector: fieldSelector, LabelSelector: labelSelector}
+	q.listCache.mutex.Lock()
+	cached, ok := q.listCache.entries[listCacheKey(entry)]
+	q.listCache.mutex.Unlock()
+	if age := time.Since(cached.fetchedAt); ok && age < CacheTTL {
+		status := fmt.Sprintf("hit, listed %s ago, expires in %s", age.Round(time.Second), (CacheTTL - age).Round(time.Second))
+		return status, len(cached.resources), true
+	}
+	return "miss, kept for " + CacheTTL.String(), 0, false
+}
+
+// copyResources deep copies listed resources
+func copyResources(resources []map[string]interface{}) []map[string]interface{} {
+	if resources == nil {
+		return nil
+	}
+	copied := make([]map[string]interface{}, len(resources))
+	for i, resource := range resources {
+		copied[i] = copyValue(resource).(map[string]interface{})
+	}
+	return copied
+}
+
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			copied[key] = copyValue(item)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = copyValue(item)
+		}
+		return copied
+	}
+	return value
+}
@@ -0,0 +1,70 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListCache(t *testing.T) {
+	originalTTL := CacheTTL
+	defer func() { CacheTTL = originalTTL }()
+	CacheTTL = time.Minute
+
+	q := newTestQueryExecutor(t, newTestObject("v1", "Pod", "default", "web-1", nil))
+	q.listCache = newListCache()
+	fork := q.Fork()
+
+	executeTestQuery(t, q, `MATCH (p:Pod) RETURN p.metadata.name`)
+	if calls := q.APICalls(); calls != 1 {
+		t.Fatalf("expected the pods to be listed, got %d API calls", calls)
+	}
+
+	// The next queries, forks' included, reuse the pods
+	plan := executeTestQuery(t, fork, `EXPLAIN MATCH (p:Pod) RETURN p`).Data["plan"].(*QueryPlan)
+	if node := plan.Nodes[0]; !node.Cached || !strings.HasPrefix(node.ListCache, "hit, ") || len(node.APICalls) != 0 {
+		t.Errorf("expected the plan to reuse the cached pods, got %+v", node)
+	}
+	originalExplainFields := ExplainFields
+	ExplainFields = true
+	result := executeTestQuery(t, fork, `MATCH (p:Pod) RETURN p.metadata.name`)
+	ExplainFields = originalExplainFields
+	if calls := q.APICalls() + fork.APICalls(); calls != 1 {
+		t.Errorf("expected the pods not to be listed again, got %d API calls", calls)
+	}
+	rows := result.Data["p"].([]interface{})
+	provenance := rows[0].(map[string]interface{})["_provenance"].(map[string]interface{})
+	if source := provenance["p.metadata.name"].(map[string]interface{})["source"]; source != ProvenanceCache {
+		t.Errorf("expected the pod to come from the cache, got %v", source)
+	}
+	entries := q.CachedLists()
+	if len(entries) != 1 || entries[0].Kind != "Pod" || entries[0].Namespace != "default" || entries[0].Resources != 1 {
+		t.Errorf("expected the pods of default to be cached, got %+v", entries)
+	}
+
+	// Changes clear the cache, so that the next queries see them
+	executeTestQuery(t, q, `MATCH (p:Pod) SET p.metadata.labels.team = "web" RETURN p.metadata.name`)
+	if entries := q.CachedLists(); len(entries) != 0 {
+		t.Errorf("expected the cache to be cleared, got %+v", entries)
+	}
+	result = executeTestQuery(t, q, `MATCH (p:Pod) RETURN p.metadata.labels.team`)
+	if !strings.Contains(fmt.Sprint(result.Data), "team:web") {
+		t.Errorf("expected the changed pod, got %v", result.Data)
+	}
+
+	// Lists older than the TTL are listed again
+	calls := q.APICalls()
+	for key, cached := range q.listCache.entries {
+		cached.fetchedAt = cached.fetchedAt.Add(-CacheTTL)
+		q.listCache.entries[key] = cached
+	}
+	executeTestQuery(t, q, `MATCH (p:Pod) RETURN p.metadata.name`)
+	if q.APICalls() != calls+1 {
+		t.Errorf("expected expired pods to be listed again")
+	}
+
+	if cleared := q.ClearCachedLists(); cleared != 1 {
+		t.Errorf("expected 1 list to be cleared, got %d", cleared)
+	}
+}
@@ -0,0 +1,89 @@
+package parser
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// LogLevel is the minimum level logged: debug, info, warn or error (fatal and panic only log errors).
+// It can change at any time, e.g. when the shell toggles debug mode.
+var LogLevel string
+
+// LogFormat is the format of log records: text (key=value pairs) or json
+var LogFormat = "text"
+
+// LogOutput is where log records are written
+var LogOutput io.Writer = os.Stderr
+
+var (
+	loggerMutex  sync.Mutex
+	logger       *slog.Logger
+	loggerFormat string
+	loggerOutput io.Writer
+)
+
+// ValidateLogFlags reports an error for an unknown LogLevel or LogFormat
+func ValidateLogFlags() error {
+	switch strings.ToLower(LogLevel) {
+	case "", "debug", "info", "warn", "warning", "error", "fatal", "panic":
+	default:
+		return newDiagnosticError(CodeInvalidLogLevel, nil, "level", strconv.Quote(LogLevel))
+	}
+	switch strings.ToLower(LogFormat) {
+	case "", "text", "json":
+	default:
+		return newDiagnosticError(CodeInvalidLogFormat, nil, "format", strconv.Quote(LogFormat))
+	}
+	return nil
+}
+
+// logLevelFlag makes the logger follow LogLevel as it changes
+type logLevelFlag struct{}
+
+func (logLevelFlag) Level() slog.Level {
+	switch strings.ToLower(LogLevel) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	case "fatal", "panic":
+		return slog.LevelError + 4
+	}
+	return slog.LevelInfo
+}
+
+// Logger returns the logger used by the parser and the executor, configured by LogLevel, LogFormat and LogOutput
+func Logger() *slog.Logger {
+	loggerMutex.Lock()
+	defer loggerMutex.Unlock()
+
+	if logger == nil || loggerFormat != LogFormat || loggerOutput != LogOutput {
+		options := &slog.HandlerOptions{Level: logLevelFlag{}}
+		var handler slog.Handler = slog.NewTextHandler(LogOutput, options)
+		if strings.ToLower(LogFormat) == "json" {
+			handler = slog.NewJSONHandler(LogOutput, options)
+		}
+		logger = slog.New(handler)
+		loggerFormat = LogFormat
+		loggerOutput = LogOutput
+	}
+	return logger
+}
+
+// logDebug logs a message with key-value attributes, e.g. logDebug("Listing resources", "kind", kind)
+func logDebug(msg string, args ...interface{}) {
+	if (logLevelFlag{}).Level() > slog.LevelDebug {
+		return
+	}
+	Logger().Debug(msg, args...)
+}
+
+func logWarn(msg string, args ...interface{}) {
+	Logger().Warn(msg, args...)
+}
@@ -0,0 +1,65 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	originalLevel, originalFormat, originalOutput := LogLevel, LogFormat, LogOutput
+	defer func() { LogLevel, LogFormat, LogOutput = originalLevel, originalFormat, originalOutput }()
+
+	var buf bytes.Buffer
+	LogOutput = &buf
+	LogLevel, LogFormat = "info", "json"
+
+	logDebug("Listing resources", "kind", "Pod")
+	if buf.Len() != 0 {
+		t.Errorf("expected debug records to be dropped at info level, got %s", buf.String())
+	}
+
+	LogLevel = "debug"
+	logDebug("Listing resources", "kind", "Pod")
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("expected a JSON record, got %q: %v", buf.String(), err)
+	}
+	if record["level"] != "DEBUG" || record["msg"] != "Listing resources" || record["kind"] != "Pod" {
+		t.Errorf("unexpected record %v", record)
+	}
+
+	buf.Reset()
+	LogLevel, LogFormat = "error", "text"
+	logWarn("Error retrieving schema", "groupVersion", "apps/v1")
+	Logger().Error("Error creating QueryExecutor instance", "error", "no config")
+	if strings.Contains(buf.String(), "schema") || !strings.Contains(buf.String(), `level=ERROR msg="Error creating QueryExecutor instance" error="no config"`) {
+		t.Errorf("unexpected text records %q", buf.String())
+	}
+}
+
+func TestValidateLogFlags(t *testing.T) {
+	originalLevel, originalFormat := LogLevel, LogFormat
+	defer func() { LogLevel, LogFormat = originalLevel, originalFormat }()
+
+	LogLevel, LogFormat = "warn", "json"
+	if err := ValidateLogFlags(); err != nil {
+		t.Errorf("ValidateLogFlags() error = %v", err)
+	}
+	LogLevel = "verbose"
+	if err := ValidateLogFlags(); err == nil || !strings.Contains(err.Error(), "unknown log level") {
+		t.Errorf("expected an unknown log level error, got %v", err)
+	}
+	LogLevel, LogFormat = "info", "yaml"
+	if err := ValidateLogFlags(); err == nil || !strings.Contains(err.Error(), "unknown log format") {
+		t.Errorf("expected an unknown log format error, got %v", err)
+	}
+}
+
+func TestParseQuerySyntaxError(t *testing.T) {
+	_, err := ParseQuery("MATCH (p:Pod RETURN p")
+	if err == nil || !strings.HasPrefix(err.Error(), "parsing failed: syntax error") {
+		t.Errorf("expected the syntax error to be returned, got %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// defaultLogLines is the number of lines logs() returns when it isn't given a number
+const defaultLogLines = 100
+
+// defaultContainerAnnotation names the container kubectl reads the logs of when none is given
+const defaultContainerAnnotation = "kubectl.kubernetes.io/default-container"
+
+var podLogsGVR = schema.GroupVersionResource{Version: "v1", Resource: "pods/log"}
+
+// podLogsFunc reads the logs of a container of a pod, as the API server returns them
+type podLogsFunc func(ctx context.Context, namespace, name string, options *corev1.PodLogOptions) ([]byte, error)
+
+// podLogLines evaluates logs(p, container, lines) for a pod: the last lines of the logs of its container, one
+// string per line. The container and number of lines are optional, in that order. Without a container, that of
+// the default-container annotation is read, or the first one. A container waiting to restart, e.g. in
+// CrashLoopBackOff, hasn't logged anything yet, the logs of its previous run are read instead. Logs that can't be
+// read, e.g. of a pod that isn't running yet, are nil, unless reading them isn't allowed.
+func (q *QueryExecutor) podLogLines(pod map[string]interface{}, args []*FunctionArg) (interface{}, error) {
+	if pod["kind"] != "Pod" {
+		return nil, newDiagnosticError(CodeFunctionArguments, nil, "function", "logs", "reason", fmt.Sprintf("reads the logs of pods, not of %v", pod["kind"]))
+	}
+	if len(args) > 2 {
+		return nil, newDiagnosticError(CodeFunctionArguments, nil, "function", "logs", "reason", fmt.Sprintf("takes at most 3 arguments, got %d", len(args)+1))
+	}
+	options := &corev1.PodLogOptions{}
+	lines := int64(defaultLogLines)
+	for i, arg := range args {
+		switch value := arg.Value.(type) {
+		case string:
+			if i > 0 {
+				return nil, newDiagnosticError(CodeFunctionArguments, nil, "function", "logs", "reason", "the container must be the second argument")
+			}
+			options.Container = value
+		case int:
+			if i != len(args)-1 || value <= 0 {
+				return nil, newDiagnosticError(CodeFunctionArguments, nil, "function", "logs", "reason", "the number of lines must be the last argument, and positive")
+			}
+			lines = int64(value)
+		default:
+			return nil, newDiagnosticError(CodeFunctionArguments, nil, "function", "logs", "reason", "takes a container name and a number of lines")
+		}
+	}
+	options.TailLines = &lines
+
+	metadata, _ := pod["metadata"].(map[string]interface{})
+	if options.Container == "" {
+		options.Container = defaultContainer(pod)
+	}
+	options.Previous = waitingToRestart(pod, options.Container)
+
+	data, err := q.readPodLogs(getNamespaceName(metadata), fmt.Sprint(metadata["name"]), options)
+	if err != nil {
+		if apierrors.IsForbidden(err) || apierrors.IsUnauthorized(err) {
+			return nil, apiError("get", podLogsGVR, err)
+		}
+		logDebug("Error reading pod logs", "pod", resourceIdentity(pod), "container", options.Container, "error", err)
+		return nil, nil
+	}
+	logLines := []interface{}{}
+	if text := strings.TrimSuffix(string(data), "\n"); text != "" {
+		for _, line := range strings.Split(text, "\n") {
+			logLines = append(logLines, line)
+		}
+	}
+	return logLines, nil
+}
+
+// readPodLogs reads the logs of a container of a pod
+func (q *QueryExecutor) readPodLogs(namespace, name string, options *corev1.PodLogOptions) ([]byte, error) {
+	q.observeAPICall("get", podLogsGVR)
+	if q.podLogs != nil {
+		return q.podLogs(q.context(), namespace, name, options)
+	}
+	return q.Clientset.CoreV1().Pods(namespace).GetLogs(name, options).DoRaw(q.context())
+}
+
+// defaultContainer is the container whose logs are read when none is named
+func defaultContainer(pod map[string]interface{}) string {
+	metadata, _ := pod["metadata"].(map[string]interface{})
+	annotations, _ := metadata["annotations"].(map[string]interface{})
+	if container, ok := annotations[defaultContainerAnnotation].(string); ok && container != "" {
+		return container
+	}
+	spec, _ := pod["spec"].(map[string]interface{})
+	containers, _ := spec["containers"].([]interface{})
+	if len(containers) > 0 {
+		container, _ := containers[0].(map[string]interface{})
+		name, _ := container["name"].(string)
+		return name
+	}
+	return ""
+}
+
+// waitingToRestart reports whether a container of a pod is waiting to run again after it terminated
+func waitingToRestart(pod map[string]interface{}, container string) bool {
+	status, _ := pod["status"].(map[string]interface{})
+	statuses, _ := status["containerStatuses"].([]interface{})
+	for _, s := range statuses {
+		containerStatus, _ := s.(map[string]interface{})
+		if containerStatus["name"] != container {
+			continue
+		}
+		state, _ := containerStatus["state"].(map[string]interface{})
+		restarts, _ := toFloat64(containerStatus["restartCount"])
+		return state["waiting"] != nil && restarts > 0
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestPodLogs(t *testing.T) {
+	crashing := newTestObject("v1", "Pod", "default", "web-1", map[string]interface{}{
+		"spec": map[string]interface{}{"containers": []interface{}{map[string]interface{}{"name": "app"}, map[string]interface{}{"name": "proxy"}}},
+		"status": map[string]interface{}{"containerStatuses": []interface{}{map[string]interface{}{
+			"name":         "app",
+			"restartCount": int64(4),
+			"state":        map[string]interface{}{"waiting": map[string]interface{}{"reason": "CrashLoopBackOff"}},
+		}}},
+	})
+	running := newTestObject("v1", "Pod", "default", "web-2", map[string]interface{}{
+		"spec": map[string]interface{}{"containers": []interface{}{map[string]interface{}{"name": "app"}, map[string]interface{}{"name": "proxy"}}},
+	})
+	running.SetAnnotations(map[string]string{defaultContainerAnnotation: "proxy"})
+	q := newTestQueryExecutor(t, crashing, running)
+
+	var requests []string
+	q.podLogs = func(ctx context.Context, namespace, name string, options *corev1.PodLogOptions) ([]byte, error) {
+		requests = append(requests, fmt.Sprintf("%s/%s %s tail=%d previous=%t", namespace, name, options.Container, *options.TailLines, options.Previous))
+		var lines []string
+		for i := 1; i <= int(*options.TailLines); i++ {
+			lines = append(lines, fmt.Sprintf("%s line %d", name, i))
+		}
+		return []byte(strings.Join(lines, "\n") + "\n"), nil
+	}
+
+	result := executeTestQuery(t, q, `MATCH (p:Pod) WHERE p.status.containerStatuses[0].state.waiting.reason = "CrashLoopBackOff" RETURN logs(p, 2) AS logs`)
+	expected := []interface{}{map[string]interface{}{"name": "web-1", "logs": []interface{}{"web-1 line 1", "web-1 line 2"}}}
+	if !reflect.DeepEqual(result.Data["p"], expected) {
+		t.Errorf("expected %v, got %v", expected, result.Data["p"])
+	}
+	// The crashing container hasn't logged anything since it last terminated
+	if want := []string{"default/web-1 app tail=2 previous=true"}; !reflect.DeepEqual(requests, want) {
+		t.Errorf("expected requests %v, got %v", want, requests)
+	}
+
+	requests = nil
+	executeTestQuery(t, q, `MATCH (p:Pod) WHERE p.metadata.name = "web-2" RETURN logs(p), logs(p, "app", 1) AS app`)
+	want := []string{"default/web-2 proxy tail=100 previous=false", "default/web-2 app tail=1 previous=false"}
+	if !reflect.DeepEqual(requests, want) {
+		t.Errorf("expected requests %v, got %v", want, requests)
+	}
+
+	// Logs that can't be read are missing, unless reading them isn't allowed
+	q.podLogs = func(ctx context.Context, namespace, name string, options *corev1.PodLogOptions) ([]byte, error) {
+		return nil, apierrors.NewBadRequest("container \"app\" in pod \"web-1\" is waiting to start")
+	}
+	result = executeTestQuery(t, q, `MATCH (p:Pod) WHERE p.metadata.name = "web-1" RETURN logs(p)`)
+	if logs := result.Data["p"].([]interface{})[0].(map[string]interface{})["logs"]; logs != nil {
+		t.Errorf("expected no logs, got %v", logs)
+	}
+	q.podLogs = func(ctx context.Context, namespace, name string, options *corev1.PodLogOptions) ([]byte, error) {
+		return nil, apierrors.NewForbidden(schema.GroupResource{Resource: "pods/log"}, name, fmt.Errorf("denied"))
+	}
+	ast, err := ParseQuery(`MATCH (p:Pod) RETURN logs(p)`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	if _, err := q.Execute(ast, "default"); DiagnosticCodeOf(err) != CodeForbidden {
+		t.Errorf("expected %s, got %v", CodeForbidden, err)
+	}
+}
+
+func TestPodLogsArguments(t *testing.T) {
+	q := newTestQueryExecutor(t,
+		newTestObject("v1", "Pod", "default", "web-1", nil),
+		newTestObject("v1", "Service", "default", "web", nil),
+	)
+	q.podLogs = func(ctx context.Context, namespace, name string, options *corev1.PodLogOptions) ([]byte, error) {
+		return nil, nil
+	}
+	for _, query := range []string{
+		`MATCH (s:Service) RETURN logs(s)`,
+		`MATCH (p:Pod) RETURN logs(p, 10, "app")`,
+		`MATCH (p:Pod) RETURN logs(p, "app", 0)`,
+		`MATCH (p:Pod) RETURN logs(p, p.metadata.name)`,
+		`MATCH (p:Pod) RETURN logs(p, "app", 10, 20)`,
+	} {
+		ast, err := ParseQuery(query)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q) error = %v", query, err)
+		}
+		if _, err := q.Execute(ast, "default"); DiagnosticCodeOf(err) != CodeFunctionArguments {
+			t.Errorf("%s: expected %s, got %v", query, CodeFunctionArguments, err)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// mergeNode matches the resource of a MERGE node pattern by its name and fields, or creates the resource the
+// pattern describes if none matches. The created resource gets the name, labels and fields of the pattern, and
+// the values of the SET clause that follows the MERGE, if any. It reports whether the resource was created.
+func (q *QueryExecutor) mergeNode(node *NodePattern, set *SetClause, results *QueryResult) (bool, error) {
+	nodeId := node.ResourceProperties.Name
+	if node.ResourceProperties.Kind == "" {
+		return false, newDiagnosticError(CodeMissingKind, nil)
+	}
+	if IsMultiKindPattern(node.ResourceProperties.Kind) {
+		return false, newDiagnosticError(CodeMergeUnsupported, nil, "node", nodeId, "reason", "it matches more than one kind")
+	}
+	gvr, err := FindGVR(q.Clientset, node.ResourceProperties.Kind)
+	if err != nil {
+		return false, fmt.Errorf("error finding API resource >> %w", err)
+	}
+
+	// Names are unique, a resource with the name is matched whatever its labels as it couldn't be created
+	var name string
+	template := map[string]interface{}{}
+	labels := map[string]interface{}{}
+	match := &NodePattern{ResourceProperties: &ResourceProperties{Name: nodeId, Kind: node.ResourceProperties.Kind, Properties: &Properties{}}}
+	if node.ResourceProperties.Properties != nil {
+		for _, prop := range node.ResourceProperties.Properties.PropertyList {
+			key := strings.Trim(prop.Key, `"`)
+			if prop.Operator != "" {
+				return false, newDiagnosticError(CodeMergeUnsupported, nil, "node", nodeId, "reason", fmt.Sprintf("%s isn't an equality", key))
+			}
+			field, isField := fieldSelectorKey(gvr.Resource, key)
+			if isField || key == "namespace" || key == "metadata.namespace" {
+				match.ResourceProperties.Properties.PropertyList = append(match.ResourceProperties.Properties.PropertyList, prop)
+			}
+			switch {
+			case key == "namespace" || key == "metadata.namespace":
+				// Set by createK8sResource, from the namespace the pattern is matched in
+			case field == "metadata.name":
+				name = fmt.Sprint(prop.Value)
+			case isField:
+				updateResultMap(template, strings.Split(field, "."), prop.Value)
+			default:
+				labels[key] = fmt.Sprint(prop.Value)
+			}
+		}
+	}
+	if name == "" {
+		return false, newDiagnosticError(CodeMergeUnsupported, nil, "node", nodeId, "reason", "it has no name property")
+	}
+	if len(labels) > 0 {
+		updateResultMap(template, []string{"metadata", "labels"}, labels)
+	}
+
+	if err := q.processNodes(&MatchClause{Nodes: []*NodePattern{match}}, results); err != nil {
+		return false, err
+	}
+	if resources, _ := q.resultMap[nodeId].([]map[string]interface{}); len(resources) > 0 {
+		return false, nil
+	}
+
+	if set != nil {
+		for _, kvp := range set.KeyValuePairs {
+			if strings.Split(kvp.Key, ".")[0] != nodeId {
+				continue
+			}
+			path := setPath(kvp.Key)
+			for i, part := range path {
+				path[i] = strings.ReplaceAll(part, "~1", "/")
+			}
+			updateResultMap(template, path, kvp.Value)
+		}
+	}
+
+	created, err := q.createK8sResource(node, template, name)
+	if err != nil {
+		return false, fmt.Errorf("error creating resource >> %w", err)
+	}
+	q.resultMap[nodeId] = []map[string]interface{}{created}
+	q.resultSources[nodeId] = resultSource{source: ProvenanceLive, fetchedAt: time.Now()}
+	metadata, _ := created["metadata"].(map[string]interface{})
+	graphNode := Node{Id: nodeId, Kind: fmt.Sprint(created["kind"]), Name: name}
+	if graphNode.Kind != "Namespace" {
+		graphNode.Namespace = getNamespaceName(metadata)
+	}
+	results.Graph.Nodes = append(results.Graph.Nodes, graphNode)
+	return true, nil
+}
@@ -0,0 +1,84 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestParseMerge(t *testing.T) {
+	expr, err := ParseQuery(`MERGE (p:Pod {name: "web", app: "shop"}) SET p.spec.nodeName = "node-1" RETURN p.metadata.labels`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	expected := []Clause{
+		&MergeClause{Node: &NodePattern{ResourceProperties: &ResourceProperties{
+			Name: "p",
+			Kind: "Pod",
+			Properties: &Properties{PropertyList: []*Property{
+				{Key: "name", Value: "web"},
+				{Key: "app", Value: "shop"},
+			}},
+		}}},
+		&SetClause{KeyValuePairs: []*KeyValuePair{{Key: "p.spec.nodeName", Value: "node-1", Operator: "EQUALS"}}},
+		&ReturnClause{Items: []*ReturnItem{{JsonPath: "p.metadata.labels"}}},
+	}
+	if !reflect.DeepEqual(expr.Clauses, expected) {
+		t.Errorf("ParseQuery() = %v, want %v", expr.Clauses, expected)
+	}
+}
+
+func TestMergeCreatesOrMatches(t *testing.T) {
+	q := newTestQueryExecutor(t)
+	fake := q.DynamicClient.(*dynamicfake.FakeDynamicClient)
+	query := `MERGE (p:Pod {name: "web", namespace: "staging", app: "shop"}) SET p.metadata.labels.tier = "frontend" RETURN p.metadata.labels`
+
+	verbs := func() []string {
+		var verbs []string
+		for _, action := range fake.Actions() {
+			if verb := action.GetVerb(); verb != "list" && verb != "get" {
+				verbs = append(verbs, action.GetVerb())
+			}
+		}
+		fake.ClearActions()
+		return verbs
+	}
+	labels := map[string]interface{}{"app": "shop", "tier": "frontend"}
+
+	// The pod doesn't exist, it's created with the pattern's labels and the SET values
+	result := executeTestQuery(t, q, query)
+	if got := verbs(); !reflect.DeepEqual(got, []string{"create"}) {
+		t.Errorf("expected the pod to be created, got %v", got)
+	}
+	returned := result.Data["p"].([]interface{})[0].(map[string]interface{})
+	if !reflect.DeepEqual(returned["metadata"], map[string]interface{}{"labels": labels}) {
+		t.Errorf("unexpected labels %v", returned["metadata"])
+	}
+	if len(result.Graph.Nodes) != 1 || result.Graph.Nodes[0].Namespace != "staging" {
+		t.Errorf("expected the created pod in the graph, got %v", result.Graph.Nodes)
+	}
+
+	// The pod exists now, it's matched and patched instead
+	executeTestQuery(t, q, query)
+	if got := verbs(); !reflect.DeepEqual(got, []string{"patch"}) {
+		t.Errorf("expected the pod to be patched, got %v", got)
+	}
+}
+
+func TestMergeUnsupportedPatterns(t *testing.T) {
+	q := newTestQueryExecutor(t)
+	for _, query := range []string{
+		`MERGE (p:Pod {app: "shop"})`,
+		`MERGE (p:Pod {name: "web", app IN ["shop"]})`,
+		`MERGE (w:Pod|Deployment {name: "web"})`,
+	} {
+		ast, err := ParseQuery(query)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q) error = %v", query, err)
+		}
+		if _, err := q.Execute(ast, "default"); DiagnosticCodeOf(err) != CodeMergeUnsupported {
+			t.Errorf("%s: expected code %s, got %v", query, CodeMergeUnsupported, err)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// Pods and nodes have a virtual metrics field, added to them when a query refers to it, with their current usage
+// as reported by the metrics API (metrics.k8s.io, served by metrics-server):
+//
+//	metrics.cpu, metrics.memory                     usage, in millicores and bytes
+//	metrics.cpuLimitPercent, metrics.memoryLimitPercent
+//	metrics.cpuRequestPercent, metrics.memoryRequestPercent
+//	                                                usage of a pod relative to the sum of its containers' limits or
+//	                                                requests, when all of its containers set them
+//	metrics.cpuPercent, metrics.memoryPercent       usage of a node relative to its allocatable resources
+//	metrics.containers                              name, cpu and memory of each container of a pod
+//	metrics.timestamp, metrics.window               when the usage was sampled, and over how long
+//
+// Resources the metrics API has no sample of yet, e.g. pods that just started, have no metrics field.
+const metricsField = "metrics"
+
+// metricsResources are the resources of the metrics API, by the resource they report on
+var metricsResources = map[schema.GroupVersionResource]schema.GroupVersionResource{
+	{Version: "v1", Resource: "pods"}:  {Group: "metrics.k8s.io", Version: "v1beta1", Resource: "pods"},
+	{Version: "v1", Resource: "nodes"}: {Group: "metrics.k8s.io", Version: "v1beta1", Resource: "nodes"},
+}
+
+// metricsNodes returns the names of the nodes whose metrics field the query refers to
+func metricsNodes(ast *Expression) map[string]bool {
+	nodes := make(map[string]bool)
+	refer := func(path string) {
+		if parts := strings.Split(path, "."); len(parts) > 1 && parts[1] == metricsField {
+			nodes[parts[0]] = true
+		}
+	}
+	referItems := func(items []*ReturnItem) {
+		for _, item := range items {
+			refer(item.JsonPath)
+			for _, arg := range item.Args {
+				refer(arg.JsonPath)
+			}
+		}
+	}
+	referFilters := func(filters []*KeyValuePair) {
+		for _, filter := range filters {
+			refer(filter.Key)
+			for _, arg := range filter.Args {
+				refer(arg.JsonPath)
+			}
+		}
+	}
+	for _, clause := range ast.Clauses {
+		switch c := clause.(type) {
+		case *MatchClause:
+			referFilters(c.ExtraFilters)
+		case *WithClause:
+			referItems(c.Items)
+			referFilters(c.ExtraFilters)
+		case *UnwindClause:
+			refer(c.JsonPath)
+		case *ReturnClause:
+			referItems(c.Items)
+			for _, item := range c.OrderBy {
+				refer(item.JsonPath)
+			}
+		}
+	}
+	return nodes
+}
+
+// addMetrics adds the metrics field to the resources of a node whose metrics the query refers to, if the node
+// matches pods or nodes. The usage of the resources is listed once per query.
+func (q *QueryExecutor) addMetrics(n *NodePattern, resources []map[string]interface{}) error {
+	if !q.metricsNodes[n.ResourceProperties.Name] || len(resources) == 0 || IsMultiKindPattern(n.ResourceProperties.Kind) {
+		return nil
+	}
+	gvr, err := FindGVR(q.Clientset, n.ResourceProperties.Kind)
+	if err != nil {
+		return nil
+	}
+	metricsGVR, ok := metricsResources[gvr]
+	if !ok {
+		return nil
+	}
+	usage, err := q.listMetrics(metricsGVR)
+	if err != nil {
+		return err
+	}
+	for _, resource := range resources {
+		if _, ok := resource[metricsField]; ok {
+			continue
+		}
+		sample, ok := usage[metricsKey(resource)]
+		if !ok {
+			continue
+		}
+		if gvr.Resource == "pods" {
+			resource[metricsField] = podMetrics(resource, sample)
+		} else {
+			resource[metricsField] = nodeMetrics(resource, sample)
+		}
+	}
+	return nil
+}
+
+// listMetrics lists the samples of a resource of the metrics API in the namespace of the query, by the metricsKey
+// of the resource they're of
+func (q *QueryExecutor) listMetrics(gvr schema.GroupVersionResource) (map[string]map[string]interface{}, error) {
+	if q.metricsSamples == nil {
+		q.metricsSamples = make(map[schema.GroupVersionResource]map[string]map[string]interface{})
+	}
+	if samples, ok := q.metricsSamples[gvr]; ok {
+		return samples, nil
+	}
+	var client dynamic.ResourceInterface = q.DynamicClient.Resource(gvr)
+	if gvr.Resource == "pods" {
+		client = q.DynamicClient.Resource(gvr).Namespace(q.namespace)
+	}
+	q.observeAPICall("list", gvr)
+	ctx, cancel := listContext(q.context(), gvr)
+	defer cancel()
+	list, err := client.List(ctx, metav1.ListOptions{})
+	if err != nil {
+		if _, ok := listTimedOut(ctx); ok {
+			return nil, q.listError(ctx, gvr, err)
+		}
+		return nil, newDiagnosticError(CodeMetricsUnavailable, err, "resource", gvr.Resource)
+	}
+	samples := make(map[string]map[string]interface{})
+	for _, item := range list.Items {
+		// Samples have the namespace and name of the resource they're of
+		samples[metricsKey(item.UnstructuredContent())] = item.UnstructuredContent()
+	}
+	q.metricsSamples[gvr] = samples
+	return samples, nil
+}
+
+// metricsKey is the namespace and name of a resource, which it shares with its sample of the metrics API
+func metricsKey(resource map[string]interface{}) string {
+	metadata, _ := resource["metadata"].(map[string]interface{})
+	return fmt.Sprintf("%s/%v", getNamespaceName(metadata), metadata["name"])
+}
+
+// podMetrics is the metrics field of a pod, from its sample of the metrics API
+func podMetrics(pod, sample map[string]interface{}) map[string]interface{} {
+	metrics := sampleTime(sample)
+	containers := []interface{}{}
+	var cpu, memory int64
+	items, _ := sample["containers"].([]interface{})
+	for _, item := range items {
+		container, _ := item.(map[string]interface{})
+		usage, _ := container["usage"].(map[string]interface{})
+		containerCPU, containerMemory := quantityValue(usage, corev1.ResourceCPU), quantityValue(usage, corev1.ResourceMemory)
+		cpu += containerCPU
+		memory += containerMemory
+		containers = append(containers, map[string]interface{}{"name": container["name"], "cpu": containerCPU, "memory": containerMemory})
+	}
+	metrics["cpu"], metrics["memory"], metrics["containers"] = cpu, memory, containers
+
+	var spec corev1.Pod
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(pod, &spec); err != nil {
+		logDebug("Error reading pod resources", "pod", resourceIdentity(pod), "error", err)
+		return metrics
+	}
+	for name, bound := range map[string]func(corev1.Container) corev1.ResourceList{
+		"Limit":   func(c corev1.Container) corev1.ResourceList { return c.Resources.Limits },
+		"Request": func(c corev1.Container) corev1.ResourceList { return c.Resources.Requests },
+	} {
+		if total, ok := containersTotal(spec.Spec.Containers, bound, corev1.ResourceCPU); ok {
+			metrics["cpu"+name+"Percent"] = percent(cpu, total)
+		}
+		if total, ok := containersTotal(spec.Spec.Containers, bound, corev1.ResourceMemory); ok {
+			metrics["memory"+name+"Percent"] = percent(memory, total)
+		}
+	}
+	return metrics
+}
+
+// nodeMetrics is the metrics field of a node, from its sample of the metrics API
+func nodeMetrics(node, sample map[string]interface{}) map[string]interface{} {
+	metrics := sampleTime(sample)
+	usage, _ := sample["usage"].(map[string]interface{})
+	cpu, memory := quantityValue(usage, corev1.ResourceCPU), quantityValue(usage, corev1.ResourceMemory)
+	metrics["cpu"], metrics["memory"] = cpu, memory
+
+	status, _ := node["status"].(map[string]interface{})
+	allocatable, _ := status["allocatable"].(map[string]interface{})
+	if total := quantityValue(allocatable, corev1.ResourceCPU); total > 0 {
+		metrics["cpuPercent"] = percent(cpu, total)
+	}
+	if total := quantityValue(allocatable, corev1.ResourceMemory); total > 0 {
+		metrics["memoryPercent"] = percent(memory, total)
+	}
+	return metrics
+}
+
+func sampleTime(sample map[string]interface{}) map[string]interface{} {
+	metrics := make(map[string]interface{})
+	for _, key := range []string{"timestamp", "window"} {
+		if value, ok := sample[key]; ok {
+			metrics[key] = value
+		}
+	}
+	return metrics
+}
+
+// quantityValue reads a quantity of a resource list as a number: millicores for CPU, bytes for memory. Quantities
+// that are missing or can't be parsed are 0.
+func quantityValue(list map[string]interface{}, name corev1.ResourceName) int64 {
+	value, ok := list[string(name)].(string)
+	if !ok {
+		return 0
+	}
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil {
+		logDebug("Invalid quantity", "resource", name, "value", value, "error", err)
+		return 0
+	}
+	if name == corev1.ResourceCPU {
+		return quantity.MilliValue()
+	}
+	return quantity.Value()
+}
+
+// containersTotal sums a resource over the limits or requests of containers, if all of them set it
+func containersTotal(containers []corev1.Container, bound func(corev1.Container) corev1.ResourceList, name corev1.ResourceName) (int64, bool) {
+	var total int64
+	for _, container := range containers {
+		quantity, ok := bound(container)[name]
+		if !ok {
+			return 0, false
+		}
+		if name == corev1.ResourceCPU {
+			total += quantity.MilliValue()
+		} else {
+			total += quantity.Value()
+		}
+	}
+	return total, len(containers) > 0 && total > 0
+}
+
+// percent is usage as a percentage of total, to two decimals
+func percent(usage, total int64) float64 {
+	return math.Round(float64(usage)/float64(total)*10000) / 100
+}
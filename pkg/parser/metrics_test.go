@@ -0,0 +1,144 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// serveMetrics makes the metrics API return the given samples of a resource, pods or nodes. It returns the number
+// of list calls made to it.
+func serveMetrics(q *QueryExecutor, resource string, samples ...map[string]interface{}) *int {
+	calls := 0
+	q.DynamicClient.(*dynamicfake.FakeDynamicClient).PrependReactor("list", resource, func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetResource().Group != "metrics.k8s.io" {
+			return false, nil, nil
+		}
+		calls++
+		list := &unstructured.UnstructuredList{Object: map[string]interface{}{"apiVersion": "metrics.k8s.io/v1beta1", "kind": "PodMetricsList"}}
+		for _, sample := range samples {
+			list.Items = append(list.Items, unstructured.Unstructured{Object: sample})
+		}
+		return true, list, nil
+	})
+	return &calls
+}
+
+func podSample(name string, usage ...map[string]interface{}) map[string]interface{} {
+	var containers []interface{}
+	for i, u := range usage {
+		containers = append(containers, map[string]interface{}{"name": fmt.Sprintf("c%d", i), "usage": u})
+	}
+	return map[string]interface{}{
+		"apiVersion": "metrics.k8s.io/v1beta1",
+		"kind":       "PodMetrics",
+		"metadata":   map[string]interface{}{"name": name, "namespace": "default"},
+		"timestamp":  "2024-05-01T10:00:00Z",
+		"window":     "15s",
+		"containers": containers,
+	}
+}
+
+func podWithLimits(name string, limits ...map[string]interface{}) runtime.Object {
+	var containers []interface{}
+	for i, l := range limits {
+		containers = append(containers, map[string]interface{}{"name": fmt.Sprintf("c%d", i), "image": "nginx", "resources": map[string]interface{}{"limits": l}})
+	}
+	return newTestObject("v1", "Pod", "default", name, map[string]interface{}{"spec": map[string]interface{}{"containers": containers}})
+}
+
+func TestPodMetrics(t *testing.T) {
+	q := newTestQueryExecutor(t,
+		podWithLimits("web-1", map[string]interface{}{"memory": "512Mi", "cpu": "500m"}, map[string]interface{}{"memory": "512Mi"}),
+		podWithLimits("web-2", map[string]interface{}{"memory": "1Gi"}),
+		podWithLimits("starting", map[string]interface{}{"memory": "1Gi"}),
+	)
+	calls := serveMetrics(q, "pods",
+		podSample("web-1", map[string]interface{}{"cpu": "250000000n", "memory": "800Mi"}, map[string]interface{}{"cpu": "1m", "memory": "100Mi"}),
+		podSample("web-2", map[string]interface{}{"cpu": "10m", "memory": "256Mi"}),
+	)
+
+	result := executeTestQuery(t, q, `MATCH (p:Pod) WHERE p.metrics.memoryLimitPercent > 80 RETURN p.metrics.cpu, p.metrics.memory, p.metrics.cpuLimitPercent`)
+	expected := []interface{}{map[string]interface{}{
+		"name":    "web-1",
+		"metrics": map[string]interface{}{"cpu": int64(251), "memory": int64(900 << 20), "cpuLimitPercent": nil},
+	}}
+	rows := result.Data["p"].([]interface{})
+	if len(rows) != 1 {
+		t.Fatalf("expected the pod using more than 80%% of its memory limit, got %v", rows)
+	}
+	// Only some containers of web-1 limit their CPU
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("expected %v, got %v", expected, rows)
+	}
+	if *calls != 1 {
+		t.Errorf("expected the metrics to be listed once, got %d calls", *calls)
+	}
+
+	result = executeTestQuery(t, q, `MATCH (p:Pod) RETURN p.metrics.containers ORDER BY p.metrics.memory`)
+	rows = result.Data["p"].([]interface{})
+	if len(rows) != 3 || rows[1].(map[string]interface{})["name"] != "web-1" {
+		t.Fatalf("expected the pods by memory, got %v", rows)
+	}
+	containers := rows[1].(map[string]interface{})["metrics"].(map[string]interface{})["containers"]
+	if want := []interface{}{
+		map[string]interface{}{"name": "c0", "cpu": int64(250), "memory": int64(800 << 20)},
+		map[string]interface{}{"name": "c1", "cpu": int64(1), "memory": int64(100 << 20)},
+	}; !reflect.DeepEqual(containers, want) {
+		t.Errorf("expected the usage of each container, got %v", containers)
+	}
+	// Pods without a sample yet have no metrics
+	if starting := rows[2].(map[string]interface{}); starting["name"] != "starting" || starting["metrics"].(map[string]interface{})["containers"] != nil {
+		t.Errorf("expected no metrics for the starting pod, got %v", starting)
+	}
+
+	// Queries that don't refer to metrics don't list them
+	*calls = 0
+	result = executeTestQuery(t, q, `MATCH (p:Pod) RETURN p`)
+	if *calls != 0 || result.Data["p"].([]interface{})[0].(map[string]interface{})["metrics"] != nil {
+		t.Errorf("expected no metrics, got %d calls", *calls)
+	}
+}
+
+func TestNodeMetrics(t *testing.T) {
+	node := func(name, cpu, memory string) runtime.Object {
+		return newTestObject("v1", "Node", "", name, map[string]interface{}{"status": map[string]interface{}{"allocatable": map[string]interface{}{"cpu": cpu, "memory": memory}}})
+	}
+	q := newTestQueryExecutor(t, node("worker-1", "4", "16Gi"), node("worker-2", "2", "8Gi"))
+	serveMetrics(q, "nodes",
+		map[string]interface{}{"kind": "NodeMetrics", "metadata": map[string]interface{}{"name": "worker-1"}, "usage": map[string]interface{}{"cpu": "3", "memory": "4Gi"}},
+		map[string]interface{}{"kind": "NodeMetrics", "metadata": map[string]interface{}{"name": "worker-2"}, "usage": map[string]interface{}{"cpu": "500m", "memory": "6Gi"}},
+	)
+
+	result := executeTestQuery(t, q, `MATCH (n:Node) WHERE n.metrics.cpuPercent > 50 RETURN n.metrics.cpuPercent, n.metrics.memoryPercent`)
+	expected := []interface{}{map[string]interface{}{
+		"name":    "worker-1",
+		"metrics": map[string]interface{}{"cpuPercent": 75.0, "memoryPercent": 25.0},
+	}}
+	if !reflect.DeepEqual(result.Data["n"], expected) {
+		t.Errorf("expected %v, got %v", expected, result.Data["n"])
+	}
+}
+
+func TestMetricsUnavailable(t *testing.T) {
+	q := newTestQueryExecutor(t, podWithLimits("web-1"))
+	q.DynamicClient.(*dynamicfake.FakeDynamicClient).PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetResource().Group != "metrics.k8s.io" {
+			return false, nil, nil
+		}
+		return true, nil, fmt.Errorf("the server could not find the requested resource")
+	})
+
+	ast, err := ParseQuery(`MATCH (p:Pod) RETURN p.metrics.cpu`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	if _, err := q.Execute(ast, "default"); DiagnosticCodeOf(err) != CodeMetricsUnavailable {
+		t.Errorf("expected %s, got %v", CodeMetricsUnavailable, err)
+	}
+}
@@ -0,0 +1,213 @@
+package parser
+
+import (
+	"fmt"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// relationshipAnalyzer identifies how the resources of a rule without criteria are related, by evaluating other
+// resources of the cluster rather than by comparing their fields
+type relationshipAnalyzer string
+
+// analyzeNetworkPolicies relates pods to the pods the NetworkPolicies of both let them send traffic to
+const analyzeNetworkPolicies relationshipAnalyzer = "NetworkPolicies"
+
+// analyzeRelationship returns the rule of a relationship with the function matching its resources, if its rule has
+// an analyzer. Until then, resources are never related by the rule.
+func (q *QueryExecutor) analyzeRelationship(rule RelationshipRule, rel *Relationship) (RelationshipRule, error) {
+	switch rule.analyzer {
+	case "":
+		return rule, nil
+	case analyzeNetworkPolicies:
+		reachability, err := q.podReachability()
+		if err != nil {
+			return rule, err
+		}
+		// The resources of rules between the same kind are passed right node first
+		rule.match = func(resourceA, resourceB interface{}) bool {
+			right, _ := resourceA.(map[string]interface{})
+			left, _ := resourceB.(map[string]interface{})
+			switch rel.Direction {
+			case Right:
+				return reachability.canReach(left, right)
+			case Left:
+				return reachability.canReach(right, left)
+			}
+			return reachability.canReach(left, right) || reachability.canReach(right, left)
+		}
+		return rule, nil
+	}
+	return rule, fmt.Errorf("unknown analyzer %s for relationship %s", rule.analyzer, rule.Relationship)
+}
+
+// analyzerDescription describes what an analyzer evaluates, as listed by EXPLAIN
+func analyzerDescription(analyzer relationshipAnalyzer) string {
+	switch analyzer {
+	case analyzeNetworkPolicies:
+		return "allowed by the ingress NetworkPolicies of the destination and the egress NetworkPolicies of the source"
+	}
+	return string(analyzer)
+}
+
+// podReachability evaluates the NetworkPolicies of the namespace a query runs in. Traffic is allowed on some port
+// from a pod to another pod when the egress policies of the source and the ingress policies of the destination
+// allow it. IP blocks, which are meant for addresses outside the cluster, are ignored.
+type podReachability struct {
+	policies []networkingv1.NetworkPolicy
+	// namespaceLabels are the labels of the namespaces, listed if a policy selects peers by namespace
+	namespaceLabels map[string]labels.Set
+}
+
+// podReachability reads the NetworkPolicies through the result cache, once per query
+func (q *QueryExecutor) podReachability() (*podReachability, error) {
+	if q.reachability != nil {
+		return q.reachability, nil
+	}
+	resources, err := q.hopResources("networkpolicies")
+	if err != nil {
+		return nil, err
+	}
+	reachability := &podReachability{namespaceLabels: make(map[string]labels.Set)}
+	selectsNamespaces := false
+	for _, resource := range resources {
+		var policy networkingv1.NetworkPolicy
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(resource, &policy); err != nil {
+			return nil, fmt.Errorf("error reading NetworkPolicy %s >> %w", resourceIdentity(resource), err)
+		}
+		reachability.policies = append(reachability.policies, policy)
+		for _, peer := range policyPeers(policy) {
+			selectsNamespaces = selectsNamespaces || peer.NamespaceSelector != nil
+		}
+	}
+	if selectsNamespaces {
+		namespaces, err := q.hopResources("namespaces")
+		if err != nil {
+			return nil, err
+		}
+		for _, namespace := range namespaces {
+			metadata, _ := namespace["metadata"].(map[string]interface{})
+			name, _ := metadata["name"].(string)
+			// The API server labels every namespace with its name
+			set := labels.Set{"kubernetes.io/metadata.name": name}
+			for key, value := range resourceLabels(namespace) {
+				set[key] = value
+			}
+			reachability.namespaceLabels[name] = set
+		}
+	}
+	logDebug("Read NetworkPolicies", "count", len(reachability.policies), "namespaces", len(reachability.namespaceLabels))
+	q.reachability = reachability
+	return reachability, nil
+}
+
+func policyPeers(policy networkingv1.NetworkPolicy) []networkingv1.NetworkPolicyPeer {
+	var peers []networkingv1.NetworkPolicyPeer
+	for _, rule := range policy.Spec.Ingress {
+		peers = append(peers, rule.From...)
+	}
+	for _, rule := range policy.Spec.Egress {
+		peers = append(peers, rule.To...)
+	}
+	return peers
+}
+
+// canReach reports whether the policies let traffic from the pod source reach the pod destination
+func (r *podReachability) canReach(source, destination map[string]interface{}) bool {
+	if source == nil || destination == nil || resourceIdentity(source) == resourceIdentity(destination) {
+		return false
+	}
+	return r.allows(destination, source, networkingv1.PolicyTypeIngress) && r.allows(source, destination, networkingv1.PolicyTypeEgress)
+}
+
+// allows reports whether the policies of a type let a pod exchange traffic with a peer pod. Pods no policy of the
+// type selects are isolated in no way, the others only exchange traffic with the peers a rule of those policies allows.
+func (r *podReachability) allows(pod, peer map[string]interface{}, policyType networkingv1.PolicyType) bool {
+	metadata, _ := pod["metadata"].(map[string]interface{})
+	namespace := getNamespaceName(metadata)
+	isolated := false
+	for _, policy := range r.policies {
+		if policy.Namespace != namespace || !hasPolicyType(policy, policyType) || !selectorMatches(policy.Spec.PodSelector, resourceLabels(pod)) {
+			continue
+		}
+		isolated = true
+		if policyType == networkingv1.PolicyTypeIngress {
+			for _, rule := range policy.Spec.Ingress {
+				if r.peersInclude(policy.Namespace, rule.From, peer) {
+					return true
+				}
+			}
+			continue
+		}
+		for _, rule := range policy.Spec.Egress {
+			if r.peersInclude(policy.Namespace, rule.To, peer) {
+				return true
+			}
+		}
+	}
+	return !isolated
+}
+
+// peersInclude reports whether the peers of a rule of a policy in namespace include a pod, a rule without peers
+// including every pod
+func (r *podReachability) peersInclude(namespace string, peers []networkingv1.NetworkPolicyPeer, pod map[string]interface{}) bool {
+	if len(peers) == 0 {
+		return true
+	}
+	metadata, _ := pod["metadata"].(map[string]interface{})
+	podNamespace := getNamespaceName(metadata)
+	for _, peer := range peers {
+		if peer.PodSelector == nil && peer.NamespaceSelector == nil {
+			continue
+		}
+		if peer.NamespaceSelector != nil {
+			if !selectorMatches(*peer.NamespaceSelector, r.namespaceLabels[podNamespace]) {
+				continue
+			}
+		} else if podNamespace != namespace {
+			continue
+		}
+		if peer.PodSelector != nil && !selectorMatches(*peer.PodSelector, resourceLabels(pod)) {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// hasPolicyType reports whether a policy restricts traffic of a type. Policies that don't list their types restrict
+// ingress, and egress if they have egress rules.
+func hasPolicyType(policy networkingv1.NetworkPolicy, policyType networkingv1.PolicyType) bool {
+	if len(policy.Spec.PolicyTypes) == 0 {
+		return policyType == networkingv1.PolicyTypeIngress || len(policy.Spec.Egress) > 0
+	}
+	for _, t := range policy.Spec.PolicyTypes {
+		if t == policyType {
+			return true
+		}
+	}
+	return false
+}
+
+// selectorMatches reports whether a label selector selects a set of labels, the empty selector selecting all of them
+func selectorMatches(selector metav1.LabelSelector, set labels.Set) bool {
+	s, err := metav1.LabelSelectorAsSelector(&selector)
+	if err != nil {
+		logDebug("Invalid label selector", "selector", selector, "error", err)
+		return false
+	}
+	return s.Matches(set)
+}
+
+func resourceLabels(resource map[string]interface{}) labels.Set {
+	metadata, _ := resource["metadata"].(map[string]interface{})
+	values, _ := metadata["labels"].(map[string]interface{})
+	set := make(labels.Set, len(values))
+	for key, value := range values {
+		set[key] = fmt.Sprint(value)
+	}
+	return set
+}
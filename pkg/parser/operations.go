@@ -0,0 +1,93 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// The rollout operations are the imperative verbs of kubectl rollout and kubectl scale, applied to the workloads
+// of the nodes a query matched:
+//
+//	RESTART d       sets the restartedAt annotation of the pod template, as kubectl rollout restart does
+//	SCALE d TO 5    sets the replicas of the scale subresource
+//	PAUSE d         pauses the rollout of a Deployment, or suspends a Job or CronJob
+//	RESUME d        resumes it
+//
+// Like SET, each operation is a merge patch of every resource of its nodes, recorded by the ledger and rolled out
+// in waves by APPLY.
+
+// restartedAtAnnotation is the annotation of pod templates kubectl rollout restart sets
+const restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+// pauseFields are the fields PAUSE and RESUME set in the spec of each kind
+var pauseFields = map[string]string{
+	"Deployment": "paused",
+	"Job":        "suspend",
+	"CronJob":    "suspend",
+}
+
+// operationTime is when RESTART restarts workloads, replaced by tests
+var operationTime = func() time.Time { return time.Now() }
+
+// executeOperation applies a rollout operation to the resources of its nodes
+func (q *QueryExecutor) executeOperation(c *OperationClause) error {
+	restartedAt := operationTime().UTC().Format(time.RFC3339)
+	for _, nodeId := range c.NodeIds {
+		if q.resultMap[nodeId] == nil {
+			return newDiagnosticError(CodeUnknownMutationNode, nil, "node", nodeId)
+		}
+		resources, _ := q.resultMap[nodeId].([]map[string]interface{})
+		for _, resource := range resources {
+			path, value, subresource, err := operationChange(c, resource, restartedAt)
+			if err != nil {
+				return err
+			}
+			patch := map[string]interface{}{}
+			updateResultMap(patch, path, value)
+			patchJSON, err := json.Marshal(patch)
+			if err != nil {
+				return newDiagnosticError(CodeInvalidPatch, err)
+			}
+			// The ledger identifies the change by the operation, a restart isn't repeated by a resumed run
+			change, _ := json.Marshal([]interface{}{c.Operation, c.Replicas})
+			if err := q.patchK8sResource(resource, types.MergePatchType, patchJSON, patchDigest(change), subresource...); err != nil {
+				if err := q.changeFailed(err); err != nil {
+					return fmt.Errorf("error patching resource: %w", err)
+				}
+				continue
+			}
+			updateResultMap(resource, path, value)
+		}
+	}
+	return nil
+}
+
+// operationChange is the field a rollout operation sets in a resource, and the subresource it's set through if
+// any
+func operationChange(c *OperationClause, resource map[string]interface{}, restartedAt string) (path []string, value interface{}, subresource []string, err error) {
+	kind, _ := resource["kind"].(string)
+	unsupported := func(reason string) error {
+		metadata, _ := resource["metadata"].(map[string]interface{})
+		return newDiagnosticError(CodeUnsupportedOperation, nil, "operation", c.Operation, "kind", kind, "name", metadata["name"], "reason", reason)
+	}
+	switch c.Operation {
+	case "restart":
+		spec, _ := resource["spec"].(map[string]interface{})
+		if _, ok := spec["template"].(map[string]interface{}); !ok {
+			return nil, nil, nil, unsupported("it has no pod template")
+		}
+		return []string{"spec", "template", "metadata", "annotations", restartedAtAnnotation}, restartedAt, nil, nil
+	case "scale":
+		return []string{"spec", "replicas"}, c.Replicas, []string{"scale"}, nil
+	case "pause", "resume":
+		field, ok := pauseFields[kind]
+		if !ok {
+			return nil, nil, nil, unsupported("only Deployments, Jobs and CronJobs can be paused")
+		}
+		return []string{"spec", field}, c.Operation == "pause", nil, nil
+	}
+	return nil, nil, nil, newDiagnosticError(CodeUnknownClause, nil, "clause", c.Operation)
+}
@@ -0,0 +1,116 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestParseOperations(t *testing.T) {
+	tests := []struct {
+		query     string
+		operation OperationClause
+	}{
+		{`MATCH (d:Deployment {app: "web"}) RESTART d`, OperationClause{Operation: "restart", NodeIds: []string{"d"}}},
+		{`MATCH (d:Deployment), (s:StatefulSet) WHERE d.metadata.name = "web" SCALE d, s TO 5 RETURN d.spec.replicas`, OperationClause{Operation: "scale", NodeIds: []string{"d", "s"}, Replicas: 5}},
+		{`MATCH (d:Deployment) PAUSE d`, OperationClause{Operation: "pause", NodeIds: []string{"d"}}},
+		{`MATCH (d:Deployment) RESUME d RETURN d.spec.paused`, OperationClause{Operation: "resume", NodeIds: []string{"d"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			expr, err := ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+			if operation := expr.Clauses[1].(*OperationClause); !reflect.DeepEqual(*operation, tt.operation) {
+				t.Errorf("expected %+v, got %+v", tt.operation, *operation)
+			}
+			if formatted := FormatQuery(expr); formatted != tt.query {
+				t.Errorf("expected %q, got %q", tt.query, formatted)
+			}
+		})
+	}
+
+	// APPLY rolls the operations out in waves
+	expr, err := ParseQuery(`APPLY BATCH 2 MATCH (d:Deployment) RESTART d WHILE MATCH (p:Pod) WHERE p.status.phase = "Pending" RETURN p`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	if operation, ok := expr.Clauses[1].(*OperationClause); !ok || expr.Apply == nil || operation.Operation != "restart" {
+		t.Errorf("expected the restart to be applied in batches, got %+v", expr)
+	}
+
+	// The operations are only keywords after the patterns of a query
+	expr, err = ParseQuery(`MATCH (scale:Deployment {name: "restart"}) RETURN scale.spec.replicas`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	if _, ok := expr.Clauses[1].(*ReturnClause); !ok {
+		t.Errorf("expected a RETURN clause, got %T", expr.Clauses[1])
+	}
+}
+
+// recordMergePatches records the merge patches of deployments, and the subresources they're made to
+func recordMergePatches(t *testing.T, q *QueryExecutor) *[]string {
+	var patches []string
+	q.DynamicClient.(*dynamicfake.FakeDynamicClient).PrependReactor("patch", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		if patch.GetPatchType() != types.MergePatchType {
+			t.Errorf("expected a merge patch, got %s", patch.GetPatchType())
+		}
+		patches = append(patches, patch.GetSubresource()+string(patch.GetPatch()))
+		if patch.GetSubresource() != "" {
+			// The fake client has no scale subresource
+			return true, newPatchTestDeployment(), nil
+		}
+		return false, nil, nil
+	})
+	return &patches
+}
+
+func TestOperations(t *testing.T) {
+	originalOperationTime := operationTime
+	defer func() { operationTime = originalOperationTime }()
+	operationTime = func() time.Time { return time.Date(2026, 10, 16, 9, 30, 0, 0, time.UTC) }
+
+	q := newTestQueryExecutor(t, newPatchTestDeployment())
+	patches := recordMergePatches(t, q)
+
+	result := executeTestQuery(t, q, `MATCH (d:Deployment) RESTART d RETURN d.spec.template.metadata.annotations`)
+	executeTestQuery(t, q, `MATCH (d:Deployment) SCALE d TO 0`)
+	executeTestQuery(t, q, `MATCH (d:Deployment) PAUSE d`)
+	executeTestQuery(t, q, `MATCH (d:Deployment) RESUME d`)
+
+	expected := []string{
+		`{"spec":{"template":{"metadata":{"annotations":{"kubectl.kubernetes.io/restartedAt":"2026-10-16T09:30:00Z"}}}}}`,
+		`scale{"spec":{"replicas":0}}`,
+		`{"spec":{"paused":true}}`,
+		`{"spec":{"paused":false}}`,
+	}
+	if !reflect.DeepEqual(*patches, expected) {
+		t.Errorf("expected patches %v, got %v", expected, *patches)
+	}
+	row := result.Data["d"].([]interface{})[0].(map[string]interface{})
+	annotations := row["spec"].(map[string]interface{})["template"].(map[string]interface{})["metadata"].(map[string]interface{})["annotations"]
+	if !reflect.DeepEqual(annotations, map[string]interface{}{restartedAtAnnotation: "2026-10-16T09:30:00Z"}) {
+		t.Errorf("expected the returned template to be restarted, got %v", annotations)
+	}
+}
+
+func TestUnsupportedOperation(t *testing.T) {
+	q := newTestQueryExecutor(t, newTestObject("v1", "Pod", "default", "web-1", nil))
+	for _, query := range []string{`MATCH (p:Pod) RESTART p`, `MATCH (p:Pod) PAUSE p`} {
+		ast, err := ParseQuery(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := q.Execute(ast, "default"); DiagnosticCodeOf(err) != CodeUnsupportedOperation {
+			t.Errorf("%s: expected code %s, got %v", query, CodeUnsupportedOperation, err)
+		}
+	}
+}
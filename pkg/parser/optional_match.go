@@ -0,0 +1,73 @@
+package parser
+
+// processBoundMatch matches the patterns of an OPTIONAL MATCH clause, or of a MATCH clause following WITH, against
+// the nodes bound by the clauses before it. The new nodes of the clause get the related resources, which may be
+// none. A MATCH keeps the resources of the bound nodes that have related resources, while an OPTIONAL MATCH never
+// filters the bound nodes: their resources are kept whether or not related resources are found.
+func (q *QueryExecutor) processBoundMatch(c *MatchClause, bound map[string]*NodePattern, results *QueryResult) error {
+	// Relationships are joined against the bound resources as they are, which are restored afterwards
+	filteredResults := make(map[string][]map[string]interface{})
+	boundResources := make(map[string]interface{})
+	unbound := []*NodePattern{}
+	for _, node := range c.Nodes {
+		name := node.ResourceProperties.Name
+		pattern, ok := bound[name]
+		if !ok {
+			unbound = append(unbound, node)
+			continue
+		}
+		// A bound node is usually referred to by its name alone, e.g. (d)
+		if node.ResourceProperties.Kind == "" {
+			node.ResourceProperties.Kind = pattern.ResourceProperties.Kind
+		}
+		resources, _ := q.resultMap[name].([]map[string]interface{})
+		filteredResults[name] = resources
+		boundResources[name] = q.resultMap[name]
+	}
+
+	clause := &MatchClause{Nodes: unbound, Relationships: c.Relationships, ExtraFilters: c.ExtraFilters}
+	for _, rel := range c.Relationships {
+		if _, err := q.processRelationship(rel, clause, results, filteredResults); err != nil {
+			return err
+		}
+	}
+	if err := q.processNodes(clause, results); err != nil {
+		return err
+	}
+	if err := q.bindRelationshipVariables(c); err != nil {
+		return err
+	}
+
+	if c.Optional {
+		for name, resources := range boundResources {
+			q.resultMap[name] = resources
+		}
+	}
+	// Nodes that matched nothing are still known, so that returning them gives no results rather than an error
+	for _, node := range unbound {
+		if q.resultMap[node.ResourceProperties.Name] == nil {
+			q.resultMap[node.ResourceProperties.Name] = []map[string]interface{}{}
+		}
+	}
+	return nil
+}
+
+// refersToBoundNodes reports whether a MATCH clause refers to nodes bound by the clauses before it
+func refersToBoundNodes(c *MatchClause, bound map[string]*NodePattern) bool {
+	for _, node := range c.Nodes {
+		if _, ok := bound[node.ResourceProperties.Name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// bindNodes records the patterns of matched nodes, for the OPTIONAL MATCH clauses and the clauses following WITH
+// to refer to them
+func bindNodes(bound map[string]*NodePattern, nodes []*NodePattern) {
+	for _, node := range nodes {
+		if _, ok := bound[node.ResourceProperties.Name]; !ok && node.ResourceProperties.Kind != "" {
+			bound[node.ResourceProperties.Name] = node
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseOptionalMatch(t *testing.T) {
+	expr, err := ParseQuery(`MATCH (d:Deployment) OPTIONAL MATCH (d)->(h:HorizontalPodAutoscaler) RETURN d.metadata.name, h.spec.maxReplicas`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	if len(expr.Clauses) != 3 {
+		t.Fatalf("expected 3 clauses, got %d", len(expr.Clauses))
+	}
+	if expr.Clauses[0].(*MatchClause).Optional {
+		t.Errorf("expected the first MATCH not to be optional")
+	}
+	optional := expr.Clauses[1].(*MatchClause)
+	if !optional.Optional || len(optional.Nodes) != 2 || len(optional.Relationships) != 1 {
+		t.Errorf("unexpected OPTIONAL MATCH clause %+v", optional)
+	}
+	if optional.Nodes[0].ResourceProperties.Name != "d" || optional.Nodes[0].ResourceProperties.Kind != "" {
+		t.Errorf("expected the bound node to be referred to by name, got %+v", optional.Nodes[0].ResourceProperties)
+	}
+}
+
+func TestOptionalMatchKeepsBoundNodes(t *testing.T) {
+	q := newTestQueryExecutor(t,
+		newTestObject("apps/v1", "Deployment", "default", "web", nil),
+		newTestObject("apps/v1", "Deployment", "default", "worker", map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "worker", "namespace": "default", "labels": map[string]interface{}{"app": "worker"}},
+		}),
+		newTestObject("autoscaling/v2", "HorizontalPodAutoscaler", "default", "web-hpa", map[string]interface{}{
+			"spec": map[string]interface{}{
+				"maxReplicas":    int64(5),
+				"scaleTargetRef": map[string]interface{}{"name": "web"},
+			},
+		}),
+	)
+
+	result := executeTestQuery(t, q, `MATCH (d:Deployment) OPTIONAL MATCH (d)->(h:HorizontalPodAutoscaler) RETURN d.metadata.name, h.spec.maxReplicas`)
+	if got := len(result.Data["d"].([]interface{})); got != 2 {
+		t.Errorf("expected both deployments to be kept, got %d", got)
+	}
+	expected := []interface{}{map[string]interface{}{"name": "web-hpa", "spec": map[string]interface{}{"maxReplicas": int64(5)}}}
+	if !reflect.DeepEqual(result.Data["h"], expected) {
+		t.Errorf("expected the autoscaler of web, got %v", result.Data["h"])
+	}
+
+	// A MATCH drops the deployment without an autoscaler
+	result = executeTestQuery(t, q, `MATCH (d:Deployment)->(h:HorizontalPodAutoscaler) RETURN d.metadata.name`)
+	if got := len(result.Data["d"].([]interface{})); got != 1 {
+		t.Errorf("expected MATCH to keep 1 deployment, got %d", got)
+	}
+
+	// Nothing matching the optional pattern isn't an error
+	result = executeTestQuery(t, q, `MATCH (d:Deployment {app: "worker"}) OPTIONAL MATCH (d)->(h:HorizontalPodAutoscaler) RETURN d.metadata.name, h.spec.maxReplicas`)
+	if got := len(result.Data["d"].([]interface{})); got != 1 {
+		t.Errorf("expected the worker deployment, got %d", got)
+	}
+	if !reflect.DeepEqual(result.Data["h"], []interface{}{}) {
+		t.Errorf("expected no autoscalers, got %v", result.Data["h"])
+	}
+}
@@ -0,0 +1,102 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestParseOrderBy(t *testing.T) {
+	expr, err := ParseQuery(`MATCH (p:Pod) RETURN p.metadata.name AS name ORDER BY p.status.startTime DESC, p.metadata.name ASC`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	expected := &ReturnClause{
+		Items:   []*ReturnItem{{JsonPath: "p.metadata.name", Alias: "name"}},
+		OrderBy: []*OrderItem{{JsonPath: "p.status.startTime", Descending: true}, {JsonPath: "p.metadata.name"}},
+	}
+	if !reflect.DeepEqual(expr.Clauses[1], expected) {
+		t.Errorf("unexpected RETURN clause %+v", expr.Clauses[1])
+	}
+
+	// Fields may still be called order
+	expr, err = ParseQuery(`MATCH (p:Pod) RETURN p.spec.order, p.metadata.name AS order`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	if c := expr.Clauses[1].(*ReturnClause); len(c.OrderBy) != 0 || len(c.Items) != 2 {
+		t.Errorf("unexpected RETURN clause %+v", c)
+	}
+
+	for _, query := range []string{
+		`MATCH (p:Pod) RETURN p ORDER BY`,
+		`MATCH (p:Pod) RETURN p ORDER BY p.metadata.name AS name`,
+		`MATCH (p:Pod) RETURN p ORDER BY COUNT{p}`,
+	} {
+		if _, err := ParseQuery(query); err == nil {
+			t.Errorf("ParseQuery(%q) expected an error", query)
+		}
+	}
+}
+
+func TestReturnOrderBy(t *testing.T) {
+	pod := func(name string, restarts int64, started string) runtime.Object {
+		status := map[string]interface{}{"containerStatuses": []interface{}{map[string]interface{}{"restartCount": restarts}}}
+		if started != "" {
+			status["startTime"] = started
+		}
+		return newTestObject("v1", "Pod", "default", name, map[string]interface{}{"status": status})
+	}
+	q := newTestQueryExecutor(t,
+		pod("web-1", 3, "2024-05-01T10:00:00Z"),
+		pod("web-2", 12, "2024-04-30T08:00:00Z"),
+		pod("web-3", 3, "2024-05-02T09:00:00Z"),
+		pod("pending", 0, ""),
+	)
+	names := func(result QueryResult) []string {
+		names := []string{}
+		for _, row := range result.Data["p"].([]interface{}) {
+			names = append(names, row.(map[string]interface{})["name"].(string))
+		}
+		return names
+	}
+
+	// Timestamps sort chronologically, missing values last
+	result := executeTestQuery(t, q, `MATCH (p:Pod) RETURN p.status.startTime ORDER BY p.status.startTime`)
+	if got, want := names(result), []string{"web-2", "web-1", "web-3", "pending"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the pods by start time, got %v", got)
+	}
+
+	// Numbers sort by value, ties by the next item
+	result = executeTestQuery(t, q, `MATCH (p:Pod) RETURN p.metadata.name ORDER BY p.status.containerStatuses[0].restartCount DESC, p.status.startTime DESC`)
+	if got, want := names(result), []string{"web-2", "web-3", "web-1", "pending"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the pods by restarts, got %v", got)
+	}
+
+	// Aggregates are unaffected
+	result = executeTestQuery(t, q, `MATCH (p:Pod) RETURN COUNT{p} AS pods ORDER BY p.metadata.name`)
+	if pods := result.Data["aggregate"].(map[string]interface{})["pods"]; pods != 4 {
+		t.Errorf("expected 4 pods, got %v", pods)
+	}
+
+	ast, err := ParseQuery(`MATCH (p:Pod) RETURN p.metadata.name ORDER BY d.metadata.name`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	if _, err := q.Execute(ast, "default"); DiagnosticCodeOf(err) != CodeUnknownReturnNode {
+		t.Errorf("expected %s for a node RETURN doesn't return, got %v", CodeUnknownReturnNode, err)
+	}
+}
+
+func TestCompareOrderValues(t *testing.T) {
+	ordered := []interface{}{float64(-1), int64(2), 2.5, "", "a", "b", false, true, map[string]interface{}{"a": 1}, nil}
+	for i := range ordered {
+		for j := range ordered {
+			c := compareOrderValues(ordered[i], ordered[j])
+			if (i < j && c >= 0) || (i > j && c <= 0) || (i == j && c != 0) {
+				t.Errorf("compareOrderValues(%v, %v) = %d", ordered[i], ordered[j], c)
+			}
+		}
+	}
+}
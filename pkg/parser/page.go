@@ -0,0 +1,137 @@
+package parser
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+// PageOptions bound the rows of a query run with ExecutePage
+type PageOptions struct {
+	// MaxRows, if positive, is the number of rows after which the query stops
+	MaxRows int
+	// Continue is the Continue token of a result the same query returned before, to resume it from
+	Continue string
+}
+
+// continueTokenVersion is the version of the continue tokens ExecutePage returns
+const continueTokenVersion = 1
+
+// continueToken is the content of a Continue token: the cursor a query stopped at, and the query and namespace it
+// belongs to, as a LedgerKey
+type continueToken struct {
+	Version int    `json:"v"`
+	Query   string `json:"q"`
+	pageCursor
+}
+
+// ExecutePage runs a query like ExecuteContext, but stops once it returned MaxRows rows. Queries whose rows can be
+// streamed, those matching a single node without relationships, aggregations, DISTINCT or ORDER BY, are listed
+// one API page at a time. When one stops early, because of MaxRows or because ctx is done, its result is Truncated
+// and holds the rows returned so far and a Continue token: running the same query in the same namespace with that
+// token returns the rows after them. A resource listed through several kinds of the query, e.g. of a wildcard, may
+// be returned again by a resumed query. Other queries are evaluated as a whole, their rows cut to MaxRows, and can't
+// be resumed.
+func (q *QueryExecutor) ExecutePage(ctx context.Context, ast *Expression, namespace string, options PageOptions) (QueryResult, error) {
+	match, returnClause, ok := streamablePattern(ast)
+	if !ok {
+		if options.Continue != "" {
+			return QueryResult{}, newDiagnosticError(CodeInvalidContinue, nil, "reason", "only queries whose rows can be streamed can be resumed")
+		}
+		result, err := q.ExecuteContext(ctx, ast, namespace)
+		if options.MaxRows > 0 {
+			limitRows(&result, options.MaxRows)
+		}
+		return result, err
+	}
+
+	if err := q.preflight(ctx, ast, namespace, false); err != nil {
+		return QueryResult{}, err
+	}
+	q.prepareQuery(namespace)
+	defer q.clearQueryState()
+	key := LedgerKey(FormatQuery(ast), q.namespace)
+	from, err := decodeContinueToken(options.Continue, key)
+	if err != nil {
+		return QueryResult{}, err
+	}
+
+	nodeId := match.Nodes[0].ResourceProperties.Name
+	result := QueryResult{Data: map[string]interface{}{}, Graph: Graph{Nodes: []Node{}, Edges: []Edge{}}}
+	rows := []interface{}{}
+	// Pages end where the rows run out, so that a stopped query resumes right after its last row
+	pageSize := func() int64 {
+		if remaining := int64(options.MaxRows - len(rows)); options.MaxRows > 0 && remaining < StreamPageSize {
+			return remaining
+		}
+		return StreamPageSize
+	}
+	cursor, err := q.listPages(ctx, match, returnClause, from, pageSize, func(page *QueryResult) (bool, error) {
+		rows = append(rows, page.Data[nodeId].([]interface{})...)
+		result.Rows = append(result.Rows, page.Rows...)
+		result.Graph.Nodes = append(result.Graph.Nodes, page.Graph.Nodes...)
+		result.Hidden += page.Hidden
+		return options.MaxRows <= 0 || len(rows) < options.MaxRows, nil
+	})
+	result.Data[nodeId] = rows
+	if q.Rows && result.Rows == nil {
+		result.Rows = []map[string]interface{}{}
+	}
+	if err != nil && ctx.Err() == nil {
+		return result, err
+	}
+	if cursor != nil {
+		result.Truncated = true
+		result.Continue = encodeContinueToken(continueToken{Version: continueTokenVersion, Query: key, pageCursor: *cursor})
+	}
+	if err != nil {
+		result.Truncated = true
+		if errors.Is(err, context.DeadlineExceeded) {
+			return result, timedOutError(err, match, nil)
+		}
+		return result, interruptedError(err, nil)
+	}
+	return result, nil
+}
+
+// limitRows cuts the rows of each node of a result, and its Rows, to max
+func limitRows(result *QueryResult, max int) {
+	for nodeId, data := range result.Data {
+		if rows, ok := data.([]interface{}); ok && len(rows) > max {
+			result.Data[nodeId] = rows[:max]
+			result.Truncated = true
+		}
+	}
+	if len(result.Rows) > max {
+		result.Rows = result.Rows[:max]
+		result.Truncated = true
+	}
+}
+
+func encodeContinueToken(token continueToken) string {
+	data, _ := json.Marshal(token)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeContinueToken returns the cursor of a Continue token, which must have been returned by the query of key.
+// The cursor of an empty token is the start of the query.
+func decodeContinueToken(encoded, key string) (pageCursor, error) {
+	if encoded == "" {
+		return pageCursor{}, nil
+	}
+	var token continueToken
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err == nil {
+		err = json.Unmarshal(data, &token)
+	}
+	switch {
+	case err != nil:
+		return pageCursor{}, newDiagnosticError(CodeInvalidContinue, err, "reason", "it isn't a token cyphernetes returned")
+	case token.Version != continueTokenVersion:
+		return pageCursor{}, newDiagnosticError(CodeInvalidContinue, nil, "reason", "it was returned by another version of cyphernetes")
+	case token.Query != key:
+		return pageCursor{}, newDiagnosticError(CodeInvalidContinue, nil, "reason", "it was returned by another query or namespace")
+	}
+	return token.pageCursor, nil
+}
@@ -0,0 +1,217 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// pagedPods is a client listing the given pods page by page as the API server does, honoring the limit and
+// continue token of each call, which is the offset of the page. The fake client ignores both.
+type pagedPods struct {
+	dynamic.Interface
+	names []string
+	// limits are the limits asked by the list calls
+	limits []int64
+}
+
+type pagedPodsResource struct {
+	dynamic.NamespaceableResourceInterface
+	pods *pagedPods
+}
+
+func limitPods(q *QueryExecutor, names ...string) *pagedPods {
+	pods := &pagedPods{Interface: q.DynamicClient, names: names}
+	q.DynamicClient = pods
+	return pods
+}
+
+func (c *pagedPods) Resource(gvr schema.GroupVersionResource) dynamic.NamespaceableResourceInterface {
+	if gvr.Resource != "pods" {
+		return c.Interface.Resource(gvr)
+	}
+	return pagedPodsResource{c.Interface.Resource(gvr), c}
+}
+
+func (r pagedPodsResource) Namespace(string) dynamic.ResourceInterface {
+	return r
+}
+
+func (r pagedPodsResource) List(ctx context.Context, options metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	r.pods.limits = append(r.pods.limits, options.Limit)
+	if options.Continue == "expired" {
+		return nil, apierrors.NewResourceExpired("continue token expired")
+	}
+	offset, _ := strconv.Atoi(options.Continue)
+	end := min(offset+int(options.Limit), len(r.pods.names))
+	list := &unstructured.UnstructuredList{Object: map[string]interface{}{"apiVersion": "v1", "kind": "PodList"}}
+	for _, name := range r.pods.names[offset:end] {
+		list.Items = append(list.Items, *newTestObject("v1", "Pod", "default", name, nil))
+	}
+	if end < len(r.pods.names) {
+		list.SetContinue(strconv.Itoa(end))
+	}
+	return list, nil
+}
+
+func rowNames(t *testing.T, result QueryResult, nodeId string) []string {
+	t.Helper()
+	names := []string{}
+	for _, row := range result.Data[nodeId].([]interface{}) {
+		names = append(names, row.(map[string]interface{})["name"].(string))
+	}
+	return names
+}
+
+func TestExecutePageContinue(t *testing.T) {
+	q := newTestQueryExecutor(t)
+	pods := limitPods(q, "web-1", "web-2", "web-3", "web-4", "web-5")
+	ast, err := ParseQuery("MATCH (p:Pod) RETURN p.metadata.namespace")
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+
+	var pages [][]string
+	options := PageOptions{MaxRows: 2}
+	for i := 0; i < 3; i++ {
+		result, err := q.ExecutePage(context.Background(), ast, "default", options)
+		if err != nil {
+			t.Fatalf("ExecutePage() error = %v", err)
+		}
+		pages = append(pages, rowNames(t, result, "p"))
+		if result.Truncated != (result.Continue != "") {
+			t.Errorf("expected truncated results to have a continue token, got %+v", result)
+		}
+		if len(result.Graph.Nodes) != len(pages[i]) {
+			t.Errorf("expected a graph node per row, got %v", result.Graph.Nodes)
+		}
+		options.Continue = result.Continue
+	}
+	expected := [][]string{{"web-1", "web-2"}, {"web-3", "web-4"}, {"web-5"}}
+	if !reflect.DeepEqual(pages, expected) {
+		t.Errorf("expected pages %v, got %v", expected, pages)
+	}
+	if options.Continue != "" {
+		t.Errorf("expected no continue token once all rows were returned")
+	}
+	if !reflect.DeepEqual(pods.limits, []int64{2, 2, 2}) {
+		t.Errorf("expected pages of the remaining rows, got limits %v", pods.limits)
+	}
+}
+
+func TestExecutePageInvalidContinue(t *testing.T) {
+	q := newTestQueryExecutor(t)
+	limitPods(q, "web-1", "web-2")
+	ast, err := ParseQuery("MATCH (p:Pod) RETURN p")
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	result, err := q.ExecutePage(context.Background(), ast, "default", PageOptions{MaxRows: 1})
+	if err != nil || result.Continue == "" {
+		t.Fatalf("ExecutePage() = %+v, %v", result, err)
+	}
+
+	other, err := ParseQuery("MATCH (p:Pod) RETURN p.metadata.name")
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	ordered, err := ParseQuery("MATCH (p:Pod) RETURN p ORDER BY p.metadata.name")
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	for _, tt := range []struct {
+		name      string
+		ast       *Expression
+		namespace string
+		token     string
+	}{
+		{"another query", other, "default", result.Continue},
+		{"another namespace", ast, "kube-system", result.Continue},
+		{"not a token", ast, "default", "page-2"},
+		{"query that can't be resumed", ordered, "default", result.Continue},
+	} {
+		_, err := q.ExecutePage(context.Background(), tt.ast, tt.namespace, PageOptions{Continue: tt.token})
+		if DiagnosticCodeOf(err) != CodeInvalidContinue {
+			t.Errorf("%s: expected %s, got %v", tt.name, CodeInvalidContinue, err)
+		}
+	}
+
+	expired := encodeContinueToken(continueToken{Version: continueTokenVersion, Query: LedgerKey(FormatQuery(ast), "default"), pageCursor: pageCursor{Continue: "expired"}})
+	if _, err := q.ExecutePage(context.Background(), ast, "default", PageOptions{Continue: expired}); DiagnosticCodeOf(err) != CodeContinueExpired {
+		t.Errorf("expected %s, got %v", CodeContinueExpired, err)
+	}
+}
+
+func TestExecutePageInterrupted(t *testing.T) {
+	q := newTestQueryExecutor(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	calls := 0
+	q.DynamicClient.(*dynamicfake.FakeDynamicClient).PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		calls++
+		if calls > 1 {
+			cancel()
+			return true, nil, ctx.Err()
+		}
+		list := &unstructured.UnstructuredList{Object: map[string]interface{}{"apiVersion": "v1", "kind": "PodList"}}
+		list.Items = append(list.Items, *newTestObject("v1", "Pod", "default", "web-1", nil))
+		list.SetContinue("page-2")
+		return true, list, nil
+	})
+	ast, err := ParseQuery("MATCH (p:Pod) RETURN p.metadata.namespace")
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+
+	result, err := q.ExecutePage(ctx, ast, "default", PageOptions{})
+	if !errors.Is(err, ErrInterrupted) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected an interrupted error, got %v", err)
+	}
+	if !result.Truncated || !reflect.DeepEqual(rowNames(t, result, "p"), []string{"web-1"}) {
+		t.Errorf("expected the rows of the first page, got %+v", result)
+	}
+	cursor, err := decodeContinueToken(result.Continue, LedgerKey(FormatQuery(ast), "default"))
+	if err != nil || cursor != (pageCursor{Continue: "page-2"}) {
+		t.Errorf("expected to resume from the second page, got %+v, %v", cursor, err)
+	}
+}
+
+func TestExecutePageMaxRows(t *testing.T) {
+	var objects []runtime.Object
+	for i := 1; i <= 3; i++ {
+		objects = append(objects, newTestObject("v1", "Pod", "default", fmt.Sprintf("web-%d", i), nil))
+	}
+	q := newTestQueryExecutor(t, objects...)
+	ast, err := ParseQuery("MATCH (p:Pod) RETURN p.metadata.name ORDER BY p.metadata.name DESC")
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+
+	result, err := q.ExecutePage(context.Background(), ast, "default", PageOptions{MaxRows: 2})
+	if err != nil {
+		t.Fatalf("ExecutePage() error = %v", err)
+	}
+	if !result.Truncated || result.Continue != "" {
+		t.Errorf("expected truncated results that can't be resumed, got %+v", result)
+	}
+	if names := rowNames(t, result, "p"); !reflect.DeepEqual(names, []string{"web-3", "web-2"}) {
+		t.Errorf("expected the first 2 rows, got %v", names)
+	}
+
+	result, err = q.ExecutePage(context.Background(), ast, "default", PageOptions{MaxRows: 3})
+	if err != nil || result.Truncated {
+		t.Errorf("expected complete results, got %+v, %v", result, err)
+	}
+}
@@ -2,18 +2,46 @@ package parser
 
 import (
 	"fmt"
-	"log"
+	"strings"
+	"sync"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	schema "k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
 )
 
 var Namespace string
-var LogLevel string
 var AllNamespaces bool
 var CleanOutput bool
 
+// ReadOnly rejects queries that would change resources when they're parsed, so that Cyphernetes can be shared
+// for exploring clusters only
+var ReadOnly bool
+
 type Expression struct {
 	Clauses []Clause
+	// Explain is set for EXPLAIN queries, which report the query plan instead of running it
+	Explain bool
+	// Apply is set for APPLY queries, whose changes are made in batches for as long as a condition holds
+	Apply *Apply
+	// Union is set when the rows of further queries are added to those of this one by UNION
+	Union *Union
+	// Version is the language version the query declares with a CYPHERNETES pragma, 0 if it declares none
+	Version int
+}
+
+// Apply is the batching of an APPLY query: its WHILE query runs before each batch of BatchSize changes,
+// and the query stops making changes once the WHILE query returns no resources
+type Apply struct {
+	BatchSize int
+	While     *Expression
+}
+
+// Union holds the queries whose results UNION adds to those of the first query. The rows of each node identifier
+// are combined, and rows repeating an earlier row are dropped unless All is set, for UNION ALL.
+type Union struct {
+	All     bool
+	Queries []*Expression
 }
 
 func (e *Expression) String() string {
@@ -28,20 +56,39 @@ type MatchClause struct {
 	Nodes         []*NodePattern
 	Relationships []*Relationship
 	ExtraFilters  []*KeyValuePair
+	// Optional is set for OPTIONAL MATCH, which keeps the nodes matched before it whether or not its patterns match
+	Optional bool
 }
 
 type SetClause struct {
 	KeyValuePairs []*KeyValuePair
+	// PatchType is the patch the values are set with, json, merge or strategic, PatchType if empty
+	PatchType string
+	// Status sets the values through the status subresource, for SET STATUS
+	Status bool
 }
 
 type DeleteClause struct {
 	NodeIds []string
 }
 
+// OperationClause is a rollout operation on the workloads of nodes: RESTART, SCALE, PAUSE or RESUME
+type OperationClause struct {
+	// Operation is restart, scale, pause or resume
+	Operation string
+	NodeIds   []string
+	// Replicas is the number of replicas SCALE scales to
+	Replicas int
+}
+
 type KeyValuePair struct {
 	Key      string
 	Value    interface{}
 	Operator string
+	// Function, if set, is a function of the value at Key that is compared instead, e.g. TOLOWER, with Args its
+	// other arguments
+	Function string
+	Args     []*FunctionArg
 }
 
 type CreateClause struct {
@@ -49,11 +96,31 @@ type CreateClause struct {
 	Relationships []*Relationship
 }
 
+// MergeClause matches the node's resources, or creates the resource if none matches
+type MergeClause struct {
+	Node *NodePattern
+}
+
 type Relationship struct {
 	ResourceProperties *ResourceProperties
 	Direction          Direction
 	LeftNode           *NodePattern
 	RightNode          *NodePattern
+	// Hops is set for variable-length relationships, e.g. -[*1..3]->, which go through intermediate kinds
+	Hops *Hops
+}
+
+// Hops is the number of relationships a variable-length relationship spans, from Min to Max
+type Hops struct {
+	Min int
+	Max int
+}
+
+func (h *Hops) String() string {
+	if h.Min == h.Max {
+		return fmt.Sprintf("*%d", h.Min)
+	}
+	return fmt.Sprintf("*%d..%d", h.Min, h.Max)
 }
 
 type NodeRelationshipList struct {
@@ -72,12 +139,56 @@ const (
 
 type ReturnClause struct {
 	Items []*ReturnItem
+	// Distinct drops the rows of a node that repeat an earlier row
+	Distinct bool
+	// OrderBy sorts the rows of the nodes its items name, by the first item then the next ones
+	OrderBy []*OrderItem
+}
+
+// OrderItem sorts the rows of a node by the value at JsonPath, which starts with the node's name
+type OrderItem struct {
+	JsonPath   string
+	Descending bool
+}
+
+// UnwindClause expands the list at JsonPath into rows, one per element, which is named Alias
+type UnwindClause struct {
+	JsonPath string
+	Alias    string
+}
+
+// WithClause passes matched nodes, or rows of values grouped by its items, on to the clauses that follow
+type WithClause struct {
+	Items        []*ReturnItem
+	ExtraFilters []*KeyValuePair
 }
 
 type ReturnItem struct {
 	JsonPath  string
 	Alias     string
 	Aggregate string
+	Function  string
+	// Args are the arguments of Function after JsonPath, e.g. "-" in split(p.spec.nodeName, "-")
+	Args []*FunctionArg
+}
+
+// FunctionArg is an argument of a function call after the first: a JSONPath or a literal value
+type FunctionArg struct {
+	JsonPath string
+	Value    interface{}
+}
+
+// TemporalExpression is the sum of calls of now(), datetime() and duration() compared by a WHERE filter, e.g.
+// now() - duration("24h"). It's computed when the filter is evaluated.
+type TemporalExpression struct {
+	Terms []*TemporalTerm
+}
+
+// TemporalTerm is a call in a TemporalExpression, Negative if it's subtracted
+type TemporalTerm struct {
+	Function string
+	Arg      string
+	Negative bool
 }
 
 type NodePattern struct {
@@ -97,8 +208,10 @@ type Properties struct {
 
 type Property struct {
 	Key string
-	// Value is string int or bool
+	// Value is string int or bool, or a list of those for IN and NOT_IN
 	Value interface{}
+	// Operator is empty for equality, or one of IN, NOT_IN, EXISTS, NOT_EXISTS
+	Operator string
 }
 
 type JSONPathValueList struct {
@@ -110,41 +223,108 @@ type JSONPathValue struct {
 }
 
 // Implement isClause for all Clause types
-func (m *MatchClause) isClause()  {}
-func (s *SetClause) isClause()    {}
-func (d *DeleteClause) isClause() {}
-func (r *ReturnClause) isClause() {}
-func (c *CreateClause) isClause() {}
+func (m *MatchClause) isClause()     {}
+func (s *SetClause) isClause()       {}
+func (d *DeleteClause) isClause()    {}
+func (o *OperationClause) isClause() {}
+func (r *ReturnClause) isClause()    {}
+func (c *CreateClause) isClause()    {}
+func (m *MergeClause) isClause()     {}
+func (w *WithClause) isClause()      {}
+func (u *UnwindClause) isClause()    {}
 
 var result *Expression
 
+// parseMutex serializes parsing, the parser keeps the expression it builds in result
+var parseMutex sync.Mutex
+
 func ParseQuery(query string) (*Expression, error) {
+	parseMutex.Lock()
+	defer parseMutex.Unlock()
+	stripped, unclosed := stripComments(query)
+	if unclosed >= 0 {
+		lexer := NewLexer(query)
+		lexer.errorAt(unclosed, "syntax error")
+		return nil, newParseError(lexer)
+	}
+	version, query, declared := cutVersionPragma(stripped)
+	if declared && (version < 1 || version > languageVersion) {
+		return nil, newDiagnosticError(CodeUnsupportedVersion, nil, "version", version, "latest", languageVersion)
+	}
 	lexer := NewLexer(query)
 	if yyParse(lexer) != 0 {
-		return nil, fmt.Errorf("parsing failed")
+		return nil, newParseError(lexer)
+	}
+	result.Version = version
+	if err := checkLanguageVersion(result); err != nil {
+		return nil, err
+	}
+	if err := checkReadOnly(result); err != nil {
+		return nil, err
 	}
 
 	return result, nil
 }
 
-func logDebug(v ...interface{}) {
-	if LogLevel == "debug" {
-		log.Println(v...)
+// CheckSyntax returns the syntax error of a query, if it has one. Unlike that of ParseQuery, the error has the position
+// and the token the parser failed at but not the tokens expected there, which take a parse each to find, so that it's
+// cheap enough to check queries as they're typed.
+func CheckSyntax(query string) *ParseError {
+	parseMutex.Lock()
+	defer parseMutex.Unlock()
+	stripped, unclosed := stripComments(query)
+	if unclosed >= 0 {
+		lexer := NewLexer(query)
+		lexer.errorAt(unclosed, "syntax error")
+		return syntaxError(lexer)
+	}
+	_, query, _ = cutVersionPragma(stripped)
+	lexer := NewLexer(query)
+	if yyParse(lexer) != 0 {
+		return syntaxError(lexer)
 	}
+	return nil
+}
+
+// SetReadOnly turns read-only mode on or off, e.g. when the web server's configuration is reloaded
+func SetReadOnly(readOnly bool) {
+	parseMutex.Lock()
+	defer parseMutex.Unlock()
+	ReadOnly = readOnly
+}
+
+// checkReadOnly rejects the clauses that change resources in read-only mode, those of the queries UNION adds
+// too. EXPLAIN queries don't run, they're allowed.
+func checkReadOnly(e *Expression) error {
+	if !ReadOnly || e.Explain {
+		return nil
+	}
+	for _, clause := range e.Clauses {
+		switch clause.(type) {
+		case *CreateClause, *SetClause, *DeleteClause, *MergeClause, *OperationClause:
+			return newDiagnosticError(CodeReadOnly, nil, "clause", strings.ToUpper(clauseName(clause)))
+		}
+	}
+	if e.Union != nil {
+		for _, query := range e.Union.Queries {
+			if err := checkReadOnly(query); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
 func ClearCache() {
 	GvrCacheMutex.Lock()
 	GvrCache = make(map[string]schema.GroupVersionResource)
-	GvrCacheMutex.Unlock()
-
 	apiResourceListCache = nil
-
-	// Clear the resultCache
-	resultCache = make(map[string]interface{})
+	GvrCacheMutex.Unlock()
 }
 
 func PrintCache() {
+	GvrCacheMutex.RLock()
+	defer GvrCacheMutex.RUnlock()
 	fmt.Println("GVR Cache:")
 	for k, v := range GvrCache {
 		fmt.Printf("%s: %s\n", k, v)
@@ -153,12 +333,48 @@ func PrintCache() {
 	for _, v := range apiResourceListCache {
 		fmt.Printf("%s\n", v)
 	}
-	fmt.Println("Result Cache:")
-	for k, v := range resultCache {
-		fmt.Printf("%s: %s\n", k, v)
+}
+
+// ClusterState holds everything learned about one cluster: the discovery client, the
+// resolved GVRs and the OpenAPI resource specs. The shell swaps it when switching between
+// sessions bound to different clusters.
+type ClusterState struct {
+	discoveryClient discovery.CachedDiscoveryInterface
+	gvrCache        map[string]schema.GroupVersionResource
+	apiResourceList []*metav1.APIResourceList
+	resourceSpecs   map[string][]string
+}
+
+// SaveClusterState returns the state of the cluster currently being queried
+func SaveClusterState() ClusterState {
+	cachedDiscoveryMutex.Lock()
+	discoveryClient := cachedDiscoveryClient
+	cachedDiscoveryMutex.Unlock()
+
+	GvrCacheMutex.RLock()
+	defer GvrCacheMutex.RUnlock()
+	return ClusterState{
+		discoveryClient: discoveryClient,
+		gvrCache:        GvrCache,
+		apiResourceList: apiResourceListCache,
+		resourceSpecs:   ResourceSpecs,
 	}
-	fmt.Println("Result Map:")
-	for k, v := range resultMap {
-		fmt.Printf("%s: %s\n", k, v)
+}
+
+// RestoreClusterState makes a previously saved state current. The zero value starts from scratch.
+func RestoreClusterState(state ClusterState) {
+	setDiscoveryClient(state.discoveryClient)
+
+	GvrCacheMutex.Lock()
+	GvrCache = state.gvrCache
+	if GvrCache == nil {
+		GvrCache = make(map[string]schema.GroupVersionResource)
+	}
+	apiResourceListCache = state.apiResourceList
+	GvrCacheMutex.Unlock()
+
+	ResourceSpecs = state.resourceSpecs
+	if ResourceSpecs == nil {
+		ResourceSpecs = make(map[string][]string)
 	}
 }
@@ -3,6 +3,7 @@ package parser
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
 	"testing"
@@ -127,6 +128,87 @@ func TestParseQueryWithReturnAndAlias(t *testing.T) {
 	}
 }
 
+func TestParseExplainQuery(t *testing.T) {
+	query := `EXPLAIN MATCH (explain:Pod) RETURN explain.metadata.name`
+
+	expected := &Expression{
+		Clauses: []Clause{
+			&MatchClause{
+				Nodes: []*NodePattern{
+					{
+						ResourceProperties: &ResourceProperties{
+							Name: "explain",
+							Kind: "Pod",
+						},
+					},
+				},
+				Relationships: []*Relationship{},
+				ExtraFilters:  nil,
+			},
+			&ReturnClause{
+				Items: []*ReturnItem{
+					{JsonPath: "explain.metadata.name"},
+				},
+			},
+		},
+		Explain: true,
+	}
+
+	expr, err := ParseQuery(query)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(expr, expected) {
+		exprJson, _ := json.Marshal(expr)
+		expectedJson, _ := json.Marshal(expected)
+		fmt.Printf("expr: %+v\n", string(exprJson))
+		fmt.Printf("expected: %+v\n", string(expectedJson))
+		t.Errorf("ParseQuery() = %v, want %v", expr, expected)
+	}
+}
+
+func TestParseQueryWithReturnFunction(t *testing.T) {
+	query := `MATCH (p:Pod) RETURN id(p), id(p) AS podId, p.metadata.name`
+
+	expected := &Expression{
+		Clauses: []Clause{
+			&MatchClause{
+				Nodes: []*NodePattern{
+					{
+						ResourceProperties: &ResourceProperties{
+							Name: "p",
+							Kind: "Pod",
+						},
+					},
+				},
+				Relationships: []*Relationship{},
+				ExtraFilters:  nil,
+			},
+			&ReturnClause{
+				Items: []*ReturnItem{
+					{JsonPath: "p", Function: "ID"},
+					{JsonPath: "p", Function: "ID", Alias: "podId"},
+					{JsonPath: "p.metadata.name"},
+				},
+			},
+		},
+	}
+
+	expr, err := ParseQuery(query)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(expr, expected) {
+		exprJson, _ := json.Marshal(expr)
+		expectedJson, _ := json.Marshal(expected)
+		fmt.Printf("expr: %+v\n", string(exprJson))
+		fmt.Printf("expected: %+v\n", string(expectedJson))
+		t.Errorf("ParseQuery() = %v, want %v", expr, expected)
+	}
+}
+
 func TestSingleNodePattern(t *testing.T) {
 	query := `MATCH (n:Node) RETURN n`
 	// Expected AST structure...
@@ -168,6 +250,54 @@ func TestSingleNodePattern(t *testing.T) {
 	}
 }
 
+func TestNodePatternWithSetBasedSelectors(t *testing.T) {
+	query := `MATCH (p:Pod {app IN ["web", "api"], env NOT IN ["dev"], tier EXISTS, canary NOT EXISTS, team: "a"}) RETURN p`
+
+	expected := &Expression{
+		Clauses: []Clause{
+			&MatchClause{
+				Nodes: []*NodePattern{
+					{
+						ResourceProperties: &ResourceProperties{
+							Name: "p",
+							Kind: "Pod",
+							Properties: &Properties{
+								PropertyList: []*Property{
+									{Key: "app", Value: []interface{}{"web", "api"}, Operator: "IN"},
+									{Key: "env", Value: []interface{}{"dev"}, Operator: "NOT_IN"},
+									{Key: "tier", Operator: "EXISTS"},
+									{Key: "canary", Operator: "NOT_EXISTS"},
+									{Key: "team", Value: "a"},
+								},
+							},
+						},
+					},
+				},
+				Relationships: []*Relationship{},
+				ExtraFilters:  nil,
+			},
+			&ReturnClause{
+				Items: []*ReturnItem{
+					{JsonPath: "p"},
+				},
+			},
+		},
+	}
+
+	expr, err := ParseQuery(query)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(expr, expected) {
+		exprJson, _ := json.Marshal(expr)
+		expectedJson, _ := json.Marshal(expected)
+		fmt.Printf("expr: %+v\n", string(exprJson))
+		fmt.Printf("expected: %+v\n", string(expectedJson))
+		t.Errorf("ParseQuery() = %v, want %v", expr, expected)
+	}
+}
+
 func TestMultipleNodePatternsCommaSeparated(t *testing.T) {
 	query := `MATCH (n:Node), (m:Module) RETURN n,m`
 	// Expected AST structure...
@@ -1051,3 +1181,33 @@ func TestMatchReturnSumAsCountAs(t *testing.T) {
 		t.Errorf("ParseQuery() = %v, want %v", expr, expected)
 	}
 }
+
+func TestReadOnly(t *testing.T) {
+	SetReadOnly(true)
+	defer SetReadOnly(false)
+
+	tests := []struct {
+		query  string
+		clause string
+	}{
+		{`MATCH (d:Deployment) SET d.spec.replicas = 3`, "SET"},
+		{`MATCH (p:Pod) DELETE p`, "DELETE"},
+		{`CREATE (c:ConfigMap {"name": "settings"})`, "CREATE"},
+		{`MERGE (p:Pod {name: "web"}) RETURN p`, "MERGE"},
+		{`MATCH (d:Deployment) RESTART d`, "RESTART"},
+	}
+	for _, tt := range tests {
+		_, err := ParseQuery(tt.query)
+		var diagnostic *DiagnosticError
+		if !errors.As(err, &diagnostic) || diagnostic.Code != CodeReadOnly || diagnostic.Details["clause"] != tt.clause {
+			t.Errorf("%s: expected %s to be rejected, got %v", tt.query, tt.clause, err)
+		}
+	}
+
+	// Reading is allowed, and so is explaining a change, which doesn't make it
+	for _, query := range []string{`MATCH (d:Deployment)->(p:Pod) RETURN p.metadata.name`, `EXPLAIN MATCH (p:Pod) DELETE p`} {
+		if _, err := ParseQuery(query); err != nil {
+			t.Errorf("%s: expected the query to be allowed, got %v", query, err)
+		}
+	}
+}
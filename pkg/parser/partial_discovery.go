@@ -0,0 +1,81 @@
+package parser
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+)
+
+// When an aggregated API is down, e.g. metrics-server, discovery returns the resources of every other group along
+// with an error naming the groups it couldn't discover. Queries go on with the groups discovered, and the broken
+// ones are warned about once. Only identifiers that resolve to nothing fail, saying which groups may have served
+// them, so that a query of pods isn't blocked by an unavailable metrics.k8s.io.
+
+var (
+	unavailableGroups      map[schema.GroupVersion]error
+	unavailableGroupsMutex sync.Mutex
+)
+
+// preferredResources discovers the preferred version of the resources of every group, leaving out the groups
+// that failed to be discovered
+func preferredResources(discoveryClient discovery.DiscoveryInterface) ([]*metav1.APIResourceList, error) {
+	apiResourceList, err := discoveryClient.ServerPreferredResources()
+	var failed *discovery.ErrGroupDiscoveryFailed
+	if !errors.As(err, &failed) {
+		return apiResourceList, err
+	}
+	recordUnavailableGroups(failed.Groups)
+	return apiResourceList, nil
+}
+
+// recordUnavailableGroups remembers the groups discovery failed for, warning about those it didn't fail for before
+func recordUnavailableGroups(groups map[schema.GroupVersion]error) {
+	unavailableGroupsMutex.Lock()
+	defer unavailableGroupsMutex.Unlock()
+	if unavailableGroups == nil {
+		unavailableGroups = make(map[schema.GroupVersion]error)
+	}
+	for gv, err := range groups {
+		if _, ok := unavailableGroups[gv]; !ok {
+			logDiagnostic(CodeGroupUnavailable, err, "groupVersion", gv.String())
+		}
+		unavailableGroups[gv] = err
+	}
+}
+
+// resetUnavailableGroups forgets the groups discovery failed for, so that they're tried again
+func resetUnavailableGroups() {
+	unavailableGroupsMutex.Lock()
+	defer unavailableGroupsMutex.Unlock()
+	unavailableGroups = nil
+}
+
+// unavailableGroupsFor are the unavailable group versions that could serve identifier: those of its group if it's
+// qualified with one, otherwise all of them, sorted
+func unavailableGroupsFor(identifier string) []string {
+	unavailableGroupsMutex.Lock()
+	defer unavailableGroupsMutex.Unlock()
+	var groups []string
+	for gv := range unavailableGroups {
+		if _, qualifier, found := strings.Cut(identifier, "."); found && !strings.EqualFold(qualifier, gv.Group) {
+			continue
+		}
+		groups = append(groups, gv.String())
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// unknownKindError is the error of an identifier that resolves to nothing, which may be because the group serving
+// it is unavailable
+func unknownKindError(identifier string) error {
+	if groups := unavailableGroupsFor(identifier); len(groups) > 0 {
+		return newDiagnosticError(CodeKindUnavailable, nil, "identifier", identifier, "groups", strings.Join(groups, ", "))
+	}
+	return newDiagnosticError(CodeUnknownKind, nil, "identifier", identifier)
+}
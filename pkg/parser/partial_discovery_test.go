@@ -0,0 +1,68 @@
+package parser
+
+import (
+	"errors"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// partialDiscovery serves its resources along with the error of the groups it failed to discover
+type partialDiscovery struct {
+	*fakediscovery.FakeDiscovery
+	resources []*metav1.APIResourceList
+	err       error
+}
+
+func (d *partialDiscovery) ServerPreferredResources() ([]*metav1.APIResourceList, error) {
+	return d.resources, d.err
+}
+
+func TestPartialDiscovery(t *testing.T) {
+	originalList := apiResourceListCache
+	defer func() {
+		apiResourceListCache = originalList
+		resetUnavailableGroups()
+	}()
+
+	metrics := schema.GroupVersion{Group: "metrics.k8s.io", Version: "v1beta1"}
+	client := &partialDiscovery{
+		FakeDiscovery: &fakediscovery.FakeDiscovery{Fake: &k8stesting.Fake{}},
+		resources: []*metav1.APIResourceList{{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{{Name: "pods", SingularName: "pod", Kind: "Pod", Namespaced: true}},
+		}},
+		err: &discovery.ErrGroupDiscoveryFailed{Groups: map[schema.GroupVersion]error{metrics: errors.New("the server is currently unable to handle the request")}},
+	}
+	resources, err := preferredResources(client)
+	if err != nil {
+		t.Fatalf("expected the groups discovered to be kept, got %v", err)
+	}
+	apiResourceListCache = resources
+
+	if _, err := ResolveKind(nil, "pods"); err != nil {
+		t.Errorf("expected pods to resolve, got %v", err)
+	}
+	for _, identifier := range []string{"podmetrics", "pods.metrics.k8s.io"} {
+		_, err := ResolveKind(nil, identifier)
+		if DiagnosticCodeOf(err) != CodeKindUnavailable {
+			t.Errorf("%s: expected the kind to be unavailable, got %v", identifier, err)
+		} else if expected := "resource identifier not found: " + identifier + ", it may be served by the unavailable API groups metrics.k8s.io/v1beta1"; err.Error() != expected {
+			t.Errorf("%s: expected %q, got %q", identifier, expected, err.Error())
+		}
+	}
+	// Identifiers of other groups aren't served by the unavailable ones
+	if _, err := ResolveKind(nil, "widgets.example.com"); DiagnosticCodeOf(err) != CodeUnknownKind {
+		t.Errorf("expected the kind to be unknown, got %v", err)
+	}
+
+	// Other discovery errors still fail
+	client.err = errors.New("connection refused")
+	if _, err := preferredResources(client); err == nil {
+		t.Errorf("expected the discovery error to be returned")
+	}
+}
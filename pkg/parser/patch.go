@@ -0,0 +1,177 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// SET patches the resources of a node with one of three patch types:
+//
+//	json       a JSON patch (RFC 6902), the default. A value set to null is removed, and list elements can be set
+//	           or removed by index, e.g. SET d.spec.template.spec.containers[0].env[2] = null, or appended with -,
+//	           e.g. SET d.spec.template.spec.containers[0].args[-] = "--verbose"
+//	merge      a JSON merge patch (RFC 7386), whose null values remove fields. Lists are replaced as a whole.
+//	strategic  a strategic merge patch, which merges the lists of built-in kinds by key instead of replacing them,
+//	           e.g. containers by name. Custom resources don't support it.
+//
+// A SET clause names its patch type after SET, e.g. SET STRATEGIC d.spec.replicas = 2, else PatchType is used unless
+// the change is a server-side apply, see ServerSideApply.
+//
+// Resources with a status subresource, e.g. those of controllers and operators, ignore the changes of their status
+// made to the resource itself. SET STATUS patches the status subresource instead, e.g.
+// SET STATUS MERGE r.status.phase = "Ready", and may only set the values under status.
+
+// PatchType is the patch type of the SET clauses that don't name one
+var PatchType = "json"
+
+var patchTypes = map[string]types.PatchType{
+	"json":      types.JSONPatchType,
+	"merge":     types.MergePatchType,
+	"strategic": types.StrategicMergePatchType,
+}
+
+// PatchTypes are the names of the patch types SET supports
+var PatchTypes = []string{"json", "merge", "strategic"}
+
+// isPatchType reports whether a word names a patch type, in any case
+func isPatchType(word string) bool {
+	_, ok := patchTypes[strings.ToLower(word)]
+	return ok
+}
+
+// setPatchType is the patch type a SET clause patches with, applyPatchType for server-side apply
+func setPatchType(c *SetClause) (string, error) {
+	name := c.PatchType
+	if name == "" && ServerSideApply {
+		return applyPatchType, nil
+	}
+	if name == "" {
+		name = strings.ToLower(PatchType)
+	}
+	if _, ok := patchTypes[name]; !ok {
+		return "", newDiagnosticError(CodeInvalidPatchType, nil, "reason", fmt.Sprintf("unknown patch type %q, expected one of %s", name, strings.Join(PatchTypes, ", ")))
+	}
+	return name, nil
+}
+
+// setSubresource is the subresource a SET clause patches, status for SET STATUS
+func setSubresource(c *SetClause) ([]string, error) {
+	if !c.Status {
+		return nil, nil
+	}
+	for _, kvp := range c.KeyValuePairs {
+		if path := setPath(kvp.Key); len(path) == 0 || listIndex.ReplaceAllString(path[0], "") != "status" {
+			return nil, newDiagnosticError(CodeInvalidStatusSet, nil, "key", kvp.Key)
+		}
+	}
+	return []string{"status"}, nil
+}
+
+// listIndex matches the list indices of a SET key, e.g. [0] or [-]
+var listIndex = regexp.MustCompile(`\[(\d+|-)\]`)
+
+// setPatch returns the patch setting a SET key to value in a resource, or nil when there's nothing to change
+func setPatch(patchType string, resource map[string]interface{}, key string, path []string, value interface{}) ([]byte, error) {
+	if patchType == "json" {
+		patches := createCompatiblePatch(resource, path, value)
+		if len(patches) == 0 {
+			return nil, nil
+		}
+		return json.Marshal(patches)
+	}
+	if listIndex.MatchString(key) {
+		return nil, newDiagnosticError(CodeInvalidPatchType, nil, "reason", fmt.Sprintf("%s patches replace lists as a whole, set the elements of %s with a json patch", patchType, key))
+	}
+	// The path of the value, as nested objects
+	patch := value
+	for i := len(path) - 1; i >= 0; i-- {
+		patch = map[string]interface{}{unescapePathSegment(path[i]): patch}
+	}
+	return json.Marshal(patch)
+}
+
+// unescapePathSegment turns a segment of a JSON patch path back into the key it refers to
+func unescapePathSegment(segment string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(segment, "~1", "/"), "~0", "~")
+}
+
+// splitListIndices splits the list indices off the segments of a path, e.g. containers[0] into containers and 0
+func splitListIndices(path []string) []string {
+	var split []string
+	for _, segment := range path {
+		start := strings.Index(segment, "[")
+		if start <= 0 || !listIndex.MatchString(segment[start:]) || listIndex.ReplaceAllString(segment[start:], "") != "" {
+			split = append(split, segment)
+			continue
+		}
+		split = append(split, segment[:start])
+		for _, index := range listIndex.FindAllStringSubmatch(segment[start:], -1) {
+			split = append(split, index[1])
+		}
+	}
+	return split
+}
+
+// lookupPathSegment returns the value a segment of a path refers to in an object or a list
+func lookupPathSegment(value interface{}, segment string) (interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		child, ok := v[unescapePathSegment(segment)]
+		return child, ok
+	case []interface{}:
+		index, err := strconv.Atoi(segment)
+		if err != nil || index < 0 || index >= len(v) {
+			return nil, false
+		}
+		return v[index], true
+	}
+	return nil, false
+}
+
+// setValue sets the value at path in value, removing it when it's nil, and returns the value changed. Lists are
+// indexed by the segments of the path, - appending to them. Objects missing along the path are created.
+func setValue(value interface{}, path []string, newValue interface{}) interface{} {
+	if len(path) == 0 {
+		return newValue
+	}
+	segment := path[0]
+	switch v := value.(type) {
+	case []interface{}:
+		if segment == "-" && len(path) == 1 {
+			if newValue == nil {
+				return v
+			}
+			return append(v, newValue)
+		}
+		index, err := strconv.Atoi(segment)
+		if err != nil || index < 0 || index >= len(v) {
+			return v
+		}
+		if len(path) == 1 && newValue == nil {
+			return append(v[:index:index], v[index+1:]...)
+		}
+		v[index] = setValue(v[index], path[1:], newValue)
+		return v
+	case map[string]interface{}:
+		if len(path) == 1 && newValue == nil {
+			delete(v, segment)
+			return v
+		}
+		child, ok := v[segment]
+		if !ok && len(path) > 1 {
+			child = map[string]interface{}{}
+		}
+		v[segment] = setValue(child, path[1:], newValue)
+		return v
+	}
+	if newValue == nil {
+		return value
+	}
+	// A missing or scalar value is replaced by an object holding the path
+	return setValue(map[string]interface{}{}, path, newValue)
+}
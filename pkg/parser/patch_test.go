@@ -0,0 +1,238 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestParseSetPatchType(t *testing.T) {
+	query := `MATCH (d:Deployment) SET STRATEGIC d.spec.replicas = 2, d.metadata.labels.tier = null RETURN d`
+	expr, err := ParseQuery(query)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	set := expr.Clauses[1].(*SetClause)
+	if set.PatchType != "strategic" || set.KeyValuePairs[1].Value != nil {
+		t.Errorf("expected a strategic patch removing the tier label, got %+v", set)
+	}
+	if formatted := FormatQuery(expr); formatted != query {
+		t.Errorf("expected %q, got %q", query, formatted)
+	}
+
+	expr, err = ParseQuery(`MATCH (d:Deployment) SET d.spec.template.spec.containers[0].args[-] = "--verbose"`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	if set := expr.Clauses[1].(*SetClause); set.PatchType != "" || set.KeyValuePairs[0].Key != "d.spec.template.spec.containers[0].args[-]" {
+		t.Errorf("expected the default patch type to append to a list, got %+v", set.KeyValuePairs[0])
+	}
+}
+
+func newPatchTestDeployment() *unstructured.Unstructured {
+	return newTestObject("apps/v1", "Deployment", "default", "web", map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{
+						map[string]interface{}{
+							"name":  "app",
+							"image": "nginx:1",
+							"args":  []interface{}{"--port=80"},
+							"env": []interface{}{
+								map[string]interface{}{"name": "DEBUG", "value": "1"},
+								map[string]interface{}{"name": "MODE", "value": "prod"},
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+}
+
+func TestSetJSONPatchLists(t *testing.T) {
+	deploymentsGVR := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	q := newTestQueryExecutor(t, newPatchTestDeployment())
+	fake := q.DynamicClient.(*dynamicfake.FakeDynamicClient)
+	var patches []string
+	fake.PrependReactor("patch", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		if patch.GetPatchType() != types.JSONPatchType {
+			t.Errorf("expected a JSON patch, got %s", patch.GetPatchType())
+		}
+		patches = append(patches, string(patch.GetPatch()))
+		return false, nil, nil
+	})
+
+	result := executeTestQuery(t, q, `MATCH (d:Deployment) SET d.spec.template.spec.containers[0].env[0] = null, d.spec.template.spec.containers[0].args[-] = "--verbose", d.spec.template.spec.containers[0].image = "nginx:2", d.metadata.labels.tier = null RETURN d.spec.template.spec.containers`)
+
+	expectedPatches := []string{
+		`[{"op":"remove","path":"/spec/template/spec/containers/0/env/0"}]`,
+		`[{"op":"add","path":"/spec/template/spec/containers/0/args/-","value":"--verbose"}]`,
+		`[{"op":"add","path":"/spec/template/spec/containers/0/image","value":"nginx:2"}]`,
+	}
+	if !reflect.DeepEqual(patches, expectedPatches) {
+		t.Errorf("expected patches %v, got %v", expectedPatches, patches)
+	}
+
+	expected := []interface{}{map[string]interface{}{
+		"name":  "app",
+		"image": "nginx:2",
+		"args":  []interface{}{"--port=80", "--verbose"},
+		"env":   []interface{}{map[string]interface{}{"name": "MODE", "value": "prod"}},
+	}}
+	returned := result.Data["d"].([]interface{})[0].(map[string]interface{})["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})["containers"]
+	if !reflect.DeepEqual(returned, expected) {
+		t.Errorf("expected the returned containers %v, got %v", expected, returned)
+	}
+	stored, err := fake.Tracker().Get(deploymentsGVR, "default", "web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	containers, _, _ := unstructured.NestedSlice(stored.(*unstructured.Unstructured).Object, "spec", "template", "spec", "containers")
+	if !reflect.DeepEqual(containers, expected) {
+		t.Errorf("expected the stored containers %v, got %v", expected, containers)
+	}
+}
+
+func TestSetPatchTypes(t *testing.T) {
+	tests := []struct {
+		name      string
+		patchType string
+		query     string
+		expected  types.PatchType
+		patch     string
+		code      DiagnosticCode
+	}{
+		{
+			name:     "merge",
+			query:    `MATCH (d:Deployment) SET MERGE d.metadata.labels.tier = null`,
+			expected: types.MergePatchType,
+			patch:    `{"metadata":{"labels":{"tier":null}}}`,
+		},
+		{
+			name:      "strategic by default",
+			patchType: "strategic",
+			query:     `MATCH (d:Deployment) SET d.metadata.labels.app\.kubernetes\.io/name = "web"`,
+			expected:  types.StrategicMergePatchType,
+			patch:     `{"metadata":{"labels":{"app.kubernetes.io/name":"web"}}}`,
+		},
+		{
+			name:  "merge with a list index",
+			query: `MATCH (d:Deployment) SET MERGE d.spec.template.spec.containers[0].image = "nginx:2"`,
+			code:  CodeInvalidPatchType,
+		},
+		{
+			name:      "unknown patch type",
+			patchType: "apply",
+			query:     `MATCH (d:Deployment) SET d.spec.replicas = 2`,
+			code:      CodeInvalidPatchType,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.patchType != "" {
+				originalPatchType := PatchType
+				PatchType = tt.patchType
+				defer func() { PatchType = originalPatchType }()
+			}
+			q := newTestQueryExecutor(t, newPatchTestDeployment())
+			fake := q.DynamicClient.(*dynamicfake.FakeDynamicClient)
+			var patchType types.PatchType
+			var patch string
+			fake.PrependReactor("patch", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				patchType, patch = action.(k8stesting.PatchAction).GetPatchType(), string(action.(k8stesting.PatchAction).GetPatch())
+				return true, newPatchTestDeployment(), nil
+			})
+
+			ast, err := ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+			_, err = q.Execute(ast, "default")
+			if tt.code != "" {
+				if DiagnosticCodeOf(err) != tt.code || patch != "" {
+					t.Errorf("expected code %s without a patch, got %v and %q", tt.code, err, patch)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if patchType != tt.expected || patch != tt.patch {
+				t.Errorf("expected a %s patch %s, got a %s patch %s", tt.expected, tt.patch, patchType, patch)
+			}
+		})
+	}
+}
+
+func TestSetRemoveMissingField(t *testing.T) {
+	q := newTestQueryExecutor(t, newPatchTestDeployment())
+	fake := q.DynamicClient.(*dynamicfake.FakeDynamicClient)
+	fake.PrependReactor("patch", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		t.Errorf("expected no patch, got %s", action.(k8stesting.PatchAction).GetPatch())
+		return false, nil, nil
+	})
+	executeTestQuery(t, q, `MATCH (d:Deployment) SET d.metadata.annotations.owner = null, d.spec.template.spec.containers[0].env[5] = null`)
+}
+
+func TestSetStatus(t *testing.T) {
+	query := `MATCH (d:Deployment) SET STATUS MERGE d.status.readyReplicas = 2 RETURN d.status`
+	expr, err := ParseQuery(query)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	if set := expr.Clauses[1].(*SetClause); !set.Status || set.PatchType != "merge" {
+		t.Errorf("expected a merge patch of the status, got %+v", set)
+	}
+	if formatted := FormatQuery(expr); formatted != query {
+		t.Errorf("expected %q, got %q", query, formatted)
+	}
+
+	q := newTestQueryExecutor(t, newPatchTestDeployment())
+	fake := q.DynamicClient.(*dynamicfake.FakeDynamicClient)
+	var patches []string
+	fake.PrependReactor("patch", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		patches = append(patches, patch.GetSubresource()+" "+string(patch.GetPatch()))
+		// The fake client has no status subresource
+		return patch.GetSubresource() != "", newPatchTestDeployment(), nil
+	})
+
+	result := executeTestQuery(t, q, `MATCH (d:Deployment) SET STATUS d.status.conditions = "Ready" RETURN d.status`)
+	executeTestQuery(t, q, query)
+	executeTestQuery(t, q, `MATCH (d:Deployment) SET d.spec.replicas = 2`)
+	expected := []string{
+		`status [{"op":"add","path":"/status","value":{}},{"op":"add","path":"/status/conditions","value":"Ready"}]`,
+		`status {"status":{"readyReplicas":2}}`,
+		` [{"op":"add","path":"/spec/replicas","value":2}]`,
+	}
+	if !reflect.DeepEqual(patches, expected) {
+		t.Errorf("expected patches %v, got %v", expected, patches)
+	}
+	if status := result.Data["d"].([]interface{})[0].(map[string]interface{})["status"]; !reflect.DeepEqual(status, map[string]interface{}{"conditions": "Ready"}) {
+		t.Errorf("expected the returned status to be set, got %v", status)
+	}
+
+	// A resource MERGE creates gets its status once created
+	patches = nil
+	executeTestQuery(t, q, `MERGE (d:Deployment {name: "api"}) SET STATUS MERGE d.status.readyReplicas = 1`)
+	if !reflect.DeepEqual(patches, []string{`status {"status":{"readyReplicas":1}}`}) {
+		t.Errorf("expected the status of the created deployment to be patched, got %v", patches)
+	}
+
+	ast, err := ParseQuery(`MATCH (d:Deployment) SET STATUS d.status.readyReplicas = 2, d.spec.replicas = 2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Execute(ast, "default"); DiagnosticCodeOf(err) != CodeInvalidStatusSet {
+		t.Errorf("expected code %s, got %v", CodeInvalidStatusSet, err)
+	}
+}
@@ -0,0 +1,91 @@
+package parser
+
+// The node patterns of a MATCH clause are evaluated one after the other, along its relationships and then its
+// nodes. Their resources don't depend on each other though, so when a clause has several to list they're all
+// listed ahead as it starts: the list calls go through the executor's pool of APIWorkers, and the rate limiter of
+// its clients, while the clause waits on the first it needs. Nodes whose kind is only known through their
+// relationships aren't listed ahead, and neither are those of clauses with a namespace property, which sets the
+// namespace of the nodes evaluated after it.
+
+// prefetch is a list call of a node pattern made ahead
+type prefetch struct {
+	done      chan struct{}
+	resources interface{}
+	source    resultSource
+	err       error
+}
+
+// prefetchNodes starts listing the node patterns of a MATCH clause that aren't listed yet, if there are several
+func (q *QueryExecutor) prefetchNodes(c *MatchClause) {
+	type nodeList struct {
+		key, kind, fieldSelector, labelSelector string
+	}
+	for _, n := range c.Nodes {
+		if hasNamespaceProperty(n) {
+			return
+		}
+	}
+	var lists []nodeList
+	listed := make(map[string]bool)
+	for _, n := range c.Nodes {
+		if n.ResourceProperties.Kind == "" {
+			continue
+		}
+		key := q.resourcePropertyName(n)
+		if key == "" || listed[key] || q.resultCache[key] != nil {
+			continue
+		}
+		fieldSelector, labelSelector, err := q.nodeSelectors(n)
+		if err != nil {
+			// The error is returned when the node is evaluated
+			continue
+		}
+		listed[key] = true
+		lists = append(lists, nodeList{key: key, kind: n.ResourceProperties.Kind, fieldSelector: fieldSelector, labelSelector: labelSelector})
+	}
+	if len(lists) < 2 {
+		return
+	}
+	logDebug("Listing node patterns ahead", "count", len(lists))
+	q.prefetched = make(map[string]*prefetch)
+	for _, list := range lists {
+		p := &prefetch{done: make(chan struct{})}
+		q.prefetched[list.key] = p
+		go func() {
+			defer close(p.done)
+			p.resources, p.source, p.err = q.cachedResources(list.kind, list.fieldSelector, list.labelSelector)
+		}()
+	}
+}
+
+// listNode lists the resources of the node pattern with the resultCache key, or waits for them if they're
+// being listed ahead
+func (q *QueryExecutor) listNode(key, kind, fieldSelector, labelSelector string) (interface{}, resultSource, error) {
+	if p, ok := q.prefetched[key]; ok {
+		<-p.done
+		delete(q.prefetched, key)
+		return p.resources, p.source, p.err
+	}
+	return q.cachedResources(kind, fieldSelector, labelSelector)
+}
+
+// awaitPrefetches waits for the list calls made ahead that weren't needed, e.g. because the clause failed, so that
+// none outlives the clause
+func (q *QueryExecutor) awaitPrefetches() {
+	for _, p := range q.prefetched {
+		<-p.done
+	}
+	q.prefetched = nil
+}
+
+func hasNamespaceProperty(n *NodePattern) bool {
+	if n.ResourceProperties.Properties == nil {
+		return false
+	}
+	for _, prop := range n.ResourceProperties.Properties.PropertyList {
+		if isNamespaceProperty(prop) {
+			return true
+		}
+	}
+	return false
+}
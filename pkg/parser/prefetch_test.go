@@ -0,0 +1,52 @@
+package parser
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestPrefetchNodes(t *testing.T) {
+	q := newTestQueryExecutor(t,
+		newTestObject("v1", "Pod", "default", "web-1", nil),
+		newTestObject("v1", "Service", "default", "web", nil),
+	)
+	// Two workers make the list calls
+	q.semaphore = make(chan struct{}, 2)
+	go q.processRequests()
+
+	// Each list call waits for the other to start
+	var started sync.WaitGroup
+	started.Add(2)
+	arrived := make(chan struct{})
+	go func() {
+		started.Wait()
+		close(arrived)
+	}()
+	var mutex sync.Mutex
+	concurrent := map[string]bool{}
+	Hooks = QueryHooks{OnAPICall: func(verb string, gvr schema.GroupVersionResource) {
+		started.Done()
+		select {
+		case <-arrived:
+			mutex.Lock()
+			concurrent[gvr.Resource] = true
+			mutex.Unlock()
+		case <-time.After(5 * time.Second):
+		}
+	}}
+	defer func() { Hooks = QueryHooks{} }()
+
+	result := executeTestQuery(t, q, `MATCH (p:Pod), (s:Service) RETURN p.metadata.name, s.metadata.name`)
+	if !concurrent["pods"] || !concurrent["services"] {
+		t.Errorf("expected the pods and services to be listed at once, got %v", concurrent)
+	}
+	if pods, services := result.Data["p"].([]interface{}), result.Data["s"].([]interface{}); len(pods) != 1 || len(services) != 1 {
+		t.Errorf("expected a pod and a service, got %v", result.Data)
+	}
+	if calls := q.APICalls(); calls != 2 {
+		t.Errorf("expected a list call of each node, got %d calls", calls)
+	}
+}
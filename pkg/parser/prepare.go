@@ -0,0 +1,448 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// A query run many times, e.g. by the dashboards of the web server, is parsed and planned once with
+// Prepare: the kinds of its node patterns are resolved, and the selectors pushed down to their list calls
+// computed, ahead of its runs. Its values may be parameters, e.g. $name in
+//
+//	MATCH (p:Pod {app: $app}) WHERE p.status.phase = $phase RETURN p.metadata.name
+//
+// given when it runs, so that queries differing only in their values share a plan, and values never need to be
+// quoted into the query. Parameters stand for the values of properties, WHERE filters and SET clauses.
+
+// Parameter is a value given when the query runs, e.g. $name
+type Parameter struct {
+	Name string
+}
+
+func (p *Parameter) String() string {
+	return "$" + p.Name
+}
+
+// PreparedQuery is a query parsed and planned once, to run many times with different parameters
+type PreparedQuery struct {
+	// Query is the text of the query
+	Query string
+	// Parameters are the names of the parameters the query takes, sorted
+	Parameters []string
+	ast        *Expression
+	// selectors are the selectors pushed down to the list calls of the node patterns whose properties aren't
+	// parameters, which are shared by every run
+	selectors map[*NodePattern]plannedSelectors
+}
+
+type plannedSelectors struct {
+	fieldSelector, labelSelector string
+}
+
+// maxPreparedQueries is how many prepared queries an executor keeps, the least recently prepared are dropped
+const maxPreparedQueries = 256
+
+// preparedQueries are the queries prepared by an executor and its forks, by query
+type preparedQueries struct {
+	mutex   sync.Mutex
+	queries map[string]*PreparedQuery
+	// order is the queries from the least to the most recently prepared
+	order []string
+}
+
+func newPreparedQueries() *preparedQueries {
+	return &preparedQueries{queries: make(map[string]*PreparedQuery)}
+}
+
+func (p *preparedQueries) get(query string) (*PreparedQuery, bool) {
+	if p == nil {
+		return nil, false
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	prepared, ok := p.queries[query]
+	return prepared, ok
+}
+
+func (p *preparedQueries) put(prepared *PreparedQuery) {
+	if p == nil {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if _, ok := p.queries[prepared.Query]; !ok {
+		p.order = append(p.order, prepared.Query)
+	}
+	p.queries[prepared.Query] = prepared
+	for len(p.order) > maxPreparedQueries {
+		delete(p.queries, p.order[0])
+		p.order = p.order[1:]
+	}
+}
+
+// Prepare parses and plans a query, or returns the plan of the same query prepared earlier by the executor or
+// its forks. The kinds of the query are resolved, so an unknown kind fails here rather than when it runs.
+func (q *QueryExecutor) Prepare(query string) (*PreparedQuery, error) {
+	if prepared, ok := q.prepared.get(query); ok {
+		return prepared, nil
+	}
+	ast, err := ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	prepared := &PreparedQuery{Query: query, Parameters: parameterNames(ast), ast: ast, selectors: make(map[*NodePattern]plannedSelectors)}
+	if err := q.planSelectors(ast, prepared.selectors); err != nil {
+		return nil, err
+	}
+	q.prepared.put(prepared)
+	return prepared, nil
+}
+
+// planSelectors computes the selectors of the node patterns of a query that are listed, unless their properties
+// are parameters
+func (q *QueryExecutor) planSelectors(ast *Expression, selectors map[*NodePattern]plannedSelectors) error {
+	var nodes []*NodePattern
+	for _, clause := range ast.Clauses {
+		switch c := clause.(type) {
+		case *MatchClause:
+			nodes = append(nodes, c.Nodes...)
+		case *MergeClause:
+			nodes = append(nodes, c.Node)
+		}
+	}
+	for _, n := range nodes {
+		if n.ResourceProperties.Kind == "" || hasParameters(n) {
+			continue
+		}
+		if !IsMultiKindPattern(n.ResourceProperties.Kind) {
+			if _, err := FindGVR(q.Clientset, n.ResourceProperties.Kind); err != nil {
+				return err
+			}
+		}
+		fieldSelector, labelSelector, err := q.nodeSelectors(n)
+		if err != nil {
+			return err
+		}
+		selectors[n] = plannedSelectors{fieldSelector: fieldSelector, labelSelector: labelSelector}
+	}
+	if ast.Apply != nil && ast.Apply.While != nil {
+		if err := q.planSelectors(ast.Apply.While, selectors); err != nil {
+			return err
+		}
+	}
+	if ast.Union != nil {
+		for _, query := range ast.Union.Queries {
+			if err := q.planSelectors(query, selectors); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Bind returns a copy of the query to run, its parameters replaced by the given values. Values are strings,
+// numbers, booleans or null.
+func (p *PreparedQuery) Bind(parameters map[string]interface{}) (*Expression, error) {
+	ast, _, err := p.bind(parameters)
+	return ast, err
+}
+
+// BindParameters gives the parameters of a parsed query their values, returning a copy of the query to run
+func BindParameters(ast *Expression, parameters map[string]interface{}) (*Expression, error) {
+	prepared := &PreparedQuery{Parameters: parameterNames(ast), ast: ast}
+	return prepared.Bind(parameters)
+}
+
+// parameterNames are the names of the parameters of a query, sorted
+func parameterNames(ast *Expression) []string {
+	parameters := []string{}
+	names := make(map[string]bool)
+	walkValues(ast, func(value interface{}) {
+		if parameter, ok := value.(*Parameter); ok && !names[parameter.Name] {
+			names[parameter.Name] = true
+			parameters = append(parameters, parameter.Name)
+		}
+	})
+	sort.Strings(parameters)
+	return parameters
+}
+
+// bind binds the parameters of the query, returning the copies of its node patterns as well. Running a query
+// completes its node patterns, e.g. with the kinds of the nodes bound earlier, so each run has copies of its own.
+func (p *PreparedQuery) bind(parameters map[string]interface{}) (*Expression, map[*NodePattern]*NodePattern, error) {
+	values := make(map[string]interface{}, len(parameters))
+	for name, value := range parameters {
+		if !slices.Contains(p.Parameters, name) {
+			return nil, nil, newDiagnosticError(CodeUnknownParameter, nil, "parameter", "$"+name)
+		}
+		bound, err := parameterValue(name, value)
+		if err != nil {
+			return nil, nil, err
+		}
+		values[name] = bound
+	}
+	for _, name := range p.Parameters {
+		if _, ok := values[name]; !ok {
+			return nil, nil, newDiagnosticError(CodeMissingParameter, nil, "parameter", "$"+name)
+		}
+	}
+	b := &binder{values: values, copies: make(map[*NodePattern]*NodePattern)}
+	return b.expression(p.ast), b.copies, nil
+}
+
+// ExecutePrepared runs a prepared query with the given parameters, reusing its plan
+func (q *QueryExecutor) ExecutePrepared(ctx context.Context, prepared *PreparedQuery, parameters map[string]interface{}, namespace string) (QueryResult, error) {
+	ast, nodes, err := prepared.bind(parameters)
+	if err != nil {
+		return QueryResult{}, err
+	}
+	// Read-only mode may have been turned on since the query was prepared
+	parseMutex.Lock()
+	err = checkReadOnly(ast)
+	parseMutex.Unlock()
+	if err != nil {
+		return QueryResult{}, err
+	}
+	if q.resultCache == nil {
+		q.queryState = newQueryState()
+	}
+	q.plannedSelectors = make(map[*NodePattern]plannedSelectors, len(prepared.selectors))
+	for n, selectors := range prepared.selectors {
+		q.plannedSelectors[nodes[n]] = selectors
+	}
+	return q.ExecuteContext(ctx, ast, namespace)
+}
+
+// parameterValue checks the value of a parameter, numbers being decoded from JSON as float64 become ints when
+// they're whole, like the integers of a query
+func parameterValue(name string, value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil, string, bool, int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < math.MaxInt32 {
+			return int(v), nil
+		}
+		return v, nil
+	}
+	return nil, newDiagnosticError(CodeInvalidParameter, nil, "parameter", "$"+name, "type", fmt.Sprintf("%T", value))
+}
+
+// unboundParameters fails queries whose parameters weren't given values, as they only run through ExecutePrepared
+func unboundParameters(ast *Expression) error {
+	var unbound *Parameter
+	walkValues(ast, func(value interface{}) {
+		if parameter, ok := value.(*Parameter); ok && unbound == nil {
+			unbound = parameter
+		}
+	})
+	if unbound != nil {
+		return newDiagnosticError(CodeMissingParameter, nil, "parameter", unbound.String())
+	}
+	return nil
+}
+
+// walkValues calls visit with the values of the properties, filters and SET items of a query, and the elements
+// of the lists among them
+func walkValues(ast *Expression, visit func(interface{})) {
+	visitValue := func(value interface{}) {
+		if list, ok := value.([]interface{}); ok {
+			for _, item := range list {
+				visit(item)
+			}
+			return
+		}
+		visit(value)
+	}
+	visitNode := func(n *NodePattern) {
+		if n == nil || n.ResourceProperties == nil || n.ResourceProperties.Properties == nil {
+			return
+		}
+		for _, prop := range n.ResourceProperties.Properties.PropertyList {
+			visitValue(prop.Value)
+		}
+	}
+	visitFilters := func(filters []*KeyValuePair) {
+		for _, filter := range filters {
+			visitValue(filter.Value)
+		}
+	}
+	for _, clause := range ast.Clauses {
+		switch c := clause.(type) {
+		case *MatchClause:
+			for _, n := range c.Nodes {
+				visitNode(n)
+			}
+			for _, rel := range c.Relationships {
+				visitNode(&NodePattern{ResourceProperties: rel.ResourceProperties})
+			}
+			visitFilters(c.ExtraFilters)
+		case *CreateClause:
+			for _, n := range c.Nodes {
+				visitNode(n)
+			}
+		case *MergeClause:
+			visitNode(c.Node)
+		case *SetClause:
+			visitFilters(c.KeyValuePairs)
+		case *WithClause:
+			visitFilters(c.ExtraFilters)
+		}
+	}
+	if ast.Apply != nil && ast.Apply.While != nil {
+		walkValues(ast.Apply.While, visit)
+	}
+	if ast.Union != nil {
+		for _, query := range ast.Union.Queries {
+			walkValues(query, visit)
+		}
+	}
+}
+
+// hasParameters reports whether the properties of a node pattern are parameters
+func hasParameters(n *NodePattern) bool {
+	found := false
+	walkValues(&Expression{Clauses: []Clause{&MergeClause{Node: n}}}, func(value interface{}) {
+		_, ok := value.(*Parameter)
+		found = found || ok
+	})
+	return found
+}
+
+// binder copies the clauses of a query, with the values of its parameters instead
+type binder struct {
+	values map[string]interface{}
+	// copies are the copies of the node patterns, which relationships refer to as well
+	copies map[*NodePattern]*NodePattern
+}
+
+func (b *binder) expression(e *Expression) *Expression {
+	bound := *e
+	bound.Clauses = make([]Clause, len(e.Clauses))
+	for i, clause := range e.Clauses {
+		bound.Clauses[i] = b.clause(clause)
+	}
+	if e.Apply != nil && e.Apply.While != nil {
+		apply := *e.Apply
+		apply.While = b.expression(e.Apply.While)
+		bound.Apply = &apply
+	}
+	if e.Union != nil {
+		union := *e.Union
+		union.Queries = make([]*Expression, len(e.Union.Queries))
+		for i, query := range e.Union.Queries {
+			union.Queries[i] = b.expression(query)
+		}
+		bound.Union = &union
+	}
+	return &bound
+}
+
+func (b *binder) clause(clause Clause) Clause {
+	switch c := clause.(type) {
+	case *MatchClause:
+		bound := *c
+		bound.Nodes = b.nodes(c.Nodes)
+		bound.Relationships = b.relationships(c.Relationships)
+		bound.ExtraFilters = b.filters(c.ExtraFilters)
+		return &bound
+	case *CreateClause:
+		bound := *c
+		bound.Nodes = b.nodes(c.Nodes)
+		bound.Relationships = b.relationships(c.Relationships)
+		return &bound
+	case *MergeClause:
+		return &MergeClause{Node: b.node(c.Node)}
+	case *SetClause:
+		bound := *c
+		bound.KeyValuePairs = b.filters(c.KeyValuePairs)
+		return &bound
+	case *WithClause:
+		bound := *c
+		bound.ExtraFilters = b.filters(c.ExtraFilters)
+		return &bound
+	}
+	return clause
+}
+
+func (b *binder) nodes(nodes []*NodePattern) []*NodePattern {
+	bound := make([]*NodePattern, len(nodes))
+	for i, n := range nodes {
+		bound[i] = b.node(n)
+	}
+	return bound
+}
+
+func (b *binder) node(n *NodePattern) *NodePattern {
+	if n == nil {
+		return nil
+	}
+	if bound, ok := b.copies[n]; ok {
+		return bound
+	}
+	bound := &NodePattern{ResourceProperties: b.resourceProperties(n.ResourceProperties)}
+	b.copies[n] = bound
+	return bound
+}
+
+func (b *binder) resourceProperties(r *ResourceProperties) *ResourceProperties {
+	if r == nil {
+		return nil
+	}
+	bound := *r
+	if r.Properties == nil {
+		return &bound
+	}
+	bound.Properties = &Properties{PropertyList: make([]*Property, len(r.Properties.PropertyList))}
+	for i, prop := range r.Properties.PropertyList {
+		boundProp := *prop
+		boundProp.Value = b.value(prop.Value)
+		bound.Properties.PropertyList[i] = &boundProp
+	}
+	return &bound
+}
+
+func (b *binder) relationships(relationships []*Relationship) []*Relationship {
+	bound := make([]*Relationship, len(relationships))
+	for i, rel := range relationships {
+		boundRel := *rel
+		boundRel.ResourceProperties = b.resourceProperties(rel.ResourceProperties)
+		boundRel.LeftNode = b.node(rel.LeftNode)
+		boundRel.RightNode = b.node(rel.RightNode)
+		bound[i] = &boundRel
+	}
+	return bound
+}
+
+func (b *binder) filters(filters []*KeyValuePair) []*KeyValuePair {
+	if filters == nil {
+		return nil
+	}
+	bound := make([]*KeyValuePair, len(filters))
+	for i, filter := range filters {
+		boundFilter := *filter
+		boundFilter.Value = b.value(filter.Value)
+		bound[i] = &boundFilter
+	}
+	return bound
+}
+
+func (b *binder) value(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *Parameter:
+		return b.values[v.Name]
+	case []interface{}:
+		bound := make([]interface{}, len(v))
+		for i, item := range v {
+			bound[i] = b.value(item)
+		}
+		return bound
+	}
+	return value
+}
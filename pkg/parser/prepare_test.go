@@ -0,0 +1,103 @@
+package parser
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestParseParameters(t *testing.T) {
+	ast, err := ParseQuery(`MATCH (p:Pod {app: $app, tier IN ["web", $tier]}) WHERE p.spec.priority > $priority SET p.metadata.labels.team = $team`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	match := ast.Clauses[0].(*MatchClause)
+	props := match.Nodes[0].ResourceProperties.Properties.PropertyList
+	if !reflect.DeepEqual(props[0].Value, &Parameter{Name: "app"}) || !reflect.DeepEqual(props[1].Value, []interface{}{"web", &Parameter{Name: "tier"}}) {
+		t.Errorf("expected parameters in the properties, got %v and %v", props[0].Value, props[1].Value)
+	}
+	if !reflect.DeepEqual(match.ExtraFilters[0].Value, &Parameter{Name: "priority"}) {
+		t.Errorf("expected a parameter in the WHERE clause, got %v", match.ExtraFilters[0].Value)
+	}
+	if set := ast.Clauses[1].(*SetClause); !reflect.DeepEqual(set.KeyValuePairs[0].Value, &Parameter{Name: "team"}) {
+		t.Errorf("expected a parameter in the SET clause, got %v", set.KeyValuePairs[0].Value)
+	}
+
+	if _, err := ParseQuery(`MATCH (p:Pod {app: $}) RETURN p`); err == nil {
+		t.Errorf("expected a parameter without a name not to parse")
+	}
+}
+
+func TestPreparedQuery(t *testing.T) {
+	q := newTestQueryExecutor(t,
+		newTestObject("v1", "Pod", "default", "web-1", map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "web-1", "namespace": "default", "labels": map[string]interface{}{"app": "web"}},
+			"spec":     map[string]interface{}{"priority": int64(10)},
+		}),
+		newTestObject("v1", "Pod", "default", "web-2", map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "web-2", "namespace": "default", "labels": map[string]interface{}{"app": "web"}},
+			"spec":     map[string]interface{}{"priority": int64(20)},
+		}),
+	)
+	q.prepared = newPreparedQueries()
+
+	query := `MATCH (p:Pod {app: "web"}) WHERE p.spec.priority > $priority RETURN p.metadata.name`
+	prepared, err := q.Prepare(query)
+	if err != nil {
+		t.Fatalf("Prepare() error = %v", err)
+	}
+	if !reflect.DeepEqual(prepared.Parameters, []string{"priority"}) {
+		t.Errorf("expected the priority parameter, got %v", prepared.Parameters)
+	}
+	if len(prepared.selectors) != 1 {
+		t.Errorf("expected the selectors of the pod to be planned, got %v", prepared.selectors)
+	}
+	if again, err := q.Fork().Prepare(query); err != nil || again != prepared {
+		t.Errorf("expected forks to reuse the prepared query, got %v", err)
+	}
+
+	// JSON numbers are float64
+	for priority, expected := range map[float64][]string{5: {"web-1", "web-2"}, 15: {"web-2"}} {
+		result, err := q.ExecutePrepared(context.Background(), prepared, map[string]interface{}{"priority": priority}, "default")
+		if err != nil {
+			t.Fatalf("ExecutePrepared() error = %v", err)
+		}
+		var names []string
+		for _, row := range result.Data["p"].([]interface{}) {
+			names = append(names, row.(map[string]interface{})["name"].(string))
+		}
+		if !reflect.DeepEqual(names, expected) {
+			t.Errorf("priority > %v: expected %v, got %v", priority, expected, names)
+		}
+	}
+	if filter := prepared.ast.Clauses[0].(*MatchClause).ExtraFilters[0]; !reflect.DeepEqual(filter.Value, &Parameter{Name: "priority"}) {
+		t.Errorf("expected the prepared query to keep its parameter, got %v", filter.Value)
+	}
+
+	tests := []struct {
+		parameters map[string]interface{}
+		code       DiagnosticCode
+	}{
+		{map[string]interface{}{}, CodeMissingParameter},
+		{map[string]interface{}{"priority": 1, "phase": "Running"}, CodeUnknownParameter},
+		{map[string]interface{}{"priority": []interface{}{1}}, CodeInvalidParameter},
+	}
+	for _, tt := range tests {
+		if _, err := q.ExecutePrepared(context.Background(), prepared, tt.parameters, "default"); DiagnosticCodeOf(err) != tt.code {
+			t.Errorf("%v: expected %s, got %v", tt.parameters, tt.code, err)
+		}
+	}
+
+	// Parameters only get values through ExecutePrepared
+	ast, err := ParseQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Execute(ast, "default"); DiagnosticCodeOf(err) != CodeMissingParameter || err.Error() != "parameter $priority has no value" {
+		t.Errorf("expected the unbound parameter to fail the query, got %v", err)
+	}
+
+	if _, err := q.Prepare(`MATCH (w:Widget) RETURN w`); DiagnosticCodeOf(err) != CodeUnknownKind {
+		t.Errorf("expected an unknown kind to fail preparing the query, got %v", err)
+	}
+}
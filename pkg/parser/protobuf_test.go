@@ -0,0 +1,70 @@
+package parser
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer/protobuf"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+)
+
+func TestProtobufList(t *testing.T) {
+	pods := &corev1.PodList{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "PodList"},
+		ListMeta: metav1.ListMeta{ResourceVersion: "42"},
+		Items: []corev1.Pod{{
+			ObjectMeta: metav1.ObjectMeta{Name: "web-1", Namespace: "default"},
+			Spec:       corev1.PodSpec{NodeName: "node-a", Containers: []corev1.Container{{Name: "web", Image: "nginx"}}},
+		}},
+	}
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if accept := r.Header.Get("Accept"); !strings.HasPrefix(accept, runtime.ContentTypeProtobuf) {
+			t.Errorf("expected protobuf to be asked for, got %q", accept)
+		}
+		w.Header().Set("Content-Type", runtime.ContentTypeProtobuf)
+		if err := protobuf.NewSerializer(scheme.Scheme, scheme.Scheme).Encode(pods, w); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer server.Close()
+
+	q := newTestQueryExecutor(t)
+	q.protobuf = newProtobufLister(&rest.Config{Host: server.URL})
+	result := executeTestQuery(t, q, `MATCH (p:Pod) RETURN p`)
+
+	items, _ := result.Data["p"].([]interface{})
+	if len(items) != 1 {
+		t.Fatalf("expected a pod, got %v", result.Data["p"])
+	}
+	pod := items[0].(map[string]interface{})
+	for path, expected := range map[string]string{
+		"apiVersion":    "v1",
+		"kind":          "Pod",
+		"metadata.name": "web-1",
+		"spec.nodeName": "node-a",
+	} {
+		if value, _, _ := unstructured.NestedString(pod, strings.Split(path, ".")...); value != expected {
+			t.Errorf("%s: expected %q, got %q", path, expected, value)
+		}
+	}
+	if len(paths) != 1 || paths[0] != "/api/v1/namespaces/default/pods" {
+		t.Errorf("expected the pods of default to be listed, got %v", paths)
+	}
+
+	// Custom kinds are listed as JSON
+	target := listTarget{gvr: schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}, kind: "Widget", namespaced: true}
+	if _, ok, _ := q.protobuf.list(context.Background(), target, "default", metav1.ListOptions{}); ok {
+		t.Error("expected widgets not to be listed as protobuf")
+	}
+}
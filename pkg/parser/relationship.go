@@ -4,8 +4,6 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
-
-	"github.com/AvitalTamir/jsonpath"
 )
 
 func initializeRelationships() {
@@ -108,7 +106,7 @@ func initializeRelationships() {
 }
 
 func findRuleByRelationshipType(relationshipType RelationshipType) (RelationshipRule, error) {
-	for _, rule := range relationshipRules {
+	for _, rule := range activeRelationshipRules() {
 		if rule.Relationship == relationshipType {
 			return rule, nil
 		}
@@ -117,7 +115,7 @@ func findRuleByRelationshipType(relationshipType RelationshipType) (Relationship
 }
 
 func findRuleByKinds(kindA, kindB string) (RelationshipRule, error) {
-	for _, rule := range relationshipRules {
+	for _, rule := range activeRelationshipRules() {
 		if (rule.KindA == kindA && rule.KindB == kindB) || (rule.KindA == kindB && rule.KindB == kindA) {
 			return rule, nil
 		}
@@ -125,29 +123,51 @@ func findRuleByKinds(kindA, kindB string) (RelationshipRule, error) {
 	return RelationshipRule{}, fmt.Errorf("rule not found for kinds: %s and %s", kindA, kindB)
 }
 
+// matchByRule reports whether a rule relates two resources, resourceA being of the rule's KindA
+func matchByRule(resourceA, resourceB interface{}, rule RelationshipRule) bool {
+	if rule.analyzer != "" {
+		return rule.match != nil && rule.match(resourceA, resourceB)
+	}
+	if !rule.MatchAny {
+		return matchByCriteria(resourceA, resourceB, rule.MatchCriteria)
+	}
+	_, ok := matchingCriterion(resourceA, resourceB, rule)
+	return ok
+}
+
+// matchingCriterion returns the first criterion of a rule two resources match, resourceA being of the rule's KindA
+func matchingCriterion(resourceA, resourceB interface{}, rule RelationshipRule) (MatchCriterion, bool) {
+	for _, criterion := range rule.MatchCriteria {
+		if matchByCriteria(resourceA, resourceB, []MatchCriterion{criterion}) {
+			return criterion, true
+		}
+	}
+	return MatchCriterion{}, false
+}
+
 func matchByCriteria(resourceA, resourceB interface{}, criteria []MatchCriterion) bool {
 	for _, criterion := range criteria {
 		switch criterion.ComparisonType {
 		case ContainsAll:
-			l, err := jsonpath.JsonPathLookup(resourceA, strings.ReplaceAll(criterion.FieldA, "[]", ""))
+			l, err := jsonPathLookup(resourceA, strings.ReplaceAll(criterion.FieldA, "[]", ""))
 			if err != nil {
-				logDebug("Error extracting fieldA: ", err)
+				logDebug("Error extracting fieldA", "error", err)
 				return false
 			}
 			labels, ok := l.(map[string]interface{})
 			if !ok {
-				logDebug("No labels found for resource: ", resourceA)
+				logDebug("No labels found for resource", "resource", resourceA)
 				return false
 			}
 
-			s, err := jsonpath.JsonPathLookup(resourceB, strings.ReplaceAll(criterion.FieldB, "[]", ""))
+			s, err := jsonPathLookup(resourceB, strings.ReplaceAll(criterion.FieldB, "[]", ""))
 			if err != nil {
-				logDebug("Error extracting fieldB: ", err)
+				logDebug("Error extracting fieldB", "error", err)
 				return false
 			}
 			selector, ok := s.(map[string]interface{})
 			if !ok {
-				logDebug("No resources found for selector: ", selector)
+				logDebug("No resources found for selector", "selector", selector)
 				return false
 			}
 
@@ -158,14 +178,14 @@ func matchByCriteria(resourceA, resourceB interface{}, criteria []MatchCriterion
 			// Logic for exact field matching
 
 			// Extract the fields
-			fieldsA, err := jsonpath.JsonPathLookup(resourceA, strings.ReplaceAll(criterion.FieldA, "[]", ""))
+			fieldsA, err := jsonPathLookup(resourceA, strings.ReplaceAll(criterion.FieldA, "[]", ""))
 			if err != nil {
-				logDebug("Error extracting fieldA: ", err)
+				logDebug("Error extracting fieldA", "error", err)
 				return false
 			}
-			fieldsB, err := jsonpath.JsonPathLookup(resourceB, strings.ReplaceAll(criterion.FieldB, "[]", ""))
+			fieldsB, err := jsonPathLookup(resourceB, strings.ReplaceAll(criterion.FieldB, "[]", ""))
 			if err != nil {
-				logDebug("Error extracting fieldB: ", err)
+				logDebug("Error extracting fieldB", "error", err)
 				return false
 			}
 			if !matchFields(fieldsA, fieldsB) {
@@ -248,7 +268,7 @@ func applyRelationshipRule(resourcesA, resourcesB []map[string]interface{}, rule
 
 	for _, resourceA := range resourcesA {
 		for _, resourceB := range resourcesB {
-			if matchByCriteria(resourceA, resourceB, rule.MatchCriteria) {
+			if matchByRule(resourceA, resourceB, rule) {
 				if direction == Left {
 					// if resourceA doesn't already exist in matchedResourcesA, add it
 					if !containsResource(matchedResourcesA, resourceA) {
@@ -283,8 +303,9 @@ func applyRelationshipRule(resourcesA, resourcesB []map[string]interface{}, rule
 }
 
 func containsResource(resources []map[string]interface{}, resource map[string]interface{}) bool {
+	identity := resourceIdentity(resource)
 	for _, res := range resources {
-		if res["metadata"].(map[string]interface{})["name"] == resource["metadata"].(map[string]interface{})["name"] {
+		if resourceIdentity(res) == identity {
 			return true
 		}
 	}
@@ -1,8 +1,14 @@
 package parser
 
 import (
+	"context"
 	"reflect"
+	"slices"
 	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 func TestFindRuleByRelationshipType(t *testing.T) {
@@ -281,3 +287,410 @@ func TestApplyRelationshipRule(t *testing.T) {
 		})
 	}
 }
+
+func TestConfigMapAndSecretReferences(t *testing.T) {
+	podSpec := map[string]interface{}{
+		"containers": []interface{}{
+			map[string]interface{}{
+				"name": "app",
+				"env": []interface{}{
+					map[string]interface{}{"name": "MODE", "value": "production"},
+					map[string]interface{}{"name": "PASSWORD", "valueFrom": map[string]interface{}{
+						"secretKeyRef": map[string]interface{}{"name": "db", "key": "password"},
+					}},
+				},
+				"envFrom": []interface{}{map[string]interface{}{"configMapRef": map[string]interface{}{"name": "settings"}}},
+			},
+		},
+		"volumes": []interface{}{
+			map[string]interface{}{"name": "tls", "secret": map[string]interface{}{"secretName": "tls"}},
+		},
+		"imagePullSecrets": []interface{}{map[string]interface{}{"name": "registry"}},
+	}
+	q := newTestQueryExecutor(t,
+		newTestObject("apps/v1", "Deployment", "default", "web", map[string]interface{}{
+			"spec": map[string]interface{}{"template": map[string]interface{}{"spec": podSpec}},
+		}),
+		newTestObject("v1", "Pod", "default", "web-1", map[string]interface{}{"spec": podSpec}),
+		newTestObject("v1", "ConfigMap", "default", "settings", nil),
+		newTestObject("v1", "ConfigMap", "default", "unused", nil),
+		newTestObject("v1", "Secret", "default", "db", nil),
+		newTestObject("v1", "Secret", "default", "tls", nil),
+		newTestObject("v1", "Secret", "default", "registry", nil),
+		newTestObject("v1", "Secret", "default", "other", nil),
+	)
+
+	result := executeTestQuery(t, q, `MATCH (d:Deployment)-[r]->(s:Secret) RETURN s.metadata.name, type(r), r.link, r.field`)
+	links := map[string]interface{}{}
+	for _, link := range result.Data["r"].([]interface{}) {
+		link := link.(map[string]interface{})
+		links[link["field"].(string)] = link["link"]
+		if link["type"] != string(DeploymentUseSecret) {
+			t.Errorf("unexpected link %v", link)
+		}
+	}
+	expected := map[string]interface{}{
+		"spec.template.spec.containers[].env[].valueFrom.secretKeyRef.name": LinkEnv,
+		"spec.template.spec.volumes[].secret.secretName":                    LinkVolume,
+		"spec.template.spec.imagePullSecrets[].name":                        LinkReference,
+	}
+	if !reflect.DeepEqual(links, expected) {
+		t.Errorf("expected a link per way the secrets are used, got %v", links)
+	}
+	if secrets := len(result.Data["s"].([]interface{})); secrets != 3 {
+		t.Errorf("expected the three secrets the deployment uses, got %v", result.Data["s"])
+	}
+
+	result = executeTestQuery(t, q, `MATCH (c:ConfigMap)<-(x) RETURN x.kind, c.metadata.name`)
+	configMaps, users := result.Data["c"].([]interface{}), result.Data["x"].([]interface{})
+	if len(configMaps) != 1 || configMaps[0].(map[string]interface{})["name"] != "settings" || len(users) != 2 {
+		t.Errorf("expected the deployment and pod using the settings, got %v and %v", configMaps, users)
+	}
+}
+
+func TestStorageRelationships(t *testing.T) {
+	claimant := func(name, claim string) *unstructured.Unstructured {
+		return newTestObject("v1", "Pod", "default", name, map[string]interface{}{
+			"spec": map[string]interface{}{"volumes": []interface{}{
+				map[string]interface{}{"name": "data", "persistentVolumeClaim": map[string]interface{}{"claimName": claim}},
+			}},
+		})
+	}
+	claim := func(name, volume, storageClass string) *unstructured.Unstructured {
+		return newTestObject("v1", "PersistentVolumeClaim", "default", name, map[string]interface{}{
+			"spec": map[string]interface{}{"volumeName": volume, "storageClassName": storageClass},
+		})
+	}
+	volume := func(name, storageClass string) *unstructured.Unstructured {
+		return newTestObject("v1", "PersistentVolume", "", name, map[string]interface{}{
+			"spec": map[string]interface{}{"storageClassName": storageClass},
+		})
+	}
+	q := newTestQueryExecutor(t,
+		claimant("db-0", "data-db-0"),
+		claimant("cache-0", "data-cache-0"),
+		newTestObject("v1", "Pod", "default", "web", nil),
+		claim("data-db-0", "pv-1", "fast"),
+		claim("data-cache-0", "pv-2", "slow"),
+		claim("pending", "", "fast"),
+		volume("pv-1", "fast"),
+		volume("pv-2", "slow"),
+		newTestObject("storage.k8s.io/v1", "StorageClass", "", "fast", nil),
+		newTestObject("storage.k8s.io/v1", "StorageClass", "", "slow", nil),
+	)
+
+	// The pods that would be affected by removing a storage class, through cluster-scoped volumes and classes
+	result := executeTestQuery(t, q, `MATCH (p:Pod)->(pvc:PersistentVolumeClaim)->(pv:PersistentVolume)->(sc:StorageClass) WHERE sc.metadata.name = "fast" RETURN p.metadata.name, pv.metadata.name`)
+	if pods := result.Data["p"].([]interface{}); len(pods) != 1 || pods[0].(map[string]interface{})["name"] != "db-0" {
+		t.Errorf("expected the pod on the fast class, got %v", pods)
+	}
+	if volumes := result.Data["pv"].([]interface{}); len(volumes) != 1 || volumes[0].(map[string]interface{})["name"] != "pv-1" {
+		t.Errorf("expected the volume of the fast class, got %v", volumes)
+	}
+
+	// Claims relate to their class even before they're bound
+	result = executeTestQuery(t, q, `MATCH (pvc:PersistentVolumeClaim)->(sc:StorageClass) WHERE sc.metadata.name = "fast" RETURN pvc.metadata.name`)
+	if claims := result.Data["pvc"].([]interface{}); len(claims) != 2 {
+		t.Errorf("expected the bound and pending claims of the fast class, got %v", claims)
+	}
+}
+
+func TestRoutingRelationships(t *testing.T) {
+	pod := func(name, app string) *unstructured.Unstructured {
+		object := newTestObject("v1", "Pod", "default", name, map[string]interface{}{
+			"status": map[string]interface{}{"podIP": "10.0.0." + name[len(name)-1:]},
+		})
+		object.SetLabels(map[string]string{"app": app})
+		return object
+	}
+	service := func(name, app string) *unstructured.Unstructured {
+		return newTestObject("v1", "Service", "default", name, map[string]interface{}{
+			"spec": map[string]interface{}{"selector": map[string]interface{}{"app": app}},
+		})
+	}
+	q := newTestQueryExecutor(t,
+		pod("web-1", "web"),
+		pod("api-2", "api"),
+		pod("admin-3", "admin"),
+		service("web", "web"),
+		service("api", "api"),
+		service("admin", "admin"),
+		newTestObject("networking.k8s.io/v1", "Ingress", "default", "shop", map[string]interface{}{
+			"spec": map[string]interface{}{
+				"defaultBackend": map[string]interface{}{"service": map[string]interface{}{"name": "web"}},
+				"rules": []interface{}{map[string]interface{}{
+					"host": "shop.example.com",
+					"http": map[string]interface{}{"paths": []interface{}{
+						map[string]interface{}{"path": "/api", "backend": map[string]interface{}{"service": map[string]interface{}{"name": "api"}}},
+					}},
+				}},
+			},
+		}),
+		newTestObject("gateway.networking.k8s.io/v1", "HTTPRoute", "default", "admin", map[string]interface{}{
+			"spec": map[string]interface{}{
+				"parentRefs": []interface{}{map[string]interface{}{"name": "internal"}},
+				"rules": []interface{}{map[string]interface{}{
+					"backendRefs": []interface{}{map[string]interface{}{"name": "admin", "port": int64(8080)}},
+				}},
+			},
+		}),
+	)
+	// The fake client would guess the resource of gateways to be "gatewaies"
+	gateways := schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "gateways"}
+	for _, name := range []string{"internal", "public"} {
+		gateway := newTestObject("gateway.networking.k8s.io/v1", "Gateway", "default", name, nil)
+		if _, err := q.DynamicClient.Resource(gateways).Namespace("default").Create(context.Background(), gateway, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Ingresses reach the pods behind the services of their paths and of their default backend
+	result := executeTestQuery(t, q, `MATCH (i:Ingress)->(s:Service)->(p:Pod) RETURN i.spec.rules[0].host, p.status.podIP`)
+	ips := []string{}
+	for _, pod := range result.Data["p"].([]interface{}) {
+		ips = append(ips, pod.(map[string]interface{})["status"].(map[string]interface{})["podIP"].(string))
+	}
+	if !reflect.DeepEqual(ips, []string{"10.0.0.1", "10.0.0.2"}) && !reflect.DeepEqual(ips, []string{"10.0.0.2", "10.0.0.1"}) {
+		t.Errorf("expected the pods behind the ingress, got %v", ips)
+	}
+
+	// Gateways reach the pods behind the backends of the routes attached to them
+	result = executeTestQuery(t, q, `MATCH (g:Gateway)->(r:HTTPRoute)->(s:Service)->(p:Pod) RETURN g.metadata.name, p.metadata.name`)
+	if pods := result.Data["p"].([]interface{}); len(pods) != 1 || pods[0].(map[string]interface{})["name"] != "admin-3" {
+		t.Errorf("expected the pod behind the route, got %v", pods)
+	}
+	if gateways := result.Data["g"].([]interface{}); len(gateways) != 1 || gateways[0].(map[string]interface{})["name"] != "internal" {
+		t.Errorf("expected the gateway the route is attached to, got %v", gateways)
+	}
+}
+
+func TestRBACRelationships(t *testing.T) {
+	rbac := "rbac.authorization.k8s.io/v1"
+	binding := func(kind, namespace, name, roleKind, role string, subjects ...interface{}) *unstructured.Unstructured {
+		return newTestObject(rbac, kind, namespace, name, map[string]interface{}{
+			"roleRef":  map[string]interface{}{"apiGroup": "rbac.authorization.k8s.io", "kind": roleKind, "name": role},
+			"subjects": subjects,
+		})
+	}
+	subject := func(kind, namespace, name string) interface{} {
+		return map[string]interface{}{"kind": kind, "namespace": namespace, "name": name}
+	}
+	q := newTestQueryExecutor(t,
+		newTestObject("v1", "ServiceAccount", "default", "ci", nil),
+		newTestObject("v1", "ServiceAccount", "default", "web", nil),
+		newTestObject("v1", "ServiceAccount", "other", "ci", nil),
+		newTestObject("v1", "Pod", "default", "build", map[string]interface{}{"spec": map[string]interface{}{"serviceAccountName": "ci"}}),
+		newTestObject("v1", "Pod", "default", "frontend", map[string]interface{}{"spec": map[string]interface{}{"serviceAccountName": "web"}}),
+		newTestObject(rbac, "ClusterRole", "", "edit", map[string]interface{}{"rules": []interface{}{map[string]interface{}{"verbs": []interface{}{"create", "delete"}}}}),
+		newTestObject(rbac, "ClusterRole", "", "cluster-admin", nil),
+		newTestObject(rbac, "Role", "default", "edit", map[string]interface{}{"rules": []interface{}{map[string]interface{}{"verbs": []interface{}{"get"}}}}),
+		// The user sharing the name of the service account isn't it
+		binding("RoleBinding", "default", "deployers", "ClusterRole", "edit", subject("User", "", "web"), subject("ServiceAccount", "default", "ci")),
+		binding("RoleBinding", "default", "readers", "Role", "edit", subject("ServiceAccount", "default", "web")),
+		binding("ClusterRoleBinding", "", "admins", "ClusterRole", "cluster-admin", subject("ServiceAccount", "other", "ci")),
+	)
+	names := func(result QueryResult, node string) []string {
+		list := []string{}
+		for _, resource := range result.Data[node].([]interface{}) {
+			list = append(list, resource.(map[string]interface{})["name"].(string))
+		}
+		return list
+	}
+
+	// Bindings grant the cluster role of their roleRef rather than the role of the same name
+	result := executeTestQuery(t, q, `MATCH (sa:ServiceAccount)<-(rb:RoleBinding)->(r:ClusterRole) WHERE r.metadata.name = "edit" RETURN sa.metadata.name, rb.metadata.name`)
+	if got := names(result, "sa"); !reflect.DeepEqual(got, []string{"ci"}) {
+		t.Errorf("expected the service account the edit cluster role is granted to, got %v", got)
+	}
+	result = executeTestQuery(t, q, `MATCH (rb:RoleBinding)->(r:Role) RETURN rb.metadata.name`)
+	if got := names(result, "rb"); !reflect.DeepEqual(got, []string{"readers"}) {
+		t.Errorf("expected the binding of the role, got %v", got)
+	}
+
+	// Subjects are service accounts of their namespace
+	result = executeTestQuery(t, q, `MATCH (crb:ClusterRoleBinding)->(sa:ServiceAccount) RETURN sa.metadata.name`)
+	if got := names(result, "sa"); len(got) != 0 {
+		t.Errorf("expected no service account of the default namespace to be an admin, got %v", got)
+	}
+	result = executeTestQuery(t, q, `MATCH (crb:ClusterRoleBinding)->(sa:ServiceAccount {namespace: "other"}) RETURN sa.metadata.name`)
+	if got := names(result, "sa"); !reflect.DeepEqual(got, []string{"ci"}) {
+		t.Errorf("expected the admin service account of the other namespace, got %v", got)
+	}
+
+	// What pods may do, through the service accounts they run as
+	result = executeTestQuery(t, q, `MATCH (p:Pod)->(sa:ServiceAccount)<-(rb:RoleBinding)->(r:ClusterRole) RETURN p.metadata.name, r.rules`)
+	if got := names(result, "p"); !reflect.DeepEqual(got, []string{"build"}) {
+		t.Errorf("expected the pod running as the service account granted a cluster role, got %v", got)
+	}
+}
+
+func TestNodeRelationships(t *testing.T) {
+	pod := func(namespace, name, node string) *unstructured.Unstructured {
+		return newTestObject("v1", "Pod", namespace, name, map[string]interface{}{"spec": map[string]interface{}{"nodeName": node}})
+	}
+	q := newTestQueryExecutor(t,
+		newTestObject("v1", "Node", "", "ip-10-0-1-5", nil),
+		newTestObject("v1", "Node", "", "ip-10-0-1-6", nil),
+		pod("default", "web-1", "ip-10-0-1-5"),
+		pod("default", "web-2", "ip-10-0-1-6"),
+		pod("data", "db-1", "ip-10-0-1-5"),
+		// Pods the scheduler hasn't bound yet run on no node
+		newTestObject("v1", "Pod", "default", "pending", nil),
+	)
+
+	// Everything on a node, whatever its namespace. The fake client ignores the field selector {name: ...} is read
+	// with, so the node is filtered by WHERE.
+	AllNamespaces = true
+	result := executeTestQuery(t, q, `MATCH (n:Node)<-(p:Pod) WHERE n.metadata.name = "ip-10-0-1-5" RETURN p.metadata.namespace, p.metadata.name`)
+	pods := []string{}
+	for _, resource := range result.Data["p"].([]interface{}) {
+		metadata := resource.(map[string]interface{})["metadata"].(map[string]interface{})
+		pods = append(pods, metadata["namespace"].(string)+"/"+metadata["name"].(string))
+	}
+	slices.Sort(pods)
+	if want := []string{"data/db-1", "default/web-1"}; !reflect.DeepEqual(pods, want) {
+		t.Errorf("expected the pods running on the node, got %v", pods)
+	}
+
+	result = executeTestQuery(t, q, `MATCH (p:Pod)->(n:Node) RETURN p.metadata.name, n.metadata.name`)
+	if pods := result.Data["p"].([]interface{}); len(pods) != 2 {
+		t.Errorf("expected the scheduled pods of the default namespace, got %v", pods)
+	}
+}
+
+func TestEventRelationships(t *testing.T) {
+	event := func(namespace, name, kind, object, reason, last string) *unstructured.Unstructured {
+		return newTestObject("v1", "Event", namespace, name, map[string]interface{}{
+			"involvedObject": map[string]interface{}{"kind": kind, "name": object, "namespace": namespace},
+			"reason":         reason,
+			"lastTimestamp":  last,
+		})
+	}
+	q := newTestQueryExecutor(t,
+		newTestObject("v1", "Pod", "default", "web-1", nil),
+		newTestObject("v1", "Pod", "default", "web-2", nil),
+		newTestObject("v1", "ConfigMap", "default", "web-1", nil),
+		newTestObject("v1", "Node", "", "ip-10-0-1-5", nil),
+		event("default", "web-1.b", "Pod", "web-1", "BackOff", "2024-05-01T10:05:00Z"),
+		event("default", "web-1.a", "Pod", "web-1", "Pulled", "2024-05-01T10:00:00Z"),
+		event("default", "web-2.a", "Pod", "web-2", "Scheduled", "2024-05-01T09:00:00Z"),
+		// Events of cluster-scoped resources are in the default namespace
+		event("default", "ip-10-0-1-5.a", "Node", "ip-10-0-1-5", "NodeNotReady", "2024-05-01T11:00:00Z"),
+	)
+	reasons := func(result QueryResult) []string {
+		reasons := []string{}
+		for _, row := range result.Data["e"].([]interface{}) {
+			reasons = append(reasons, row.(map[string]interface{})["reason"].(string))
+		}
+		return reasons
+	}
+
+	// The events of a pod, not those of the ConfigMap of the same name, latest first
+	result := executeTestQuery(t, q, `MATCH (p:Pod)-[:HAS_EVENT]->(e:Event) WHERE p.metadata.name = "web-1" RETURN e.reason, e.message ORDER BY e.lastTimestamp DESC`)
+	if got, want := reasons(result), []string{"BackOff", "Pulled"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the events of the pod, got %v", got)
+	}
+
+	result = executeTestQuery(t, q, `MATCH (e:Event)<-(n:Node) RETURN e.reason`)
+	if got, want := reasons(result), []string{"NodeNotReady"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the events of the node, got %v", got)
+	}
+
+	// Relationships of a kind to Events take precedence over the rule relating every kind to them
+	rules := []RelationshipRule{{KindA: "events", KindB: "configmaps", Relationship: "CUSTOM_EVENT", MatchCriteria: []MatchCriterion{
+		{FieldA: "$.reason", FieldB: "$.metadata.name", ComparisonType: ExactMatch},
+	}}}
+	if err := SetCustomRelationships(rules); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetCustomRelationships(nil) })
+	result = executeTestQuery(t, q, `MATCH (c:ConfigMap)->(e:Event) RETURN e.reason`)
+	if events, _ := result.Data["e"].([]interface{}); len(events) != 0 {
+		t.Errorf("expected the custom relationship, got %v", events)
+	}
+}
+
+func TestNetworkPolicyRelationships(t *testing.T) {
+	pod := func(namespace, app string) *unstructured.Unstructured {
+		object := newTestObject("v1", "Pod", namespace, app, nil)
+		object.SetLabels(map[string]string{"app": app})
+		return object
+	}
+	selector := func(key, value string) map[string]interface{} {
+		return map[string]interface{}{"matchLabels": map[string]interface{}{key: value}}
+	}
+	monitoring := newTestObject("v1", "Namespace", "", "monitoring", nil)
+	monitoring.SetLabels(map[string]string{"team": "observability"})
+	q := newTestQueryExecutor(t,
+		pod("default", "web"),
+		pod("default", "api"),
+		pod("default", "db"),
+		pod("monitoring", "prometheus"),
+		newTestObject("v1", "Namespace", "", "default", nil),
+		monitoring,
+		// Only the api reaches the database
+		newTestObject("networking.k8s.io/v1", "NetworkPolicy", "default", "db", map[string]interface{}{"spec": map[string]interface{}{
+			"podSelector": selector("app", "db"),
+			"ingress":     []interface{}{map[string]interface{}{"from": []interface{}{map[string]interface{}{"podSelector": selector("app", "api")}}}},
+		}}),
+		// The api only sends traffic to the database
+		newTestObject("networking.k8s.io/v1", "NetworkPolicy", "default", "api", map[string]interface{}{"spec": map[string]interface{}{
+			"podSelector": selector("app", "api"),
+			"policyTypes": []interface{}{"Egress"},
+			"egress":      []interface{}{map[string]interface{}{"to": []interface{}{map[string]interface{}{"podSelector": selector("app", "db")}}}},
+		}}),
+		// The web pods are only scraped by the observability namespaces
+		newTestObject("networking.k8s.io/v1", "NetworkPolicy", "default", "web", map[string]interface{}{"spec": map[string]interface{}{
+			"podSelector": selector("app", "web"),
+			"ingress": []interface{}{map[string]interface{}{
+				"from":  []interface{}{map[string]interface{}{"namespaceSelector": selector("team", "observability")}},
+				"ports": []interface{}{map[string]interface{}{"port": int64(9090)}},
+			}},
+		}}),
+	)
+	names := func(result QueryResult, node string) []string {
+		list := []string{}
+		for _, resource := range result.Data[node].([]interface{}) {
+			list = append(list, resource.(map[string]interface{})["name"].(string))
+		}
+		slices.Sort(list)
+		return list
+	}
+
+	result := executeTestQuery(t, q, `MATCH (a:Pod)-[r:CAN_REACH]->(b:Pod) RETURN r`)
+	reaches := []string{}
+	for _, link := range result.Data["r"].([]interface{}) {
+		link := link.(map[string]interface{})
+		reaches = append(reaches, link["from"].(map[string]interface{})["name"].(string)+" -> "+link["to"].(map[string]interface{})["name"].(string))
+	}
+	slices.Sort(reaches)
+	if want := []string{"api -> db", "db -> api", "web -> api"}; !reflect.DeepEqual(reaches, want) {
+		t.Errorf("expected the traffic the policies allow, got %v", reaches)
+	}
+
+	// The relationship follows its arrow
+	result = executeTestQuery(t, q, `MATCH (b:Pod {app: "db"})<-[:CAN_REACH]-(a:Pod) RETURN a.metadata.name`)
+	if got := names(result, "a"); !reflect.DeepEqual(got, []string{"api"}) {
+		t.Errorf("expected the pods reaching the database, got %v", got)
+	}
+
+	// Peers of other namespaces are selected by the labels of their namespace
+	AllNamespaces = true
+	result = executeTestQuery(t, q, `MATCH (a:Pod {app: "prometheus"})-[:CAN_REACH]->(b:Pod) RETURN b.metadata.name`)
+	if got := names(result, "b"); !reflect.DeepEqual(got, []string{"api", "web"}) {
+		t.Errorf("expected the pods prometheus reaches, got %v", got)
+	}
+
+	result = executeTestQuery(t, q, `EXPLAIN MATCH (a:Pod)-[:CAN_REACH]->(b:Pod) RETURN b`)
+	if plan := result.Data["plan"].(*QueryPlan).Relationships[0]; plan.Relationship != string(CanReach) || len(plan.Criteria) != 1 {
+		t.Errorf("expected the join to be evaluated from the NetworkPolicies, got %+v", plan)
+	}
+
+	ast, err := ParseQuery(`MATCH (a:Pod {app: "web"}) CREATE (a)-[:CAN_REACH]->(b:Pod)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Execute(ast, "default"); DiagnosticCodeOf(err) != CodeCreateAnalyzedRelationship {
+		t.Errorf("expected code %s, got %v", CodeCreateAnalyzedRelationship, err)
+	}
+}
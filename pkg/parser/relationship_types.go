@@ -9,30 +9,52 @@ type ResourceRelationship struct {
 type RelationshipType string
 
 const (
-	DeploymentOwnReplicaset        RelationshipType = "DEPLOYMENT_OWN_REPLICASET"
-	ReplicasetOwnPod               RelationshipType = "REPLICASET_OWN_POD"
-	StatefulsetOwnPod              RelationshipType = "STATEFULSET_OWN_POD"
-	DaemonsetOwnPod                RelationshipType = "DAEMONSET_OWN_POD"
-	JobOwnPod                      RelationshipType = "JOB_OWN_POD"
-	ServiceExposePod               RelationshipType = "SERVICE_EXPOSE_POD"
-	ServiceExposeDeployment        RelationshipType = "SERVICE_EXPOSE_DEPLOYMENT"
-	ServiceExposeStatefulset       RelationshipType = "SERVICE_EXPOSE_STATEFULSET"
-	ServiceExposeDaemonset         RelationshipType = "SERVICE_EXPOSE_DAEMONSET"
-	ServiceExposeReplicaset        RelationshipType = "SERVICE_EXPOSE_REPLICASET"
-	CronJobOwnPod                  RelationshipType = "CRONJOB_OWN_POD"
-	CronJobOwnJob                  RelationshipType = "CRONJOB_OWN_JOB"
-	ServiceHasEndpoints            RelationshipType = "SERVICE_HAS_ENDPOINTS"
-	NetworkPolicyApplyPod          RelationshipType = "NETWORKPOLICY_APPLY_POD"
-	HPAScaleDeployment             RelationshipType = "HPA_SCALE_DEPLOYMENT"
-	RoleBindingReferenceRole       RelationshipType = "ROLEBINDING_REFERENCE_ROLE"
-	MutatingWebhookTargetService   RelationshipType = "MUTATINGWEBHOOK_TARGET_SERVICE"
-	ValidatingWebhookTargetService RelationshipType = "VALIDATINGWEBHOOK_TARGET_SERVICE"
-	PDBProtectPod                  RelationshipType = "PDB_PROTECT_POD"
+	DeploymentOwnReplicaset                RelationshipType = "DEPLOYMENT_OWN_REPLICASET"
+	ReplicasetOwnPod                       RelationshipType = "REPLICASET_OWN_POD"
+	StatefulsetOwnPod                      RelationshipType = "STATEFULSET_OWN_POD"
+	DaemonsetOwnPod                        RelationshipType = "DAEMONSET_OWN_POD"
+	JobOwnPod                              RelationshipType = "JOB_OWN_POD"
+	ServiceExposePod                       RelationshipType = "SERVICE_EXPOSE_POD"
+	ServiceExposeDeployment                RelationshipType = "SERVICE_EXPOSE_DEPLOYMENT"
+	ServiceExposeStatefulset               RelationshipType = "SERVICE_EXPOSE_STATEFULSET"
+	ServiceExposeDaemonset                 RelationshipType = "SERVICE_EXPOSE_DAEMONSET"
+	ServiceExposeReplicaset                RelationshipType = "SERVICE_EXPOSE_REPLICASET"
+	CronJobOwnPod                          RelationshipType = "CRONJOB_OWN_POD"
+	CronJobOwnJob                          RelationshipType = "CRONJOB_OWN_JOB"
+	ServiceHasEndpoints                    RelationshipType = "SERVICE_HAS_ENDPOINTS"
+	NetworkPolicyApplyPod                  RelationshipType = "NETWORKPOLICY_APPLY_POD"
+	HPAScaleDeployment                     RelationshipType = "HPA_SCALE_DEPLOYMENT"
+	RoleBindingReferenceRole               RelationshipType = "ROLEBINDING_REFERENCE_ROLE"
+	MutatingWebhookTargetService           RelationshipType = "MUTATINGWEBHOOK_TARGET_SERVICE"
+	ValidatingWebhookTargetService         RelationshipType = "VALIDATINGWEBHOOK_TARGET_SERVICE"
+	PDBProtectPod                          RelationshipType = "PDB_PROTECT_POD"
+	PodUseConfigMap                        RelationshipType = "POD_USE_CONFIGMAP"
+	PodUseSecret                           RelationshipType = "POD_USE_SECRET"
+	DeploymentUseConfigMap                 RelationshipType = "DEPLOYMENT_USE_CONFIGMAP"
+	DeploymentUseSecret                    RelationshipType = "DEPLOYMENT_USE_SECRET"
+	PodUsePVC                              RelationshipType = "POD_USE_PVC"
+	DeploymentUsePVC                       RelationshipType = "DEPLOYMENT_USE_PVC"
+	PVCBindPV                              RelationshipType = "PVC_BIND_PV"
+	PVUseStorageClass                      RelationshipType = "PV_USE_STORAGECLASS"
+	PVCUseStorageClass                     RelationshipType = "PVC_USE_STORAGECLASS"
+	HTTPRouteBackendService                RelationshipType = "HTTPROUTE_BACKEND_SERVICE"
+	HTTPRouteAttachGateway                 RelationshipType = "HTTPROUTE_ATTACH_GATEWAY"
+	RoleBindingReferenceClusterRole        RelationshipType = "ROLEBINDING_REFERENCE_CLUSTERROLE"
+	ClusterRoleBindingReferenceClusterRole RelationshipType = "CLUSTERROLEBINDING_REFERENCE_CLUSTERROLE"
+	RoleBindingBindServiceAccount          RelationshipType = "ROLEBINDING_BIND_SERVICEACCOUNT"
+	ClusterRoleBindingBindServiceAccount   RelationshipType = "CLUSTERROLEBINDING_BIND_SERVICEACCOUNT"
+	PodUseServiceAccount                   RelationshipType = "POD_USE_SERVICEACCOUNT"
+	// pods to the nodes they're scheduled to
+	PodRunOnNode RelationshipType = "POD_RUN_ON_NODE"
 	// ingresses to services
 	Route RelationshipType = "ROUTE"
+	// pods to the pods their NetworkPolicies let them send traffic to
+	CanReach RelationshipType = "CAN_REACH"
 
 	// special relationships
 	NamespaceHasResource RelationshipType = "NAMESPACE_HAS_RESOURCE"
+	// resources of any kind to the Events about them
+	ResourceHasEvent RelationshipType = "HAS_EVENT"
 )
 
 type ComparisonType string
@@ -61,6 +83,76 @@ type RelationshipRule struct {
 	Relationship RelationshipType
 	// Currently only supports one match criterion but can be extended to support multiple
 	MatchCriteria []MatchCriterion
+	// MatchAny relates resources matching any of the criteria rather than all of them
+	MatchAny bool
+	// analyzer, for rules without criteria, tells which resources of the cluster relate those of the rule, match
+	// relating them once the executor has evaluated those resources
+	analyzer relationshipAnalyzer
+	match    func(resourceA, resourceB interface{}) bool
+}
+
+// clusterRoleReferenceCriteria relate bindings to the ClusterRole of their roleRef, rather than to a Role of the
+// same name
+var clusterRoleReferenceCriteria = []MatchCriterion{
+	{
+		FieldA:         "$.roleRef.name",
+		FieldB:         "$.metadata.name",
+		ComparisonType: ExactMatch,
+	},
+	{
+		FieldA:         "$.roleRef.kind",
+		FieldB:         "$.kind",
+		ComparisonType: ExactMatch,
+	},
+}
+
+// serviceAccountSubjectCriteria relate bindings to the service accounts among their subjects, which may also be users
+// and groups of the same names
+var serviceAccountSubjectCriteria = []MatchCriterion{
+	{
+		FieldA:         "$.subjects[?(@.kind == 'ServiceAccount')].name",
+		FieldB:         "$.metadata.name",
+		ComparisonType: ExactMatch,
+	},
+	{
+		FieldA:         "$.subjects[?(@.kind == 'ServiceAccount')].namespace",
+		FieldB:         "$.metadata.namespace",
+		ComparisonType: ExactMatch,
+	},
+}
+
+// configMapReferences are the fields of a pod spec naming the ConfigMaps it consumes
+var configMapReferences = []string{
+	"containers[].env[].valueFrom.configMapKeyRef.name",
+	"containers[].envFrom[].configMapRef.name",
+	"initContainers[].env[].valueFrom.configMapKeyRef.name",
+	"initContainers[].envFrom[].configMapRef.name",
+	"volumes[].configMap.name",
+	"volumes[].projected.sources[].configMap.name",
+}
+
+// secretReferences are the fields of a pod spec naming the Secrets it consumes
+var secretReferences = []string{
+	"containers[].env[].valueFrom.secretKeyRef.name",
+	"containers[].envFrom[].secretRef.name",
+	"initContainers[].env[].valueFrom.secretKeyRef.name",
+	"initContainers[].envFrom[].secretRef.name",
+	"volumes[].secret.secretName",
+	"volumes[].projected.sources[].secret.name",
+	"imagePullSecrets[].name",
+}
+
+// podSpecReferenceCriteria matches the resources named by any of the references of the pod spec at specPath
+func podSpecReferenceCriteria(specPath string, references []string) []MatchCriterion {
+	criteria := []MatchCriterion{}
+	for _, reference := range references {
+		criteria = append(criteria, MatchCriterion{
+			FieldA:         specPath + "." + reference,
+			FieldB:         "$.metadata.name",
+			ComparisonType: ExactMatch,
+		})
+	}
+	return criteria
 }
 
 var relationshipRules = []RelationshipRule{
@@ -136,6 +228,12 @@ var relationshipRules = []RelationshipRule{
 			},
 		},
 	},
+	{
+		KindA:        "pods",
+		KindB:        "pods",
+		Relationship: CanReach,
+		analyzer:     analyzeNetworkPolicies,
+	},
 	{
 		KindA:        "horizontalpodautoscalers",
 		KindB:        "deployments",
@@ -230,7 +328,13 @@ var relationshipRules = []RelationshipRule{
 					},
 				},
 			},
+			{
+				FieldA:         "$.spec.defaultBackend.service.name",
+				FieldB:         "$.metadata.name",
+				ComparisonType: ExactMatch,
+			},
 		},
+		MatchAny: true,
 	},
 	{
 		KindA:        "replicasets",
@@ -344,6 +448,197 @@ var relationshipRules = []RelationshipRule{
 			},
 		},
 	},
+	{
+		KindA:         "pods",
+		KindB:         "configmaps",
+		Relationship:  PodUseConfigMap,
+		MatchCriteria: podSpecReferenceCriteria("$.spec", configMapReferences),
+		MatchAny:      true,
+	},
+	{
+		KindA:         "pods",
+		KindB:         "secrets",
+		Relationship:  PodUseSecret,
+		MatchCriteria: podSpecReferenceCriteria("$.spec", secretReferences),
+		MatchAny:      true,
+	},
+	{
+		KindA:         "deployments",
+		KindB:         "configmaps",
+		Relationship:  DeploymentUseConfigMap,
+		MatchCriteria: podSpecReferenceCriteria("$.spec.template.spec", configMapReferences),
+		MatchAny:      true,
+	},
+	{
+		KindA:         "deployments",
+		KindB:         "secrets",
+		Relationship:  DeploymentUseSecret,
+		MatchCriteria: podSpecReferenceCriteria("$.spec.template.spec", secretReferences),
+		MatchAny:      true,
+	},
+	// Gateway API: routes attach to gateways and send traffic to their backend services
+	{
+		KindA:        "httproutes",
+		KindB:        "services",
+		Relationship: HTTPRouteBackendService,
+		MatchCriteria: []MatchCriterion{
+			{
+				FieldA:         "$.spec.rules[].backendRefs[].name",
+				FieldB:         "$.metadata.name",
+				ComparisonType: ExactMatch,
+			},
+		},
+	},
+	{
+		KindA:        "httproutes",
+		KindB:        "gateways",
+		Relationship: HTTPRouteAttachGateway,
+		MatchCriteria: []MatchCriterion{
+			{
+				FieldA:         "$.spec.parentRefs[].name",
+				FieldB:         "$.metadata.name",
+				ComparisonType: ExactMatch,
+			},
+		},
+	},
+	// RBAC: bindings grant the role they reference to their subjects, and pods run as their service account
+	{
+		KindA:        "rolebindings",
+		KindB:        "roles",
+		Relationship: RoleBindingReferenceRole,
+		MatchCriteria: []MatchCriterion{
+			{
+				FieldA:         "$.roleRef.name",
+				FieldB:         "$.metadata.name",
+				ComparisonType: ExactMatch,
+			},
+			{
+				FieldA:         "$.roleRef.kind",
+				FieldB:         "$.kind",
+				ComparisonType: ExactMatch,
+			},
+			{
+				FieldA:         "$.metadata.namespace",
+				FieldB:         "$.metadata.namespace",
+				ComparisonType: ExactMatch,
+			},
+		},
+	},
+	{
+		KindA:         "rolebindings",
+		KindB:         "clusterroles",
+		Relationship:  RoleBindingReferenceClusterRole,
+		MatchCriteria: clusterRoleReferenceCriteria,
+	},
+	{
+		KindA:         "clusterrolebindings",
+		KindB:         "clusterroles",
+		Relationship:  ClusterRoleBindingReferenceClusterRole,
+		MatchCriteria: clusterRoleReferenceCriteria,
+	},
+	{
+		KindA:         "rolebindings",
+		KindB:         "serviceaccounts",
+		Relationship:  RoleBindingBindServiceAccount,
+		MatchCriteria: serviceAccountSubjectCriteria,
+	},
+	{
+		KindA:         "clusterrolebindings",
+		KindB:         "serviceaccounts",
+		Relationship:  ClusterRoleBindingBindServiceAccount,
+		MatchCriteria: serviceAccountSubjectCriteria,
+	},
+	{
+		KindA:        "pods",
+		KindB:        "serviceaccounts",
+		Relationship: PodUseServiceAccount,
+		MatchCriteria: []MatchCriterion{
+			{
+				FieldA:         "$.spec.serviceAccountName",
+				FieldB:         "$.metadata.name",
+				ComparisonType: ExactMatch,
+			},
+			{
+				FieldA:         "$.metadata.namespace",
+				FieldB:         "$.metadata.namespace",
+				ComparisonType: ExactMatch,
+			},
+		},
+	},
+	// Scheduling: pods run on the node the scheduler bound them to, unscheduled pods on none
+	{
+		KindA:        "pods",
+		KindB:        "nodes",
+		Relationship: PodRunOnNode,
+		MatchCriteria: []MatchCriterion{
+			{
+				FieldA:         "$.spec.nodeName",
+				FieldB:         "$.metadata.name",
+				ComparisonType: ExactMatch,
+			},
+		},
+	},
+	// Storage: pods mount claims, claims are bound to volumes, and both are provisioned by storage classes
+	{
+		KindA:        "pods",
+		KindB:        "persistentvolumeclaims",
+		Relationship: PodUsePVC,
+		MatchCriteria: []MatchCriterion{
+			{
+				FieldA:         "$.spec.volumes[].persistentVolumeClaim.claimName",
+				FieldB:         "$.metadata.name",
+				ComparisonType: ExactMatch,
+			},
+		},
+	},
+	{
+		KindA:        "deployments",
+		KindB:        "persistentvolumeclaims",
+		Relationship: DeploymentUsePVC,
+		MatchCriteria: []MatchCriterion{
+			{
+				FieldA:         "$.spec.template.spec.volumes[].persistentVolumeClaim.claimName",
+				FieldB:         "$.metadata.name",
+				ComparisonType: ExactMatch,
+			},
+		},
+	},
+	{
+		KindA:        "persistentvolumeclaims",
+		KindB:        "persistentvolumes",
+		Relationship: PVCBindPV,
+		MatchCriteria: []MatchCriterion{
+			{
+				FieldA:         "$.spec.volumeName",
+				FieldB:         "$.metadata.name",
+				ComparisonType: ExactMatch,
+			},
+		},
+	},
+	{
+		KindA:        "persistentvolumes",
+		KindB:        "storageclasses",
+		Relationship: PVUseStorageClass,
+		MatchCriteria: []MatchCriterion{
+			{
+				FieldA:         "$.spec.storageClassName",
+				FieldB:         "$.metadata.name",
+				ComparisonType: ExactMatch,
+			},
+		},
+	},
+	{
+		KindA:        "persistentvolumeclaims",
+		KindB:        "storageclasses",
+		Relationship: PVCUseStorageClass,
+		MatchCriteria: []MatchCriterion{
+			{
+				FieldA:         "$.spec.storageClassName",
+				FieldB:         "$.metadata.name",
+				ComparisonType: ExactMatch,
+			},
+		},
+	},
 	// Special case for namespaces
 	{
 		KindA:        "namespaces",
@@ -357,4 +652,23 @@ var relationshipRules = []RelationshipRule{
 			},
 		},
 	},
+	// Events name the resource they're about by kind and name, in their namespace or, for cluster-scoped resources
+	// such as nodes, in the default namespace
+	{
+		KindA:        "events",
+		KindB:        "*",
+		Relationship: ResourceHasEvent,
+		MatchCriteria: []MatchCriterion{
+			{
+				FieldA:         "$.involvedObject.kind",
+				FieldB:         "$.kind",
+				ComparisonType: ExactMatch,
+			},
+			{
+				FieldA:         "$.involvedObject.name",
+				FieldB:         "$.metadata.name",
+				ComparisonType: ExactMatch,
+			},
+		},
+	},
 }
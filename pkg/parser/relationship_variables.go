@@ -0,0 +1,236 @@
+package parser
+
+import (
+	"slices"
+	"strings"
+)
+
+// A relationship variable, e.g. r in (s:Service)-[r]->(p:Pod), binds the links between the resources a relationship
+// joins. Each link is a record describing how the two resources are related, which RETURN projects like a resource:
+//
+//	type  the relationship's type, e.g. SERVICE_EXPOSE_POD, which type(r) returns
+//	link  how the resources are linked: ownerReference, selector, volume, env, namespace or reference
+//	field the field of one resource that refers to the other, e.g. spec.selector
+//	from  the kind, name and namespace of the resource the relationship starts from
+//	to    those of the resource it goes to
+//	port  the first port of the Service, if one of the resources is a Service, and ports all its ports
+//
+// A variable-length relationship's links are paths instead, with the number of hops and the kinds gone through.
+
+// Kinds of links between two related resources
+const (
+	LinkOwnerReference = "ownerReference"
+	LinkSelector       = "selector"
+	LinkVolume         = "volume"
+	LinkEnv            = "env"
+	LinkNamespace      = "namespace"
+	LinkReference      = "reference"
+	LinkPath           = "path"
+)
+
+// bindRelationshipVariables binds the variables of a MATCH clause's relationships to the links between the
+// resources the clause matched
+func (q *QueryExecutor) bindRelationshipVariables(c *MatchClause) error {
+	for _, rel := range c.Relationships {
+		if rel.ResourceProperties == nil || rel.ResourceProperties.Name == "" || rel.LeftNode == nil || rel.RightNode == nil {
+			continue
+		}
+		name := rel.ResourceProperties.Name
+		for _, node := range c.Nodes {
+			if node.ResourceProperties.Name == name {
+				return newDiagnosticError(CodeRelationshipVariable, nil, "name", name)
+			}
+		}
+		links, err := q.relationshipLinks(rel)
+		if err != nil {
+			return err
+		}
+		q.resultMap[name] = links
+		q.resultSources[name] = resultSource{source: ProvenanceComputed}
+		if !slices.Contains(q.relationshipVariables, name) {
+			q.relationshipVariables = append(q.relationshipVariables, name)
+		}
+	}
+	return nil
+}
+
+// relationshipLinks lists the links between each pair of resources a relationship joins
+func (q *QueryExecutor) relationshipLinks(rel *Relationship) ([]map[string]interface{}, error) {
+	left, _ := q.resultMap[rel.LeftNode.ResourceProperties.Name].([]map[string]interface{})
+	right, _ := q.resultMap[rel.RightNode.ResourceProperties.Name].([]map[string]interface{})
+	links := []map[string]interface{}{}
+
+	if rel.Hops != nil {
+		paths, err := q.relationshipPaths(rel)
+		if err != nil {
+			return nil, err
+		}
+		// A pair of resources several chains join has a single link, of the shortest chain
+		joined := map[[2]string]bool{}
+		for _, path := range paths {
+			reached, err := q.traverse(left, right, path.kinds, path.rules)
+			if err != nil {
+				return nil, err
+			}
+			for i, resources := range reached {
+				for _, resource := range resources {
+					pair := [2]string{linkEndKey(linkEnd(left[i])), linkEndKey(linkEnd(resource))}
+					if joined[pair] {
+						continue
+					}
+					joined[pair] = true
+					link := newRelationshipLink(rel, left[i], resource, path.relationship(), LinkPath)
+					link["hops"] = len(path.rules)
+					link["kinds"] = slices.Clone(path.kinds)
+					links = append(links, link)
+				}
+			}
+		}
+		return links, nil
+	}
+
+	if isKindlessRelationship(rel) {
+		known, kind, unknown, err := q.kindlessNodes(rel)
+		if err != nil {
+			return nil, err
+		}
+		knownResources, _ := q.resultMap[known.ResourceProperties.Name].([]map[string]interface{})
+		unknownResources, _ := q.resultMap[unknown.ResourceProperties.Name].([]map[string]interface{})
+		related, err := q.relatedResources(knownResources, kind)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range related {
+			if !containsResource(unknownResources, r.related) {
+				continue
+			}
+			left, right := r.known, r.related
+			if unknown == rel.LeftNode {
+				left, right = right, left
+			}
+			linkKind, field := LinkOwnerReference, "metadata.ownerReferences"
+			if r.rule != nil {
+				linkKind, field = relationshipLinkKind(*r.rule, linkCriterion(*r.rule, kind.Resource, r.known, r.related))
+			}
+			link := newRelationshipLink(rel, left, right, r.relationship, linkKind)
+			if field != "" {
+				link["field"] = field
+			}
+			links = append(links, link)
+		}
+		return links, nil
+	}
+
+	rule, leftKind, rightKind, err := q.relationshipRule(rel)
+	if err != nil {
+		return nil, err
+	}
+	if rule, err = q.analyzeRelationship(rule, rel); err != nil {
+		return nil, err
+	}
+	for _, leftResource := range left {
+		for _, rightResource := range right {
+			// Like the matching of the clause, rules between the same kind are passed the right node first
+			if !joins(rule, rightKind.Resource, rightResource, leftResource) {
+				continue
+			}
+			kind, field := relationshipLinkKind(rule, linkCriterion(rule, leftKind.Resource, leftResource, rightResource))
+			link := newRelationshipLink(rel, leftResource, rightResource, string(rule.Relationship), kind)
+			if field != "" {
+				link["field"] = field
+			}
+			links = append(links, link)
+		}
+	}
+	return links, nil
+}
+
+// newRelationshipLink describes the link of two related resources, going from the left one to the right one unless
+// the relationship points left
+func newRelationshipLink(rel *Relationship, left, right map[string]interface{}, relationshipType, kind string) map[string]interface{} {
+	from, to := left, right
+	if rel.Direction == Left {
+		from, to = right, left
+	}
+	link := map[string]interface{}{
+		"type": relationshipType,
+		"link": kind,
+		"from": linkEnd(from),
+		"to":   linkEnd(to),
+	}
+	for _, resource := range []map[string]interface{}{from, to} {
+		if resource["kind"] != "Service" {
+			continue
+		}
+		spec, _ := resource["spec"].(map[string]interface{})
+		servicePorts, _ := spec["ports"].([]interface{})
+		ports := []interface{}{}
+		for _, port := range servicePorts {
+			if port, ok := port.(map[string]interface{}); ok && port["port"] != nil {
+				ports = append(ports, port["port"])
+			}
+		}
+		if len(ports) > 0 {
+			link["port"] = ports[0]
+			link["ports"] = ports
+		}
+		break
+	}
+	return link
+}
+
+// linkEnd identifies a resource at one end of a link
+func linkEnd(resource map[string]interface{}) map[string]interface{} {
+	metadata, _ := resource["metadata"].(map[string]interface{})
+	end := map[string]interface{}{"kind": resource["kind"], "name": metadata["name"]}
+	if resource["kind"] != "Namespace" {
+		end["namespace"] = getNamespaceName(metadata)
+	}
+	return end
+}
+
+// linkCriterion returns the criterion of a rule by which a resource of kind is related to another, the first one
+// unless the rule matches any of its criteria
+func linkCriterion(rule RelationshipRule, kind string, resource, other map[string]interface{}) *MatchCriterion {
+	if len(rule.MatchCriteria) == 0 {
+		return nil
+	}
+	if !rule.MatchAny {
+		return &rule.MatchCriteria[0]
+	}
+	if !strings.EqualFold(rule.KindA, kind) {
+		resource, other = other, resource
+	}
+	criterion, ok := matchingCriterion(resource, other, rule)
+	if !ok {
+		return nil
+	}
+	return &criterion
+}
+
+// relationshipLinkKind tells how a rule links resources by one of its criteria, and the field of one resource that
+// refers to the other
+func relationshipLinkKind(rule RelationshipRule, criterion *MatchCriterion) (string, string) {
+	if rule.Relationship == NamespaceHasResource {
+		return LinkNamespace, "metadata.namespace"
+	}
+	if criterion == nil {
+		return LinkReference, ""
+	}
+	field := criterion.FieldA
+	if field == "$.metadata.name" || field == "$.metadata.labels" {
+		field = criterion.FieldB
+	}
+	field = strings.TrimPrefix(field, "$.")
+	switch {
+	case strings.Contains(field, "ownerReferences"):
+		return LinkOwnerReference, field
+	case criterion.ComparisonType == ContainsAll || strings.Contains(strings.ToLower(field), "selector"):
+		return LinkSelector, field
+	case strings.Contains(field, "volumes"):
+		return LinkVolume, field
+	case strings.Contains(field, "env"):
+		return LinkEnv, field
+	}
+	return LinkReference, field
+}
@@ -0,0 +1,82 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestRelationshipVariables(t *testing.T) {
+	pod := func(name, app, owner string) runtime.Object {
+		object := newTestObject("v1", "Pod", "default", name, nil)
+		object.SetLabels(map[string]string{"app": app})
+		if owner != "" {
+			object.SetOwnerReferences([]metav1.OwnerReference{{Name: owner}})
+		}
+		return object
+	}
+	q := newTestQueryExecutor(t,
+		newTestObject("v1", "Service", "default", "web", map[string]interface{}{
+			"spec": map[string]interface{}{
+				"selector": map[string]interface{}{"app": "web"},
+				"ports":    []interface{}{map[string]interface{}{"port": int64(80)}, map[string]interface{}{"port": int64(443)}},
+			},
+		}),
+		newTestObject("apps/v1", "Deployment", "default", "web", nil),
+		newTestObject("apps/v1", "ReplicaSet", "default", "web-5d8f", map[string]interface{}{
+			"metadata": map[string]interface{}{"name": "web-5d8f", "namespace": "default", "ownerReferences": []interface{}{map[string]interface{}{"name": "web"}}},
+		}),
+		pod("web-5d8f-abc", "web", "web-5d8f"),
+		pod("debug", "debug", ""),
+	)
+
+	result := executeTestQuery(t, q, `MATCH (s:Service)-[r]->(p:Pod) RETURN type(r), r.port, r.link, r.from.name, r.to.name`)
+	expected := []interface{}{map[string]interface{}{
+		"type": string(ServiceExposePod),
+		"port": int64(80),
+		"link": LinkSelector,
+		"from": map[string]interface{}{"name": "web"},
+		"to":   map[string]interface{}{"name": "web-5d8f-abc"},
+	}}
+	if !reflect.DeepEqual(result.Data["r"], expected) {
+		t.Errorf("expected the service's link to its pod, got %v", result.Data["r"])
+	}
+
+	// The links of a relationship pointing left go from its right node
+	result = executeTestQuery(t, q, `MATCH (p:Pod)<-[owner]-(rs:ReplicaSet) RETURN owner`)
+	links := result.Data["owner"].([]interface{})
+	if len(links) != 1 {
+		t.Fatalf("expected one link, got %v", links)
+	}
+	link := links[0].(map[string]interface{})
+	if link["link"] != LinkOwnerReference || link["field"] != "metadata.ownerReferences[].name" ||
+		!reflect.DeepEqual(link["from"], map[string]interface{}{"kind": "ReplicaSet", "name": "web-5d8f", "namespace": "default"}) {
+		t.Errorf("unexpected link %v", link)
+	}
+
+	result = executeTestQuery(t, q, `MATCH (d:Deployment)-[path*2]->(p:Pod) RETURN type(path), path.hops, path.kinds`)
+	expected = []interface{}{map[string]interface{}{
+		"type":  string(DeploymentOwnReplicaset) + "/" + string(ReplicasetOwnPod),
+		"hops":  2,
+		"kinds": []string{"deployments", "replicasets", "pods"},
+	}}
+	if !reflect.DeepEqual(result.Data["path"], expected) {
+		t.Errorf("expected the path from the deployment to its pod, got %v", result.Data["path"])
+	}
+
+	for query, code := range map[string]DiagnosticCode{
+		`MATCH (s:Service)-[p]->(p:Pod) RETURN p`:          CodeRelationshipVariable,
+		`MATCH (s:Service)-[r]->(p:Pod) RETURN type(p)`:    CodeTypeExpectsRelationship,
+		`MATCH (s:Service)-[r]->(p:Pod) RETURN type(r.to)`: CodeFunctionExpectsNode,
+	} {
+		ast, err := ParseQuery(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := q.Execute(ast, "default"); DiagnosticCodeOf(err) != code {
+			t.Errorf("%s: expected %s, got %v", query, code, err)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// rowRelationship is a relationship matched by the query, which joins the resources of its nodes in the Rows of RETURN
+type rowRelationship struct {
+	*Relationship
+	// optional is set for the relationships of OPTIONAL MATCH, which leave the nodes they don't join null
+	optional bool
+	// bound are its nodes the clauses before bound, each of whose resources is in a row
+	bound []string
+}
+
+// recordRowRelationships keeps the relationships of a MATCH clause for the Rows of RETURN, before the nodes bound
+// by the clauses before it are bound to it
+func (q *QueryExecutor) recordRowRelationships(c *MatchClause, boundNodes map[string]*NodePattern) {
+	if !q.Rows {
+		return
+	}
+	for _, rel := range c.Relationships {
+		if rel.LeftNode == nil || rel.RightNode == nil {
+			continue
+		}
+		rowRel := rowRelationship{Relationship: rel, optional: c.Optional}
+		for _, node := range []*NodePattern{rel.LeftNode, rel.RightNode} {
+			if _, ok := boundNodes[node.ResourceProperties.Name]; ok {
+				rowRel.bound = append(rowRel.bound, node.ResourceProperties.Name)
+			}
+		}
+		q.rowRelationships = append(q.rowRelationships, rowRel)
+	}
+}
+
+// rowBinding is a combination of resources in the Rows of RETURN, the index of the resource of each name among those
+// it's bound to, -1 for null
+type rowBinding map[string]int
+
+// returnRows computes the Rows of a RETURN clause from the resources of its nodes, items being those of the clause
+// with the values of WITH read from its rows
+func (q *QueryExecutor) returnRows(c *ReturnClause, items []*ReturnItem, nodeIds []string, resources map[string][]map[string]interface{}) ([]map[string]interface{}, error) {
+	columns := make([]string, len(c.Items))
+	for i, item := range c.Items {
+		columns[i] = returnItemLabel(item)
+	}
+	records := map[string][]map[string]interface{}{}
+	for _, nodeId := range nodeIds {
+		records[nodeId] = resources[nodeId]
+	}
+	bindings, err := q.rowBindings(nodeIds, records)
+	if err != nil {
+		return nil, err
+	}
+
+	// Rows follow the order of the resources of the nodes ORDER BY sorts, then of the others
+	order := []string{}
+	for _, item := range c.OrderBy {
+		nodeId := strings.Split(item.JsonPath, ".")[0]
+		if slices.Contains(q.withColumns, nodeId) {
+			nodeId = withRowsNode
+		}
+		if !slices.Contains(order, nodeId) {
+			order = append(order, nodeId)
+		}
+	}
+	for _, nodeId := range nodeIds {
+		if !slices.Contains(order, nodeId) {
+			order = append(order, nodeId)
+		}
+	}
+	slices.SortStableFunc(bindings, func(a, b rowBinding) int {
+		for _, nodeId := range order {
+			// Null resources come last
+			x, y := uint(a[nodeId]), uint(b[nodeId])
+			if x != y {
+				if x < y {
+					return -1
+				}
+				return 1
+			}
+		}
+		return 0
+	})
+
+	rows := make([]map[string]interface{}, 0, len(bindings))
+	for _, binding := range bindings {
+		row := map[string]interface{}{}
+		for i, item := range items {
+			nodeId := strings.Split(item.JsonPath, ".")[0]
+			var record map[string]interface{}
+			if index := binding[nodeId]; index >= 0 {
+				record = records[nodeId][index]
+			}
+			value, err := q.rowValue(item, record)
+			if err != nil {
+				return nil, err
+			}
+			row[columns[i]] = value
+		}
+		rows = append(rows, row)
+	}
+	rows, err = aggregateRows(items, columns, rows)
+	if err != nil {
+		return nil, err
+	}
+	if c.Distinct {
+		rows = distinctRecords(rows)
+	}
+	return rows, nil
+}
+
+// rowBindings combines the resources of the returned nodes, and of those relating them, by the relationships of the
+// query. records holds the resources of the returned nodes, to which those of the others are added.
+func (q *QueryExecutor) rowBindings(nodeIds []string, records map[string][]map[string]interface{}) ([]rowBinding, error) {
+	bindings := []rowBinding{{}}
+	for _, rel := range q.rowRelationships {
+		left, right := rel.LeftNode.ResourceProperties.Name, rel.RightNode.ResourceProperties.Name
+		if !q.inRowScope(left) || !q.inRowScope(right) {
+			continue
+		}
+		for _, name := range []string{left, right} {
+			if _, ok := records[name]; !ok {
+				records[name], _ = q.resultMap[name].([]map[string]interface{})
+			}
+		}
+		name := ""
+		links, isBound := []map[string]interface{}(nil), false
+		if rel.ResourceProperties != nil && rel.ResourceProperties.Name != "" {
+			name = rel.ResourceProperties.Name
+			links, isBound = q.resultMap[name].([]map[string]interface{})
+		}
+		if !isBound {
+			var err error
+			if links, err = q.relationshipLinks(rel.Relationship); err != nil {
+				return nil, err
+			}
+			name = ""
+		} else if _, ok := records[name]; !ok {
+			records[name] = links
+		} else {
+			// A relationship returned by RETURN is joined by the links it returns
+			links = records[name]
+		}
+
+		if rel.optional {
+			// Every resource of the bound nodes is in a row, joined or not
+			for _, name := range rel.bound {
+				bindings = expandBindings(bindings, name, len(records[name]))
+			}
+		}
+		leftIndex, rightIndex := recordIndex(records[left]), recordIndex(records[right])
+		joined := []rowBinding{}
+		for _, binding := range bindings {
+			matched := false
+			for i, link := range links {
+				from, to := linkEndKey(link["from"]), linkEndKey(link["to"])
+				if rel.Direction == Left {
+					from, to = to, from
+				}
+				l, okLeft := leftIndex[from]
+				r, okRight := rightIndex[to]
+				if !okLeft || !okRight || !binds(binding, left, l) || !binds(binding, right, r) || !binds(binding, name, i) {
+					continue
+				}
+				matched = true
+				next := rowBinding{left: l, right: r}
+				for n, index := range binding {
+					next[n] = index
+				}
+				if name != "" {
+					next[name] = i
+				}
+				joined = append(joined, next)
+			}
+			if !matched && rel.optional {
+				next := rowBinding{}
+				for n, index := range binding {
+					next[n] = index
+				}
+				for _, n := range []string{left, right, name} {
+					if _, ok := next[n]; !ok && n != "" {
+						next[n] = -1
+					}
+				}
+				joined = append(joined, next)
+			}
+		}
+		bindings = joined
+	}
+
+	// The returned nodes no relationship bound are combined with every row
+	for _, nodeId := range nodeIds {
+		bindings = expandBindings(bindings, nodeId, len(records[nodeId]))
+	}
+	return bindings, nil
+}
+
+// expandBindings combines the bindings that don't bind name with each of its n resources
+func expandBindings(bindings []rowBinding, name string, n int) []rowBinding {
+	expanded := []rowBinding{}
+	for _, binding := range bindings {
+		if _, ok := binding[name]; ok {
+			expanded = append(expanded, binding)
+			continue
+		}
+		for i := 0; i < n; i++ {
+			next := rowBinding{name: i}
+			for other, index := range binding {
+				next[other] = index
+			}
+			expanded = append(expanded, next)
+		}
+	}
+	return expanded
+}
+
+// inRowScope tells whether a node is still in scope, its resources in resultMap
+func (q *QueryExecutor) inRowScope(name string) bool {
+	_, ok := q.resultMap[name].([]map[string]interface{})
+	return ok && name != withRowsNode
+}
+
+// binds tells whether a binding can bind name to the resource at index, either binding it to it already or not yet
+// binding name
+func binds(binding rowBinding, name string, index int) bool {
+	bound, ok := binding[name]
+	return name == "" || !ok || bound == index
+}
+
+// recordIndex indexes resources by the key of their link ends
+func recordIndex(resources []map[string]interface{}) map[string]int {
+	index := make(map[string]int, len(resources))
+	for i, resource := range resources {
+		key := linkEndKey(linkEnd(resource))
+		if _, ok := index[key]; !ok {
+			index[key] = i
+		}
+	}
+	return index
+}
+
+// linkEndKey identifies the resource at an end of a link
+func linkEndKey(end interface{}) string {
+	e, _ := end.(map[string]interface{})
+	return fmt.Sprintf("%v/%v/%v", e["kind"], e["namespace"], e["name"])
+}
+
+// rowValue is the value of a RETURN item in a row, for the resource of its node, null if it's null
+func (q *QueryExecutor) rowValue(item *ReturnItem, record map[string]interface{}) (interface{}, error) {
+	if record == nil {
+		return nil, nil
+	}
+	if strings.ToUpper(item.Aggregate) == "COUNT" {
+		// Counted unless null
+		return true, nil
+	}
+	if item.Function != "" {
+		return q.returnFunctionValue(item, record)
+	}
+	path := "$"
+	if parts := splitFieldPath(item.JsonPath)[1:]; len(parts) > 0 {
+		path = "$." + strings.Join(parts, ".")
+	}
+	value, err := returnPathLookup(record, path)
+	if err != nil {
+		return nil, nil
+	}
+	return value, nil
+}
+
+// aggregateRows groups rows by the values of their items without an aggregate, and computes the aggregates of each
+// group: a COUNT item counts the rows its node isn't null in, and a SUM item sums its values
+func aggregateRows(items []*ReturnItem, columns []string, rows []map[string]interface{}) ([]map[string]interface{}, error) {
+	hasAggregates, hasKeys := false, false
+	for _, item := range items {
+		hasAggregates = hasAggregates || item.Aggregate != ""
+		hasKeys = hasKeys || item.Aggregate == ""
+	}
+	if !hasAggregates {
+		return rows, nil
+	}
+
+	groups := []map[string]interface{}{}
+	groupIndex := map[string]map[string]interface{}{}
+	for _, row := range rows {
+		keys := []interface{}{}
+		for i, item := range items {
+			if item.Aggregate == "" {
+				keys = append(keys, row[columns[i]])
+			}
+		}
+		// The values are those of resources, which JSON encodes
+		key, _ := json.Marshal(keys)
+		group, ok := groupIndex[string(key)]
+		if !ok {
+			group = map[string]interface{}{}
+			for i, item := range items {
+				if item.Aggregate == "" {
+					group[columns[i]] = row[columns[i]]
+				}
+			}
+			groupIndex[string(key)] = group
+			groups = append(groups, group)
+		}
+		for i, item := range items {
+			column := columns[i]
+			switch strings.ToUpper(item.Aggregate) {
+			case "COUNT":
+				count, _ := group[column].(int)
+				if row[column] != nil {
+					count++
+				}
+				group[column] = count
+			case "SUM":
+				var err error
+				if group[column], err = addToSum(group[column], row[column], item.JsonPath); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	// Aggregating everything, e.g. RETURN count{p}, gives a row even when there's nothing to aggregate
+	if len(groups) == 0 && !hasKeys {
+		groups = append(groups, map[string]interface{}{})
+	}
+
+	for _, group := range groups {
+		for i, item := range items {
+			column := columns[i]
+			switch strings.ToUpper(item.Aggregate) {
+			case "COUNT":
+				if group[column] == nil {
+					group[column] = 0
+				}
+			case "SUM":
+				if strSlice, ok := group[column].([]string); ok && len(strSlice) == 1 {
+					group[column] = strSlice[0]
+				}
+			}
+		}
+	}
+	return groups, nil
+}
+
+// distinctRecords drops the rows that repeat an earlier row
+func distinctRecords(rows []map[string]interface{}) []map[string]interface{} {
+	values := make([]interface{}, len(rows))
+	for i, row := range rows {
+		values[i] = row
+	}
+	distinct := []map[string]interface{}{}
+	for _, row := range distinctRows(values) {
+		distinct = append(distinct, row.(map[string]interface{}))
+	}
+	return distinct
+}
@@ -0,0 +1,126 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestReturnRows(t *testing.T) {
+	replicaSet := func(name, owner string) runtime.Object {
+		object := newTestObject("apps/v1", "ReplicaSet", "default", name, nil)
+		object.SetOwnerReferences([]metav1.OwnerReference{{Name: owner}})
+		return object
+	}
+	pod := func(name, owner string, cpu string) runtime.Object {
+		object := newTestObject("v1", "Pod", "default", name, map[string]interface{}{
+			"spec": map[string]interface{}{"containers": []interface{}{
+				map[string]interface{}{"resources": map[string]interface{}{"requests": map[string]interface{}{"cpu": cpu}}},
+			}},
+		})
+		if owner != "" {
+			object.SetOwnerReferences([]metav1.OwnerReference{{Name: owner}})
+		}
+		return object
+	}
+	q := newTestQueryExecutor(t,
+		newTestObject("apps/v1", "Deployment", "default", "api", nil),
+		newTestObject("apps/v1", "Deployment", "default", "web", nil),
+		replicaSet("api-1", "api"),
+		replicaSet("web-1", "web"),
+		pod("api-1-a", "api-1", "100m"),
+		pod("web-1-a", "web-1", "200m"),
+		pod("web-1-b", "web-1", "300m"),
+		pod("debug", "", "50m"),
+	)
+	q.Rows = true
+
+	tests := []struct {
+		query    string
+		expected []map[string]interface{}
+	}{
+		{
+			// Each pod is in a row with its own deployment, joined through the replica set that isn't returned
+			`MATCH (d:Deployment)->(rs:ReplicaSet)->(p:Pod) RETURN d.metadata.name AS deployment, p.metadata.name`,
+			[]map[string]interface{}{
+				{"deployment": "api", "p.metadata.name": "api-1-a"},
+				{"deployment": "web", "p.metadata.name": "web-1-a"},
+				{"deployment": "web", "p.metadata.name": "web-1-b"},
+			},
+		},
+		{
+			`MATCH (d:Deployment)->(rs:ReplicaSet)->(p:Pod) RETURN d.metadata.name AS deployment, p.metadata.name AS pod ORDER BY p.metadata.name DESC`,
+			[]map[string]interface{}{
+				{"deployment": "web", "pod": "web-1-b"},
+				{"deployment": "web", "pod": "web-1-a"},
+				{"deployment": "api", "pod": "api-1-a"},
+			},
+		},
+		{
+			// Aggregates are computed per row of the other items
+			`MATCH (d:Deployment)->(rs:ReplicaSet)->(p:Pod) RETURN d.metadata.name AS deployment, COUNT{p} AS pods, SUM{p.spec.containers[0].resources.requests.cpu} AS cpu`,
+			[]map[string]interface{}{
+				{"deployment": "api", "pods": 1, "cpu": "100m"},
+				{"deployment": "web", "pods": 2, "cpu": "500m"},
+			},
+		},
+		{
+			// Nodes no relationship connects are combined with every row
+			`MATCH (d:Deployment {name: "api"}), (p:Pod {name: "debug"}) RETURN d.metadata.name AS deployment, p.metadata.name AS pod`,
+			[]map[string]interface{}{
+				{"deployment": "api", "pod": "debug"},
+			},
+		},
+		{
+			`MATCH (rs:ReplicaSet {name: "web-1"})-[r]->(p:Pod) RETURN rs.metadata.name AS rs, r.link, p.metadata.name AS pod`,
+			[]map[string]interface{}{
+				{"rs": "web-1", "r.link": LinkOwnerReference, "pod": "web-1-a"},
+				{"rs": "web-1", "r.link": LinkOwnerReference, "pod": "web-1-b"},
+			},
+		},
+		{
+			// A node OPTIONAL MATCH found nothing for is null
+			`MATCH (d:Deployment) OPTIONAL MATCH (d)->(rs:ReplicaSet {name: "api-1"}) RETURN d.metadata.name AS deployment, rs.metadata.name AS rs`,
+			[]map[string]interface{}{
+				{"deployment": "api", "rs": "api-1"},
+				{"deployment": "web", "rs": nil},
+			},
+		},
+		{
+			`MATCH (p:Pod) WITH p.metadata.namespace AS ns, COUNT{p} AS pods RETURN ns, pods`,
+			[]map[string]interface{}{
+				{"ns": "default", "pods": 4},
+			},
+		},
+		{
+			`MATCH (p:Pod) WHERE p.metadata.name = "debug" RETURN COUNT{p}`,
+			[]map[string]interface{}{
+				{"count{p}": 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		result := executeTestQuery(t, q, tt.query)
+		if !reflect.DeepEqual(result.Rows, tt.expected) {
+			t.Errorf("%s: expected rows %v, got %v", tt.query, tt.expected, result.Rows)
+		}
+	}
+
+	// The results keyed by node are returned as before
+	result := executeTestQuery(t, q, `MATCH (d:Deployment {name: "api"}) RETURN d.metadata.name`)
+	expected := []interface{}{map[string]interface{}{"name": "api", "metadata": map[string]interface{}{"name": "api"}}}
+	if !reflect.DeepEqual(result.Data["d"], expected) {
+		t.Errorf("expected the rows of d, got %v", result.Data["d"])
+	}
+
+	// Forks return rows like the executor they're forked from, and executors without Rows don't
+	if result := executeTestQuery(t, q.Fork(), `MATCH (d:Deployment {name: "api"}) RETURN d.metadata.name AS name`); !reflect.DeepEqual(result.Rows, []map[string]interface{}{{"name": "api"}}) {
+		t.Errorf("expected the rows of the fork, got %v", result.Rows)
+	}
+	q.Rows = false
+	if result := executeTestQuery(t, q, `MATCH (d:Deployment {name: "api"}) RETURN d.metadata.name`); result.Rows != nil {
+		t.Errorf("expected no rows without Rows, got %v", result.Rows)
+	}
+}
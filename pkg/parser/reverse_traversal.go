@@ -0,0 +1,314 @@
+package parser
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// A node without a kind, e.g. owner in (p:Pod {name: "web-1"})<-(owner), matches the resources of any kind that are
+// related to the other node's resources: the owners their ownerReferences name, whatever their kind, and the
+// resources of every kind with a relationship to the other node's kind, such as the services selecting a pod or
+// the autoscalers scaling a deployment. The resources of each related kind are listed once and indexed by the
+// values they refer to, so that each of the other node's resources only looks up the resources referring to it.
+
+// JoinStrategyReverseLookup is reported for relationships to a node without a kind
+const JoinStrategyReverseLookup = "reverse lookup"
+
+// relatedResource is a resource related to one of the resources of the node whose kind is known
+type relatedResource struct {
+	known, related map[string]interface{}
+	relationship   string
+	// rule is the rule relating the two, nil for owners found through ownerReferences alone
+	rule *RelationshipRule
+}
+
+// isKindlessRelationship reports whether one of the nodes of a relationship has no kind, to be found from the other
+func isKindlessRelationship(rel *Relationship) bool {
+	return rel.Hops == nil && rel.LeftNode != nil && rel.RightNode != nil &&
+		(rel.LeftNode.ResourceProperties.Kind == "") != (rel.RightNode.ResourceProperties.Kind == "")
+}
+
+// kindlessNodes returns the node of a relationship whose kind is known, its resource, and the node without a kind
+func (q *QueryExecutor) kindlessNodes(rel *Relationship) (*NodePattern, schema.GroupVersionResource, *NodePattern, error) {
+	known, unknown := rel.LeftNode, rel.RightNode
+	if known.ResourceProperties.Kind == "" {
+		known, unknown = unknown, known
+	}
+	if IsMultiKindPattern(known.ResourceProperties.Kind) {
+		return nil, schema.GroupVersionResource{}, nil, newDiagnosticError(CodeMultiKindRelationship, nil, "node", known.ResourceProperties.Name, "kind", known.ResourceProperties.Kind)
+	}
+	gvr, err := FindGVR(q.Clientset, known.ResourceProperties.Kind)
+	if err != nil {
+		return nil, schema.GroupVersionResource{}, nil, fmt.Errorf("error finding API resource >> %w", err)
+	}
+	return known, gvr, unknown, nil
+}
+
+func (q *QueryExecutor) processKindlessRelationship(rel *Relationship, c *MatchClause, results *QueryResult, filteredResults map[string][]map[string]interface{}) (bool, error) {
+	known, knownKind, unknown, err := q.kindlessNodes(rel)
+	if err != nil {
+		return false, err
+	}
+	for _, node := range c.Nodes {
+		if node.ResourceProperties.Name == known.ResourceProperties.Name && results.Data[node.ResourceProperties.Name] == nil {
+			if err := getNodeResources(node, q, c.ExtraFilters); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	knownName, unknownName := known.ResourceProperties.Name, unknown.ResourceProperties.Name
+	knownResources := q.getResourcesFromMap(filteredResults, knownName)
+	related, err := q.relatedResources(knownResources, knownKind)
+	if err != nil {
+		return false, err
+	}
+	// On later passes, only the resources matched so far are kept, and the WHERE clause filters the related resources
+	// like those of nodes with a kind
+	candidates := []map[string]interface{}{}
+	for _, r := range related {
+		if !containsResource(candidates, r.related) {
+			candidates = append(candidates, r.related)
+		}
+	}
+	if previous, ok := filteredResults[unknownName]; ok {
+		candidates = slices.DeleteFunc(candidates, func(resource map[string]interface{}) bool { return !containsResource(previous, resource) })
+	}
+	q.resultMap[unknownName] = candidates
+	if err := q.applyExtraFilters(unknown, c.ExtraFilters); err != nil {
+		return false, err
+	}
+	candidates, _ = q.resultMap[unknownName].([]map[string]interface{})
+	related = slices.DeleteFunc(related, func(r relatedResource) bool { return !containsResource(candidates, r.related) })
+
+	matchedKnown := []map[string]interface{}{}
+	matchedUnknown := []map[string]interface{}{}
+	edges := []Edge{}
+	for _, r := range related {
+		if !containsResource(matchedKnown, r.known) {
+			matchedKnown = append(matchedKnown, r.known)
+		}
+		if !containsResource(matchedUnknown, r.related) {
+			matchedUnknown = append(matchedUnknown, r.related)
+		}
+		left, right := r.known, r.related
+		if unknown == rel.LeftNode {
+			left, right = right, left
+		}
+		edge := Edge{From: graphNodeId(right), To: graphNodeId(left), Type: r.relationship}
+		if !slices.Contains(edges, edge) {
+			edges = append(edges, edge)
+		}
+	}
+
+	previousUnknown, unknownFiltered := filteredResults[unknownName]
+	filteredResults[knownName] = matchedKnown
+	filteredResults[unknownName] = matchedUnknown
+	q.resultMap[unknownName] = matchedUnknown
+	if current, ok := q.resultMap[knownName].([]map[string]interface{}); !ok || len(current) > len(matchedKnown) {
+		q.resultMap[knownName] = matchedKnown
+	}
+	for _, name := range []string{knownName, unknownName} {
+		for _, resource := range filteredResults[name] {
+			results.Graph.Nodes = append(results.Graph.Nodes, graphNode(name, resource))
+		}
+	}
+	results.Graph.Edges = append(results.Graph.Edges, edges...)
+
+	return len(matchedKnown) < len(knownResources) || (unknownFiltered && len(matchedUnknown) < len(previousUnknown)), nil
+}
+
+// relatedResources finds the resources related to each of the resources of a kind
+func (q *QueryExecutor) relatedResources(resources []map[string]interface{}, kind schema.GroupVersionResource) ([]relatedResource, error) {
+	related := []relatedResource{}
+	ruleKinds := []string{}
+	rules := activeRelationshipRules()
+	for i := range rules {
+		rule := &rules[i]
+		otherKind, ok := relatedKind(*rule, kind.Resource)
+		// Relationships evaluated from other resources are only followed between nodes of known kinds
+		if !ok || otherKind == "*" || rule.analyzer != "" {
+			continue
+		}
+		if _, err := FindGVR(q.Clientset, otherKind); err != nil {
+			continue
+		}
+		ruleKinds = append(ruleKinds, otherKind)
+		candidates, err := q.hopResources(otherKind)
+		if err != nil {
+			return nil, err
+		}
+		index := newReferenceIndex(*rule, otherKind, candidates)
+		for _, resource := range resources {
+			for _, candidate := range index.lookup(*rule, kind.Resource, resource) {
+				if joins(*rule, kind.Resource, resource, candidate) {
+					related = append(related, relatedResource{known: resource, related: candidate, relationship: string(rule.Relationship), rule: rule})
+				}
+			}
+		}
+	}
+
+	// Owners of kinds no rule relates to the resources, e.g. custom resources, are found by their ownerReferences
+	for _, resource := range resources {
+		metadata, _ := resource["metadata"].(map[string]interface{})
+		ownerReferences, _ := metadata["ownerReferences"].([]interface{})
+		for _, reference := range ownerReferences {
+			owner, _ := reference.(map[string]interface{})
+			ownerKind, _ := owner["kind"].(string)
+			if ownerKind == "" {
+				continue
+			}
+			gvr, err := FindGVR(q.Clientset, ownerKind)
+			if err != nil || slices.Contains(ruleKinds, gvr.Resource) {
+				continue
+			}
+			candidates, err := q.hopResources(ownerKind)
+			if err != nil {
+				return nil, err
+			}
+			for _, candidate := range candidates {
+				if isOwner(candidate, owner) {
+					relationship := fmt.Sprintf("%s_OWN_%s", strings.ToUpper(ownerKind), strings.ToUpper(fmt.Sprint(resource["kind"])))
+					related = append(related, relatedResource{known: resource, related: candidate, relationship: relationship})
+				}
+			}
+		}
+	}
+	return related, nil
+}
+
+// isOwner reports whether a resource is the one an ownerReference names, by UID if the reference has one
+func isOwner(resource, ownerReference map[string]interface{}) bool {
+	metadata, _ := resource["metadata"].(map[string]interface{})
+	if resource["kind"] != ownerReference["kind"] {
+		return false
+	}
+	if uid, ok := ownerReference["uid"].(string); ok && uid != "" {
+		return metadata["uid"] == uid
+	}
+	return metadata["name"] == ownerReference["name"]
+}
+
+// referenceIndex maps the values a field of the resources of a kind holds to the resources holding them. Rules
+// matching by selectors aren't indexed, and every resource is a candidate.
+type referenceIndex struct {
+	values    map[string][]map[string]interface{}
+	resources []map[string]interface{}
+}
+
+func newReferenceIndex(rule RelationshipRule, kind string, resources []map[string]interface{}) *referenceIndex {
+	index := &referenceIndex{resources: resources}
+	fields, ok := indexedFields(rule, kind)
+	if !ok {
+		return index
+	}
+	index.values = map[string][]map[string]interface{}{}
+	for _, resource := range resources {
+		for _, field := range fields {
+			for _, value := range fieldValues(resource, field) {
+				if !containsResource(index.values[value], resource) {
+					index.values[value] = append(index.values[value], resource)
+				}
+			}
+		}
+	}
+	return index
+}
+
+// lookup lists the candidates for being related to a resource of kind
+func (index *referenceIndex) lookup(rule RelationshipRule, kind string, resource map[string]interface{}) []map[string]interface{} {
+	fields, ok := indexedFields(rule, kind)
+	if !ok || index.values == nil {
+		return index.resources
+	}
+	candidates := []map[string]interface{}{}
+	for _, field := range fields {
+		for _, value := range fieldValues(resource, field) {
+			for _, candidate := range index.values[value] {
+				if !containsResource(candidates, candidate) {
+					candidates = append(candidates, candidate)
+				}
+			}
+		}
+	}
+	return candidates
+}
+
+// indexedFields are the fields resources of kind are compared by: that of the first criterion of a rule if it's an
+// exact match, or those of every criterion of a rule matching any of them if they're all exact matches
+func indexedFields(rule RelationshipRule, kind string) ([]string, bool) {
+	criteria := rule.MatchCriteria
+	if !rule.MatchAny && len(criteria) > 0 {
+		criteria = criteria[:1]
+	}
+	if len(criteria) == 0 {
+		return nil, false
+	}
+	fields := []string{}
+	for _, criterion := range criteria {
+		if criterion.ComparisonType != ExactMatch {
+			return nil, false
+		}
+		if strings.EqualFold(rule.KindA, kind) {
+			fields = append(fields, criterion.FieldA)
+		} else {
+			fields = append(fields, criterion.FieldB)
+		}
+	}
+	return fields, true
+}
+
+// fieldValues lists the values found at a field of a resource, looking into lists and objects like matchFields
+func fieldValues(resource map[string]interface{}, field string) []string {
+	value, err := jsonPathLookup(resource, strings.ReplaceAll(field, "[]", ""))
+	if err != nil {
+		return nil
+	}
+	values := []string{}
+	var collect func(value interface{})
+	collect = func(value interface{}) {
+		switch v := value.(type) {
+		case []interface{}:
+			for _, element := range v {
+				collect(element)
+			}
+		case map[string]interface{}:
+			for _, element := range v {
+				collect(element)
+			}
+		case nil:
+		default:
+			values = append(values, fmt.Sprint(v))
+		}
+	}
+	collect(value)
+	return values
+}
+
+func (q *QueryExecutor) explainKindlessRelationship(rel *Relationship) (RelationshipPlan, error) {
+	_, kind, _, err := q.kindlessNodes(rel)
+	if err != nil {
+		return RelationshipPlan{}, err
+	}
+	relationshipPlan := RelationshipPlan{
+		Left:         rel.LeftNode.ResourceProperties.Name,
+		Right:        rel.RightNode.ResourceProperties.Name,
+		Relationship: "*",
+		Strategy:     JoinStrategyReverseLookup,
+	}
+	for _, rule := range activeRelationshipRules() {
+		otherKind, ok := relatedKind(rule, kind.Resource)
+		if !ok || otherKind == "*" || rule.analyzer != "" {
+			continue
+		}
+		if _, err := FindGVR(q.Clientset, otherKind); err != nil {
+			continue
+		}
+		relationshipPlan.Criteria = append(relationshipPlan.Criteria, fmt.Sprintf("%s (%s)", otherKind, rule.Relationship))
+	}
+	relationshipPlan.Criteria = append(relationshipPlan.Criteria, "owners named by metadata.ownerReferences")
+	return relationshipPlan, nil
+}
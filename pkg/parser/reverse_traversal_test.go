@@ -0,0 +1,97 @@
+package parser
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestKindlessRelationship(t *testing.T) {
+	owned := func(apiVersion, kind, name, ownerKind, owner string, labels map[string]string) runtime.Object {
+		object := newTestObject(apiVersion, kind, "default", name, nil)
+		object.SetLabels(labels)
+		if owner != "" {
+			object.SetOwnerReferences([]metav1.OwnerReference{{Kind: ownerKind, Name: owner}})
+		}
+		return object
+	}
+	q := newTestQueryExecutor(t,
+		newTestObject("v1", "Service", "default", "web", map[string]interface{}{
+			"spec": map[string]interface{}{"selector": map[string]interface{}{"app": "web"}},
+		}),
+		owned("apps/v1", "Deployment", "web", "", "", nil),
+		owned("apps/v1", "Deployment", "batch", "", "", nil),
+		owned("apps/v1", "ReplicaSet", "web-5d8f", "Deployment", "web", nil),
+		owned("v1", "Pod", "web-5d8f-abc", "ReplicaSet", "web-5d8f", map[string]string{"app": "web"}),
+		owned("v1", "Pod", "batch-run", "Deployment", "batch", nil),
+		owned("v1", "Pod", "debug", "", "", nil),
+	)
+	identities := func(rows interface{}) []string {
+		list := []string{}
+		for _, row := range rows.([]interface{}) {
+			row := row.(map[string]interface{})
+			list = append(list, row["kind"].(string)+"/"+row["name"].(string))
+		}
+		slices.Sort(list)
+		return list
+	}
+
+	// The pod's replicaset owns it and the service selects it
+	result := executeTestQuery(t, q, `MATCH (p:Pod)<-(owner) WHERE p.metadata.name = "web-5d8f-abc" RETURN owner.kind, owner.metadata.name AS name`)
+	if owners := identities(result.Data["owner"]); !reflect.DeepEqual(owners, []string{"ReplicaSet/web-5d8f", "Service/web"}) {
+		t.Errorf("expected the pod's replicaset and service, got %v", owners)
+	}
+	edges := []string{}
+	for _, edge := range result.Graph.Edges {
+		edges = append(edges, edge.From+" "+edge.Type+" "+edge.To)
+	}
+	if !slices.Contains(edges, "ReplicaSet/web-5d8f "+string(ReplicasetOwnPod)+" Pod/web-5d8f-abc") {
+		t.Errorf("expected an edge from the replicaset to the pod, got %v", edges)
+	}
+
+	// Owners of kinds no relationship joins to pods are found through ownerReferences, and WHERE filters them
+	result = executeTestQuery(t, q, `MATCH (p:Pod)<-(owner) WHERE owner.kind = "Deployment" RETURN owner.kind, owner.metadata.name AS name, p.metadata.name`)
+	if owners := identities(result.Data["owner"]); !reflect.DeepEqual(owners, []string{"Deployment/batch"}) {
+		t.Errorf("expected the deployment owning batch-run, got %v", owners)
+	}
+	if pods := result.Data["p"].([]interface{}); len(pods) != 1 || pods[0].(map[string]interface{})["name"] != "batch-run" {
+		t.Errorf("expected the pods to be joined to their owners, got %v", pods)
+	}
+
+	// The node without a kind may be on either side, and bound to a relationship variable
+	result = executeTestQuery(t, q, `MATCH (x)-[r]->(rs:ReplicaSet) RETURN type(r), r.link, r.from.kind`)
+	links := result.Data["r"].([]interface{})
+	expected := []interface{}{
+		map[string]interface{}{"type": string(ReplicasetOwnPod), "link": LinkOwnerReference, "from": map[string]interface{}{"kind": "Pod"}},
+		map[string]interface{}{"type": string(DeploymentOwnReplicaset), "link": LinkOwnerReference, "from": map[string]interface{}{"kind": "Deployment"}},
+	}
+	slices.SortFunc(links, func(a, b interface{}) int {
+		return len(a.(map[string]interface{})["type"].(string)) - len(b.(map[string]interface{})["type"].(string))
+	})
+	if !reflect.DeepEqual(links, expected) {
+		t.Errorf("expected the links of the replicaset, got %v", links)
+	}
+
+	ast, err := ParseQuery(`EXPLAIN MATCH (p:Pod)<-(owner) RETURN owner`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := q.explain(ast)
+	if err != nil {
+		t.Fatalf("explain() error = %v", err)
+	}
+	if rel := plan.Relationships[0]; rel.Strategy != JoinStrategyReverseLookup || !slices.Contains(rel.Criteria, "replicasets ("+string(ReplicasetOwnPod)+")") {
+		t.Errorf("unexpected plan %+v", rel)
+	}
+
+	ast, err = ParseQuery(`MATCH (a)->(b) RETURN a`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Execute(ast, "default"); DiagnosticCodeOf(err) != CodeMissingKind {
+		t.Errorf("expected two nodes without a kind to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,206 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Rollout applies the changes of a query progressively, in waves of BatchSize changes. Between waves it pauses,
+// then runs the health query, and only goes on with the next wave if the health query returns no resources.
+type Rollout struct {
+	// BatchSize is the number of changes in a wave
+	BatchSize int
+	// Pause is how long to wait after a wave, before checking health and applying the next wave
+	Pause time.Duration
+	// StopOnError stops the rollout at the first change that fails. Otherwise the other changes are still applied,
+	// and the failed ones are reported once the rollout completes.
+	StopOnError bool
+	// HealthQuery, if set, finds unhealthy resources, e.g. MATCH (d:Deployment) WHERE d.status.unavailableReplicas > 0 RETURN d
+	HealthQuery string
+
+	// while is the WHILE query of an APPLY query, the rollout goes on as long as it returns resources
+	while *Expression
+
+	changes  int
+	failures []string
+	// stopped is set once the WHILE query returned no resources
+	stopped bool
+}
+
+// ParseHealthQuery parses the health query of a rollout, which can only read resources
+func ParseHealthQuery(query string) (*Expression, error) {
+	ast, err := ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if ast.Explain {
+		return nil, newDiagnosticError(CodeInvalidHealthQuery, nil)
+	}
+	for _, clause := range ast.Clauses {
+		switch clause.(type) {
+		case *MatchClause, *ReturnClause:
+		default:
+			return nil, newDiagnosticError(CodeInvalidHealthQuery, nil)
+		}
+	}
+	return ast, nil
+}
+
+// errWhileStopped stops an APPLY query once its WHILE query returns no resources, which isn't an error
+var errWhileStopped = errors.New("WHILE condition no longer holds")
+
+// haltError stops a rollout whatever StopOnError, e.g. when the health query fails
+type haltError struct{ error }
+
+func (e haltError) Unwrap() error { return e.error }
+
+func (r *Rollout) reset() {
+	if r != nil {
+		r.changes = 0
+		r.failures = nil
+		r.stopped = false
+	}
+}
+
+// nextChange is called before each change of the running query: once a wave is complete, it waits before
+// letting the next wave begin. The WHILE query of an APPLY query is also checked before the first wave.
+func (q *QueryExecutor) nextChange() error {
+	r := q.Rollout
+	if r == nil || r.BatchSize <= 0 {
+		return nil
+	}
+	if (r.changes > 0 || r.while != nil) && r.changes%r.BatchSize == 0 {
+		wave := r.changes / r.BatchSize
+		if r.changes > 0 {
+			Logger().Info("Rollout wave applied", "wave", wave, "changes", r.changes)
+			if r.Pause > 0 {
+				Logger().Info("Pausing rollout", "duration", r.Pause)
+				select {
+				case <-time.After(r.Pause):
+				case <-q.context().Done():
+					return q.context().Err()
+				}
+			}
+		}
+		if r.HealthQuery != "" {
+			if err := q.checkHealth(wave); err != nil {
+				return haltError{err}
+			}
+		}
+		if r.while != nil {
+			holds, err := q.checkWhile()
+			if err != nil {
+				return haltError{err}
+			}
+			if !holds {
+				Logger().Info("Stopping APPLY, its WHILE condition no longer holds", "wave", wave, "changes", r.changes)
+				r.stopped = true
+				return haltError{errWhileStopped}
+			}
+		}
+	}
+	r.changes++
+	return nil
+}
+
+// changeFailed decides whether a failed change stops the running query: it does unless the query is rolled
+// out without StopOnError and isn't Atomic, which notes the failure to report it at the end and goes on
+func (q *QueryExecutor) changeFailed(err error) error {
+	r := q.Rollout
+	var halt haltError
+	if r == nil || r.StopOnError || q.Atomic || q.context().Err() != nil || errors.As(err, &halt) {
+		return err
+	}
+	logWarn("Rollout change failed", "code", string(DiagnosticCodeOf(err)), "error", err)
+	r.failures = append(r.failures, err.Error())
+	return nil
+}
+
+// rolloutFailures reports the changes of the rollout that failed, if any
+func (q *QueryExecutor) rolloutFailures() error {
+	if q.Rollout == nil || len(q.Rollout.failures) == 0 {
+		return nil
+	}
+	failures := q.Rollout.failures
+	return newDiagnosticError(CodeRolloutFailures, nil, "count", len(failures), "failures", strings.Join(failures, "; "))
+}
+
+// checkHealth runs the health query of the rollout, which fails it if it returns resources
+func (q *QueryExecutor) checkHealth(wave int) error {
+	ast, err := ParseHealthQuery(q.Rollout.HealthQuery)
+	if err != nil {
+		return err
+	}
+	unhealthy, err := q.countGuardResources(ast)
+	if err != nil {
+		return fmt.Errorf("error running health query >> %w", err)
+	}
+	if unhealthy > 0 {
+		return newDiagnosticError(CodeRolloutUnhealthy, nil, "wave", wave, "count", unhealthy, "changes", appliedChanges(q.applied), "applied", append([]string{}, q.applied...))
+	}
+	Logger().Info("Rollout health query passed", "wave", wave)
+	return nil
+}
+
+// checkWhile runs the WHILE query of an APPLY query, and reports whether it returned resources
+func (q *QueryExecutor) checkWhile() (bool, error) {
+	count, err := q.countGuardResources(q.Rollout.while)
+	if err != nil {
+		return false, fmt.Errorf("error running WHILE query >> %w", err)
+	}
+	return count > 0, nil
+}
+
+// countGuardResources runs a health or WHILE query, with the state of the running query set aside, and
+// returns how many resources it returned
+func (q *QueryExecutor) countGuardResources(ast *Expression) (int, error) {
+	saved := q.queryState
+	ctx, applied, undo, rollout, ledger := q.ctx, q.applied, q.undo, q.Rollout, q.Ledger
+	q.clearQueryState()
+	q.Rollout, q.Ledger = nil, nil
+	result, err := q.ExecuteContext(ctx, ast, saved.namespace)
+	q.queryState = saved
+	q.ctx, q.applied, q.undo, q.Rollout, q.Ledger = ctx, applied, undo, rollout, ledger
+	if err != nil {
+		if errors.Is(err, ErrInterrupted) {
+			return 0, ctx.Err()
+		}
+		return 0, err
+	}
+
+	count := 0
+	for _, resources := range result.Data {
+		if list, ok := resources.([]interface{}); ok {
+			count += len(list)
+		}
+	}
+	return count, nil
+}
+
+// applyRollout is the rollout of an APPLY query: its batches are waves, stopped by the WHILE query. The
+// pause and health query of the executor's rollout, if any, still apply between batches.
+func (q *QueryExecutor) applyRollout(apply *Apply) (*Rollout, error) {
+	if apply.BatchSize < 1 {
+		return nil, newDiagnosticError(CodeInvalidBatchSize, nil, "size", apply.BatchSize)
+	}
+	rollout := &Rollout{BatchSize: apply.BatchSize, StopOnError: true, while: apply.While}
+	if q.Rollout != nil {
+		rollout.Pause, rollout.HealthQuery = q.Rollout.Pause, q.Rollout.HealthQuery
+	}
+	return rollout, nil
+}
+
+// applyReport summarizes what an APPLY query did, as its result
+func (r *Rollout) applyReport(applied int) map[string]interface{} {
+	batches := 0
+	if r.BatchSize > 0 {
+		batches = (r.changes + r.BatchSize - 1) / r.BatchSize
+	}
+	return map[string]interface{}{
+		"changes": applied,
+		"batches": batches,
+		"stopped": r.stopped,
+	}
+}
@@ -0,0 +1,94 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestRolloutWaves(t *testing.T) {
+	tests := []struct {
+		name        string
+		objects     []runtime.Object
+		failing     string
+		stopOnError bool
+		patched     []string
+		code        DiagnosticCode
+	}{
+		{
+			name:    "healthy",
+			patched: []string{"web-1", "web-2", "web-3"},
+		},
+		{
+			name:    "unhealthy after the first wave",
+			objects: []runtime.Object{newTestObject("apps/v1", "Deployment", "default", "broken", nil)},
+			patched: []string{"web-1", "web-2"},
+			code:    CodeRolloutUnhealthy,
+		},
+		{
+			name:    "failed change reported at the end",
+			failing: "web-2",
+			patched: []string{"web-1", "web-2", "web-3"},
+			code:    CodeRolloutFailures,
+		},
+		{
+			name:        "failed change stops the rollout",
+			failing:     "web-2",
+			stopOnError: true,
+			patched:     []string{"web-1", "web-2"},
+			code:        CodeNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects := append([]runtime.Object{}, tt.objects...)
+			for _, name := range []string{"web-1", "web-2", "web-3"} {
+				objects = append(objects, newTestObject("v1", "Pod", "default", name, nil))
+			}
+			q := newTestQueryExecutor(t, objects...)
+			var patched []string
+			q.DynamicClient.(*dynamicfake.FakeDynamicClient).PrependReactor("patch", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				name := action.(k8stesting.PatchAction).GetName()
+				patched = append(patched, name)
+				if name == tt.failing {
+					return true, nil, apierrors.NewNotFound(schema.GroupResource{Resource: "pods"}, name)
+				}
+				return false, nil, nil
+			})
+			q.Rollout = &Rollout{BatchSize: 2, StopOnError: tt.stopOnError, HealthQuery: `MATCH (d:Deployment) RETURN d.metadata.name`}
+
+			ast, err := ParseQuery(`MATCH (p:Pod) SET p.metadata.labels.tier = "web"`)
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+			_, err = q.Execute(ast, "default")
+			if code := DiagnosticCodeOf(err); code != tt.code {
+				t.Errorf("expected code %q, got %q (%v)", tt.code, code, err)
+			}
+			if !reflect.DeepEqual(patched, tt.patched) {
+				t.Errorf("expected %v to be patched, got %v", tt.patched, patched)
+			}
+		})
+	}
+}
+
+func TestParseHealthQuery(t *testing.T) {
+	for query, valid := range map[string]bool{
+		`MATCH (d:Deployment) WHERE d.status.unavailableReplicas > 0 RETURN d`: true,
+		`MATCH (d:Deployment) SET d.spec.replicas = 0`:                         false,
+		`MATCH (d:Deployment) DELETE d`:                                        false,
+	} {
+		_, err := ParseHealthQuery(query)
+		if valid && err != nil {
+			t.Errorf("%s: unexpected error %v", query, err)
+		}
+		if !valid && DiagnosticCodeOf(err) != CodeInvalidHealthQuery {
+			t.Errorf("%s: expected code %s, got %v", query, CodeInvalidHealthQuery, err)
+		}
+	}
+}
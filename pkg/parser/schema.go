@@ -0,0 +1,154 @@
+package parser
+
+import (
+	"slices"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+)
+
+// SchemaKind is a kind of resource served by the cluster
+type SchemaKind struct {
+	Kind       string   `json:"kind"`
+	Resource   string   `json:"resource"`
+	Group      string   `json:"group"`
+	Version    string   `json:"version"`
+	Namespaced bool     `json:"namespaced"`
+	ShortNames []string `json:"shortNames,omitempty"`
+}
+
+// SchemaRelationship is a relationship queries can traverse between two kinds, e.g. (d:Deployment)->(rs:ReplicaSet)
+type SchemaRelationship struct {
+	KindA string `json:"kindA"`
+	KindB string `json:"kindB"`
+	Type  string `json:"type"`
+}
+
+// Schema is what can be queried: the kinds of the cluster and the relationships between them
+type Schema struct {
+	Kinds         []SchemaKind         `json:"kinds"`
+	Relationships []SchemaRelationship `json:"relationships"`
+}
+
+// GetSchema returns the kinds served by the cluster, sorted by kind, and the relationships between them
+func GetSchema(clientset kubernetes.Interface) (*Schema, error) {
+	apiResourceLists, err := loadAPIResourceList(clientset)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Schema{Kinds: []SchemaKind{}, Relationships: []SchemaRelationship{}}
+	kindsByResource := make(map[string]string)
+	for _, apiResourceList := range apiResourceLists {
+		gv, err := schema.ParseGroupVersion(apiResourceList.GroupVersion)
+		if err != nil {
+			return nil, err
+		}
+		for _, resource := range apiResourceList.APIResources {
+			result.Kinds = append(result.Kinds, SchemaKind{
+				Kind:       resource.Kind,
+				Resource:   resource.Name,
+				Group:      gv.Group,
+				Version:    gv.Version,
+				Namespaced: resource.Namespaced,
+				ShortNames: resource.ShortNames,
+			})
+			// Relationship rules name the resources, core resources win over others of the same name
+			if _, ok := kindsByResource[resource.Name]; !ok || gv.Group == "" {
+				kindsByResource[resource.Name] = resource.Kind
+			}
+		}
+	}
+	sort.SliceStable(result.Kinds, func(i, j int) bool {
+		if result.Kinds[i].Kind != result.Kinds[j].Kind {
+			return result.Kinds[i].Kind < result.Kinds[j].Kind
+		}
+		return result.Kinds[i].Group < result.Kinds[j].Group
+	})
+
+	kindOf := func(resource string) string {
+		if kind, ok := kindsByResource[resource]; ok {
+			return kind
+		}
+		return resource
+	}
+	for _, rule := range activeRelationshipRules() {
+		result.Relationships = append(result.Relationships, SchemaRelationship{
+			KindA: kindOf(rule.KindA),
+			KindB: kindOf(rule.KindB),
+			Type:  string(rule.Relationship),
+		})
+	}
+	return result, nil
+}
+
+// ListableKinds returns the kinds of the cluster whose resources can be listed, in discovery order, limited to
+// namespaced kinds when namespace isn't empty
+func ListableKinds(clientset kubernetes.Interface, namespace string) ([]SchemaKind, error) {
+	targets, err := listTargetsForWildcard(clientset, namespace)
+	if err != nil {
+		return nil, err
+	}
+	kinds := []SchemaKind{}
+	for _, target := range targets {
+		kinds = append(kinds, SchemaKind{
+			Kind:       target.kind,
+			Resource:   target.gvr.Resource,
+			Group:      target.gvr.Group,
+			Version:    target.gvr.Version,
+			Namespaced: target.namespaced,
+		})
+	}
+	return kinds, nil
+}
+
+// KindDescription is a kind as the shell's :describe shows it: where it's served, and the fields of its OpenAPI
+// schema, e.g. spec.template.spec.containers[].image
+type KindDescription struct {
+	SchemaKind
+	Fields []string `json:"fields"`
+}
+
+// DescribeKind describes the kind an identifier refers to. Its fields are only known once the OpenAPI schemas are
+// loaded, see InitResourceSpecs.
+func DescribeKind(clientset kubernetes.Interface, identifier string) (*KindDescription, error) {
+	resolutions, err := ResolveKind(clientset, identifier)
+	if err != nil {
+		return nil, err
+	}
+	resolution, err := resolveOne(identifier, resolutions)
+	if err != nil {
+		return nil, err
+	}
+	description := &KindDescription{
+		SchemaKind: SchemaKind{
+			Kind:       resolution.Kind,
+			Resource:   resolution.Resource,
+			Group:      resolution.Group,
+			Version:    resolution.Version,
+			Namespaced: resolution.Namespaced,
+		},
+		Fields: []string{},
+	}
+	apiResourceLists, err := loadAPIResourceList(clientset)
+	if err != nil {
+		return nil, err
+	}
+	for _, apiResourceList := range apiResourceLists {
+		if apiResourceList.GroupVersion != resolution.GVR.GroupVersion().String() {
+			continue
+		}
+		for _, resource := range apiResourceList.APIResources {
+			if resource.Name == resolution.Resource {
+				description.ShortNames = resource.ShortNames
+			}
+		}
+	}
+	for _, field := range schemaFields(resolution.GVR, resolution.Kind) {
+		if !slices.Contains(description.Fields, field) {
+			description.Fields = append(description.Fields, field)
+		}
+	}
+	return description, nil
+}
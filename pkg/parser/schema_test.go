@@ -0,0 +1,113 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetSchema(t *testing.T) {
+	originalList := apiResourceListCache
+	defer func() { apiResourceListCache = originalList }()
+	apiResourceListCache = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "pods", SingularName: "pod", Kind: "Pod", Namespaced: true, ShortNames: []string{"po"}},
+			},
+		},
+		{
+			GroupVersion: "apps/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "replicasets", SingularName: "replicaset", Kind: "ReplicaSet", Namespaced: true, ShortNames: []string{"rs"}},
+				{Name: "deployments", SingularName: "deployment", Kind: "Deployment", Namespaced: true, ShortNames: []string{"deploy"}},
+			},
+		},
+	}
+
+	result, err := GetSchema(nil)
+	if err != nil {
+		t.Fatalf("GetSchema() error = %v", err)
+	}
+	var kinds []string
+	for _, kind := range result.Kinds {
+		kinds = append(kinds, kind.Kind)
+	}
+	if !reflect.DeepEqual(kinds, []string{"Deployment", "Pod", "ReplicaSet"}) {
+		t.Errorf("unexpected kinds %v", kinds)
+	}
+	if result.Kinds[0].Group != "apps" || result.Kinds[0].Resource != "deployments" || !result.Kinds[0].Namespaced {
+		t.Errorf("unexpected kind %+v", result.Kinds[0])
+	}
+	found := false
+	for _, relationship := range result.Relationships {
+		found = found || relationship == SchemaRelationship{KindA: "Pod", KindB: "ReplicaSet", Type: string(ReplicasetOwnPod)}
+	}
+	if !found {
+		t.Errorf("expected the relationship of pods to their replica sets, got %+v", result.Relationships)
+	}
+}
+
+func TestListableKinds(t *testing.T) {
+	originalList := apiResourceListCache
+	defer func() { apiResourceListCache = originalList }()
+	apiResourceListCache = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "pods", Kind: "Pod", Namespaced: true, Verbs: []string{"get", "list"}},
+				{Name: "nodes", Kind: "Node", Verbs: []string{"get", "list"}},
+				{Name: "bindings", Kind: "Binding", Namespaced: true, Verbs: []string{"create"}},
+			},
+		},
+	}
+
+	kinds, err := ListableKinds(nil, "")
+	if err != nil {
+		t.Fatalf("ListableKinds() error = %v", err)
+	}
+	expected := []SchemaKind{
+		{Kind: "Pod", Resource: "pods", Version: "v1", Namespaced: true},
+		{Kind: "Node", Resource: "nodes", Version: "v1"},
+	}
+	if !reflect.DeepEqual(kinds, expected) {
+		t.Errorf("expected %+v, got %+v", expected, kinds)
+	}
+	// A namespace holds no nodes
+	if kinds, _ := ListableKinds(nil, "default"); len(kinds) != 1 || kinds[0].Kind != "Pod" {
+		t.Errorf("expected only namespaced kinds, got %+v", kinds)
+	}
+}
+
+func TestDescribeKind(t *testing.T) {
+	originalList, originalSpecs := apiResourceListCache, ResourceSpecs
+	defer func() { apiResourceListCache, ResourceSpecs = originalList, originalSpecs }()
+	apiResourceListCache = []*metav1.APIResourceList{
+		{
+			GroupVersion: "apps/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "deployments", SingularName: "deployment", Kind: "Deployment", Namespaced: true, ShortNames: []string{"deploy"}},
+			},
+		},
+	}
+	ResourceSpecs = map[string][]string{
+		"io.k8s.api.apps.v1.Deployment": {"metadata", "metadata.name", "spec", "spec.replicas", "spec.replicas"},
+	}
+
+	description, err := DescribeKind(nil, "deploy")
+	if err != nil {
+		t.Fatalf("DescribeKind() error = %v", err)
+	}
+	expected := &KindDescription{
+		SchemaKind: SchemaKind{Kind: "Deployment", Resource: "deployments", Group: "apps", Version: "v1", Namespaced: true, ShortNames: []string{"deploy"}},
+		Fields:     []string{"metadata", "metadata.name", "spec", "spec.replicas"},
+	}
+	if !reflect.DeepEqual(description, expected) {
+		t.Errorf("DescribeKind() = %+v, want %+v", description, expected)
+	}
+
+	if _, err := DescribeKind(nil, "widget"); DiagnosticCodeOf(err) != CodeUnknownKind {
+		t.Errorf("expected an unknown kind, got %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// With server-side apply, CREATE and MERGE apply the resources they create, and SET the values it sets, as the
+// FieldManager. The API server records the fields each manager applied, so a query owns the fields it sets and
+// leaves those of other managers, e.g. controllers, alone: an apply that sets a field another manager owns fails with
+// a conflict instead of overwriting it. Each apply declares every field its manager wants to own, the fields the
+// manager applied before and leaves out are removed unless another manager owns them too. Queries managing
+// different fields of the same resources should have field managers of their own.
+
+// ServerSideApply makes the changes of queries server-side applies rather than creations and patches
+var ServerSideApply bool
+
+// FieldManager is the field manager of the changes queries make
+var FieldManager = "cyphernetes"
+
+// applyPatchType is the patch type of the SET clauses of queries with server-side apply
+const applyPatchType = "apply"
+
+// applySetClause applies the values of a SET clause to the resources of its nodes, with a single apply per resource
+// holding every value the clause sets in it. The nodes of created holds the resources MERGE created with the values.
+func (q *QueryExecutor) applySetClause(c *SetClause, created map[string]bool) error {
+	subresource, err := setSubresource(c)
+	if err != nil {
+		return err
+	}
+	var nodeIds []string
+	pairs := map[string][]*KeyValuePair{}
+	for _, kvp := range c.KeyValuePairs {
+		nodeId := strings.Split(kvp.Key, ".")[0]
+		if created[nodeId] {
+			continue
+		}
+		if kvp.Value == nil || listIndex.MatchString(kvp.Key) {
+			return newDiagnosticError(CodeInvalidPatchType, nil, "reason", fmt.Sprintf("server-side apply sets the fields a query owns, %s can't remove fields or set list elements, use a json patch", kvp.Key))
+		}
+		if _, ok := pairs[nodeId]; !ok {
+			nodeIds = append(nodeIds, nodeId)
+		}
+		pairs[nodeId] = append(pairs[nodeId], kvp)
+	}
+
+	for _, nodeId := range nodeIds {
+		// The ledger identifies the change by what it sets, like for other patches
+		set := []interface{}{applyPatchType, FieldManager}
+		for _, kvp := range pairs[nodeId] {
+			set = append(set, setPath(kvp.Key), kvp.Value)
+		}
+		if c.Status {
+			set = append(set, "status")
+		}
+		change, err := json.Marshal(set)
+		if err != nil {
+			return newDiagnosticError(CodeInvalidPatch, err)
+		}
+		digest := patchDigest(change)
+
+		resources, _ := q.resultMap[nodeId].([]map[string]interface{})
+		for _, resource := range resources {
+			configuration := applyConfiguration(resource)
+			for _, kvp := range pairs[nodeId] {
+				updateResultMap(configuration, setPath(kvp.Key), kvp.Value)
+			}
+			data, err := json.Marshal(configuration)
+			if err != nil {
+				return newDiagnosticError(CodeInvalidPatch, err)
+			}
+			if err := q.patchK8sResource(resource, types.ApplyPatchType, data, digest, subresource...); err != nil {
+				if err := q.changeFailed(err); err != nil {
+					return fmt.Errorf("error patching resource: %w", err)
+				}
+				continue
+			}
+			for _, kvp := range pairs[nodeId] {
+				updateResultMap(resource, setPath(kvp.Key), kvp.Value)
+			}
+		}
+	}
+	return nil
+}
+
+// applyConfiguration is the start of an apply configuration of a resource, identifying it
+func applyConfiguration(resource map[string]interface{}) map[string]interface{} {
+	metadata, _ := resource["metadata"].(map[string]interface{})
+	identity := map[string]interface{}{"name": metadata["name"]}
+	if namespace, ok := metadata["namespace"]; ok {
+		identity["namespace"] = namespace
+	}
+	return map[string]interface{}{
+		"apiVersion": resource["apiVersion"],
+		"kind":       resource["kind"],
+		"metadata":   identity,
+	}
+}
+
+// serverSideApplyLabel is how EXPLAIN notes that resources are created with server-side apply
+func serverSideApplyLabel() string {
+	if !ServerSideApply {
+		return ""
+	}
+	return " with server-side apply as " + FieldManager
+}
@@ -0,0 +1,153 @@
+package parser
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// fieldManagers records the field managers of the creations and patches made through a client, which the fake
+// client leaves out of its actions
+type fieldManagers struct {
+	dynamic.Interface
+	managers []string
+}
+
+type fieldManagersResource struct {
+	dynamic.ResourceInterface
+	client *fieldManagers
+}
+
+type fieldManagersNamespaceableResource struct {
+	dynamic.NamespaceableResourceInterface
+	client *fieldManagers
+}
+
+func (c *fieldManagers) Resource(gvr schema.GroupVersionResource) dynamic.NamespaceableResourceInterface {
+	return fieldManagersNamespaceableResource{c.Interface.Resource(gvr), c}
+}
+
+func (r fieldManagersNamespaceableResource) Namespace(namespace string) dynamic.ResourceInterface {
+	return fieldManagersResource{r.NamespaceableResourceInterface.Namespace(namespace), r.client}
+}
+
+func (r fieldManagersResource) Create(ctx context.Context, obj *unstructured.Unstructured, options metav1.CreateOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	r.client.managers = append(r.client.managers, "create "+options.FieldManager)
+	return r.ResourceInterface.Create(ctx, obj, options, subresources...)
+}
+
+func (r fieldManagersResource) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, options metav1.PatchOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	r.client.managers = append(r.client.managers, "patch "+options.FieldManager)
+	return r.ResourceInterface.Patch(ctx, name, pt, data, options, subresources...)
+}
+
+// applied records the server-side applies of a fake client, answering with the applied configuration
+func applied(fake *dynamicfake.FakeDynamicClient, resource string) *[]k8stesting.PatchActionImpl {
+	var actions []k8stesting.PatchActionImpl
+	fake.PrependReactor("patch", resource, func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchActionImpl)
+		if patch.GetPatchType() != types.ApplyPatchType {
+			return false, nil, nil
+		}
+		actions = append(actions, patch)
+		object := &unstructured.Unstructured{}
+		return true, object, object.UnmarshalJSON(patch.GetPatch())
+	})
+	return &actions
+}
+
+func enableServerSideApply(t *testing.T) {
+	originalServerSideApply, originalFieldManager := ServerSideApply, FieldManager
+	t.Cleanup(func() { ServerSideApply, FieldManager = originalServerSideApply, originalFieldManager })
+	ServerSideApply, FieldManager = true, "release-bot"
+}
+
+func TestServerSideApplySet(t *testing.T) {
+	enableServerSideApply(t)
+	q := newTestQueryExecutor(t, newPatchTestDeployment())
+	actions := applied(q.DynamicClient.(*dynamicfake.FakeDynamicClient), "deployments")
+	managers := &fieldManagers{Interface: q.DynamicClient}
+	q.DynamicClient = managers
+
+	result := executeTestQuery(t, q, `MATCH (d:Deployment) SET d.spec.replicas = 3, d.metadata.labels.tier = "web" RETURN d.spec.replicas, d.metadata.labels.tier`)
+	if len(*actions) != 1 {
+		t.Fatalf("expected a single apply of the deployment, got %d", len(*actions))
+	}
+	action := (*actions)[0]
+	if action.GetName() != "web" || !reflect.DeepEqual(managers.managers, []string{"patch release-bot"}) {
+		t.Errorf("expected web to be applied by release-bot, got %s by %v", action.GetName(), managers.managers)
+	}
+	var configuration map[string]interface{}
+	json.Unmarshal(action.GetPatch(), &configuration)
+	expected := map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "default", "labels": map[string]interface{}{"tier": "web"}},
+		"spec":       map[string]interface{}{"replicas": float64(3)},
+	}
+	if !reflect.DeepEqual(configuration, expected) {
+		t.Errorf("expected the configuration to hold only the values set, got %v", configuration)
+	}
+	row := result.Data["d"].([]interface{})[0].(map[string]interface{})
+	if replicas := row["spec"].(map[string]interface{})["replicas"]; replicas != 3 {
+		t.Errorf("expected the returned replicas to be set, got %v", replicas)
+	}
+
+	// Applies only set fields, clauses removing fields or setting list elements name a JSON patch instead
+	ast, err := ParseQuery(`MATCH (d:Deployment) SET d.metadata.labels.tier = null`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Execute(ast, "default"); DiagnosticCodeOf(err) != CodeInvalidPatchType {
+		t.Errorf("expected code %s, got %v", CodeInvalidPatchType, err)
+	}
+	executeTestQuery(t, q, `MATCH (d:Deployment) SET JSON d.spec.template.spec.containers[0].image = "nginx:2"`)
+	if len(*actions) != 1 {
+		t.Errorf("expected the JSON patch not to be applied, got %d applies", len(*actions))
+	}
+}
+
+func TestServerSideApplyMerge(t *testing.T) {
+	enableServerSideApply(t)
+	q := newTestQueryExecutor(t)
+	fake := q.DynamicClient.(*dynamicfake.FakeDynamicClient)
+	actions := applied(fake, "configmaps")
+	fake.PrependReactor("create", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		t.Error("expected the config map to be applied rather than created")
+		return false, nil, nil
+	})
+
+	managers := &fieldManagers{Interface: fake}
+	q.DynamicClient = managers
+
+	executeTestQuery(t, q, `MERGE (c:ConfigMap {name: "settings"}) SET c.data.key = "v" RETURN c.data`)
+	if len(*actions) != 1 || (*actions)[0].GetName() != "settings" || !reflect.DeepEqual(managers.managers, []string{"patch release-bot"}) {
+		t.Fatalf("expected settings to be applied by release-bot, got %d applies by %v", len(*actions), managers.managers)
+	}
+	var configuration map[string]interface{}
+	json.Unmarshal((*actions)[0].GetPatch(), &configuration)
+	if !reflect.DeepEqual(configuration["data"], map[string]interface{}{"key": "v"}) {
+		t.Errorf("expected the values of the SET clause to be applied, got %v", configuration)
+	}
+}
+
+func TestFieldManager(t *testing.T) {
+	q := newTestQueryExecutor(t, newTestObject("v1", "Pod", "default", "web-1", nil))
+	managers := &fieldManagers{Interface: q.DynamicClient}
+	q.DynamicClient = managers
+	executeTestQuery(t, q, `CREATE (c:ConfigMap {"name": "settings"})`)
+	executeTestQuery(t, q, `MATCH (p:Pod) SET p.metadata.labels.tier = "web"`)
+	if !reflect.DeepEqual(managers.managers, []string{"create cyphernetes", "patch cyphernetes"}) {
+		t.Errorf("expected the changes to be made by cyphernetes, got %v", managers.managers)
+	}
+}
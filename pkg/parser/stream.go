@@ -0,0 +1,270 @@
+package parser
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// StreamPageSize is the number of resources a streamed query lists per API call
+var StreamPageSize int64 = 500
+
+// ResultRow is one row of a streamed query: the RETURN items of a single resource matched by Node.
+// Aggregations arrive as a single row for the "aggregate" node once all resources have been seen.
+type ResultRow struct {
+	Node string
+	Data map[string]interface{}
+}
+
+// ExecuteStream runs a query and sends its result rows on the returned channel as they are produced,
+// so large results can be processed incrementally. Queries matching a single node, without
+// relationships, aggregations or DISTINCT, are paged through the API and their rows arrive page by page;
+// any other query is evaluated as a whole before its rows are sent.
+//
+// Cancelling ctx stops the query. The rows channel is always closed when the query ends, after
+// which the error channel yields the error that ended it, if any. Like Execute, only one query
+// may run at a time.
+func (q *QueryExecutor) ExecuteStream(ctx context.Context, ast *Expression, namespace string) (<-chan ResultRow, <-chan error) {
+	rows := make(chan ResultRow)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(rows)
+
+		var err error
+		if match, returnClause, ok := streamablePattern(ast); ok {
+			err = q.preflight(ctx, ast, namespace, false)
+			if err == nil {
+				err = q.streamPages(ctx, match, returnClause, namespace, rows)
+			}
+		} else {
+			err = q.streamResult(ctx, ast, namespace, rows)
+		}
+		if err != nil {
+			errs <- err
+		}
+	}()
+
+	return rows, errs
+}
+
+// streamablePattern reports whether the query's rows can be produced one API page at a time
+func streamablePattern(ast *Expression) (*MatchClause, *ReturnClause, bool) {
+	if ast.Explain || ast.Union != nil || len(ast.Clauses) != 2 {
+		return nil, nil, false
+	}
+	match, ok := ast.Clauses[0].(*MatchClause)
+	if !ok || len(match.Nodes) != 1 || len(match.Relationships) != 0 || match.Nodes[0].ResourceProperties.Kind == "" {
+		return nil, nil, false
+	}
+	// Distinct and ordered rows are only known once the whole result is
+	returnClause, ok := ast.Clauses[1].(*ReturnClause)
+	if !ok || returnClause.Distinct || len(returnClause.OrderBy) > 0 {
+		return nil, nil, false
+	}
+	for _, item := range returnClause.Items {
+		if item.Aggregate != "" {
+			return nil, nil, false
+		}
+	}
+	return match, returnClause, true
+}
+
+func (q *QueryExecutor) streamPages(ctx context.Context, match *MatchClause, returnClause *ReturnClause, namespace string, rows chan<- ResultRow) error {
+	q.prepareQuery(namespace)
+	defer q.clearQueryState()
+
+	nodeId := match.Nodes[0].ResourceProperties.Name
+	pageSize := func() int64 { return StreamPageSize }
+	_, err := q.listPages(ctx, match, returnClause, pageCursor{}, pageSize, func(page *QueryResult) (bool, error) {
+		for _, row := range page.Data[nodeId].([]interface{}) {
+			if err := sendRow(ctx, rows, ResultRow{Node: nodeId, Data: row.(map[string]interface{})}); err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	})
+	return err
+}
+
+// pageCursor is where listing the resources of a pattern resumes: at the page of Continue, the continue token of
+// the API server, of the target listed at index Target
+type pageCursor struct {
+	Target   int    `json:"t,omitempty"`
+	Continue string `json:"c,omitempty"`
+}
+
+// listPages lists the resources matched by the single node of a streamable pattern one API page at a time, from the
+// cursor on, and hands the rows RETURN projects from each page to handle, which returns false to stop after it. The
+// size of each page is asked from pageSize. listPages returns the cursor of the first page that wasn't handled, or
+// nil once all of them were. When ctx is done the cursor is returned along with the context's error.
+func (q *QueryExecutor) listPages(ctx context.Context, match *MatchClause, returnClause *ReturnClause, from pageCursor, pageSize func() int64, handle func(page *QueryResult) (bool, error)) (*pageCursor, error) {
+	node := match.Nodes[0]
+	nodeId := node.ResourceProperties.Name
+	q.applyNamespaceProperty(node)
+	fieldSelector, labelSelector, err := q.nodeSelectors(node)
+	if err != nil {
+		return nil, err
+	}
+	labelSelector, err = parseLabelSelector(strings.ReplaceAll(labelSelector, "\"", ""))
+	if err != nil {
+		return nil, err
+	}
+
+	targets, err := listTargetsForKind(q.Clientset, node.ResourceProperties.Kind, q.namespace)
+	if err != nil {
+		return nil, err
+	}
+	q.metricsNodes = metricsNodes(&Expression{Clauses: []Clause{match, returnClause}})
+	if from.Target > len(targets) {
+		return nil, newDiagnosticError(CodeInvalidContinue, nil, "reason", "the kinds of the query changed")
+	}
+
+	// The same object can be listed through several targets, only return it once
+	seen := make(map[string]bool)
+	for i := from.Target; i < len(targets); i++ {
+		target := targets[i]
+		options := metav1.ListOptions{
+			FieldSelector: fieldSelector,
+			LabelSelector: labelSelector,
+		}
+		if i == from.Target {
+			options.Continue = from.Continue
+		}
+		for {
+			if err := ctx.Err(); err != nil {
+				return &pageCursor{Target: i, Continue: options.Continue}, err
+			}
+			options.Limit = pageSize()
+			q.observeAPICall("list", target.gvr)
+			listCtx, cancel := listContext(ctx, target.gvr)
+			list, err := q.listResources(listCtx, target, options)
+			cancel()
+			if err != nil {
+				if ctx.Err() != nil {
+					return &pageCursor{Target: i, Continue: options.Continue}, ctx.Err()
+				}
+				if options.Continue != "" && apierrors.IsResourceExpired(err) {
+					return nil, newDiagnosticError(CodeContinueExpired, err, "resource", target.gvr.Resource)
+				}
+				if node.ResourceProperties.Kind == "*" {
+					// A wildcard can't expect every resource to be listable, skip the ones we can't read
+					logDebug("Skipping resource in wildcard match", "resource", target.gvr.String(), "error", err)
+					break
+				}
+				return nil, q.listError(listCtx, target.gvr, err)
+			}
+
+			var resources []map[string]interface{}
+			for _, item := range list.Items {
+				if len(targets) > 1 {
+					target.tag(&item)
+				}
+				resource := item.UnstructuredContent()
+				if seen[resourceIdentity(resource)] {
+					continue
+				}
+				seen[resourceIdentity(resource)] = true
+				resources = append(resources, resource)
+			}
+
+			if err := q.addMetrics(node, resources); err != nil {
+				return nil, err
+			}
+			q.resultMap[nodeId] = resources
+			q.resultSources[nodeId] = resultSource{source: ProvenanceLive, fetchedAt: time.Now()}
+			if err := q.applyExtraFilters(node, match.ExtraFilters); err != nil {
+				return nil, err
+			}
+
+			page := &QueryResult{Data: make(map[string]interface{}), Graph: Graph{Nodes: []Node{}, Edges: []Edge{}}}
+			if err := q.projectReturn(returnClause, page); err != nil {
+				return nil, err
+			}
+			if page.Data[nodeId] == nil {
+				page.Data[nodeId] = []interface{}{}
+			}
+			// Hidden resources were already counted by projectReturn
+			for _, resource := range q.returnedResources(nodeId, &QueryResult{}) {
+				page.Graph.Nodes = append(page.Graph.Nodes, graphNode(nodeId, resource))
+			}
+			more, err := handle(page)
+			if err != nil {
+				return nil, err
+			}
+
+			next := &pageCursor{Target: i, Continue: list.GetContinue()}
+			if next.Continue == "" {
+				next = &pageCursor{Target: i + 1}
+			}
+			if !more {
+				if next.Target == len(targets) {
+					return nil, nil
+				}
+				return next, nil
+			}
+			if list.GetContinue() == "" {
+				break
+			}
+			options.Continue = list.GetContinue()
+		}
+	}
+	return nil, nil
+}
+
+// streamResult runs the query in full and sends the rows of its result
+func (q *QueryExecutor) streamResult(ctx context.Context, ast *Expression, namespace string, rows chan<- ResultRow) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	results, err := q.Execute(ast, namespace)
+	if err != nil {
+		return err
+	}
+
+	var nodeIds []string
+	for nodeId := range results.Data {
+		if nodeId != "aggregate" {
+			nodeIds = append(nodeIds, nodeId)
+		}
+	}
+	sort.Strings(nodeIds)
+	if results.Data["aggregate"] != nil {
+		nodeIds = append(nodeIds, "aggregate")
+	}
+
+	for _, nodeId := range nodeIds {
+		switch data := results.Data[nodeId].(type) {
+		case []interface{}:
+			for _, row := range data {
+				if err := sendRow(ctx, rows, ResultRow{Node: nodeId, Data: row.(map[string]interface{})}); err != nil {
+					return err
+				}
+			}
+		case map[string]interface{}:
+			if err := sendRow(ctx, rows, ResultRow{Node: nodeId, Data: data}); err != nil {
+				return err
+			}
+		default:
+			// e.g. the plan of an EXPLAIN query
+			if err := sendRow(ctx, rows, ResultRow{Node: nodeId, Data: map[string]interface{}{nodeId: data}}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func sendRow(ctx context.Context, rows chan<- ResultRow, row ResultRow) error {
+	select {
+	case rows <- row:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
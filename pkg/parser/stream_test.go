@@ -0,0 +1,111 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// pagePods makes list calls return the given pages of pods, one per call
+func pagePods(q *QueryExecutor, pages ...[]string) *int {
+	calls := 0
+	q.DynamicClient.(*dynamicfake.FakeDynamicClient).PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if calls >= len(pages) {
+			return true, nil, fmt.Errorf("unexpected list call %d", calls+1)
+		}
+		list := &unstructured.UnstructuredList{Object: map[string]interface{}{"apiVersion": "v1", "kind": "PodList"}}
+		for _, name := range pages[calls] {
+			list.Items = append(list.Items, *newTestObject("v1", "Pod", "default", name, nil))
+		}
+		calls++
+		if calls < len(pages) {
+			list.SetContinue(fmt.Sprintf("page-%d", calls))
+		}
+		return true, list, nil
+	})
+	return &calls
+}
+
+func TestExecuteStreamPages(t *testing.T) {
+	q := newTestQueryExecutor(t)
+	calls := pagePods(q, []string{"web-1", "web-2"}, []string{"web-3"})
+
+	ast, err := ParseQuery("MATCH (p:Pod) RETURN p.metadata.namespace")
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	rows, errs := q.ExecuteStream(context.Background(), ast, "default")
+
+	var names []string
+	for row := range rows {
+		if row.Node != "p" {
+			t.Errorf("expected rows for p, got %s", row.Node)
+		}
+		names = append(names, row.Data["name"].(string))
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("ExecuteStream() error = %v", err)
+	}
+
+	if *calls != 2 {
+		t.Errorf("expected 2 list calls, got %d", *calls)
+	}
+	if len(names) != 3 || names[0] != "web-1" || names[2] != "web-3" {
+		t.Errorf("expected rows web-1..web-3, got %v", names)
+	}
+}
+
+func TestExecuteStreamCancel(t *testing.T) {
+	q := newTestQueryExecutor(t)
+	pagePods(q, []string{"web-1", "web-2"}, []string{"web-3"})
+
+	ast, err := ParseQuery("MATCH (p:Pod) RETURN p")
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	rows, errs := q.ExecuteStream(ctx, ast, "default")
+
+	<-rows
+	cancel()
+	for range rows {
+	}
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestExecuteStreamAggregate(t *testing.T) {
+	q := newTestQueryExecutor(t,
+		newTestObject("v1", "Pod", "default", "web-1", nil),
+		newTestObject("v1", "Pod", "default", "web-2", nil),
+	)
+
+	ast, err := ParseQuery("MATCH (p:Pod) RETURN COUNT{p} AS pods")
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	rows, errs := q.ExecuteStream(context.Background(), ast, "default")
+
+	var received []ResultRow
+	for row := range rows {
+		received = append(received, row)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("ExecuteStream() error = %v", err)
+	}
+
+	if len(received) != 3 {
+		t.Fatalf("expected 2 pod rows and an aggregate row, got %v", received)
+	}
+	last := received[len(received)-1]
+	if last.Node != "aggregate" || last.Data["pods"] != 2 {
+		t.Errorf("expected the aggregate last with pods=2, got %+v", last)
+	}
+}
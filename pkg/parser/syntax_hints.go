@@ -0,0 +1,106 @@
+package parser
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// closers are the brackets closing each opening one
+var closers = map[byte]byte{'(': ')', '{': '}', '[': ']'}
+
+// tokenAt is the text of the token starting at offset of the input: a word, a quoted string, the start of a block
+// comment or a single character.
+// It's empty at the end of the input.
+func tokenAt(input string, offset int) string {
+	if offset < 0 || offset >= len(input) {
+		return ""
+	}
+	s := input[offset:]
+	if strings.HasPrefix(s, "/*") {
+		return "/*"
+	}
+	if s[0] == '"' || s[0] == '\'' {
+		if end := strings.IndexByte(s[1:], s[0]); end >= 0 {
+			return s[:end+2]
+		}
+		return strings.TrimRight(s, " \t\r\n")
+	}
+	n := strings.IndexFunc(s, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' })
+	switch n {
+	case -1:
+		return s
+	case 0:
+		_, size := utf8.DecodeRuneInString(s)
+		return s[:size]
+	}
+	return s[:n]
+}
+
+// positionAt is the line and column of offset in the input, both counted from 1
+func positionAt(input string, offset int) (line, column int) {
+	return 1 + strings.Count(input[:offset], "\n"), offset - strings.LastIndex(input[:offset], "\n")
+}
+
+// suggestFix says how to fix the syntax error of a query found at offset, for the mistakes people make most: strings
+// in single quotes, strings and comments that aren't closed, brackets left open and misspelled keywords. It's empty
+// when none of them applies.
+func suggestFix(input string, offset int, found string, expected []string) string {
+	switch {
+	case strings.HasPrefix(found, "'"):
+		value := strings.Trim(found, "'")
+		return fmt.Sprintf("strings are in double quotes, e.g. %q", value)
+	case strings.HasPrefix(found, `"`) && (len(found) == 1 || !strings.HasSuffix(found, `"`)):
+		return `the string isn't closed, end it with "`
+	case found == "/*":
+		return "the comment isn't closed, end it with */"
+	}
+	if open, ok := unclosedBracket(input[:offset]); ok {
+		closer := string(closers[input[open]])
+		if found == "" || slices.Contains(expected, "'"+closer+"'") {
+			line, column := positionAt(input, open)
+			return fmt.Sprintf("add '%s' to close the '%c' at line %d, column %d", closer, input[open], line, column)
+		}
+	}
+	var keywords []string
+	for _, name := range expected {
+		if isKeyword(name) {
+			keywords = append(keywords, name)
+		}
+	}
+	if found != "" && unicode.IsLetter(rune(found[0])) {
+		if keyword, ok := closestField(found, keywords); ok && !strings.EqualFold(keyword, found) {
+			return "did you mean " + keyword + "?"
+		}
+	}
+	return ""
+}
+
+// unclosedBracket is the offset of the last bracket of the query left open, brackets in strings aside
+func unclosedBracket(query string) (int, bool) {
+	var open []int
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case closers[c] != 0:
+			open = append(open, i)
+		case len(open) > 0 && c == closers[query[open[len(open)-1]]]:
+			open = open[:len(open)-1]
+		}
+	}
+	if len(open) == 0 {
+		return 0, false
+	}
+	return open[len(open)-1], true
+}
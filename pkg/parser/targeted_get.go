@@ -0,0 +1,56 @@
+package parser
+
+import (
+	"context"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// A node pattern selecting a single resource by its name, e.g. (d:Deployment {name: "web"}), is fetched with a
+// GET of that resource rather than a list call with a metadata.name field selector, when the namespace it's in is
+// known or its kind is cluster-scoped. The API server serves it without going through the resources of the kind,
+// and the query only needs the get permission on them. A resource that doesn't exist matches nothing, as an empty
+// list would. Nodes with other selectors, and those matched across all namespaces, are still listed.
+
+// namedResource is the name of the single resource selected by the selectors of a list call, if they select one
+// by name and nothing else
+func namedResource(fieldSelector, labelSelector string) (string, bool) {
+	if fieldSelector == "" || labelSelector != "" {
+		return "", false
+	}
+	selector, err := fields.ParseSelector(fieldSelector)
+	if err != nil {
+		return "", false
+	}
+	requirements := selector.Requirements()
+	if len(requirements) != 1 || requirements[0].Field != "metadata.name" || requirements[0].Operator == selection.NotEquals {
+		return "", false
+	}
+	return requirements[0].Value, true
+}
+
+// gets tells whether the resources of the target are fetched by name in namespace, which they are unless they're
+// namespaced and the namespace isn't known
+func (target listTarget) gets(namespace string) bool {
+	return !target.namespaced || namespace != ""
+}
+
+// getResource fetches the resource of the target with the given name, as a list of it, or an empty list if
+// there's no such resource
+func (q *QueryExecutor) getResource(ctx context.Context, target listTarget, name string) (*unstructured.UnstructuredList, error) {
+	item, err := target.resource(q.DynamicClient, q.namespace).Get(ctx, name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		return &unstructured.UnstructuredList{}, nil
+	case err != nil:
+		if _, ok := listTimedOut(ctx); ok {
+			return nil, q.listError(ctx, target.gvr, err)
+		}
+		return nil, apiError("get", target.gvr, err)
+	}
+	return &unstructured.UnstructuredList{Items: []unstructured.Unstructured{*item}}, nil
+}
@@ -0,0 +1,90 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestTargetedGet(t *testing.T) {
+	q := newTestQueryExecutor(t,
+		newTestObject("apps/v1", "Deployment", "default", "web", nil),
+		newTestObject("apps/v1", "Deployment", "default", "api", nil),
+		newTestObject("v1", "Node", "", "node-a", nil),
+	)
+	client := q.DynamicClient.(*fake.FakeDynamicClient)
+	verbs := func() []string {
+		var verbs []string
+		for _, action := range client.Actions() {
+			verbs = append(verbs, action.GetVerb()+" "+action.GetResource().Resource)
+		}
+		client.ClearActions()
+		return verbs
+	}
+
+	result := executeTestQuery(t, q, `MATCH (d:Deployment {name: "web"}) RETURN d.metadata.name`)
+	if rows := result.Data["d"].([]interface{}); len(rows) != 1 || rows[0].(map[string]interface{})["name"] != "web" {
+		t.Errorf("expected the web deployment, got %v", rows)
+	}
+	if got := verbs(); !reflect.DeepEqual(got, []string{"get deployments"}) {
+		t.Errorf("expected the deployment to be fetched by name, got %v", got)
+	}
+
+	// A resource that doesn't exist matches nothing
+	result = executeTestQuery(t, q, `MATCH (d:Deployment {name: "shop"}) RETURN d.metadata.name`)
+	if rows, _ := result.Data["d"].([]interface{}); len(rows) != 0 {
+		t.Errorf("expected no deployment, got %v", rows)
+	}
+	verbs()
+
+	// Across all namespaces, only cluster-scoped resources are fetched by name
+	Namespace = ""
+	for query, expected := range map[string]string{
+		`MATCH (d:Deployment {name: "web"}) RETURN d`: "list deployments",
+		`MATCH (n:Node {name: "node-a"}) RETURN n`:    "get nodes",
+	} {
+		ast, err := ParseQuery(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := q.Execute(ast, ""); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		if got := verbs(); !reflect.DeepEqual(got, []string{expected}) {
+			t.Errorf("%s: expected %s, got %v", query, expected, got)
+		}
+	}
+	Namespace = "default"
+
+	ast, err := ParseQuery(`MATCH (d:Deployment {name: "web"}), (p:Pod) RETURN d, p`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	access, err := q.Access(ast, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var requests []string
+	for _, request := range access {
+		requests = append(requests, request.String())
+	}
+	if expected := []string{"get deployments.apps in namespace default", "list pods in namespace default"}; !reflect.DeepEqual(requests, expected) {
+		t.Errorf("expected %v, got %v", expected, requests)
+	}
+
+	client.PrependReactor("get", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Group: "apps", Resource: "deployments"}, "web", nil)
+	})
+	ast, err = ParseQuery(`MATCH (d:Deployment {name: "web"}) RETURN d`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Execute(ast, "default"); DiagnosticCodeOf(err) != CodeForbidden {
+		t.Errorf("expected the get to be forbidden, got %v", err)
+	}
+}
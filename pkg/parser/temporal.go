@@ -0,0 +1,207 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// temporalFunction is a function of temporal values, e.g. duration("24h")
+type temporalFunction struct {
+	name string
+	// arg is whether the function takes an argument: required by duration, datetime() without one is now()
+	arg bool
+}
+
+var temporalFunctions = map[string]temporalFunction{
+	"NOW":      {name: "now"},
+	"DATETIME": {name: "datetime", arg: true},
+	"DURATION": {name: "duration", arg: true},
+}
+
+func isTemporalFunction(name string) bool {
+	_, ok := temporalFunctions[strings.ToUpper(name)]
+	return ok
+}
+
+// dateTimeLayouts are the formats datetime() parses, Kubernetes timestamps are RFC 3339
+var dateTimeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"}
+
+// parseDateTime parses a timestamp, in UTC unless it has a time zone
+func parseDateTime(s string) (time.Time, error) {
+	var err error
+	for _, layout := range dateTimeLayouts {
+		var t time.Time
+		if t, err = time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// durationDays matches the days of a duration, which time.ParseDuration doesn't know, e.g. 7d or 1d12h
+var durationDays = regexp.MustCompile(`^(-?)(\d+)d`)
+
+// parseDuration parses a Go duration such as 1h30m, which may also count days, e.g. 7d
+func parseDuration(s string) (time.Duration, error) {
+	match := durationDays.FindStringSubmatch(s)
+	if match == nil {
+		return time.ParseDuration(s)
+	}
+	days, err := strconv.Atoi(match[2])
+	if err != nil {
+		return 0, err
+	}
+	duration := time.Duration(days) * 24 * time.Hour
+	if rest := s[len(match[0]):]; rest != "" {
+		more, err := time.ParseDuration(rest)
+		if err != nil {
+			return 0, err
+		}
+		duration += more
+	}
+	if match[1] == "-" {
+		duration = -duration
+	}
+	return duration, nil
+}
+
+// evaluate computes the expression at now: a time.Time when it adds up to a point in time, e.g.
+// now() - duration("1h"), or a time.Duration, e.g. duration("1h") or now() - datetime("2024-01-01")
+func (e *TemporalExpression) evaluate(now time.Time) (interface{}, error) {
+	// The points in time are summed relative to the first one, so the sum doesn't overflow
+	var anchor time.Time
+	var anchored bool
+	var points int
+	var sum time.Duration
+	for _, term := range e.Terms {
+		f, ok := temporalFunctions[term.Function]
+		if !ok {
+			return nil, newDiagnosticError(CodeUnknownFunction, nil, "function", strings.ToLower(term.Function))
+		}
+		invalid := func(err error, reason string) error {
+			return newDiagnosticError(CodeInvalidTemporal, err, "expression", e.String(), "reason", reason)
+		}
+		if term.Arg != "" && !f.arg {
+			return nil, invalid(nil, f.name+"() takes no arguments")
+		}
+		sign := time.Duration(1)
+		if term.Negative {
+			sign = -1
+		}
+
+		t := now
+		switch term.Function {
+		case "DURATION":
+			duration, err := parseDuration(term.Arg)
+			if err != nil {
+				return nil, invalid(err, fmt.Sprintf("%q isn't a duration such as 1h30m or 7d", term.Arg))
+			}
+			sum += sign * duration
+			continue
+		case "DATETIME":
+			if term.Arg != "" {
+				var err error
+				if t, err = parseDateTime(term.Arg); err != nil {
+					return nil, invalid(err, fmt.Sprintf("%q isn't an RFC 3339 timestamp", term.Arg))
+				}
+			}
+		}
+		if !anchored {
+			anchor, anchored = t, true
+		}
+		points += int(sign)
+		sum += sign * t.Sub(anchor)
+	}
+
+	switch points {
+	case 0:
+		return sum, nil
+	case 1:
+		return anchor.Add(sum), nil
+	}
+	return nil, newDiagnosticError(CodeInvalidTemporal, nil, "expression", e.String(), "reason", "it must add up to a point in time or a duration")
+}
+
+// String renders the expression as written in a query
+func (e *TemporalExpression) String() string {
+	var b strings.Builder
+	for i, term := range e.Terms {
+		switch {
+		case term.Negative:
+			b.WriteString(" - ")
+		case i > 0:
+			b.WriteString(" + ")
+		}
+		name := strings.ToLower(term.Function)
+		if f, ok := temporalFunctions[term.Function]; ok {
+			name = f.name
+		}
+		b.WriteString(name + "(")
+		if term.Arg != "" {
+			b.WriteString(strconv.Quote(term.Arg))
+		}
+		b.WriteString(")")
+	}
+	return b.String()
+}
+
+// matchesTemporal compares a value with a temporal expression: timestamps with points in time, and
+// durations such as 30s with durations
+func matchesTemporal(result interface{}, filter *KeyValuePair, expression *TemporalExpression) bool {
+	value, err := expression.evaluate(time.Now())
+	if err != nil {
+		logDebug("Invalid temporal value", "error", err)
+		return false
+	}
+
+	var compare int
+	switch value := value.(type) {
+	case time.Time:
+		var t time.Time
+		switch r := result.(type) {
+		case time.Time:
+			t = r
+		case string:
+			if t, err = parseDateTime(r); err != nil {
+				return false
+			}
+		default:
+			return false
+		}
+		compare = t.Compare(value)
+	case time.Duration:
+		s, ok := result.(string)
+		if !ok {
+			return false
+		}
+		d, err := parseDuration(s)
+		if err != nil {
+			return false
+		}
+		switch {
+		case d < value:
+			compare = -1
+		case d > value:
+			compare = 1
+		}
+	}
+
+	switch filter.Operator {
+	case "EQUALS":
+		return compare == 0
+	case "NOT_EQUALS":
+		return compare != 0
+	case "GREATER_THAN":
+		return compare > 0
+	case "LESS_THAN":
+		return compare < 0
+	case "GREATER_THAN_EQUALS":
+		return compare >= 0
+	case "LESS_THAN_EQUALS":
+		return compare <= 0
+	}
+	return false
+}
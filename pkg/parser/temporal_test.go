@@ -0,0 +1,112 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestParseTemporal(t *testing.T) {
+	expr, err := ParseQuery(`MATCH (p:Pod) WHERE p.metadata.creationTimestamp < now() - duration("24h"), p.spec.activeDeadline >= DURATION("1h") RETURN p`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	expected := []*KeyValuePair{
+		{Key: "p.metadata.creationTimestamp", Operator: "LESS_THAN", Value: &TemporalExpression{Terms: []*TemporalTerm{
+			{Function: "NOW"},
+			{Function: "DURATION", Arg: "24h", Negative: true},
+		}}},
+		{Key: "p.spec.activeDeadline", Operator: "GREATER_THAN_EQUALS", Value: &TemporalExpression{Terms: []*TemporalTerm{
+			{Function: "DURATION", Arg: "1h"},
+		}}},
+	}
+	if filters := expr.Clauses[0].(*MatchClause).ExtraFilters; !reflect.DeepEqual(filters, expected) {
+		t.Errorf("unexpected filters %+v", filters)
+	}
+	if got := expected[0].Value.(*TemporalExpression).String(); got != `now() - duration("24h")` {
+		t.Errorf("String() = %s", got)
+	}
+}
+
+func TestTemporalEvaluate(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		terms    []*TemporalTerm
+		expected interface{}
+	}{
+		{[]*TemporalTerm{{Function: "NOW"}}, now},
+		{[]*TemporalTerm{{Function: "DATETIME"}}, now},
+		{[]*TemporalTerm{{Function: "NOW"}, {Function: "DURATION", Arg: "1d12h", Negative: true}}, now.Add(-36 * time.Hour)},
+		{[]*TemporalTerm{{Function: "DATETIME", Arg: "2024-05-01T00:00:00Z"}, {Function: "DURATION", Arg: "30m"}}, time.Date(2024, 5, 1, 0, 30, 0, 0, time.UTC)},
+		{[]*TemporalTerm{{Function: "DATETIME", Arg: "2024-05-01"}}, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+		{[]*TemporalTerm{{Function: "DURATION", Arg: "7d"}}, 7 * 24 * time.Hour},
+		{[]*TemporalTerm{{Function: "NOW"}, {Function: "DATETIME", Arg: "2024-06-01T11:00:00Z", Negative: true}}, time.Hour},
+	}
+	for _, tt := range tests {
+		expression := &TemporalExpression{Terms: tt.terms}
+		got, err := expression.evaluate(now)
+		if err != nil {
+			t.Errorf("%s: evaluate() error = %v", expression, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("%s = %v, expected %v", expression, got, tt.expected)
+		}
+	}
+
+	for _, terms := range [][]*TemporalTerm{
+		{{Function: "DURATION", Arg: "a day"}},
+		{{Function: "DATETIME", Arg: "yesterday"}},
+		{{Function: "NOW", Arg: "UTC"}},
+		{{Function: "NOW"}, {Function: "NOW"}},
+	} {
+		expression := &TemporalExpression{Terms: terms}
+		if _, err := expression.evaluate(now); DiagnosticCodeOf(err) != CodeInvalidTemporal {
+			t.Errorf("expected %s for %s, got %v", CodeInvalidTemporal, expression, err)
+		}
+	}
+}
+
+func TestWhereTemporal(t *testing.T) {
+	pod := func(name string, age time.Duration, deadline string) *unstructured.Unstructured {
+		return newTestObject("v1", "Pod", "default", name, map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"name":              name,
+				"namespace":         "default",
+				"creationTimestamp": time.Now().Add(-age).UTC().Format(time.RFC3339),
+			},
+			"spec": map[string]interface{}{"timeout": deadline},
+		})
+	}
+	q := newTestQueryExecutor(t, pod("old", 48*time.Hour, "90s"), pod("new", time.Hour, "5m"))
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{`MATCH (p:Pod) WHERE p.metadata.creationTimestamp < now() - duration("24h") RETURN p.metadata.name`, []string{"old"}},
+		{`MATCH (p:Pod) WHERE p.metadata.creationTimestamp >= now() - duration("1d") RETURN p.metadata.name`, []string{"new"}},
+		{`MATCH (p:Pod) WHERE p.metadata.creationTimestamp > datetime("2000-01-01T00:00:00Z") RETURN p.metadata.name`, []string{"new", "old"}},
+		{`MATCH (p:Pod) WHERE p.spec.timeout > duration("2m") RETURN p.metadata.name`, []string{"new"}},
+	}
+	for _, tt := range tests {
+		result := executeTestQuery(t, q, tt.query)
+		names := []string{}
+		for _, row := range result.Data["p"].([]interface{}) {
+			names = append(names, row.(map[string]interface{})["name"].(string))
+		}
+		if !reflect.DeepEqual(names, tt.expected) {
+			t.Errorf("%s returned %v, expected %v", tt.query, names, tt.expected)
+		}
+	}
+
+	ast, err := ParseQuery(`MATCH (p:Pod) WHERE p.metadata.creationTimestamp < now() - duration("a day") RETURN p`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	if _, err := q.Execute(ast, "default"); DiagnosticCodeOf(err) != CodeInvalidTemporal {
+		t.Errorf("expected %s, got %v", CodeInvalidTemporal, err)
+	}
+}
@@ -0,0 +1,154 @@
+package parser
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// The API calls of queries are rate limited on the client, as client-go does, so that a query fanning out to many
+// kinds doesn't starve the other clients of the API server: QPS calls a second on average, in bursts of up to
+// Burst. The executors of an API server share their limiter, those of the users of the web interface included.
+//
+// API priority and fairness makes the API server reject the calls of a client beyond its share with 429 Too Many
+// Requests. client-go retries them after the Retry-After the server asks for, but a client going on at the same
+// rate keeps being rejected, and its queries time out. With AdaptiveThrottling, each rejection halves the rate of
+// the limiter, down to minThrottledQPS, and the rate doubles back towards QPS every throttleRecovery without one.
+
+// QPS is how many API calls a second queries make on average, 0 for no limit
+var QPS float32 = 5
+
+// Burst is how many API calls queries may make at once above QPS
+var Burst = 10
+
+// AdaptiveThrottling slows the API calls down while the API server rejects them for exceeding its share
+var AdaptiveThrottling = true
+
+// minThrottledQPS is the lowest rate AdaptiveThrottling slows down to
+const minThrottledQPS = 1
+
+// throttleRecovery is how long the rate stays lowered after a rejection before doubling back
+var throttleRecovery = 10 * time.Second
+
+// throttleTime is the clock of the limiters, replaced by tests
+var throttleTime = func() time.Time { return time.Now() }
+
+// apiLimiters are the limiters of the API servers queries were run against, by host
+var apiLimiters = make(map[string]*adaptiveLimiter)
+var apiLimitersMutex sync.Mutex
+
+// applyRateLimits makes the clients of config rate limited by the shared limiter of its API server, or not at all
+// if QPS is 0
+func applyRateLimits(config *rest.Config) {
+	if QPS <= 0 {
+		// A negative QPS disables client-go's rate limiter
+		config.QPS = -1
+		return
+	}
+	config.RateLimiter = apiLimiter(config.Host)
+	if AdaptiveThrottling {
+		limiter := config.RateLimiter.(*adaptiveLimiter)
+		config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+			return &throttlingRoundTripper{next: rt, limiter: limiter}
+		})
+	}
+}
+
+// apiLimiter is the limiter of the API server at host
+func apiLimiter(host string) *adaptiveLimiter {
+	apiLimitersMutex.Lock()
+	defer apiLimitersMutex.Unlock()
+	limiter, ok := apiLimiters[host]
+	if !ok || limiter.qps != float64(QPS) || limiter.limiter.Burst() != max(Burst, 1) {
+		limiter = newAdaptiveLimiter(float64(QPS), max(Burst, 1))
+		apiLimiters[host] = limiter
+	}
+	return limiter
+}
+
+// adaptiveLimiter is a token bucket whose rate is lowered while the API server rejects calls
+type adaptiveLimiter struct {
+	limiter *rate.Limiter
+	// qps is the rate the limiter runs at unless it's throttled
+	qps     float64
+	mutex   sync.Mutex
+	changed time.Time
+}
+
+var _ flowcontrol.RateLimiter = &adaptiveLimiter{}
+
+func newAdaptiveLimiter(qps float64, burst int) *adaptiveLimiter {
+	return &adaptiveLimiter{limiter: rate.NewLimiter(rate.Limit(qps), burst), qps: qps}
+}
+
+func (l *adaptiveLimiter) TryAccept() bool {
+	l.restore()
+	return l.limiter.Allow()
+}
+
+func (l *adaptiveLimiter) Accept() {
+	l.Wait(context.Background())
+}
+
+func (l *adaptiveLimiter) Wait(ctx context.Context) error {
+	l.restore()
+	return l.limiter.Wait(ctx)
+}
+
+func (l *adaptiveLimiter) Stop() {}
+
+func (l *adaptiveLimiter) QPS() float32 {
+	return float32(l.limiter.Limit())
+}
+
+// throttle halves the rate after the API server rejected a call
+func (l *adaptiveLimiter) throttle(priorityLevel string, retryAfter time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := throttleTime()
+	current := float64(l.limiter.Limit())
+	lowered := max(current/2, min(minThrottledQPS, l.qps))
+	l.changed = now
+	if lowered == current {
+		return
+	}
+	l.limiter.SetLimit(rate.Limit(lowered))
+	logWarn("The API server is rejecting calls, slowing down", "qps", lowered, "priorityLevel", priorityLevel, "retryAfter", retryAfter)
+}
+
+// restore doubles the rate back towards qps once it went throttleRecovery without a rejection
+func (l *adaptiveLimiter) restore() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := throttleTime()
+	current := float64(l.limiter.Limit())
+	if current >= l.qps || now.Sub(l.changed) < throttleRecovery {
+		return
+	}
+	raised := min(current*2, l.qps)
+	l.changed = now
+	l.limiter.SetLimit(rate.Limit(raised))
+	logDebug("Speeding back up", "qps", raised)
+}
+
+// throttlingRoundTripper throttles the limiter of the API server when it rejects a call with 429 Too Many Requests
+type throttlingRoundTripper struct {
+	next    http.RoundTripper
+	limiter *adaptiveLimiter
+}
+
+func (rt *throttlingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := rt.next.RoundTrip(req)
+	if err == nil && resp.StatusCode == http.StatusTooManyRequests {
+		seconds, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		// API priority and fairness names the priority level the call was rejected in
+		rt.limiter.throttle(resp.Header.Get("X-Kubernetes-PF-PriorityLevel-UID"), time.Duration(seconds)*time.Second)
+	}
+	return resp, err
+}
@@ -0,0 +1,73 @@
+package parser
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/rest"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestAdaptiveThrottling(t *testing.T) {
+	now := time.Date(2026, 10, 16, 9, 30, 0, 0, time.UTC)
+	originalTime := throttleTime
+	defer func() { throttleTime = originalTime }()
+	throttleTime = func() time.Time { return now }
+
+	limiter := newAdaptiveLimiter(8, 10)
+	rejected := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{"Retry-After": []string{"1"}}}
+	rt := &throttlingRoundTripper{limiter: limiter, next: roundTripperFunc(func(*http.Request) (*http.Response, error) {
+		return rejected, nil
+	})}
+	// Each rejection halves the rate, down to the lowest
+	for _, expected := range []float32{4, 2, 1, 1} {
+		if _, err := rt.RoundTrip(&http.Request{}); err != nil {
+			t.Fatal(err)
+		}
+		if qps := limiter.QPS(); qps != expected {
+			t.Errorf("expected %v QPS after a rejection, got %v", expected, qps)
+		}
+	}
+
+	// The rate doubles back once a while passes without one, up to the configured rate
+	limiter.TryAccept()
+	if qps := limiter.QPS(); qps != 1 {
+		t.Errorf("expected the rate to stay lowered right after a rejection, got %v", qps)
+	}
+	for _, expected := range []float32{2, 4, 8, 8} {
+		now = now.Add(throttleRecovery)
+		limiter.TryAccept()
+		if qps := limiter.QPS(); qps != expected {
+			t.Errorf("expected %v QPS, got %v", expected, qps)
+		}
+	}
+}
+
+func TestApplyRateLimits(t *testing.T) {
+	originalQPS := QPS
+	defer func() { QPS = originalQPS }()
+
+	first, second, other := &rest.Config{Host: "https://a:6443"}, &rest.Config{Host: "https://a:6443"}, &rest.Config{Host: "https://b:6443"}
+	for _, config := range []*rest.Config{first, second, other} {
+		applyRateLimits(config)
+	}
+	if first.RateLimiter == nil || first.RateLimiter != second.RateLimiter || first.RateLimiter == other.RateLimiter {
+		t.Errorf("expected the clients of an API server to share its limiter")
+	}
+	if first.WrapTransport == nil {
+		t.Errorf("expected the rejections of the API server to throttle the limiter")
+	}
+
+	QPS = 0
+	unlimited := &rest.Config{Host: "https://a:6443"}
+	applyRateLimits(unlimited)
+	if unlimited.RateLimiter != nil || unlimited.QPS >= 0 {
+		t.Errorf("expected the calls not to be rate limited, got %+v", unlimited)
+	}
+}
@@ -0,0 +1,128 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// A list call to an API that doesn't answer, e.g. that of a broken metrics-server, would hang the query until it's
+// interrupted. List timeouts give each list call a deadline, by default ListTimeout, which ListTimeouts overrides
+// for API groups and resources:
+//
+//	30s                          every list call
+//	metrics.k8s.io=5s            the resources of the metrics.k8s.io group
+//	pods.metrics.k8s.io=10s      the pods of the metrics.k8s.io group
+//
+// A list call past its deadline fails the query with CYP-0111, naming the resource and the clause that listed it.
+
+// ListTimeout is the deadline of list calls whose resource has none in ListTimeouts, 0 for none
+var ListTimeout time.Duration
+
+// ListTimeouts are the deadlines of the list calls of API groups and resources, by group (e.g. metrics.k8s.io) or
+// resource and group (e.g. pods.metrics.k8s.io, or pods for the core group)
+var ListTimeouts map[string]time.Duration
+
+// listTimeoutsMutex guards ListTimeout and ListTimeouts, which the web server's configuration changes as it runs
+var listTimeoutsMutex sync.RWMutex
+
+// SetListTimeouts sets ListTimeout and ListTimeouts
+func SetListTimeouts(timeout time.Duration, timeouts map[string]time.Duration) {
+	listTimeoutsMutex.Lock()
+	defer listTimeoutsMutex.Unlock()
+	ListTimeout, ListTimeouts = timeout, timeouts
+}
+
+// ParseListTimeouts reads the values of --list-timeout, each either the default deadline (e.g. 30s) or that of
+// a group or resource (e.g. metrics.k8s.io=5s)
+func ParseListTimeouts(values []string) (time.Duration, map[string]time.Duration, error) {
+	var timeout time.Duration
+	timeouts := make(map[string]time.Duration)
+	for _, value := range values {
+		resource, duration, found := strings.Cut(value, "=")
+		if !found {
+			resource, duration = "", value
+		}
+		parsed, err := time.ParseDuration(duration)
+		if err != nil || parsed < 0 {
+			return 0, nil, fmt.Errorf("invalid list timeout %q, expected a duration such as 30s or a resource's such as metrics.k8s.io=5s", value)
+		}
+		if resource == "" {
+			timeout = parsed
+			continue
+		}
+		timeouts[resource] = parsed
+	}
+	return timeout, timeouts, nil
+}
+
+// listTimeout is the deadline of the list calls of gvr, 0 for none
+func listTimeout(gvr schema.GroupVersionResource) time.Duration {
+	listTimeoutsMutex.RLock()
+	defer listTimeoutsMutex.RUnlock()
+	resource := gvr.Resource
+	if gvr.Group != "" {
+		resource += "." + gvr.Group
+	}
+	if timeout, ok := ListTimeouts[resource]; ok {
+		return timeout
+	}
+	if timeout, ok := ListTimeouts[gvr.Group]; ok && gvr.Group != "" {
+		return timeout
+	}
+	return ListTimeout
+}
+
+// listContext is the context of a list call of gvr made within ctx, with the deadline of its resource if it has one
+func listContext(ctx context.Context, gvr schema.GroupVersionResource) (context.Context, context.CancelFunc) {
+	timeout := listTimeout(gvr)
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeoutCause(ctx, timeout, &listTimeoutError{gvr: gvr, timeout: timeout})
+}
+
+// listTimeoutError is the cause of the context of a list call that passed its deadline
+type listTimeoutError struct {
+	gvr     schema.GroupVersionResource
+	timeout time.Duration
+}
+
+func (e *listTimeoutError) Error() string {
+	return fmt.Sprintf("listing %s timed out after %s", e.gvr.GroupResource(), e.timeout)
+}
+
+// listError is the error of a list call of gvr made with listCtx: the API server's, or CYP-0111 if the call passed
+// its deadline
+func (q *QueryExecutor) listError(listCtx context.Context, gvr schema.GroupVersionResource, err error) error {
+	if timeoutErr, ok := listTimedOut(listCtx); ok {
+		return newDiagnosticError(CodeListTimedOut, err, "resource", gvr.GroupResource().String(), "timeout", timeoutErr.timeout.String(), "clause", runningClause(q.clause))
+	}
+	return apiError("list", gvr, err)
+}
+
+// listTimedOut tells whether a list call made with listCtx passed its deadline
+func listTimedOut(listCtx context.Context) (*listTimeoutError, bool) {
+	var timeoutErr *listTimeoutError
+	ok := errors.As(context.Cause(listCtx), &timeoutErr)
+	return timeoutErr, ok
+}
+
+// timedOutError is the error of a query that passed the deadline of its context in the given clause, after
+// applying the given changes
+func timedOutError(err error, clause Clause, applied []string) error {
+	return newDiagnosticError(CodeTimedOut, err, "clause", runningClause(clause), "changes", appliedChanges(applied), "applied", append([]string{}, applied...))
+}
+
+// runningClause names the clause a query was running, e.g. "the MATCH clause"
+func runningClause(clause Clause) string {
+	if clause == nil {
+		return "the query"
+	}
+	return "the " + strings.ToUpper(clauseName(clause)) + " clause"
+}
@@ -0,0 +1,86 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestParseListTimeouts(t *testing.T) {
+	timeout, timeouts, err := ParseListTimeouts([]string{"30s", "metrics.k8s.io=5s", "pods.metrics.k8s.io=10s", "pods=1m"})
+	if err != nil {
+		t.Fatalf("ParseListTimeouts() error = %v", err)
+	}
+	SetListTimeouts(timeout, timeouts)
+	defer SetListTimeouts(0, nil)
+
+	tests := []struct {
+		gvr     schema.GroupVersionResource
+		timeout time.Duration
+	}{
+		{schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}, 30 * time.Second},
+		{schema.GroupVersionResource{Group: "metrics.k8s.io", Version: "v1beta1", Resource: "nodes"}, 5 * time.Second},
+		{schema.GroupVersionResource{Group: "metrics.k8s.io", Version: "v1beta1", Resource: "pods"}, 10 * time.Second},
+		{schema.GroupVersionResource{Version: "v1", Resource: "pods"}, time.Minute},
+	}
+	for _, tt := range tests {
+		if timeout := listTimeout(tt.gvr); timeout != tt.timeout {
+			t.Errorf("%s: expected %s, got %s", tt.gvr, tt.timeout, timeout)
+		}
+	}
+
+	for _, value := range []string{"soon", "metrics.k8s.io=-5s"} {
+		if _, _, err := ParseListTimeouts([]string{value}); err == nil {
+			t.Errorf("%s: expected an error", value)
+		}
+	}
+}
+
+func TestListTimeout(t *testing.T) {
+	SetListTimeouts(0, map[string]time.Duration{"pods": time.Millisecond})
+	defer SetListTimeouts(0, nil)
+
+	q := newTestQueryExecutor(t, newTestObject("v1", "Pod", "default", "web-1", nil))
+	// The API server doesn't answer until the client gives up
+	q.DynamicClient.(*dynamicfake.FakeDynamicClient).PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		time.Sleep(20 * time.Millisecond)
+		return true, nil, context.DeadlineExceeded
+	})
+
+	ast, err := ParseQuery(`MATCH (p:Pod) RETURN p.metadata.name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = q.Execute(ast, "default")
+	var diagnostic *DiagnosticError
+	if !errors.As(err, &diagnostic) || diagnostic.Code != CodeListTimedOut {
+		t.Fatalf("expected the list call to time out, got %v", err)
+	}
+	if message := "listing pods timed out after 1ms in the MATCH clause"; !strings.HasSuffix(err.Error(), message) {
+		t.Errorf("expected %q, got %q", message, err.Error())
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	q := newTestQueryExecutor(t, newTestObject("v1", "Pod", "default", "web-1", nil))
+	ast, err := ParseQuery(`MATCH (p:Pod) DELETE p`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	result, err := q.ExecuteContext(ctx, ast, "default")
+	if DiagnosticCodeOf(err) != CodeTimedOut || !errors.Is(err, ErrInterrupted) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the query to time out, got %v", err)
+	}
+	if message := "query timed out in the MATCH clause, no changes were applied"; err.Error() != message || !result.Truncated {
+		t.Errorf("expected %q with truncated results, got %q", message, err.Error())
+	}
+}
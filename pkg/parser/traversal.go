@@ -0,0 +1,331 @@
+package parser
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// A variable-length relationship, e.g. (d:Deployment)-[*1..3]->(p:Pod), joins two nodes through chains of
+// relationships between kinds: deployments to pods through replicasets, or ingresses to pods through services.
+// Every chain of known relationships between the two kinds spanning the given number of hops is followed in the
+// direction of the query's arrow, and the resources of the intermediate kinds are listed once and kept in the result
+// cache. A relationship without an arrow follows the chains going either way, each going one way throughout.
+
+// maxRelationshipHops is the most relationships a variable-length relationship spans, and what -[*]-> spans
+const maxRelationshipHops = 5
+
+// JoinStrategyTraversal is reported for variable-length relationships, which follow chains of relationships
+const JoinStrategyTraversal = "variable-length traversal"
+
+func (q *QueryExecutor) processVariableLengthRelationship(rel *Relationship, c *MatchClause, results *QueryResult, filteredResults map[string][]map[string]interface{}) (bool, error) {
+	paths, err := q.relationshipPaths(rel)
+	if err != nil {
+		return false, err
+	}
+
+	// Fetch the resources of both nodes, like processRelationship does
+	for _, node := range c.Nodes {
+		if node.ResourceProperties.Name == rel.LeftNode.ResourceProperties.Name || node.ResourceProperties.Name == rel.RightNode.ResourceProperties.Name {
+			if results.Data[node.ResourceProperties.Name] == nil {
+				if err := getNodeResources(node, q, c.ExtraFilters); err != nil {
+					return false, err
+				}
+			}
+		}
+	}
+
+	leftName, rightName := rel.LeftNode.ResourceProperties.Name, rel.RightNode.ResourceProperties.Name
+	left := q.getResourcesFromMap(filteredResults, leftName)
+	right := q.getResourcesFromMap(filteredResults, rightName)
+	matchedLeft := []map[string]interface{}{}
+	matchedRight := []map[string]interface{}{}
+	// A pair of resources several chains join has a single edge, of the shortest chain
+	edges := map[Edge]bool{}
+	joined := map[[2]string]bool{}
+
+	for _, path := range paths {
+		reached, err := q.traverse(left, right, path.kinds, path.rules)
+		if err != nil {
+			return false, err
+		}
+		for i, resources := range reached {
+			if len(resources) == 0 {
+				continue
+			}
+			if !containsResource(matchedLeft, left[i]) {
+				matchedLeft = append(matchedLeft, left[i])
+			}
+			for _, resource := range resources {
+				if !containsResource(matchedRight, resource) {
+					matchedRight = append(matchedRight, resource)
+				}
+				pair := [2]string{graphNodeId(resource), graphNodeId(left[i])}
+				if !joined[pair] {
+					joined[pair] = true
+					edges[Edge{From: pair[0], To: pair[1], Type: path.relationship()}] = true
+				}
+			}
+		}
+	}
+
+	filteredResults[leftName] = matchedLeft
+	filteredResults[rightName] = matchedRight
+	// As in processRelationship, the smaller of the lists is kept so resources filtered out earlier stay out
+	for _, name := range []string{leftName, rightName} {
+		matched := filteredResults[name]
+		if current, ok := q.resultMap[name].([]map[string]interface{}); !ok || len(current) > len(matched) {
+			q.resultMap[name] = matched
+		}
+		for _, resource := range matched {
+			results.Graph.Nodes = append(results.Graph.Nodes, graphNode(name, resource))
+		}
+	}
+	newEdges := []Edge{}
+	for edge := range edges {
+		newEdges = append(newEdges, edge)
+	}
+	slices.SortFunc(newEdges, func(a, b Edge) int {
+		return strings.Compare(a.From+a.To+a.Type, b.From+b.To+b.Type)
+	})
+	results.Graph.Edges = append(results.Graph.Edges, newEdges...)
+
+	return len(matchedLeft) < len(left) || len(matchedRight) < len(right), nil
+}
+
+// relationshipPath is a chain of relationship rules, going from kinds[i] to kinds[i+1] through rules[i]
+type relationshipPath struct {
+	kinds []string
+	rules []RelationshipRule
+}
+
+// relationship is the type reported for a path's edges, the types of its rules joined by slashes
+func (p relationshipPath) relationship() string {
+	types := make([]string, len(p.rules))
+	for i, rule := range p.rules {
+		types[i] = string(rule.Relationship)
+	}
+	return strings.Join(types, "/")
+}
+
+// relationshipPaths validates a variable-length relationship and lists the chains of relationship rules joining
+// the kinds of its nodes, shortest first. A chain follows its rules the way the relationship's arrow points, goes
+// through a kind at most once, only through kinds the cluster serves, and never through namespaces, which hold
+// every namespaced resource.
+func (q *QueryExecutor) relationshipPaths(rel *Relationship) ([]relationshipPath, error) {
+	leftKind, rightKind, err := q.relationshipKinds(rel)
+	if err != nil {
+		return nil, err
+	}
+	hops := rel.Hops
+	reason := ""
+	switch {
+	case hops.Min < 1:
+		reason = "a relationship spans at least 1 hop"
+	case hops.Max > maxRelationshipHops:
+		reason = fmt.Sprintf("a relationship spans at most %d hops", maxRelationshipHops)
+	case hops.Min > hops.Max:
+		reason = "the minimum is more than the maximum"
+	}
+	if reason != "" {
+		return nil, newDiagnosticError(CodeInvalidHops, nil, "hops", hops.String(), "left", rel.LeftNode.ResourceProperties.Name, "right", rel.RightNode.ResourceProperties.Name, "reason", reason)
+	}
+
+	paths := []relationshipPath{}
+	from, to := strings.ToLower(leftKind.Resource), strings.ToLower(rightKind.Resource)
+	visited := map[string]bool{from: true}
+	var walk func(path relationshipPath, forward bool)
+	walk = func(path relationshipPath, forward bool) {
+		if len(path.rules) == hops.Max {
+			return
+		}
+		kind := path.kinds[len(path.kinds)-1]
+		for _, rule := range activeRelationshipRules() {
+			next, ok := followedKind(rule, kind, forward)
+			if !ok || rule.analyzer != "" {
+				continue
+			}
+			extended := relationshipPath{kinds: append(slices.Clone(path.kinds), next), rules: append(slices.Clone(path.rules), rule)}
+			if next == to {
+				if len(extended.rules) >= hops.Min {
+					paths = append(paths, extended)
+				}
+				continue
+			}
+			if visited[next] {
+				continue
+			}
+			if _, err := FindGVR(q.Clientset, next); err != nil {
+				continue
+			}
+			visited[next] = true
+			walk(extended, forward)
+			visited[next] = false
+		}
+	}
+	// -> follows the rules from the left node to the right one, <- against them, and no arrow either way
+	if rel.Direction != Left {
+		walk(relationshipPath{kinds: []string{from}}, true)
+	}
+	if rel.Direction != Right {
+		walk(relationshipPath{kinds: []string{from}}, false)
+	}
+	slices.SortStableFunc(paths, func(a, b relationshipPath) int {
+		return len(a.rules) - len(b.rules)
+	})
+
+	if len(paths) == 0 {
+		return nil, newDiagnosticError(CodeRelationshipNotFound, nil, "left", leftKind, "right", rightKind)
+	}
+	return paths, nil
+}
+
+// relatedKind is the kind a rule relates kind to, if the rule involves kind. Rules relating a kind to every other
+// kind relate no kind in particular.
+func relatedKind(rule RelationshipRule, kind string) (string, bool) {
+	if next, ok := followedKind(rule, kind, true); ok {
+		return next, true
+	}
+	return followedKind(rule, kind, false)
+}
+
+// followedKind is the kind a rule points to from kind, or, not forward, from to kind
+func followedKind(rule RelationshipRule, kind string, forward bool) (string, bool) {
+	if rule.Relationship == NamespaceHasResource || rule.KindB == "*" {
+		return "", false
+	}
+	from, to := ruleEnds(rule)
+	if !forward {
+		from, to = to, from
+	}
+	if strings.EqualFold(from, kind) {
+		return strings.ToLower(to), true
+	}
+	return "", false
+}
+
+// relationshipsFromKindA are the built-in relationships pointing from their KindA to their KindB, e.g. the pods
+// using a ConfigMap. The others point from the kind owning, exposing or holding KindA, their KindB.
+var relationshipsFromKindA = map[RelationshipType]bool{
+	NetworkPolicyApplyPod:                  true,
+	HPAScaleDeployment:                     true,
+	Route:                                  true,
+	MutatingWebhookTargetService:           true,
+	ValidatingWebhookTargetService:         true,
+	PDBProtectPod:                          true,
+	PodUseConfigMap:                        true,
+	PodUseSecret:                           true,
+	DeploymentUseConfigMap:                 true,
+	DeploymentUseSecret:                    true,
+	HTTPRouteBackendService:                true,
+	HTTPRouteAttachGateway:                 true,
+	RoleBindingReferenceRole:               true,
+	RoleBindingReferenceClusterRole:        true,
+	ClusterRoleBindingReferenceClusterRole: true,
+	RoleBindingBindServiceAccount:          true,
+	ClusterRoleBindingBindServiceAccount:   true,
+	PodUseServiceAccount:                   true,
+	PodRunOnNode:                           true,
+	PodUsePVC:                              true,
+	DeploymentUsePVC:                       true,
+	PVCBindPV:                              true,
+	PVUseStorageClass:                      true,
+	PVCUseStorageClass:                     true,
+	CanReach:                               true,
+}
+
+// ruleEnds are the kinds a rule points from and to. Relationships found in the specs of resources point from the
+// resources referring to others, their KindA, and those of relationship packs from their KindB.
+func ruleEnds(rule RelationshipRule) (string, string) {
+	if relationshipsFromKindA[rule.Relationship] || strings.Contains(string(rule.Relationship), "_INSPEC_") {
+		return rule.KindA, rule.KindB
+	}
+	return rule.KindB, rule.KindA
+}
+
+// traverse follows a path from each of the left resources, returning for each the right resources it reaches.
+// The resources of the intermediate kinds are all listed.
+func (q *QueryExecutor) traverse(left, right []map[string]interface{}, kinds []string, rules []RelationshipRule) ([][]map[string]interface{}, error) {
+	reached := make([][]map[string]interface{}, len(left))
+	for i, resource := range left {
+		reached[i] = []map[string]interface{}{resource}
+	}
+	for hop, rule := range rules {
+		candidates := right
+		if hop < len(rules)-1 {
+			var err error
+			if candidates, err = q.hopResources(kinds[hop+1]); err != nil {
+				return nil, err
+			}
+		}
+		for i, frontier := range reached {
+			next := []map[string]interface{}{}
+			for _, candidate := range candidates {
+				for _, resource := range frontier {
+					if joins(rule, kinds[hop], resource, candidate) {
+						next = append(next, candidate)
+						break
+					}
+				}
+			}
+			reached[i] = next
+		}
+	}
+	return reached, nil
+}
+
+// joins reports whether a rule relates a resource of kind to another resource
+func joins(rule RelationshipRule, kind string, resource, other map[string]interface{}) bool {
+	if strings.EqualFold(rule.KindA, kind) {
+		return matchByRule(resource, other, rule)
+	}
+	return matchByRule(other, resource, rule)
+}
+
+// hopResources lists the resources of an intermediate kind of a variable-length relationship through the result
+// cache, in the namespace the query runs in
+func (q *QueryExecutor) hopResources(kind string) ([]map[string]interface{}, error) {
+	key := q.resourcePropertyName(&NodePattern{ResourceProperties: &ResourceProperties{Kind: kind}})
+	observeCacheLookup(q.resultCache[key] != nil)
+	if q.resultCache[key] == nil {
+		resources, source, err := q.cachedResources(kind, "", "")
+		if err != nil {
+			return nil, err
+		}
+		q.resultCache[key] = resources
+		q.resultCacheFetchedAt[key] = source.fetchedAt
+	}
+	resources, _ := q.resultCache[key].([]map[string]interface{})
+	return resources, nil
+}
+
+func graphNodeId(resource map[string]interface{}) string {
+	metadata, _ := resource["metadata"].(map[string]interface{})
+	return fmt.Sprintf("%v/%v", resource["kind"], metadata["name"])
+}
+
+func graphNode(nodeId string, resource map[string]interface{}) Node {
+	metadata, _ := resource["metadata"].(map[string]interface{})
+	node := Node{Id: nodeId, Kind: fmt.Sprint(resource["kind"]), Name: fmt.Sprint(metadata["name"])}
+	if node.Kind != "Namespace" {
+		node.Namespace = getNamespaceName(metadata)
+	}
+	return node
+}
+
+func (q *QueryExecutor) explainVariableLengthRelationship(rel *Relationship) (RelationshipPlan, error) {
+	paths, err := q.relationshipPaths(rel)
+	if err != nil {
+		return RelationshipPlan{}, err
+	}
+	relationshipPlan := RelationshipPlan{
+		Left:         rel.LeftNode.ResourceProperties.Name,
+		Right:        rel.RightNode.ResourceProperties.Name,
+		Relationship: rel.Hops.String(),
+		Strategy:     JoinStrategyTraversal,
+	}
+	for _, path := range paths {
+		relationshipPlan.Criteria = append(relationshipPlan.Criteria, fmt.Sprintf("%s (%s)", strings.Join(path.kinds, " -> "), path.relationship()))
+	}
+	return relationshipPlan, nil
+}
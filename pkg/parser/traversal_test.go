@@ -0,0 +1,165 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestParseVariableLengthRelationship(t *testing.T) {
+	for query, expected := range map[string]Hops{
+		`MATCH (d:Deployment)-[*1..3]->(p:Pod) RETURN p`: {Min: 1, Max: 3},
+		`MATCH (d:Deployment)-[*2]->(p:Pod) RETURN p`:    {Min: 2, Max: 2},
+		`MATCH (d:Deployment)<-[*..2]-(p:Pod) RETURN p`:  {Min: 1, Max: 2},
+		`MATCH (d:Deployment)-[*2..]-(p:Pod) RETURN p`:   {Min: 2, Max: maxRelationshipHops},
+		`MATCH (d:Deployment)-[*]->(p:Pod) RETURN p`:     {Min: 1, Max: maxRelationshipHops},
+	} {
+		expr, err := ParseQuery(query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) error = %v", query, err)
+			continue
+		}
+		rel := expr.Clauses[0].(*MatchClause).Relationships[0]
+		if rel.Hops == nil || *rel.Hops != expected || rel.ResourceProperties != nil {
+			t.Errorf("%s: expected hops %v, got %+v", query, expected, rel)
+		}
+	}
+
+	for _, query := range []string{
+		`MATCH (d:Deployment)-[*1.3]->(p:Pod) RETURN p`,
+		`MATCH (d:Deployment)-[*a]->(p:Pod) RETURN p`,
+		`MATCH (d:Deployment)-[r *2]->(p:Pod) RETURN p`,
+		`MATCH (d:Deployment)-[r:*1..3]->(p:Pod) RETURN p`,
+	} {
+		if _, err := ParseQuery(query); err == nil {
+			t.Errorf("expected %q to be rejected", query)
+		}
+	}
+}
+
+func TestVariableLengthRelationship(t *testing.T) {
+	owned := func(apiVersion, kind, name, owner string) runtime.Object {
+		object := newTestObject(apiVersion, kind, "default", name, nil)
+		if owner != "" {
+			object.SetOwnerReferences([]metav1.OwnerReference{{Name: owner}})
+		}
+		return object
+	}
+	q := newTestQueryExecutor(t,
+		owned("apps/v1", "Deployment", "web", ""),
+		owned("apps/v1", "Deployment", "api", ""),
+		owned("apps/v1", "ReplicaSet", "web-5d8f", "web"),
+		owned("v1", "Pod", "web-5d8f-abc", "web-5d8f"),
+		owned("v1", "Pod", "web-5d8f-def", "web-5d8f"),
+		owned("v1", "Pod", "debug", ""),
+	)
+
+	result := executeTestQuery(t, q, `MATCH (d:Deployment)-[*1..3]->(p:Pod) RETURN d.metadata.name, p.metadata.name`)
+	names := func(rows interface{}) []string {
+		list := []string{}
+		for _, row := range rows.([]interface{}) {
+			list = append(list, row.(map[string]interface{})["metadata"].(map[string]interface{})["name"].(string))
+		}
+		return list
+	}
+	if d := names(result.Data["d"]); !reflect.DeepEqual(d, []string{"web"}) {
+		t.Errorf("expected the deployment with pods, got %v", d)
+	}
+	if p := names(result.Data["p"]); !reflect.DeepEqual(p, []string{"web-5d8f-abc", "web-5d8f-def"}) {
+		t.Errorf("expected the pods of the deployment's replicaset, got %v", p)
+	}
+	edges := []Edge{}
+	for _, edge := range result.Graph.Edges {
+		if edge.To == "Deployment/web" {
+			edges = append(edges, edge)
+		}
+	}
+	if len(edges) != 2 || edges[0].From != "Pod/web-5d8f-abc" || edges[0].Type != string(DeploymentOwnReplicaset)+"/"+string(ReplicasetOwnPod) {
+		t.Errorf("expected an edge from each pod to the deployment, got %v", result.Graph.Edges)
+	}
+
+	// Deployments and pods aren't related directly
+	for query, code := range map[string]DiagnosticCode{
+		`MATCH (d:Deployment)-[*1]->(p:Pod) RETURN p`:    CodeRelationshipNotFound,
+		`MATCH (d:Deployment)-[*3..2]->(p:Pod) RETURN p`: CodeInvalidHops,
+		`MATCH (d:Deployment)-[*0..2]->(p:Pod) RETURN p`: CodeInvalidHops,
+		`MATCH (d:Deployment)-[*6]->(p:Pod) RETURN p`:    CodeInvalidHops,
+	} {
+		ast, err := ParseQuery(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := q.Execute(ast, "default"); DiagnosticCodeOf(err) != code {
+			t.Errorf("%s: expected %s, got %v", query, code, err)
+		}
+	}
+
+	ast, err := ParseQuery(`EXPLAIN MATCH (d:Deployment)-[*..2]->(p:Pod) RETURN p`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := q.explain(ast)
+	if err != nil {
+		t.Fatalf("explain() error = %v", err)
+	}
+	if rel := plan.Relationships[0]; rel.Strategy != JoinStrategyTraversal || rel.Relationship != "*1..2" || len(rel.Criteria) != 1 || rel.Criteria[0] != "deployments -> replicasets -> pods (DEPLOYMENT_OWN_REPLICASET/REPLICASET_OWN_POD)" {
+		t.Errorf("unexpected plan %+v", rel)
+	}
+}
+
+func TestVariableLengthRelationshipDirection(t *testing.T) {
+	labels := map[string]interface{}{"tier": "frontend"}
+	deployment := func(name string) runtime.Object {
+		return newTestObject("apps/v1", "Deployment", "default", name, map[string]interface{}{
+			"spec": map[string]interface{}{"selector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": name, "tier": "frontend"}}},
+		})
+	}
+	replicaSet := func(name, owner string) runtime.Object {
+		object := newTestObject("apps/v1", "ReplicaSet", "default", name, nil)
+		object.SetOwnerReferences([]metav1.OwnerReference{{Name: owner}})
+		return object
+	}
+	pod := func(name, app, owner string) runtime.Object {
+		object := newTestObject("v1", "Pod", "default", name, nil)
+		object.SetLabels(map[string]string{"app": app, "tier": "frontend"})
+		object.SetOwnerReferences([]metav1.OwnerReference{{Name: owner}})
+		return object
+	}
+	// Two apps behind one Service, which exposes both deployments and all of their pods
+	q := newTestQueryExecutor(t,
+		deployment("web"),
+		deployment("api"),
+		replicaSet("web-1", "web"),
+		replicaSet("api-1", "api"),
+		pod("web-1-a", "web", "web-1"),
+		pod("api-1-a", "api", "api-1"),
+		newTestObject("v1", "Service", "default", "frontend", map[string]interface{}{"spec": map[string]interface{}{"selector": labels}}),
+	)
+	q.Rows = true
+
+	// The deployment's pods are found through its replica sets, not through the Service it shares with the other app
+	result := executeTestQuery(t, q, `MATCH (d:Deployment {name: "web"})-[*1..3]->(p:Pod) RETURN p.metadata.name AS pod`)
+	if expected := []map[string]interface{}{{"pod": "web-1-a"}}; !reflect.DeepEqual(result.Rows, expected) {
+		t.Errorf("expected the pods of web, got %v", result.Rows)
+	}
+	result = executeTestQuery(t, q, `MATCH (p:Pod)<-[*1..3]-(d:Deployment {name: "web"}) RETURN p.metadata.name AS pod`)
+	if expected := []map[string]interface{}{{"pod": "web-1-a"}}; !reflect.DeepEqual(result.Rows, expected) {
+		t.Errorf("expected the pods of web against the arrow, got %v", result.Rows)
+	}
+
+	// The Service reaches each pod directly and through its deployment, which joins them once
+	result = executeTestQuery(t, q, `MATCH (s:Service)-[*1..3]->(p:Pod) RETURN s.metadata.name AS service, p.metadata.name AS pod`)
+	expected := []map[string]interface{}{{"service": "frontend", "pod": "api-1-a"}, {"service": "frontend", "pod": "web-1-a"}}
+	if !reflect.DeepEqual(result.Rows, expected) {
+		t.Errorf("expected each pod of the service once, got %v", result.Rows)
+	}
+	edges := map[string]int{}
+	for _, edge := range result.Graph.Edges {
+		edges[edge.From+" "+edge.To]++
+	}
+	if len(edges) != 2 || edges["Pod/web-1-a Service/frontend"] != 1 || edges["Pod/api-1-a Service/frontend"] != 1 {
+		t.Errorf("expected an edge from each pod to the service, got %v", result.Graph.Edges)
+	}
+}
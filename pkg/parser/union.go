@@ -0,0 +1,116 @@
+package parser
+
+import (
+	"context"
+	"maps"
+	"slices"
+)
+
+// executeUnion runs the queries combined by UNION one after the other and merges their results: the rows of each
+// node identifier are appended to those of the queries before, and the aggregates of every query are returned
+// together. UNION, unlike UNION ALL, returns distinct rows.
+func (q *QueryExecutor) executeUnion(ctx context.Context, ast *Expression, namespace string) (QueryResult, error) {
+	union := QueryResult{
+		Data: make(map[string]interface{}),
+		Graph: Graph{
+			Nodes: []Node{},
+			Edges: []Edge{},
+		},
+	}
+	queries := append([]*Expression{{Clauses: ast.Clauses}}, ast.Union.Queries...)
+	for _, query := range queries {
+		if !ast.Union.All {
+			query = distinctQuery(query)
+		}
+		result, err := q.ExecuteContext(ctx, query, namespace)
+		if mergeErr := mergeUnionResult(&union, result); mergeErr != nil && err == nil {
+			err = mergeErr
+		}
+		if err != nil {
+			return union, err
+		}
+	}
+	if !ast.Union.All {
+		for key, value := range union.Data {
+			if rows, ok := value.([]interface{}); ok {
+				union.Data[key] = distinctRows(rows)
+			}
+		}
+		if union.Rows != nil {
+			union.Rows = distinctRecords(union.Rows)
+		}
+	}
+	return union, nil
+}
+
+// distinctQuery is a copy of a query whose RETURN clause is DISTINCT
+func distinctQuery(query *Expression) *Expression {
+	distinct := *query
+	distinct.Clauses = slices.Clone(query.Clauses)
+	last := len(distinct.Clauses) - 1
+	if c, ok := distinct.Clauses[last].(*ReturnClause); ok && !c.Distinct {
+		returnClause := *c
+		returnClause.Distinct = true
+		distinct.Clauses[last] = &returnClause
+	}
+	return &distinct
+}
+
+// mergeUnionResult adds the result of one of the queries of a UNION to the union's
+func mergeUnionResult(union *QueryResult, result QueryResult) error {
+	union.Truncated = union.Truncated || result.Truncated
+	union.Hidden += result.Hidden
+	union.Rows = append(union.Rows, result.Rows...)
+	for key, value := range result.Data {
+		if key != "aggregate" {
+			rows, _ := union.Data[key].([]interface{})
+			if added, ok := value.([]interface{}); ok {
+				union.Data[key] = append(rows, added...)
+			} else {
+				union.Data[key] = value
+			}
+			continue
+		}
+		if union.Data["aggregate"] == nil {
+			union.Data["aggregate"] = make(map[string]interface{})
+		}
+		aggregates := union.Data["aggregate"].(map[string]interface{})
+		for name, aggregate := range value.(map[string]interface{}) {
+			if name == "_provenance" {
+				provenance, _ := aggregates[name].(map[string]interface{})
+				if provenance == nil {
+					provenance = make(map[string]interface{})
+				}
+				maps.Copy(provenance, aggregate.(map[string]interface{}))
+				aggregates[name] = provenance
+				continue
+			}
+			if _, ok := aggregates[name]; ok {
+				return newDiagnosticError(CodeUnionAggregate, nil, "aggregate", name)
+			}
+			aggregates[name] = aggregate
+		}
+	}
+
+	nodes := make(map[Node]bool, len(union.Graph.Nodes))
+	for _, node := range union.Graph.Nodes {
+		nodes[node] = true
+	}
+	for _, node := range result.Graph.Nodes {
+		if !nodes[node] {
+			nodes[node] = true
+			union.Graph.Nodes = append(union.Graph.Nodes, node)
+		}
+	}
+	edges := make(map[Edge]bool, len(union.Graph.Edges))
+	for _, edge := range union.Graph.Edges {
+		edges[edge] = true
+	}
+	for _, edge := range result.Graph.Edges {
+		if !edges[edge] {
+			edges[edge] = true
+			union.Graph.Edges = append(union.Graph.Edges, edge)
+		}
+	}
+	return nil
+}
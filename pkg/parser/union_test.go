@@ -0,0 +1,90 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestParseUnion(t *testing.T) {
+	expr, err := ParseQuery(`MATCH (d:Deployment) RETURN d.metadata.name UNION ALL MATCH (p:Pod) RETURN p.metadata.name UNION ALL MATCH (s:Service) RETURN s`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	if expr.Union == nil || !expr.Union.All || len(expr.Union.Queries) != 2 || len(expr.Clauses) != 2 {
+		t.Fatalf("unexpected UNION %+v", expr.Union)
+	}
+	if c := expr.Union.Queries[1].Clauses[1].(*ReturnClause); c.Items[0].JsonPath != "s" {
+		t.Errorf("unexpected RETURN clause of the last query %+v", c)
+	}
+
+	for _, query := range []string{
+		// UNION and UNION ALL can't be mixed
+		`MATCH (d:Deployment) RETURN d UNION MATCH (p:Pod) RETURN p UNION ALL MATCH (s:Service) RETURN s`,
+		// Only queries returning resources can be combined
+		`MATCH (d:Deployment) RETURN d UNION MATCH (p:Pod) DELETE p`,
+		`MATCH (d:Deployment) RETURN d UNION`,
+	} {
+		if _, err := ParseQuery(query); err == nil {
+			t.Errorf("expected %q to be rejected", query)
+		}
+	}
+}
+
+func TestUnion(t *testing.T) {
+	containers := func(images ...string) []interface{} {
+		list := []interface{}{}
+		for _, image := range images {
+			list = append(list, map[string]interface{}{"image": image})
+		}
+		return list
+	}
+	deployment := func(name string, images ...string) runtime.Object {
+		return newTestObject("apps/v1", "Deployment", "default", name, map[string]interface{}{
+			"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{"containers": containers(images...)}}},
+		})
+	}
+	pod := func(name string, images ...string) runtime.Object {
+		return newTestObject("v1", "Pod", "default", name, map[string]interface{}{
+			"spec": map[string]interface{}{"containers": containers(images...)},
+		})
+	}
+	q := newTestQueryExecutor(t, deployment("api", "api:2.0", "envoy:1.29"), deployment("web", "nginx:1.25"), pod("debug", "busybox:1.36", "envoy:1.29"))
+
+	images := `MATCH (d:Deployment) UNWIND d.spec.template.spec.containers AS c RETURN c.image UNION%s MATCH (p:Pod) UNWIND p.spec.containers AS c RETURN c.image`
+	image := func(image string) interface{} {
+		return map[string]interface{}{"c": map[string]interface{}{"image": image}}
+	}
+	result := executeTestQuery(t, q, fmt.Sprintf(images, ""))
+	expected := []interface{}{image("api:2.0"), image("envoy:1.29"), image("nginx:1.25"), image("busybox:1.36")}
+	if !reflect.DeepEqual(result.Data[withRowsNode], expected) {
+		t.Errorf("expected the distinct images of deployments and pods, got %v", result.Data[withRowsNode])
+	}
+	result = executeTestQuery(t, q, fmt.Sprintf(images, " ALL"))
+	expected = []interface{}{image("api:2.0"), image("envoy:1.29"), image("nginx:1.25"), image("busybox:1.36"), image("envoy:1.29")}
+	if !reflect.DeepEqual(result.Data[withRowsNode], expected) {
+		t.Errorf("expected every image of deployments and pods, got %v", result.Data[withRowsNode])
+	}
+
+	// Rows of different nodes are kept apart, and so are aggregates
+	result = executeTestQuery(t, q, `MATCH (d:Deployment) RETURN d.metadata.name AS name, COUNT{d} AS deployments UNION ALL MATCH (p:Pod) RETURN p.metadata.name AS name, COUNT{p} AS pods`)
+	if len(result.Data["d"].([]interface{})) != 2 || len(result.Data["p"].([]interface{})) != 1 {
+		t.Errorf("expected the rows of both queries, got %v", result.Data)
+	}
+	if aggregate := result.Data["aggregate"].(map[string]interface{}); aggregate["deployments"] != 2 || aggregate["pods"] != 1 {
+		t.Errorf("expected the aggregates of both queries, got %v", aggregate)
+	}
+	if len(result.Graph.Nodes) != 3 {
+		t.Errorf("expected the graph of both queries, got %v", result.Graph.Nodes)
+	}
+
+	ast, err := ParseQuery(`MATCH (d:Deployment) RETURN COUNT{d} AS total UNION MATCH (p:Pod) RETURN COUNT{p} AS total`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Execute(ast, "default"); DiagnosticCodeOf(err) != CodeUnionAggregate {
+		t.Errorf("expected %s, got %v", CodeUnionAggregate, err)
+	}
+}
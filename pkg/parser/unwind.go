@@ -0,0 +1,79 @@
+package parser
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// processUnwind runs an UNWIND clause, which expands a list into rows, one per element. Unwinding a list of a
+// node, e.g. UNWIND p.spec.containers AS c, gives rows of the resource and the element, so that RETURN
+// p.metadata.name, c.image pairs each container with its pod. Unwinding a value of the rows of a previous WITH or
+// UNWIND clause repeats each row once per element. A missing list gives no rows, and a value that isn't a list
+// gives a single row.
+func (q *QueryExecutor) processUnwind(c *UnwindClause, bound map[string]*NodePattern) error {
+	root := strings.Split(c.JsonPath, ".")[0]
+	if c.Alias == withRowsNode || slices.Contains(q.withColumns, c.Alias) || q.resultMap[c.Alias] != nil {
+		return newDiagnosticError(CodeInvalidUnwind, nil, "path", c.JsonPath, "reason", fmt.Sprintf("%s is already defined", c.Alias))
+	}
+
+	rows := []map[string]interface{}{}
+	var columns []string
+	if slices.Contains(q.withColumns, root) {
+		records, _ := q.resultMap[withRowsNode].([]map[string]interface{})
+		for _, record := range records {
+			for _, element := range unwindElements(record, "$."+c.JsonPath) {
+				row := make(map[string]interface{}, len(record)+1)
+				for column, value := range record {
+					row[column] = value
+				}
+				row[c.Alias] = element
+				rows = append(rows, row)
+			}
+		}
+		columns = append(append([]string{}, q.withColumns...), c.Alias)
+	} else if resources, ok := q.resultMap[root].([]map[string]interface{}); ok && root != withRowsNode {
+		if q.withColumns != nil {
+			return newDiagnosticError(CodeInvalidUnwind, nil, "path", c.JsonPath, "reason", fmt.Sprintf("%s can't be unwound alongside the rows of WITH", root))
+		}
+		path := "$"
+		if parts := strings.Split(c.JsonPath, "."); len(parts) > 1 {
+			path = "$." + strings.Join(parts[1:], ".")
+		}
+		for _, resource := range resources {
+			for _, element := range unwindElements(resource, path) {
+				rows = append(rows, map[string]interface{}{root: resource, c.Alias: element})
+			}
+		}
+		columns = []string{root, c.Alias}
+		// The node is now a value of the rows
+		delete(q.resultMap, root)
+		delete(bound, root)
+	} else {
+		return newDiagnosticError(CodeInvalidUnwind, nil, "path", c.JsonPath, "reason", fmt.Sprintf("%s isn't a matched node or a WITH value", root))
+	}
+
+	q.resultMap[withRowsNode] = rows
+	q.withColumns = columns
+	return nil
+}
+
+// unwindElements are the elements of the list at path within a record
+func unwindElements(record map[string]interface{}, path string) []interface{} {
+	value := interface{}(record)
+	if path != "$" {
+		var err error
+		if value, err = jsonPathLookup(record, path); err != nil {
+			logDebug("Path not found", "path", path)
+			return nil
+		}
+	}
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return v
+	default:
+		return []interface{}{v}
+	}
+}
@@ -0,0 +1,79 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestParseUnwind(t *testing.T) {
+	expr, err := ParseQuery(`MATCH (p:Pod) UNWIND p.spec.containers AS c RETURN p.metadata.name, c.image`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	if len(expr.Clauses) != 3 || !reflect.DeepEqual(expr.Clauses[1], &UnwindClause{JsonPath: "p.spec.containers", Alias: "c"}) {
+		t.Errorf("unexpected UNWIND clause %+v", expr.Clauses)
+	}
+
+	expr, err = ParseQuery(`MATCH (p:Pod) UNWIND p.spec.containers AS c UNWIND c.ports AS port WITH port.containerPort AS port, COUNT(c) AS containers RETURN port, containers`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	if len(expr.Clauses) != 5 {
+		t.Fatalf("expected 5 clauses, got %d", len(expr.Clauses))
+	}
+	if unwind := expr.Clauses[2].(*UnwindClause); unwind.JsonPath != "c.ports" || unwind.Alias != "port" {
+		t.Errorf("unexpected second UNWIND clause %+v", unwind)
+	}
+	if _, ok := expr.Clauses[3].(*WithClause); !ok {
+		t.Errorf("expected a WITH after UNWIND, got %T", expr.Clauses[3])
+	}
+}
+
+func TestUnwindExpandsLists(t *testing.T) {
+	pod := func(name string, images ...string) runtime.Object {
+		containers := []interface{}{}
+		for _, image := range images {
+			containers = append(containers, map[string]interface{}{"name": name, "image": image})
+		}
+		return newTestObject("v1", "Pod", "default", name, map[string]interface{}{
+			"spec": map[string]interface{}{"containers": containers},
+		})
+	}
+	q := newTestQueryExecutor(t, pod("web", "nginx:1.25", "envoy:1.29"), pod("api", "api:2.0"), pod("empty"))
+
+	result := executeTestQuery(t, q, `MATCH (p:Pod) UNWIND p.spec.containers AS c RETURN p.metadata.name AS pod, c.image AS image`)
+	images := map[string]string{}
+	for _, row := range result.Data[withRowsNode].([]interface{}) {
+		row := row.(map[string]interface{})
+		images[row["image"].(string)] = row["pod"].(string)
+	}
+	expected := map[string]string{"nginx:1.25": "web", "envoy:1.29": "web", "api:2.0": "api"}
+	if !reflect.DeepEqual(images, expected) {
+		t.Errorf("expected a row per container with its pod, got %v", result.Data[withRowsNode])
+	}
+
+	// Unwound rows can be grouped by WITH
+	result = executeTestQuery(t, q, `MATCH (p:Pod) UNWIND p.spec.containers AS c WITH COUNT(c) AS containers RETURN containers`)
+	if !reflect.DeepEqual(result.Data[withRowsNode], []interface{}{map[string]interface{}{"containers": 3}}) {
+		t.Errorf("expected 3 containers, got %v", result.Data[withRowsNode])
+	}
+}
+
+func TestUnwindInvalid(t *testing.T) {
+	q := newTestQueryExecutor(t, newTestObject("v1", "Pod", "default", "web", nil))
+	for _, query := range []string{
+		`MATCH (p:Pod) UNWIND x.spec.containers AS c RETURN c`,
+		`MATCH (p:Pod) UNWIND p.spec.containers AS p RETURN p`,
+		`MATCH (p:Pod) WITH COUNT(p) AS pods UNWIND p.spec.containers AS c RETURN c`,
+	} {
+		ast, err := ParseQuery(query)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q) error = %v", query, err)
+		}
+		if _, err := q.Execute(ast, "default"); DiagnosticCodeOf(err) != CodeInvalidUnwind {
+			t.Errorf("expected %s for %q, got %v", CodeInvalidUnwind, query, err)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package parser
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A query may start with the language version it was written for, e.g. CYPHERNETES 1 MATCH (p:Pod) RETURN p. When
+// the grammar changes the meaning of an operator or a clause, the change comes with a new language version, and
+// queries declaring an earlier one keep being checked against it instead of silently taking the new meaning. Queries
+// without the pragma are checked against CompatVersion, --compat, or the latest version if it isn't set.
+
+// languageVersion is the latest version of the language
+var languageVersion = 1
+
+// CompatVersion is the language version queries that don't declare one are checked against, 0 for the latest
+var CompatVersion int
+
+// LanguageVersion returns the latest version of the language
+func LanguageVersion() int {
+	return languageVersion
+}
+
+// languageFeature is a construct of the language introduced by a version after the first
+type languageFeature struct {
+	Name    string
+	Version int
+	// used reports whether a query, without the queries of its UNION or APPLY, uses the construct
+	used func(e *Expression) bool
+}
+
+// languageFeatures are the constructs introduced after version 1, in the order of their versions. A construct whose
+// meaning changes is added here with the version of its new meaning, so older queries are told they need it.
+var languageFeatures []languageFeature
+
+var versionPragma = regexp.MustCompile(`^\s*(?i:CYPHERNETES)\s+(\d+)\b`)
+
+// cutVersionPragma returns the version a query declares and the query with its pragma blanked out, so the positions
+// reported by the parser are those of the query as written
+func cutVersionPragma(query string) (int, string, bool) {
+	match := versionPragma.FindStringSubmatchIndex(query)
+	if match == nil {
+		return 0, query, false
+	}
+	version, err := strconv.Atoi(query[match[2]:match[3]])
+	if err != nil {
+		version = -1
+	}
+	return version, strings.Repeat(" ", match[1]) + query[match[1]:], true
+}
+
+// LanguageVersion returns the version the query is checked against: the one it declares, or else CompatVersion
+func (e *Expression) LanguageVersion() int {
+	switch {
+	case e.Version != 0:
+		return e.Version
+	case CompatVersion != 0:
+		return CompatVersion
+	}
+	return languageVersion
+}
+
+// RequiredVersion returns the earliest language version the query can be run with, that of the latest construct it
+// uses
+func RequiredVersion(e *Expression) int {
+	version := 1
+	if feature, ok := requiredFeature(e); ok {
+		version = feature.Version
+	}
+	return version
+}
+
+// requiredFeature returns the construct of the query introduced by the latest version, if it uses any
+func requiredFeature(e *Expression) (languageFeature, bool) {
+	var required languageFeature
+	found := false
+	var visit func(e *Expression)
+	visit = func(e *Expression) {
+		if e == nil {
+			return
+		}
+		for _, feature := range languageFeatures {
+			if (!found || feature.Version > required.Version) && feature.used(e) {
+				required, found = feature, true
+			}
+		}
+		if e.Apply != nil {
+			visit(e.Apply.While)
+		}
+		if e.Union != nil {
+			for _, query := range e.Union.Queries {
+				visit(query)
+			}
+		}
+	}
+	visit(e)
+	return required, found
+}
+
+// checkLanguageVersion rejects the queries which use constructs introduced after the version they're checked against
+func checkLanguageVersion(e *Expression) error {
+	if CompatVersion < 0 || CompatVersion > languageVersion {
+		return newDiagnosticError(CodeUnsupportedVersion, nil, "version", CompatVersion, "latest", languageVersion)
+	}
+	version := e.LanguageVersion()
+	if feature, ok := requiredFeature(e); ok && feature.Version > version {
+		return newDiagnosticError(CodeVersionRequired, nil, "feature", feature.Name, "required", feature.Version, "version", version)
+	}
+	return nil
+}
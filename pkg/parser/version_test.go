@@ -0,0 +1,75 @@
+package parser
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLanguageVersionPragma(t *testing.T) {
+	ast, err := ParseQuery(`CYPHERNETES 1 EXPLAIN MATCH (p:Pod) RETURN p.metadata.name`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	if ast.Version != 1 || !ast.Explain || ast.LanguageVersion() != 1 || RequiredVersion(ast) != 1 {
+		t.Errorf("expected an EXPLAIN query declaring version 1, got %+v", ast)
+	}
+
+	ast, err = ParseQuery(`MATCH (p:Pod) RETURN p`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	if ast.Version != 0 || ast.LanguageVersion() != LanguageVersion() {
+		t.Errorf("expected a query without a pragma to be checked against the latest version, got %d", ast.LanguageVersion())
+	}
+
+	for _, query := range []string{`CYPHERNETES 0 MATCH (p:Pod) RETURN p`, `cyphernetes 2 MATCH (p:Pod) RETURN p`} {
+		if _, err := ParseQuery(query); DiagnosticCodeOf(err) != CodeUnsupportedVersion {
+			t.Errorf("expected code %s for %q, got %v", CodeUnsupportedVersion, query, err)
+		}
+	}
+
+	// Errors are reported at their position in the query as written
+	_, err = ParseQuery(`CYPHERNETES 1 MATCH (p:Pod RETURN p`)
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.Column != 28 {
+		t.Errorf("expected a syntax error at RETURN, got %v", err)
+	}
+}
+
+func TestLanguageVersionFeatures(t *testing.T) {
+	originalVersion, originalFeatures, originalCompat := languageVersion, languageFeatures, CompatVersion
+	defer func() {
+		languageVersion, languageFeatures, CompatVersion = originalVersion, originalFeatures, originalCompat
+	}()
+	languageVersion = 2
+	languageFeatures = []languageFeature{{Name: "UNION", Version: 2, used: func(e *Expression) bool { return e.Union != nil }}}
+
+	union := `MATCH (p:Pod) RETURN p.metadata.name UNION MATCH (s:Service) RETURN s.metadata.name`
+	ast, err := ParseQuery(union)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	if RequiredVersion(ast) != 2 {
+		t.Errorf("expected the query to require version 2, got %d", RequiredVersion(ast))
+	}
+	if _, err := ParseQuery("CYPHERNETES 1 " + union); DiagnosticCodeOf(err) != CodeVersionRequired {
+		t.Errorf("expected code %s for a query declaring version 1, got %v", CodeVersionRequired, err)
+	}
+
+	// --compat applies to the queries that don't declare their version
+	CompatVersion = 1
+	if _, err := ParseQuery(union); DiagnosticCodeOf(err) != CodeVersionRequired {
+		t.Errorf("expected code %s under --compat 1, got %v", CodeVersionRequired, err)
+	}
+	if _, err := ParseQuery("CYPHERNETES 2 " + union); err != nil {
+		t.Errorf("expected the declared version to take precedence over --compat, got %v", err)
+	}
+	if ast, err := ParseQuery(`MATCH (p:Pod) RETURN p`); err != nil || RequiredVersion(ast) != 1 {
+		t.Errorf("expected a query without the construct to run under --compat 1, got %v", err)
+	}
+
+	CompatVersion = 3
+	if _, err := ParseQuery(`MATCH (p:Pod) RETURN p`); DiagnosticCodeOf(err) != CodeUnsupportedVersion {
+		t.Errorf("expected code %s for --compat 3, got %v", CodeUnsupportedVersion, err)
+	}
+}
@@ -0,0 +1,376 @@
+package parser
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// Types of watch events
+const (
+	// WatchAdded is a resource that now matches the query, Data is its row
+	WatchAdded = "added"
+	// WatchModified is a change of the row of a resource that matched the query already
+	WatchModified = "modified"
+	// WatchDeleted is a resource that no longer matches the query, or was deleted
+	WatchDeleted = "deleted"
+	// WatchSynced follows the rows of the resources that matched when the watch started
+	WatchSynced = "synced"
+	// WatchReset tells the rows received so far are stale, e.g. the resume token expired. The matching
+	// resources are sent again as added rows, followed by synced.
+	WatchReset = "reset"
+	// WatchBookmark only carries a newer resume token
+	WatchBookmark = "bookmark"
+)
+
+// WatchEvent is a change of the rows of a watched query
+type WatchEvent struct {
+	Type string
+	// Node is the name of the node the row is of
+	Node string
+	// Key identifies the resource of the row across events
+	Key  string
+	Data map[string]interface{}
+	// ResumeToken resumes the watch after this event when given to WatchOptions, it's empty for the rows
+	// sent before synced
+	ResumeToken string
+}
+
+// WatchOptions are the options of Watch
+type WatchOptions struct {
+	// ResumeToken resumes a watch after the event it was taken from, instead of starting with the
+	// resources that match
+	ResumeToken string
+	// Lock, if set, is held while the watch reads or changes the query state, e.g. to let other queries run
+	// between its events
+	Lock sync.Locker
+}
+
+// queryWatch is a running watch of a query
+type queryWatch struct {
+	q            *QueryExecutor
+	match        *MatchClause
+	returnClause *ReturnClause
+	node         *NodePattern
+	nodeId       string
+	gvr          schema.GroupVersionResource
+	namespace    string
+	options      metav1.ListOptions
+	lock         sync.Locker
+	events       chan<- WatchEvent
+
+	// rows are the last rows sent by resource, nil for a resource known not to match. complete is false
+	// when the client may hold rows missing from rows, i.e. when the watch was resumed.
+	rows     map[string]map[string]interface{}
+	complete bool
+	// synced is set once the client was told the resources are listed
+	synced bool
+}
+
+// Watch runs a query, then sends the changes of its rows as the resources it matches change. Only queries
+// of a single kind, without relationships or aggregations, can be watched.
+//
+// Unless resumed, the watch first sends the rows of the matching resources as added events, followed by a
+// synced event. Cancelling ctx stops the watch. The events channel is always closed when the watch ends,
+// after which the error channel yields the error that ended it, if any.
+func (q *QueryExecutor) Watch(ctx context.Context, ast *Expression, namespace string, opts WatchOptions) (<-chan WatchEvent, <-chan error) {
+	events := make(chan WatchEvent)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(events)
+
+		w, err := q.newQueryWatch(ast, namespace, opts, events)
+		if err == nil {
+			err = q.preflight(ctx, ast, namespace, true)
+		}
+		if err == nil {
+			err = w.run(ctx, opts.ResumeToken)
+		}
+		if err != nil && ctx.Err() == nil {
+			errs <- err
+		}
+	}()
+
+	return events, errs
+}
+
+func (q *QueryExecutor) newQueryWatch(ast *Expression, namespace string, opts WatchOptions, events chan<- WatchEvent) (*queryWatch, error) {
+	match, returnClause, ok := streamablePattern(ast)
+	if !ok || match.Nodes[0].ResourceProperties.Kind == "*" || IsMultiKindPattern(match.Nodes[0].ResourceProperties.Kind) {
+		return nil, newDiagnosticError(CodeWatchUnsupported, nil)
+	}
+
+	w := &queryWatch{
+		q:            q,
+		match:        match,
+		returnClause: returnClause,
+		node:         match.Nodes[0],
+		nodeId:       match.Nodes[0].ResourceProperties.Name,
+		lock:         opts.Lock,
+		events:       events,
+		rows:         make(map[string]map[string]interface{}),
+	}
+
+	// The namespace and selectors are taken from the query state, which other queries change
+	w.acquire()
+	defer w.release()
+	originalNamespace := q.namespace
+	defer func() { q.namespace = originalNamespace }()
+	q.prepareQuery(namespace)
+	q.applyNamespaceProperty(w.node)
+	w.namespace = q.namespace
+
+	fieldSelector, labelSelector, err := q.nodeSelectors(w.node)
+	if err != nil {
+		return nil, err
+	}
+	labelSelector, err = parseLabelSelector(strings.ReplaceAll(labelSelector, "\"", ""))
+	if err != nil {
+		return nil, err
+	}
+	w.options = metav1.ListOptions{FieldSelector: fieldSelector, LabelSelector: labelSelector}
+
+	targets, err := listTargetsForKind(q.Clientset, w.node.ResourceProperties.Kind, w.namespace)
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) != 1 {
+		return nil, newDiagnosticError(CodeWatchUnsupported, nil)
+	}
+	w.gvr = targets[0].gvr
+	if !targets[0].namespaced {
+		w.namespace = ""
+	}
+	return w, nil
+}
+
+func (w *queryWatch) acquire() {
+	if w.lock != nil {
+		w.lock.Lock()
+	}
+}
+
+func (w *queryWatch) release() {
+	if w.lock != nil {
+		w.lock.Unlock()
+	}
+}
+
+func (w *queryWatch) run(ctx context.Context, resourceVersion string) error {
+	if resourceVersion == "" {
+		w.complete = true
+		var err error
+		if resourceVersion, err = w.list(ctx); err != nil {
+			return err
+		}
+	} else {
+		w.synced = true
+	}
+
+	for {
+		options := w.options
+		options.ResourceVersion = resourceVersion
+		options.AllowWatchBookmarks = true
+		w.q.observeAPICall("watch", w.gvr)
+		watcher, err := w.q.DynamicClient.Resource(w.gvr).Namespace(w.namespace).Watch(ctx, options)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if !apierrors.IsResourceExpired(err) && !apierrors.IsGone(err) {
+				return apiError("watch", w.gvr, err)
+			}
+			if resourceVersion, err = w.reset(ctx); err != nil {
+				return err
+			}
+			continue
+		}
+		if !w.synced {
+			// The resources are listed, tell the client once changes can no longer be missed
+			w.synced = true
+			if err := w.send(ctx, WatchEvent{Type: WatchSynced, ResumeToken: resourceVersion}); err != nil {
+				watcher.Stop()
+				return err
+			}
+		}
+
+		resourceVersion, err = w.consume(ctx, watcher, resourceVersion)
+		watcher.Stop()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// consume sends the changes of the watched resources until the API server ends the watch, it returns the
+// resource version to watch from next
+func (w *queryWatch) consume(ctx context.Context, watcher watch.Interface, resourceVersion string) (string, error) {
+	for {
+		var event watch.Event
+		var ok bool
+		select {
+		case event, ok = <-watcher.ResultChan():
+			if !ok {
+				return resourceVersion, nil
+			}
+		case <-ctx.Done():
+			return resourceVersion, ctx.Err()
+		}
+
+		if event.Type == watch.Error {
+			err := apierrors.FromObject(event.Object)
+			if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) {
+				return w.reset(ctx)
+			}
+			return resourceVersion, apiError("watch", w.gvr, err)
+		}
+		item, ok := event.Object.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+		if item.GetResourceVersion() != "" {
+			resourceVersion = item.GetResourceVersion()
+		}
+
+		var err error
+		switch event.Type {
+		case watch.Bookmark:
+			err = w.send(ctx, WatchEvent{Type: WatchBookmark, ResumeToken: resourceVersion})
+		case watch.Deleted:
+			err = w.remove(ctx, resourceIdentity(item.UnstructuredContent()), resourceVersion)
+		default:
+			err = w.update(ctx, item.UnstructuredContent(), resourceVersion)
+		}
+		if err != nil {
+			return resourceVersion, err
+		}
+	}
+}
+
+// list sends the rows of the resources that match, and returns the resource version to watch from
+func (w *queryWatch) list(ctx context.Context) (string, error) {
+	options := w.options
+	options.Limit = StreamPageSize
+	var resourceVersion string
+	for {
+		w.q.observeAPICall("list", w.gvr)
+		listCtx, cancel := listContext(ctx, w.gvr)
+		list, err := w.q.DynamicClient.Resource(w.gvr).Namespace(w.namespace).List(listCtx, options)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			return "", w.q.listError(listCtx, w.gvr, err)
+		}
+		// The pages are a snapshot as of the first one
+		if resourceVersion == "" {
+			resourceVersion = list.GetResourceVersion()
+		}
+		for _, item := range list.Items {
+			if err := w.update(ctx, item.UnstructuredContent(), ""); err != nil {
+				return "", err
+			}
+		}
+		if list.GetContinue() == "" {
+			return resourceVersion, nil
+		}
+		options.Continue = list.GetContinue()
+	}
+}
+
+// reset lists the resources again once the watch can't go on from where it was
+func (w *queryWatch) reset(ctx context.Context) (string, error) {
+	logDebug("Watch expired, listing resources again", "resource", w.gvr.String())
+	if err := w.send(ctx, WatchEvent{Type: WatchReset}); err != nil {
+		return "", err
+	}
+	w.rows = make(map[string]map[string]interface{})
+	w.complete = true
+	w.synced = false
+	return w.list(ctx)
+}
+
+// update sends the change of a resource's row, if any
+func (w *queryWatch) update(ctx context.Context, resource map[string]interface{}, resourceVersion string) error {
+	key := resourceIdentity(resource)
+	row, matches, err := w.row(resource)
+	if err != nil {
+		return err
+	}
+	if !matches {
+		return w.remove(ctx, key, resourceVersion)
+	}
+
+	previous := w.rows[key]
+	w.rows[key] = row
+	switch {
+	case previous == nil:
+		return w.send(ctx, WatchEvent{Type: WatchAdded, Key: key, Data: row, ResumeToken: resourceVersion})
+	case reflect.DeepEqual(previous, row):
+		// e.g. the status of the resource changed, but the query doesn't return it
+		return nil
+	default:
+		return w.send(ctx, WatchEvent{Type: WatchModified, Key: key, Data: row, ResumeToken: resourceVersion})
+	}
+}
+
+// remove sends the deletion of a resource's row, unless it's known not to have one
+func (w *queryWatch) remove(ctx context.Context, key, resourceVersion string) error {
+	previous, known := w.rows[key]
+	w.rows[key] = nil
+	if previous == nil && (known || w.complete) {
+		return nil
+	}
+	return w.send(ctx, WatchEvent{Type: WatchDeleted, Key: key, Data: previous, ResumeToken: resourceVersion})
+}
+
+// row evaluates the query for a single resource, matches is false if the resource doesn't match its filters
+func (w *queryWatch) row(resource map[string]interface{}) (row map[string]interface{}, matches bool, err error) {
+	w.acquire()
+	defer w.release()
+
+	q := w.q
+	originalMap, originalSources, originalColumns := q.resultMap, q.resultSources, q.withColumns
+	defer func() {
+		q.resultMap, q.resultSources, q.withColumns = originalMap, originalSources, originalColumns
+	}()
+	q.resultMap = map[string]interface{}{w.nodeId: []map[string]interface{}{resource}}
+	q.resultSources = map[string]resultSource{w.nodeId: {source: ProvenanceLive, fetchedAt: time.Now()}}
+	q.withColumns = nil
+
+	if err := q.applyExtraFilters(w.node, w.match.ExtraFilters); err != nil {
+		return nil, false, err
+	}
+	results := &QueryResult{Data: make(map[string]interface{})}
+	if err := w.q.projectReturn(w.returnClause, results); err != nil {
+		return nil, false, err
+	}
+	rows, _ := results.Data[w.nodeId].([]interface{})
+	if len(rows) == 0 {
+		return nil, false, nil
+	}
+	return rows[0].(map[string]interface{}), true, nil
+}
+
+func (w *queryWatch) send(ctx context.Context, event WatchEvent) error {
+	if event.Type != WatchSynced && event.Type != WatchReset && event.Type != WatchBookmark {
+		event.Node = w.nodeId
+	}
+	select {
+	case w.events <- event:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,106 @@
+package parser
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestWatch(t *testing.T) {
+	pod := func(name, phase string) *unstructured.Unstructured {
+		return newTestObject("v1", "Pod", "default", name, map[string]interface{}{
+			"metadata": map[string]interface{}{"name": name, "namespace": "default"},
+			"status":   map[string]interface{}{"phase": phase},
+		})
+	}
+	q := newTestQueryExecutor(t, pod("web", "Running"), pod("api", "Pending"))
+	ast, err := ParseQuery(`MATCH (p:Pod) WHERE p.status.phase = "Running" RETURN p.metadata.name`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, errs := q.Watch(ctx, ast, "default", WatchOptions{})
+	next := func() WatchEvent {
+		t.Helper()
+		select {
+		case event, ok := <-events:
+			if !ok {
+				t.Fatalf("watch ended: %v", <-errs)
+			}
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a watch event")
+		}
+		return WatchEvent{}
+	}
+	expect := func(eventType, name string) {
+		t.Helper()
+		event := next()
+		if event.Type != eventType {
+			t.Fatalf("expected a %s event, got %+v", eventType, event)
+		}
+		if name != "" && event.Data["name"] != name {
+			t.Fatalf("expected the row of %s, got %+v", name, event)
+		}
+	}
+
+	expect(WatchAdded, "web")
+	expect(WatchSynced, "")
+
+	pods := q.DynamicClient.Resource(schema.GroupVersionResource{Version: "v1", Resource: "pods"}).Namespace("default")
+	// api starts running, web fails, and a pod that doesn't match is created
+	if _, err := pods.Update(ctx, pod("api", "Running"), metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	expect(WatchAdded, "api")
+	if _, err := pods.Create(ctx, pod("db", "Pending"), metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pods.Update(ctx, pod("web", "Failed"), metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	expect(WatchDeleted, "web")
+	// A change the query doesn't return isn't sent
+	running := pod("api", "Running")
+	running.SetLabels(map[string]string{"app": "api"})
+	if _, err := pods.Update(ctx, running, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := pods.Delete(ctx, "api", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	expect(WatchDeleted, "api")
+
+	cancel()
+	for range events {
+	}
+	if err := <-errs; err != nil {
+		t.Errorf("expected no error once cancelled, got %v", err)
+	}
+}
+
+func TestWatchUnsupported(t *testing.T) {
+	q := newTestQueryExecutor(t)
+	for _, query := range []string{
+		`MATCH (d:Deployment)->(p:Pod) RETURN p.metadata.name`,
+		`MATCH (p:Pod) RETURN COUNT{p.metadata.name}`,
+		`MATCH (p:Pod|Deployment) RETURN p.metadata.name`,
+	} {
+		ast, err := ParseQuery(query)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q) error = %v", query, err)
+		}
+		events, errs := q.Watch(context.Background(), ast, "default", WatchOptions{})
+		for range events {
+		}
+		if err := <-errs; DiagnosticCodeOf(err) != CodeWatchUnsupported {
+			t.Errorf("expected %s for %q, got %v", CodeWatchUnsupported, query, err)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// withRowsNode is the identifier the rows of a grouping WITH clause, or of an UNWIND clause, are kept and returned under
+const withRowsNode = "rows"
+
+// processWith runs a WITH clause. A WITH clause of nodes only, e.g. WITH d WHERE d.spec.replicas > 2, passes the
+// resources of those nodes on, filtered by its WHERE clause. Otherwise its items are grouped into rows: the
+// values of the items without an aggregate are the grouping keys, and COUNT and SUM are computed per group.
+// Either way the nodes that aren't passed on are out of scope for the clauses that follow.
+func (q *QueryExecutor) processWith(c *WithClause, bound map[string]*NodePattern) error {
+	var nodes, projections []*ReturnItem
+	for _, item := range c.Items {
+		if _, isNode := q.resultMap[item.JsonPath].([]map[string]interface{}); isNode && item.JsonPath != withRowsNode &&
+			item.Alias == "" && item.Aggregate == "" && item.Function == "" {
+			nodes = append(nodes, item)
+		} else {
+			projections = append(projections, item)
+		}
+	}
+	if len(projections) == 0 {
+		return q.passNodes(c, bound, nodes)
+	}
+	if len(nodes) > 0 {
+		return newDiagnosticError(CodeInvalidWith, nil, "item", nodes[0].JsonPath, "reason", "nodes can't be passed on with grouped values")
+	}
+	return q.groupRows(c, bound, projections)
+}
+
+// passNodes keeps the nodes of a WITH clause in scope, and filters their resources by its WHERE clause
+func (q *QueryExecutor) passNodes(c *WithClause, bound map[string]*NodePattern, items []*ReturnItem) error {
+	names := []string{}
+	for _, item := range items {
+		names = append(names, item.JsonPath)
+	}
+	for _, filter := range c.ExtraFilters {
+		if nodeId := strings.Split(filter.Key, ".")[0]; !slices.Contains(names, nodeId) {
+			return newDiagnosticError(CodeInvalidWith, nil, "item", filter.Key, "reason", fmt.Sprintf("%s isn't passed on by WITH", nodeId))
+		}
+	}
+	q.leaveScope(bound, names)
+	for _, name := range names {
+		if err := q.applyExtraFilters(&NodePattern{ResourceProperties: &ResourceProperties{Name: name}}, c.ExtraFilters); err != nil {
+			return err
+		}
+		if q.resultMap[name] == nil {
+			// applyExtraFilters leaves nil when it drops every resource
+			q.resultMap[name] = []map[string]interface{}{}
+		}
+	}
+	return nil
+}
+
+// groupRows groups the resources of a node, or the rows of a previous WITH clause, by the items of a WITH clause
+func (q *QueryExecutor) groupRows(c *WithClause, bound map[string]*NodePattern, items []*ReturnItem) error {
+	// All items are computed from the same records: the resources of a node, or the rows of a previous WITH
+	source := ""
+	columns := []string{}
+	for _, item := range items {
+		root := strings.Split(item.JsonPath, ".")[0]
+		itemSource := root
+		if slices.Contains(q.withColumns, root) {
+			itemSource = withRowsNode
+		} else if _, ok := q.resultMap[root].([]map[string]interface{}); !ok || root == withRowsNode {
+			return newDiagnosticError(CodeInvalidWith, nil, "item", item.JsonPath, "reason", fmt.Sprintf("%s isn't a matched node or a WITH value", root))
+		}
+		if source != "" && itemSource != source {
+			return newDiagnosticError(CodeInvalidWith, nil, "item", item.JsonPath, "reason", "all items must refer to the same node")
+		}
+		source = itemSource
+
+		column := item.Alias
+		if column == "" && itemSource == withRowsNode && item.JsonPath == root && item.Aggregate == "" {
+			// A value of the previous WITH passed on keeps its name
+			column = root
+		}
+		if column == "" {
+			return newDiagnosticError(CodeInvalidWith, nil, "item", item.JsonPath, "reason", "it needs a name, e.g. AS value")
+		}
+		if slices.Contains(columns, column) {
+			return newDiagnosticError(CodeInvalidWith, nil, "item", item.JsonPath, "reason", fmt.Sprintf("%s is already defined", column))
+		}
+		columns = append(columns, column)
+	}
+	for _, filter := range c.ExtraFilters {
+		if column := strings.Split(filter.Key, ".")[0]; !slices.Contains(columns, column) {
+			return newDiagnosticError(CodeInvalidWith, nil, "item", filter.Key, "reason", fmt.Sprintf("%s isn't a WITH value", column))
+		}
+	}
+
+	type group struct {
+		row   map[string]interface{}
+		count int
+		sums  map[string]interface{}
+	}
+	groups := []*group{}
+	groupIndex := map[string]*group{}
+	hasKeys := false
+	for _, item := range items {
+		hasKeys = hasKeys || item.Aggregate == ""
+	}
+
+	records, _ := q.resultMap[source].([]map[string]interface{})
+	for _, record := range records {
+		row := map[string]interface{}{}
+		values := map[string]interface{}{}
+		keys := []interface{}{}
+		for i, item := range items {
+			value, err := withItemValue(item, record, source == withRowsNode)
+			if err != nil {
+				return err
+			}
+			if item.Aggregate == "" {
+				row[columns[i]] = value
+				keys = append(keys, value)
+			} else {
+				values[columns[i]] = value
+			}
+		}
+		key, err := json.Marshal(keys)
+		if err != nil {
+			return newDiagnosticError(CodeInvalidWith, err, "item", items[0].JsonPath, "reason", "its values can't be grouped")
+		}
+		g, ok := groupIndex[string(key)]
+		if !ok {
+			g = &group{row: row, sums: map[string]interface{}{}}
+			groupIndex[string(key)] = g
+			groups = append(groups, g)
+		}
+		g.count++
+		for i, item := range items {
+			if strings.ToUpper(item.Aggregate) == "SUM" {
+				g.sums[columns[i]], err = addToSum(g.sums[columns[i]], values[columns[i]], withItemPath(item, source == withRowsNode))
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	// Aggregating everything, e.g. WITH COUNT{p} AS pods, gives a row even when there's nothing to count
+	if len(groups) == 0 && !hasKeys {
+		groups = append(groups, &group{row: map[string]interface{}{}, sums: map[string]interface{}{}})
+	}
+
+	rows := []map[string]interface{}{}
+	for _, g := range groups {
+		for i, item := range items {
+			switch strings.ToUpper(item.Aggregate) {
+			case "COUNT":
+				g.row[columns[i]] = g.count
+			case "SUM":
+				sum := g.sums[columns[i]]
+				if strSlice, ok := sum.([]string); ok && len(strSlice) == 1 {
+					sum = strSlice[0]
+				}
+				g.row[columns[i]] = sum
+			}
+		}
+		matches, err := withRowMatches(g.row, c.ExtraFilters)
+		if err != nil {
+			return err
+		}
+		if matches {
+			rows = append(rows, g.row)
+		}
+	}
+
+	q.leaveScope(bound, nil)
+	q.resultMap[withRowsNode] = rows
+	q.withColumns = columns
+	return nil
+}
+
+// withItemPath is the JSONPath of a WITH item within a resource, or within a row of a previous WITH clause
+func withItemPath(item *ReturnItem, fromRows bool) string {
+	return recordPath(item.JsonPath, fromRows)
+}
+
+// withItemValue is the value of a WITH item for a resource, or for a row of a previous WITH clause
+func withItemValue(item *ReturnItem, record map[string]interface{}, fromRows bool) (interface{}, error) {
+	path := withItemPath(item, fromRows)
+	if isValueFunction(item.Function) {
+		return evaluateValueFunction(item.Function, item.JsonPath, item.Args, record, fromRows)
+	}
+	if item.Function != "" {
+		if path != "$" || fromRows {
+			return nil, newDiagnosticError(CodeFunctionExpectsNode, nil, "function", strings.ToLower(item.Function), "argument", item.JsonPath)
+		}
+		return evaluateReturnFunction(item.Function, record)
+	}
+	if path == "$" {
+		return record, nil
+	}
+	value, err := returnPathLookup(record, path)
+	if err != nil {
+		logDebug("Path not found", "path", item.JsonPath)
+		return nil, nil
+	}
+	return value, nil
+}
+
+// withRowMatches reports whether a row of a WITH clause satisfies its WHERE clause
+func withRowMatches(row map[string]interface{}, filters []*KeyValuePair) (bool, error) {
+	for _, filter := range filters {
+		if err := validateFilter(filter); err != nil {
+			return false, err
+		}
+		if filter.Function != "" {
+			value, err := evaluateValueFunction(filter.Function, filter.Key, filter.Args, row, true)
+			if err != nil {
+				return false, err
+			}
+			if !matchesFilter(value, filter) {
+				return false, nil
+			}
+			continue
+		}
+		value, err := jsonPathLookup(row, "$."+filter.Key)
+		if err != nil || !matchesFilter(value, filter) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// leaveScope drops the nodes and rows a WITH clause doesn't pass on
+func (q *QueryExecutor) leaveScope(bound map[string]*NodePattern, keep []string) {
+	for name := range q.resultMap {
+		if !slices.Contains(keep, name) {
+			delete(q.resultMap, name)
+		}
+	}
+	for name := range bound {
+		if !slices.Contains(keep, name) {
+			delete(bound, name)
+		}
+	}
+	q.withColumns = nil
+}
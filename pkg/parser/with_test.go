@@ -0,0 +1,113 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestParseWith(t *testing.T) {
+	expr, err := ParseQuery(`MATCH (p:Pod) WITH p.spec.nodeName AS node, COUNT(p) AS pods WHERE pods > 50 RETURN node, pods`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	expected := &WithClause{
+		Items: []*ReturnItem{
+			{JsonPath: "p.spec.nodeName", Alias: "node"},
+			{JsonPath: "p", Alias: "pods", Aggregate: "COUNT"},
+		},
+		ExtraFilters: []*KeyValuePair{{Key: "pods", Value: 50, Operator: "GREATER_THAN"}},
+	}
+	if len(expr.Clauses) != 3 || !reflect.DeepEqual(expr.Clauses[1], expected) {
+		t.Errorf("unexpected WITH clause %+v", expr.Clauses)
+	}
+
+	expr, err = ParseQuery(`MATCH (d:Deployment) WITH d WHERE d.spec.replicas > 2 MATCH (d)->(h:HorizontalPodAutoscaler) RETURN h`)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	if len(expr.Clauses) != 4 {
+		t.Fatalf("expected 4 clauses, got %d", len(expr.Clauses))
+	}
+	if with := expr.Clauses[1].(*WithClause); !reflect.DeepEqual(with.Items, []*ReturnItem{{JsonPath: "d"}}) {
+		t.Errorf("expected WITH d, got %+v", with.Items)
+	}
+	if _, ok := expr.Clauses[2].(*MatchClause); !ok {
+		t.Errorf("expected a MATCH after WITH, got %T", expr.Clauses[2])
+	}
+}
+
+func TestWithGroupsRows(t *testing.T) {
+	pod := func(name, node string) runtime.Object {
+		return newTestObject("v1", "Pod", "default", name, map[string]interface{}{
+			"spec": map[string]interface{}{"nodeName": node},
+		})
+	}
+	q := newTestQueryExecutor(t,
+		pod("web-1", "node-a"), pod("web-2", "node-a"), pod("web-3", "node-a"), pod("api-1", "node-b"),
+	)
+
+	result := executeTestQuery(t, q, `MATCH (p:Pod) WITH p.spec.nodeName AS node, COUNT(p) AS pods WHERE pods > 1 RETURN node, pods`)
+	expected := []interface{}{map[string]interface{}{"node": "node-a", "pods": 3}}
+	if !reflect.DeepEqual(result.Data[withRowsNode], expected) {
+		t.Errorf("expected the busy node, got %v", result.Data[withRowsNode])
+	}
+	if result.Data["p"] != nil {
+		t.Errorf("expected the pods not to be returned, got %v", result.Data["p"])
+	}
+
+	// Rows can be grouped again and aggregated by RETURN
+	result = executeTestQuery(t, q, `MATCH (p:Pod) WITH p.spec.nodeName AS node, COUNT{p} AS pods WITH COUNT{node} AS nodes, SUM{pods} AS pods RETURN nodes, pods`)
+	expected = []interface{}{map[string]interface{}{"nodes": 2, "pods": int64(4)}}
+	if !reflect.DeepEqual(result.Data[withRowsNode], expected) {
+		t.Errorf("expected the totals, got %v", result.Data[withRowsNode])
+	}
+}
+
+func TestWithChainsMatch(t *testing.T) {
+	deployment := func(name string, replicas int64) runtime.Object {
+		return newTestObject("apps/v1", "Deployment", "default", name, map[string]interface{}{
+			"spec": map[string]interface{}{"replicas": replicas},
+		})
+	}
+	hpa := func(target string) runtime.Object {
+		return newTestObject("autoscaling/v2", "HorizontalPodAutoscaler", "default", target+"-hpa", map[string]interface{}{
+			"spec": map[string]interface{}{"scaleTargetRef": map[string]interface{}{"name": target}},
+		})
+	}
+	q := newTestQueryExecutor(t, deployment("web", 3), deployment("api", 5), deployment("worker", 1), hpa("web"), hpa("worker"))
+
+	result := executeTestQuery(t, q, `MATCH (d:Deployment) WITH d WHERE d.spec.replicas > 2 MATCH (d)->(h:HorizontalPodAutoscaler) RETURN d.metadata.name, h.metadata.name`)
+	names := func(nodeId string) []interface{} {
+		var names []interface{}
+		for _, row := range result.Data[nodeId].([]interface{}) {
+			names = append(names, row.(map[string]interface{})["name"])
+		}
+		return names
+	}
+	if got := names("d"); !reflect.DeepEqual(got, []interface{}{"web"}) {
+		t.Errorf("expected the large deployment with an autoscaler, got %v", got)
+	}
+	if got := names("h"); !reflect.DeepEqual(got, []interface{}{"web-hpa"}) {
+		t.Errorf("expected its autoscaler, got %v", got)
+	}
+}
+
+func TestWithScope(t *testing.T) {
+	q := newTestQueryExecutor(t, newTestObject("v1", "Pod", "default", "web-1", nil))
+	for query, code := range map[string]DiagnosticCode{
+		`MATCH (p:Pod) WITH p.spec.nodeName RETURN p`:                                 CodeInvalidWith,
+		`MATCH (p:Pod) WITH p, COUNT{p} AS pods RETURN pods`:                          CodeInvalidWith,
+		`MATCH (p:Pod) WITH COUNT{p} AS pods WHERE p.spec.nodeName = "a" RETURN pods`: CodeInvalidWith,
+		`MATCH (p:Pod) WITH COUNT{p} AS pods RETURN p`:                                CodeUnknownReturnNode,
+	} {
+		ast, err := ParseQuery(query)
+		if err != nil {
+			t.Fatalf("ParseQuery(%q) error = %v", query, err)
+		}
+		if _, err := q.Execute(ast, "default"); DiagnosticCodeOf(err) != code {
+			t.Errorf("%s: expected code %s, got %v", query, code, err)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+"""Client of the HTTP API served by cyphernetes web, as documented by its OpenAPI document at /api/openapi.json."""
+
+import json
+import ssl
+import urllib.error
+import urllib.parse
+import urllib.request
+from dataclasses import dataclass, field
+from typing import Any, Dict, List, Optional
+
+__all__ = ["Client", "CyphernetesError", "QueryResult"]
+
+
+@dataclass
+class QueryResult:
+    """The result of a query: the returned values keyed by node name, and their graph."""
+
+    data: Dict[str, Any]
+    graph: Dict[str, Any] = field(default_factory=dict)
+
+
+class CyphernetesError(Exception):
+    """An error response of the API. code is its diagnostic code, e.g. CYP-0020, if it has one."""
+
+    def __init__(self, status: int, message: str, code: Optional[str] = None, details: Optional[Dict[str, Any]] = None):
+        super().__init__(f"{code}: {message}" if code else message)
+        self.status = status
+        self.message = message
+        self.code = code
+        self.details = details or {}
+
+
+class Client:
+    """Sends requests to a cyphernetes web server.
+
+    token is sent as a bearer token: a static token of --token-file, or an OpenID Connect ID token. Pass an
+    ssl_context with a client certificate loaded to authenticate with one.
+    """
+
+    def __init__(self, base_url: str, token: Optional[str] = None, ssl_context: Optional[ssl.SSLContext] = None,
+                 timeout: Optional[float] = None):
+        self.base_url = base_url.rstrip("/")
+        self.token = token
+        self.ssl_context = ssl_context
+        self.timeout = timeout
+
+    def query(self, query: str) -> QueryResult:
+        response = self._request("POST", "/api/query", body={"query": query})
+        # The result and graph are JSON documents within the response
+        return QueryResult(data=json.loads(response["result"]), graph=json.loads(response["graph"]))
+
+    def autocomplete(self, query: str, position: int) -> List[str]:
+        response = self._request("GET", "/api/autocomplete", params={"query": query, "position": str(position)})
+        return response["suggestions"]
+
+    def convert_resource_name(self, name: str) -> str:
+        """Resolves a kind, plural, singular or short name to the plural name of its resource."""
+        return self._request("GET", "/api/convert-resource-name", params={"name": name})["singular"]
+
+    def _request(self, method: str, path: str, params: Optional[Dict[str, str]] = None, body: Any = None) -> Any:
+        url = self.base_url + path
+        if params:
+            url += "?" + urllib.parse.urlencode(params)
+        headers = {"Accept": "application/json"}
+        data = None
+        if body is not None:
+            data = json.dumps(body).encode()
+            headers["Content-Type"] = "application/json"
+        if self.token:
+            headers["Authorization"] = f"Bearer {self.token}"
+
+        request = urllib.request.Request(url, data=data, headers=headers, method=method)
+        try:
+            with urllib.request.urlopen(request, context=self.ssl_context, timeout=self.timeout) as response:
+                return json.load(response)
+        except urllib.error.HTTPError as e:
+            text = e.read().decode(errors="replace")
+            try:
+                error = json.loads(text)
+            except ValueError:
+                error = {}
+            if not isinstance(error, dict):
+                error = {}
+            raise CyphernetesError(e.code, error.get("error") or text or str(e.reason), error.get("code"),
+                                   error.get("details")) from None
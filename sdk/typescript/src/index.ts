@@ -0,0 +1,106 @@
+// Client of the HTTP API served by cyphernetes web, as documented by its OpenAPI document at /api/openapi.json
+
+export interface GraphNode {
+  Id: string;
+  Kind: string;
+  Name: string;
+  Namespace: string;
+}
+
+export interface GraphEdge {
+  From: string;
+  To: string;
+  Type: string;
+}
+
+export interface Graph {
+  Nodes: GraphNode[] | null;
+  Edges: GraphEdge[] | null;
+}
+
+// QueryResult is the result of a query: the returned values keyed by node name, and their graph
+export interface QueryResult {
+  data: Record<string, unknown>;
+  graph: Graph;
+}
+
+export interface ClientOptions {
+  // A static token of --token-file, or an OpenID Connect ID token
+  token?: string;
+  fetch?: typeof fetch;
+}
+
+// CyphernetesError is an error response of the API
+export class CyphernetesError extends Error {
+  constructor(
+    readonly status: number,
+    message: string,
+    // The diagnostic code of the error, e.g. CYP-0020, if it has one
+    readonly code?: string,
+    readonly details?: Record<string, unknown>,
+  ) {
+    super(code ? `${code}: ${message}` : message);
+    this.name = 'CyphernetesError';
+  }
+}
+
+export class CyphernetesClient {
+  private readonly baseUrl: string;
+  private readonly fetch: typeof fetch;
+
+  constructor(baseUrl: string, private readonly options: ClientOptions = {}) {
+    this.baseUrl = baseUrl.replace(/\/+$/, '');
+    this.fetch = options.fetch ?? globalThis.fetch.bind(globalThis);
+  }
+
+  async query(query: string): Promise<QueryResult> {
+    const response = await this.request<{ result: string; graph: string }>('POST', '/api/query', undefined, { query });
+    // The result and graph are JSON documents within the response
+    return { data: JSON.parse(response.result), graph: JSON.parse(response.graph) };
+  }
+
+  async autocomplete(query: string, position: number): Promise<string[]> {
+    const response = await this.request<{ suggestions: string[] }>('GET', '/api/autocomplete', {
+      query,
+      position: String(position),
+    });
+    return response.suggestions;
+  }
+
+  // convertResourceName resolves a kind, plural, singular or short name to the plural name of its resource
+  async convertResourceName(name: string): Promise<string> {
+    const response = await this.request<{ singular: string }>('GET', '/api/convert-resource-name', { name });
+    return response.singular;
+  }
+
+  private async request<T>(method: string, path: string, params?: Record<string, string>, body?: unknown): Promise<T> {
+    let url = this.baseUrl + path;
+    if (params) {
+      url += '?' + new URLSearchParams(params).toString();
+    }
+    const headers: Record<string, string> = { Accept: 'application/json' };
+    if (body !== undefined) {
+      headers['Content-Type'] = 'application/json';
+    }
+    if (this.options.token) {
+      headers['Authorization'] = `Bearer ${this.options.token}`;
+    }
+
+    const response = await this.fetch(url, {
+      method,
+      headers,
+      body: body === undefined ? undefined : JSON.stringify(body),
+    });
+    const text = await response.text();
+    if (!response.ok) {
+      let error: { error?: string; code?: string; details?: Record<string, unknown> } = {};
+      try {
+        error = JSON.parse(text);
+      } catch {
+        // Not a JSON error response
+      }
+      throw new CyphernetesError(response.status, error.error || text || response.statusText, error.code, error.details);
+    }
+    return JSON.parse(text) as T;
+  }
+}
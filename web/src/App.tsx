@@ -2,6 +2,10 @@ import React, { useState, useCallback, useRef, useEffect } from 'react';
 import QueryInput from './components/QueryInput';
 import ResultsDisplay from './components/ResultsDisplay';
 import GraphVisualization from './components/GraphVisualization';
+import ResultsTable from './components/ResultsTable';
+import SchemaBrowser from './components/SchemaBrowser';
+import Dashboards from './components/Dashboards';
+import { buildPermalink, readPermalink, isReadOnlyQuery, ResultView } from './permalink';
 import { executeQuery, QueryResponse } from './api/queryApi';
 import './App.css';
 
@@ -31,6 +35,13 @@ function App() {
   const [aggregateResults, setAggregateResults] = useState<AggregateResult>({});
   const [filterManagedFields, setFilterManagedFields] = useState(true);
   const [darkTheme, setDarkTheme] = useState(false);
+  const [permalink] = useState(() => readPermalink());
+  const [view, setView] = useState<ResultView>(permalink?.view ?? 'graph');
+  const [editorSeed, setEditorSeed] = useState({ query: permalink?.query ?? '', key: 0 });
+  const [currentQuery, setCurrentQuery] = useState(editorSeed.query);
+  const [isSchemaOpen, setIsSchemaOpen] = useState(false);
+  const [isDashboardsOpen, setIsDashboardsOpen] = useState(false);
+  const [shareStatus, setShareStatus] = useState<string | null>(null);
 
   useEffect(() => {
     const handleKeyDown = (e: KeyboardEvent) => {
@@ -55,6 +66,12 @@ function App() {
     }
   }, [filterManagedFields, originalQueryResult]);
 
+  useEffect(() => {
+    if (permalink && isReadOnlyQuery(permalink.query)) {
+      handleQuerySubmit(permalink.query, null);
+    }
+  }, []);
+
   const handleQuerySubmit = async (query: string, selectedText: string | null) => {
     setIsLoading(true);
     setError(null);
@@ -234,6 +251,22 @@ function App() {
     }
   }, [originalQueryResult, filterResults]);
 
+  const handleShare = async () => {
+    const link = buildPermalink({ query: currentQuery, view });
+    window.history.replaceState(null, '', link);
+    try {
+      await navigator.clipboard.writeText(link);
+      setShareStatus('Link copied');
+    } catch (err) {
+      setShareStatus('Link in address bar');
+    }
+    setTimeout(() => setShareStatus(null), 2000);
+  };
+
+  const handleSchemaQuery = (query: string) => {
+    setEditorSeed(prev => ({ query, key: prev.key + 1 }));
+  };
+
   const hasResults = originalQueryResult && originalQueryResult.result && Object.keys(JSON.parse(originalQueryResult.result)).length > 0;
 
   return (
@@ -286,6 +319,9 @@ function App() {
         </button>
         <div className="query-input">
           <QueryInput
+            key={editorSeed.key}
+            initialQuery={editorSeed.query}
+            onQueryChange={setCurrentQuery}
             onSubmit={handleQuerySubmit}
             isLoading={isLoading}
             queryStatus={queryStatus}
@@ -295,12 +331,33 @@ function App() {
           />
         </div>
         <div className="graph-visualization">
-          <GraphVisualization 
-            ref={graphRef}
-            data={originalQueryResult?.graph ?? null} 
-            onNodeHover={handleNodeHover}
-          />
+          <div className="view-toolbar">
+            <button className={view === 'graph' ? 'active' : ''} onClick={() => setView('graph')}>Graph</button>
+            <button className={view === 'table' ? 'active' : ''} onClick={() => setView('table')}>Table</button>
+            <button onClick={() => setIsSchemaOpen(true)}>Schema</button>
+            <button onClick={() => setIsDashboardsOpen(true)}>Dashboards</button>
+            <button onClick={handleShare} disabled={!currentQuery.trim()}>{shareStatus ?? 'Share'}</button>
+          </div>
+          {view === 'graph' ? (
+            <GraphVisualization 
+              ref={graphRef}
+              data={originalQueryResult?.graph ?? null} 
+              onNodeHover={handleNodeHover}
+            />
+          ) : (
+            <ResultsTable result={filteredResult} />
+          )}
         </div>
+        <SchemaBrowser
+          isOpen={isSchemaOpen}
+          onClose={() => setIsSchemaOpen(false)}
+          onSelectQuery={handleSchemaQuery}
+        />
+        <Dashboards
+          isOpen={isDashboardsOpen}
+          onClose={() => setIsDashboardsOpen(false)}
+          currentQuery={currentQuery}
+        />
       </div>
     </div>
   );
@@ -9,6 +9,11 @@ vi.mock('../api/queryApi', () => ({
   executeQuery: vi.fn(),
   fetchAutocompleteSuggestions: vi.fn().mockResolvedValue([]),
   convertResourceName: vi.fn().mockResolvedValue(''),
+  fetchSchema: vi.fn().mockResolvedValue({ kinds: [], relationships: [] }),
+  fetchDashboards: vi.fn().mockResolvedValue([]),
+  saveDashboard: vi.fn(),
+  deleteDashboard: vi.fn(),
+  watchQuery: vi.fn().mockReturnValue(() => {}),
 }));
 
 // Mock child components
@@ -0,0 +1,34 @@
+import { expect, test, describe } from 'vitest';
+import { buildPermalink, readPermalink, isReadOnlyQuery } from '../permalink';
+
+const location = { origin: 'http://localhost:8080', pathname: '/' };
+
+describe('permalink', () => {
+  test('round trips a query and its view', () => {
+    const link = buildPermalink({ query: 'MATCH (d:Deployment) RETURN d.metadata.name', view: 'table' }, location);
+    expect(link.startsWith('http://localhost:8080/?')).toBe(true);
+    expect(readPermalink(link.slice(link.indexOf('?')))).toEqual({
+      query: 'MATCH (d:Deployment) RETURN d.metadata.name',
+      view: 'table',
+    });
+  });
+
+  test('leaves out the default graph view', () => {
+    const link = buildPermalink({ query: 'MATCH (p:Pod) RETURN p', view: 'graph' }, location);
+    expect(link).not.toContain('view=');
+    expect(readPermalink(link.slice(link.indexOf('?')))?.view).toBe('graph');
+  });
+
+  test('ignores pages without a query', () => {
+    expect(readPermalink('')).toBeNull();
+    expect(readPermalink('?view=table')).toBeNull();
+  });
+
+  test('tells read-only queries apart', () => {
+    expect(isReadOnlyQuery('MATCH (d:Deployment) RETURN d')).toBe(true);
+    expect(isReadOnlyQuery('MATCH (d:Deployment {name: "delete-me"}) RETURN d')).toBe(true);
+    expect(isReadOnlyQuery('MATCH (d:Deployment) SET d.spec.replicas = 2')).toBe(false);
+    expect(isReadOnlyQuery('match (p:Pod) delete p')).toBe(false);
+    expect(isReadOnlyQuery('CREATE (d:Deployment {"name": "x"})')).toBe(false);
+  });
+});
@@ -4,15 +4,19 @@ export interface QueryResponse {
   result: string;
   graph: string;
   error?: string;
+  acknowledged?: number;
+  rows?: string;
 }
 
-export async function executeQuery(query: string): Promise<QueryResponse> {
+// Run a query, as a report of rule if it's given, which leaves out the findings acknowledged for it. Scheduled
+// queries, run again on a timer, yield to those users run when the server is busy.
+export async function executeQuery(query: string, rule?: string, scheduled?: boolean): Promise<QueryResponse> {
   const response = await fetch('/api/query', {
     method: 'POST',
     headers: {
       'Content-Type': 'application/json',
     },
-    body: JSON.stringify({ query }),
+    body: JSON.stringify({ query, ...(rule ? { rule } : {}), ...(scheduled ? { scheduled } : {}) }),
   });
 
   if (!response.ok) {
@@ -78,4 +82,158 @@ async function convertQueryResourceNames(query: string): Promise<string> {
   }
 
   return query;
-}
\ No newline at end of file
+}
+
+export interface SchemaKind {
+  kind: string;
+  resource: string;
+  group: string;
+  version: string;
+  namespaced: boolean;
+  shortNames?: string[];
+}
+
+export interface SchemaRelationship {
+  kindA: string;
+  kindB: string;
+  type: string;
+}
+
+export interface Schema {
+  kinds: SchemaKind[];
+  relationships: SchemaRelationship[];
+}
+
+// Fetch the kinds of the cluster and the relationships between them
+export async function fetchSchema(): Promise<Schema> {
+  const response = await fetch('/api/schema', {
+    method: 'GET',
+    headers: {
+      'Content-Type': 'application/json',
+    },
+  });
+
+  if (!response.ok) {
+    const data = await response.json();
+    throw new Error(data.error);
+  }
+
+  return response.json();
+}
+
+export type PanelType = 'table' | 'graph' | 'stat';
+
+export interface DashboardPanel {
+  title: string;
+  query: string;
+  type: PanelType;
+  rule?: string;
+}
+
+export interface Dashboard {
+  id?: string;
+  title: string;
+  owner?: string;
+  roles?: string[];
+  refreshSeconds?: number;
+  panels: DashboardPanel[];
+  updatedAt?: string;
+}
+
+async function storeRequest<T>(method: string, path: string, body?: object): Promise<T> {
+  const response = await fetch(path, {
+    method,
+    headers: {
+      'Content-Type': 'application/json',
+    },
+    body: body ? JSON.stringify(body) : undefined,
+  });
+
+  if (!response.ok) {
+    const data = await response.json();
+    throw new Error(data.error);
+  }
+
+  return response.status === 204 ? (undefined as T) : response.json();
+}
+
+// The saved dashboards the user may see
+export function fetchDashboards(): Promise<Dashboard[]> {
+  return storeRequest('GET', '/api/dashboards');
+}
+
+// Save a new dashboard, or change an existing one
+export function saveDashboard(dashboard: Dashboard): Promise<Dashboard> {
+  if (dashboard.id) {
+    return storeRequest('PUT', `/api/dashboards/${encodeURIComponent(dashboard.id)}`, dashboard);
+  }
+  return storeRequest('POST', '/api/dashboards', dashboard);
+}
+
+export function deleteDashboard(id: string): Promise<void> {
+  return storeRequest('DELETE', `/api/dashboards/${encodeURIComponent(id)}`);
+}
+
+// Watch the rows of a query, calling onChange with all of them whenever one changes. Returns a function that
+// stops watching, onError is called when the query can't be watched.
+export function watchQuery(
+  query: string,
+  onChange: (rows: { [key: string]: any }) => void,
+  onError: () => void,
+): () => void {
+  const source = new EventSource(`/api/watch?query=${encodeURIComponent(query)}`);
+  const rows: { [key: string]: any } = {};
+  let synced = false;
+  const handle = (type: string) => (event: MessageEvent) => {
+    const data = JSON.parse(event.data);
+    if (type === 'deleted') {
+      delete rows[data.key];
+    } else {
+      rows[data.key] = data.data;
+    }
+    if (synced) onChange({ ...rows });
+  };
+  source.addEventListener('added', handle('added'));
+  source.addEventListener('modified', handle('modified'));
+  source.addEventListener('deleted', handle('deleted'));
+  source.addEventListener('reset', () => {
+    synced = false;
+    for (const key of Object.keys(rows)) delete rows[key];
+  });
+  source.addEventListener('synced', () => {
+    synced = true;
+    onChange({ ...rows });
+  });
+  source.onerror = () => {
+    // Before the first sync the query can't be watched, later errors are retried by the browser
+    if (!synced) {
+      source.close();
+      onError();
+    }
+  };
+  return () => source.close();
+}
+
+export interface Acknowledgement {
+  id?: string;
+  uid: string;
+  rule: string;
+  justification: string;
+  expiresAt?: string;
+  by?: string;
+  createdAt?: string;
+}
+
+// The acknowledged findings that haven't expired, of a rule or of every rule
+export function fetchAcknowledgements(rule?: string): Promise<Acknowledgement[]> {
+  return storeRequest('GET', rule ? `/api/acknowledgements?rule=${encodeURIComponent(rule)}` : '/api/acknowledgements');
+}
+
+// Hide a finding from the reports of its rule, until the acknowledgement expires or is revoked
+export function acknowledgeFinding(acknowledgement: Acknowledgement): Promise<Acknowledgement> {
+  return storeRequest('POST', '/api/acknowledgements', acknowledgement);
+}
+
+export function revokeAcknowledgement(id: string): Promise<void> {
+  return storeRequest('DELETE', `/api/acknowledgements/${encodeURIComponent(id)}`);
+}
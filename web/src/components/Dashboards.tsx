@@ -0,0 +1,281 @@
+import React, { useState, useEffect } from 'react';
+import {
+  executeQuery,
+  fetchDashboards,
+  saveDashboard,
+  deleteDashboard,
+  watchQuery,
+  acknowledgeFinding,
+  Dashboard,
+  DashboardPanel,
+  PanelType,
+} from '../api/queryApi';
+import ResultsTable, { Row } from './ResultsTable';
+import GraphVisualization from './GraphVisualization';
+import './Dashboards.css';
+
+interface DashboardsProps {
+  isOpen: boolean;
+  onClose: () => void;
+  currentQuery: string;
+}
+
+// The value a stat panel shows: the first aggregate of the result, or else its number of rows
+export function statValue(result: any): string {
+  if (result?.aggregate && typeof result.aggregate === 'object') {
+    const [value] = Object.entries(result.aggregate).filter(([key]) => key !== '_provenance').map(([, v]) => v);
+    if (value !== undefined) {
+      return typeof value === 'object' ? JSON.stringify(value) : String(value);
+    }
+  }
+  const rows = Object.entries(result ?? {})
+    .filter(([key]) => key !== 'aggregate')
+    .reduce((count, [, value]) => Math.max(count, Array.isArray(value) ? value.length : 0), 0);
+  return String(rows);
+}
+
+// The time an acknowledgement for a number of days expires at, or none for 0 days
+export function expiryAfterDays(days: number, now: Date = new Date()): string | undefined {
+  if (!(days > 0)) return undefined;
+  return new Date(now.getTime() + days * 24 * 60 * 60 * 1000).toISOString();
+}
+
+export function parseRoles(roles: string): string[] {
+  return roles.split(',').map(role => role.trim()).filter(role => role !== '');
+}
+
+interface PanelViewProps {
+  panel: DashboardPanel;
+  refreshSeconds: number;
+}
+
+// A panel watches its query when it can, and otherwise runs it again every refreshSeconds. Reports, panels with a
+// rule, are always run again as acknowledged findings are left out by the server.
+const PanelView: React.FC<PanelViewProps> = ({ panel, refreshSeconds }) => {
+  const [result, setResult] = useState<string | null>(null);
+  const [acknowledged, setAcknowledged] = useState(0);
+  const [runs, setRuns] = useState(0);
+  const [graph, setGraph] = useState<string | null>(null);
+  const [error, setError] = useState<string | null>(null);
+  const [isLive, setIsLive] = useState(false);
+
+  useEffect(() => {
+    let timer: ReturnType<typeof setInterval> | undefined;
+    let stopWatching: (() => void) | undefined;
+    let cancelled = false;
+
+    const run = async (scheduled = false) => {
+      try {
+        const response = await executeQuery(panel.query, panel.rule, scheduled);
+        if (cancelled) return;
+        setResult(response.result);
+        setAcknowledged(response.acknowledged ?? 0);
+        setGraph(response.graph);
+        setError(null);
+      } catch (err: any) {
+        if (!cancelled) setError(err.message);
+      }
+    };
+    const poll = () => {
+      setIsLive(false);
+      run();
+      if (refreshSeconds > 0) {
+        timer = setInterval(() => run(true), refreshSeconds * 1000);
+      }
+    };
+
+    // Graphs need the relationships of the whole result, which a watch doesn't send
+    if (panel.type === 'graph' || panel.rule) {
+      poll();
+    } else {
+      stopWatching = watchQuery(
+        panel.query,
+        rows => {
+          setIsLive(true);
+          setError(null);
+          setResult(JSON.stringify({ rows: Object.values(rows) }));
+        },
+        poll,
+      );
+    }
+
+    return () => {
+      cancelled = true;
+      stopWatching?.();
+      if (timer) clearInterval(timer);
+    };
+  }, [panel.query, panel.type, panel.rule, refreshSeconds, runs]);
+
+  const acknowledge = async (row: Row) => {
+    const justification = window.prompt('Why is this finding acknowledged?');
+    if (!justification) return;
+    const days = Number(window.prompt('Report it again after how many days? (0 for never)', '30'));
+    try {
+      await acknowledgeFinding({ uid: row._uid, rule: panel.rule!, justification, expiresAt: expiryAfterDays(days) });
+      setRuns(r => r + 1);
+    } catch (err: any) {
+      setError(err.message);
+    }
+  };
+
+  let content: React.ReactNode;
+  if (error) {
+    content = <div className="dashboard-panel-error">{error}</div>;
+  } else if (panel.type === 'stat') {
+    content = <div className="dashboard-stat">{result ? statValue(JSON.parse(result)) : '…'}</div>;
+  } else if (panel.type === 'graph') {
+    content = <GraphVisualization data={graph} onNodeHover={() => {}} />;
+  } else {
+    content = <ResultsTable result={result} onAcknowledge={panel.rule ? acknowledge : undefined} />;
+  }
+
+  return (
+    <div className={`dashboard-panel dashboard-panel-${panel.type}`}>
+      <div className="dashboard-panel-header">
+        <span>{panel.title}</span>
+        <span className="dashboard-panel-mode">
+          {acknowledged > 0 && `${acknowledged} acknowledged · `}
+          {isLive ? 'live' : refreshSeconds > 0 ? `every ${refreshSeconds}s` : ''}
+        </span>
+      </div>
+      <div className="dashboard-panel-content">{content}</div>
+    </div>
+  );
+};
+
+const Dashboards: React.FC<DashboardsProps> = ({ isOpen, onClose, currentQuery }) => {
+  const [dashboards, setDashboards] = useState<Dashboard[]>([]);
+  const [selected, setSelected] = useState<Dashboard | null>(null);
+  const [error, setError] = useState<string | null>(null);
+  const [newTitle, setNewTitle] = useState('');
+  const [newRoles, setNewRoles] = useState('');
+  const [newRefresh, setNewRefresh] = useState(30);
+  const [panelTitle, setPanelTitle] = useState('');
+  const [panelType, setPanelType] = useState<PanelType>('table');
+  const [panelRule, setPanelRule] = useState('');
+
+  const load = async () => {
+    try {
+      setDashboards(await fetchDashboards());
+      setError(null);
+    } catch (err: any) {
+      setError('Failed to load dashboards: ' + err.message);
+    }
+  };
+
+  useEffect(() => {
+    if (isOpen) load();
+  }, [isOpen]);
+
+  if (!isOpen) return null;
+
+  const save = async (dashboard: Dashboard) => {
+    try {
+      const saved = await saveDashboard(dashboard);
+      setSelected(saved);
+      setError(null);
+      await load();
+    } catch (err: any) {
+      setError('Failed to save the dashboard: ' + err.message);
+    }
+  };
+
+  const create = () => {
+    if (!newTitle.trim()) return;
+    save({ title: newTitle.trim(), roles: parseRoles(newRoles), refreshSeconds: newRefresh, panels: [] });
+    setNewTitle('');
+    setNewRoles('');
+  };
+
+  const addPanel = () => {
+    if (!selected || !currentQuery.trim()) return;
+    const panel: DashboardPanel = { title: panelTitle.trim() || `Panel ${selected.panels.length + 1}`, query: currentQuery, type: panelType };
+    if (panelRule.trim()) {
+      panel.rule = panelRule.trim();
+    }
+    save({ ...selected, panels: [...selected.panels, panel] });
+    setPanelTitle('');
+    setPanelRule('');
+  };
+
+  const removePanel = (index: number) => {
+    if (!selected) return;
+    save({ ...selected, panels: selected.panels.filter((_, i) => i !== index) });
+  };
+
+  const remove = async () => {
+    if (!selected?.id) return;
+    try {
+      await deleteDashboard(selected.id);
+      setSelected(null);
+      await load();
+    } catch (err: any) {
+      setError('Failed to delete the dashboard: ' + err.message);
+    }
+  };
+
+  return (
+    <div className="dashboards-overlay" onClick={onClose}>
+      <div className="dashboards" onClick={e => e.stopPropagation()} onKeyDown={e => e.key === 'Escape' && onClose()}>
+        <div className="dashboards-sidebar">
+          <h2>Dashboards</h2>
+          <ul className="dashboards-list">
+            {dashboards.map(dashboard => (
+              <li
+                key={dashboard.id}
+                className={selected?.id === dashboard.id ? 'selected' : ''}
+                onClick={() => setSelected(dashboard)}
+              >
+                {dashboard.title}
+                {dashboard.owner && <span className="dashboards-owner">{dashboard.owner}</span>}
+              </li>
+            ))}
+          </ul>
+          <div className="dashboards-form">
+            <input type="text" placeholder="New dashboard title" value={newTitle} onChange={e => setNewTitle(e.target.value)} />
+            <input type="text" placeholder="Shared with roles, e.g. sre, dev" value={newRoles} onChange={e => setNewRoles(e.target.value)} />
+            <label>
+              Refresh every
+              <input type="number" min={0} value={newRefresh} onChange={e => setNewRefresh(Number(e.target.value))} />
+              s
+            </label>
+            <button onClick={create} disabled={!newTitle.trim()}>Create</button>
+          </div>
+        </div>
+        <div className="dashboards-main">
+          {error && <div className="dashboards-error">{error}</div>}
+          {!selected && <div className="dashboards-empty">Pick a dashboard, or create one</div>}
+          {selected && (
+            <>
+              <div className="dashboards-header">
+                <h2>{selected.title}</h2>
+                {(selected.roles ?? []).length > 0 && <span className="dashboards-roles">{selected.roles!.join(', ')}</span>}
+                <button onClick={remove}>Delete</button>
+              </div>
+              <div className="dashboards-form dashboards-add-panel">
+                <input type="text" placeholder="Panel title" value={panelTitle} onChange={e => setPanelTitle(e.target.value)} />
+                <select value={panelType} onChange={e => setPanelType(e.target.value as PanelType)}>
+                  <option value="table">Table</option>
+                  <option value="graph">Graph</option>
+                  <option value="stat">Stat</option>
+                </select>
+                <input type="text" placeholder="Rule, to report findings" value={panelRule} onChange={e => setPanelRule(e.target.value)} />
+                <button onClick={addPanel} disabled={!currentQuery.trim()} title={currentQuery}>Add current query</button>
+              </div>
+              <div className="dashboard-panels">
+                {selected.panels.map((panel, index) => (
+                  <div key={`${selected.id}-${index}`} className="dashboard-panel-container">
+                    <PanelView panel={panel} refreshSeconds={selected.refreshSeconds ?? 0} />
+                    <button className="dashboard-panel-remove" onClick={() => removePanel(index)}>×</button>
+                  </div>
+                ))}
+              </div>
+            </>
+          )}
+        </div>
+      </div>
+    </div>
+  );
+};
+
+export default Dashboards;
@@ -16,6 +16,8 @@ interface QueryInputProps {
   isHistoryModalOpen: boolean;
   setIsHistoryModalOpen: (isOpen: boolean) => void;
   isPanelOpen: boolean;
+  initialQuery?: string;
+  onQueryChange?: (query: string) => void;
 }
 
 const QueryInput: React.FC<QueryInputProps> = ({ 
@@ -24,9 +26,11 @@ const QueryInput: React.FC<QueryInputProps> = ({
   queryStatus, 
   isHistoryModalOpen, 
   setIsHistoryModalOpen,
-  isPanelOpen
+  isPanelOpen,
+  initialQuery = '',
+  onQueryChange
 }) => {
-  const [query, setQuery] = useState('');
+  const [query, setQuery] = useState(initialQuery);
   const [suggestions, setSuggestions] = useState<string[]>([]);
   const [cursorPosition, setCursorPosition] = useState(0);
   const [selectedSuggestionIndex, setSelectedSuggestionIndex] = useState(-1);
@@ -44,6 +48,10 @@ const QueryInput: React.FC<QueryInputProps> = ({
     }
   }, []);
 
+  useEffect(() => {
+    onQueryChange?.(query);
+  }, [query, onQueryChange]);
+
   const saveQueryToHistory = (newQuery: string) => {
     const updatedHistory = [newQuery, ...queryHistory.filter(q => q !== newQuery)].slice(0, 1000);
     setQueryHistory(updatedHistory);
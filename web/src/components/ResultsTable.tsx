@@ -0,0 +1,89 @@
+import React from 'react';
+import './ResultsTable.css';
+
+export type Row = { [column: string]: any };
+
+interface ResultsTableProps {
+  result: string | null;
+  // Called to acknowledge the finding of a row of a report, which carries the UID of its resource in _uid
+  onAcknowledge?: (row: Row) => void;
+}
+
+// Flatten nested objects into dotted columns, e.g. metadata.name, lists are shown as JSON
+export function flattenRow(value: any, prefix = '', row: Row = {}): Row {
+  if (value && typeof value === 'object' && !Array.isArray(value)) {
+    for (const [key, child] of Object.entries(value)) {
+      flattenRow(child, prefix ? `${prefix}.${key}` : key, row);
+    }
+  } else {
+    row[prefix || 'value'] = value;
+  }
+  return row;
+}
+
+// Tables of a query result, one per node with the rows of its resources
+export function resultTables(result: any): { name: string; columns: string[]; rows: Row[] }[] {
+  return Object.entries(result ?? {}).map(([name, value]) => {
+    const items = Array.isArray(value) ? value : [value];
+    const rows = items.map(item => flattenRow(item));
+    const columns: string[] = [];
+    for (const row of rows) {
+      for (const column of Object.keys(row)) {
+        if (column !== '_uid' && !columns.includes(column)) {
+          columns.push(column);
+        }
+      }
+    }
+    return { name, columns, rows };
+  });
+}
+
+function formatCell(value: any): string {
+  if (value === undefined || value === null) {
+    return '';
+  }
+  return typeof value === 'object' ? JSON.stringify(value) : String(value);
+}
+
+const ResultsTable: React.FC<ResultsTableProps> = ({ result, onAcknowledge }) => {
+  if (!result) return <div className="results-table results-table-empty">No results yet</div>;
+
+  let tables;
+  try {
+    tables = resultTables(JSON.parse(result));
+  } catch (e) {
+    return <div className="results-table results-table-empty">{result}</div>;
+  }
+
+  return (
+    <div className="results-table">
+      {tables.map(table => (
+        <div key={table.name} className="results-table-node">
+          <h3>{table.name} <span className="results-table-count">{table.rows.length}</span></h3>
+          <table>
+            <thead>
+              <tr>
+                {table.columns.map(column => <th key={column}>{column}</th>)}
+                {onAcknowledge && <th />}
+              </tr>
+            </thead>
+            <tbody>
+              {table.rows.map((row, index) => (
+                <tr key={index}>
+                  {table.columns.map(column => <td key={column}>{formatCell(row[column])}</td>)}
+                  {onAcknowledge && (
+                    <td>
+                      {row._uid && <button className="results-table-acknowledge" onClick={() => onAcknowledge(row)}>Acknowledge</button>}
+                    </td>
+                  )}
+                </tr>
+              ))}
+            </tbody>
+          </table>
+        </div>
+      ))}
+    </div>
+  );
+};
+
+export default ResultsTable;
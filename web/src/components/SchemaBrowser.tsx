@@ -0,0 +1,122 @@
+import React, { useState, useEffect, useRef } from 'react';
+import { fetchSchema, Schema, SchemaKind } from '../api/queryApi';
+import './SchemaBrowser.css';
+
+interface SchemaBrowserProps {
+  isOpen: boolean;
+  onClose: () => void;
+  onSelectQuery: (query: string) => void;
+}
+
+// The name of a node of a kind in a query, e.g. rs for ReplicaSet
+export function nodeName(kind: string): string {
+  const initials = kind.replace(/[^A-Z]/g, '').toLowerCase();
+  return initials || kind.charAt(0).toLowerCase();
+}
+
+export function kindQuery(kind: string): string {
+  const name = nodeName(kind);
+  return `MATCH (${name}:${kind})\nRETURN ${name}.metadata.name`;
+}
+
+export function relationshipQuery(from: string, to: string): string {
+  let fromName = nodeName(from);
+  let toName = nodeName(to);
+  if (fromName === toName) {
+    fromName += '1';
+    toName += '2';
+  }
+  return `MATCH (${fromName}:${from})->(${toName}:${to})\nRETURN ${fromName}.metadata.name, ${toName}.metadata.name`;
+}
+
+const SchemaBrowser: React.FC<SchemaBrowserProps> = ({ isOpen, onClose, onSelectQuery }) => {
+  const [schema, setSchema] = useState<Schema | null>(null);
+  const [error, setError] = useState<string | null>(null);
+  const [searchTerm, setSearchTerm] = useState('');
+  const [selectedKind, setSelectedKind] = useState<SchemaKind | null>(null);
+  const searchInputRef = useRef<HTMLInputElement>(null);
+
+  useEffect(() => {
+    if (!isOpen) return;
+    searchInputRef.current?.focus();
+    if (schema) return;
+    fetchSchema()
+      .then(setSchema)
+      .catch(err => setError('Failed to load the schema: ' + err.message));
+  }, [isOpen, schema]);
+
+  if (!isOpen) return null;
+
+  const kinds = (schema?.kinds ?? []).filter(kind => {
+    const term = searchTerm.toLowerCase();
+    return kind.kind.toLowerCase().includes(term) ||
+      kind.resource.includes(term) ||
+      (kind.shortNames ?? []).some(shortName => shortName.includes(term));
+  });
+  const relationships = selectedKind
+    ? (schema?.relationships ?? []).filter(r => r.kindA === selectedKind.kind || r.kindB === selectedKind.kind)
+    : [];
+
+  const select = (query: string) => {
+    onSelectQuery(query);
+    onClose();
+  };
+
+  return (
+    <div className="schema-browser-overlay" onClick={onClose}>
+      <div className="schema-browser" onClick={e => e.stopPropagation()} onKeyDown={e => e.key === 'Escape' && onClose()}>
+        <h2>Schema</h2>
+        <input
+          ref={searchInputRef}
+          type="text"
+          placeholder="Search kinds..."
+          value={searchTerm}
+          onChange={e => setSearchTerm(e.target.value)}
+          className="schema-search-input"
+        />
+        {error && <div className="schema-error">{error}</div>}
+        {!schema && !error && <div className="schema-loading">Loading...</div>}
+        <div className="schema-columns">
+          <ul className="schema-kinds">
+            {kinds.map(kind => (
+              <li
+                key={`${kind.group}/${kind.kind}`}
+                className={selectedKind === kind ? 'selected' : ''}
+                onClick={() => setSelectedKind(kind)}
+              >
+                {kind.kind}
+                <span className="schema-kind-group">{kind.group || 'core'}/{kind.version}</span>
+              </li>
+            ))}
+          </ul>
+          {selectedKind && (
+            <div className="schema-details">
+              <h3>{selectedKind.kind}</h3>
+              <p>
+                {selectedKind.resource}
+                {(selectedKind.shortNames ?? []).length > 0 && ` (${selectedKind.shortNames!.join(', ')})`}
+                {selectedKind.namespaced ? ', namespaced' : ', cluster-scoped'}
+              </p>
+              <button onClick={() => select(kindQuery(selectedKind.kind))}>Query {selectedKind.kind}</button>
+              <h4>Relationships</h4>
+              {relationships.length === 0 && <p className="schema-none">None</p>}
+              <ul className="schema-relationships">
+                {relationships.map(relationship => {
+                  const other = relationship.kindA === selectedKind.kind ? relationship.kindB : relationship.kindA;
+                  return (
+                    <li key={relationship.type} onClick={() => select(relationshipQuery(selectedKind.kind, other))}>
+                      {other}
+                      <span className="schema-relationship-type">{relationship.type}</span>
+                    </li>
+                  );
+                })}
+              </ul>
+            </div>
+          )}
+        </div>
+      </div>
+    </div>
+  );
+};
+
+export default SchemaBrowser;
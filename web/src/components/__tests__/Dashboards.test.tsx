@@ -0,0 +1,25 @@
+import { expect, test, describe } from 'vitest';
+import { statValue, parseRoles, expiryAfterDays } from '../Dashboards';
+
+describe('Dashboards Component', () => {
+  test('shows the first aggregate of a result as a stat', () => {
+    expect(statValue({ p: [{ name: 'web' }], aggregate: { 'count:p': 12, 'sum:p.spec.replicas': 3 } })).toBe('12');
+  });
+
+  test('shows the number of rows of a result without aggregates', () => {
+    expect(statValue({ p: [{ name: 'a' }, { name: 'b' }], d: [{ name: 'c' }] })).toBe('2');
+    expect(statValue({})).toBe('0');
+  });
+
+  test('reads the roles a dashboard is shared with', () => {
+    expect(parseRoles(' sre, dev ,,')).toEqual(['sre', 'dev']);
+    expect(parseRoles('')).toEqual([]);
+  });
+
+  test('computes when an acknowledgement expires', () => {
+    const now = new Date('2026-01-01T00:00:00Z');
+    expect(expiryAfterDays(30, now)).toBe('2026-01-31T00:00:00.000Z');
+    expect(expiryAfterDays(0, now)).toBeUndefined();
+    expect(expiryAfterDays(NaN, now)).toBeUndefined();
+  });
+});
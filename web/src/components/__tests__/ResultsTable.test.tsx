@@ -0,0 +1,36 @@
+import React from 'react';
+import { render, screen } from '@testing-library/react';
+import { expect, test, describe } from 'vitest';
+import ResultsTable, { flattenRow, resultTables } from '../ResultsTable';
+
+describe('ResultsTable Component', () => {
+  test('flattens nested fields into dotted columns', () => {
+    expect(flattenRow({ name: 'nginx', metadata: { labels: { app: 'web' } }, ports: [80] })).toEqual({
+      name: 'nginx',
+      'metadata.labels.app': 'web',
+      ports: [80],
+    });
+  });
+
+  test('builds a table per node with the columns of all rows', () => {
+    const tables = resultTables({
+      d: [{ name: 'a', replicas: 1 }, { name: 'b', paused: true }],
+    });
+    expect(tables).toHaveLength(1);
+    expect(tables[0].name).toBe('d');
+    expect(tables[0].columns).toEqual(['name', 'replicas', 'paused']);
+    expect(tables[0].rows).toHaveLength(2);
+  });
+
+  test('renders the rows of a result', () => {
+    render(<ResultsTable result={JSON.stringify({ d: [{ name: 'nginx', spec: { replicas: 3 } }] })} />);
+    expect(screen.getByText('spec.replicas')).toBeDefined();
+    expect(screen.getByText('nginx')).toBeDefined();
+    expect(screen.getByText('3')).toBeDefined();
+  });
+
+  test('renders a placeholder without results', () => {
+    render(<ResultsTable result={null} />);
+    expect(screen.getByText('No results yet')).toBeDefined();
+  });
+});
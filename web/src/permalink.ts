@@ -0,0 +1,34 @@
+// Permalinks share a query, and how its result is shown, as parameters of the page's URL
+
+export type ResultView = 'graph' | 'table';
+
+export interface PermalinkState {
+  query: string;
+  view: ResultView;
+}
+
+export function buildPermalink(state: PermalinkState, location: { origin: string; pathname: string } = window.location): string {
+  const params = new URLSearchParams();
+  params.set('query', state.query);
+  if (state.view !== 'graph') {
+    params.set('view', state.view);
+  }
+  return `${location.origin}${location.pathname}?${params.toString()}`;
+}
+
+export function readPermalink(search: string = window.location.search): PermalinkState | null {
+  const params = new URLSearchParams(search);
+  const query = params.get('query');
+  if (!query) {
+    return null;
+  }
+  return {
+    query,
+    view: params.get('view') === 'table' ? 'table' : 'graph',
+  };
+}
+
+// Shared queries only run when opened if they can't change anything, others wait for the reader to run them
+export function isReadOnlyQuery(query: string): boolean {
+  return !/\b(SET|DELETE|CREATE|MERGE|APPLY)\b/i.test(query.replace(/"[^"]*"/g, '""'));
+}